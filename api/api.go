@@ -3,35 +3,94 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/backchannel"
 	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/feature"
 	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/lockout"
+	"github.com/macrat/lauth/mail"
 	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/mfa"
+	"github.com/macrat/lauth/policy"
+	"github.com/macrat/lauth/revocation"
 	"github.com/macrat/lauth/token"
 )
 
 type LauthAPI struct {
+	// inFlight is the number of processing requests. It is at the top of struct for atomic operations on 32-bit platforms.
+	inFlight int64
+
 	Connector    ldap.Connector
 	Config       *config.Config
 	TokenManager token.Manager
+	Policy       policy.Decider
+	Revocation   *revocation.List
+	Lockout      *lockout.Counter
+	Quota        *lockout.Counter
+	Mailer       mail.Sender
+	Backchannel  *backchannel.Store
+	MFA          map[string]mfa.Provider
+	Features     *feature.Flags
+	Build        BuildInfo
+
+	discovery       discoveryCache
+	keyUsage        keyUsageReport
+	requestURICache requestURICache
+	selfTest        selfTestCache
+
+	// rehashWarned is client IDs that already warned about outdated secret hash.
+	rehashWarned sync.Map
 }
 
 func (api *LauthAPI) SetRoutes(r gin.IRoutes) {
 	endpoints := api.Config.EndpointPaths()
 
-	r.GET(endpoints.OpenIDConfiguration, api.GetConfiguration)
-	r.GET(endpoints.Authz, api.GetAuthz)
-	r.POST(endpoints.Authz, api.PostAuthz)
-	r.POST(endpoints.Token, api.PostToken)
-	r.OPTIONS(endpoints.Token, api.OptionsToken)
-	r.GET(endpoints.Userinfo, api.GetUserInfo)
-	r.POST(endpoints.Userinfo, api.PostUserInfo)
-	r.OPTIONS(endpoints.Userinfo, api.OptionsUserInfo)
-	r.GET(endpoints.Jwks, api.GetCerts)
-	r.GET(endpoints.Logout, api.Logout)
-	r.POST(endpoints.Logout, api.Logout)
+	errors.SetDocumentBase(api.Config.Issuer.URL().ResolveReference(&url.URL{Path: endpoints.Errors}))
+
+	r.Use(api.negotiateLocale, api.allHeaders, api.limitConcurrency, api.limitRequest)
+
+	pages := api.pageHeaders
+	apis := api.apiHeaders
+
+	r.GET("/robots.txt", api.GetRobotsTxt)
+	r.GET(endpoints.OpenIDConfiguration, apis, api.GetConfiguration)
+	r.GET(endpoints.Authz, pages, api.GetAuthz)
+	r.POST(endpoints.Authz, pages, api.PostAuthz)
+	r.POST(endpoints.Token, apis, api.PostToken)
+	r.OPTIONS(endpoints.Token, apis, api.OptionsToken)
+	r.GET(endpoints.Userinfo, apis, api.GetUserInfo)
+	r.POST(endpoints.Userinfo, apis, api.PostUserInfo)
+	r.OPTIONS(endpoints.Userinfo, apis, api.OptionsUserInfo)
+	r.GET(endpoints.Jwks, apis, api.GetCerts)
+	r.GET(endpoints.Logout, pages, api.Logout)
+	r.POST(endpoints.Logout, pages, api.Logout)
+	r.GET(endpoints.Register, pages, api.GetRegister)
+	r.POST(endpoints.Register, pages, api.PostRegister)
+	r.GET(endpoints.Invite, pages, api.GetInvite)
+	r.POST(endpoints.Invite, pages, api.PostInvite)
+	r.GET(endpoints.QRCode+".png", apis, api.GetQRCodePNG)
+	r.GET(endpoints.QRCode+".svg", apis, api.GetQRCodeSVG)
+	r.GET(path.Join(endpoints.Errors, ":code"), pages, api.GetErrorCode)
+	r.GET(path.Join(endpoints.Session, "status"), apis, api.GetSessionStatus)
+	r.POST(path.Join(endpoints.Session, "renew"), apis, api.PostSessionRenew)
+	r.POST(endpoints.Backchannel, apis, api.PostBackchannel)
+	r.GET(path.Join(endpoints.Backchannel, "approve"), pages, api.GetBackchannelApprove)
+	r.POST(path.Join(endpoints.Backchannel, "approve"), pages, api.PostBackchannelApprove)
+
+	if api.Config.Admin.Enabled() {
+		r.POST(path.Join(endpoints.Admin, "invitations"), apis, api.PostInvitation)
+		r.GET(path.Join(endpoints.Admin, "features"), apis, api.GetFeatures)
+		r.PATCH(path.Join(endpoints.Admin, "features"), apis, api.PatchFeatures)
+		r.GET(path.Join(endpoints.Admin, "debug/claims"), apis, api.GetClaimsDiagnostics)
+		r.GET(path.Join(endpoints.Admin, "keys/usage"), apis, api.GetKeyUsage)
+		r.GET("/version", apis, api.GetVersion)
+	}
 }
 
 func (api *LauthAPI) SetErrorRoutes(r *gin.Engine) {
@@ -49,9 +108,11 @@ func (api *LauthAPI) SetErrorRoutes(r *gin.Engine) {
 		switch c.Request.URL.Path {
 		case endpoints.Authz:
 			report.SetError(methodNotAllowed)
+			api.pageHeaders(c)
 			errors.SendHTML(c, methodNotAllowed)
 		case endpoints.OpenIDConfiguration, endpoints.Token, endpoints.Userinfo, endpoints.Jwks:
 			report.SetError(methodNotAllowed)
+			api.apiHeaders(c)
 			c.JSON(http.StatusMethodNotAllowed, methodNotAllowed)
 		default:
 			notFound := &errors.Error{
@@ -59,6 +120,7 @@ func (api *LauthAPI) SetErrorRoutes(r *gin.Engine) {
 				Description: "requested page is not found",
 			}
 			report.SetError(notFound)
+			api.pageHeaders(c)
 			errors.SendHTML(c, notFound)
 		}
 	})
@@ -70,7 +132,20 @@ func (api *LauthAPI) GetConfiguration(c *gin.Context) {
 
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	c.IndentedJSON(200, api.Config.OpenIDConfiguration())
+	body, etag, lastModified, err := api.discoveryDocument()
+	if err != nil {
+		report.SetError(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	api.setDiscoveryCacheHeaders(c, etag, lastModified)
+	if notModified(c, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
 func (api *LauthAPI) GetCerts(c *gin.Context) {
@@ -78,6 +153,7 @@ func (api *LauthAPI) GetCerts(c *gin.Context) {
 	defer report.Close()
 
 	c.Header("Access-Control-Allow-Origin", "*")
+	api.publicCache(c)
 
 	keys, err := api.TokenManager.JWKs(api.Config.Issuer.Hostname())
 	if err != nil {
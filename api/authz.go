@@ -2,20 +2,24 @@ package api
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/feature"
 	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/policy"
 	"github.com/macrat/lauth/token"
 )
 
 type AuthzRequest struct {
 	ResponseType string `form:"response_type" json:"response_type" xml:"response_type"`
+	ResponseMode string `form:"response_mode" json:"response_mode" xml:"response_mode"`
 	ClientID     string `form:"client_id"     json:"client_id"     xml:"client_id"`
 	RedirectURI  string `form:"redirect_uri"  json:"redirect_uri"  xml:"redirect_uri"`
 	Scope        string `form:"scope"         json:"scope"         xml:"scope"`
@@ -24,6 +28,9 @@ type AuthzRequest struct {
 	MaxAge       int64  `form:"max_age"       json:"max_age"       xml:"max_age"`
 	Prompt       string `form:"prompt"        json:"prompt"        xml:"prompt"`
 
+	CodeChallenge       string `form:"code_challenge"        json:"code_challenge"        xml:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method" xml:"code_challenge_method"`
+
 	// use only GET method
 	LoginHint  string `form:"login_hint"  json:"login_hint"  xml:"login_hint"`
 	Request    string `form:"request"     json:"request"     xml:"request"`
@@ -32,9 +39,14 @@ type AuthzRequest struct {
 	// use only POST method
 	User     string `form:"username" json:"username" xml:"username"`
 	Password string `form:"password" json:"password" xml:"password"`
+	OTP      string `form:"otp"      json:"otp"      xml:"otp"`
 
 	RequestExpiresAt int64  `form:"-" json:"-" xml:"-"`
 	RequestSubject   string `form:"-" json:"-" xml:"-"`
+	LoginSession     string `form:"-" json:"-" xml:"-"`
+
+	// MFA is the pending second factor, that set after the user entered the correct password.
+	MFA *token.MFAClaims `form:"-" json:"-" xml:"-"`
 }
 
 func (req *AuthzRequest) makeRedirectError(err error, reason errors.Reason, description string) *errors.Error {
@@ -44,12 +56,46 @@ func (req *AuthzRequest) makeRedirectError(err error, reason errors.Reason, desc
 		Err:          err,
 		RedirectURI:  redirectURI,
 		ResponseType: req.ResponseType,
+		ResponseMode: req.effectiveResponseMode(),
+		ClientID:     req.ClientID,
 		State:        req.State,
 		Reason:       reason,
 		Description:  description,
 	}
 }
 
+// effectiveResponseMode returns the response_mode to send the response in.
+//
+// The response_mode is resolved while validating the request, but errors before that and login sessions that started before response_mode was recorded use the default of response_type.
+func (req *AuthzRequest) effectiveResponseMode() string {
+	rt := ParseStringSet(req.ResponseType).String()
+	tokens := rt != "code" && rt != ""
+
+	switch req.ResponseMode {
+	case config.ResponseModeQuery, config.ResponseModeFragment, config.ResponseModeFormPost, config.ResponseModeQueryJWT, config.ResponseModeFragmentJWT, config.ResponseModeFormPostJWT:
+		return req.ResponseMode
+	case config.ResponseModeJWT:
+		if tokens {
+			return config.ResponseModeFragmentJWT
+		}
+		return config.ResponseModeQueryJWT
+	}
+
+	if tokens {
+		return config.ResponseModeFragment
+	}
+	return config.ResponseModeQuery
+}
+
+// usesFragment checks if the response should be sent in the fragment of the redirect URI.
+func (req *AuthzRequest) usesFragment() bool {
+	switch req.effectiveResponseMode() {
+	case config.ResponseModeFragment, config.ResponseModeFragmentJWT:
+		return true
+	}
+	return false
+}
+
 func (req *AuthzRequest) makeNonRedirectError(err error, reason errors.Reason, description string) *errors.Error {
 	return &errors.Error{
 		Err:          err,
@@ -63,12 +109,18 @@ func (req *AuthzRequest) makeNonRedirectError(err error, reason errors.Reason, d
 func (req *AuthzRequest) RequestObjectClaims() token.RequestObjectClaims {
 	return token.RequestObjectClaims{
 		ResponseType: req.ResponseType,
+		ResponseMode: req.ResponseMode,
 		ClientID:     req.ClientID,
 		RedirectURI:  req.RedirectURI,
 		Scope:        req.Scope,
 		State:        req.State,
 		Nonce:        req.Nonce,
 		MaxAge:       req.MaxAge,
+
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+
+		MFA: req.MFA,
 	}
 }
 
@@ -84,37 +136,25 @@ func (req *GetAuthzRequestUnmarshaller) GetRequest() *AuthzRequest {
 }
 
 func (req *GetAuthzRequestUnmarshaller) processRequestObject(api *LauthAPI) *errors.Error {
+	if !api.Features.Enabled(feature.RequestObject) {
+		if req.RequestURI != "" {
+			return req.GetRequest().makeNonRedirectError(nil, errors.RequestURINotSupported, "request_uri is disabled")
+		}
+		if req.Request != "" {
+			return req.GetRequest().makeNonRedirectError(nil, errors.RequestNotSupported, "request is disabled")
+		}
+	}
+
 	errorReason := errors.InvalidRequestObject
 
 	request := req.Request
 	if req.RequestURI != "" {
 		errorReason = errors.InvalidRequestURI
-		resp, err := http.Get(req.RequestURI)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			return req.GetRequest().makeNonRedirectError(
-				err,
-				errorReason,
-				"failed to fetch request object from request_uri",
-			)
-		}
-		defer resp.Body.Close()
-
-		bs, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return req.GetRequest().makeNonRedirectError(
-				err,
-				errorReason,
-				"failed to fetch request object from request_uri",
-			)
-		}
 
-		request = string(bs)
-		if request == "" {
-			return req.GetRequest().makeNonRedirectError(
-				err,
-				errorReason,
-				"failed to fetch request object from request_uri",
-			)
+		var e *requestURIError
+		request, e = api.fetchRequestURI(req.ClientID, req.RequestURI)
+		if e != nil {
+			return req.GetRequest().makeNonRedirectError(e.Err, errorReason, e.Description)
 		}
 	}
 
@@ -151,6 +191,14 @@ func (req *GetAuthzRequestUnmarshaller) processRequestObject(api *LauthAPI) *err
 		mismatches = append(mismatches, "response_type")
 	}
 
+	if claims.ResponseMode != "" {
+		if req.ResponseMode != "" && claims.ResponseMode != req.ResponseMode {
+			mismatches = append(mismatches, "response_mode")
+		} else {
+			req.ResponseMode = claims.ResponseMode
+		}
+	}
+
 	if claims.ClientID != "" && claims.ClientID != req.ClientID {
 		mismatches = append(mismatches, "client_id")
 	}
@@ -211,6 +259,22 @@ func (req *GetAuthzRequestUnmarshaller) processRequestObject(api *LauthAPI) *err
 		}
 	}
 
+	if claims.CodeChallenge != "" {
+		if req.CodeChallenge != "" && claims.CodeChallenge != req.CodeChallenge {
+			mismatches = append(mismatches, "code_challenge")
+		} else {
+			req.CodeChallenge = claims.CodeChallenge
+		}
+	}
+
+	if claims.CodeChallengeMethod != "" {
+		if req.CodeChallengeMethod != "" && claims.CodeChallengeMethod != req.CodeChallengeMethod {
+			mismatches = append(mismatches, "code_challenge_method")
+		} else {
+			req.CodeChallengeMethod = claims.CodeChallengeMethod
+		}
+	}
+
 	if len(mismatches) == 0 {
 		return nil
 	}
@@ -242,7 +306,13 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 			errors.InvalidClient,
 			"client_id is not registered",
 		)
-	} else if !client.RedirectURI.Match(req.RedirectURI) {
+	} else if api.Config.StrictOAuth21() && !client.RedirectURI.MatchExact(req.RedirectURI) {
+		return req.GetRequest().makeNonRedirectError(
+			nil,
+			errors.UnauthorizedClient,
+			"redirect_uri is not registered; OAuth 2.1 requires exactly the same URI as registered",
+		)
+	} else if !client.MatchRedirectURI(req.RedirectURI) {
 		return req.GetRequest().makeNonRedirectError(
 			nil,
 			errors.UnauthorizedClient,
@@ -258,7 +328,12 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 		)
 	}
 
+	// Resolve response_mode before the other checks, so that their errors are sent in the same mode as the success response.
 	rt := ParseStringSet(req.ResponseType)
+	if err := req.resolveResponseMode(api, rt.String() != "code" && rt.String() != ""); err != nil {
+		return err
+	}
+
 	if rt.String() == "" {
 		return req.GetRequest().makeRedirectError(
 			nil,
@@ -273,6 +348,20 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 			err.Error(),
 		)
 	}
+	if rt.String() != "code" && api.Config.StrictOAuth21() {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.UnsupportedResponseType,
+			"implicit/hybrid flow is not allowed in OAuth 2.1; use response_type=code with PKCE",
+		)
+	}
+	if rt.String() != "code" && !api.Features.Enabled(feature.Implicit) {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.UnsupportedResponseType,
+			"implicit/hybrid flow is disabled",
+		)
+	}
 	if !api.Config.Clients[req.ClientID].AllowImplicitFlow && rt.String() != "code" {
 		return req.GetRequest().makeRedirectError(
 			nil,
@@ -298,6 +387,137 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 		)
 	}
 
+	if err := req.filterScopes(api); err != nil {
+		return err
+	}
+
+	return req.validateCodeChallenge(api)
+}
+
+// resolveResponseMode validates response_mode, or sets the default of the config if omitted.
+// The tokens should be true if the response includes access_token or id_token.
+func (req *GetAuthzRequestUnmarshaller) resolveResponseMode(api *LauthAPI, tokens bool) *errors.Error {
+	switch req.ResponseMode {
+	case "":
+		req.ResponseMode = api.Config.ResponseMode.Default(tokens)
+	case config.ResponseModeJWT:
+		req.ResponseMode = config.ResponseModeQueryJWT
+		if tokens {
+			req.ResponseMode = config.ResponseModeFragmentJWT
+		}
+	case config.ResponseModeQuery, config.ResponseModeFragment, config.ResponseModeFragmentJWT, config.ResponseModeFormPost, config.ResponseModeFormPostJWT:
+	case config.ResponseModeQueryJWT:
+		// JARM doesn't allow query.jwt for tokens without encryption, because the tokens are readable in URL.
+		if tokens {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidRequest,
+				fmt.Sprintf("response_mode=query.jwt is not allowed for response_type=%s; use response_mode=fragment.jwt", req.ResponseType),
+			)
+		}
+	default:
+		mode := req.ResponseMode
+		req.ResponseMode = ""
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			fmt.Sprintf("response_mode %#v is not supported; use \"query\", \"fragment\", \"form_post\", \"query.jwt\", \"fragment.jwt\", \"form_post.jwt\", or \"jwt\"", mode),
+		)
+	}
+
+	// Tokens in the query are recorded in browser histories and server logs.
+	if tokens && req.ResponseMode == config.ResponseModeQuery {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			fmt.Sprintf("response_mode=query is not allowed for response_type=%s because it exposes tokens in URL; use response_mode=fragment", req.ResponseType),
+		)
+	}
+
+	return nil
+}
+
+// filterScopes strips or rejects unknown scopes, by the scope registry config.
+func (req *GetAuthzRequestUnmarshaller) filterScopes(api *LauthAPI) *errors.Error {
+	known, unknown := api.Config.FilterScopes(ParseStringSet(req.Scope).List())
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	if api.Config.ScopeRegistry.Unknown == config.UnknownScopeReject {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidScope,
+			fmt.Sprintf("unknown scope: %s", strings.Join(unknown, " ")),
+		)
+	}
+
+	req.Scope = strings.Join(known, " ")
+	return nil
+}
+
+func (req *GetAuthzRequestUnmarshaller) validateCodeChallenge(api *LauthAPI) *errors.Error {
+	client := api.Config.Clients[req.ClientID]
+
+	if req.CodeChallenge == "" {
+		if req.CodeChallengeMethod != "" {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidRequest,
+				"code_challenge is required when set code_challenge_method",
+			)
+		}
+		if api.Config.StrictOAuth21() {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidRequest,
+				"code_challenge is required in OAuth 2.1; use PKCE with code_challenge_method=S256",
+			)
+		}
+		if client.RequirePKCE {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidRequest,
+				"code_challenge is required for this client",
+			)
+		}
+		return nil
+	}
+
+	if !token.ValidCodeChallenge(req.CodeChallenge) {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			"code_challenge must be 43-128 characters of A-Z, a-z, 0-9, and -._~",
+		)
+	}
+
+	switch req.CodeChallengeMethod {
+	case "", "plain":
+		if api.Config.StrictOAuth21() {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidRequest,
+				"code_challenge_method must be S256 in OAuth 2.1",
+			)
+		}
+	case "S256":
+	default:
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			"supported code_challenge_method is plain or S256",
+		)
+	}
+
+	if !client.AllowsPKCEMethod(req.CodeChallengeMethod) {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			fmt.Sprintf("code_challenge_method must be %s for this client", strings.Join(client.PKCEMethods, " or ")),
+		)
+	}
+
 	return nil
 }
 
@@ -312,6 +532,7 @@ type PostAuthzRequestUnmarshaller struct {
 	Request  string `form:"request"  json:"request"  xml:"request"`
 	User     string `form:"username" json:"username" xml:"username"`
 	Password string `form:"password" json:"password" xml:"password"`
+	OTP      string `form:"otp"      json:"otp"      xml:"otp"`
 
 	claims token.RequestObjectClaims
 }
@@ -319,6 +540,7 @@ type PostAuthzRequestUnmarshaller struct {
 func (req *PostAuthzRequestUnmarshaller) GetRequest() *AuthzRequest {
 	return &AuthzRequest{
 		ResponseType: req.claims.ResponseType,
+		ResponseMode: req.claims.ResponseMode,
 		ClientID:     req.claims.ClientID,
 		RedirectURI:  req.claims.RedirectURI,
 		Scope:        req.claims.Scope,
@@ -326,11 +548,18 @@ func (req *PostAuthzRequestUnmarshaller) GetRequest() *AuthzRequest {
 		Nonce:        req.claims.Nonce,
 		MaxAge:       req.claims.MaxAge,
 
+		CodeChallenge:       req.claims.CodeChallenge,
+		CodeChallengeMethod: req.claims.CodeChallengeMethod,
+
 		User:     req.User,
 		Password: req.Password,
+		OTP:      req.OTP,
 
 		RequestExpiresAt: req.claims.ExpiresAt,
 		RequestSubject:   req.claims.Subject,
+		LoginSession:     req.claims.LoginSession,
+
+		MFA: req.claims.MFA,
 	}
 }
 
@@ -359,7 +588,10 @@ func (req *PostAuthzRequestUnmarshaller) PreProcess(api *LauthAPI) *errors.Error
 		)
 	}
 
-	if err = req.claims.Validate(api.Config.Issuer.String(), api.Config.Issuer); err != nil {
+	err = api.validateIssuers(func(issuer *config.URL) error {
+		return req.claims.Validate(issuer.String(), issuer)
+	})
+	if err != nil {
 		return req.GetRequest().makeNonRedirectError(
 			err,
 			errors.InvalidRequestObject,
@@ -375,13 +607,18 @@ type AuthzContext struct {
 	Gin     *gin.Context
 	Request *AuthzRequest
 	Report  *metrics.Context
+
+	// decision is the result of the authorization policy for decisionSubject, that cached by decidePolicy.
+	decision        *policy.Decision
+	decisionSubject string
 }
 
 func NewAuthzContext(api *LauthAPI, c *gin.Context) (*AuthzContext, *errors.Error) {
 	m := metrics.StartAuthz(c)
 
-	c.Header("Cache-Control", "no-store")
-	c.Header("Pragma", "no-cache")
+	noStore(c)
+
+	endParse := m.Step("parse")
 
 	var unmarshaller AuthzRequestUnmarshaller
 	if c.Request.Method == "GET" {
@@ -407,6 +644,7 @@ func NewAuthzContext(api *LauthAPI, c *gin.Context) (*AuthzContext, *errors.Erro
 	}
 
 	req := unmarshaller.GetRequest()
+	endParse()
 
 	m.Set("client_id", req.ClientID)
 	m.Set("response_type", req.ResponseType)
@@ -425,69 +663,142 @@ func (ctx *AuthzContext) Close() error {
 	return ctx.Report.Close()
 }
 
-func (ctx *AuthzContext) MakeRequestObject() (string, error) {
-	expiresAt := time.Now().Add(ctx.API.Config.Expire.Login.Duration())
+// loginExpiresAt returns the time limit of the login session.
+func (ctx *AuthzContext) loginExpiresAt() time.Time {
+	expiresAt := ctx.API.TokenManager.Now().Add(ctx.API.Config.Expire.Login.Duration())
 
 	if 0 < ctx.Request.RequestExpiresAt && ctx.Request.RequestExpiresAt < expiresAt.Unix() {
 		expiresAt = time.Unix(ctx.Request.RequestExpiresAt, 0)
 	}
 
+	return expiresAt
+}
+
+// MakeRequestObject makes the request object for the login page, that bound to the client IP and the login session cookie.
+func (ctx *AuthzContext) MakeRequestObject() (string, error) {
+	expiresAt := ctx.loginExpiresAt()
+
+	session, err := ctx.API.setLoginSession(ctx.Gin, expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	claims := ctx.Request.RequestObjectClaims()
+	claims.LoginSession = session
+
 	return ctx.API.TokenManager.CreateRequestObject(
 		ctx.API.Config.Issuer,
-		ctx.Gin.ClientIP(),
-		ctx.Request.RequestObjectClaims(),
+		ctx.API.clientIP(ctx.Gin),
+		claims,
 		expiresAt,
 	)
 }
 
 func (ctx *AuthzContext) ErrorRedirect(err *errors.Error) {
 	ctx.Report.SetError(err)
-	errors.SendRedirect(ctx.Gin, err)
+	ctx.API.sendAuthzError(ctx.Gin, err)
 }
 
+// sendAuthzError sends an error of the authorization endpoint with the `iss` parameter of RFC 9207.
+func (api *LauthAPI) sendAuthzError(c *gin.Context, err *errors.Error) {
+	err.Issuer = api.Config.Issuer.String()
+	if err.CanRedirect() && (isJWTResponseMode(err.ResponseMode) || isFormPostResponseMode(err.ResponseMode)) {
+		api.sendAuthzErrorResponse(c, err)
+		return
+	}
+	errors.SendRedirect(c, err)
+}
+
+// TrySSO authorizes the request by the SSO session if possible.
+//
+// Requests with prompt=none never show any page; they get login_required if there is no usable session, or consent_required if the user hasn't consented to the client or the scopes yet.
+// The authorized should be true if the user confirmed the request on the page.
 func (ctx *AuthzContext) TrySSO(authorized bool) (proceed bool) {
 	ctx.Report.Set("authn_by", "password")
 
 	prompt := ParseStringSet(ctx.Request.Prompt)
 
-	if prompt.Has("login") || prompt.Has("select_account") || ctx.API.Config.Expire.SSO <= 0 {
+	if prompt.Has("login") || prompt.Has("select_account") {
 		return false
 	}
 
-	token, err := ctx.API.GetSSOToken(ctx.Gin)
-	if err == nil {
-		if ctx.Request.MaxAge <= 0 || ctx.Request.MaxAge > time.Now().Unix()-token.AuthTime {
+	loginRequired := func(description string) bool {
+		if prompt.Has("none") {
 			ctx.Report.Set("authn_by", "sso_token")
-			ctx.Report.Set("username", token.Subject)
+			ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.LoginRequired, description))
+			return true
+		}
+		return false
+	}
+
+	if ctx.API.Config.Expire.SSO <= 0 {
+		return loginRequired("SSO is disabled")
+	}
+	if !ctx.API.Config.Clients[ctx.Request.ClientID].UsesSSO() {
+		return loginRequired("the client doesn't use SSO")
+	}
 
-			if !authorized && (prompt.Has("consent") || !token.Authorized.Includes(ctx.Request.ClientID)) {
-				if prompt.Has("none") {
-					ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.InteractionRequired, ""))
-				} else {
-					ctx.ShowConfirmPage(http.StatusOK, token.Subject)
-				}
+	token, err := ctx.API.GetSSOToken(ctx.Gin)
+	if err != nil {
+		if err != http.ErrNoCookie {
+			ctx.API.DeleteSSOToken(ctx.Gin)
+		}
+		return loginRequired("")
+	}
 
-				return true
-			}
+	if ctx.Request.MaxAge > 0 && ctx.Request.MaxAge <= ctx.API.TokenManager.Now().Unix()-token.AuthTime {
+		return loginRequired("max_age has elapsed since the last login")
+	}
 
-			ctx.API.SetSSOToken(ctx.Gin, token.Subject, ctx.Request.ClientID, false)
-			ctx.SendTokens(token.Subject, time.Unix(token.AuthTime, 0))
+	if len(ctx.API.MFA) > 0 {
+		provider, e := ctx.mfaProvider(nil, token.Subject)
+		if e != nil {
+			ctx.Report.Set("username", token.Subject)
+			ctx.ErrorRedirect(ctx.Request.makeRedirectError(e.Err, e.Reason, e.Description))
 			return true
 		}
-	} else if err != http.ErrNoCookie {
-		ctx.API.DeleteSSOToken(ctx.Gin)
+		if provider != "" && !token.PassedMFA(provider) {
+			return loginRequired("multi-factor authentication is required")
+		}
 	}
 
-	if prompt.Has("none") {
-		ctx.Report.Set("authn_by", "sso_token")
-		ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.LoginRequired, ""))
+	ctx.Report.Set("authn_by", "sso_token")
+	ctx.Report.Set("username", token.Subject)
+	ctx.Report.SetField("sso_id", token.Id)
+
+	if !authorized && (prompt.Has("consent") || !token.Consents.Covers(ctx.Request.ClientID, ctx.Request.Scope)) {
+		if prompt.Has("none") {
+			ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.ConsentRequired, "the user hasn't consented to the client or the requested scope"))
+		} else {
+			ctx.ShowConfirmPage(http.StatusOK, token.Subject)
+		}
 		return true
 	}
 
-	return false
+	ctx.API.SetSSOToken(ctx.Gin, token.Subject, ctx.Request.ClientID, ctx.Request.Scope, false, "")
+	ctx.SendTokens(token.Subject, time.Unix(token.AuthTime, 0))
+	return true
+}
+
+// ScopeDescription is a requested scope and its description to show in the login page.
+type ScopeDescription struct {
+	Name        string
+	Description string
 }
 
-func (ctx *AuthzContext) showPage(code int, authzOnly bool, initialUser, errorDescription string) {
+func (ctx *AuthzContext) scopeDescriptions() []ScopeDescription {
+	scopes := ParseStringSet(ctx.Request.Scope).List()
+	result := make([]ScopeDescription, len(scopes))
+	for i, s := range scopes {
+		result[i] = ScopeDescription{
+			Name:        s,
+			Description: ctx.API.Config.ScopeDescription(s),
+		}
+	}
+	return result
+}
+
+func (ctx *AuthzContext) showPage(code int, authzOnly bool, initialUser, errorDescription, errorDetail string) {
 	requestObject, err := ctx.MakeRequestObject()
 	if err != nil {
 		ctx.ErrorRedirect(ctx.Request.makeRedirectError(err, "server_error", "failed to create login session"))
@@ -506,29 +817,48 @@ func (ctx *AuthzContext) showPage(code int, authzOnly bool, initialUser, errorDe
 		"request":          requestObject,
 		"initial_username": initialUser,
 		"error":            errorDescription,
+		"error_detail":     errorDetail,
 		"authz_only":       authzOnly,
+		"scopes":           ctx.scopeDescriptions(),
+		"autocomplete":     !ctx.API.Config.Login.DisableAutocomplete,
+		"password_toggle":  ctx.API.Config.Login.PasswordToggle,
+	}
+	if ctx.Request.MFA != nil {
+		data["mfa"] = ctx.Request.MFA.Message
+		if ctx.Request.MFA.Message == "" {
+			data["mfa"] = "Enter the verification code."
+		}
 	}
-	ctx.Gin.HTML(code, "login.tmpl", data)
+	ctx.Gin.HTML(code, "login.tmpl", pageDataWithExpiry(ctx.Gin, data, ctx.API.TokenManager.Now(), ctx.loginExpiresAt()))
 }
 
 func (ctx *AuthzContext) ShowLoginPage(code int, initialUser string, errorDescription string) {
 	ctx.Report.Continue()
-	ctx.showPage(code, false, initialUser, errorDescription)
+	ctx.showPage(code, false, initialUser, errorDescription, "")
+}
+
+// ShowLoginFailurePage shows the login page with the reason of failed login like "User not found.".
+// Please use it only for the trusted networks, because the reason tells whether the user exists.
+func (ctx *AuthzContext) ShowLoginFailurePage(code int, initialUser, errorDescription, errorDetail string) {
+	ctx.Report.Continue()
+	ctx.showPage(code, false, initialUser, errorDescription, errorDetail)
 }
 
 func (ctx *AuthzContext) ShowConfirmPage(code int, initialUser string) {
 	ctx.Report.Continue()
-	ctx.showPage(code, true, initialUser, "")
+	ctx.showPage(code, true, initialUser, "", "")
 }
 
 func (ctx *AuthzContext) makeCodeToken(subject string, authTime time.Time) (string, *errors.Error) {
-	code, err := ctx.API.TokenManager.CreateCode(
+	code, err := ctx.API.TokenManager.CreateCodeWithChallenge(
 		ctx.API.Config.Issuer,
 		subject,
 		ctx.Request.ClientID,
 		ctx.Request.RedirectURI,
 		ctx.Request.Scope,
 		ctx.Request.Nonce,
+		ctx.Request.CodeChallenge,
+		ctx.Request.CodeChallengeMethod,
 		authTime,
 		ctx.API.Config.Expire.Code.Duration(),
 	)
@@ -553,60 +883,104 @@ func (ctx *AuthzContext) makeAccessToken(subject string, authTime time.Time) (st
 	return token, nil
 }
 
-func (ctx *AuthzContext) makeIDToken(subject string, authTime time.Time, code, accessToken string) (string, *errors.Error) {
+// idTokenClaims gathers the claims of id_token.
+// It is separated from makeIDToken because it doesn't depend on other tokens, so it can run while signing them.
+func (ctx *AuthzContext) idTokenClaims(subject string) (map[string]interface{}, *errors.Error) {
 	scope := ParseStringSet(ctx.Request.Scope)
-	userinfo, errMsg := ctx.API.userinfo(subject, scope)
+	userinfo, errMsg := ctx.API.idTokenClaims(ctx.Gin, subject, ctx.Request.ClientID, scope)
 	if errMsg != nil {
 		errMsg.RedirectURI, _ = url.Parse(ctx.Request.RedirectURI)
-		return "", errMsg
+		return nil, errMsg
 	}
+	return userinfo, nil
+}
 
-	token, err := ctx.API.TokenManager.CreateIDToken(
-		ctx.API.Config.Issuer,
-		subject,
-		ctx.Request.ClientID,
-		ctx.Request.Nonce,
-		code,
-		accessToken,
-		userinfo,
-		authTime,
-		ctx.API.Config.Expire.Token.Duration(),
-	)
-	if err != nil {
-		return "", ctx.Request.makeRedirectError(err, errors.ServerError, "failed to generate id_token")
+func (ctx *AuthzContext) makeIDToken(subject string, authTime time.Time, userinfo map[string]interface{}, code, accessToken string) (string, *errors.Error) {
+	token, e := ctx.API.createIDToken(subject, ctx.Request.ClientID, ctx.Request.Nonce, code, accessToken, userinfo, authTime)
+	if e != nil {
+		return "", ctx.Request.makeRedirectError(e.Err, e.Reason, e.Description)
 	}
 
 	return token, nil
 }
 
-func (ctx *AuthzContext) makeAuthzTokens(subject string, authTime time.Time) (*url.URL, *errors.Error) {
+// runParallel runs all fs concurrently and waits for them.
+// The first one runs on the current goroutine, so it is the only one that can use gin.Context safely.
+func runParallel(fs ...func()) {
+	if len(fs) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(fs) - 1)
+	for _, f := range fs[1:] {
+		go func(f func()) {
+			defer wg.Done()
+			f()
+		}(f)
+	}
+	fs[0]()
+	wg.Wait()
+}
+
+func (ctx *AuthzContext) makeAuthzTokens(subject string, authTime time.Time) (url.Values, *errors.Error) {
 	resp := make(url.Values)
 
 	if ctx.Request.State != "" {
 		resp.Set("state", ctx.Request.State)
 	}
+	resp.Set("iss", ctx.API.Config.Issuer.String())
 
 	rt := ParseStringSet(ctx.Request.ResponseType)
 
+	// The code, the access_token, and the claims of id_token are independent, so make them in parallel.
+	// Only the id_token has to wait for the others, because it includes their hashes.
+	var (
+		code, accessToken string
+		userinfo          map[string]interface{}
+		codeErr, tokenErr *errors.Error
+		userinfoErr       *errors.Error
+		tasks             []func()
+	)
+	if rt.Has("id_token") {
+		tasks = append(tasks, func() {
+			defer ctx.Report.Step("attributes")()
+			userinfo, userinfoErr = ctx.idTokenClaims(subject)
+		})
+	}
 	if rt.Has("code") {
-		code, err := ctx.makeCodeToken(subject, authTime)
+		tasks = append(tasks, func() {
+			defer ctx.Report.Step("sign_code")()
+			code, codeErr = ctx.makeCodeToken(subject, authTime)
+		})
+	}
+	if rt.Has("token") {
+		tasks = append(tasks, func() {
+			defer ctx.Report.Step("sign_access_token")()
+			accessToken, tokenErr = ctx.makeAccessToken(subject, authTime)
+		})
+	}
+	runParallel(tasks...)
+
+	for _, err := range []*errors.Error{codeErr, tokenErr, userinfoErr} {
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	if rt.Has("code") {
 		resp.Set("code", code)
 	}
 	if rt.Has("token") {
-		token, err := ctx.makeAccessToken(subject, authTime)
-		if err != nil {
-			return nil, err
-		}
 		resp.Set("token_type", "Bearer")
-		resp.Set("access_token", token)
+		resp.Set("access_token", accessToken)
 		resp.Set("scope", ctx.Request.Scope)
 		resp.Set("expires_in", ctx.API.Config.Expire.Token.StrSeconds())
 	}
 	if rt.Has("id_token") {
-		token, err := ctx.makeIDToken(subject, authTime, resp.Get("code"), resp.Get("access_token"))
+		endSign := ctx.Report.Step("sign_id_token")
+		token, err := ctx.makeIDToken(subject, authTime, userinfo, code, accessToken)
+		endSign()
 		if err != nil {
 			return nil, err
 		}
@@ -614,22 +988,59 @@ func (ctx *AuthzContext) makeAuthzTokens(subject string, authTime time.Time) (*u
 		resp.Set("expires_in", ctx.API.Config.Expire.Token.StrSeconds())
 	}
 
-	redirectURI, _ := url.Parse(ctx.Request.RedirectURI)
-	if rt.String() != "code" {
-		redirectURI.Fragment = resp.Encode()
-	} else {
-		redirectURI.RawQuery = resp.Encode()
+	if isJWTResponseMode(ctx.Request.ResponseMode) {
+		defer ctx.Report.Step("sign_response")()
+	}
+	params, err := ctx.API.signAuthzResponse(ctx.Request.ResponseMode, ctx.Request.ClientID, resp)
+	if err != nil {
+		return nil, ctx.Request.makeRedirectError(err, errors.ServerError, "failed to sign authorization response")
+	}
+	return params, nil
+}
+
+// decidePolicy evaluates the authorization policy for the request.
+// The decision is cached, so deciding MFA and issuing tokens share the same evaluation.
+func (ctx *AuthzContext) decidePolicy(subject string) (policy.Decision, *errors.Error) {
+	if ctx.decision != nil && ctx.decisionSubject == subject {
+		return *ctx.decision, nil
+	}
+
+	defer ctx.Report.Step("policy")()
+
+	decision, e := ctx.API.decidePolicy(ctx.Gin, subject, ctx.Request.ClientID, ParseStringSet(ctx.Request.Scope))
+	if e != nil {
+		return policy.Decision{}, e
 	}
-	return redirectURI, nil
+	ctx.decision = &decision
+	ctx.decisionSubject = subject
+	return decision, nil
 }
 
 func (ctx *AuthzContext) SendTokens(subject string, authTime time.Time) {
-	redirect, errMsg := ctx.makeAuthzTokens(subject, authTime)
+	if _, e := ctx.decidePolicy(subject); e != nil {
+		ctx.ErrorRedirect(ctx.Request.makeRedirectError(e.Err, e.Reason, e.Description))
+		return
+	}
+
+	// Codes are counted when exchanged at the token endpoint, so only tokens are counted here.
+	if ctx.Request.ResponseType != "code" {
+		if e := ctx.API.takeQuota(ctx.Report, subject, ctx.Request.ClientID); e != nil {
+			errMsg := ctx.Request.makeRedirectError(e.Err, e.Reason, e.Description)
+			errMsg.Code = e.Code
+			ctx.ErrorRedirect(errMsg)
+			return
+		}
+	}
+
+	params, errMsg := ctx.makeAuthzTokens(subject, authTime)
 
 	if errMsg != nil {
 		ctx.ErrorRedirect(errMsg)
 	} else {
+		emitTokenIssued(ctx.Request.ResponseType, ctx.Request.ClientID, subject, ctx.Request.Scope, false)
 		ctx.Report.Success()
-		ctx.Gin.Redirect(http.StatusFound, redirect.String())
+		defer ctx.Report.Step("redirect")()
+		redirectURI, _ := url.Parse(ctx.Request.RedirectURI)
+		ctx.API.sendAuthzResponse(ctx.Gin, redirectURI, ctx.Request.ResponseMode, ctx.Request.usesFragment(), params)
 	}
 }
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// authzResponseExpire is the lifetime of JARM responses.
+// The client reads it right after the redirect, so it is short as recommended by the spec.
+const authzResponseExpire = 10 * time.Minute
+
+// isJWTResponseMode checks if the response_mode is one of JARM (JWT Secured Authorization Response Mode).
+func isJWTResponseMode(mode string) bool {
+	switch mode {
+	case config.ResponseModeQueryJWT, config.ResponseModeFragmentJWT, config.ResponseModeFormPostJWT, config.ResponseModeJWT:
+		return true
+	}
+	return false
+}
+
+// isFormPostResponseMode checks if the response should be sent by an auto-submitting form, rather than a redirect.
+func isFormPostResponseMode(mode string) bool {
+	return mode == config.ResponseModeFormPost || mode == config.ResponseModeFormPostJWT
+}
+
+// signAuthzResponse signs params as a JWT and returns the `response` parameter if the response_mode is JARM.
+// Otherwise it returns params as is.
+func (api *LauthAPI) signAuthzResponse(responseMode, clientID string, params url.Values) (url.Values, error) {
+	if !isJWTResponseMode(responseMode) {
+		return params, nil
+	}
+
+	resp, err := api.TokenManager.CreateAuthzResponse(api.Config.Issuer, clientID, params, authzResponseExpire)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{"response": {resp}}, nil
+}
+
+// formPostParam is a hidden input of the form_post page.
+type formPostParam struct {
+	Name  string
+	Value string
+}
+
+// sendAuthzResponse sends params of the authorization response to the client.
+//
+// It redirects with params in the query or the fragment of redirectURI, or shows a form that posts params to redirectURI if the response_mode is form_post.
+func (api *LauthAPI) sendAuthzResponse(c *gin.Context, redirectURI *url.URL, responseMode string, fragment bool, params url.Values) {
+	if isFormPostResponseMode(responseMode) {
+		names := make([]string, 0, len(params))
+		for k := range params {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		inputs := make([]formPostParam, len(names))
+		for i, k := range names {
+			inputs[i] = formPostParam{k, params.Get(k)}
+		}
+
+		noStore(c)
+		c.HTML(http.StatusOK, "form_post.tmpl", pageData(c, gin.H{
+			"redirect_uri": redirectURI.String(),
+			"params":       inputs,
+		}))
+		return
+	}
+
+	if fragment {
+		redirectURI.Fragment = params.Encode()
+	} else {
+		redirectURI.RawQuery = params.Encode()
+	}
+	c.Redirect(http.StatusFound, redirectURI.String())
+}
+
+// sendAuthzErrorResponse sends an error of the authorization endpoint in JARM or form_post.
+func (api *LauthAPI) sendAuthzErrorResponse(c *gin.Context, err *errors.Error) {
+	params, e := api.signAuthzResponse(err.ResponseMode, err.ClientID, err.RedirectParams())
+	if e != nil {
+		log.Error().Err(e).Msg("failed to sign authorization response")
+		errors.SendHTML(c, &errors.Error{
+			Err:         e,
+			Reason:      errors.ServerError,
+			Description: "failed to sign authorization response",
+		})
+		return
+	}
+
+	redirectURI := *err.RedirectURI
+	api.sendAuthzResponse(c, &redirectURI, err.ResponseMode, err.UsesFragment(), params)
+}
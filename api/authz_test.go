@@ -1,14 +1,17 @@
 package api_test
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/macrat/lauth/api"
 	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
 )
 
 func authzEndpointCommonTests(t *testing.T, c *config.Config) []testutil.RedirectTest {
@@ -167,6 +170,7 @@ func TestSSOLogin(t *testing.T) {
 	if resp.Code != http.StatusOK {
 		t.Fatalf("unexpected status code on prompt=consent with SSO token: %d", resp.Code)
 	}
+	consentCookies := resp.Result().Cookies()
 
 	inputs, err := testutil.FindInputsByHTML(resp.Body)
 	if err != nil {
@@ -191,6 +195,9 @@ func TestSSOLogin(t *testing.T) {
 	for _, c := range rawCookie {
 		req.Header.Add("Cookie", c)
 	}
+	for _, c := range consentCookies {
+		req.AddCookie(c)
+	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
 	resp = env.DoRequest(req)
@@ -230,11 +237,12 @@ func TestSSOLogin(t *testing.T) {
 	if resp.Code != http.StatusFound {
 		t.Fatalf("unexpected status code on another client with SSO token: %d", resp.Code)
 	}
+	consentCookies = resp.Result().Cookies()
 
 	location, err = url.Parse(resp.Header().Get("Location"))
 	if err != nil {
 		t.Errorf("failed to parse location: %s", err)
-	} else if errMsg := location.Query().Get("error"); errMsg != "interaction_required" {
+	} else if errMsg := location.Query().Get("error"); errMsg != "consent_required" {
 		t.Errorf("unexpected error message: %#v", errMsg)
 	}
 
@@ -254,6 +262,7 @@ func TestSSOLogin(t *testing.T) {
 	if resp.Code != http.StatusOK {
 		t.Fatalf("unexpected status code on another client with SSO token: %d", resp.Code)
 	}
+	consentCookies = resp.Result().Cookies()
 
 	inputs, err = testutil.FindInputsByHTML(resp.Body)
 	if err != nil {
@@ -277,6 +286,9 @@ func TestSSOLogin(t *testing.T) {
 	for _, c := range rawCookie {
 		req.Header.Add("Cookie", c)
 	}
+	for _, c := range consentCookies {
+		req.AddCookie(c)
+	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
 	resp = env.DoRequest(req)
@@ -331,3 +343,167 @@ func TestSSOLogin(t *testing.T) {
 		t.Errorf("auth_time is not match: sso_token=%s != code=%s", ssoToken.Subject, code.Subject)
 	}
 }
+
+func TestTrySSO_PromptNone(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	makeSSOToken := func(consents token.Consents, authTime time.Time) string {
+		t.Helper()
+
+		ssoToken, err := env.API.TokenManager.CreateSSOToken(
+			env.API.Config.Issuer,
+			"some-session",
+			"macrat",
+			"",
+			token.AuthorizedParties{"some_client_id"},
+			consents,
+			authTime,
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("failed to create SSO token: %s", err)
+		}
+		return ssoToken
+	}
+
+	consented := makeSSOToken(token.Consents{"some_client_id": "openid profile"}, time.Now())
+	oldLogin := makeSSOToken(token.Consents{"some_client_id": "openid profile"}, time.Now().Add(-time.Hour))
+	otherClient := makeSSOToken(token.Consents{"implicit_client_id": "openid"}, time.Now())
+
+	tests := []struct {
+		Name     string
+		SSOToken string
+		Scope    string
+		Prompt   string
+		MaxAge   string
+		Code     int
+		Error    string
+	}{
+		{Name: "no session", Scope: "openid", Prompt: "none", Code: http.StatusFound, Error: "login_required"},
+		{Name: "consented", SSOToken: consented, Scope: "openid profile", Prompt: "none", Code: http.StatusFound},
+		{Name: "narrower scope", SSOToken: consented, Scope: "openid", Prompt: "none", Code: http.StatusFound},
+		{Name: "expanded scope", SSOToken: consented, Scope: "openid email", Prompt: "none", Code: http.StatusFound, Error: "consent_required"},
+		{Name: "expanded scope with page", SSOToken: consented, Scope: "openid email", Code: http.StatusOK},
+		{Name: "not consented client", SSOToken: otherClient, Scope: "openid", Prompt: "none", Code: http.StatusFound, Error: "consent_required"},
+		{Name: "max_age elapsed", SSOToken: oldLogin, Scope: "openid", Prompt: "none", MaxAge: "60", Code: http.StatusFound, Error: "login_required"},
+		{Name: "max_age not elapsed", SSOToken: oldLogin, Scope: "openid", Prompt: "none", MaxAge: "7200", Code: http.StatusFound},
+		{Name: "with other prompt", SSOToken: consented, Scope: "openid", Prompt: "none consent", Code: http.StatusFound, Error: "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			params := url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {tt.Scope},
+			}
+			if tt.Prompt != "" {
+				params.Set("prompt", tt.Prompt)
+			}
+			if tt.MaxAge != "" {
+				params.Set("max_age", tt.MaxAge)
+			}
+
+			req, _ := http.NewRequest("GET", "/authz?"+params.Encode(), nil)
+			if tt.SSOToken != "" {
+				req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, tt.SSOToken))
+			}
+			resp := env.DoRequest(req)
+
+			if resp.Code != tt.Code {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+			if resp.Code != http.StatusFound {
+				return
+			}
+
+			loc, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("failed to parse location: %s", err)
+			}
+			if e := loc.Query().Get("error"); e != tt.Error {
+				t.Errorf("expected error %#v but got %#v", tt.Error, e)
+			}
+			if tt.Error == "" && loc.Query().Get("code") == "" {
+				t.Errorf("code is not issued: %s", loc)
+			}
+		})
+	}
+
+	t.Run("SSO disabled", func(t *testing.T) {
+		env.API.Config.Expire.SSO = 0
+
+		params := url.Values{
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+			"client_id":     {"some_client_id"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"prompt":        {"none"},
+		}
+		resp := env.Get("/authz", "", params)
+		if loc, err := url.Parse(resp.Header().Get("Location")); err != nil {
+			t.Fatalf("failed to parse location: %s", err)
+		} else if e := loc.Query().Get("error"); e != "login_required" {
+			t.Errorf("expected login_required but got %#v", e)
+		}
+	})
+}
+
+func TestTrySSO_RecordsConsent(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": "openid"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	request, err := env.API.TokenManager.CreateRequestObject(
+		env.API.Config.Issuer,
+		"::1",
+		token.RequestObjectClaims{
+			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
+			RedirectURI:  "http://some-client.example.com/callback",
+			ResponseType: "code",
+			Scope:        "openid email",
+		},
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("faield to make request: %s", err)
+	}
+
+	req, _ := http.NewRequest("POST", "/authz", strings.NewReader(url.Values{"request": {request}}.Encode()))
+	req.RemoteAddr = "[::1]:54321"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+	req.AddCookie(&http.Cookie{Name: api.LOGIN_SESSION_COOKIE, Value: testutil.LoginSession})
+	resp := env.DoRequest(req)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("failed to confirm: status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var renewed string
+	for _, c := range resp.Result().Cookies() {
+		if c.Name == api.SSO_TOKEN_COOKIE {
+			renewed = c.Value
+		}
+	}
+	claims, err := env.API.TokenManager.ParseSSOToken(renewed)
+	if err != nil {
+		t.Fatalf("failed to parse SSO token: %s", err)
+	}
+	if !claims.Consents.Covers("some_client_id", "openid email") {
+		t.Errorf("consent was not recorded: %#v", claims.Consents)
+	}
+}
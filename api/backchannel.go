@@ -0,0 +1,498 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/backchannel"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// BackchannelInterval is the minimum interval for clients to poll the result of backchannel authentication requests.
+	BackchannelInterval = 5 * time.Second
+
+	// MaxBindingMessageLength is the maximum number of characters of binding_message.
+	// It is shown to the user with the request, so it should be short enough to compare with the client's screen.
+	MaxBindingMessageLength = 64
+)
+
+type BackchannelRequest struct {
+	ClientID       string `form:"client_id"        json:"client_id"        xml:"client_id"`
+	ClientSecret   string `form:"client_secret"    json:"client_secret"    xml:"client_secret"`
+	Scope          string `form:"scope"            json:"scope"            xml:"scope"`
+	LoginHint      string `form:"login_hint"       json:"login_hint"       xml:"login_hint"`
+	LoginHintToken string `form:"login_hint_token" json:"login_hint_token" xml:"login_hint_token"`
+	IDTokenHint    string `form:"id_token_hint"    json:"id_token_hint"    xml:"id_token_hint"`
+	BindingMessage string `form:"binding_message"  json:"binding_message"  xml:"binding_message"`
+
+	// AuthMethod is the token_endpoint_auth_method that the client used, detected in Bind.
+	AuthMethod string `form:"-" json:"-" xml:"-"`
+}
+
+type BackchannelResponse struct {
+	AuthReqID string `json:"auth_req_id"`
+	ExpiresIn int64  `json:"expires_in"`
+	Interval  int64  `json:"interval"`
+}
+
+type BackchannelApproveRequest struct {
+	Key      string `form:"key"      json:"key"      xml:"key"`
+	Password string `form:"password" json:"password" xml:"password"`
+	Action   string `form:"action"   json:"action"   xml:"action"`
+}
+
+func (req *BackchannelRequest) Bind(c *gin.Context) *errors.Error {
+	if err := c.ShouldBind(req); err != nil {
+		return &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidRequest,
+			Description: "failed to parse request",
+		}
+	}
+	req.AuthMethod = config.TokenEndpointAuthClientSecretPost
+	if u, p, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = u
+		req.ClientSecret = p
+		req.AuthMethod = config.TokenEndpointAuthClientSecretBasic
+	}
+	return nil
+}
+
+func (req BackchannelRequest) Validate(conf *config.Config) *errors.Error {
+	if err := authenticateClient(conf, req.ClientID, req.ClientSecret, req.AuthMethod); err != nil {
+		return err
+	}
+
+	if !conf.Clients[req.ClientID].AllowBackchannel {
+		return &errors.Error{
+			Reason:      errors.UnauthorizedClient,
+			Description: "backchannel authentication is not allowed for this client",
+		}
+	}
+
+	if !ParseStringSet(req.Scope).Has("openid") {
+		return &errors.Error{
+			Reason:      errors.InvalidScope,
+			Description: "scope must include openid",
+		}
+	}
+
+	if req.LoginHintToken != "" || req.IDTokenHint != "" {
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "login_hint_token and id_token_hint are not supported; use login_hint",
+		}
+	}
+	if req.LoginHint == "" {
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "login_hint is required",
+		}
+	}
+
+	if utf8.RuneCountInString(req.BindingMessage) > MaxBindingMessageLength {
+		return &errors.Error{
+			Reason:      errors.InvalidBindingMessage,
+			Description: fmt.Sprintf("binding_message must be %d characters or less", MaxBindingMessageLength),
+		}
+	}
+	if strings.IndexFunc(req.BindingMessage, unicode.IsControl) >= 0 {
+		return &errors.Error{
+			Reason:      errors.InvalidBindingMessage,
+			Description: "binding_message can't include control characters",
+		}
+	}
+
+	return nil
+}
+
+func (req *BackchannelRequest) BindAndValidate(c *gin.Context, conf *config.Config) *errors.Error {
+	if err := req.Bind(c); err != nil {
+		return err
+	}
+	return req.Validate(conf)
+}
+
+// PostBackchannel is the backchannel authentication endpoint of CIBA (Client-Initiated Backchannel Authentication).
+//
+// It sends the approval link to the email address of the user, and the client polls the result from the token endpoint.
+func (api *LauthAPI) PostBackchannel(c *gin.Context) {
+	report := metrics.StartBackchannel(c)
+	defer report.Close()
+
+	noStore(c)
+
+	report.Set("step", "request")
+
+	var req BackchannelRequest
+	if err := (&req).BindAndValidate(c, api.Config); err != nil {
+		report.Set("client_id", req.ClientID)
+		report.SetError(err)
+		errors.SendJSON(c, err)
+		return
+	}
+	report.Set("client_id", req.ClientID)
+
+	username := api.Config.Login.NormalizeUsername(req.LoginHint)
+	report.Set("username", username)
+
+	known, unknown := api.Config.FilterScopes(ParseStringSet(req.Scope).List())
+	if len(unknown) > 0 && api.Config.ScopeRegistry.Unknown == config.UnknownScopeReject {
+		e := &errors.Error{
+			Reason:      errors.InvalidScope,
+			Description: fmt.Sprintf("unknown scope: %s", strings.Join(unknown, " ")),
+		}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to connecting LDAP server")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to connecting LDAP server"}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+	defer conn.Close()
+
+	attr := api.Config.Login.NotifyAttribute
+	attrs, err := conn.GetUserAttributes(username, []string{attr})
+	if err == ldap.UserNotFoundError {
+		e := &errors.Error{Err: err, Reason: errors.UnknownUserID, Description: "user is not found"}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	} else if err != nil {
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to get user information"}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	} else if len(attrs[attr]) == 0 || attrs[attr][0] == "" {
+		e := &errors.Error{Reason: errors.UnknownUserID, Description: "user has no email address to send the request"}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	if api.Mailer == nil {
+		e := &errors.Error{Reason: errors.ServerError, Description: "email sender is not configured"}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	now := api.TokenManager.Now()
+	expiresIn := api.Config.Expire.Backchannel.Duration()
+	breq, err := api.Backchannel.Add(backchannel.Request{
+		ClientID:       req.ClientID,
+		Subject:        username,
+		Scope:          strings.Join(known, " "),
+		BindingMessage: req.BindingMessage,
+		ExpiresAt:      now.Add(expiresIn),
+		Interval:       BackchannelInterval,
+	}, now)
+	if err != nil {
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to create backchannel authentication request"}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	clientName := api.Config.Clients[req.ClientID].Name
+	if clientName == "" {
+		clientName = req.ClientID
+	}
+
+	link := *api.Config.Issuer.URL()
+	link.Path = path.Join(api.Config.EndpointPaths().Backchannel, "approve")
+	link.RawQuery = url.Values{"key": {breq.ApprovalKey}}.Encode()
+
+	message := ""
+	if req.BindingMessage != "" {
+		message = fmt.Sprintf("Please make sure that %s shows this message: %s\n\n", clientName, req.BindingMessage)
+	}
+	body := fmt.Sprintf("Hello %s,\n\n%s is requesting to sign in with your account.\n\n%sPlease open the link below to approve or deny the request.\n\n%s\n\nThis link expires in %s.\nIf you didn't expect this, please deny the request.\n", username, clientName, message, link.String(), api.Config.Expire.Backchannel)
+
+	if err := api.Mailer.Send(attrs[attr][0], "Sign in request from "+clientName, body); err != nil {
+		log.Error().Err(err).Msg("failed to send backchannel authentication request")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to send the request to the user"}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	report.Continue()
+	c.JSON(http.StatusOK, BackchannelResponse{
+		AuthReqID: breq.ID,
+		ExpiresIn: int64(expiresIn.Seconds()),
+		Interval:  int64(BackchannelInterval.Seconds()),
+	})
+}
+
+// findBackchannelRequest finds the pending request of the approval link.
+func (api *LauthAPI) findBackchannelRequest(key string) (backchannel.Request, *errors.Error) {
+	req, err := api.Backchannel.Find(key, api.TokenManager.Now())
+	if err != nil {
+		return req, &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidRequest,
+			Description: "sign in request is invalid, expired, or already answered",
+		}
+	}
+	return req, nil
+}
+
+func (api *LauthAPI) backchannelPageData(c *gin.Context, req backchannel.Request, data gin.H) gin.H {
+	client := api.Config.Clients[req.ClientID]
+
+	scopes := ParseStringSet(req.Scope).List()
+	descriptions := make([]ScopeDescription, len(scopes))
+	for i, s := range scopes {
+		descriptions[i] = ScopeDescription{
+			Name:        s,
+			Description: api.Config.ScopeDescription(s),
+		}
+	}
+
+	data["step"] = "confirm"
+	data["key"] = req.ApprovalKey
+	data["username"] = req.Subject
+	data["binding_message"] = req.BindingMessage
+	data["client"] = gin.H{
+		"ID":      req.ClientID,
+		"Name":    client.Name,
+		"IconURL": client.IconURL,
+	}
+	data["scopes"] = descriptions
+	return pageDataWithExpiry(c, data, api.TokenManager.Now(), req.ExpiresAt)
+}
+
+// GetBackchannelApprove shows the page to approve or deny the backchannel authentication request.
+func (api *LauthAPI) GetBackchannelApprove(c *gin.Context) {
+	report := metrics.StartBackchannel(c)
+	defer report.Close()
+
+	noStore(c)
+
+	report.Set("step", "confirm")
+
+	req, e := api.findBackchannelRequest(c.Query("key"))
+	if e != nil {
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	report.Set("client_id", req.ClientID)
+	report.Set("username", req.Subject)
+
+	report.Continue()
+	c.HTML(http.StatusOK, "backchannel.tmpl", api.backchannelPageData(c, req, gin.H{}))
+}
+
+// PostBackchannelApprove approves the backchannel authentication request after checking the password of the user, or denies it.
+func (api *LauthAPI) PostBackchannelApprove(c *gin.Context) {
+	report := metrics.StartBackchannel(c)
+	defer report.Close()
+
+	noStore(c)
+
+	var form BackchannelApproveRequest
+	if err := c.ShouldBind(&form); err != nil {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "failed to parse request"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	report.Set("step", "answer")
+
+	req, e := api.findBackchannelRequest(form.Key)
+	if e != nil {
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	report.Set("client_id", req.ClientID)
+	report.Set("username", req.Subject)
+
+	switch form.Action {
+	case "deny":
+		if err := api.Backchannel.Deny(form.Key, api.TokenManager.Now()); err != nil {
+			e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "sign in request is invalid, expired, or already answered"}
+			report.SetError(e)
+			errors.SendHTML(c, e)
+			return
+		}
+		report.Success()
+		c.HTML(http.StatusOK, "backchannel.tmpl", pageData(c, gin.H{"step": "denied"}))
+		return
+	case "approve":
+	default:
+		e := &errors.Error{Reason: errors.InvalidRequest, Description: "action must be approve or deny"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	loginStart := time.Now()
+	showForm := func(description string) {
+		if latency := api.Config.Login.FailureLatency.Duration(); latency > 0 {
+			EqualizeDelay(loginStart, latency)
+		} else {
+			RandomDelay()
+		}
+		report.UserError()
+		c.HTML(http.StatusForbidden, "backchannel.tmpl", api.backchannelPageData(c, req, gin.H{
+			"error": description,
+		}))
+	}
+
+	if api.isLockedOut(req.Subject) {
+		showForm("Invalid password.")
+		return
+	}
+
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to connecting LDAP server")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to connecting LDAP server"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	defer conn.Close()
+
+	if err := conn.LoginTest(req.Subject, form.Password); err != nil {
+		api.recordLoginFailure(c, report, nil, req.Subject, err)
+		showForm("Invalid password.")
+		return
+	}
+
+	decision, e := api.decidePolicy(c, req.Subject, req.ClientID, ParseStringSet(req.Scope))
+	if e != nil {
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	if e := api.checkMFAWithoutPage(c, report, conn, req.Subject, req.ClientID, decision); e != nil {
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	api.resetLoginFailures(req.Subject)
+
+	if err := api.Backchannel.Approve(form.Key, api.TokenManager.Now()); err != nil {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "sign in request is invalid, expired, or already answered"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	report.Success()
+	c.HTML(http.StatusOK, "backchannel.tmpl", pageData(c, gin.H{"step": "approved"}))
+}
+
+// postTokenWithBackchannel handles the CIBA grant, that the client polls the result of the backchannel authentication request.
+func (api *LauthAPI) postTokenWithBackchannel(c *gin.Context, req PostTokenRequest, report *metrics.Context) (*PostTokenResponse, *errors.Error) {
+	if !api.Config.Clients[req.ClientID].AllowBackchannel {
+		return nil, &errors.Error{
+			Reason:      errors.UnauthorizedClient,
+			Description: "backchannel authentication is not allowed for this client",
+		}
+	}
+
+	breq, err := api.Backchannel.Poll(req.AuthReqID, req.ClientID, api.TokenManager.Now())
+	switch err {
+	case nil:
+	case backchannel.PendingError:
+		return nil, &errors.Error{Err: err, Reason: errors.AuthorizationPending, Description: "the user hasn't approved the request yet"}
+	case backchannel.SlowDownError:
+		return nil, &errors.Error{Err: err, Reason: errors.SlowDown, Description: "polling too frequently; please increase the interval by 5 seconds"}
+	case backchannel.DeniedError:
+		return nil, &errors.Error{Err: err, Reason: errors.AccessDenied, Description: "the user denied the request"}
+	case backchannel.ExpiredError:
+		return nil, &errors.Error{Err: err, Reason: errors.ExpiredToken, Description: "the request is expired"}
+	default:
+		return nil, &errors.Error{Err: err, Reason: errors.InvalidGrant}
+	}
+	report.Set("username", breq.Subject)
+
+	scope := ParseStringSet(breq.Scope)
+
+	if e := api.checkPolicy(c, breq.Subject, breq.ClientID, scope); e != nil {
+		return nil, e
+	}
+
+	if e := api.takeQuota(report, breq.Subject, breq.ClientID); e != nil {
+		return nil, e
+	}
+
+	accessToken, err := api.TokenManager.CreateAccessToken(
+		api.Config.Issuer,
+		breq.Subject,
+		breq.ClientID,
+		scope.String(),
+		breq.AuthTime,
+		api.Config.Expire.Token.Duration(),
+	)
+	if err != nil {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to generate access_token",
+		}
+	}
+
+	userinfo, errMsg := api.idTokenClaims(c, breq.Subject, breq.ClientID, scope)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	idToken, errMsg := api.createIDToken(breq.Subject, breq.ClientID, "", "", accessToken, userinfo, breq.AuthTime)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+
+	refreshToken := ""
+	if api.issuesRefreshToken(scope) {
+		refreshToken, err = api.TokenManager.CreateRefreshToken(
+			api.Config.Issuer,
+			breq.Subject,
+			breq.ClientID,
+			scope.String(),
+			"",
+			breq.AuthTime,
+			api.Config.Expire.Refresh.Duration(),
+		)
+		if err != nil {
+			return nil, &errors.Error{
+				Err:         err,
+				Reason:      errors.ServerError,
+				Description: "failed to generate refresh_token",
+			}
+		}
+	}
+
+	emitTokenIssued(config.GrantTypeCIBA, breq.ClientID, breq.Subject, scope.String(), refreshToken != "")
+
+	return &PostTokenResponse{
+		TokenType:    "Bearer",
+		AccessToken:  accessToken,
+		IDToken:      idToken,
+		ExpiresIn:    api.Config.Expire.Token.IntSeconds(),
+		Scope:        scope.String(),
+		RefreshToken: refreshToken,
+	}, nil
+}
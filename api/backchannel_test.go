@@ -0,0 +1,292 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+)
+
+func setupBackchannel(t *testing.T) (*testutil.APITestEnvironment, *DummyMailer) {
+	t.Helper()
+
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+	env.API.Config.Login.NotifyAttribute = "mail"
+	env.API.Config.Expire.Backchannel = config.Duration(5 * time.Minute)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowBackchannel = true
+	env.API.Config.Clients["some_client_id"] = client
+
+	mailer := &DummyMailer{}
+	env.API.Mailer = mailer
+
+	return env, mailer
+}
+
+var approvalKeyPattern = regexp.MustCompile(`/backchannel/approve\?key=([^\s]+)`)
+
+func approvalKey(t *testing.T, mail DummyMail) string {
+	t.Helper()
+
+	m := approvalKeyPattern.FindStringSubmatch(mail.Body)
+	if m == nil {
+		t.Fatalf("approval link is not found in the email:\n%s", mail.Body)
+	}
+	key, err := url.QueryUnescape(m[1])
+	if err != nil {
+		t.Fatalf("failed to parse approval link: %s", err)
+	}
+	return key
+}
+
+func TestPostBackchannel(t *testing.T) {
+	env, _ := setupBackchannel(t)
+
+	tests := []struct {
+		Name    string
+		Request url.Values
+		Code    int
+		Error   string
+	}{
+		{
+			Name:    "without client secret",
+			Request: url.Values{"client_id": {"some_client_id"}, "scope": {"openid"}, "login_hint": {"macrat"}},
+			Code:    http.StatusBadRequest,
+			Error:   "invalid_request",
+		},
+		{
+			Name:    "wrong client secret",
+			Request: url.Values{"client_id": {"some_client_id"}, "client_secret": {"wrong"}, "scope": {"openid"}, "login_hint": {"macrat"}},
+			Code:    http.StatusBadRequest,
+			Error:   "invalid_client",
+		},
+		{
+			Name:    "not allowed client",
+			Request: url.Values{"client_id": {"implicit_client_id"}, "client_secret": {"secret for implicit-client"}, "scope": {"openid"}, "login_hint": {"macrat"}},
+			Code:    http.StatusBadRequest,
+			Error:   "unauthorized_client",
+		},
+		{
+			Name:    "without openid",
+			Request: url.Values{"client_id": {"some_client_id"}, "client_secret": {"secret for some-client"}, "scope": {"profile"}, "login_hint": {"macrat"}},
+			Code:    http.StatusBadRequest,
+			Error:   "invalid_scope",
+		},
+		{
+			Name:    "without login_hint",
+			Request: url.Values{"client_id": {"some_client_id"}, "client_secret": {"secret for some-client"}, "scope": {"openid"}},
+			Code:    http.StatusBadRequest,
+			Error:   "invalid_request",
+		},
+		{
+			Name:    "id_token_hint",
+			Request: url.Values{"client_id": {"some_client_id"}, "client_secret": {"secret for some-client"}, "scope": {"openid"}, "id_token_hint": {"xxx"}},
+			Code:    http.StatusBadRequest,
+			Error:   "invalid_request",
+		},
+		{
+			Name:    "unknown user",
+			Request: url.Values{"client_id": {"some_client_id"}, "client_secret": {"secret for some-client"}, "scope": {"openid"}, "login_hint": {"nobody"}},
+			Code:    http.StatusBadRequest,
+			Error:   "unknown_user_id",
+		},
+		{
+			Name:    "too long binding_message",
+			Request: url.Values{"client_id": {"some_client_id"}, "client_secret": {"secret for some-client"}, "scope": {"openid"}, "login_hint": {"macrat"}, "binding_message": {strings.Repeat("a", 65)}},
+			Code:    http.StatusBadRequest,
+			Error:   "invalid_binding_message",
+		},
+		{
+			Name:    "success",
+			Request: url.Values{"client_id": {"some_client_id"}, "client_secret": {"secret for some-client"}, "scope": {"openid"}, "login_hint": {"macrat"}},
+			Code:    http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			resp := env.Post("/backchannel", "", tt.Request)
+			if resp.Code != tt.Code {
+				t.Fatalf("expected status code %d but got %d: %s", tt.Code, resp.Code, resp.Body.String())
+			}
+			if tt.Error != "" && !strings.Contains(resp.Body.String(), `"error":"`+tt.Error+`"`) {
+				t.Errorf("expected error %s but got %s", tt.Error, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestBackchannel_Discovery(t *testing.T) {
+	env, _ := setupBackchannel(t)
+
+	c := env.API.Config.OpenIDConfiguration()
+	if c.GrantTypesSupported[len(c.GrantTypesSupported)-1] != "urn:openid:params:grant-type:ciba" {
+		t.Errorf("CIBA grant is not advertised: %#v", c.GrantTypesSupported)
+	}
+	if c.BackchannelAuthenticationEndpoint != env.API.Config.Issuer.String()+"/backchannel" {
+		t.Errorf("unexpected backchannel_authentication_endpoint: %s", c.BackchannelAuthenticationEndpoint)
+	}
+	if strings.Join(c.BackchannelTokenDeliveryModesSupported, ",") != "poll" {
+		t.Errorf("unexpected backchannel_token_delivery_modes_supported: %#v", c.BackchannelTokenDeliveryModesSupported)
+	}
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowBackchannel = false
+	env.API.Config.Clients["some_client_id"] = client
+
+	if c := env.API.Config.OpenIDConfiguration(); c.BackchannelAuthenticationEndpoint != "" {
+		t.Errorf("backchannel authentication should not be advertised if no client allows it: %s", c.BackchannelAuthenticationEndpoint)
+	}
+}
+
+func TestBackchannel_Approve(t *testing.T) {
+	env, mailer := setupBackchannel(t)
+	rp := env.SomeClientRP()
+
+	resp := env.Post("/backchannel", "", url.Values{
+		"client_id":       {"some_client_id"},
+		"client_secret":   {"secret for some-client"},
+		"scope":           {"openid profile"},
+		"login_hint":      {"macrat"},
+		"binding_message": {"A7X2"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to start backchannel authentication: %s", resp.Body.String())
+	}
+	authReqID := regexp.MustCompile(`"auth_req_id":"([^"]+)"`).FindStringSubmatch(resp.Body.String())
+	if authReqID == nil || !strings.Contains(resp.Body.String(), `"interval":5`) {
+		t.Fatalf("unexpected response: %s", resp.Body.String())
+	}
+
+	if len(mailer.Sent) != 1 || mailer.Sent[0].To != "m@crat.jp" {
+		t.Fatalf("unexpected emails: %#v", mailer.Sent)
+	}
+	if !strings.Contains(mailer.Sent[0].Body, "A7X2") {
+		t.Errorf("email should include binding_message:\n%s", mailer.Sent[0].Body)
+	}
+	if strings.Contains(mailer.Sent[0].Body, authReqID[1]) {
+		t.Errorf("email should not include auth_req_id:\n%s", mailer.Sent[0].Body)
+	}
+	key := approvalKey(t, mailer.Sent[0])
+
+	poll := url.Values{
+		"grant_type":  {"urn:openid:params:grant-type:ciba"},
+		"auth_req_id": {authReqID[1]},
+	}
+	if token := rp.Token(t, poll); token.Error != "authorization_pending" {
+		t.Errorf("expected authorization_pending but got %#v", token)
+	}
+	if token := rp.Token(t, poll); token.Error != "slow_down" {
+		t.Errorf("expected slow_down but got %#v", token)
+	}
+
+	page := env.Get("/backchannel/approve", "", url.Values{"key": {key}})
+	if page.Code != http.StatusOK {
+		t.Fatalf("failed to get approval page: %d", page.Code)
+	}
+	if !strings.Contains(page.Body.String(), "A7X2") {
+		t.Errorf("approval page should show binding_message")
+	}
+	testutil.AssertAccessible(t, "backchannel.tmpl", page.Body.Bytes())
+
+	if resp := env.Post("/backchannel/approve", "", url.Values{"key": {key}, "action": {"approve"}, "password": {"wrong"}}); resp.Code != http.StatusForbidden {
+		t.Fatalf("wrong password should not approve: status code %d", resp.Code)
+	}
+	if token := rp.Token(t, poll); token.Error == "" {
+		t.Fatalf("wrong password should not approve: %#v", token)
+	}
+
+	if resp := env.Post("/backchannel/approve", "", url.Values{"key": {key}, "action": {"approve"}, "password": {"foobar"}}); resp.Code != http.StatusOK {
+		t.Fatalf("failed to approve: status code %d", resp.Code)
+	}
+
+	token := rp.Token(t, poll)
+	if token.Code != http.StatusOK || token.IDToken == "" || token.AccessToken == "" {
+		t.Fatalf("failed to get tokens: %#v", token)
+	}
+	idToken, err := env.API.TokenManager.ParseIDToken(token.IDToken)
+	if err != nil {
+		t.Fatalf("failed to parse id_token: %s", err)
+	}
+	if idToken.Subject != "macrat" {
+		t.Errorf("unexpected subject: %s", idToken.Subject)
+	}
+	if token.Scope != "openid profile" {
+		t.Errorf("unexpected scope: %s", token.Scope)
+	}
+
+	if token := rp.Token(t, poll); token.Error != "invalid_grant" {
+		t.Errorf("auth_req_id should be used only once: %#v", token)
+	}
+	if resp := env.Get("/backchannel/approve", "", url.Values{"key": {key}}); resp.Code != http.StatusBadRequest {
+		t.Errorf("approval link should be used only once: status code %d", resp.Code)
+	}
+}
+
+func TestBackchannel_Deny(t *testing.T) {
+	env, mailer := setupBackchannel(t)
+	rp := env.SomeClientRP()
+
+	resp := env.Post("/backchannel", "", url.Values{
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"scope":         {"openid"},
+		"login_hint":    {"macrat"},
+	})
+	authReqID := regexp.MustCompile(`"auth_req_id":"([^"]+)"`).FindStringSubmatch(resp.Body.String())
+	if authReqID == nil {
+		t.Fatalf("unexpected response: %s", resp.Body.String())
+	}
+	key := approvalKey(t, mailer.Sent[0])
+
+	if resp := env.Post("/backchannel/approve", "", url.Values{"key": {key}, "action": {"deny"}}); resp.Code != http.StatusOK {
+		t.Fatalf("failed to deny: status code %d", resp.Code)
+	}
+
+	poll := url.Values{
+		"grant_type":  {"urn:openid:params:grant-type:ciba"},
+		"auth_req_id": {authReqID[1]},
+	}
+	if token := rp.Token(t, poll); token.Error != "access_denied" {
+		t.Errorf("expected access_denied but got %#v", token)
+	}
+}
+
+func TestBackchannel_Expire(t *testing.T) {
+	env, mailer := setupBackchannel(t)
+	clock := env.UseFakeClock(time.Now())
+	rp := env.SomeClientRP()
+
+	resp := env.Post("/backchannel", "", url.Values{
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"scope":         {"openid"},
+		"login_hint":    {"macrat"},
+	})
+	authReqID := regexp.MustCompile(`"auth_req_id":"([^"]+)"`).FindStringSubmatch(resp.Body.String())
+	if authReqID == nil {
+		t.Fatalf("unexpected response: %s", resp.Body.String())
+	}
+	key := approvalKey(t, mailer.Sent[0])
+
+	clock.Advance(10 * time.Minute)
+
+	if resp := env.Post("/backchannel/approve", "", url.Values{"key": {key}, "action": {"approve"}, "password": {"foobar"}}); resp.Code != http.StatusBadRequest {
+		t.Errorf("expired request should not be approved: status code %d", resp.Code)
+	}
+
+	token := rp.Token(t, url.Values{
+		"grant_type":  {"urn:openid:params:grant-type:ciba"},
+		"auth_req_id": {authReqID[1]},
+	})
+	if token.Error != "expired_token" {
+		t.Errorf("expected expired_token but got %#v", token)
+	}
+}
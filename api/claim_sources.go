@@ -0,0 +1,44 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/claimsource"
+	"github.com/macrat/lauth/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// enrichAttributes merges attributes from the claim sources into attrs.
+//
+// Failures of sources are only logged unless the source is required, so a down HR system doesn't block logins.
+func (api *LauthAPI) enrichAttributes(c *gin.Context, subject string, attrs map[string][]string) *errors.Error {
+	for _, s := range api.Config.ClaimSources {
+		src := claimsource.HTTPSource{
+			URL:     s.URL,
+			Timeout: time.Duration(s.Timeout),
+			Headers: s.Headers,
+		}
+
+		values, err := src.Fetch(c.Request.Context(), subject, s.Attributes)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("claim_source", s.Name).
+				Str("username", subject).
+				Msg("failed to get attributes from claim source")
+
+			if s.Required {
+				return &errors.Error{
+					Err:         err,
+					Reason:      errors.ServerError,
+					Description: "failed to get user info",
+				}
+			}
+			continue
+		}
+
+		s.Merge(attrs, values)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// clientIP returns the address of the client for security decisions like the policy and MFA.
+// X-Forwarded-For is trusted only from --trusted-proxies, so clients can't pretend to be in the internal network.
+func (api *LauthAPI) clientIP(c *gin.Context) string {
+	return api.Config.Server.ClientIP(c.Request.RemoteAddr, c.GetHeader("X-Forwarded-For"))
+}
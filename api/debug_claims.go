@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// ClaimDiagnostic is how a claim of a scope is made for the user, in the response of the claims diagnostics API.
+type ClaimDiagnostic struct {
+	Scope      string      `json:"scope"`
+	Claim      string      `json:"claim"`
+	Attributes []string    `json:"attributes"`
+	Found      bool        `json:"found"`
+	Value      interface{} `json:"value,omitempty"`
+	Problem    string      `json:"problem,omitempty"`
+}
+
+// ClaimsDiagnosticsResponse is the response of the claims diagnostics API.
+type ClaimsDiagnosticsResponse struct {
+	User       string              `json:"user"`
+	Attributes map[string][]string `json:"attributes"`
+	Claims     []ClaimDiagnostic   `json:"claims"`
+}
+
+func isEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice:
+		return rv.Len() == 0
+	}
+	return false
+}
+
+func quoteAttributes(attrs []string) string {
+	quoted := make([]string, len(attrs))
+	for i, a := range attrs {
+		quoted[i] = fmt.Sprintf("%#v", a)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// diagnoseClaims applies all claims of all scopes to the attributes.
+// Problems of each claim are reported in the result instead of failing, so all claims can be checked at once.
+func (api *LauthAPI) diagnoseClaims(attrs map[string][]string) []ClaimDiagnostic {
+	scopes := api.Config.Scopes.ScopeNames()
+	sort.Strings(scopes)
+
+	result := []ClaimDiagnostic{}
+	for _, scope := range scopes {
+		for _, claim := range api.Config.Scopes[scope] {
+			d := ClaimDiagnostic{
+				Scope:      scope,
+				Claim:      claim.Claim,
+				Attributes: claim.Attributes(),
+			}
+
+			hasValue := false
+			for _, a := range d.Attributes {
+				if len(attrs[a]) > 0 {
+					hasValue = true
+				}
+			}
+
+			value, ok := claim.Apply(attrs)
+			switch {
+			case !hasValue:
+				d.Problem = fmt.Sprintf("The user has no value in %s.", quoteAttributes(d.Attributes))
+			case !ok:
+				d.Problem = "Failed to make the value. Please check the template."
+			case isEmptyValue(value):
+				d.Problem = "All values are dropped by the transforms like regex or include."
+			default:
+				d.Found = true
+				d.Value = value
+			}
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// GetClaimsDiagnostics is the admin API to show how LDAP attributes of the user are mapped to claims.
+//
+// It responds the attributes that found, and the claims of all scopes with values or problems,
+// to debug missing claims without issuing tokens.
+func (api *LauthAPI) GetClaimsDiagnostics(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	if e := api.requireAdmin(c); e != nil {
+		report.SetError(e)
+		return
+	}
+
+	username := api.Config.Login.NormalizeUsername(c.Query("user"))
+	if username == "" {
+		e := &errors.Error{Reason: errors.InvalidRequest, Description: "user is required"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+	log.Info().Str("username", username).Msg("claims diagnostics requested by admin")
+
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to connecting LDAP server")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to connecting LDAP server"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+	defer conn.Close()
+
+	attrs, err := conn.GetUserAttributes(username, api.Config.Scopes.AttributesFor(api.Config.Scopes.ScopeNames()))
+	if err == ldap.UserNotFoundError {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "user is not found"}
+		report.SetError(e)
+		api.sendAdminError(c, http.StatusNotFound, e)
+		return
+	} else if err != nil {
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to get user information"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+	if e := api.enrichAttributes(c, username, attrs); e != nil {
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+
+	found := make(map[string][]string)
+	for name, values := range attrs {
+		if len(values) > 0 {
+			found[name] = values
+		}
+	}
+
+	c.JSON(http.StatusOK, ClaimsDiagnosticsResponse{
+		User:       username,
+		Attributes: found,
+		Claims:     api.diagnoseClaims(attrs),
+	})
+}
@@ -0,0 +1,70 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestGetClaimsDiagnostics(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Scopes = config.ScopeConfig{
+		"profile": {
+			{Claim: "name", Attribute: "displayName", Type: "string"},
+			{Claim: "nickname", Attribute: "nickName", Type: "string"},
+		},
+		"groups": {
+			{Claim: "groups", Attribute: "memberOf", Type: "[]string", RDN: true, Include: []string{"vpn-*"}},
+		},
+	}
+
+	request := func(query, password string) (int, api.ClaimsDiagnosticsResponse) {
+		req, _ := http.NewRequest("GET", "/admin/debug/claims"+query, nil)
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+		resp := env.DoRequest(req)
+
+		var r api.ClaimsDiagnosticsResponse
+		json.Unmarshal(resp.Body.Bytes(), &r)
+		return resp.Code, r
+	}
+
+	if code, _ := request("?user=macrat", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without credentials but got %d", code)
+	}
+	if code, _ := request("", "admin password"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without user but got %d", code)
+	}
+	if code, _ := request("?user=nobody", "admin password"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown user but got %d", code)
+	}
+
+	code, resp := request("?user=macrat", "admin password")
+	if code != http.StatusOK {
+		t.Fatalf("failed to get diagnostics: %d", code)
+	}
+	if resp.User != "macrat" {
+		t.Errorf("unexpected user: %#v", resp.User)
+	}
+	if !reflect.DeepEqual(resp.Attributes["displayName"], []string{"SHIDA Yuuma"}) || len(resp.Attributes["memberOf"]) != 2 {
+		t.Errorf("unexpected attributes: %#v", resp.Attributes)
+	}
+	if _, ok := resp.Attributes["nickName"]; ok {
+		t.Errorf("attributes without values should not be included: %#v", resp.Attributes)
+	}
+
+	expect := []api.ClaimDiagnostic{
+		{Scope: "groups", Claim: "groups", Attributes: []string{"memberOf"}, Problem: "All values are dropped by the transforms like regex or include."},
+		{Scope: "profile", Claim: "name", Attributes: []string{"displayName"}, Found: true, Value: "SHIDA Yuuma"},
+		{Scope: "profile", Claim: "nickname", Attributes: []string{"nickName"}, Problem: `The user has no value in "nickName".`},
+	}
+	if !reflect.DeepEqual(resp.Claims, expect) {
+		t.Errorf("unexpected claims:\nexpected: %#v\n but got: %#v", expect, resp.Claims)
+	}
+}
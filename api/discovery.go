@@ -0,0 +1,82 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+)
+
+// discoveryCache keeps the rendered discovery document until the config is replaced or feature flags change.
+type discoveryCache struct {
+	sync.Mutex
+
+	config       *config.Config
+	features     uint64
+	body         []byte
+	etag         string
+	lastModified time.Time
+}
+
+// discoveryDocument returns the rendered discovery document, its ETag, and when it was generated.
+func (api *LauthAPI) discoveryDocument() (body []byte, etag string, lastModified time.Time, err error) {
+	// The config is not changed after startup, so comparing the pointer is enough and much cheaper than Config.Hash.
+	conf := api.Config
+	features := api.Features.Version()
+
+	cache := &api.discovery
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.body == nil || cache.config != conf || cache.features != features {
+		body, err := json.MarshalIndent(api.openIDConfiguration(), "", "    ")
+		if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		sum := sha256.Sum256(body)
+
+		cache.config = conf
+		cache.features = features
+		cache.body = body
+		cache.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		cache.lastModified = time.Now().UTC().Truncate(time.Second)
+	}
+
+	return cache.body, cache.etag, cache.lastModified, nil
+}
+
+// matchETag checks if the If-None-Match header contains etag.
+func matchETag(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified checks conditional request headers against the cached document.
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		return matchETag(inm, etag)
+	}
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !lastModified.After(t)
+	}
+	return false
+}
+
+func (api *LauthAPI) setDiscoveryCacheHeaders(c *gin.Context, etag string, lastModified time.Time) {
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	api.publicCache(c)
+}
@@ -0,0 +1,82 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/feature"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestGetConfiguration_Cache(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.DiscoveryMaxAge = config.Duration(time.Hour)
+
+	get := func(header map[string]string) *http.Response {
+		req, _ := http.NewRequest("GET", "/.well-known/openid-configuration", nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		return env.DoRequest(req).Result()
+	}
+
+	resp := get(nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("unexpected Cache-Control: %#v", cc)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("ETag header is not set")
+	}
+	lastModified := resp.Header.Get("Last-Modified")
+	if _, err := http.ParseTime(lastModified); err != nil {
+		t.Fatalf("failed to parse Last-Modified: %#v: %s", lastModified, err)
+	}
+
+	tests := []struct {
+		Header map[string]string
+		Code   int
+	}{
+		{map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{map[string]string{"If-None-Match": `"other", ` + etag}, http.StatusNotModified},
+		{map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified},
+		{map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"}, http.StatusOK},
+		{map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp := get(tt.Header)
+		if resp.StatusCode != tt.Code {
+			t.Errorf("%v: expected status code %d but got %d", tt.Header, tt.Code, resp.StatusCode)
+		}
+		if resp.Header.Get("ETag") != etag {
+			t.Errorf("%v: ETag changed: %#v", tt.Header, resp.Header.Get("ETag"))
+		}
+	}
+
+	env.API.Features.Set(feature.Implicit, false)
+	if resp := get(map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected to regenerate after feature changed but got status code %d", resp.StatusCode)
+	} else if resp.Header.Get("ETag") == etag {
+		t.Errorf("ETag is not changed after feature changed")
+	}
+
+	env.API.Features.Set(feature.Implicit, true)
+	conf := *env.API.Config
+	conf.Scopes = nil
+	env.API.Config = &conf
+	if resp := get(map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected to regenerate after config changed but got status code %d", resp.StatusCode)
+	}
+
+	env.API.Config.DiscoveryMaxAge = 0
+	if cc := get(nil).Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("unexpected Cache-Control when max-age is 0: %#v", cc)
+	}
+}
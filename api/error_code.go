@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/page"
+)
+
+// GetErrorCode shows the explanation of the error code, that linked from error_uri and error pages.
+func (api *LauthAPI) GetErrorCode(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	info, ok := errors.LookupCode(errors.Code(c.Param("code")))
+	if !ok {
+		e := &errors.Error{
+			Reason:      errors.PageNotFound,
+			Description: "unknown error code",
+		}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	c.HTML(http.StatusOK, "error_code.tmpl", gin.H{
+		"info":      info,
+		"locale":    page.GetLocale(c),
+		"csp_nonce": page.GetCSPNonce(c),
+	})
+}
@@ -0,0 +1,44 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestGetErrorCode(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	resp := env.Get("/errors/LA3001", "", nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	body := resp.Body.String()
+	for _, expected := range []string{"LA3001: Invalid grant", "invalid_grant", "Please sign in again."} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %#v in the page but not included", expected)
+		}
+	}
+	testutil.AssertAccessible(t, "error code page", resp.Body.Bytes())
+
+	resp = env.Get("/errors/LA9999", "", nil)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code for unknown code: %d", resp.Code)
+	}
+}
+
+func TestErrorPage_Code(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	resp := env.Get("/no-such-page", "", nil)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+
+	link := `<a href="` + env.API.Config.Issuer.String() + `/errors/LA1010">LA1010</a>`
+	if !strings.Contains(resp.Body.String(), link) {
+		t.Errorf("expected link to error code page but not included:\n%s", resp.Body.String())
+	}
+}
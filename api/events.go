@@ -0,0 +1,20 @@
+package api
+
+import (
+	"github.com/macrat/lauth/events"
+)
+
+// emitTokenIssued publishes the token lifecycle event.
+// issuedBy is the grant_type of the token endpoint, or the response_type of the authorization endpoint.
+func emitTokenIssued(issuedBy, clientID, subject, scope string, refreshToken bool) {
+	fields := map[string]string{
+		"issued_by": issuedBy,
+		"client_id": clientID,
+		"username":  subject,
+		"scope":     scope,
+	}
+	if refreshToken {
+		fields["refresh_token"] = "true"
+	}
+	events.Emit(events.TypeTokenIssued, fields)
+}
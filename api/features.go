@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/feature"
+	"github.com/macrat/lauth/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// FeaturesResponse is the response of the admin API for feature flags.
+type FeaturesResponse struct {
+	Features map[string]bool `json:"features"`
+}
+
+func removeString(xs []string, x string) []string {
+	result := make([]string, 0, len(xs))
+	for _, s := range xs {
+		if s != x {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// openIDConfiguration makes the discovery metadata that reflects the current feature flags.
+func (api *LauthAPI) openIDConfiguration() config.OpenIDConfiguration {
+	c := api.Config.OpenIDConfiguration()
+
+	if !api.Features.Enabled(feature.Implicit) {
+		c.ResponseTypesSupported = []string{"code"}
+		c.ResponseModesSupported = []string{"query", "form_post", "query.jwt", "form_post.jwt", "jwt"}
+		c.GrantTypesSupported = removeString(c.GrantTypesSupported, "implicit")
+	}
+	if !api.Features.Enabled(feature.RefreshToken) {
+		c.GrantTypesSupported = removeString(c.GrantTypesSupported, "refresh_token")
+	}
+	if !api.Features.Enabled(feature.RequestObject) {
+		c.RequestParameterSupported = false
+		c.RequestURIParameterSupported = false
+	}
+
+	return c
+}
+
+// requireAdmin responds and returns error if the request doesn't have admin credentials.
+func (api *LauthAPI) requireAdmin(c *gin.Context) *errors.Error {
+	if api.checkAdmin(c) {
+		return nil
+	}
+
+	e := &errors.Error{
+		Reason:      errors.AccessDenied,
+		Description: "admin credentials are required",
+	}
+	c.Header("WWW-Authenticate", "Basic realm=\"Lauth Admin\"")
+	api.sendAdminError(c, http.StatusUnauthorized, e)
+	return e
+}
+
+// GetFeatures is the admin API to get the current state of feature flags.
+func (api *LauthAPI) GetFeatures(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	if e := api.requireAdmin(c); e != nil {
+		report.SetError(e)
+		return
+	}
+
+	c.JSON(http.StatusOK, FeaturesResponse{api.Features.All()})
+}
+
+// PatchFeatures is the admin API to toggle feature flags at runtime.
+//
+// The request body is a JSON object like `{"implicit": false}`.
+// Features that not included in the body are kept as is.
+// The changes are not persisted, so the config file is used again after restart.
+func (api *LauthAPI) PatchFeatures(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	if e := api.requireAdmin(c); e != nil {
+		report.SetError(e)
+		return
+	}
+
+	var req map[string]bool
+	if err := c.ShouldBindJSON(&req); err != nil {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "request body must be a JSON object of feature names and booleans"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+
+	for name := range req {
+		if _, ok := feature.Defaults[name]; !ok {
+			e := &errors.Error{Reason: errors.InvalidRequest, Description: feature.UnknownFeatureError(name).Error()}
+			report.SetError(e)
+			api.sendAdminError(c, e.StatusCode(), e)
+			return
+		}
+	}
+
+	for name, enabled := range req {
+		api.Features.Set(name, enabled)
+		log.Info().Str("feature", name).Bool("enabled", enabled).Msg("feature flag changed")
+	}
+
+	c.JSON(http.StatusOK, FeaturesResponse{api.Features.All()})
+}
@@ -0,0 +1,161 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/feature"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestFeatures_AdminAPI(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	request := func(method, body, password string) (int, api.FeaturesResponse) {
+		req, _ := http.NewRequest(method, "/admin/features", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+		resp := env.DoRequest(req)
+
+		var r api.FeaturesResponse
+		json.Unmarshal(resp.Body.Bytes(), &r)
+		return resp.Code, r
+	}
+
+	if code, _ := request("GET", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without credentials but got %d", code)
+	}
+	if code, _ := request("PATCH", `{"implicit": false}`, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with wrong credentials but got %d", code)
+	}
+	if !env.API.Features.Enabled(feature.Implicit) {
+		t.Fatalf("feature changed without credentials")
+	}
+
+	code, resp := request("GET", "", "admin password")
+	if code != http.StatusOK {
+		t.Fatalf("failed to get features: %d", code)
+	}
+	if !resp.Features[feature.Implicit] || !resp.Features[feature.RefreshToken] {
+		t.Errorf("unexpected features: %#v", resp.Features)
+	}
+
+	if code, _ := request("PATCH", `{"unknown": true}`, "admin password"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown feature but got %d", code)
+	}
+	if code, _ := request("PATCH", `{"implicit": "no"}`, "admin password"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid value but got %d", code)
+	}
+
+	code, resp = request("PATCH", `{"implicit": false}`, "admin password")
+	if code != http.StatusOK {
+		t.Fatalf("failed to patch features: %d", code)
+	}
+	if resp.Features[feature.Implicit] || !resp.Features[feature.RefreshToken] {
+		t.Errorf("unexpected features: %#v", resp.Features)
+	}
+	if env.API.Features.Enabled(feature.Implicit) {
+		t.Errorf("implicit is still enabled")
+	}
+}
+
+func TestFeatures_Discovery(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	get := func() (c config.OpenIDConfiguration) {
+		resp := env.Get("/.well-known/openid-configuration", "", nil)
+		if err := json.Unmarshal(resp.Body.Bytes(), &c); err != nil {
+			t.Fatalf("failed to parse discovery: %s", err)
+		}
+		return
+	}
+
+	c := get()
+	if len(c.ResponseTypesSupported) == 1 || !c.RequestParameterSupported {
+		t.Errorf("unexpected discovery in default: %#v", c)
+	}
+
+	env.API.Features.Set(feature.Implicit, false)
+	env.API.Features.Set(feature.RefreshToken, false)
+	env.API.Features.Set(feature.RequestObject, false)
+
+	c = get()
+	if strings.Join(c.ResponseTypesSupported, ",") != "code" {
+		t.Errorf("unexpected response types: %#v", c.ResponseTypesSupported)
+	}
+	if strings.Join(c.GrantTypesSupported, ",") != "authorization_code" {
+		t.Errorf("unexpected grant types: %#v", c.GrantTypesSupported)
+	}
+	if c.RequestParameterSupported || c.RequestURIParameterSupported {
+		t.Errorf("request object should not be supported")
+	}
+}
+
+func TestFeatures_Handlers(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	env.API.Features.Set(feature.Implicit, false)
+	env.API.Features.Set(feature.RequestObject, false)
+	env.API.Features.Set(feature.QRCode, false)
+	env.API.Features.Set(feature.RefreshToken, false)
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "code",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"code"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "implicit",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"code token"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"unsupported_response_type"},
+				"iss":               {env.API.Config.Issuer.String()},
+				"error_description": {"implicit/hybrid flow is disabled"},
+			},
+		},
+		{
+			Name: "request_uri",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"request_uri":   {"http://some-client.example.com/request"},
+			},
+			Code:         http.StatusBadRequest,
+			BodyIncludes: []string{"request_uri_not_supported"},
+		},
+	})
+
+	resp := env.Post("/token", "", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {"dummy"},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+	})
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "unsupported_grant_type") {
+		t.Errorf("expected unsupported_grant_type for disabled refresh_token but got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	issuer := env.API.Config.Issuer.String()
+	if resp := env.Get("/qrcode.svg", "", url.Values{"data": {issuer}}); resp.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for disabled QR code but got %d", resp.Code)
+	}
+}
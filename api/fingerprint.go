@@ -0,0 +1,52 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+)
+
+var (
+	minorVersionRe = regexp.MustCompile(`([0-9]+)(\.[0-9.]+)+`)
+)
+
+// userAgentMajor drops minor versions from User-Agent, for keep the fingerprint stable through browser updates.
+func userAgentMajor(ua string) string {
+	return minorVersionRe.ReplaceAllString(strings.TrimSpace(ua), "$1")
+}
+
+// ipPrefix returns /24 network for IPv4 or /64 network for IPv6.
+func ipPrefix(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// SSOFingerprint calculates the hash of browser characteristics to bind SSO token.
+//
+// It returns empty string if binding is disabled.
+func (api *LauthAPI) SSOFingerprint(c *gin.Context) string {
+	var source string
+
+	switch api.Config.SSO.Binding {
+	case config.SSOBindingLoose:
+		source = "ua:" + userAgentMajor(c.Request.UserAgent())
+	case config.SSOBindingStrict:
+		source = "ua:" + userAgentMajor(c.Request.UserAgent()) + "\nip:" + ipPrefix(api.clientIP(c))
+	default:
+		return ""
+	}
+
+	h := sha256.Sum256([]byte(source))
+	return base64.RawURLEncoding.EncodeToString(h[:16])
+}
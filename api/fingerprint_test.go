@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestSSOBinding(t *testing.T) {
+	const (
+		firefox    = "Mozilla/5.0 (X11; Linux x86_64; rv:115.0) Gecko/20100101 Firefox/115.0"
+		firefoxNew = "Mozilla/5.0 (X11; Linux x86_64; rv:115.0) Gecko/20100101 Firefox/115.3.1"
+		chrome     = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36"
+	)
+
+	tests := []struct {
+		Binding   string
+		UserAgent string
+		Remote    string
+		CanSSO    bool
+	}{
+		{config.SSOBindingOff, chrome, "198.51.100.1:1234", true},
+		{config.SSOBindingLoose, firefox, "198.51.100.1:1234", true},
+		{config.SSOBindingLoose, firefoxNew, "198.51.100.1:1234", true},
+		{config.SSOBindingLoose, chrome, "203.0.113.1:1234", false},
+		{config.SSOBindingStrict, firefoxNew, "203.0.113.200:1234", true},
+		{config.SSOBindingStrict, firefox, "198.51.100.1:1234", false},
+		{config.SSOBindingStrict, chrome, "203.0.113.1:1234", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.Binding, tt.Remote), func(t *testing.T) {
+			env := testutil.NewAPITestEnvironment(t)
+			env.API.Config.SSO.Binding = tt.Binding
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest("GET", "/authz", nil)
+			c.Request.Header.Set("User-Agent", firefox)
+			c.Request.RemoteAddr = "203.0.113.5:1234"
+
+			ssoToken, err := env.API.TokenManager.CreateSSOToken(
+				env.API.Config.Issuer,
+				"session-id",
+				"macrat",
+				env.API.SSOFingerprint(c),
+				token.AuthorizedParties{"some_client_id"},
+				token.Consents{"some_client_id": token.ConsentAnyScope},
+				time.Now(),
+				time.Now().Add(10*time.Minute),
+			)
+			if err != nil {
+				t.Fatalf("failed to create SSO token: %s", err)
+			}
+
+			query := url.Values{
+				"response_type": {"code"},
+				"client_id":     {"some_client_id"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"scope":         {"openid"},
+				"prompt":        {"none"},
+			}
+			req, _ := http.NewRequest("GET", "/authz?"+query.Encode(), nil)
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+			req.Header.Set("User-Agent", tt.UserAgent)
+			req.RemoteAddr = tt.Remote
+			resp := env.DoRequest(req)
+
+			loc, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("failed to parse location: %s", err)
+			}
+
+			if tt.CanSSO && loc.Query().Get("code") == "" {
+				t.Errorf("expected SSO success but failed: %s", loc)
+			}
+			if !tt.CanSSO && loc.Query().Get("error") != "login_required" {
+				t.Errorf("expected login_required but got: %s", loc)
+			}
+		})
+	}
+}
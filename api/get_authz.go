@@ -10,7 +10,7 @@ import (
 func (api *LauthAPI) GetAuthz(c *gin.Context) {
 	ctx, err := NewAuthzContext(api, c)
 	if err != nil {
-		errors.SendRedirect(c, err)
+		api.sendAuthzError(c, err)
 		return
 	}
 	defer ctx.Close()
@@ -20,6 +20,11 @@ func (api *LauthAPI) GetAuthz(c *gin.Context) {
 		return
 	}
 
+	if api.redirectToRegister(c) {
+		ctx.Report.Continue()
+		return
+	}
+
 	if proceed := ctx.TrySSO(false); proceed {
 		return
 	}
@@ -1,14 +1,18 @@
 package api_test
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/testutil"
 	"github.com/macrat/lauth/token"
 )
@@ -84,6 +88,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"unsupported_response_type"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"response_type is required"},
 			},
 			Fragment: url.Values{},
@@ -100,6 +105,7 @@ func TestGetAuthz(t *testing.T) {
 			Query:       url.Values{},
 			Fragment: url.Values{
 				"error":             {"unsupported_response_type"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"response_type \"hogefuga\" is not supported"},
 			},
 		},
@@ -169,6 +175,7 @@ func TestGetAuthz(t *testing.T) {
 			Query:       url.Values{},
 			Fragment: url.Values{
 				"error":             {"unsupported_response_type"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"implicit/hybrid flow is disallowed"},
 			},
 		},
@@ -202,6 +209,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request_object"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"mismatch query parameter and request object: response_type, client_id, redirect_uri, scope, state"},
 				"state":             {"this is state"},
 			},
@@ -237,6 +245,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request_object"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"mismatch query parameter and request object: nonce, max_age, prompt, login_hint"},
 				"state":             {"this is state"},
 			},
@@ -272,6 +281,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"prompt=none can't use same time with login, select_account, or consent"},
 			},
 			Fragment: url.Values{},
@@ -364,6 +374,7 @@ func TestGetAuthz(t *testing.T) {
 			Query:       url.Values{},
 			Fragment: url.Values{
 				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"nonce is required in the implicit/hybrid flow of OpenID Connect"},
 			},
 		},
@@ -379,6 +390,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"prompt=none can't use same time with login, select_account, or consent"},
 			},
 			Fragment: url.Values{},
@@ -395,6 +407,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"prompt=none can't use same time with login, select_account, or consent"},
 			},
 			Fragment: url.Values{},
@@ -411,6 +424,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"prompt=none can't use same time with login, select_account, or consent"},
 			},
 			Fragment: url.Values{},
@@ -427,6 +441,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error": {"login_required"},
+				"iss":   {env.API.Config.Issuer.String()},
 			},
 			Fragment: url.Values{},
 		},
@@ -443,6 +458,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
 				"error_description": {"can't set username or password in GET method"},
 			},
 			Fragment: url.Values{},
@@ -508,6 +524,52 @@ func TestGetAuthz_LoginExpires(t *testing.T) {
 	}
 }
 
+func TestGetAuthz_UnknownScope(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	query := url.Values{
+		"client_id":     {"some_client_id"},
+		"response_type": {"code"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid something profile"},
+	}
+
+	resp := env.Get("/authz", "", query)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+
+	inputs, err := testutil.FindInputsByHTML(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to get inputs: %s", err)
+	}
+	claims, err := env.API.TokenManager.ParseRequestObject(inputs["request"], "")
+	if err != nil {
+		t.Fatalf("failed to parse request object: %s", err)
+	}
+	if claims.Scope != "openid profile" {
+		t.Errorf("unknown scope should be stripped but got %#v", claims.Scope)
+	}
+
+	env.API.Config.ScopeRegistry.Unknown = config.UnknownScopeReject
+
+	resp = env.Get("/authz", "", query)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	location, _ := url.Parse(resp.Header().Get("Location"))
+	if location.Query().Get("error") != "invalid_scope" || location.Query().Get("error_description") != "unknown scope: something" {
+		t.Errorf("unexpected redirect: %s", location)
+	}
+
+	env.API.Config.ScopeRegistry.Descriptions = map[string]string{"something": "Something."}
+
+	resp = env.Get("/authz", "", query)
+	if resp.Code != http.StatusOK {
+		t.Errorf("registered scope should be accepted but got status code %d", resp.Code)
+	}
+}
+
 func TestGetAuthz_SSO(t *testing.T) {
 	env := testutil.NewAPITestEnvironment(t)
 
@@ -649,8 +711,11 @@ func TestGetAuthz_SSO(t *testing.T) {
 				var err error
 				ssoToken, err = env.API.TokenManager.CreateSSOToken(
 					env.API.Config.Issuer,
+					"session-id",
 					"macrat",
+					"",
 					token.AuthorizedParties{"some_client_id"},
+					token.Consents{"some_client_id": token.ConsentAnyScope},
 					tt.AuthTime,
 					time.Now().Add(10*time.Minute),
 				)
@@ -726,3 +791,359 @@ func TestGetAuthz_SSO(t *testing.T) {
 		}
 	})
 }
+
+func TestGetAuthz_RedirectURIMatch(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	var exact, wildcard config.Pattern
+	exact.UnmarshalText([]byte("http://some-client.example.com/callback"))
+	wildcard.UnmarshalText([]byte("http://*.some-client.example.com/callback"))
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.RedirectURI = config.PatternSet{exact, wildcard}
+	env.API.Config.Clients["some_client_id"] = client
+
+	tests := []testutil.RedirectTest{
+		{
+			Name: "registered",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "wildcard",
+			Request: url.Values{
+				"redirect_uri":  {"http://sub.some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "open redirect",
+			Request: url.Values{
+				"redirect_uri":  {"http://evil.example.com?.some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+			},
+			Code:         http.StatusBadRequest,
+			BodyIncludes: []string{"unauthorized_client", "redirect_uri is not registered"},
+		},
+	}
+	env.RedirectTest(t, "GET", "/authz", tests)
+
+	client.RedirectURIMatch = config.RedirectURIMatchExact
+	env.API.Config.Clients["some_client_id"] = client
+
+	tests[1].Code = http.StatusBadRequest
+	tests[1].BodyIncludes = []string{"unauthorized_client", "redirect_uri is not registered"}
+	env.RedirectTest(t, "GET", "/authz", tests)
+}
+
+func TestGetAuthz_ResponseMode(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id", "implicit_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope, "implicit_client_id": token.ConsentAnyScope},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	tests := []struct {
+		Name         string
+		ClientID     string
+		ResponseType string
+		ResponseMode string
+		DefaultCode  string
+		InFragment   bool
+		Key          string
+		Error        string
+	}{
+		{Name: "code default", ClientID: "some_client_id", ResponseType: "code", InFragment: false, Key: "code"},
+		{Name: "code in fragment", ClientID: "some_client_id", ResponseType: "code", ResponseMode: "fragment", InFragment: true, Key: "code"},
+		{Name: "code with configured default", ClientID: "some_client_id", ResponseType: "code", DefaultCode: "fragment", InFragment: true, Key: "code"},
+		{Name: "implicit default", ClientID: "implicit_client_id", ResponseType: "token id_token", InFragment: true, Key: "id_token"},
+		{
+			Name:         "implicit in query",
+			ClientID:     "implicit_client_id",
+			ResponseType: "token id_token",
+			ResponseMode: "query",
+			InFragment:   false,
+			Key:          "error",
+			Error:        "response_mode=query is not allowed for response_type=token id_token because it exposes tokens in URL; use response_mode=fragment",
+		},
+		{
+			Name:         "unsupported mode",
+			ClientID:     "some_client_id",
+			ResponseType: "code",
+			ResponseMode: "form_get",
+			InFragment:   false,
+			Key:          "error",
+			Error:        `response_mode "form_get" is not supported; use "query", "fragment", "form_post", "query.jwt", "fragment.jwt", "form_post.jwt", or "jwt"`,
+		}, {
+			Name:         "disallowed implicit in fragment",
+			ClientID:     "some_client_id",
+			ResponseType: "code token",
+			ResponseMode: "fragment",
+			InFragment:   true,
+			Key:          "error",
+			Error:        "implicit/hybrid flow is disallowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			env.API.Config.ResponseMode = config.ResponseModeConfig{
+				Code:     "query",
+				Implicit: "fragment",
+			}
+			if tt.DefaultCode != "" {
+				env.API.Config.ResponseMode.Code = tt.DefaultCode
+			}
+
+			redirectURI := "http://some-client.example.com/callback"
+			if tt.ClientID == "implicit_client_id" {
+				redirectURI = "http://implicit-client.example.com/callback"
+			}
+			params := url.Values{
+				"client_id":     {tt.ClientID},
+				"redirect_uri":  {redirectURI},
+				"response_type": {tt.ResponseType},
+				"scope":         {"openid"},
+				"nonce":         {"something"},
+			}
+			if tt.ResponseMode != "" {
+				params.Set("response_mode", tt.ResponseMode)
+			}
+
+			req, _ := http.NewRequest("GET", "/authz?"+params.Encode(), nil)
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+			resp := env.DoRequest(req)
+			if resp.Code != http.StatusFound {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+
+			loc, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("failed to parse location: %s", err)
+			}
+			query := loc.Query()
+			fragment, _ := url.ParseQuery(loc.Fragment)
+
+			values, other := query, fragment
+			if tt.InFragment {
+				values, other = fragment, query
+			}
+			if values.Get(tt.Key) == "" {
+				t.Errorf("%s is not found in the expected place: %s", tt.Key, loc)
+			}
+			if other.Get(tt.Key) != "" {
+				t.Errorf("%s is found in the unexpected place: %s", tt.Key, loc)
+			}
+			if d := values.Get("error_description"); d != tt.Error {
+				t.Errorf("unexpected error_description: %#v", d)
+			}
+		})
+	}
+}
+
+func TestGetAuthz_JARM(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id", "implicit_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope, "implicit_client_id": token.ConsentAnyScope},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	tests := []struct {
+		Name         string
+		ClientID     string
+		ResponseType string
+		ResponseMode string
+		Prompt       string
+		InFragment   bool
+		Key          string
+		Error        string
+	}{
+		{Name: "code", ClientID: "some_client_id", ResponseType: "code", ResponseMode: "query.jwt", InFragment: false, Key: "code"},
+		{Name: "code in fragment", ClientID: "some_client_id", ResponseType: "code", ResponseMode: "fragment.jwt", InFragment: true, Key: "code"},
+		{Name: "code with default", ClientID: "some_client_id", ResponseType: "code", ResponseMode: "jwt", InFragment: false, Key: "code"},
+		{Name: "implicit with default", ClientID: "implicit_client_id", ResponseType: "token id_token", ResponseMode: "jwt", InFragment: true, Key: "id_token"},
+		{Name: "error", ClientID: "some_client_id", ResponseType: "code", ResponseMode: "query.jwt", Prompt: "none consent", InFragment: false, Key: "error", Error: "prompt=none can't use same time with login, select_account, or consent"},
+		{
+			Name:         "implicit in query",
+			ClientID:     "implicit_client_id",
+			ResponseType: "token id_token",
+			ResponseMode: "query.jwt",
+			InFragment:   false,
+			Key:          "error",
+			Error:        "response_mode=query.jwt is not allowed for response_type=token id_token; use response_mode=fragment.jwt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			redirectURI := "http://some-client.example.com/callback"
+			if tt.ClientID == "implicit_client_id" {
+				redirectURI = "http://implicit-client.example.com/callback"
+			}
+			params := url.Values{
+				"client_id":     {tt.ClientID},
+				"redirect_uri":  {redirectURI},
+				"response_type": {tt.ResponseType},
+				"response_mode": {tt.ResponseMode},
+				"scope":         {"openid"},
+				"nonce":         {"something"},
+				"state":         {"this-is-state"},
+			}
+			if tt.Prompt != "" {
+				params.Set("prompt", tt.Prompt)
+			}
+
+			req, _ := http.NewRequest("GET", "/authz?"+params.Encode(), nil)
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+			resp := env.DoRequest(req)
+			if resp.Code != http.StatusFound {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+
+			loc, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("failed to parse location: %s", err)
+			}
+			values, _ := url.ParseQuery(loc.Fragment)
+			if !tt.InFragment {
+				values = loc.Query()
+			}
+			if len(values) != 1 || values.Get("response") == "" {
+				t.Fatalf("expected only response parameter but got: %s", loc)
+			}
+
+			claims, err := env.API.TokenManager.ParseAuthzResponse(values.Get("response"))
+			if err != nil {
+				t.Fatalf("failed to parse response: %s", err)
+			}
+			if claims["iss"] != env.API.Config.Issuer.String() {
+				t.Errorf("unexpected issuer: %v", claims["iss"])
+			}
+			if claims["aud"] != tt.ClientID {
+				t.Errorf("unexpected audience: %v", claims["aud"])
+			}
+			if claims["state"] != "this-is-state" {
+				t.Errorf("unexpected state: %v", claims["state"])
+			}
+			if v, _ := claims[tt.Key].(string); v == "" {
+				t.Errorf("%s is not found in the response: %v", tt.Key, claims)
+			}
+			if d, _ := claims["error_description"].(string); d != tt.Error {
+				t.Errorf("unexpected error_description: %#v", d)
+			}
+		})
+	}
+}
+
+func TestGetAuthz_FormPost(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id", "implicit_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope, "implicit_client_id": token.ConsentAnyScope},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	tests := []struct {
+		Name         string
+		ClientID     string
+		ResponseType string
+		ResponseMode string
+		Prompt       string
+		Keys         []string
+	}{
+		{Name: "code", ClientID: "some_client_id", ResponseType: "code", ResponseMode: "form_post", Keys: []string{"code", "iss", "state"}},
+		{Name: "implicit", ClientID: "implicit_client_id", ResponseType: "code id_token", ResponseMode: "form_post", Keys: []string{"code", "expires_in", "id_token", "iss", "state"}},
+		{Name: "error", ClientID: "some_client_id", ResponseType: "code", ResponseMode: "form_post", Prompt: "none login", Keys: []string{"error", "error_description", "error_uri", "iss", "state"}},
+		{Name: "jwt", ClientID: "some_client_id", ResponseType: "code", ResponseMode: "form_post.jwt", Keys: []string{"response"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			redirectURI := "http://some-client.example.com/callback"
+			if tt.ClientID == "implicit_client_id" {
+				redirectURI = "http://implicit-client.example.com/callback"
+			}
+			params := url.Values{
+				"client_id":     {tt.ClientID},
+				"redirect_uri":  {redirectURI},
+				"response_type": {tt.ResponseType},
+				"response_mode": {tt.ResponseMode},
+				"scope":         {"openid"},
+				"nonce":         {"something"},
+				"state":         {"this-is-state"},
+			}
+			if tt.Prompt != "" {
+				params.Set("prompt", tt.Prompt)
+			}
+
+			req, _ := http.NewRequest("GET", "/authz?"+params.Encode(), nil)
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+			resp := env.DoRequest(req)
+			if resp.Code != http.StatusOK {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+			if cc := resp.Header().Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("unexpected Cache-Control: %#v", cc)
+			}
+
+			body := resp.Body.Bytes()
+			testutil.AssertAccessible(t, "form_post.tmpl", body)
+
+			if !strings.Contains(string(body), fmt.Sprintf(`action="%s"`, redirectURI)) {
+				t.Errorf("form doesn't post to the redirect_uri")
+			}
+
+			inputs, err := testutil.FindInputsByHTML(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("failed to parse page: %s", err)
+			}
+			var keys []string
+			for k, v := range inputs {
+				if v == "" {
+					t.Errorf("%s is empty", k)
+				}
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.Keys) {
+				t.Errorf("unexpected parameters: expected %v but got %v", tt.Keys, keys)
+			}
+		})
+	}
+}
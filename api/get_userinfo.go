@@ -40,8 +40,7 @@ func (api *LauthAPI) GetUserInfo(c *gin.Context) {
 	report := metrics.StartUserinfo(c)
 	defer report.Close()
 
-	c.Header("Cache-Control", "no-store")
-	c.Header("Pragma", "no-cache")
+	noStore(c)
 
 	var req GetUserInfoRequest
 	if err := (&req).Bind(c); err != nil {
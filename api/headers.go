@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/page"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultRobotsTxt disallows crawlers to index any page, because login pages are not for search engines.
+const DefaultRobotsTxt = "User-agent: *\nDisallow: /\n"
+
+func setHeaders(c *gin.Context, headers map[string]string) {
+	for k, v := range headers {
+		c.Header(k, v)
+	}
+}
+
+// noStore prevents browsers and shared caches like CDN from storing the response.
+//
+// Responses that include tokens, credentials, or per-user pages must be sent with this.
+func noStore(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+}
+
+// publicCache allows caches to store the response that is the same for everyone, for --discovery-max-age.
+func (api *LauthAPI) publicCache(c *gin.Context) {
+	if maxAge := api.Config.DiscoveryMaxAge.Duration(); maxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int64(maxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+}
+
+func (api *LauthAPI) allHeaders(c *gin.Context) {
+	setHeaders(c, api.Config.Headers.All)
+}
+
+func (api *LauthAPI) pageHeaders(c *gin.Context) {
+	if nonce, err := page.NewCSPNonce(); err != nil {
+		log.Error().Err(err).Msg("failed to generate nonce for Content-Security-Policy")
+	} else {
+		page.SetCSPNonce(c, nonce)
+		c.Header("Content-Security-Policy", page.ContentSecurityPolicy(nonce, api.Config.Templates.AssetURL))
+	}
+	setHeaders(c, api.Config.Headers.Pages)
+}
+
+func (api *LauthAPI) apiHeaders(c *gin.Context) {
+	setHeaders(c, api.Config.Headers.API)
+}
+
+func (api *LauthAPI) GetRobotsTxt(c *gin.Context) {
+	if api.Config.RobotsTxt != "" {
+		c.File(api.Config.RobotsTxt)
+		return
+	}
+	c.String(http.StatusOK, DefaultRobotsTxt)
+}
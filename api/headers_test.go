@@ -0,0 +1,150 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestHeaders(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Headers.All = map[string]string{"x-powered-by": "lauth"}
+	env.API.Config.Headers.Pages = map[string]string{"x-robots-tag": "noindex"}
+	env.API.Config.Headers.API = map[string]string{"x-api-group": "yes"}
+
+	tests := []struct {
+		Name   string
+		Path   string
+		Expect map[string]string
+	}{
+		{"page", "/authz", map[string]string{"X-Powered-By": "lauth", "X-Robots-Tag": "noindex", "X-Api-Group": ""}},
+		{"api", "/.well-known/openid-configuration", map[string]string{"X-Powered-By": "lauth", "X-Robots-Tag": "", "X-Api-Group": "yes"}},
+		{"not found", "/no-such-page", map[string]string{"X-Powered-By": "lauth", "X-Robots-Tag": "noindex", "X-Api-Group": ""}},
+		{"robots.txt", "/robots.txt", map[string]string{"X-Powered-By": "lauth", "X-Robots-Tag": "", "X-Api-Group": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			resp := env.Get(tt.Path, "", url.Values{})
+
+			for k, v := range tt.Expect {
+				if actual := resp.Header().Get(k); actual != v {
+					t.Errorf("expected %s header is %#v but got %#v", k, v, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaders_ContentSecurityPolicy(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	rp := env.SomeClientRP()
+
+	nonceRe := regexp.MustCompile(`script-src 'nonce-([^']+)'`)
+
+	getNonce := func() string {
+		resp := env.Get("/authz", "", rp.AuthzRequest(url.Values{}))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+
+		csp := resp.Header().Get("Content-Security-Policy")
+		m := nonceRe.FindStringSubmatch(csp)
+		if m == nil {
+			t.Fatalf("nonce is not found in Content-Security-Policy: %#v", csp)
+		}
+		if !strings.Contains(csp, "frame-ancestors 'none'") {
+			t.Errorf("Content-Security-Policy should deny framing: %#v", csp)
+		}
+		if !strings.Contains(resp.Body.String(), `<style nonce="`+m[1]+`">`) {
+			t.Errorf("nonce in header is not used in the page")
+		}
+		return m[1]
+	}
+
+	if a, b := getNonce(), getNonce(); a == b {
+		t.Errorf("nonce should be changed on each response but got the same nonce: %#v", a)
+	}
+
+	resp := env.Get("/.well-known/openid-configuration", "", url.Values{})
+	if csp := resp.Header().Get("Content-Security-Policy"); strings.Contains(csp, "nonce") {
+		t.Errorf("API should not have nonce: %#v", csp)
+	}
+
+	env.API.Config.Headers.Pages = map[string]string{"Content-Security-Policy": "default-src *"}
+	resp = env.Get("/authz", "", rp.AuthzRequest(url.Values{}))
+	if csp := resp.Header().Get("Content-Security-Policy"); csp != "default-src *" {
+		t.Errorf("Content-Security-Policy should be overwritten by config but got %#v", csp)
+	}
+}
+
+func TestGetRobotsTxt(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	resp := env.Get("/robots.txt", "", url.Values{})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	if resp.Body.String() != api.DefaultRobotsTxt {
+		t.Errorf("unexpected default robots.txt: %#v", resp.Body.String())
+	}
+
+	custom := "User-agent: *\nAllow: /\n"
+	env.API.Config.RobotsTxt = filepath.Join(t.TempDir(), "robots.txt")
+	if err := os.WriteFile(env.API.Config.RobotsTxt, []byte(custom), 0644); err != nil {
+		t.Fatalf("failed to write robots.txt: %s", err)
+	}
+
+	resp = env.Get("/robots.txt", "", url.Values{})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	if resp.Body.String() != custom {
+		t.Errorf("unexpected custom robots.txt: %#v", resp.Body.String())
+	}
+}
+
+func TestHeaders_CacheControl(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.DiscoveryMaxAge = config.Duration(10 * time.Minute)
+	rp := env.SomeClientRP()
+
+	tests := []struct {
+		Name         string
+		Method       string
+		Path         string
+		Values       url.Values
+		CacheControl string
+		Pragma       string
+	}{
+		{"authz", "GET", "/authz", rp.AuthzRequest(url.Values{}), "no-store", "no-cache"},
+		{"authz error", "GET", "/authz", url.Values{}, "no-store", "no-cache"},
+		{"token", "POST", "/token", url.Values{"grant_type": {"authorization_code"}}, "no-store", "no-cache"},
+		{"userinfo", "GET", "/userinfo", url.Values{}, "no-store", "no-cache"},
+		{"logout", "GET", "/logout", url.Values{}, "no-store", "no-cache"},
+		{"discovery", "GET", "/.well-known/openid-configuration", url.Values{}, "public, max-age=600", ""},
+		{"jwks", "GET", env.API.Config.Endpoints.Jwks, url.Values{}, "public, max-age=600", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			resp := env.Do(tt.Method, tt.Path, "", tt.Values)
+
+			if cc := resp.Header().Get("Cache-Control"); cc != tt.CacheControl {
+				t.Errorf("expected Cache-Control is %#v but got %#v", tt.CacheControl, cc)
+			}
+			if pragma := resp.Header().Get("Pragma"); pragma != tt.Pragma {
+				t.Errorf("expected Pragma is %#v but got %#v", tt.Pragma, pragma)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/secret"
+	"github.com/macrat/lauth/token"
+	"github.com/rs/zerolog/log"
+)
+
+type InvitationRequest struct {
+	Username string `form:"username" json:"username" xml:"username"`
+}
+
+type InvitationResponse struct {
+	Username      string `json:"username"`
+	InvitationURL string `json:"invitation_url"`
+	ExpiresAt     int64  `json:"expires_at"`
+}
+
+type InviteRequest struct {
+	Token           string `form:"token"            json:"token"            xml:"token"`
+	Password        string `form:"password"         json:"password"         xml:"password"`
+	PasswordConfirm string `form:"password_confirm" json:"password_confirm" xml:"password_confirm"`
+}
+
+// hasAdminCredentials reports whether the request has the admin credentials, without delay on failure.
+func (api *LauthAPI) hasAdminCredentials(c *gin.Context) bool {
+	if !api.Config.Admin.Enabled() {
+		return false
+	}
+	u, p, ok := c.Request.BasicAuth()
+	return ok && secret.Equal(u, api.Config.Admin.Username) && secret.Equal(p, api.Config.Admin.Password)
+}
+
+func (api *LauthAPI) checkAdmin(c *gin.Context) bool {
+	if api.hasAdminCredentials(c) {
+		return true
+	}
+	RandomDelay()
+	return false
+}
+
+// PostInvitation is the admin API to create an invitation link for a pre-created user.
+func (api *LauthAPI) PostInvitation(c *gin.Context) {
+	report := metrics.StartInvite(c)
+	defer report.Close()
+
+	noStore(c)
+
+	report.Set("step", "create")
+
+	if e := api.requireAdmin(c); e != nil {
+		report.SetError(e)
+		return
+	}
+
+	var req InvitationRequest
+	if err := c.ShouldBind(&req); err != nil || req.Username == "" {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "username is required"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+	report.Set("username", req.Username)
+
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to connecting LDAP server")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to connecting LDAP server"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.GetUserAttributes(req.Username, []string{}); err == ldap.UserNotFoundError {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "user is not found"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	} else if err != nil {
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to get user information"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+
+	expiresIn := api.Config.Expire.Invitation.Duration()
+	invitation, err := api.TokenManager.CreateInvitation(api.Config.Issuer, req.Username, expiresIn)
+	if err != nil {
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to create invitation"}
+		report.SetError(e)
+		api.sendAdminError(c, e.StatusCode(), e)
+		return
+	}
+
+	link := *api.Config.Issuer.URL()
+	link.Path = api.Config.EndpointPaths().Invite
+	link.RawQuery = url.Values{"token": {invitation}}.Encode()
+
+	report.Success()
+	c.JSON(http.StatusOK, InvitationResponse{
+		Username:      req.Username,
+		InvitationURL: link.String(),
+		ExpiresAt:     api.TokenManager.Now().Add(expiresIn).Unix(),
+	})
+}
+
+func (api *LauthAPI) parseInvitation(raw string) (token.InvitationClaims, *errors.Error) {
+	claims, err := api.TokenManager.ParseInvitation(raw)
+	if err == nil {
+		err = api.validateIssuers(claims.Validate)
+	}
+	if err == nil && api.Revocation.IsRevoked(claims.Id) {
+		err = token.RevokedTokenError
+	}
+	if err != nil {
+		return claims, &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidRequest,
+			Description: "invitation link is invalid, expired, or already used",
+		}
+	}
+	return claims, nil
+}
+
+func (api *LauthAPI) GetInvite(c *gin.Context) {
+	report := metrics.StartInvite(c)
+	defer report.Close()
+
+	noStore(c)
+
+	report.Set("step", "verify")
+
+	claims, e := api.parseInvitation(c.Query("token"))
+	if e != nil {
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	report.Set("username", claims.Subject)
+
+	report.Continue()
+	c.HTML(http.StatusOK, "register.tmpl", pageDataWithExpiry(c, gin.H{
+		"step":     "password",
+		"token":    c.Query("token"),
+		"username": claims.Subject,
+	}, api.TokenManager.Now(), time.Unix(claims.ExpiresAt, 0)))
+}
+
+func (api *LauthAPI) PostInvite(c *gin.Context) {
+	report := metrics.StartInvite(c)
+	defer report.Close()
+
+	noStore(c)
+
+	report.Set("step", "password")
+
+	var req InviteRequest
+	if err := c.ShouldBind(&req); err != nil {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "failed to parse request"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	claims, e := api.parseInvitation(req.Token)
+	if e != nil {
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	report.Set("username", claims.Subject)
+
+	showForm := func(description string) {
+		report.UserError()
+		c.HTML(http.StatusBadRequest, "register.tmpl", pageDataWithExpiry(c, gin.H{
+			"step":     "password",
+			"token":    req.Token,
+			"username": claims.Subject,
+			"error":    description,
+		}, api.TokenManager.Now(), time.Unix(claims.ExpiresAt, 0)))
+	}
+
+	if len(req.Password) < MinPasswordLength {
+		showForm(fmt.Sprintf("Password must be at least %d characters.", MinPasswordLength))
+		return
+	}
+	if req.Password != req.PasswordConfirm {
+		showForm("Passwords don't match.")
+		return
+	}
+
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to connecting LDAP server")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to connecting LDAP server"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	defer conn.Close()
+
+	registrar, ok := conn.(ldap.Registrar)
+	if !ok {
+		e := &errors.Error{Reason: errors.ServerError, Description: "LDAP connector doesn't support account activation"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	if err := registrar.ActivateUser(claims.Subject, req.Password); err != nil {
+		log.Error().Err(err).Msg("failed to activate user")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to activate user"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	if api.Revocation != nil {
+		if err := api.Revocation.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+			log.Error().Err(err).Msg("failed to mark invitation as used")
+		}
+	}
+
+	report.Success()
+	c.HTML(http.StatusOK, "register.tmpl", pageData(c, gin.H{
+		"step":     "done",
+		"username": claims.Subject,
+	}))
+}
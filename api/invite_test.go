@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/revocation"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestInvitation(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	dummyLDAP := testutil.LDAP.Copy()
+	env.API.Connector = dummyLDAP
+	env.API.Revocation = revocation.NewList()
+
+	invite := func(username, password string) *http.Response {
+		req, _ := http.NewRequest("POST", "/admin/invitations", strings.NewReader(url.Values{"username": {username}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+		return env.DoRequest(req).Result()
+	}
+
+	if resp := invite("j.smith", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without credentials but got %d", resp.StatusCode)
+	}
+	if resp := invite("j.smith", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 with wrong credentials but got %d", resp.StatusCode)
+	}
+	if resp := invite("nobody", "admin password"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown user but got %d", resp.StatusCode)
+	}
+
+	resp := invite("j.smith", "admin password")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed to create invitation: %d", resp.StatusCode)
+	}
+	var invitation api.InvitationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&invitation); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if invitation.Username != "j.smith" {
+		t.Errorf("unexpected username: %#v", invitation.Username)
+	}
+
+	link, err := url.Parse(invitation.InvitationURL)
+	if err != nil || link.Path != "/invite" {
+		t.Fatalf("unexpected invitation URL: %#v", invitation.InvitationURL)
+	}
+	invitationToken := link.Query().Get("token")
+
+	if resp := env.Get("/invite", "", url.Values{"token": {"invalid"}}); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid token but got %d", resp.Code)
+	}
+
+	if resp := env.Get("/invite", "", url.Values{"token": {invitationToken}}); resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "j.smith") {
+		t.Fatalf("failed to show invitation page: %d", resp.Code)
+	}
+
+	if resp := env.Post("/invite", "", url.Values{"token": {invitationToken}, "password": {"short"}, "password_confirm": {"short"}}); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for short password but got %d", resp.Code)
+	}
+
+	if resp := env.Post("/invite", "", url.Values{"token": {invitationToken}, "password": {"new password"}, "password_confirm": {"new password"}}); resp.Code != http.StatusOK {
+		t.Fatalf("failed to activate account: %d", resp.Code)
+	}
+	if dummyLDAP["j.smith"].Password != "new password" {
+		t.Errorf("password was not changed")
+	}
+
+	if resp := env.Post("/invite", "", url.Values{"token": {invitationToken}, "password": {"another password"}, "password_confirm": {"another password"}}); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for used invitation but got %d", resp.Code)
+	}
+	if dummyLDAP["j.smith"].Password != "new password" {
+		t.Errorf("password was changed by used invitation")
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"github.com/macrat/lauth/config"
+)
+
+// acceptedIssuers returns the issuer and the old issuers that tokens from them are still accepted.
+func (api *LauthAPI) acceptedIssuers() []*config.URL {
+	return append([]*config.URL{api.Config.Issuer}, api.Config.OldIssuers...)
+}
+
+// validateIssuers calls validate with each accepted issuer, and succeeds if any of them succeeded.
+// The error for the current issuer is returned if all of them failed.
+func (api *LauthAPI) validateIssuers(validate func(issuer *config.URL) error) error {
+	var first error
+	for _, issuer := range api.acceptedIssuers() {
+		err := validate(issuer)
+		if err == nil {
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// isAcceptedIssuer checks if the issuer is the issuer or one of the old issuers.
+func (api *LauthAPI) isAcceptedIssuer(issuer string) bool {
+	for _, iss := range api.acceptedIssuers() {
+		if iss.String() == issuer {
+			return true
+		}
+	}
+	return false
+}
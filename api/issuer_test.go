@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestOldIssuers(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	oldIssuer := &config.URL{Scheme: "https", Host: "old-auth.example.com"}
+
+	accessToken, err := env.API.TokenManager.CreateAccessToken(oldIssuer, "macrat", "some_client_id", "openid", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+	refreshToken, err := env.API.TokenManager.CreateRefreshToken(oldIssuer, "macrat", "some_client_id", "openid", "", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %s", err)
+	}
+
+	refresh := func() *http.Response {
+		return env.Post("/token", "", url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"refresh_token": {refreshToken},
+		}).Result()
+	}
+
+	if resp := env.Get("/userinfo", "Bearer "+accessToken, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("expected access token from unknown issuer is rejected but got status code %d", resp.Code)
+	}
+	if resp := refresh(); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected refresh token from unknown issuer is rejected but got status code %d", resp.StatusCode)
+	}
+
+	env.API.Config.OldIssuers = []*config.URL{oldIssuer}
+
+	if resp := env.Get("/userinfo", "Bearer "+accessToken, nil); resp.Code != http.StatusOK {
+		t.Errorf("expected access token from old issuer is accepted but got status code %d: %s", resp.Code, resp.Body)
+	}
+
+	resp := refresh()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected refresh token from old issuer is accepted but got status code %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if claims, err := env.API.TokenManager.ParseAccessToken(body.AccessToken); err != nil {
+		t.Errorf("failed to parse new access token: %s", err)
+	} else if claims.Issuer != env.API.Config.Issuer.String() {
+		t.Errorf("expected new access token is issued by the new issuer but got %#v", claims.Issuer)
+	}
+
+	if resp := env.Get("/.well-known/openid-configuration", "", nil); resp.Code != http.StatusOK {
+		t.Errorf("unexpected status code of discovery: %d", resp.Code)
+	} else {
+		var conf config.OpenIDConfiguration
+		if err := json.Unmarshal(resp.Body.Bytes(), &conf); err != nil {
+			t.Errorf("failed to decode discovery: %s", err)
+		} else if conf.Issuer != env.API.Config.Issuer.String() {
+			t.Errorf("unexpected issuer in discovery: %#v", conf.Issuer)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/metrics"
+)
+
+// KeyUsage is how many tokens signed by the key were sent back from the client.
+type KeyUsage struct {
+	KeyID    string `json:"kid"`
+	ClientID string `json:"client_id"`
+	Signing  bool   `json:"signing"`
+	Count    int64  `json:"count"`
+	LastSeen int64  `json:"last_seen"`
+}
+
+type keyUsageKey struct {
+	KeyID    string
+	ClientID string
+}
+
+// keyUsageReport records the keys of tokens that clients send back, to find clients that still use tokens signed by old keys while rotating the sign key.
+type keyUsageReport struct {
+	sync.Mutex
+
+	entries map[keyUsageKey]*KeyUsage
+}
+
+// recordKeyUsage records the key that verifies the token that sent from the client.
+func (api *LauthAPI) recordKeyUsage(clientID, rawToken string) {
+	kid := api.TokenManager.VerifyKeyID(rawToken)
+	metrics.KeyUsage.Inc(kid, clientID)
+
+	r := &api.keyUsage
+	r.Lock()
+	defer r.Unlock()
+
+	if r.entries == nil {
+		r.entries = make(map[keyUsageKey]*KeyUsage)
+	}
+	k := keyUsageKey{kid, clientID}
+	u, ok := r.entries[k]
+	if !ok {
+		u = &KeyUsage{KeyID: kid, ClientID: clientID}
+		r.entries[k] = u
+	}
+	u.Count++
+	u.LastSeen = api.TokenManager.Now().Unix()
+}
+
+// KeyUsages returns the recorded key usages, the clients that use old keys first.
+func (api *LauthAPI) KeyUsages() []KeyUsage {
+	signKey := api.TokenManager.KeyID().String()
+
+	r := &api.keyUsage
+	r.Lock()
+	us := make([]KeyUsage, 0, len(r.entries))
+	for _, u := range r.entries {
+		x := *u
+		x.Signing = x.KeyID == signKey
+		us = append(us, x)
+	}
+	r.Unlock()
+
+	sort.Slice(us, func(i, j int) bool {
+		if us[i].Signing != us[j].Signing {
+			return !us[i].Signing
+		}
+		if us[i].ClientID != us[j].ClientID {
+			return us[i].ClientID < us[j].ClientID
+		}
+		return us[i].KeyID < us[j].KeyID
+	})
+	return us
+}
+
+type KeyUsageResponse struct {
+	SignKey string     `json:"sign_key"`
+	Usages  []KeyUsage `json:"usages"`
+}
+
+// GetKeyUsage is the admin API to report which clients still send tokens signed by the keys in --verify-key.
+// The report is kept only in memory of each replica, and reset by restart.
+func (api *LauthAPI) GetKeyUsage(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	if e := api.requireAdmin(c); e != nil {
+		report.SetError(e)
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, KeyUsageResponse{
+		SignKey: api.TokenManager.KeyID().String(),
+		Usages:  api.KeyUsages(),
+	})
+}
@@ -0,0 +1,65 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestKeyUsage(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	old, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+	env.API.TokenManager = env.API.TokenManager.WithVerifyKeys(old.PublicKey())
+
+	oldToken, err := old.CreateAccessToken(env.API.Config.Issuer, "macrat", "some_client_id", "openid", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate access token: %s", err)
+	}
+	newToken, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "macrat", "implicit_client_id", "openid", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate access token: %s", err)
+	}
+
+	for _, tok := range []string{oldToken, oldToken, newToken} {
+		if resp := env.Get("/userinfo", "Bearer "+tok, nil); resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code of userinfo: %d", resp.Code)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/keys/usage", nil)
+	if resp := env.DoRequest(req); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without credentials but got %d", resp.Code)
+	}
+
+	req.SetBasicAuth("admin", "admin password")
+	resp := env.DoRequest(req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to get key usage: %d", resp.Code)
+	}
+
+	var report api.KeyUsageResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to parse response: %s", err)
+	}
+	if report.SignKey != env.API.TokenManager.KeyID().String() {
+		t.Errorf("unexpected sign key: %s", report.SignKey)
+	}
+	if len(report.Usages) != 2 {
+		t.Fatalf("unexpected usages: %#v", report.Usages)
+	}
+
+	if u := report.Usages[0]; u.KeyID != old.KeyID().String() || u.ClientID != "some_client_id" || u.Signing || u.Count != 2 {
+		t.Errorf("unexpected usage of old key: %#v", u)
+	}
+	if u := report.Usages[1]; u.KeyID != report.SignKey || u.ClientID != "implicit_client_id" || !u.Signing || u.Count != 1 {
+		t.Errorf("unexpected usage of sign key: %#v", u)
+	}
+}
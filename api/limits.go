@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+)
+
+// isPage checks if the path is of HTML pages like the login page, to decide format of error.
+func (api *LauthAPI) isPage(path string) bool {
+	endpoints := api.Config.EndpointPaths()
+
+	switch path {
+	case endpoints.Authz, endpoints.Logout, endpoints.Register, endpoints.Invite:
+		return true
+	default:
+		return false
+	}
+}
+
+func (api *LauthAPI) sendLimitError(c *gin.Context, e *errors.Error) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	report.SetError(e)
+
+	if api.isPage(c.Request.URL.Path) {
+		api.pageHeaders(c)
+		errors.SendHTML(c, e)
+	} else {
+		api.apiHeaders(c)
+		errors.SendJSON(c, e)
+	}
+	c.Abort()
+}
+
+// limitRequest rejects too long URL or too large body before parsing them.
+func (api *LauthAPI) limitRequest(c *gin.Context) {
+	limits := api.Config.Limits
+
+	if limits.MaxURLLength > 0 && len(c.Request.URL.RequestURI()) > limits.MaxURLLength {
+		api.sendLimitError(c, &errors.Error{
+			Reason:      errors.URITooLong,
+			Description: fmt.Sprintf("URL must be %d bytes or shorter", limits.MaxURLLength),
+		})
+		return
+	}
+
+	if limits.MaxBodySize > 0 {
+		if c.Request.ContentLength > int64(limits.MaxBodySize) {
+			api.sendLimitError(c, &errors.Error{
+				Reason:      errors.RequestTooLarge,
+				Description: fmt.Sprintf("request body must be %d bytes or smaller", limits.MaxBodySize),
+			})
+			return
+		}
+
+		// Content-Length can be omitted in chunked request, so limit reading too.
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limits.MaxBodySize))
+	}
+}
+
+// limitConcurrency sheds requests over --max-concurrent-requests with 503, to protect LDAP server from thundering herd.
+func (api *LauthAPI) limitConcurrency(c *gin.Context) {
+	n := atomic.AddInt64(&api.inFlight, 1)
+	metrics.InFlight.Inc()
+	defer func() {
+		atomic.AddInt64(&api.inFlight, -1)
+		metrics.InFlight.Dec()
+	}()
+
+	if max := api.Config.Limits.MaxConcurrentRequests; max > 0 && n > int64(max) {
+		// Use the route pattern instead of the requested path, to keep the label values bounded.
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		metrics.Shed.Inc(c.Request.Method, path)
+
+		retryAfter := api.Config.Limits.RetryAfter.IntSeconds()
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+
+		api.sendLimitError(c, &errors.Error{
+			Reason:      errors.TemporarilyUnavailable,
+			Description: "too many requests are processing now, please retry later",
+		})
+		return
+	}
+
+	c.Next()
+}
@@ -0,0 +1,196 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLimitRequest(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Limits.MaxBodySize = 1024
+	env.API.Config.Limits.MaxURLLength = 512
+
+	rp := env.SomeClientRP()
+
+	t.Run("short URL", func(t *testing.T) {
+		resp := env.Get("/authz", "", rp.AuthzRequest(url.Values{}))
+		if resp.Code != http.StatusOK {
+			t.Errorf("unexpected status code: %d", resp.Code)
+		}
+	})
+
+	t.Run("long URL of page", func(t *testing.T) {
+		resp := env.Get("/authz", "", rp.AuthzRequest(url.Values{"state": {strings.Repeat("a", 512)}}))
+		if resp.Code != http.StatusRequestURITooLong {
+			t.Errorf("unexpected status code: %d", resp.Code)
+		}
+		if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("expected HTML error but got %s", ct)
+		}
+		if !strings.Contains(resp.Body.String(), "uri_too_long") {
+			t.Errorf("expected error message in the page")
+		}
+	})
+
+	t.Run("long URL of API", func(t *testing.T) {
+		resp := env.Get("/userinfo", "", url.Values{"access_token": {strings.Repeat("a", 512)}})
+		if resp.Code != http.StatusRequestURITooLong {
+			t.Errorf("unexpected status code: %d", resp.Code)
+		}
+
+		var body map[string]string
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to parse response: %s", err)
+		}
+		if body["error"] != "uri_too_long" {
+			t.Errorf("unexpected error: %#v", body)
+		}
+	})
+
+	t.Run("large body", func(t *testing.T) {
+		resp := env.Post("/token", "", url.Values{
+			"grant_type": {"authorization_code"},
+			"code":       {strings.Repeat("a", 1024)},
+		})
+		if resp.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("unexpected status code: %d", resp.Code)
+		}
+
+		var body map[string]string
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to parse response: %s", err)
+		}
+		if body["error"] != "request_too_large" {
+			t.Errorf("unexpected error: %#v", body)
+		}
+	})
+
+	t.Run("large chunked body", func(t *testing.T) {
+		body := "grant_type=authorization_code&code=" + strings.Repeat("a", 2048)
+		r, _ := http.NewRequest("POST", "/token", io.MultiReader(strings.NewReader(body)))
+		r.ContentLength = -1
+		r.RemoteAddr = "[::1]:54321"
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp := env.DoRequest(r)
+		if resp.Code < 400 || resp.Code >= 500 {
+			t.Errorf("expected client error but got status code %d", resp.Code)
+		}
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		env.API.Config.Limits.MaxURLLength = 0
+		resp := env.Get("/authz", "", rp.AuthzRequest(url.Values{"state": {strings.Repeat("a", 512)}}))
+		if resp.Code != http.StatusOK {
+			t.Errorf("unexpected status code: %d", resp.Code)
+		}
+	})
+}
+
+// blockingConnector blocks Connect until released, to simulate slow LDAP server.
+type blockingConnector struct {
+	testutil.DummyLDAP
+
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c blockingConnector) Connect() (ldap.Session, error) {
+	c.entered <- struct{}{}
+	<-c.release
+	return c.DummyLDAP, nil
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Limits.MaxConcurrentRequests = 2
+	env.API.Config.Limits.RetryAfter = config.Duration(10 * time.Second)
+
+	conn := blockingConnector{
+		DummyLDAP: testutil.LDAP,
+		entered:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	env.API.Connector = conn
+
+	rp := env.SomeClientRP()
+
+	page := rp.Authorize(t, url.Values{})
+	inputs, err := testutil.FindInputsByHTML(bytes.NewReader(page.Body))
+	if err != nil {
+		t.Fatalf("failed to parse login page: %s", err)
+	}
+	form := url.Values{}
+	for k, v := range inputs {
+		form.Set(k, v)
+	}
+	form.Set("username", "macrat")
+	form.Set("password", "foobar")
+
+	shedCount := func(path string) float64 {
+		shed := metrics.DefaultPrometheus.Collector(metrics.Shed.Desc).(*prometheus.CounterVec)
+		return promtestutil.ToFloat64(shed.WithLabelValues("GET", path))
+	}
+	shedBefore := shedCount("/authz")
+	unmatchedBefore := shedCount("unmatched")
+
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			codes <- env.Post("/authz", "", form).Code
+		}()
+		<-conn.entered
+	}
+
+	resp := env.Get("/authz", "", rp.AuthzRequest(url.Values{}))
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while processing 2 requests but got %d", resp.Code)
+	}
+	if ra := resp.Header().Get("Retry-After"); ra != "10" {
+		t.Errorf("unexpected Retry-After header: %#v", ra)
+	}
+	if !strings.Contains(resp.Body.String(), "temporarily_unavailable") {
+		t.Errorf("expected temporarily_unavailable error page")
+	}
+
+	resp = env.Post("/token", "", url.Values{"grant_type": {"authorization_code"}})
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for API while processing 2 requests but got %d", resp.Code)
+	}
+
+	if shed := shedCount("/authz"); shed != shedBefore+1 {
+		t.Errorf("expected shed count is increased by 1 but got %f -> %f", shedBefore, shed)
+	}
+
+	if resp := env.Get("/no-such-page/12345", "", nil); resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for unknown path while processing 2 requests but got %d", resp.Code)
+	}
+	if shed := shedCount("unmatched"); shed != unmatchedBefore+1 {
+		t.Errorf("expected shed count of unmatched path is increased by 1 but got %f -> %f", unmatchedBefore, shed)
+	}
+
+	close(conn.release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusFound {
+			t.Errorf("unexpected status code of blocked request: %d", code)
+		}
+	}
+
+	resp = env.Get("/authz", "", rp.AuthzRequest(url.Values{}))
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected to accept requests after finished but got %d", resp.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// isLockedOut checks if the user failed to login too many times in the lockout duration.
+//
+// It reports false if failed to read the records, to avoid locking out every user by a broken storage.
+func (api *LauthAPI) isLockedOut(username string) bool {
+	threshold := api.Config.Login.LockoutThreshold
+	if api.Lockout == nil || threshold <= 0 {
+		return false
+	}
+
+	since := time.Now().Add(-api.Config.Login.LockoutDuration.Duration())
+	n, err := api.Lockout.Count(username, since)
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to read failed logins")
+		return false
+	}
+	return n >= threshold
+}
+
+// countLoginFailures returns the number of failed logins of the user in the lockout duration, or 0 if not counted.
+func (api *LauthAPI) countLoginFailures(username string) int {
+	if api.Lockout == nil || !api.Config.Login.CountsFailures() {
+		return 0
+	}
+
+	n, err := api.Lockout.Count(username, time.Now().Add(-api.Config.Login.LockoutDuration.Duration()))
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to read failed logins")
+		return 0
+	}
+	return n
+}
+
+// recordLoginFailure counts a failed login, and notifies the user by email when the count reached --login-notify-threshold.
+//
+// Failures of usernames that don't exist are not counted, because anyone can make unlimited number of those.
+// The conn is used to look up the email address of the user. A new session is made if conn is nil.
+// Pass nil after a failed bind, because the conn may have lost the privileges of the service account by the bind.
+func (api *LauthAPI) recordLoginFailure(c *gin.Context, report *metrics.Context, conn ldap.Session, username string, loginErr error) {
+	if api.Lockout == nil || !api.Config.Login.CountsFailures() {
+		return
+	}
+	if loginErr == ldap.UserNotFoundError || loginErr == ldap.MultipleUsersFoundError {
+		return
+	}
+
+	now := time.Now()
+	if err := api.Lockout.Fail(username, now); err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to record failed login")
+		return
+	}
+
+	threshold := api.Config.Login.NotifyThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	n, err := api.Lockout.Count(username, now.Add(-api.Config.Login.LockoutDuration.Duration()))
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to read failed logins")
+		return
+	}
+	if n == threshold {
+		report.SetField("login_notification", api.notifyLoginFailures(conn, username, n, now, api.clientIP(c)))
+	}
+}
+
+// notifyLoginFailures sends an email about failed logins to the user, and returns the result to record in the audit log.
+func (api *LauthAPI) notifyLoginFailures(conn ldap.Session, username string, count int, at time.Time, remoteAddr string) string {
+	if api.Mailer == nil {
+		log.Error().Str("username", username).Msg("failed to send notification of failed logins: SMTP server is not configured")
+		return "failed"
+	}
+
+	if conn == nil {
+		c, err := api.Connector.Connect()
+		if err != nil {
+			log.Error().Err(err).Str("username", username).Msg("failed to send notification of failed logins")
+			return "failed"
+		}
+		defer c.Close()
+		conn = c
+	}
+
+	attr := api.Config.Login.NotifyAttribute
+	attrs, err := conn.GetUserAttributes(username, []string{attr})
+	if err != nil || len(attrs[attr]) == 0 || attrs[attr][0] == "" {
+		return "no_address"
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\nThere were %d failed login attempts to your account in %s.\n\nTime of the last attempt: %s\nIP address: %s\n\nIf this was you, you can ignore this email.\nOtherwise, someone may be trying to guess your password. Please change your password, or contact the administrator.\n", username, count, api.Config.Login.LockoutDuration, at.Format(time.RFC1123Z), remoteAddr)
+
+	if err := api.Mailer.Send(attrs[attr][0], "Failed login attempts to your account", body); err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to send notification of failed logins")
+		return "failed"
+	}
+	return "sent"
+}
+
+func (api *LauthAPI) resetLoginFailures(username string) {
+	if api.Lockout == nil || !api.Config.Login.CountsFailures() {
+		return
+	}
+
+	if err := api.Lockout.Reset(username); err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to reset failed logins")
+	}
+}
@@ -0,0 +1,275 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/lockout"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestLockout_SharedAcrossReplicas(t *testing.T) {
+	dir := t.TempDir()
+
+	replicas := make([]*testutil.APITestEnvironment, 2)
+	for i := range replicas {
+		env := testutil.NewAPITestEnvironment(t)
+		env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+		env.API.Config.Login.LockoutThreshold = 3
+		env.API.Config.Login.LockoutDuration = config.Duration(time.Minute)
+
+		counter, err := lockout.OpenDir(dir)
+		if err != nil {
+			t.Fatalf("failed to open lockout directory: %s", err)
+		}
+		env.API.Lockout = counter
+
+		replicas[i] = env
+	}
+
+	login := func(env *testutil.APITestEnvironment, username, password string) int {
+		return env.SomeClientRP().Login(t, url.Values{}, username, password).Code
+	}
+
+	if code := login(replicas[0], "macrat", "wrong"); code != http.StatusForbidden {
+		t.Fatalf("unexpected status code: %d", code)
+	}
+	if code := login(replicas[1], "macrat", "wrong"); code != http.StatusForbidden {
+		t.Fatalf("unexpected status code: %d", code)
+	}
+
+	if code := login(replicas[0], "j.smith", "hello"); code != http.StatusFound {
+		t.Errorf("another user should not be locked out: status code %d", code)
+	}
+
+	if code := login(replicas[1], "macrat", "wrong"); code != http.StatusForbidden {
+		t.Fatalf("unexpected status code: %d", code)
+	}
+
+	for i, env := range replicas {
+		if code := login(env, "macrat", "foobar"); code != http.StatusForbidden {
+			t.Errorf("replica %d: expected locked out but got status code %d", i, code)
+		}
+	}
+
+	env := replicas[0]
+	env.API.Config.Login.DetailedErrors = []string{"::1/128"}
+	resp := env.SomeClientRP().Login(t, url.Values{}, "macrat", "foobar")
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("expected locked out but got status code %d", resp.Code)
+	} else if !strings.Contains(string(resp.Body), "Too many failed logins.") {
+		t.Errorf("expected detailed message for locked out user")
+	}
+}
+
+func TestLockout_ResetOnSuccess(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+	env.API.Config.Login.LockoutThreshold = 2
+	env.API.Config.Login.LockoutDuration = config.Duration(time.Minute)
+	env.API.Lockout = lockout.NewCounter()
+
+	rp := env.SomeClientRP()
+
+	for i := 0; i < 3; i++ {
+		if code := rp.Login(t, url.Values{}, "macrat", "wrong").Code; code != http.StatusForbidden {
+			t.Fatalf("unexpected status code: %d", code)
+		}
+		if code := rp.Login(t, url.Values{}, "macrat", "foobar").Code; code != http.StatusFound {
+			t.Fatalf("%d: failure count should be reset by succeed login: status code %d", i, code)
+		}
+	}
+}
+
+func TestLockout_UnknownUser(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+	env.API.Config.Login.LockoutThreshold = 2
+	env.API.Config.Login.LockoutDuration = config.Duration(time.Minute)
+	env.API.Lockout = lockout.NewCounter()
+
+	rp := env.SomeClientRP()
+
+	for i := 0; i < 3; i++ {
+		if code := rp.Login(t, url.Values{}, "no-such-user", "wrong").Code; code != http.StatusForbidden {
+			t.Fatalf("unexpected status code: %d", code)
+		}
+	}
+
+	if n, err := env.API.Lockout.Count("no-such-user", time.Now().Add(-time.Minute)); err != nil || n != 0 {
+		t.Errorf("failures of unknown user must not be recorded: %d %v", n, err)
+	}
+}
+
+func TestLockout_Notify(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+	env.API.Config.Login.LockoutDuration = config.Duration(time.Minute)
+	env.API.Config.Login.NotifyThreshold = 2
+	env.API.Config.Login.NotifyAttribute = "mail"
+	env.API.Lockout = lockout.NewCounter()
+
+	mailer := &DummyMailer{}
+	env.API.Mailer = mailer
+
+	rp := env.SomeClientRP()
+
+	for i := 0; i < 3; i++ {
+		if code := rp.Login(t, url.Values{}, "macrat", "wrong").Code; code != http.StatusForbidden {
+			t.Fatalf("unexpected status code: %d", code)
+		}
+		if i == 0 && len(mailer.Sent) != 0 {
+			t.Fatalf("notification should not be sent before reach threshold")
+		}
+	}
+
+	if len(mailer.Sent) != 1 {
+		t.Fatalf("expected 1 notification but sent %d", len(mailer.Sent))
+	}
+	if mailer.Sent[0].To != "m@crat.jp" {
+		t.Errorf("unexpected recipient: %s", mailer.Sent[0].To)
+	}
+	if !strings.Contains(mailer.Sent[0].Body, "2 failed login attempts") {
+		t.Errorf("notification should tell the number of failures:\n%s", mailer.Sent[0].Body)
+	}
+	if !strings.Contains(mailer.Sent[0].Body, "IP address: ") {
+		t.Errorf("notification should tell the IP address:\n%s", mailer.Sent[0].Body)
+	}
+
+	if code := rp.Login(t, url.Values{}, "macrat", "foobar").Code; code != http.StatusFound {
+		t.Fatalf("notification should not lock out the user: status code %d", code)
+	}
+	for i := 0; i < 2; i++ {
+		rp.Login(t, url.Values{}, "macrat", "wrong")
+	}
+	if len(mailer.Sent) != 2 {
+		t.Errorf("expected notification again after reset by succeed login but sent %d", len(mailer.Sent))
+	}
+}
+
+func TestLockout_NotifyBehindProxy(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+	env.API.Config.Login.LockoutDuration = config.Duration(time.Minute)
+	env.API.Config.Login.NotifyThreshold = 1
+	env.API.Config.Login.NotifyAttribute = "mail"
+	env.API.Config.Server.TrustedProxies = []string{"192.0.2.0/24"}
+	env.API.Lockout = lockout.NewCounter()
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowPasswordGrant = true
+	env.API.Config.Clients["some_client_id"] = client
+
+	mailer := &DummyMailer{}
+	env.API.Mailer = mailer
+
+	req := httptest.NewRequest("POST", env.API.Config.Endpoints.Token, strings.NewReader(url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"username":      {"macrat"},
+		"password":      {"wrong"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "192.0.2.10:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.5")
+
+	if resp := env.DoRequest(req); resp.Code == http.StatusOK {
+		t.Fatalf("login with wrong password should fail")
+	}
+
+	if len(mailer.Sent) != 1 {
+		t.Fatalf("expected 1 notification but sent %d", len(mailer.Sent))
+	}
+	if !strings.Contains(mailer.Sent[0].Body, "IP address: 203.0.113.5\n") {
+		t.Errorf("notification should tell the address of the client instead of the proxy:\n%s", mailer.Sent[0].Body)
+	}
+}
+
+// bindingConnector makes sessions that become anonymous after a failed bind, like a real LDAP connection.
+type bindingConnector struct {
+	testutil.DummyLDAP
+}
+
+func (c bindingConnector) Connect() (ldap.Session, error) {
+	return &bindingSession{DummyLDAP: c.DummyLDAP}, nil
+}
+
+type bindingSession struct {
+	testutil.DummyLDAP
+
+	anonymous bool
+}
+
+func (s *bindingSession) LoginTest(username, password string) error {
+	err := s.DummyLDAP.LoginTest(username, password)
+	if err != nil {
+		s.anonymous = true
+	}
+	return err
+}
+
+func (s *bindingSession) GetUserAttributes(username string, attributes []string) (map[string][]string, error) {
+	if s.anonymous {
+		return nil, fmt.Errorf("insufficient access rights")
+	}
+	return s.DummyLDAP.GetUserAttributes(username, attributes)
+}
+
+func TestLockout_NotifyAfterFailedBind(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+	env.API.Config.Login.LockoutDuration = config.Duration(time.Minute)
+	env.API.Config.Login.NotifyThreshold = 1
+	env.API.Config.Login.NotifyAttribute = "mail"
+	env.API.Connector = bindingConnector{testutil.LDAP}
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowPasswordGrant = true
+	env.API.Config.Clients["some_client_id"] = client
+
+	rp := env.SomeClientRP()
+
+	tests := []struct {
+		Name  string
+		Login func()
+	}{
+		{"authz", func() {
+			if code := rp.Login(t, url.Values{}, "macrat", "wrong").Code; code != http.StatusForbidden {
+				t.Fatalf("unexpected status code: %d", code)
+			}
+		}},
+		{"password grant", func() {
+			resp := rp.Token(t, url.Values{
+				"grant_type": {"password"},
+				"username":   {"macrat"},
+				"password":   {"wrong"},
+				"scope":      {"openid"},
+			})
+			if resp.Error != "invalid_grant" {
+				t.Fatalf("unexpected response: %#v", resp)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			env.API.Lockout = lockout.NewCounter()
+			mailer := &DummyMailer{}
+			env.API.Mailer = mailer
+
+			tt.Login()
+
+			if len(mailer.Sent) != 1 || mailer.Sent[0].To != "m@crat.jp" {
+				t.Errorf("notification should be sent using a session of the service account: %#v", mailer.Sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/secret"
+)
+
+const (
+	LOGIN_SESSION_COOKIE = "lauth_session"
+)
+
+// LoginSessionHash makes the value to embed into the request object from the login session cookie.
+//
+// The request object is shown in the login page, so it has only the hash, not the cookie itself.
+func LoginSessionHash(session string) string {
+	hash := sha256.Sum256([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// setLoginSession binds the login page to the browser with a HttpOnly cookie, and returns the hash of the cookie.
+//
+// The cookie already set is reused, so the user can open the login page in multiple tabs.
+func (api *LauthAPI) setLoginSession(c *gin.Context, expiresAt time.Time) (string, error) {
+	session, err := c.Cookie(LOGIN_SESSION_COOKIE)
+	if err != nil || len(session) < 32 {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		session = base64.RawURLEncoding.EncodeToString(buf)
+	}
+
+	secure := api.Config.Issuer.Scheme == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		LOGIN_SESSION_COOKIE,
+		session,
+		int(expiresAt.Sub(api.TokenManager.Now()).Seconds()),
+		api.Config.EndpointPaths().Authz,
+		api.Config.Issuer.Hostname(),
+		secure,
+		true,
+	)
+
+	return LoginSessionHash(session), nil
+}
+
+// checkLoginSession checks if the request has the same login session cookie as the login page.
+func (api *LauthAPI) checkLoginSession(c *gin.Context, hash string) bool {
+	session, err := c.Cookie(LOGIN_SESSION_COOKIE)
+	if err != nil || session == "" || hash == "" {
+		return false
+	}
+	return secret.Equal(LoginSessionHash(session), hash)
+}
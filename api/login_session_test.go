@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestLoginSession(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	rp := env.SomeClientRP()
+
+	openLoginPage := func(cookie *http.Cookie) (string, *http.Cookie) {
+		t.Helper()
+
+		req, _ := http.NewRequest("GET", "/authz?"+rp.AuthzRequest(url.Values{}).Encode(), nil)
+		req.RemoteAddr = "[::1]:54321"
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		resp := env.DoRequest(req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+
+		inputs, err := testutil.FindInputsByHTML(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to parse login page: %s", err)
+		}
+
+		for _, c := range resp.Result().Cookies() {
+			if c.Name == api.LOGIN_SESSION_COOKIE {
+				return inputs["request"], c
+			}
+		}
+		t.Fatalf("login session cookie is not set")
+		return "", nil
+	}
+
+	login := func(request string, cookie *http.Cookie) int {
+		t.Helper()
+
+		form := url.Values{
+			"request":  {request},
+			"username": {"macrat"},
+			"password": {"foobar"},
+		}
+		req, _ := http.NewRequest("POST", "/authz", strings.NewReader(form.Encode()))
+		req.RemoteAddr = "[::1]:54321"
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		return env.DoRequest(req).Code
+	}
+
+	request, cookie := openLoginPage(nil)
+	if !cookie.HttpOnly {
+		t.Errorf("login session cookie must be HttpOnly")
+	}
+	if cookie.Path != "/authz" {
+		t.Errorf("unexpected path of login session cookie: %#v", cookie.Path)
+	}
+	if len(cookie.Value) < 32 {
+		t.Errorf("login session cookie is too short: %#v", cookie.Value)
+	}
+	if strings.Contains(request, cookie.Value) {
+		t.Errorf("request object must not include the cookie itself")
+	}
+
+	_, another := openLoginPage(nil)
+	if another.Value == cookie.Value {
+		t.Errorf("login session cookie must be random")
+	}
+
+	_, reused := openLoginPage(cookie)
+	if reused.Value != cookie.Value {
+		t.Errorf("login session cookie should be reused in the same browser")
+	}
+
+	if code := login(request, nil); code != http.StatusBadRequest {
+		t.Errorf("expected rejected without cookie but got status code %d", code)
+	}
+	if code := login(request, another); code != http.StatusBadRequest {
+		t.Errorf("expected rejected with cookie of another browser but got status code %d", code)
+	}
+	if code := login(request, cookie); code != http.StatusFound {
+		t.Errorf("expected succeed with the same cookie but got status code %d", code)
+	}
+}
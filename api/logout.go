@@ -7,12 +7,35 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/macrat/lauth/errors"
 	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/page"
+	"github.com/macrat/lauth/secret"
+	"github.com/macrat/lauth/token"
+	"github.com/rs/zerolog/log"
 )
 
 type LogoutRequest struct {
 	IDTokenHint string `form:"id_token_hint"            json:"id_token_hint"            xml:"id_token_hint"`
 	RedirectURI string `form:"post_logout_redirect_uri" json:"post_logout_redirect_uri" xml:"post_logout_redirect_uri"`
 	State       string `form:"state"                    json:"state"                    xml:"state"`
+	ClientID    string `form:"client_id"                json:"client_id"                xml:"client_id"`
+	CSRFToken   string `form:"csrf_token"               json:"-"                        xml:"-"`
+}
+
+// LogoutCSRFToken makes the token to embed into the logout confirmation page from the SSO token cookie.
+//
+// The cookie is HttpOnly, so other sites can't make a logout request that has the correct token.
+func LogoutCSRFToken(ssoToken string) string {
+	return LoginSessionHash(ssoToken)
+}
+
+// checkLogoutCSRFToken checks if the logout request came from the confirmation page.
+// It reports true if there is no SSO session, because there is nothing to protect.
+func (api *LauthAPI) checkLogoutCSRFToken(c *gin.Context, token string) bool {
+	session, err := c.Cookie(SSO_TOKEN_COOKIE)
+	if err != nil || session == "" {
+		return true
+	}
+	return api.sameOrigin(c) && secret.Equal(LogoutCSRFToken(session), token)
 }
 
 func (req *LogoutRequest) Bind(c *gin.Context) *errors.Error {
@@ -31,6 +54,8 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 	report := metrics.StartLogout(c)
 	defer report.Close()
 
+	noStore(c)
+
 	var req LogoutRequest
 	if e := (&req).Bind(c); e != nil {
 		report.SetError(e)
@@ -40,16 +65,6 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 
 	report.Set("redirect_uri", req.RedirectURI)
 
-	if req.IDTokenHint == "" {
-		e := &errors.Error{
-			Reason:      errors.InvalidRequest,
-			Description: "id_token_hint is required in this OP",
-		}
-		report.SetError(e)
-		errors.SendHTML(c, e)
-		return
-	}
-
 	redirectURI, err := url.Parse(req.RedirectURI)
 	if err != nil {
 		e := &errors.Error{
@@ -71,6 +86,11 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 		return
 	}
 
+	if req.IDTokenHint == "" {
+		api.logoutWithoutHint(c, report, req, redirectURI)
+		return
+	}
+
 	idToken, err := api.TokenManager.ParseIDToken(req.IDTokenHint)
 	if err != nil {
 		e := &errors.Error{
@@ -84,6 +104,17 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 	}
 	report.Set("client_id", idToken.Audience)
 	report.Set("username", idToken.Subject)
+	api.recordKeyUsage(idToken.Audience, req.IDTokenHint)
+
+	if req.ClientID != "" && req.ClientID != idToken.Audience {
+		e := &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "client_id is not match to id_token_hint",
+		}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
 
 	if client, ok := api.Config.Clients[idToken.Audience]; !ok {
 		e := &errors.Error{
@@ -93,7 +124,7 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 		report.SetError(e)
 		errors.SendHTML(c, e)
 		return
-	} else if req.RedirectURI != "" && !client.RedirectURI.Match(req.RedirectURI) {
+	} else if req.RedirectURI != "" && !client.MatchRedirectURI(req.RedirectURI) {
 		e := &errors.Error{
 			Reason:      errors.InvalidRequest,
 			Description: "post_logout_redirect_uri is not registered",
@@ -103,7 +134,7 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 		return
 	}
 
-	if idToken.Issuer != api.Config.Issuer.String() {
+	if !api.isAcceptedIssuer(idToken.Issuer) {
 		e := &errors.Error{
 			Reason:      errors.InvalidRequest,
 			Description: "invalid id_token_hint",
@@ -134,16 +165,121 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 		return
 	}
 
+	report.SetField("sso_id", ssoToken.Id)
+	if err := api.RevokeSSOToken(ssoToken); err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to revoke SSO token")
+	}
 	api.DeleteSSOToken(c)
 
-	if req.RedirectURI == "" {
-		c.HTML(http.StatusOK, "logout.tmpl", nil)
-	} else {
-		if req.State != "" {
-			query := redirectURI.Query()
-			query.Set("state", req.State)
-			redirectURI.RawQuery = query.Encode()
+	api.sendLoggedOut(c, req, redirectURI, ssoToken.Authorized)
+}
+
+// logoutWithoutHint handles logout that requested by the user directly, or by the client that doesn't have id_token.
+//
+// GET request only shows the confirmation page, so links in other sites can't make the user log out.
+// POST request without the CSRF token of the confirmation page shows the confirmation page again, so forms in other sites can't make the user log out either.
+// post_logout_redirect_uri needs client_id to check if it is registered.
+func (api *LauthAPI) logoutWithoutHint(c *gin.Context, report *metrics.Context, req LogoutRequest, redirectURI *url.URL) {
+	if req.ClientID != "" {
+		report.Set("client_id", req.ClientID)
+	}
+
+	if req.RedirectURI != "" {
+		var e *errors.Error
+		if req.ClientID == "" {
+			e = &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "id_token_hint or client_id is required to use post_logout_redirect_uri",
+			}
+		} else if client, ok := api.Config.Clients[req.ClientID]; !ok {
+			e = &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "client is not registered",
+			}
+		} else if !client.MatchRedirectURI(req.RedirectURI) {
+			e = &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "post_logout_redirect_uri is not registered",
+			}
+		}
+		if e != nil {
+			report.SetError(e)
+			errors.SendHTML(c, e)
+			return
+		}
+	}
+
+	if c.Request.Method != http.MethodPost || !api.checkLogoutCSRFToken(c, req.CSRFToken) {
+		var csrfToken string
+		if session, err := c.Cookie(SSO_TOKEN_COOKIE); err == nil && session != "" {
+			csrfToken = LogoutCSRFToken(session)
+		}
+
+		report.Continue()
+		c.HTML(http.StatusOK, "logout.tmpl", pageData(c, gin.H{
+			"confirm":                  true,
+			"post_logout_redirect_uri": req.RedirectURI,
+			"client_id":                req.ClientID,
+			"state":                    req.State,
+			"csrf_token":               csrfToken,
+		}))
+		return
+	}
+
+	var authorized token.AuthorizedParties
+	if ssoToken, err := api.GetSSOToken(c); err == nil {
+		report.Set("username", ssoToken.Subject)
+		report.SetField("sso_id", ssoToken.Id)
+		if err := api.RevokeSSOToken(ssoToken); err != nil {
+			log.Error().
+				Err(err).
+				Msg("failed to revoke SSO token")
+		}
+		authorized = ssoToken.Authorized
+	}
+	api.DeleteSSOToken(c)
+
+	api.sendLoggedOut(c, req, redirectURI, authorized)
+}
+
+// frontchannelLogoutURIs returns frontchannel_logout_uri of the clients that logged in under the SSO session.
+func (api *LauthAPI) frontchannelLogoutURIs(authorized token.AuthorizedParties) []string {
+	var uris []string
+	for _, clientID := range authorized {
+		if uri := api.Config.Clients[clientID].FrontchannelLogoutURI; uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// sendLoggedOut shows the logged out page, or redirects to post_logout_redirect_uri if set.
+//
+// If some clients have frontchannel_logout_uri, the logged out page is always shown to load them in iframes,
+// and it goes to post_logout_redirect_uri after that by meta refresh.
+func (api *LauthAPI) sendLoggedOut(c *gin.Context, req LogoutRequest, redirectURI *url.URL, authorized token.AuthorizedParties) {
+	if req.RedirectURI != "" && req.State != "" {
+		query := redirectURI.Query()
+		query.Set("state", req.State)
+		redirectURI.RawQuery = query.Encode()
+	}
+
+	uris := api.frontchannelLogoutURIs(authorized)
+
+	if len(uris) > 0 {
+		if policy := c.Writer.Header().Get("Content-Security-Policy"); policy != "" {
+			c.Header("Content-Security-Policy", page.AllowFrames(policy, uris))
+		}
+		data := gin.H{"frontchannel_logout_uris": uris}
+		if req.RedirectURI != "" {
+			data["continue"] = redirectURI.String()
 		}
+		c.HTML(http.StatusOK, "logout.tmpl", pageData(c, data))
+	} else if req.RedirectURI == "" {
+		c.HTML(http.StatusOK, "logout.tmpl", pageData(c, gin.H{}))
+	} else {
 		c.Redirect(http.StatusFound, redirectURI.String())
 	}
 }
@@ -10,6 +10,7 @@ import (
 
 	"github.com/macrat/lauth/api"
 	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/revocation"
 	"github.com/macrat/lauth/testutil"
 	"github.com/macrat/lauth/token"
 )
@@ -19,8 +20,11 @@ func TestLogout(t *testing.T) {
 
 	ssoToken, err := env.API.TokenManager.CreateSSOToken(
 		env.API.Config.Issuer,
+		"session-id",
 		"macrat",
+		"",
 		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope},
 		time.Now(),
 		time.Now().Add(10*time.Minute),
 	)
@@ -112,13 +116,6 @@ func TestLogout(t *testing.T) {
 		Logout      bool
 		Message     string
 	}{
-		{
-			Name:    "no query",
-			Request: url.Values{},
-			Code:    http.StatusBadRequest,
-			Logout:  false,
-			Message: "id_token_hint is required in this OP",
-		},
 		{
 			Name: "invalid token",
 			Request: url.Values{
@@ -303,3 +300,279 @@ func TestLogout(t *testing.T) {
 		}
 	}
 }
+
+func TestLogout_WithoutIDTokenHint(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"session-id",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	tests := []struct {
+		Name     string
+		Method   string
+		Request  url.Values
+		Code     int
+		Logout   bool
+		Location string
+		Message  string
+		Origin   string
+	}{
+		{
+			Name:    "confirm",
+			Method:  "GET",
+			Request: url.Values{},
+			Code:    http.StatusOK,
+			Message: `<form method="POST" aria-label="logout">`,
+		},
+		{
+			Name:    "confirm with csrf token",
+			Method:  "GET",
+			Request: url.Values{},
+			Code:    http.StatusOK,
+			Message: `name="csrf_token" value="` + api.LogoutCSRFToken(ssoToken) + `"`,
+		},
+		{
+			Name:   "logout",
+			Method: "POST",
+			Request: url.Values{
+				"csrf_token": {api.LogoutCSRFToken(ssoToken)},
+			},
+			Code:    http.StatusOK,
+			Logout:  true,
+			Message: "Logged out",
+		},
+		{
+			Name:    "logout without csrf token",
+			Method:  "POST",
+			Request: url.Values{},
+			Code:    http.StatusOK,
+			Message: `name="csrf_token" value="` + api.LogoutCSRFToken(ssoToken) + `"`,
+		},
+		{
+			Name:   "logout with invalid csrf token",
+			Method: "POST",
+			Request: url.Values{
+				"csrf_token": {"invalid-token"},
+			},
+			Code:    http.StatusOK,
+			Message: `<form method="POST" aria-label="logout">`,
+		},
+		{
+			Name:   "logout from other site",
+			Method: "POST",
+			Request: url.Values{
+				"csrf_token": {api.LogoutCSRFToken(ssoToken)},
+			},
+			Origin:  "http://evil.example.com",
+			Code:    http.StatusOK,
+			Message: `<form method="POST" aria-label="logout">`,
+		},
+		{
+			Name:   "confirm with redirect",
+			Method: "GET",
+			Request: url.Values{
+				"client_id":                {"some_client_id"},
+				"post_logout_redirect_uri": {"http://some-client.example.com/logout"},
+				"state":                    {"this is a state"},
+			},
+			Code:    http.StatusOK,
+			Message: `name="post_logout_redirect_uri" value="http://some-client.example.com/logout"`,
+		},
+		{
+			Name:   "logout with redirect",
+			Method: "POST",
+			Request: url.Values{
+				"client_id":                {"some_client_id"},
+				"post_logout_redirect_uri": {"http://some-client.example.com/logout"},
+				"state":                    {"this is a state"},
+				"csrf_token":               {api.LogoutCSRFToken(ssoToken)},
+			},
+			Code:     http.StatusFound,
+			Logout:   true,
+			Location: "http://some-client.example.com/logout?state=this+is+a+state",
+		},
+		{
+			Name:   "redirect without client_id",
+			Method: "POST",
+			Request: url.Values{
+				"post_logout_redirect_uri": {"http://some-client.example.com/logout"},
+			},
+			Code:    http.StatusBadRequest,
+			Message: "id_token_hint or client_id is required to use post_logout_redirect_uri",
+		},
+		{
+			Name:   "not registered URI",
+			Method: "GET",
+			Request: url.Values{
+				"client_id":                {"some_client_id"},
+				"post_logout_redirect_uri": {"https://example.com/non/registered"},
+			},
+			Code:    http.StatusBadRequest,
+			Message: "post_logout_redirect_uri is not registered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var req *http.Request
+			if tt.Method == "GET" {
+				req, _ = http.NewRequest("GET", "/logout?"+tt.Request.Encode(), nil)
+			} else {
+				req, _ = http.NewRequest("POST", "/logout", strings.NewReader(tt.Request.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+			if tt.Origin != "" {
+				req.Header.Set("Origin", tt.Origin)
+			}
+			resp := env.DoRequest(req)
+
+			if resp.Code != tt.Code {
+				t.Fatalf("expected status code is %d but got %d", tt.Code, resp.Code)
+			}
+			if tt.Message != "" && !strings.Contains(resp.Body.String(), tt.Message) {
+				t.Log(resp.Body.String())
+				t.Errorf("expected message %#v was not contained in the response", tt.Message)
+			}
+			if loc := resp.Header().Get("Location"); loc != tt.Location {
+				t.Errorf("expected location %#v but got %#v", tt.Location, loc)
+			}
+
+			cleared := false
+			for _, c := range resp.Result().Cookies() {
+				if c.Name == api.SSO_TOKEN_COOKIE && c.Value == "" {
+					cleared = true
+				}
+			}
+			if cleared != tt.Logout {
+				t.Errorf("expected logout is %v but cookie was cleared: %v", tt.Logout, cleared)
+			}
+		})
+	}
+}
+
+func TestLogout_RevokeSSOToken(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Revocation = revocation.NewList()
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"revoked-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	idToken, err := env.API.TokenManager.CreateIDToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"",
+		"",
+		"",
+		nil,
+		time.Now(),
+		10*time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to create test id_token: %s", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/logout?"+url.Values{"id_token_hint": {idToken}}.Encode(), nil)
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+	if resp := env.DoRequest(req); resp.Code != http.StatusOK {
+		t.Fatalf("failed to logout: status code %d", resp.Code)
+	}
+
+	if !env.API.Revocation.IsRevoked("revoked-session") {
+		t.Fatalf("SSO session was not revoked")
+	}
+
+	authzRequest := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid"},
+		"prompt":        {"none"},
+	}
+	req, _ = http.NewRequest("GET", "/authz?"+authzRequest.Encode(), nil)
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+	resp := env.DoRequest(req)
+
+	loc, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse location: %s", err)
+	}
+	if e := loc.Query().Get("error"); e != "login_required" {
+		t.Errorf("expected login_required error with revoked SSO token but got %#v", e)
+	}
+}
+
+func TestLogout_Frontchannel(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.FrontchannelLogoutURI = "http://some-client.example.com/frontchannel-logout"
+	env.API.Config.Clients["some_client_id"] = client
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"session-id",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id", "implicit_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope, "implicit_client_id": token.ConsentAnyScope},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	request := url.Values{
+		"client_id":                {"implicit_client_id"},
+		"post_logout_redirect_uri": {"http://implicit-client.example.com/logout"},
+		"csrf_token":               {api.LogoutCSRFToken(ssoToken)},
+	}
+	req, _ := http.NewRequest("POST", "/logout", strings.NewReader(request.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+	resp := env.DoRequest(req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected logged out page but got status code %d", resp.Code)
+	}
+
+	body := resp.Body.String()
+	if !strings.Contains(body, `<iframe src="http://some-client.example.com/frontchannel-logout" title="logout" hidden></iframe>`) {
+		t.Errorf("frontchannel_logout_uri is not loaded:\n%s", body)
+	}
+	if strings.Count(body, "<iframe") != 1 {
+		t.Errorf("only clients that have frontchannel_logout_uri should be loaded:\n%s", body)
+	}
+	if !strings.Contains(body, `<meta http-equiv="refresh" content="3;url=http://implicit-client.example.com/logout" />`) {
+		t.Errorf("post_logout_redirect_uri is not in the page:\n%s", body)
+	}
+
+	csp := resp.Header().Get("Content-Security-Policy")
+	if !strings.HasSuffix(csp, "; frame-src http://some-client.example.com") {
+		t.Errorf("frame-src is not allowed: %s", csp)
+	}
+}
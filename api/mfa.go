@@ -0,0 +1,221 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/mfa"
+	"github.com/macrat/lauth/policy"
+	"github.com/macrat/lauth/token"
+	"github.com/rs/zerolog/log"
+)
+
+// loginFailureMFADenied is the reason of failed login that the user didn't pass the second factor.
+const loginFailureMFADenied ldap.LoginFailure = "mfa_denied"
+
+// mfaProviderFor decides the name of MFA provider that the user has to pass to login to the client, or empty if not required.
+//
+// The decision of the authorization policy takes precedence, and then the provider of the client, and then the groups of the user.
+// The conn is used to read the groups. A new session is made if conn is nil and the groups are needed.
+func (api *LauthAPI) mfaProviderFor(conn ldap.Session, username, clientID string, decision policy.Decision) (string, error) {
+	if decision.MFA != nil {
+		return *decision.MFA, nil
+	}
+	if p := api.Config.Clients[clientID].MFA; p != "" {
+		return p, nil
+	}
+	if len(api.Config.MFA.Groups) == 0 {
+		return api.Config.MFA.Default, nil
+	}
+
+	if conn == nil {
+		c, err := api.Connector.Connect()
+		if err != nil {
+			return "", err
+		}
+		defer c.Close()
+		conn = c
+	}
+
+	attr := api.Config.Policy.GroupsAttribute
+	attrs, err := conn.GetUserAttributes(username, []string{attr})
+	if err != nil {
+		return "", err
+	}
+	return api.Config.MFA.ProviderForGroups(attrs[attr]), nil
+}
+
+// mfaProvider decides the MFA provider for the login, by the authorization policy and the MFA config.
+// The decision of the policy is reused to issue tokens.
+func (ctx *AuthzContext) mfaProvider(conn ldap.Session, username string) (string, *errors.Error) {
+	decision, e := ctx.decidePolicy(username)
+	if e != nil {
+		return "", e
+	}
+
+	provider, err := ctx.API.mfaProviderFor(conn, username, ctx.Request.ClientID, decision)
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to get groups for MFA")
+		return "", &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to decide multi-factor authentication",
+		}
+	}
+	return provider, nil
+}
+
+// startMFA begins the second factor of the login page, after the password was verified.
+//
+// It returns true if the user doesn't need the second factor or already passed it, otherwise it responds a page.
+func (ctx *AuthzContext) startMFA(conn ldap.Session, loginStart time.Time, username string) (verified bool, provider string) {
+	provider, e := ctx.mfaProvider(conn, username)
+	if e != nil {
+		ctx.ErrorRedirect(ctx.Request.makeRedirectError(e.Err, e.Reason, e.Description))
+		return false, ""
+	}
+	if provider == "" {
+		return true, ""
+	}
+
+	defer ctx.Report.Step("mfa")()
+	ctx.Report.SetField("mfa", provider)
+
+	p, ok := ctx.API.MFA[provider]
+	if !ok {
+		ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.ServerError, "multi-factor authentication is not available"))
+		return false, provider
+	}
+
+	challenge, err := p.Start(ctx.Gin.Request.Context(), username, ctx.API.clientIP(ctx.Gin))
+	return ctx.handleMFAResult(loginStart, username, provider, challenge, err), provider
+}
+
+// verifyMFA checks the answer of the second factor that the user entered on the login page.
+func (ctx *AuthzContext) verifyMFA() {
+	claims := ctx.Request.MFA
+	ctx.Request.User = claims.Subject
+	ctx.Report.Set("username", claims.Subject)
+	ctx.Report.SetField("mfa", claims.Provider)
+
+	if ctx.Request.OTP == "" {
+		ctx.Report.UserError()
+		ctx.ShowMFAPage(http.StatusForbidden, claims, "missing verification code")
+		return
+	}
+
+	loginStart := time.Now()
+
+	if ctx.API.isLockedOut(claims.Subject) {
+		ctx.Request.MFA = nil
+		ctx.loginFailed(loginStart, nil, ldap.LoginFailureTooManyAttempts)
+		return
+	}
+
+	p, ok := ctx.API.MFA[claims.Provider]
+	if !ok {
+		ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.ServerError, "multi-factor authentication is not available"))
+		return
+	}
+
+	endMFA := ctx.Report.Step("mfa")
+	next, err := p.Verify(ctx.Gin.Request.Context(), claims.Subject, ctx.API.clientIP(ctx.Gin), mfa.Challenge{Message: claims.Message, State: claims.State}, ctx.Request.OTP)
+	endMFA()
+	if !ctx.handleMFAResult(loginStart, claims.Subject, claims.Provider, next, err) {
+		return
+	}
+
+	ctx.API.resetLoginFailures(claims.Subject)
+	ctx.completeLogin(claims.Subject, claims.Provider)
+}
+
+// handleMFAResult responds the page for the result of the MFA provider, and reports true if the user passed.
+//
+// The user goes back to the password form if denied, so attackers can't try the second factor without the password.
+func (ctx *AuthzContext) handleMFAResult(loginStart time.Time, username, provider string, challenge *mfa.Challenge, err error) bool {
+	switch {
+	case err == mfa.DeniedError:
+		ctx.Request.MFA = nil
+		ctx.API.recordLoginFailure(ctx.Gin, ctx.Report, nil, username, err)
+		ctx.loginFailed(loginStart, err, loginFailureMFADenied)
+		return false
+	case err != nil:
+		log.Error().Err(err).Str("mfa", provider).Msg("failed to verify the second factor")
+		ctx.ErrorRedirect(ctx.Request.makeRedirectError(err, errors.ServerError, "failed to verify multi-factor authentication"))
+		return false
+	case challenge != nil:
+		ctx.ShowMFAPage(http.StatusOK, &token.MFAClaims{
+			Subject:  username,
+			Provider: provider,
+			Message:  challenge.Message,
+			State:    challenge.State,
+		}, "")
+		return false
+	}
+	return true
+}
+
+// ShowMFAPage shows the login page that asks the answer of the second factor.
+func (ctx *AuthzContext) ShowMFAPage(code int, claims *token.MFAClaims, errorDescription string) {
+	ctx.Request.MFA = claims
+	ctx.Report.Continue()
+	if errorDescription != "" {
+		ctx.Report.SetError(ctx.Request.makeRedirectError(nil, errors.InvalidRequest, errorDescription))
+	}
+	ctx.showPage(code, false, claims.Subject, errorDescription, "")
+}
+
+// checkMFAWithoutPage runs the second factor for the flows that can't show the login page, like the password grant.
+// Only the providers that verify without input, like Duo push, can pass.
+func (api *LauthAPI) checkMFAWithoutPage(c *gin.Context, report *metrics.Context, conn ldap.Session, username, clientID string, decision policy.Decision) *errors.Error {
+	provider, err := api.mfaProviderFor(conn, username, clientID, decision)
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to get groups for MFA")
+		return &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to decide multi-factor authentication",
+		}
+	}
+	if provider == "" {
+		return nil
+	}
+	report.SetField("mfa", provider)
+
+	p, ok := api.MFA[provider]
+	if !ok {
+		return &errors.Error{
+			Reason:      errors.ServerError,
+			Description: "multi-factor authentication is not available",
+		}
+	}
+
+	challenge, err := p.Start(c.Request.Context(), username, api.clientIP(c))
+	switch {
+	case err == mfa.DeniedError:
+		report.SetField("login_failure", string(loginFailureMFADenied))
+		api.recordLoginFailure(c, report, conn, username, err)
+		return &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidGrant,
+			Description: "denied by multi-factor authentication",
+		}
+	case err != nil:
+		log.Error().Err(err).Str("mfa", provider).Msg("failed to verify the second factor")
+		return &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to verify multi-factor authentication",
+		}
+	case challenge != nil:
+		return &errors.Error{
+			Reason:      errors.InvalidGrant,
+			Description: "multi-factor authentication is required; please use the authorization code flow",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/lockout"
+	"github.com/macrat/lauth/mfa"
+	"github.com/macrat/lauth/policy"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+// DummyMFA accepts "123456", asks the second code for "next", and denies any other answer.
+// If Push is true, it verifies users without any input.
+type DummyMFA struct {
+	Push bool
+}
+
+func (m DummyMFA) Start(ctx context.Context, username, remoteAddr string) (*mfa.Challenge, error) {
+	if m.Push {
+		return nil, nil
+	}
+	return &mfa.Challenge{Message: "Enter the first code."}, nil
+}
+
+func (m DummyMFA) Verify(ctx context.Context, username, remoteAddr string, challenge mfa.Challenge, answer string) (*mfa.Challenge, error) {
+	switch answer {
+	case "123456":
+		return nil, nil
+	case "next":
+		return &mfa.Challenge{Message: "Enter the second code.", State: "second"}, nil
+	default:
+		return nil, mfa.DeniedError
+	}
+}
+
+func TestMFA_LoginPage(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+	env.API.Config.MFA.Default = "dummy"
+	env.API.MFA = map[string]mfa.Provider{"dummy": DummyMFA{}}
+
+	rp := env.SomeClientRP()
+
+	page := rp.Login(t, url.Values{}, "macrat", "foobar")
+	if page.Code != http.StatusOK {
+		t.Fatalf("expected MFA page but got status code %d", page.Code)
+	}
+	if !strings.Contains(string(page.Body), "Enter the first code.") {
+		t.Errorf("message of the provider is not shown")
+	}
+	testutil.AssertAccessible(t, "login.tmpl", page.Body)
+
+	if resp := rp.Login(t, url.Values{}, "macrat", "wrong"); resp.Code != http.StatusForbidden {
+		t.Errorf("wrong password should not ask the second factor: status code %d", resp.Code)
+	}
+
+	resp := rp.SubmitOTP(t, page, "000000")
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("expected to back to the login form but got status code %d", resp.Code)
+	} else if !strings.Contains(string(resp.Body), `name="password"`) || strings.Contains(string(resp.Body), `name="otp"`) {
+		t.Errorf("denied user should enter password again")
+	}
+
+	next := rp.SubmitOTP(t, page, "next")
+	if next.Code != http.StatusOK || !strings.Contains(string(next.Body), "Enter the second code.") {
+		t.Fatalf("expected the next challenge but got status code %d", next.Code)
+	}
+
+	resp = rp.SubmitOTP(t, next, "123456")
+	if resp.Code != http.StatusFound || resp.Params().Get("code") == "" {
+		t.Fatalf("expected to issue code but got status code %d: %s", resp.Code, resp.Location)
+	}
+	code, err := env.API.TokenManager.ParseCode(resp.Params().Get("code"))
+	if err != nil {
+		t.Fatalf("failed to parse code: %s", err)
+	}
+	if code.Subject != "macrat" {
+		t.Errorf("unexpected subject: %s", code.Subject)
+	}
+}
+
+func TestMFA_Push(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.MFA.Default = "push"
+	env.API.MFA = map[string]mfa.Provider{"push": DummyMFA{Push: true}}
+
+	resp := env.SomeClientRP().Login(t, url.Values{}, "macrat", "foobar")
+	if resp.Code != http.StatusFound || resp.Params().Get("code") == "" {
+		t.Fatalf("approved push should login without the MFA page: status code %d", resp.Code)
+	}
+}
+
+func TestMFA_Selection(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.MFA = map[string]mfa.Provider{"dummy": DummyMFA{}}
+
+	rp := env.SomeClientRP()
+	login := func() int {
+		return rp.Login(t, url.Values{}, "macrat", "foobar").Code
+	}
+
+	if code := login(); code != http.StatusFound {
+		t.Errorf("MFA should not be required without config: status code %d", code)
+	}
+
+	env.API.Config.MFA.Groups = []config.MFAGroup{
+		{Group: "cn=grafana-admins,ou=groups,dc=example,dc=com", Provider: "dummy"},
+	}
+	if code := login(); code != http.StatusOK {
+		t.Errorf("MFA should be required for the group member: status code %d", code)
+	}
+	if code := rp.Login(t, url.Values{}, "j.smith", "hello").Code; code != http.StatusFound {
+		t.Errorf("MFA should not be required for other users: status code %d", code)
+	}
+
+	env.API.Config.MFA.Groups = nil
+	client := env.API.Config.Clients["some_client_id"]
+	client.MFA = "dummy"
+	env.API.Config.Clients["some_client_id"] = client
+	if code := rp.Login(t, url.Values{}, "j.smith", "hello").Code; code != http.StatusOK {
+		t.Errorf("MFA should be required for the client: status code %d", code)
+	}
+}
+
+func TestMFA_SSO(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.MFA.Default = "dummy"
+	env.API.MFA = map[string]mfa.Provider{"dummy": DummyMFA{}}
+
+	makeSSOToken := func(passed []string) string {
+		t.Helper()
+		ssoToken, err := env.API.TokenManager.CreateSSOTokenWithMFA(
+			env.API.Config.Issuer,
+			"some-session",
+			"macrat",
+			"",
+			token.AuthorizedParties{"some_client_id"},
+			token.Consents{"some_client_id": "openid"},
+			passed,
+			time.Now(),
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("failed to create SSO token: %s", err)
+		}
+		return ssoToken
+	}
+
+	tests := []struct {
+		Name     string
+		SSOToken string
+		Error    string
+	}{
+		{"without MFA", makeSSOToken(nil), "login_required"},
+		{"another provider", makeSSOToken([]string{"another"}), "login_required"},
+		{"passed", makeSSOToken([]string{"dummy"}), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			params := url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"prompt":        {"none"},
+			}
+			req, _ := http.NewRequest("GET", "/authz?"+params.Encode(), nil)
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, tt.SSOToken))
+			resp := env.DoRequest(req)
+
+			loc, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("failed to parse location: %s", err)
+			}
+			if e := loc.Query().Get("error"); e != tt.Error {
+				t.Errorf("expected error %#v but got %#v", tt.Error, e)
+			}
+		})
+	}
+}
+
+func TestMFA_RenewSession(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	// tokens are verified by the real clock, so the fake clock goes from the past.
+	clock := env.UseFakeClock(time.Now().Add(-10 * time.Minute))
+	env.API.Config.MFA.Default = "dummy"
+	env.API.MFA = map[string]mfa.Provider{"dummy": DummyMFA{}}
+	env.API.Config.SSO.Sliding = true
+
+	authTime := clock.Now()
+	ssoToken, err := env.API.TokenManager.CreateSSOTokenWithMFA(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": "openid"},
+		[]string{"dummy"},
+		authTime,
+		authTime.Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	clock.Advance(5 * time.Minute)
+
+	resp := sessionRequest(t, env, "POST", "/session/renew", ssoToken, env.API.Config.Issuer.String())
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to renew: %d: %s", resp.Code, resp.Body.String())
+	}
+	renewed := ""
+	for _, c := range resp.Result().Cookies() {
+		if c.Name == api.SSO_TOKEN_COOKIE {
+			renewed = c.Value
+		}
+	}
+	if renewed == "" {
+		t.Fatalf("SSO token is not renewed")
+	}
+
+	params := url.Values{
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"client_id":     {"some_client_id"},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+		"prompt":        {"none"},
+	}
+	resp = sessionRequest(t, env, "GET", "/authz?"+params.Encode(), renewed, "")
+	loc, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse location: %s", err)
+	}
+	if e := loc.Query().Get("error"); e != "" || loc.Query().Get("code") == "" {
+		t.Errorf("expected to authorize with renewed SSO token but got error %#v", e)
+	}
+}
+
+func TestMFA_PasswordGrant(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.MFA.Default = "dummy"
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowPasswordGrant = true
+	env.API.Config.Clients["some_client_id"] = client
+
+	rp := env.SomeClientRP()
+	request := url.Values{
+		"grant_type": {"password"},
+		"username":   {"macrat"},
+		"password":   {"foobar"},
+		"scope":      {"openid"},
+	}
+
+	env.API.MFA = map[string]mfa.Provider{"dummy": DummyMFA{}}
+	if resp := rp.Token(t, request); resp.Error != "invalid_grant" {
+		t.Errorf("password grant can't answer challenges: %#v", resp)
+	}
+
+	env.API.MFA = map[string]mfa.Provider{"dummy": DummyMFA{Push: true}}
+	if resp := rp.Token(t, request); resp.Code != http.StatusOK {
+		t.Errorf("approved push should issue tokens: %#v", resp)
+	}
+}
+
+// MFAPolicy requires MFA only for users who failed to login, and skips it for others.
+type MFAPolicy struct {
+	Inputs []policy.Input
+}
+
+func (p *MFAPolicy) Decide(ctx context.Context, input policy.Input) (policy.Decision, error) {
+	p.Inputs = append(p.Inputs, input)
+
+	if input.Subject == "j.smith" {
+		return policy.Decision{Allow: false, Reason: "j.smith is not allowed"}, nil
+	}
+
+	provider := ""
+	if input.FailedLogins > 0 {
+		provider = "dummy"
+	}
+	return policy.Decision{Allow: true, MFA: &provider}, nil
+}
+
+func TestMFA_Policy(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login.FailureLatency = config.Duration(time.Millisecond)
+	env.API.Config.Login.LockoutThreshold = 5
+	env.API.Config.Login.LockoutDuration = config.Duration(time.Minute)
+	env.API.Lockout = lockout.NewCounter()
+	env.API.Config.MFA.Default = "dummy"
+	env.API.MFA = map[string]mfa.Provider{"dummy": DummyMFA{}}
+
+	p := &MFAPolicy{}
+	env.API.Policy = p
+
+	rp := env.SomeClientRP()
+
+	resp := rp.Login(t, url.Values{}, "macrat", "foobar")
+	if resp.Code != http.StatusFound || resp.Params().Get("code") == "" {
+		t.Fatalf("policy should skip MFA: status code %d", resp.Code)
+	}
+	if len(p.Inputs) != 1 {
+		t.Errorf("policy should be evaluated once per login but evaluated %d times", len(p.Inputs))
+	}
+
+	if resp := rp.Login(t, url.Values{}, "macrat", "wrong"); resp.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	p.Inputs = nil
+
+	resp = rp.Login(t, url.Values{}, "macrat", "foobar")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("policy should require MFA after failed login: status code %d", resp.Code)
+	}
+	if len(p.Inputs) != 1 || p.Inputs[0].FailedLogins != 1 {
+		t.Errorf("unexpected policy inputs: %#v", p.Inputs)
+	}
+
+	resp = rp.Login(t, url.Values{}, "j.smith", "hello")
+	if resp.Code != http.StatusFound || resp.Params().Get("error") != "access_denied" {
+		t.Errorf("denied user should not be asked MFA: status code %d: %s", resp.Code, resp.Location)
+	}
+}
@@ -0,0 +1,384 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/revocation"
+	"github.com/macrat/lauth/testutil"
+)
+
+const (
+	// testCodeVerifier and testCodeChallenge are the example in RFC 7636 Appendix B.
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestOAuth21Profile_Authz(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Profile = config.ProfileOAuth21
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "success",
+			Request: url.Values{
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+				"client_id":             {"some_client_id"},
+				"response_type":         {"code"},
+				"code_challenge":        {testCodeChallenge},
+				"code_challenge_method": {"S256"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "missing code_challenge",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Fragment:    url.Values{},
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
+				"error_description": {"code_challenge is required in OAuth 2.1; use PKCE with code_challenge_method=S256"},
+			},
+		},
+		{
+			Name: "plain method",
+			Request: url.Values{
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+				"client_id":             {"some_client_id"},
+				"response_type":         {"code"},
+				"code_challenge":        {testCodeChallenge},
+				"code_challenge_method": {"plain"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Fragment:    url.Values{},
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
+				"error_description": {"code_challenge_method must be S256 in OAuth 2.1"},
+			},
+		},
+		{
+			Name: "implicit flow",
+			Request: url.Values{
+				"redirect_uri":          {"http://implicit-client.example.com/callback"},
+				"client_id":             {"implicit_client_id"},
+				"response_type":         {"code token"},
+				"code_challenge":        {testCodeChallenge},
+				"code_challenge_method": {"S256"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"unsupported_response_type"},
+				"iss":               {env.API.Config.Issuer.String()},
+				"error_description": {"implicit/hybrid flow is not allowed in OAuth 2.1; use response_type=code with PKCE"},
+			},
+		},
+	})
+
+	var c config.OpenIDConfiguration
+	resp := env.Get("/.well-known/openid-configuration", "", nil)
+	if err := json.Unmarshal(resp.Body.Bytes(), &c); err != nil {
+		t.Fatalf("failed to parse discovery: %s", err)
+	}
+	if len(c.ResponseTypesSupported) != 1 || len(c.CodeChallengeMethodsSupported) != 1 || c.CodeChallengeMethodsSupported[0] != "S256" {
+		t.Errorf("unexpected discovery: %#v", c)
+	}
+}
+
+func TestOAuth21Profile_Token(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Profile = config.ProfileOAuth21
+	env.API.Revocation = revocation.NewList()
+
+	rp := env.SomeClientRP()
+
+	resp := rp.Login(t, url.Values{
+		"scope":                 {"openid"},
+		"code_challenge":        {testCodeChallenge},
+		"code_challenge_method": {"S256"},
+	}, "macrat", "foobar")
+	if resp.Code != http.StatusFound {
+		t.Fatalf("failed to login: %d: %s", resp.Code, resp.Body)
+	}
+	code := resp.Query.Get("code")
+	if code == "" {
+		t.Fatalf("code is not issued: %s", resp.Location)
+	}
+
+	codeRequest := func(code, verifier string) url.Values {
+		return url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {rp.RedirectURI},
+			"code_verifier": {verifier},
+		}
+	}
+
+	if r := rp.Token(t, codeRequest(code, "")); r.Code != http.StatusBadRequest || r.ErrorDescription != "code_verifier is required" {
+		t.Errorf("expected error without code_verifier but got %d: %#v", r.Code, r.ErrorDescription)
+	}
+	if r := rp.Token(t, codeRequest(code, testCodeVerifier[1:]+"x")); r.Code != http.StatusBadRequest || r.ErrorDescription != "code_verifier doesn't match to code_challenge" {
+		t.Errorf("expected error with wrong code_verifier but got %d: %#v", r.Code, r.ErrorDescription)
+	}
+
+	tokens := rp.Token(t, codeRequest(code, testCodeVerifier))
+	if tokens.Code != http.StatusOK {
+		t.Fatalf("failed to get token: %d: %s", tokens.Code, tokens.ErrorDescription)
+	}
+	if tokens.RefreshToken == "" {
+		t.Fatalf("refresh_token is not issued")
+	}
+
+	rotated := rp.Refresh(t, tokens.RefreshToken)
+	if rotated.Code != http.StatusOK {
+		t.Fatalf("failed to refresh: %d: %s", rotated.Code, rotated.ErrorDescription)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("refresh_token is not rotated")
+	}
+
+	if r := rp.Refresh(t, tokens.RefreshToken); r.Code != http.StatusBadRequest || r.Error != "invalid_grant" {
+		t.Errorf("expected error when reuse refresh_token but got %d: %#v", r.Code, r.Error)
+	}
+	if r := rp.Refresh(t, rotated.RefreshToken); r.Code != http.StatusOK {
+		t.Errorf("failed to refresh with rotated token: %d: %s", r.Code, r.ErrorDescription)
+	}
+
+	legacyCode, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid",
+		"",
+		time.Now(),
+		time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to make code: %s", err)
+	}
+	if r := rp.Token(t, codeRequest(legacyCode, "")); r.Code != http.StatusBadRequest || r.Error != "invalid_grant" {
+		t.Errorf("expected error for code without PKCE but got %d: %#v", r.Code, r.Error)
+	}
+}
+
+func TestOAuth21Profile_ConcurrentRefresh(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Profile = config.ProfileOAuth21
+	env.API.Revocation = revocation.NewList()
+
+	rp := env.SomeClientRP()
+
+	refreshToken, err := env.API.TokenManager.CreateRefreshToken(env.API.Config.Issuer, "macrat", "some_client_id", "openid", "", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make refresh_token: %s", err)
+	}
+
+	request := url.Values{
+		"client_id":     {rp.ClientID},
+		"client_secret": {rp.ClientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}
+
+	// Goroutines only collect responses, because t.Fatal can't be called out of the test goroutine.
+	const n = 10
+	results := make(chan *httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- env.Post(env.API.Config.Endpoints.Token, "", request)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for resp := range results {
+		var r testutil.TokenResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &r); err != nil {
+			t.Fatalf("failed to parse token response: %s", err)
+		}
+		if resp.Code == http.StatusOK {
+			succeeded++
+		} else if r.Error != "invalid_grant" {
+			t.Errorf("unexpected error: %d: %#v", resp.Code, r.Error)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("only one of concurrent requests should succeed but %d succeeded", succeeded)
+	}
+}
+
+func TestOAuth21Profile_RefreshAfterRejected(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Profile = config.ProfileOAuth21
+	env.API.Revocation = revocation.NewList()
+
+	rp := env.SomeClientRP()
+
+	refreshToken, err := env.API.TokenManager.CreateRefreshToken(env.API.Config.Issuer, "macrat", "some_client_id", "openid", "", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make refresh_token: %s", err)
+	}
+
+	r := rp.Token(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"scope":         {"openid profile"},
+	})
+	if r.Code != http.StatusBadRequest || r.Error != "invalid_scope" {
+		t.Fatalf("expected invalid_scope but got %d: %#v", r.Code, r.Error)
+	}
+
+	if r := rp.Refresh(t, refreshToken); r.Code != http.StatusOK || r.RefreshToken == "" {
+		t.Errorf("failed to refresh after rejected request: %d: %s", r.Code, r.ErrorDescription)
+	}
+}
+
+func TestPostToken_PKCE(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	code, err := env.API.TokenManager.CreateCodeWithChallenge(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid",
+		"",
+		testCodeVerifier,
+		"plain",
+		time.Now(),
+		time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to make code: %s", err)
+	}
+
+	for _, tt := range []struct {
+		Verifier string
+		Code     int
+	}{
+		{"", http.StatusBadRequest},
+		{testCodeChallenge, http.StatusBadRequest},
+		{testCodeVerifier, http.StatusOK},
+	} {
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+			"code_verifier": {tt.Verifier},
+		})
+		if resp.Code != tt.Code {
+			t.Errorf("%#v: expected status code %d but got %d: %s", tt.Verifier, tt.Code, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestGetAuthz_ClientPKCE(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.RequirePKCE = true
+	client.PKCEMethods = []string{"S256"}
+	env.API.Config.Clients["some_client_id"] = client
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "S256",
+			Request: url.Values{
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+				"client_id":             {"some_client_id"},
+				"response_type":         {"code"},
+				"code_challenge":        {testCodeChallenge},
+				"code_challenge_method": {"S256"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "missing code_challenge",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Fragment:    url.Values{},
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
+				"error_description": {"code_challenge is required for this client"},
+			},
+		},
+		{
+			Name: "plain",
+			Request: url.Values{
+				"redirect_uri":   {"http://some-client.example.com/callback"},
+				"client_id":      {"some_client_id"},
+				"response_type":  {"code"},
+				"code_challenge": {testCodeVerifier},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Fragment:    url.Values{},
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"iss":               {env.API.Config.Issuer.String()},
+				"error_description": {"code_challenge_method must be S256 for this client"},
+			},
+		},
+		{
+			Name: "another client",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"code"},
+			},
+			Code: http.StatusOK,
+		},
+	})
+
+	code, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid",
+		"",
+		time.Now(),
+		time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to make code: %s", err)
+	}
+	resp := env.Post("/token", "", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+	})
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected error for code without PKCE but got %d", resp.Code)
+	}
+}
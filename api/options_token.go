@@ -20,8 +20,7 @@ func (api *LauthAPI) OptionsToken(c *gin.Context) {
 	report := metrics.StartToken(c)
 	defer report.Close()
 
-	c.Header("Cache-Control", "no-store")
-	c.Header("Pragma", "no-cache")
+	noStore(c)
 
 	if getOriginHeader(c) != "" {
 		e := &errors.Error{
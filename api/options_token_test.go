@@ -31,6 +31,8 @@ func TestOptionsToken(t *testing.T) {
 	expected := map[string]string{
 		"error":             "access_denied",
 		"error_description": "Origin header was set. You can't use token endpoint via browser.",
+		"error_code":        "LA4001",
+		"error_uri":         env.API.Config.Issuer.String() + "/errors/LA4001",
 	}
 
 	var body map[string]string
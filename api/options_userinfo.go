@@ -16,8 +16,7 @@ func (api *LauthAPI) OptionsUserInfo(c *gin.Context) {
 	report := metrics.StartUserinfo(c)
 	defer report.Close()
 
-	c.Header("Cache-Control", "no-store")
-	c.Header("Pragma", "no-cache")
+	noStore(c)
 
 	req := new(OptionsUserInfoRequest)
 	if err := c.ShouldBindHeader(req); err == nil && req.Origin != "" {
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/page"
+)
+
+func (api *LauthAPI) negotiateLocale(c *gin.Context) {
+	if len(api.Config.Templates.Languages()) > 1 {
+		c.Header("Vary", "Accept-Language")
+	}
+	page.SetLocale(c, page.Negotiate(api.Config.Templates, c.GetHeader("Accept-Language")))
+}
+
+// pageData adds the locale and the Content-Security-Policy nonce of the request to the data of a page.
+func pageData(c *gin.Context, data gin.H) gin.H {
+	data["locale"] = page.GetLocale(c)
+	data["csp_nonce"] = page.GetCSPNonce(c)
+	return data
+}
+
+// pageDataWithExpiry adds the locale and the expiration formatted in the locale to the data of a page.
+func pageDataWithExpiry(c *gin.Context, data gin.H, now time.Time, expiresAt time.Time) gin.H {
+	l := page.GetLocale(c)
+	data["expires_in"] = l.Duration(expiresAt.Sub(now))
+	data["expires_at"] = l.Time(expiresAt)
+	return pageData(c, data)
+}
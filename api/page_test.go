@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/page"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestPageLocale(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Templates.Language = "en,ja"
+	env.API.Config.Templates.Timezone = "UTC"
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write template: %s", err)
+		}
+		return p
+	}
+
+	renderer, err := page.NewRenderer(config.TemplateConfig{
+		Language:  "en,ja",
+		LoginPage: write("login.tmpl", `{{ .locale }}|{{ .expires_in }}|{{ .expires_at }}`),
+		ErrorPage: write("error.tmpl", `{{ .locale }}|{{ .error_message }}`),
+	})
+	if err != nil {
+		t.Fatalf("failed to load templates: %s", err)
+	}
+	env.App.HTMLRender = renderer
+
+	authz := "/authz?" + url.Values{
+		"response_type": {"code"},
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid"},
+	}.Encode()
+
+	tests := []struct {
+		Path           string
+		AcceptLanguage string
+		Code           int
+		Body           *regexp.Regexp
+	}{
+		{authz, "", http.StatusOK, regexp.MustCompile(`^en\|30 minutes\|[A-Z][a-z]{2} \d{1,2}, \d{4} \d{2}:\d{2} UTC$`)},
+		{authz, "ja,en;q=0.5", http.StatusOK, regexp.MustCompile(`^ja\|30分\|\d{4}年\d{1,2}月\d{1,2}日 \d{2}:\d{2} UTC$`)},
+		{"/no-such-page", "en-US", http.StatusNotFound, regexp.MustCompile(`^en\|The page is not found\.$`)},
+		{"/no-such-page", "ja-JP", http.StatusNotFound, regexp.MustCompile(`^ja\|ページが見つかりません。$`)},
+	}
+
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.Path, nil)
+		r.RemoteAddr = "[::1]:54321"
+		if tt.AcceptLanguage != "" {
+			r.Header.Set("Accept-Language", tt.AcceptLanguage)
+		}
+
+		resp := env.DoRequest(r)
+
+		if resp.Code != tt.Code {
+			t.Errorf("%s with %#v: unexpected status code: %d", tt.Path, tt.AcceptLanguage, resp.Code)
+		}
+		if !tt.Body.MatchString(resp.Body.String()) {
+			t.Errorf("%s with %#v: unexpected body: %s", tt.Path, tt.AcceptLanguage, resp.Body.String())
+		}
+		if resp.Header().Get("Vary") != "Accept-Language" {
+			t.Errorf("%s with %#v: unexpected Vary header: %#v", tt.Path, tt.AcceptLanguage, resp.Header().Get("Vary"))
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/policy"
+	"github.com/rs/zerolog/log"
+)
+
+func (api *LauthAPI) policyInput(c *gin.Context, subject, clientID string, scope *StringSet) (policy.Input, *errors.Error) {
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to connecting LDAP server")
+
+		return policy.Input{}, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to check authorization policy",
+		}
+	}
+	defer conn.Close()
+
+	attr := api.Config.Policy.GroupsAttribute
+	attrs, err := conn.GetUserAttributes(subject, []string{attr})
+	if err != nil {
+		return policy.Input{}, &errors.Error{
+			Err:         err,
+			Reason:      errors.AccessDenied,
+			Description: "user was not found or disabled",
+		}
+	}
+
+	groups := attrs[attr]
+	if groups == nil {
+		groups = []string{}
+	}
+
+	scopes := scope.List()
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return policy.Input{
+		Subject:      subject,
+		ClientID:     clientID,
+		Scopes:       scopes,
+		RemoteAddr:   api.clientIP(c),
+		Groups:       groups,
+		FailedLogins: api.countLoginFailures(subject),
+	}, nil
+}
+
+func (api *LauthAPI) checkPolicy(c *gin.Context, subject, clientID string, scope *StringSet) *errors.Error {
+	_, e := api.decidePolicy(c, subject, clientID, scope)
+	return e
+}
+
+// decidePolicy evaluates the authorization policy, and returns the decision if allowed.
+// The decision also tells if the user needs MFA.
+func (api *LauthAPI) decidePolicy(c *gin.Context, subject, clientID string, scope *StringSet) (policy.Decision, *errors.Error) {
+	if api.Policy == nil {
+		return policy.Decision{Allow: true}, nil
+	}
+
+	input, e := api.policyInput(c, subject, clientID, scope)
+	if e != nil {
+		return policy.Decision{}, e
+	}
+
+	decision, err := api.Policy.Decide(c.Request.Context(), input)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to evaluate authorization policy")
+
+		return policy.Decision{}, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to check authorization policy",
+		}
+	}
+
+	if !decision.Allow {
+		description := decision.Reason
+		if description == "" {
+			description = "denied by authorization policy"
+		}
+		return policy.Decision{}, &errors.Error{
+			Reason:      errors.AccessDenied,
+			Description: description,
+		}
+	}
+
+	return decision, nil
+}
+
+func (api *LauthAPI) filterClaims(c *gin.Context, subject, clientID string, scope *StringSet, claims map[string]interface{}) (map[string]interface{}, *errors.Error) {
+	filter, ok := api.Policy.(policy.ClaimFilter)
+	if !ok {
+		return claims, nil
+	}
+
+	input, e := api.policyInput(c, subject, clientID, scope)
+	if e != nil {
+		return nil, e
+	}
+	input.Claims = claims
+
+	filtered, err := filter.FilterClaims(c.Request.Context(), input)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to evaluate claims policy")
+
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to get user info",
+		}
+	}
+	if filtered == nil {
+		filtered = make(map[string]interface{})
+	}
+	filtered["sub"] = subject
+
+	return filtered, nil
+}
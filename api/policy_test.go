@@ -0,0 +1,231 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/policy"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+type DummyPolicy map[string]policy.Decision
+
+func (p DummyPolicy) Decide(ctx context.Context, input policy.Input) (policy.Decision, error) {
+	if d, ok := p[input.Subject]; ok {
+		return d, nil
+	}
+	return policy.Decision{Allow: true}, nil
+}
+
+func TestPolicy(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Policy = DummyPolicy{
+		"j.smith": {Allow: false, Reason: "j.smith is not allowed"},
+	}
+
+	expiresAt := time.Now().Add(10 * time.Minute)
+	request, err := env.API.TokenManager.CreateRequestObject(
+		env.API.Config.Issuer,
+		"::1",
+		token.RequestObjectClaims{
+			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
+			RedirectURI:  "http://some-client.example.com/callback",
+			ResponseType: "code",
+		},
+		expiresAt,
+	)
+	if err != nil {
+		t.Fatalf("faield to make request: %s", err)
+	}
+
+	env.RedirectTest(t, "POST", "/authz", []testutil.RedirectTest{
+		{
+			Name: "allowed user",
+			Request: url.Values{
+				"request":  {request},
+				"username": {"macrat"},
+				"password": {"foobar"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			CheckParams: func(t *testing.T, query, fragment url.Values) {
+				if query.Get("code") == "" {
+					t.Errorf("code is not set: %#v", query)
+				}
+			},
+		},
+		{
+			Name: "denied user",
+			Request: url.Values{
+				"request":  {request},
+				"username": {"j.smith"},
+				"password": {"hello"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"access_denied"},
+				"iss":               {env.API.Config.Issuer.String()},
+				"error_description": {"j.smith is not allowed"},
+			},
+			Fragment: url.Values{},
+		},
+	})
+
+	code, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"j.smith",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid",
+		"",
+		time.Now(),
+		env.API.Config.Expire.Code.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test code: %s", err)
+	}
+
+	refreshToken, err := env.API.TokenManager.CreateRefreshToken(
+		env.API.Config.Issuer,
+		"j.smith",
+		"some_client_id",
+		"openid",
+		"",
+		time.Now(),
+		env.API.Config.Expire.Refresh.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test refresh_token: %s", err)
+	}
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name: "authorization_code",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "access_denied",
+				"error_description": "j.smith is not allowed",
+			},
+		},
+		{
+			Name: "refresh_token",
+			Request: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {refreshToken},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "access_denied",
+				"error_description": "j.smith is not allowed",
+			},
+		},
+	})
+}
+
+type DummyClaimPolicy struct {
+	DummyPolicy
+}
+
+func (p DummyClaimPolicy) FilterClaims(ctx context.Context, input policy.Input) (map[string]interface{}, error) {
+	delete(input.Claims, "phone_number")
+	return input.Claims, nil
+}
+
+func TestPolicy_FilterClaims(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Policy = DummyClaimPolicy{}
+
+	accessToken, err := env.API.TokenManager.CreateAccessToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"openid email phone",
+		time.Now(),
+		time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test token: %s", err)
+	}
+
+	env.JSONTest(t, "GET", "/userinfo", []testutil.JSONTest{
+		{
+			Name:  "filtered",
+			Token: "Bearer " + accessToken,
+			Code:  http.StatusOK,
+			Body: map[string]interface{}{
+				"sub":   "macrat",
+				"email": "m@crat.jp",
+			},
+		},
+	})
+}
+
+func TestPolicy_RemoteAddr(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowPasswordGrant = true
+	env.API.Config.Clients["some_client_id"] = client
+
+	p := &MFAPolicy{}
+	env.API.Policy = p
+
+	tests := []struct {
+		Name           string
+		TrustedProxies []string
+		Remote         string
+		ForwardedFor   string
+		Expect         string
+	}{
+		{"direct", nil, "203.0.113.5:1234", "", "203.0.113.5"},
+		{"spoofed header", nil, "203.0.113.5:1234", "10.0.0.1", "203.0.113.5"},
+		{"trusted proxy", []string{"192.0.2.0/24"}, "192.0.2.10:1234", "203.0.113.5", "203.0.113.5"},
+		{"spoofed through trusted proxy", []string{"192.0.2.0/24"}, "192.0.2.10:1234", "10.0.0.1, 203.0.113.5", "203.0.113.5"},
+		{"untrusted proxy", []string{"192.0.2.0/24"}, "198.51.100.1:1234", "10.0.0.1", "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			env.API.Config.Server.TrustedProxies = tt.TrustedProxies
+			p.Inputs = nil
+
+			req := httptest.NewRequest("POST", env.API.Config.Endpoints.Token, strings.NewReader(url.Values{
+				"grant_type":    {"password"},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"username":      {"macrat"},
+				"password":      {"foobar"},
+				"scope":         {"openid"},
+			}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.RemoteAddr = tt.Remote
+			if tt.ForwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.ForwardedFor)
+			}
+
+			if resp := env.DoRequest(req); resp.Code != http.StatusOK {
+				t.Fatalf("failed to get token: %d: %s", resp.Code, resp.Body.String())
+			}
+			if len(p.Inputs) != 1 || p.Inputs[0].RemoteAddr != tt.Expect {
+				t.Errorf("expected remote_addr %s but got %#v", tt.Expect, p.Inputs)
+			}
+		})
+	}
+}
@@ -6,41 +6,55 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/ldap"
 	"github.com/rs/zerolog/log"
 )
 
 func (api *LauthAPI) PostAuthz(c *gin.Context) {
 	ctx, e := NewAuthzContext(api, c)
 	if e != nil {
-		errors.SendRedirect(c, e)
+		api.sendAuthzError(c, e)
 		return
 	}
 	defer ctx.Close()
 
+	ctx.Request.User = api.Config.Login.NormalizeUsername(ctx.Request.User)
 	ctx.Report.Set("username", ctx.Request.User)
 
-	showLoginForm := func(err error, description string) {
-		ctx.Report.SetError(ctx.Request.makeRedirectError(err, errors.InvalidRequest, description))
-		ctx.ShowLoginPage(http.StatusForbidden, ctx.Request.User, description)
-	}
-
-	if ctx.Request.RequestSubject != ctx.Gin.ClientIP() {
+	endSessionCheck := ctx.Report.Step("session_check")
+	if ctx.Request.RequestSubject != ctx.API.clientIP(ctx.Gin) || !api.checkLoginSession(c, ctx.Request.LoginSession) {
+		endSessionCheck()
 		e := ctx.Request.makeNonRedirectError(nil, errors.AccessDenied, "incorrect login session")
 		ctx.ErrorRedirect(e)
 		return
 	}
+	endSessionCheck()
 
 	if proceed := ctx.TrySSO(true); proceed {
 		return
 	}
 
+	if ctx.Request.MFA != nil {
+		ctx.verifyMFA()
+		return
+	}
+
 	if ctx.Request.User == "" || ctx.Request.Password == "" {
 		ctx.Report.UserError()
-		showLoginForm(nil, "missing username or password")
+		ctx.showLoginForm(nil, "missing username or password")
+		return
+	}
+
+	loginStart := time.Now()
+
+	if api.isLockedOut(ctx.Request.User) {
+		ctx.loginFailed(loginStart, nil, ldap.LoginFailureTooManyAttempts)
 		return
 	}
 
+	endConnect := ctx.Report.Step("ldap_connect")
 	conn, err := api.Connector.Connect()
+	endConnect()
 	if err != nil {
 		log.Error().
 			Err(err).
@@ -52,16 +66,79 @@ func (api *LauthAPI) PostAuthz(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	if err := conn.LoginTest(ctx.Request.User, ctx.Request.Password); err != nil {
-		ctx.Report.UserError()
-		RandomDelay()
-		showLoginForm(err, "invalid username or password")
+	endBind := ctx.Report.Step("ldap_bind")
+	err = conn.LoginTest(ctx.Request.User, ctx.Request.Password)
+	endBind()
+	if err != nil {
+		api.recordLoginFailure(ctx.Gin, ctx.Report, nil, ctx.Request.User, err)
+		ctx.loginFailed(loginStart, err, ldap.ClassifyLoginError(err))
 		return
 	}
 
-	if api.Config.Expire.SSO > 0 {
-		api.SetSSOToken(c, ctx.Request.User, ctx.Request.ClientID, true)
+	verified, provider := ctx.startMFA(conn, loginStart, ctx.Request.User)
+	if !verified {
+		return
 	}
+	api.resetLoginFailures(ctx.Request.User)
 
-	ctx.SendTokens(ctx.Request.User, time.Now())
+	ctx.completeLogin(ctx.Request.User, provider)
+}
+
+func (ctx *AuthzContext) showLoginForm(err error, description string) {
+	ctx.Report.SetError(ctx.Request.makeRedirectError(err, errors.InvalidRequest, description))
+	ctx.ShowLoginPage(http.StatusForbidden, ctx.Request.User, description)
+}
+
+// loginFailed responds the login form for the failed login, after the delay since loginStart to prevent guessing users by timing.
+func (ctx *AuthzContext) loginFailed(loginStart time.Time, err error, failure ldap.LoginFailure) {
+	ctx.Report.UserError()
+	ctx.Report.SetField("login_failure", string(failure))
+	if latency := ctx.API.Config.Login.FailureLatency.Duration(); latency > 0 {
+		EqualizeDelay(loginStart, latency)
+	} else {
+		RandomDelay()
+	}
+	if ctx.API.Config.Login.ShowsDetailedErrors(ctx.API.clientIP(ctx.Gin)) {
+		ctx.Report.SetError(ctx.Request.makeRedirectError(err, errors.InvalidRequest, "invalid username or password"))
+		ctx.ShowLoginFailurePage(http.StatusForbidden, ctx.Request.User, "invalid username or password", loginFailureMessage(failure))
+	} else {
+		ctx.showLoginForm(err, "invalid username or password")
+	}
+}
+
+// completeLogin issues the SSO token and the tokens for the client, after the user passed all factors.
+// The mfaProvider is the name of the MFA provider that the user passed, or empty if not used.
+func (ctx *AuthzContext) completeLogin(subject, mfaProvider string) {
+	if ctx.API.Config.Expire.SSO > 0 && ctx.API.Config.Clients[ctx.Request.ClientID].UsesSSO() {
+		if id, err := ctx.API.SetSSOToken(ctx.Gin, subject, ctx.Request.ClientID, ctx.Request.Scope, true, mfaProvider); err == nil {
+			ctx.Report.SetField("sso_id", id)
+		}
+	}
+
+	ctx.SendTokens(subject, ctx.API.TokenManager.Now())
+}
+
+// loginFailureMessage makes the message for the login form that tells the reason of failure.
+// Please use it only for the trusted networks, because it tells whether the user exists.
+func loginFailureMessage(failure ldap.LoginFailure) string {
+	switch failure {
+	case ldap.LoginFailureUserNotFound:
+		return "User not found."
+	case ldap.LoginFailureMultipleUsers:
+		return "Multiple users found."
+	case ldap.LoginFailureWrongPassword:
+		return "Incorrect password."
+	case ldap.LoginFailureAccountDisabled:
+		return "Account disabled."
+	case ldap.LoginFailureAccountLocked:
+		return "Account locked."
+	case ldap.LoginFailurePasswordExpired:
+		return "Password expired."
+	case ldap.LoginFailureTooManyAttempts:
+		return "Too many failed logins. Please try again later."
+	case loginFailureMFADenied:
+		return "Multi-factor authentication failed."
+	default:
+		return "Invalid username or password."
+	}
 }
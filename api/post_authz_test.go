@@ -4,9 +4,11 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/macrat/lauth/api"
 	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/testutil"
 	"github.com/macrat/lauth/token"
@@ -24,6 +26,7 @@ func TestPostAuthz(t *testing.T) {
 		"::1",
 		token.RequestObjectClaims{
 			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
 			RedirectURI:  "http://some-client.example.com/callback",
 			ResponseType: "code",
 		},
@@ -39,6 +42,7 @@ func TestPostAuthz(t *testing.T) {
 			"::1",
 			token.RequestObjectClaims{
 				ClientID:     "implicit_client_id",
+				LoginSession: testutil.LoginSessionHash,
 				RedirectURI:  "http://implicit-client.example.com/callback",
 				ResponseType: responseType,
 				Scope:        scope,
@@ -57,6 +61,7 @@ func TestPostAuthz(t *testing.T) {
 		"10.2.3.4",
 		token.RequestObjectClaims{
 			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
 			RedirectURI:  "http://some-client.example.com/callback",
 			ResponseType: "code",
 		},
@@ -71,6 +76,7 @@ func TestPostAuthz(t *testing.T) {
 		"::1",
 		token.RequestObjectClaims{
 			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
 			RedirectURI:  "http://some-client.example.com/callback",
 			ResponseType: "code",
 		},
@@ -94,6 +100,7 @@ func TestPostAuthz(t *testing.T) {
 		"::1",
 		token.RequestObjectClaims{
 			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
 			RedirectURI:  "http://some-client.example.com/callback",
 			ResponseType: "code",
 		},
@@ -215,6 +222,9 @@ func TestPostAuthz(t *testing.T) {
 				if query.Get("id_token") != "" {
 					t.Errorf("expected id_token is not set but set %#v", query.Get("id_token"))
 				}
+				if query.Get("iss") != env.API.Config.Issuer.String() {
+					t.Errorf("expected iss is issuer URL but got %#v", query.Get("iss"))
+				}
 			},
 		},
 		{
@@ -252,6 +262,9 @@ func TestPostAuthz(t *testing.T) {
 				if fragment.Get("state") != "" {
 					t.Errorf("expected state is not set but got %#v", fragment.Get("state"))
 				}
+				if fragment.Get("iss") != env.API.Config.Issuer.String() {
+					t.Errorf("expected iss is issuer URL but got %#v", fragment.Get("iss"))
+				}
 			},
 		},
 		{
@@ -402,3 +415,244 @@ func TestPostAuthz(t *testing.T) {
 		},
 	})
 }
+
+func TestPostAuthz_LoginConfig(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Login = config.LoginConfig{
+		DisableAutocomplete: true,
+		PasswordToggle:      true,
+		UsernameCase:        "lower",
+		StripDomains:        []string{"EXAMPLE", "example.com"},
+	}
+
+	request, err := env.API.TokenManager.CreateRequestObject(
+		env.API.Config.Issuer,
+		"::1",
+		token.RequestObjectClaims{
+			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
+			RedirectURI:  "http://some-client.example.com/callback",
+			ResponseType: "code",
+		},
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("faield to make request: %s", err)
+	}
+
+	checkSubject := func(t *testing.T, query, fragment url.Values) {
+		if code, err := env.API.TokenManager.ParseCode(query.Get("code")); err != nil {
+			t.Errorf("failed to parse code: %s", err)
+		} else if code.Subject != "macrat" {
+			t.Errorf("expected subject is \"macrat\" but got %#v", code.Subject)
+		}
+	}
+
+	env.RedirectTest(t, "POST", "/authz", []testutil.RedirectTest{
+		{
+			Name: "login form",
+			Request: url.Values{
+				"request":  {request},
+				"username": {"macrat"},
+				"password": {"invalid"},
+			},
+			Code:         http.StatusForbidden,
+			BodyIncludes: []string{`autocomplete="off"`, `class="password-toggle"`},
+		},
+		{
+			Name: "NetBIOS domain",
+			Request: url.Values{
+				"request":  {request},
+				"username": {`EXAMPLE\MacRat`},
+				"password": {"foobar"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			CheckParams: checkSubject,
+		},
+		{
+			Name: "UPN",
+			Request: url.Values{
+				"request":  {request},
+				"username": {"macrat@example.com"},
+				"password": {"foobar"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			CheckParams: checkSubject,
+		},
+		{
+			Name: "unknown domain",
+			Request: url.Values{
+				"request":  {request},
+				"username": {`OTHER\macrat`},
+				"password": {"foobar"},
+			},
+			Code:         http.StatusForbidden,
+			BodyIncludes: []string{"Invalid username or password."},
+		},
+	})
+}
+
+func TestPostAuthz_LoginFailure(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	users := testutil.DummyLDAP{}
+	for name, user := range testutil.LDAP {
+		users[name] = user
+	}
+	users["disabled"] = testutil.DummyUserInfo{Password: "foobar", Disabled: true}
+	env.API.Connector = users
+
+	request, err := env.API.TokenManager.CreateRequestObject(
+		env.API.Config.Issuer,
+		"::1",
+		token.RequestObjectClaims{
+			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
+			RedirectURI:  "http://some-client.example.com/callback",
+			ResponseType: "code",
+		},
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("faield to make request: %s", err)
+	}
+
+	login := func(username, password string) string {
+		resp := env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {username},
+			"password": {password},
+		})
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("%s: unexpected status code: %d", username, resp.Code)
+		}
+
+		body := resp.Body.String()
+		start := strings.Index(body, `<div id="alert" role="alert">`)
+		if start < 0 {
+			t.Fatalf("%s: alert is not found in the login page", username)
+		}
+		end := strings.Index(body[start:], "</div>")
+		return body[start : start+end]
+	}
+
+	tests := []struct {
+		Username string
+		Password string
+		Detail   string
+	}{
+		{"unknown", "foobar", "Error: User not found."},
+		{"macrat", "invalid", "Error: Incorrect password."},
+		{"disabled", "foobar", "Error: Account disabled."},
+	}
+
+	var generic string
+	for _, tt := range tests {
+		msg := login(tt.Username, tt.Password)
+		if generic == "" {
+			generic = msg
+		}
+		if msg != generic || !strings.Contains(msg, "Invalid username or password.") {
+			t.Errorf("%s: expected generic message %#v but got %#v", tt.Username, generic, msg)
+		}
+	}
+
+	env.API.Config.Login.DetailedErrors = []string{"::1/128"}
+	for _, tt := range tests {
+		if msg := login(tt.Username, tt.Password); !strings.Contains(msg, tt.Detail) {
+			t.Errorf("%s: expected %#v on trusted network but got %#v", tt.Username, tt.Detail, msg)
+		}
+	}
+
+	env.API.Config.Login.DetailedErrors = []string{"10.0.0.0/8"}
+	if msg := login("unknown", "foobar"); msg != generic {
+		t.Errorf("expected generic message on untrusted network but got %#v", msg)
+	}
+
+	req, _ := http.NewRequest("POST", "/authz", strings.NewReader(url.Values{
+		"request":  {request},
+		"username": {"unknown"},
+		"password": {"foobar"},
+	}.Encode()))
+	req.RemoteAddr = "[::1]:54321"
+	req.AddCookie(&http.Cookie{Name: api.LOGIN_SESSION_COOKIE, Value: testutil.LoginSession})
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", "10.1.2.3")
+	if resp := env.DoRequest(req); strings.Contains(resp.Body.String(), "User not found.") {
+		t.Errorf("X-Forwarded-For from untrusted peer should not enable detailed errors")
+	}
+}
+
+func TestAuthz_ClientWithoutSSO(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	disabled := false
+	client := env.API.Config.Clients["some_client_id"]
+	client.SSO = &disabled
+	env.API.Config.Clients["some_client_id"] = client
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	authzRequest := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid"},
+	}
+
+	resp := sessionRequest(t, env, "GET", "/authz?"+authzRequest.Encode(), ssoToken, "")
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected login page but got status %d", resp.Code)
+	}
+
+	authzRequest.Set("prompt", "none")
+	resp = sessionRequest(t, env, "GET", "/authz?"+authzRequest.Encode(), ssoToken, "")
+	if loc, err := url.Parse(resp.Header().Get("Location")); err != nil {
+		t.Errorf("failed to parse location: %s", err)
+	} else if e := loc.Query().Get("error"); e != "login_required" {
+		t.Errorf("expected login_required but got %#v", e)
+	}
+
+	request, err := env.API.TokenManager.CreateRequestObject(
+		env.API.Config.Issuer,
+		"::1",
+		token.RequestObjectClaims{
+			ClientID:     "some_client_id",
+			LoginSession: testutil.LoginSessionHash,
+			RedirectURI:  "http://some-client.example.com/callback",
+			ResponseType: "code",
+		},
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("faield to make request: %s", err)
+	}
+
+	resp = env.Post("/authz", "", url.Values{
+		"request":  {request},
+		"username": {"macrat"},
+		"password": {"foobar"},
+	})
+	if resp.Code != http.StatusFound {
+		t.Fatalf("failed to login: status %d", resp.Code)
+	}
+	for _, c := range resp.Result().Cookies() {
+		if c.Name == api.SSO_TOKEN_COOKIE {
+			t.Errorf("SSO token is set for the client without SSO")
+		}
+	}
+}
@@ -1,16 +1,25 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/events"
+	"github.com/macrat/lauth/feature"
 	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/revocation"
 	"github.com/macrat/lauth/secret"
+	"github.com/macrat/lauth/token"
+	"github.com/rs/zerolog/log"
 )
 
 type PostTokenRequest struct {
@@ -20,20 +29,95 @@ type PostTokenRequest struct {
 	ClientID     string `form:"client_id"     json:"client_id"     xml:"client_id"`
 	ClientSecret string `form:"client_secret" json:"client_secret" xml:"client_secret"`
 	RedirectURI  string `form:"redirect_uri"  json:"redirect_uri"  xml:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier" json:"code_verifier" xml:"code_verifier"`
+	Scope        string `form:"scope"         json:"scope"         xml:"scope"`
+
+	Username string `form:"username" json:"username" xml:"username"`
+	Password string `form:"password" json:"password" xml:"password"`
+
+	AuthReqID string `form:"auth_req_id" json:"auth_req_id" xml:"auth_req_id"`
+
+	// AuthMethod is the token_endpoint_auth_method that the client used, detected in Bind.
+	AuthMethod string `form:"-" json:"-" xml:"-"`
+}
+
+// bindJSON reads the JSON object body like a form.
+// Some client libraries send numbers or booleans as is, and scope as an array of strings, so these are converted to the same strings as a form.
+func (req *PostTokenRequest) bindJSON(body io.Reader) error {
+	var values map[string]interface{}
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("request body is not a valid JSON object: %s", err)
+	}
+
+	fields := map[string]*string{
+		"grant_type":    &req.GrantType,
+		"code":          &req.Code,
+		"refresh_token": &req.RefreshToken,
+		"client_id":     &req.ClientID,
+		"client_secret": &req.ClientSecret,
+		"redirect_uri":  &req.RedirectURI,
+		"code_verifier": &req.CodeVerifier,
+		"scope":         &req.Scope,
+		"username":      &req.Username,
+		"password":      &req.Password,
+		"auth_req_id":   &req.AuthReqID,
+	}
+	for key, value := range values {
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case nil:
+		case string:
+			*field = v
+		case json.Number:
+			*field = v.String()
+		case bool:
+			*field = strconv.FormatBool(v)
+		case []interface{}:
+			if key != "scope" {
+				return fmt.Errorf("%s must be a string", key)
+			}
+			ss := make([]string, len(v))
+			for i, x := range v {
+				s, ok := x.(string)
+				if !ok {
+					return fmt.Errorf("scope must be a string or an array of strings")
+				}
+				ss[i] = s
+			}
+			*field = strings.Join(ss, " ")
+		default:
+			return fmt.Errorf("%s must be a string", key)
+		}
+	}
+	return nil
 }
 
 func (req *PostTokenRequest) Bind(c *gin.Context) *errors.Error {
-	err := c.ShouldBind(req)
-	if err != nil {
+	if c.ContentType() == "application/json" {
+		if err := req.bindJSON(c.Request.Body); err != nil {
+			return &errors.Error{
+				Err:         err,
+				Reason:      errors.InvalidRequest,
+				Description: fmt.Sprintf("failed to parse request: %s", err),
+			}
+		}
+	} else if err := c.ShouldBind(req); err != nil {
 		return &errors.Error{
 			Err:         err,
 			Reason:      errors.InvalidRequest,
 			Description: "failed to parse request",
 		}
 	}
+	req.AuthMethod = config.TokenEndpointAuthClientSecretPost
 	if u, p, ok := c.Request.BasicAuth(); ok {
 		req.ClientID = u
 		req.ClientSecret = p
+		req.AuthMethod = config.TokenEndpointAuthClientSecretBasic
 	}
 	return nil
 }
@@ -66,30 +150,48 @@ func (req PostTokenRequest) Validate(conf *config.Config) *errors.Error {
 				Description: "can't set code when use refresh_token grant type",
 			}
 		}
+	case "client_credentials":
+		if req.Code != "" || req.RefreshToken != "" {
+			return &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "can't set code or refresh_token when use client_credentials grant type",
+			}
+		}
+	case "password":
+		if req.Username == "" || req.Password == "" {
+			return &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "username and password are required when use password grant type",
+			}
+		}
+		if req.Code != "" || req.RefreshToken != "" {
+			return &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "can't set code or refresh_token when use password grant type",
+			}
+		}
+	case config.GrantTypeCIBA:
+		if req.AuthReqID == "" {
+			return &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "auth_req_id is required when use " + config.GrantTypeCIBA + " grant type",
+			}
+		}
+		if req.Code != "" || req.RefreshToken != "" {
+			return &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "can't set code or refresh_token when use " + config.GrantTypeCIBA + " grant type",
+			}
+		}
 	default:
 		return &errors.Error{
 			Reason:      errors.UnsupportedGrantType,
-			Description: "supported grant_type is authorization_code or refresh_token",
+			Description: "supported grant_type is authorization_code, refresh_token, client_credentials, password, or " + config.GrantTypeCIBA,
 		}
 	}
 
-	if req.ClientID == "" {
-		return &errors.Error{
-			Reason:      errors.InvalidRequest,
-			Description: "client_id is required",
-		}
-	} else if req.ClientSecret == "" {
-		return &errors.Error{
-			Reason:      errors.InvalidRequest,
-			Description: "client_secret is required",
-		}
-	} else {
-		client, ok := conf.Clients[req.ClientID]
-		if !ok {
-			return &errors.Error{Reason: errors.InvalidClient}
-		} else if err := secret.Compare(client.Secret, req.ClientSecret); err != nil {
-			return &errors.Error{Err: err, Reason: errors.InvalidClient}
-		}
+	if err := authenticateClient(conf, req.ClientID, req.ClientSecret, req.AuthMethod); err != nil {
+		return err
 	}
 
 	if req.GrantType == "authorization_code" {
@@ -114,6 +216,35 @@ func (req PostTokenRequest) Validate(conf *config.Config) *errors.Error {
 	return nil
 }
 
+// authenticateClient checks the client_id and client_secret that sent to the token endpoint or the backchannel authentication endpoint.
+// The authMethod is the token_endpoint_auth_method that the client used, or empty to accept any method.
+func authenticateClient(conf *config.Config, clientID, clientSecret, authMethod string) *errors.Error {
+	if clientID == "" {
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "client_id is required",
+		}
+	} else if clientSecret == "" {
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "client_secret is required",
+		}
+	}
+
+	client, ok := conf.Clients[clientID]
+	if !ok {
+		return &errors.Error{Err: secret.CompareDummy(clientSecret), Reason: errors.InvalidClient}
+	} else if authMethod != "" && !client.AllowsTokenEndpointAuthMethod(authMethod) {
+		return &errors.Error{
+			Reason:      errors.InvalidClient,
+			Description: fmt.Sprintf("%s is not allowed for this client", authMethod),
+		}
+	} else if err := secret.Compare(client.Secret, clientSecret); err != nil {
+		return &errors.Error{Err: err, Reason: errors.InvalidClient}
+	}
+	return nil
+}
+
 func (req *PostTokenRequest) BindAndValidate(c *gin.Context, conf *config.Config) *errors.Error {
 	if err := req.Bind(c); err != nil {
 		return err
@@ -126,7 +257,7 @@ type PostTokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	IDToken      string `json:"id_token"`
 	ExpiresIn    int64  `json:"expires_in"`
-	Scope        string `json:"string"`
+	Scope        string `json:"scope"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
@@ -139,7 +270,7 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 		}
 	}
 	report.Set("username", code.Subject)
-	if err := code.Validate(api.Config.Issuer); err != nil {
+	if err := api.validateIssuers(code.Validate); err != nil {
 		return nil, &errors.Error{
 			Err:    err,
 			Reason: errors.InvalidGrant,
@@ -160,8 +291,30 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 		}
 	}
 
+	if code.CodeChallenge == "" && (api.Config.StrictOAuth21() || api.Config.Clients[code.ClientID].RequirePKCE) {
+		return nil, &errors.Error{
+			Reason:      errors.InvalidGrant,
+			Description: "code was issued without PKCE; code_challenge is required in the authorization request",
+		}
+	}
+	if err := code.VerifyCodeVerifier(req.CodeVerifier); err != nil {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidGrant,
+			Description: err.Error(),
+		}
+	}
+
 	scope := ParseStringSet(code.Scope)
 
+	if e := api.checkPolicy(c, code.Subject, code.ClientID, scope); e != nil {
+		return nil, e
+	}
+
+	if e := api.takeQuota(report, code.Subject, code.ClientID); e != nil {
+		return nil, e
+	}
+
 	accessToken, err := api.TokenManager.CreateAccessToken(
 		api.Config.Issuer,
 		code.Subject,
@@ -180,33 +333,19 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 
 	var idToken string
 	if scope.Has("openid") {
-		userinfo, errMsg := api.userinfo(code.Subject, scope)
-		if err != nil {
+		userinfo, errMsg := api.idTokenClaims(c, code.Subject, code.ClientID, scope)
+		if errMsg != nil {
 			return nil, errMsg
 		}
 
-		idToken, err = api.TokenManager.CreateIDToken(
-			api.Config.Issuer,
-			code.Subject,
-			code.ClientID,
-			code.Nonce,
-			req.Code,
-			accessToken,
-			userinfo,
-			time.Unix(code.AuthTime, 0),
-			api.Config.Expire.Token.Duration(),
-		)
-		if err != nil {
-			return nil, &errors.Error{
-				Err:         err,
-				Reason:      errors.ServerError,
-				Description: "failed to generate access_token",
-			}
+		idToken, errMsg = api.createIDToken(code.Subject, code.ClientID, code.Nonce, req.Code, accessToken, userinfo, time.Unix(code.AuthTime, 0))
+		if errMsg != nil {
+			return nil, errMsg
 		}
 	}
 
 	refreshToken := ""
-	if api.Config.Expire.Refresh > 0 {
+	if api.issuesRefreshToken(scope) {
 		refreshToken, err = api.TokenManager.CreateRefreshToken(
 			api.Config.Issuer,
 			code.Subject,
@@ -225,6 +364,8 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 		}
 	}
 
+	emitTokenIssued("authorization_code", code.ClientID, code.Subject, code.Scope, refreshToken != "")
+
 	return &PostTokenResponse{
 		TokenType:    "Bearer",
 		AccessToken:  accessToken,
@@ -244,7 +385,7 @@ func (api *LauthAPI) postTokenWithRefreshToken(c *gin.Context, req PostTokenRequ
 		}
 	}
 	report.Set("username", refreshToken.Subject)
-	if err := refreshToken.Validate(api.Config.Issuer); err != nil {
+	if err := api.validateIssuers(refreshToken.Validate); err != nil {
 		return nil, &errors.Error{
 			Err:    err,
 			Reason: errors.InvalidGrant,
@@ -257,12 +398,40 @@ func (api *LauthAPI) postTokenWithRefreshToken(c *gin.Context, req PostTokenRequ
 			Reason: errors.InvalidGrant,
 		}
 	}
+	api.recordKeyUsage(req.ClientID, req.RefreshToken)
+
+	if api.Config.StrictOAuth21() && refreshToken.Id == "" {
+		return nil, &errors.Error{
+			Reason:      errors.InvalidGrant,
+			Description: "refresh_token can't be rotated; please authorize again",
+		}
+	}
+	if api.Revocation.IsRevoked(refreshToken.Id) {
+		return nil, &errors.Error{
+			Err:         token.RevokedTokenError,
+			Reason:      errors.InvalidGrant,
+			Description: "refresh_token has already been used; OAuth 2.1 rotates refresh_token on each use",
+		}
+	}
+
+	scope, e := narrowScope(refreshToken.Scope, req.Scope)
+	if e != nil {
+		return nil, e
+	}
+
+	if e := api.checkPolicy(c, refreshToken.Subject, refreshToken.ClientID, scope); e != nil {
+		return nil, e
+	}
+
+	if e := api.takeQuota(report, refreshToken.Subject, refreshToken.ClientID); e != nil {
+		return nil, e
+	}
 
 	accessToken, err := api.TokenManager.CreateAccessToken(
 		api.Config.Issuer,
 		refreshToken.Subject,
 		refreshToken.ClientID,
-		refreshToken.Scope,
+		scope.String(),
 		time.Unix(refreshToken.AuthTime, 0),
 		api.Config.Expire.Token.Duration(),
 	)
@@ -274,49 +443,330 @@ func (api *LauthAPI) postTokenWithRefreshToken(c *gin.Context, req PostTokenRequ
 		}
 	}
 
-	scope := ParseStringSet(refreshToken.Scope)
 	var idToken string
 	if scope.Has("openid") {
-		userinfo, errMsg := api.userinfo(refreshToken.Subject, scope)
+		userinfo, errMsg := api.idTokenClaims(c, refreshToken.Subject, refreshToken.ClientID, scope)
+		if errMsg != nil {
+			return nil, errMsg
+		}
+
+		idToken, errMsg = api.createIDToken(refreshToken.Subject, refreshToken.ClientID, refreshToken.Nonce, "", accessToken, userinfo, time.Unix(refreshToken.AuthTime, 0))
+		if errMsg != nil {
+			return nil, errMsg
+		}
+	}
+
+	var newRefreshToken string
+	if api.Config.StrictOAuth21() {
+		// Consume the refresh_token after all checks passed, so the client can retry with the same token if the request is rejected.
+		// It is still before returning anything, so only one of concurrent requests with the same token can succeed.
+		if e := api.consumeRefreshToken(refreshToken); e != nil {
+			return nil, e
+		}
+
+		newRefreshToken, err = api.rotateRefreshToken(refreshToken)
 		if err != nil {
+			return nil, &errors.Error{
+				Err:         err,
+				Reason:      errors.ServerError,
+				Description: "failed to rotate refresh_token",
+			}
+		}
+	}
+
+	emitTokenIssued("refresh_token", refreshToken.ClientID, refreshToken.Subject, scope.String(), newRefreshToken != "")
+
+	return &PostTokenResponse{
+		TokenType:    "Bearer",
+		AccessToken:  accessToken,
+		IDToken:      idToken,
+		ExpiresIn:    api.Config.Expire.Token.IntSeconds(),
+		Scope:        scope.String(),
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
+func (api *LauthAPI) postTokenWithClientCredentials(c *gin.Context, req PostTokenRequest, report *metrics.Context) (*PostTokenResponse, *errors.Error) {
+	client := api.Config.Clients[req.ClientID]
+	if !client.AllowClientCredentials {
+		return nil, &errors.Error{
+			Reason:      errors.UnauthorizedClient,
+			Description: "client_credentials grant type is not allowed for this client",
+		}
+	}
+
+	allowed := ParseStringSet(strings.Join(client.ClientCredentialsScopes, " "))
+	scope := allowed
+	if req.Scope != "" {
+		scope = ParseStringSet(req.Scope)
+		for _, s := range scope.List() {
+			if !allowed.Has(s) {
+				return nil, &errors.Error{
+					Reason:      errors.InvalidScope,
+					Description: fmt.Sprintf("scope %#v is not allowed for this client", s),
+				}
+			}
+		}
+	}
+
+	if e := api.takeQuota(report, "", req.ClientID); e != nil {
+		return nil, e
+	}
+
+	accessToken, err := api.TokenManager.CreateClientAccessToken(
+		api.Config.Issuer,
+		req.ClientID,
+		scope.String(),
+		api.Config.Expire.Token.Duration(),
+	)
+	if err != nil {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to generate access_token",
+		}
+	}
+
+	emitTokenIssued("client_credentials", req.ClientID, "", scope.String(), false)
+
+	return &PostTokenResponse{
+		TokenType:   "Bearer",
+		AccessToken: accessToken,
+		ExpiresIn:   api.Config.Expire.Token.IntSeconds(),
+		Scope:       scope.String(),
+	}, nil
+}
+
+// postTokenWithPassword handles the Resource Owner Password Credentials grant.
+// The username and password are checked by the LDAP server directly, so it is allowed only for the clients that set allow_password_grant.
+func (api *LauthAPI) postTokenWithPassword(c *gin.Context, req PostTokenRequest, report *metrics.Context) (*PostTokenResponse, *errors.Error) {
+	if !api.Config.Clients[req.ClientID].AllowPasswordGrant {
+		return nil, &errors.Error{
+			Reason:      errors.UnauthorizedClient,
+			Description: "password grant type is not allowed for this client",
+		}
+	}
+
+	username := api.Config.Login.NormalizeUsername(req.Username)
+	report.Set("username", username)
+
+	known, unknown := api.Config.FilterScopes(ParseStringSet(req.Scope).List())
+	if len(unknown) > 0 && api.Config.ScopeRegistry.Unknown == config.UnknownScopeReject {
+		return nil, &errors.Error{
+			Reason:      errors.InvalidScope,
+			Description: fmt.Sprintf("unknown scope: %s", strings.Join(unknown, " ")),
+		}
+	}
+	scope := ParseStringSet(strings.Join(known, " "))
+
+	loginStart := time.Now()
+	loginFailed := func(err error) *errors.Error {
+		if latency := api.Config.Login.FailureLatency.Duration(); latency > 0 {
+			EqualizeDelay(loginStart, latency)
+		} else {
+			RandomDelay()
+		}
+		return &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidGrant,
+			Description: "invalid username or password",
+		}
+	}
+
+	if api.isLockedOut(username) {
+		return nil, loginFailed(nil)
+	}
+
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to connecting LDAP server")
+
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to connecting LDAP server",
+		}
+	}
+	defer conn.Close()
+
+	if err := conn.LoginTest(username, req.Password); err != nil {
+		api.recordLoginFailure(c, report, nil, username, err)
+		return nil, loginFailed(err)
+	}
+
+	decision, e := api.decidePolicy(c, username, req.ClientID, scope)
+	if e != nil {
+		return nil, e
+	}
+
+	if e := api.checkMFAWithoutPage(c, report, conn, username, req.ClientID, decision); e != nil {
+		return nil, e
+	}
+	api.resetLoginFailures(username)
+
+	if e := api.takeQuota(report, username, req.ClientID); e != nil {
+		return nil, e
+	}
+
+	authTime := api.TokenManager.Now()
+
+	accessToken, err := api.TokenManager.CreateAccessToken(
+		api.Config.Issuer,
+		username,
+		req.ClientID,
+		scope.String(),
+		authTime,
+		api.Config.Expire.Token.Duration(),
+	)
+	if err != nil {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to generate access_token",
+		}
+	}
+
+	var idToken string
+	if scope.Has("openid") {
+		userinfo, errMsg := api.idTokenClaims(c, username, req.ClientID, scope)
+		if errMsg != nil {
 			return nil, errMsg
 		}
 
-		idToken, err = api.TokenManager.CreateIDToken(
+		idToken, errMsg = api.createIDToken(username, req.ClientID, "", "", accessToken, userinfo, authTime)
+		if errMsg != nil {
+			return nil, errMsg
+		}
+	}
+
+	refreshToken := ""
+	if api.issuesRefreshToken(scope) {
+		refreshToken, err = api.TokenManager.CreateRefreshToken(
 			api.Config.Issuer,
-			refreshToken.Subject,
-			refreshToken.ClientID,
-			refreshToken.Nonce,
+			username,
+			req.ClientID,
+			scope.String(),
 			"",
-			accessToken,
-			userinfo,
-			time.Unix(refreshToken.AuthTime, 0),
-			api.Config.Expire.Token.Duration(),
+			authTime,
+			api.Config.Expire.Refresh.Duration(),
 		)
 		if err != nil {
 			return nil, &errors.Error{
 				Err:         err,
 				Reason:      errors.ServerError,
-				Description: "failed to generate access_token",
+				Description: "failed to generate refresh_token",
 			}
 		}
 	}
 
+	emitTokenIssued("password", req.ClientID, username, scope.String(), refreshToken != "")
+
 	return &PostTokenResponse{
-		TokenType:   "Bearer",
-		AccessToken: accessToken,
-		IDToken:     idToken,
-		ExpiresIn:   api.Config.Expire.Token.IntSeconds(),
-		Scope:       refreshToken.Scope,
+		TokenType:    "Bearer",
+		AccessToken:  accessToken,
+		IDToken:      idToken,
+		ExpiresIn:    api.Config.Expire.Token.IntSeconds(),
+		Scope:        scope.String(),
+		RefreshToken: refreshToken,
 	}, nil
 }
 
+// narrowScope parses the requested scope of refresh_token grant.
+// The requested scope has to be a subset of the granted scope, and empty means the same as granted.
+func narrowScope(granted, requested string) (*StringSet, *errors.Error) {
+	grantedSet := ParseStringSet(granted)
+	if requested == "" {
+		return grantedSet, nil
+	}
+
+	requestedSet := ParseStringSet(requested)
+	for _, s := range requestedSet.List() {
+		if !grantedSet.Has(s) {
+			return nil, &errors.Error{
+				Reason:      errors.InvalidScope,
+				Description: fmt.Sprintf("scope %#v is not granted by the refresh_token", s),
+			}
+		}
+	}
+	return requestedSet, nil
+}
+
+// issuesRefreshToken reports whether to issue a refresh token for the granted scope.
+func (api *LauthAPI) issuesRefreshToken(scope *StringSet) bool {
+	if api.Config.Expire.Refresh <= 0 || !api.Features.Enabled(feature.RefreshToken) {
+		return false
+	}
+	return !api.Config.RequireOfflineAccess || scope.Has("offline_access")
+}
+
+// consumeRefreshToken revokes the refresh_token for rotation.
+// It fails if the token is already used, even by a concurrent request.
+func (api *LauthAPI) consumeRefreshToken(old token.RefreshTokenClaims) *errors.Error {
+	if api.Revocation == nil {
+		return &errors.Error{
+			Err:         fmt.Errorf("revocation list is not configured"),
+			Reason:      errors.ServerError,
+			Description: "failed to rotate refresh_token",
+		}
+	}
+
+	err := api.Revocation.Revoke(old.Id, time.Unix(old.ExpiresAt, 0))
+	if err == revocation.AlreadyRevokedError {
+		return &errors.Error{
+			Err:         token.RevokedTokenError,
+			Reason:      errors.InvalidGrant,
+			Description: "refresh_token has already been used; OAuth 2.1 rotates refresh_token on each use",
+		}
+	} else if err != nil {
+		return &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to rotate refresh_token",
+		}
+	}
+
+	events.Emit(events.TypeRefreshTokenRevoked, map[string]string{
+		"jti":       old.Id,
+		"client_id": old.ClientID,
+		"username":  old.Subject,
+	})
+	return nil
+}
+
+// rotateRefreshToken issues the new refresh_token that expires at the same time as the consumed one.
+func (api *LauthAPI) rotateRefreshToken(old token.RefreshTokenClaims) (string, error) {
+	expiresAt := time.Unix(old.ExpiresAt, 0)
+
+	return api.TokenManager.CreateRefreshToken(
+		api.Config.Issuer,
+		old.Subject,
+		old.ClientID,
+		old.Scope,
+		old.Nonce,
+		time.Unix(old.AuthTime, 0),
+		expiresAt.Sub(api.TokenManager.Now()),
+	)
+}
+
+// warnOutdatedSecretHash warns once per client if the secret is hashed with other algorithm or parameters than --secret-hash.
+// The hash can't be upgraded automatically because it is in the config file, so it asks the administrator to regenerate it.
+func (api *LauthAPI) warnOutdatedSecretHash(clientID string) {
+	client, ok := api.Config.Clients[clientID]
+	if !ok || !api.Config.SecretHash.Params().NeedsRehash(client.Secret) {
+		return
+	}
+	if _, warned := api.rehashWarned.LoadOrStore(clientID, true); !warned {
+		log.Warn().Str("client_id", clientID).Msg("secret of the client is hashed with outdated parameters. please regenerate it by `lauth gen-client`")
+	}
+}
+
 func (api *LauthAPI) PostToken(c *gin.Context) {
 	report := metrics.StartToken(c)
 	defer report.Close()
 
-	c.Header("Cache-Control", "no-store")
-	c.Header("Pragma", "no-cache")
+	noStore(c)
 
 	var req PostTokenRequest
 	if err := (&req).BindAndValidate(c, api.Config); err != nil {
@@ -326,6 +776,19 @@ func (api *LauthAPI) PostToken(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err)
 		return
 	}
+	api.warnOutdatedSecretHash(req.ClientID)
+
+	if req.GrantType == "refresh_token" && !api.Features.Enabled(feature.RefreshToken) {
+		e := &errors.Error{
+			Reason:      errors.UnsupportedGrantType,
+			Description: "refresh_token grant type is disabled",
+		}
+		report.Set("grant_type", req.GrantType)
+		report.Set("client_id", req.ClientID)
+		report.SetError(e)
+		c.JSON(http.StatusBadRequest, e)
+		return
+	}
 
 	if getOriginHeader(c) != "" {
 		e := &errors.Error{
@@ -342,9 +805,16 @@ func (api *LauthAPI) PostToken(c *gin.Context) {
 
 	var resp *PostTokenResponse
 	var err *errors.Error
-	if req.GrantType == "authorization_code" {
+	switch req.GrantType {
+	case "authorization_code":
 		resp, err = api.postTokenWithCode(c, req, report)
-	} else {
+	case "client_credentials":
+		resp, err = api.postTokenWithClientCredentials(c, req, report)
+	case "password":
+		resp, err = api.postTokenWithPassword(c, req, report)
+	case config.GrantTypeCIBA:
+		resp, err = api.postTokenWithBackchannel(c, req, report)
+	default:
 		resp, err = api.postTokenWithRefreshToken(c, req, report)
 	}
 	if err != nil {
@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -30,7 +31,7 @@ func TestPostToken(t *testing.T) {
 			Code: http.StatusBadRequest,
 			Body: map[string]interface{}{
 				"error":             "unsupported_grant_type",
-				"error_description": "supported grant_type is authorization_code or refresh_token",
+				"error_description": "supported grant_type is authorization_code, refresh_token, client_credentials, password, or urn:openid:params:grant-type:ciba",
 			},
 		},
 	})
@@ -56,6 +57,11 @@ func ResponseValidation(env *testutil.APITestEnvironment, scope, codeHash string
 			t.Errorf("scope is expected %#v but got %#v", scope, resp.Scope)
 		}
 
+		var raw map[string]interface{}
+		if err := body.Bind(&raw); err != nil || raw["scope"] != scope {
+			t.Errorf("scope is expected as \"scope\" field but got %#v", raw)
+		}
+
 		accessToken, err := env.API.TokenManager.ParseAccessToken(resp.AccessToken)
 		if err != nil {
 			t.Errorf("failed to parse access token: %s", err)
@@ -582,6 +588,50 @@ func TestPostToken_RefreshToken(t *testing.T) {
 			Code:      http.StatusOK,
 			CheckBody: ResponseValidation(env, "profile", ""),
 		},
+		{
+			Name: "success / narrow scope",
+			Request: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {refreshToken},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"scope":         {"openid"},
+			},
+			Code:      http.StatusOK,
+			CheckBody: func(t *testing.T, body testutil.RawBody) {
+				var resp api.PostTokenResponse
+				if err := body.Bind(&resp); err != nil || resp.AccessToken == "" {
+					t.Errorf("expected access token but got %s", string(body))
+				}
+			},
+		},
+		{
+			Name: "success / narrow scope without openid",
+			Request: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {refreshToken},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"scope":         {"profile"},
+			},
+			Code:      http.StatusOK,
+			CheckBody: ResponseValidation(env, "profile", ""),
+		},
+		{
+			Name: "wider scope",
+			Request: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {refreshTokenWithoutOpenID},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"scope":         {"openid profile"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_scope",
+				"error_description": "scope \"openid\" is not granted by the refresh_token",
+			},
+		},
 	})
 }
 
@@ -630,6 +680,8 @@ func TestPostToken_CORS(t *testing.T) {
 	expected := map[string]string{
 		"error":             "access_denied",
 		"error_description": "Origin header was set. You can't use token endpoint via browser.",
+		"error_code":        "LA4001",
+		"error_uri":         env.API.Config.Issuer.String() + "/errors/LA4001",
 	}
 
 	var body map[string]string
@@ -639,3 +691,582 @@ func TestPostToken_CORS(t *testing.T) {
 		t.Errorf("unexpected response: %#v", string(resp.Body.Bytes()))
 	}
 }
+
+func TestPostToken_CodeExpired(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	clock := env.UseFakeClock(time.Now())
+
+	code, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid",
+		"",
+		clock.Now(),
+		env.API.Config.Expire.Code.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test code: %s", err)
+	}
+
+	clock.Advance(env.API.Config.Expire.Code.Duration() + time.Second)
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name: "expired code",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error": "invalid_grant",
+			},
+		},
+	})
+}
+
+func TestPostToken_GroupsOverage(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	tests := []struct {
+		Name    string
+		Limit   int
+		Groups  int
+		Overage bool
+	}{
+		{"no limit", 0, 2, false},
+		{"under limit", 2, 2, false},
+		{"over limit", 1, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			env.API.Config.IDToken.GroupsLimit = tt.Limit
+
+			code, err := env.API.TokenManager.CreateCode(
+				env.API.Config.Issuer,
+				"macrat",
+				"some_client_id",
+				"http://some-client.example.com/callback",
+				"openid groups",
+				"",
+				time.Now(),
+				env.API.Config.Expire.Code.Duration(),
+			)
+			if err != nil {
+				t.Fatalf("failed to generate test code: %s", err)
+			}
+
+			resp := env.Post("/token", "", url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			})
+			if resp.Code != http.StatusOK {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+
+			var body api.PostTokenResponse
+			if err := testutil.RawBody(resp.Body.Bytes()).Bind(&body); err != nil {
+				t.Fatalf("failed to unmarshal response body: %s", err)
+			}
+			idToken, err := env.API.TokenManager.ParseIDToken(body.IDToken)
+			if err != nil {
+				t.Fatalf("failed to parse id token: %s", err)
+			}
+
+			if groups, ok := idToken.ExtraClaims["groups"].([]interface{}); !ok || len(groups) != tt.Groups {
+				t.Errorf("expected %d groups but got %#v", tt.Groups, idToken.ExtraClaims["groups"])
+			}
+			if overage, _ := idToken.ExtraClaims["groups_overage"].(bool); overage != tt.Overage {
+				t.Errorf("expected groups_overage is %v but got %#v", tt.Overage, idToken.ExtraClaims["groups_overage"])
+			}
+			if _, ok := idToken.ExtraClaims["_claim_sources"]; ok != tt.Overage {
+				t.Errorf("unexpected _claim_sources: %#v", idToken.ExtraClaims["_claim_sources"])
+			}
+		})
+	}
+}
+
+func TestPostToken_IDTokenMaxSize(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	tests := []struct {
+		Name     string
+		MaxSize  int
+		Overflow string
+		Code     int
+		Groups   bool
+	}{
+		{"no limit", 0, config.IDTokenOverflowError, http.StatusOK, true},
+		{"under limit", 64 * 1024, config.IDTokenOverflowError, http.StatusOK, true},
+		{"userinfo", 100, config.IDTokenOverflowUserinfo, http.StatusOK, false},
+		{"warn", 100, config.IDTokenOverflowWarn, http.StatusOK, true},
+		{"error", 100, config.IDTokenOverflowError, http.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			env.API.Config.IDToken.MaxSize = tt.MaxSize
+			env.API.Config.IDToken.Overflow = tt.Overflow
+
+			code, err := env.API.TokenManager.CreateCode(
+				env.API.Config.Issuer,
+				"macrat",
+				"some_client_id",
+				"http://some-client.example.com/callback",
+				"openid groups",
+				"",
+				time.Now(),
+				env.API.Config.Expire.Code.Duration(),
+			)
+			if err != nil {
+				t.Fatalf("failed to generate test code: %s", err)
+			}
+
+			resp := env.Post("/token", "", url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			})
+			if resp.Code != tt.Code {
+				t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+			}
+			if resp.Code != http.StatusOK {
+				return
+			}
+
+			var body api.PostTokenResponse
+			if err := testutil.RawBody(resp.Body.Bytes()).Bind(&body); err != nil {
+				t.Fatalf("failed to unmarshal response body: %s", err)
+			}
+			idToken, err := env.API.TokenManager.ParseIDToken(body.IDToken)
+			if err != nil {
+				t.Fatalf("failed to parse id token: %s", err)
+			}
+
+			if _, ok := idToken.ExtraClaims["groups"]; ok != tt.Groups {
+				t.Errorf("unexpected groups: %#v", idToken.ExtraClaims["groups"])
+			}
+			if overage, _ := idToken.ExtraClaims["groups_overage"].(bool); overage == tt.Groups {
+				t.Errorf("unexpected groups_overage: %#v", idToken.ExtraClaims["groups_overage"])
+			}
+		})
+	}
+}
+
+func TestPostToken_AuthMethod(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.TokenEndpointAuthMethods = []string{config.TokenEndpointAuthClientSecretBasic}
+	env.API.Config.Clients["some_client_id"] = client
+
+	makeCode := func() string {
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			"",
+			time.Now(),
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+		return code
+	}
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name: "post is not allowed",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {makeCode()},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": "client_secret_post is not allowed for this client",
+			},
+		},
+		{
+			Name: "basic is allowed",
+			Request: url.Values{
+				"grant_type":   {"authorization_code"},
+				"code":         {makeCode()},
+				"redirect_uri": {"http://some-client.example.com/callback"},
+			},
+			Token:     "Basic c29tZV9jbGllbnRfaWQ6c2VjcmV0IGZvciBzb21lLWNsaWVudA==",
+			Code:      http.StatusOK,
+			CheckBody: func(t *testing.T, body testutil.RawBody) {
+				var resp api.PostTokenResponse
+				if err := body.Bind(&resp); err != nil || resp.AccessToken == "" {
+					t.Errorf("expected access token but got %s", string(body))
+				}
+			},
+		},
+	})
+}
+
+func TestPostToken_JSONBody(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	code, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid profile",
+		"",
+		time.Now(),
+		env.API.Config.Expire.Code.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test code: %s", err)
+	}
+
+	tests := []struct {
+		Name        string
+		ContentType string
+		Body        string
+		Code        int
+		Error       string
+		Description string
+	}{
+		{
+			Name:        "invalid JSON",
+			ContentType: "application/json",
+			Body:        `{"grant_type": `,
+			Code:        http.StatusBadRequest,
+			Error:       "invalid_request",
+			Description: "failed to parse request: request body is not a valid JSON object: unexpected EOF",
+		},
+		{
+			Name:        "not an object",
+			ContentType: "application/json",
+			Body:        `["authorization_code"]`,
+			Code:        http.StatusBadRequest,
+			Error:       "invalid_request",
+			Description: "failed to parse request: request body is not a valid JSON object: json: cannot unmarshal array into Go value of type map[string]interface {}",
+		},
+		{
+			Name:        "object as code",
+			ContentType: "application/json",
+			Body:        `{"grant_type": "authorization_code", "code": {}}`,
+			Code:        http.StatusBadRequest,
+			Error:       "invalid_request",
+			Description: "failed to parse request: code must be a string",
+		},
+		{
+			Name:        "number in scope",
+			ContentType: "application/json",
+			Body:        `{"grant_type": "refresh_token", "refresh_token": "x", "scope": ["openid", 1]}`,
+			Code:        http.StatusBadRequest,
+			Error:       "invalid_request",
+			Description: "failed to parse request: scope must be a string or an array of strings",
+		},
+		{
+			Name:        "success",
+			ContentType: "application/json; charset=utf-8",
+			Body: fmt.Sprintf(
+				`{"grant_type": "authorization_code", "code": %q, "client_id": "some_client_id", "client_secret": "secret for some-client", "redirect_uri": "http://some-client.example.com/callback", "unknown": 1}`,
+				code,
+			),
+			Code: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/token", strings.NewReader(tt.Body))
+			if err != nil {
+				t.Fatalf("failed to generate request: %s", err)
+			}
+			req.Header.Set("Content-Type", tt.ContentType)
+
+			resp := env.DoRequest(req)
+			if resp.Code != tt.Code {
+				t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+			}
+
+			var body map[string]interface{}
+			if err = json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse response body: %s", err)
+			}
+			if tt.Code == http.StatusOK {
+				if _, ok := body["access_token"]; !ok {
+					t.Errorf("access_token is not included: %s", resp.Body.String())
+				}
+				return
+			}
+			if body["error"] != tt.Error || body["error_description"] != tt.Description {
+				t.Errorf("unexpected response: %s", resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestPostToken_RequireOfflineAccess(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.RequireOfflineAccess = true
+
+	tests := []struct {
+		Scope   string
+		Refresh bool
+	}{
+		{"openid profile", false},
+		{"openid offline_access", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Scope, func(t *testing.T) {
+			code, err := env.API.TokenManager.CreateCode(
+				env.API.Config.Issuer,
+				"macrat",
+				"some_client_id",
+				"http://some-client.example.com/callback",
+				tt.Scope,
+				"",
+				time.Now(),
+				env.API.Config.Expire.Code.Duration(),
+			)
+			if err != nil {
+				t.Fatalf("failed to generate test code: %s", err)
+			}
+
+			resp := env.Post("/token", "", url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			})
+			if resp.Code != http.StatusOK {
+				t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+			}
+
+			var body api.PostTokenResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse response: %s", err)
+			}
+			if (body.RefreshToken != "") != tt.Refresh {
+				t.Errorf("expected refresh_token issued %v but got %#v", tt.Refresh, body.RefreshToken)
+			}
+			if body.Scope != tt.Scope {
+				t.Errorf("unexpected scope: %s", body.Scope)
+			}
+		})
+	}
+}
+
+func TestPostToken_ClientCredentials(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	request := func(scope string) url.Values {
+		v := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+		}
+		if scope != "" {
+			v.Set("scope", scope)
+		}
+		return v
+	}
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name:    "not allowed",
+			Request: request(""),
+			Code:    http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "unauthorized_client",
+				"error_description": "client_credentials grant type is not allowed for this client",
+			},
+		},
+	})
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowClientCredentials = true
+	client.ClientCredentialsScopes = []string{"api:read", "api:write"}
+	env.API.Config.Clients["some_client_id"] = client
+
+	checkToken := func(scope string) testutil.JSONTester {
+		return func(t *testing.T, body testutil.RawBody) {
+			var resp map[string]interface{}
+			if err := body.Bind(&resp); err != nil {
+				t.Fatalf("failed to unmarshal response body: %s", err)
+			}
+			if resp["scope"] != scope {
+				t.Errorf("expected scope %#v but got %#v", scope, resp["scope"])
+			}
+			if _, ok := resp["refresh_token"]; ok {
+				t.Errorf("refresh_token is issued by client_credentials grant")
+			}
+
+			accessToken, err := env.API.TokenManager.ParseAccessToken(resp["access_token"].(string))
+			if err != nil {
+				t.Fatalf("failed to parse access token: %s", err)
+			}
+			if err = accessToken.Validate(env.API.Config.Issuer); err != nil {
+				t.Errorf("failed to validate access token: %s", err)
+			}
+			if accessToken.Subject != "" {
+				t.Errorf("access token has subject: %#v", accessToken.Subject)
+			}
+			if !reflect.DeepEqual(accessToken.AuthorizedParties, []string{"some_client_id"}) {
+				t.Errorf("unexpected azp: %#v", accessToken.AuthorizedParties)
+			}
+
+			resp2 := env.Get("/userinfo", "Bearer "+resp["access_token"].(string), nil)
+			if resp2.Code != http.StatusForbidden {
+				t.Errorf("expected userinfo to reject the token but got %d", resp2.Code)
+			}
+		}
+	}
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name:      "all allowed scopes",
+			Request:   request(""),
+			Code:      http.StatusOK,
+			CheckBody: checkToken("api:read api:write"),
+		},
+		{
+			Name:      "narrowed scope",
+			Request:   request("api:read"),
+			Code:      http.StatusOK,
+			CheckBody: checkToken("api:read"),
+		},
+		{
+			Name:    "not allowed scope",
+			Request: request("api:read openid"),
+			Code:    http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_scope",
+				"error_description": "scope \"openid\" is not allowed for this client",
+			},
+		},
+		{
+			Name: "wrong secret",
+			Request: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"wrong"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error": "invalid_client",
+			},
+		},
+	})
+
+	if c := env.API.Config.OpenIDConfiguration(); c.GrantTypesSupported[len(c.GrantTypesSupported)-1] != "client_credentials" {
+		t.Errorf("client_credentials is not advertised: %#v", c.GrantTypesSupported)
+	}
+}
+
+func TestPostToken_Password(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	request := func(username, password, scope string) url.Values {
+		return url.Values{
+			"grant_type":    {"password"},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"username":      {username},
+			"password":      {password},
+			"scope":         {scope},
+		}
+	}
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name:    "not allowed",
+			Request: request("macrat", "foobar", "openid"),
+			Code:    http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "unauthorized_client",
+				"error_description": "password grant type is not allowed for this client",
+			},
+		},
+	})
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowPasswordGrant = true
+	env.API.Config.Clients["some_client_id"] = client
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name:    "missing password",
+			Request: request("macrat", "", "openid"),
+			Code:    http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_request",
+				"error_description": "username and password are required when use password grant type",
+			},
+		},
+		{
+			Name:    "wrong password",
+			Request: request("macrat", "wrong", "openid"),
+			Code:    http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_grant",
+				"error_description": "invalid username or password",
+			},
+		},
+		{
+			Name:    "success",
+			Request: request("macrat", "foobar", "openid profile"),
+			Code:    http.StatusOK,
+			CheckBody: func(t *testing.T, body testutil.RawBody) {
+				var resp map[string]interface{}
+				if err := body.Bind(&resp); err != nil {
+					t.Fatalf("failed to unmarshal response body: %s", err)
+				}
+				if resp["scope"] != "openid profile" {
+					t.Errorf("unexpected scope: %#v", resp["scope"])
+				}
+
+				accessToken, err := env.API.TokenManager.ParseAccessToken(resp["access_token"].(string))
+				if err != nil {
+					t.Fatalf("failed to parse access token: %s", err)
+				}
+				if accessToken.Subject != "macrat" {
+					t.Errorf("unexpected subject: %#v", accessToken.Subject)
+				}
+
+				idToken, err := env.API.TokenManager.ParseIDToken(resp["id_token"].(string))
+				if err != nil {
+					t.Fatalf("failed to parse id token: %s", err)
+				}
+				if idToken.Subject != "macrat" || idToken.Audience != "some_client_id" {
+					t.Errorf("unexpected id token: %#v", idToken)
+				}
+
+				if _, err := env.API.TokenManager.ParseRefreshToken(resp["refresh_token"].(string)); err != nil {
+					t.Errorf("failed to parse refresh token: %s", err)
+				}
+			},
+		},
+	})
+
+	if c := env.API.Config.OpenIDConfiguration(); c.GrantTypesSupported[len(c.GrantTypesSupported)-1] != "password" {
+		t.Errorf("password is not advertised: %#v", c.GrantTypesSupported)
+	}
+}
@@ -46,8 +46,7 @@ func (api *LauthAPI) PostUserInfo(c *gin.Context) {
 	report := metrics.StartUserinfo(c)
 	defer report.Close()
 
-	c.Header("Cache-Control", "no-store")
-	c.Header("Pragma", "no-cache")
+	noStore(c)
 
 	var req PostUserInfoRequest
 	if e := (&req).Bind(c); e != nil {
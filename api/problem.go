@@ -0,0 +1,17 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+)
+
+// sendAdminError responds an error of the admin API or /readyz, in the format of --admin-error-format.
+func (api *LauthAPI) sendAdminError(c *gin.Context, status int, e *errors.Error) {
+	if api.Config.Admin.ErrorFormat == config.ErrorFormatProblem {
+		errors.SendProblem(c, status, e, metrics.TraceID(c))
+	} else {
+		c.JSON(status, e)
+	}
+}
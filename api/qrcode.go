@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/feature"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/qrcode"
+)
+
+const (
+	// QRCodeScale is the pixels per module of PNG QR code.
+	QRCodeScale = 8
+)
+
+// qrcodeData gets data to encode from the query, and checks it is an URL under the issuer.
+// The QR code endpoint only serves links to this server, so it can't be used as a general QR code generator.
+// Secrets like otpauth:// URIs should be rendered in the page with the qrcode template function, instead of this endpoint.
+func (api *LauthAPI) qrcodeData(c *gin.Context) (*qrcode.QRCode, *errors.Error) {
+	if !api.Features.Enabled(feature.QRCode) {
+		return nil, &errors.Error{
+			Reason:      errors.PageNotFound,
+			Description: "QR code endpoint is disabled",
+		}
+	}
+
+	data := c.Query("data")
+	if data == "" {
+		return nil, &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "data is required",
+		}
+	}
+
+	u, err := url.Parse(data)
+	issuer := api.Config.Issuer
+	if err != nil || u.Scheme != issuer.Scheme || u.Host != issuer.Host || !strings.HasPrefix(u.Path, issuer.Path) {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidRequest,
+			Description: "data must be an URL under the issuer",
+		}
+	}
+
+	q, err := qrcode.Encode([]byte(data))
+	if err != nil {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidRequest,
+			Description: "data is too long",
+		}
+	}
+
+	return q, nil
+}
+
+func (api *LauthAPI) GetQRCodePNG(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	q, e := api.qrcodeData(c)
+	if e != nil {
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	img, err := q.PNG(QRCodeScale)
+	if err != nil {
+		e := &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to generate QR code",
+		}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/png", img)
+}
+
+func (api *LauthAPI) GetQRCodeSVG(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	q, e := api.qrcodeData(c)
+	if e != nil {
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/svg+xml", []byte(q.SVG()))
+}
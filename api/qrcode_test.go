@@ -0,0 +1,52 @@
+package api_test
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestGetQRCode(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	issuer := env.API.Config.Issuer.String()
+
+	tests := []struct {
+		Name        string
+		Path        string
+		Data        string
+		Code        int
+		ContentType string
+	}{
+		{"png", "/qrcode.png", issuer + "/device?user_code=ABCD-EFGH", http.StatusOK, "image/png"},
+		{"svg", "/qrcode.svg", issuer + "/device", http.StatusOK, "image/svg+xml"},
+		{"missing data", "/qrcode.png", "", http.StatusBadRequest, "application/json; charset=utf-8"},
+		{"another host", "/qrcode.svg", "http://evil.example.com/", http.StatusBadRequest, "application/json; charset=utf-8"},
+		{"otpauth", "/qrcode.png", "otpauth://totp/lauth:macrat?secret=JBSWY3DPEHPK3PXP", http.StatusBadRequest, "application/json; charset=utf-8"},
+		{"too long", "/qrcode.png", issuer + "/" + strings.Repeat("a", 500), http.StatusBadRequest, "application/json; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			resp := env.Get(tt.Path, "", url.Values{"data": {tt.Data}})
+
+			if resp.Code != tt.Code {
+				t.Fatalf("expected status code %d but got %d: %s", tt.Code, resp.Code, resp.Body.String())
+			}
+			if ct := resp.Header().Get("Content-Type"); ct != tt.ContentType {
+				t.Errorf("expected content type %#v but got %#v", tt.ContentType, ct)
+			}
+
+			if tt.ContentType == "image/png" {
+				if _, err := png.Decode(bytes.NewReader(resp.Body.Bytes())); err != nil {
+					t.Errorf("failed to decode PNG: %s", err)
+				}
+			}
+		})
+	}
+}
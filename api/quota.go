@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/lockout"
+	"github.com/macrat/lauth/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+type quota struct {
+	Name   string
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// quotas returns the token issuance quotas that apply to the subject and the client.
+// The subject is empty for client_credentials grant, so only the quota of the client applies to it.
+func (api *LauthAPI) quotas(subject, clientID string) []quota {
+	var qs []quota
+	if limit := api.Config.Limits.TokensPerSubject; limit > 0 && subject != "" {
+		qs = append(qs, quota{"subject", "subject:" + subject, limit, time.Hour})
+	}
+	if limit := api.Config.Limits.TokensPerClient; limit > 0 {
+		qs = append(qs, quota{"client", "client:" + clientID, limit, time.Minute})
+	}
+	return qs
+}
+
+// takeQuota counts a token issuance, or rejects it if --tokens-per-subject or --tokens-per-client is exceeded.
+func (api *LauthAPI) takeQuota(report *metrics.Context, subject, clientID string) *errors.Error {
+	if api.Quota == nil {
+		return nil
+	}
+
+	now := time.Now()
+	qs := api.quotas(subject, clientID)
+
+	limits := make([]lockout.Limit, len(qs))
+	for i, q := range qs {
+		limits[i] = lockout.Limit{Key: q.Key, Since: now.Add(-q.Window), Max: q.Limit}
+	}
+
+	i, err := api.Quota.Take(now, limits...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to record token quota")
+		return nil
+	}
+	if i >= 0 {
+		q := qs[i]
+		metrics.QuotaExceeded.Inc(q.Name)
+		report.SetField("quota_exceeded", q.Name)
+		return &errors.Error{
+			Reason:      errors.AccessDenied,
+			Code:        errors.QuotaExceeded,
+			Description: fmt.Sprintf("too many tokens are issued to the %s, please retry later", q.Name),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/lockout"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestQuota_Client(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Limits.TokensPerClient = 2
+	env.API.Quota = lockout.NewCounter()
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowClientCredentials = true
+	client.ClientCredentialsScopes = []string{"api:read"}
+	env.API.Config.Clients["some_client_id"] = client
+
+	request := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := env.Post("/token", "", request); resp.Code != http.StatusOK {
+			t.Fatalf("%d: unexpected status code: %d: %s", i, resp.Code, resp.Body.String())
+		}
+	}
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name:    "exceeded",
+			Request: request,
+			Code:    http.StatusTooManyRequests,
+			Body: map[string]interface{}{
+				"error":             "access_denied",
+				"error_description": "too many tokens are issued to the client, please retry later",
+				"error_code":        "LA4005",
+				"error_uri":         env.API.Config.Issuer.String() + "/errors/LA4005",
+			},
+		},
+	})
+}
+
+func TestQuota_Subject(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Limits.TokensPerSubject = 1
+	env.API.Quota = lockout.NewCounter()
+
+	exchange := func(subject string) int {
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			subject,
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			"",
+			time.Now(),
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+
+		return env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		}).Code
+	}
+
+	if code := exchange("macrat"); code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", code)
+	}
+	if code := exchange("macrat"); code != http.StatusTooManyRequests {
+		t.Errorf("expected quota exceeded but got status code %d", code)
+	}
+	if code := exchange("j.smith"); code != http.StatusOK {
+		t.Errorf("another user should not be limited: status code %d", code)
+	}
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"implicit_client_id"},
+		token.Consents{"implicit_client_id": token.ConsentAnyScope},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+	authzRequest := url.Values{
+		"response_type": {"token"},
+		"client_id":     {"implicit_client_id"},
+		"redirect_uri":  {"http://implicit-client.example.com/callback"},
+		"scope":         {"openid"},
+		"prompt":        {"none"},
+	}
+	resp := sessionRequest(t, env, "GET", "/authz?"+authzRequest.Encode(), ssoToken, "")
+	if resp.Code != http.StatusFound {
+		t.Fatalf("unexpected status code of authz: %d", resp.Code)
+	}
+	loc, _ := url.Parse(resp.Header().Get("Location"))
+	fragment, _ := url.ParseQuery(loc.Fragment)
+	if fragment.Get("error") != "access_denied" || !strings.Contains(fragment.Get("error_uri"), "LA4005") {
+		t.Errorf("expected quota exceeded on authz but got %s", loc)
+	}
+}
@@ -10,3 +10,13 @@ func RandomDelay() {
 	rand.Read(b)
 	time.Sleep(time.Duration(500+float64(b[0])*500/255) * time.Millisecond)
 }
+
+// EqualizeDelay sleeps until the latency passed since the start, with random jitter up to 10% of the latency.
+// It makes the response time the same whether the user exists or not, so attacker can't guess users by timing.
+func EqualizeDelay(start time.Time, latency time.Duration) {
+	b := make([]byte, 1)
+	rand.Read(b)
+	jitter := time.Duration(float64(latency) * 0.1 * float64(b[0]) / 255)
+
+	time.Sleep(time.Until(start.Add(latency + jitter)))
+}
@@ -0,0 +1,25 @@
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+)
+
+func TestEqualizeDelay(t *testing.T) {
+	latency := 50 * time.Millisecond
+
+	start := time.Now()
+	api.EqualizeDelay(start, latency)
+	if d := time.Since(start); d < latency || d > latency*2 {
+		t.Errorf("expected delay about %s but got %s", latency, d)
+	}
+
+	start = time.Now().Add(-latency * 2)
+	before := time.Now()
+	api.EqualizeDelay(start, latency)
+	if d := time.Since(before); d > latency/2 {
+		t.Errorf("expected no delay when latency already passed but got %s", d)
+	}
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/token"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MinPasswordLength = 8
+)
+
+var (
+	usernameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+)
+
+type RegisterRequest struct {
+	Continue   string `form:"continue"    json:"continue"    xml:"continue"`
+	Username   string `form:"username"    json:"username"    xml:"username"`
+	Email      string `form:"email"       json:"email"       xml:"email"`
+	GivenName  string `form:"given_name"  json:"given_name"  xml:"given_name"`
+	FamilyName string `form:"family_name" json:"family_name" xml:"family_name"`
+
+	Token           string `form:"token"            json:"token"            xml:"token"`
+	Password        string `form:"password"         json:"password"         xml:"password"`
+	PasswordConfirm string `form:"password_confirm" json:"password_confirm" xml:"password_confirm"`
+}
+
+// validateContinue checks the URL to back after registration is the authorization endpoint of this server.
+func (api *LauthAPI) validateContinue(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path != api.Config.EndpointPaths().Authz {
+		return ""
+	}
+	return u.String()
+}
+
+// redirectToRegister sends user to the registration page if requested prompt=create.
+func (api *LauthAPI) redirectToRegister(c *gin.Context) bool {
+	if !api.Config.Register.Enable {
+		return false
+	}
+
+	query := c.Request.URL.Query()
+	prompt := ParseStringSet(query.Get("prompt"))
+	if !prompt.Has("create") {
+		return false
+	}
+
+	var rest []string
+	for _, p := range prompt.List() {
+		if p != "create" {
+			rest = append(rest, p)
+		}
+	}
+	if len(rest) > 0 {
+		query.Set("prompt", strings.Join(rest, " "))
+	} else {
+		query.Del("prompt")
+	}
+
+	endpoints := api.Config.EndpointPaths()
+	continueURL := endpoints.Authz + "?" + query.Encode()
+	c.Redirect(http.StatusFound, endpoints.Register+"?"+url.Values{"continue": {continueURL}}.Encode())
+	return true
+}
+
+func (api *LauthAPI) registrationDisabled(c *gin.Context, report *metrics.Context) bool {
+	if api.Config.Register.Enable {
+		return false
+	}
+
+	e := &errors.Error{
+		Reason:      errors.PageNotFound,
+		Description: "registration is disabled",
+	}
+	report.SetError(e)
+	errors.SendHTML(c, e)
+	return true
+}
+
+func (api *LauthAPI) GetRegister(c *gin.Context) {
+	report := metrics.StartRegister(c)
+	defer report.Close()
+
+	noStore(c)
+
+	if api.registrationDisabled(c, report) {
+		return
+	}
+
+	var req RegisterRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "failed to parse request"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	if req.Token == "" {
+		report.Set("step", "profile")
+		report.Continue()
+		c.HTML(http.StatusOK, "register.tmpl", pageData(c, gin.H{
+			"step":     "profile",
+			"continue": api.validateContinue(req.Continue),
+		}))
+		return
+	}
+
+	report.Set("step", "verify")
+
+	claims, e := api.parseRegistrationToken(req.Token)
+	if e != nil {
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	report.Set("username", claims.Subject)
+
+	report.Continue()
+	c.HTML(http.StatusOK, "register.tmpl", pageDataWithExpiry(c, gin.H{
+		"step":     "password",
+		"token":    req.Token,
+		"username": claims.Subject,
+	}, api.TokenManager.Now(), time.Unix(claims.ExpiresAt, 0)))
+}
+
+func (api *LauthAPI) PostRegister(c *gin.Context) {
+	report := metrics.StartRegister(c)
+	defer report.Close()
+
+	noStore(c)
+
+	if api.registrationDisabled(c, report) {
+		return
+	}
+
+	var req RegisterRequest
+	if err := c.ShouldBind(&req); err != nil {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "failed to parse request"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	if req.Token == "" {
+		api.postRegisterProfile(c, report, req)
+	} else {
+		api.postRegisterPassword(c, report, req)
+	}
+}
+
+func (api *LauthAPI) postRegisterProfile(c *gin.Context, report *metrics.Context, req RegisterRequest) {
+	report.Set("step", "profile")
+	report.Set("username", req.Username)
+
+	req.Continue = api.validateContinue(req.Continue)
+
+	showForm := func(description string) {
+		report.UserError()
+		c.HTML(http.StatusBadRequest, "register.tmpl", pageData(c, gin.H{
+			"step":        "profile",
+			"continue":    req.Continue,
+			"error":       description,
+			"username":    req.Username,
+			"email":       req.Email,
+			"given_name":  req.GivenName,
+			"family_name": req.FamilyName,
+		}))
+	}
+
+	req.GivenName = strings.TrimSpace(req.GivenName)
+	req.FamilyName = strings.TrimSpace(req.FamilyName)
+
+	if !usernameRe.MatchString(req.Username) {
+		showForm("Username can contain only alphabets, numbers, '.', '_', and '-'.")
+		return
+	}
+	if addr, err := netmail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		showForm("Invalid email address.")
+		return
+	}
+	if req.GivenName == "" || req.FamilyName == "" {
+		showForm("Given name and family name are required.")
+		return
+	}
+
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to connecting LDAP server")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to connecting LDAP server"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.GetUserAttributes(req.Username, []string{})
+	if err == nil {
+		showForm("The username is already taken.")
+		return
+	} else if err != ldap.UserNotFoundError {
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to get user information"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	regToken, err := api.TokenManager.CreateRegistrationToken(
+		api.Config.Issuer,
+		req.Username,
+		req.Email,
+		req.GivenName,
+		req.FamilyName,
+		req.Continue,
+		api.Config.Expire.Login.Duration(),
+	)
+	if err != nil {
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to create verification link"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	link := *api.Config.Issuer.URL()
+	link.Path = api.Config.EndpointPaths().Register
+	link.RawQuery = url.Values{"token": {regToken}}.Encode()
+	body := fmt.Sprintf("Hello %s,\n\nPlease open the link below to verify your email address and set your password.\n\n%s\n\nThis link expires in %s.\nIf you didn't request this, please ignore this email.\n", req.GivenName, link.String(), api.Config.Expire.Login)
+
+	if api.Mailer == nil {
+		e := &errors.Error{Reason: errors.ServerError, Description: "email sender is not configured"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	if err := api.Mailer.Send(req.Email, "Verify your email address", body); err != nil {
+		log.Error().Err(err).Msg("failed to send verification email")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to send verification email"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	report.Continue()
+	c.HTML(http.StatusOK, "register.tmpl", pageData(c, gin.H{
+		"step": "sent",
+	}))
+}
+
+func (api *LauthAPI) postRegisterPassword(c *gin.Context, report *metrics.Context, req RegisterRequest) {
+	report.Set("step", "password")
+
+	claims, e := api.parseRegistrationToken(req.Token)
+	if e != nil {
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	report.Set("username", claims.Subject)
+
+	showForm := func(description string) {
+		report.UserError()
+		c.HTML(http.StatusBadRequest, "register.tmpl", pageDataWithExpiry(c, gin.H{
+			"step":     "password",
+			"token":    req.Token,
+			"username": claims.Subject,
+			"error":    description,
+		}, api.TokenManager.Now(), time.Unix(claims.ExpiresAt, 0)))
+	}
+
+	if len(req.Password) < MinPasswordLength {
+		showForm(fmt.Sprintf("Password must be at least %d characters.", MinPasswordLength))
+		return
+	}
+	if req.Password != req.PasswordConfirm {
+		showForm("Passwords don't match.")
+		return
+	}
+
+	attributes, err := api.registrationAttributes(claims.Subject, claims.Email, claims.GivenName, claims.FamilyName)
+	if err != nil {
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to make user attributes"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to connecting LDAP server")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to connecting LDAP server"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+	defer conn.Close()
+
+	registrar, ok := conn.(ldap.Registrar)
+	if !ok {
+		e := &errors.Error{Reason: errors.ServerError, Description: "LDAP connector doesn't support registration"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	if err := registrar.CreateUser(api.Config.Register.BaseDN, claims.Subject, req.Password, attributes); err == ldap.UserAlreadyExistsError {
+		e := &errors.Error{Err: err, Reason: errors.InvalidRequest, Description: "the account is already created"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("failed to create user")
+		e := &errors.Error{Err: err, Reason: errors.ServerError, Description: "failed to create user"}
+		report.SetError(e)
+		errors.SendHTML(c, e)
+		return
+	}
+
+	if group := api.Config.Register.Group; group != "" {
+		if err := registrar.AddGroupMember(group, api.Config.Register.GroupAttribute, claims.Subject); err != nil {
+			log.Error().Err(err).Str("group", group).Msg("failed to add user into initial group")
+		}
+	}
+
+	report.Success()
+
+	if claims.Continue != "" {
+		c.Redirect(http.StatusFound, claims.Continue)
+		return
+	}
+	c.HTML(http.StatusOK, "register.tmpl", pageData(c, gin.H{
+		"step":     "done",
+		"username": claims.Subject,
+	}))
+}
+
+func (api *LauthAPI) parseRegistrationToken(raw string) (claims token.RegistrationClaims, e *errors.Error) {
+	claims, err := api.TokenManager.ParseRegistrationToken(raw)
+	if err == nil {
+		err = api.validateIssuers(claims.Validate)
+	}
+	if err != nil {
+		return claims, &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidRequest,
+			Description: "verification link is invalid or expired",
+		}
+	}
+	return claims, nil
+}
+
+// registrationAttributes makes LDAP attributes of the new user from the template in the config.
+func (api *LauthAPI) registrationAttributes(username, email, givenName, familyName string) (map[string][]string, error) {
+	data := map[string]string{
+		"Username":   username,
+		"Email":      email,
+		"GivenName":  givenName,
+		"FamilyName": familyName,
+	}
+
+	result := make(map[string][]string)
+	for name, values := range api.Config.Register.Attributes {
+		for _, v := range values {
+			tmpl, err := template.New(name).Parse(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			var buf strings.Builder
+			if err := tmpl.Execute(&buf, data); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if s := strings.TrimSpace(buf.String()); s != "" {
+				result[name] = append(result[name], s)
+			}
+		}
+	}
+	return result, nil
+}
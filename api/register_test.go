@@ -0,0 +1,183 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+)
+
+type DummyMail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type DummyMailer struct {
+	Sent []DummyMail
+}
+
+func (m *DummyMailer) Send(to, subject, body string) error {
+	m.Sent = append(m.Sent, DummyMail{to, subject, body})
+	return nil
+}
+
+func TestRegister_Disabled(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	if resp := env.Get("/register", "", nil); resp.Code != http.StatusNotFound {
+		t.Errorf("expected 404 if registration is disabled but got %d", resp.Code)
+	}
+
+	resp := env.Get("/authz", "", url.Values{
+		"response_type": {"code"},
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid"},
+		"prompt":        {"create"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected login page if registration is disabled but got %d", resp.Code)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	dummyLDAP := testutil.LDAP.Copy()
+	mailer := &DummyMailer{}
+
+	env.API.Connector = dummyLDAP
+	env.API.Mailer = mailer
+	env.API.Config.Register = config.RegistrationConfig{
+		Enable:         true,
+		BaseDN:         "ou=people,dc=example,dc=com",
+		Group:          "cn=users,ou=groups,dc=example,dc=com",
+		GroupAttribute: "member",
+		Attributes:     config.DefaultRegistrationAttributes,
+	}
+
+	resp := env.Get("/authz", "", url.Values{
+		"response_type": {"code"},
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid"},
+		"prompt":        {"create consent"},
+	})
+	if resp.Code != http.StatusFound {
+		t.Fatalf("expected redirect to registration page but got %d", resp.Code)
+	}
+	loc, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse location: %s", err)
+	}
+	if loc.Path != "/register" {
+		t.Fatalf("unexpected redirect: %s", loc)
+	}
+	continueURL := loc.Query().Get("continue")
+	if cont, err := url.Parse(continueURL); err != nil || cont.Path != "/authz" || cont.Query().Get("prompt") != "consent" {
+		t.Fatalf("unexpected continue URL: %s", continueURL)
+	}
+
+	resp = env.Get("/register", "", url.Values{"continue": {continueURL}})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to get registration page: %d", resp.Code)
+	}
+
+	profileTests := []struct {
+		Name    string
+		Request url.Values
+		Message string
+	}{
+		{"invalid username", url.Values{"username": {"(invalid)"}, "email": {"new@example.com"}, "given_name": {"new"}, "family_name": {"user"}}, "Username can contain only"},
+		{"invalid email", url.Values{"username": {"newuser"}, "email": {"Someone <new@example.com>"}, "given_name": {"new"}, "family_name": {"user"}}, "Invalid email address."},
+		{"missing name", url.Values{"username": {"newuser"}, "email": {"new@example.com"}, "given_name": {""}, "family_name": {"user"}}, "Given name and family name are required."},
+		{"already taken", url.Values{"username": {"macrat"}, "email": {"new@example.com"}, "given_name": {"new"}, "family_name": {"user"}}, "The username is already taken."},
+	}
+	for _, tt := range profileTests {
+		resp := env.Post("/register", "", tt.Request)
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 but got %d", tt.Name, resp.Code)
+		}
+		if !strings.Contains(resp.Body.String(), tt.Message) {
+			t.Errorf("%s: expected message %#v was not contained", tt.Name, tt.Message)
+		}
+	}
+	if len(mailer.Sent) != 0 {
+		t.Fatalf("email must not be sent for invalid requests")
+	}
+
+	resp = env.Post("/register", "", url.Values{
+		"continue":    {continueURL},
+		"username":    {"newuser"},
+		"email":       {"new@example.com"},
+		"given_name":  {"new"},
+		"family_name": {"user"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to post profile: %d\n%s", resp.Code, resp.Body)
+	}
+	if len(mailer.Sent) != 1 || mailer.Sent[0].To != "new@example.com" {
+		t.Fatalf("unexpected emails: %#v", mailer.Sent)
+	}
+
+	link := regexp.MustCompile(`http://\S+`).FindString(mailer.Sent[0].Body)
+	linkURL, err := url.Parse(link)
+	if err != nil || linkURL.Path != "/register" {
+		t.Fatalf("unexpected verification link: %#v", link)
+	}
+	regToken := linkURL.Query().Get("token")
+
+	resp = env.Get("/register", "", url.Values{"token": {"invalid"}})
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid token but got %d", resp.Code)
+	}
+
+	resp = env.Get("/register", "", url.Values{"token": {regToken}})
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "newuser") {
+		t.Fatalf("failed to show password form: %d", resp.Code)
+	}
+
+	resp = env.Post("/register", "", url.Values{"token": {regToken}, "password": {"short"}, "password_confirm": {"short"}})
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for short password but got %d", resp.Code)
+	}
+	resp = env.Post("/register", "", url.Values{"token": {regToken}, "password": {"new password"}, "password_confirm": {"another"}})
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for mismatched password but got %d", resp.Code)
+	}
+
+	resp = env.Post("/register", "", url.Values{"token": {regToken}, "password": {"new password"}, "password_confirm": {"new password"}})
+	if resp.Code != http.StatusFound {
+		t.Fatalf("failed to create account: %d\n%s", resp.Code, resp.Body)
+	}
+	if resp.Header().Get("Location") != continueURL {
+		t.Errorf("unexpected redirect after registration: %s", resp.Header().Get("Location"))
+	}
+
+	user, ok := dummyLDAP["newuser"]
+	if !ok {
+		t.Fatalf("user was not created")
+	}
+	if user.Password != "new password" {
+		t.Errorf("unexpected password: %#v", user.Password)
+	}
+	if cn := user.Attributes["cn"]; len(cn) != 1 || cn[0] != "new user" {
+		t.Errorf("unexpected cn: %#v", cn)
+	}
+	if mail := user.Attributes["mail"]; len(mail) != 1 || mail[0] != "new@example.com" {
+		t.Errorf("unexpected mail: %#v", mail)
+	}
+	if groups := user.Attributes["memberOf"]; len(groups) != 1 || groups[0] != "cn=users,ou=groups,dc=example,dc=com" {
+		t.Errorf("unexpected groups: %#v", groups)
+	}
+
+	resp = env.Post("/register", "", url.Values{"token": {regToken}, "password": {"new password"}, "password_confirm": {"new password"}})
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for reused link but got %d", resp.Code)
+	}
+}
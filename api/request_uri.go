@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRequestURICacheEntries = 1024
+
+type requestURICacheEntry struct {
+	Object    string
+	ExpiresAt time.Time
+}
+
+// requestURICache keeps request objects that fetched from request_uri, for --request-uri-cache.
+type requestURICache struct {
+	sync.Mutex
+
+	entries map[string]requestURICacheEntry
+}
+
+func (c *requestURICache) Get(uri string, now time.Time) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[uri]
+	if !ok {
+		return "", false
+	}
+	if !now.Before(e.ExpiresAt) {
+		delete(c.entries, uri)
+		return "", false
+	}
+	return e.Object, true
+}
+
+func (c *requestURICache) Put(uri, object string, now, expiresAt time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]requestURICacheEntry)
+	}
+	for k, e := range c.entries {
+		if !now.Before(e.ExpiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	// Fragments make unlimited number of keys, so it doesn't cache more than this.
+	if len(c.entries) < maxRequestURICacheEntries {
+		c.entries[uri] = requestURICacheEntry{Object: object, ExpiresAt: expiresAt}
+	}
+}
+
+// requestURIError is an error of fetchRequestURI, with the description for the client.
+type requestURIError struct {
+	Err         error
+	Description string
+}
+
+func (e requestURIError) Error() string {
+	if e.Err == nil {
+		return e.Description
+	}
+	return fmt.Sprintf("%s: %s", e.Description, e.Err)
+}
+
+// fetchRequestURI gets the request object from the request_uri that registered for the client.
+//
+// The fragment of uri is not sent, but it is a part of the key of the cache, so clients can change it to make lauth fetch again.
+func (api *LauthAPI) fetchRequestURI(clientID, uri string) (string, *requestURIError) {
+	client, ok := api.Config.Clients[clientID]
+	if !ok || !client.RequestURIs.Match(strings.SplitN(uri, "#", 2)[0]) {
+		return "", &requestURIError{Description: "request_uri is not registered for the client"}
+	}
+
+	limits := api.Config.Limits
+
+	now := api.TokenManager.Now()
+	if limits.RequestURICache > 0 {
+		if object, ok := api.requestURICache.Get(uri, now); ok {
+			return object, nil
+		}
+	}
+
+	httpClient := &http.Client{
+		Timeout: limits.RequestURITimeout.Duration(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// Redirections may go to the URI that not registered.
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := httpClient.Get(uri)
+	if err != nil {
+		return "", &requestURIError{Err: err, Description: "failed to fetch request object from request_uri"}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &requestURIError{Err: fmt.Errorf("unexpected status: %s", resp.Status), Description: "failed to fetch request object from request_uri"}
+	}
+
+	var body io.Reader = resp.Body
+	if limits.RequestObjectSize > 0 {
+		body = io.LimitReader(resp.Body, int64(limits.RequestObjectSize)+1)
+	}
+	bs, err := io.ReadAll(body)
+	if err != nil {
+		return "", &requestURIError{Err: err, Description: "failed to fetch request object from request_uri"}
+	}
+	if limits.RequestObjectSize > 0 && len(bs) > limits.RequestObjectSize {
+		return "", &requestURIError{Description: "request object from request_uri is too large"}
+	}
+	if len(bs) == 0 {
+		return "", &requestURIError{Description: "failed to fetch request object from request_uri"}
+	}
+
+	object := string(bs)
+	if limits.RequestURICache > 0 {
+		api.requestURICache.Put(uri, object, now, now.Add(limits.RequestURICache.Duration()))
+	}
+	return object, nil
+}
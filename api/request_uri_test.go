@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestRequestURI(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	clock := env.UseFakeClock(time.Now())
+
+	env.API.Config.Limits.RequestObjectSize = 4096
+	env.API.Config.Limits.RequestURICache = config.Duration(5 * time.Minute)
+
+	object := testutil.SomeClientRequestObject(t, map[string]interface{}{
+		"iss":          "some_client_id",
+		"aud":          env.API.Config.Issuer.String(),
+		"redirect_uri": "http://some-client.example.com/callback",
+	})
+
+	var fetched int32
+	m := http.NewServeMux()
+	m.HandleFunc("/request", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		w.Write([]byte(object))
+	})
+	m.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 4097)))
+	})
+	m.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/request", http.StatusFound)
+	})
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	get := func(clientID, requestURI string) *httptest.ResponseRecorder {
+		return env.Get("/authz", "", url.Values{
+			"client_id":     {clientID},
+			"response_type": {"code"},
+			"request_uri":   {requestURI},
+		})
+	}
+
+	if resp := get("some_client_id", srv.URL+"/request"); resp.Code != http.StatusOK {
+		t.Fatalf("failed to use request_uri: %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := get("some_client_id", srv.URL+"/request"); resp.Code != http.StatusOK {
+		t.Fatalf("failed to use cached request_uri: %d: %s", resp.Code, resp.Body.String())
+	}
+	if n := atomic.LoadInt32(&fetched); n != 1 {
+		t.Errorf("expected to fetch only once while cached but fetched %d times", n)
+	}
+
+	if resp := get("some_client_id", srv.URL+"/request#v2"); resp.Code != http.StatusOK {
+		t.Fatalf("failed to use request_uri with fragment: %d: %s", resp.Code, resp.Body.String())
+	}
+	if n := atomic.LoadInt32(&fetched); n != 2 {
+		t.Errorf("expected to fetch again for another fragment but fetched %d times", n)
+	}
+
+	clock.Advance(6 * time.Minute)
+	get("some_client_id", srv.URL+"/request")
+	if n := atomic.LoadInt32(&fetched); n != 3 {
+		t.Errorf("expected to fetch again after the cache expired but fetched %d times", n)
+	}
+
+	tests := []struct {
+		Name       string
+		ClientID   string
+		RequestURI string
+		Error      string
+	}{
+		{"not registered", "implicit_client_id", srv.URL + "/request", "request_uri is not registered for the client"},
+		{"unknown client", "unknown_client_id", srv.URL + "/request", "request_uri is not registered for the client"},
+		{"another host", "some_client_id", "http://localhost/request", "request_uri is not registered for the client"},
+		{"too large", "some_client_id", srv.URL + "/large", "request object from request_uri is too large"},
+		{"redirect", "some_client_id", srv.URL + "/redirect", "failed to fetch request object from request_uri"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			resp := get(tt.ClientID, tt.RequestURI)
+			if resp.Code != http.StatusBadRequest {
+				t.Errorf("unexpected status code: %d", resp.Code)
+			}
+			if body := resp.Body.String(); !strings.Contains(body, "invalid_request_uri") || !strings.Contains(body, tt.Error) {
+				t.Errorf("expected error %#v but got:\n%s", tt.Error, body)
+			}
+		})
+	}
+}
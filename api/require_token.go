@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/token"
+)
+
+const accessTokenContextKey = "lauth.access_token"
+
+// RequireToken makes a middleware that accepts only requests with a valid access token of lauth.
+// The token has to include all of the scopes.
+//
+// Handlers after this middleware can get the token by AccessTokenFromContext.
+func (api *LauthAPI) RequireToken(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req GetUserInfoRequest
+		if err := (&req).Bind(c); err != nil {
+			errors.SendJSON(c, err)
+			c.Abort()
+			return
+		}
+
+		rawToken, e := req.GetToken()
+		if e != nil {
+			errors.SendJSON(c, e)
+			c.Abort()
+			return
+		}
+
+		t, err := api.TokenManager.ParseAccessToken(rawToken)
+		if err == nil {
+			err = api.validateIssuers(t.Validate)
+		}
+		if err != nil {
+			errors.SendJSON(c, &errors.Error{
+				Err:         err,
+				Reason:      errors.InvalidToken,
+				Description: "token is invalid",
+			})
+			c.Abort()
+			return
+		}
+
+		if len(t.AuthorizedParties) > 0 {
+			api.recordKeyUsage(t.AuthorizedParties[0], rawToken)
+		}
+
+		granted := ParseStringSet(t.Scope)
+		var missing []string
+		for _, s := range scopes {
+			if !granted.Has(s) {
+				missing = append(missing, s)
+			}
+		}
+		if len(missing) > 0 {
+			errors.SendJSON(c, &errors.Error{
+				Reason:      errors.InsufficientScope,
+				Description: fmt.Sprintf("scope %s is required", strings.Join(missing, ", ")),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set(accessTokenContextKey, t)
+		c.Next()
+	}
+}
+
+// AccessTokenFromContext returns the access token that verified by RequireToken.
+func AccessTokenFromContext(c *gin.Context) (token.AccessTokenClaims, bool) {
+	v, ok := c.Get(accessTokenContextKey)
+	if !ok {
+		return token.AccessTokenClaims{}, false
+	}
+	t, ok := v.(token.AccessTokenClaims)
+	return t, ok
+}
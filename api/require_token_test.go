@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestRequireToken(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	env.App.GET("/protected", env.API.RequireToken("profile", "email"), func(c *gin.Context) {
+		token, ok := api.AccessTokenFromContext(c)
+		if !ok {
+			t.Errorf("failed to get access token from context")
+		}
+		c.JSON(http.StatusOK, gin.H{"sub": token.Subject})
+	})
+
+	makeToken := func(issuer *config.URL, scope string) string {
+		token, err := env.API.TokenManager.CreateAccessToken(issuer, "macrat", "some_client_id", scope, time.Now(), time.Hour)
+		if err != nil {
+			t.Fatalf("failed to make access token: %s", err)
+		}
+		return "Bearer " + token
+	}
+
+	env.JSONTest(t, "GET", "/protected", []testutil.JSONTest{
+		{
+			Name:  "success",
+			Token: makeToken(env.API.Config.Issuer, "openid profile email"),
+			Code:  http.StatusOK,
+			Body: map[string]interface{}{
+				"sub": "macrat",
+			},
+		},
+		{
+			Name: "missing token",
+			Code: http.StatusForbidden,
+			Body: map[string]interface{}{
+				"error":             "invalid_token",
+				"error_description": "access token is required",
+			},
+		},
+		{
+			Name:  "invalid token",
+			Token: "Bearer invalid-token",
+			Code:  http.StatusForbidden,
+			Body: map[string]interface{}{
+				"error":             "invalid_token",
+				"error_description": "token is invalid",
+			},
+		},
+		{
+			Name:  "another issuer",
+			Token: makeToken(&config.URL{Scheme: "http", Host: "another-issuer.example.com"}, "profile email"),
+			Code:  http.StatusForbidden,
+			Body: map[string]interface{}{
+				"error":             "invalid_token",
+				"error_description": "token is invalid",
+			},
+		},
+		{
+			Name:  "insufficient scope",
+			Token: makeToken(env.API.Config.Issuer, "openid profile"),
+			Code:  http.StatusForbidden,
+			Body: map[string]interface{}{
+				"error":             "insufficient_scope",
+				"error_description": "scope email is required",
+			},
+		},
+	})
+}
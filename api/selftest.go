@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+type SelfTestResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func newSelfTestResult(name string, err error) SelfTestResult {
+	if err != nil {
+		return SelfTestResult{Name: name, OK: false, Error: err.Error()}
+	}
+	return SelfTestResult{Name: name, OK: true}
+}
+
+func (api *LauthAPI) selfTestToken() error {
+	tok, err := api.TokenManager.CreateAccessToken(api.Config.Issuer, "self-test", "self-test", "openid", api.TokenManager.Now(), time.Minute)
+	if err != nil {
+		return fmt.Errorf("failed to sign token: %s", err)
+	}
+
+	claims, err := api.TokenManager.ParseAccessToken(tok)
+	if err != nil {
+		return fmt.Errorf("failed to verify token: %s", err)
+	}
+	if err := claims.Validate(api.Config.Issuer); err != nil {
+		return fmt.Errorf("failed to validate token: %s", err)
+	}
+
+	return nil
+}
+
+func (api *LauthAPI) selfTestLDAP() error {
+	conn, err := api.Connector.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect LDAP server: %s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Ping(); err != nil {
+		return fmt.Errorf("failed to search base DN %#v: %s", api.Config.LDAP.BaseDN, err)
+	}
+
+	return nil
+}
+
+// SelfTest checks that the server can sign and verify tokens, and can search in the LDAP server.
+func (api *LauthAPI) SelfTest() []SelfTestResult {
+	return []SelfTestResult{
+		newSelfTestResult("token", api.selfTestToken()),
+		newSelfTestResult("ldap", api.selfTestLDAP()),
+	}
+}
+
+// selfTestCacheDuration is how long /readyz reuses the result of SelfTest.
+// SelfTest connects to the LDAP server and signs a token, so it is too heavy to run on every probe.
+const selfTestCacheDuration = 5 * time.Second
+
+type selfTestCache struct {
+	sync.Mutex
+
+	results   []SelfTestResult
+	checkedAt time.Time
+}
+
+// cachedSelfTest returns the result of SelfTest in the last selfTestCacheDuration, or runs SelfTest if expired.
+// Failures are logged only when checked, because /readyz doesn't tell the details to anonymous callers.
+func (api *LauthAPI) cachedSelfTest() []SelfTestResult {
+	now := api.TokenManager.Now()
+
+	cache := &api.selfTest
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.results == nil || now.Sub(cache.checkedAt) >= selfTestCacheDuration || now.Before(cache.checkedAt) {
+		cache.results = api.SelfTest()
+		cache.checkedAt = now
+
+		for _, r := range cache.results {
+			if !r.OK {
+				log.Error().Str("check", r.Name).Msgf("self-test failed: %s", r.Error)
+			}
+		}
+	}
+	return cache.results
+}
+
+// GetReadyz responds the result of SelfTest, with 503 status if any test failed.
+//
+// The error messages are included only if the request has the admin credentials, because those may tell the LDAP settings.
+func (api *LauthAPI) GetReadyz(c *gin.Context) {
+	cached := api.cachedSelfTest()
+	detailed := api.hasAdminCredentials(c)
+
+	status := http.StatusOK
+	results := make([]SelfTestResult, len(cached))
+	for i, r := range cached {
+		if !r.OK {
+			status = http.StatusServiceUnavailable
+		}
+		if !detailed {
+			r.Error = ""
+		}
+		results[i] = r
+	}
+
+	noStore(c)
+
+	if status != http.StatusOK && api.Config.Admin.ErrorFormat == config.ErrorFormatProblem {
+		e := &errors.Error{Reason: errors.TemporarilyUnavailable, Description: "some checks failed"}
+		errors.RenderProblem(c, status, struct {
+			errors.Problem
+			Checks []SelfTestResult `json:"checks"`
+		}{e.Problem(status, c.Request.URL.Path, metrics.TraceID(c)), results})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"ok":     status == http.StatusOK,
+		"checks": results,
+	})
+}
@@ -0,0 +1,70 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/testutil"
+)
+
+type brokenConnector struct{}
+
+func (brokenConnector) Connect() (ldap.Session, error) {
+	return nil, fmt.Errorf("connection refused")
+}
+
+func TestGetReadyz(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.App.GET("/readyz", env.API.GetReadyz)
+	clock := env.UseFakeClock(time.Now().Add(-30 * time.Second))
+
+	env.JSONTest(t, "GET", "/readyz", []testutil.JSONTest{
+		{
+			Name: "ready",
+			Code: http.StatusOK,
+			Body: map[string]interface{}{
+				"ok": true,
+				"checks": []interface{}{
+					map[string]interface{}{"name": "token", "ok": true},
+					map[string]interface{}{"name": "ldap", "ok": true},
+				},
+			},
+		},
+	})
+
+	env.API.Connector = brokenConnector{}
+
+	if resp := env.Get("/readyz", "", nil); resp.Code != http.StatusOK {
+		t.Errorf("expected cached result but got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	clock.Advance(10 * time.Second)
+
+	env.JSONTest(t, "GET", "/readyz", []testutil.JSONTest{
+		{
+			Name: "ldap unavailable",
+			Code: http.StatusServiceUnavailable,
+			Body: map[string]interface{}{
+				"ok": false,
+				"checks": []interface{}{
+					map[string]interface{}{"name": "token", "ok": true},
+					map[string]interface{}{"name": "ldap", "ok": false},
+				},
+			},
+		},
+	})
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	req.SetBasicAuth("admin", "admin password")
+	resp := env.DoRequest(req)
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status code: %d", resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), `"error":"failed to connect LDAP server: connection refused"`) {
+		t.Errorf("expected error message for admin: %s", resp.Body.String())
+	}
+}
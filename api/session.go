@@ -0,0 +1,160 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/token"
+)
+
+// SessionStatus is the response of the SSO session status endpoint.
+type SessionStatus struct {
+	Active    bool  `json:"active"`
+	AuthTime  int64 `json:"auth_time,omitempty"`
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+	Renewable bool  `json:"renewable"`
+}
+
+func (api *LauthAPI) sessionStatus(ssoToken token.SSOTokenClaims) SessionStatus {
+	expiresIn := ssoToken.ExpiresAt - api.TokenManager.Now().Unix()
+	if expiresIn < 0 {
+		expiresIn = 0
+	}
+
+	return SessionStatus{
+		Active:    true,
+		AuthTime:  ssoToken.AuthTime,
+		ExpiresAt: ssoToken.ExpiresAt,
+		ExpiresIn: expiresIn,
+		Renewable: api.Config.SSO.Sliding,
+	}
+}
+
+// GetSessionStatus responds the remaining lifetime of the SSO session, for the session-management iframe or custom templates.
+func (api *LauthAPI) GetSessionStatus(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	noStore(c)
+
+	ssoToken, err := api.GetSSOToken(c)
+	if err != nil {
+		if err != http.ErrNoCookie {
+			api.DeleteSSOToken(c)
+		}
+		c.JSON(http.StatusOK, SessionStatus{Renewable: api.Config.SSO.Sliding})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.sessionStatus(ssoToken))
+}
+
+// sameOrigin checks if the Origin header is the same as the issuer, if the header is set.
+func (api *LauthAPI) sameOrigin(c *gin.Context) bool {
+	origin := getOriginHeader(c)
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == api.Config.Issuer.Scheme && u.Host == api.Config.Issuer.Host
+}
+
+// PostSessionRenew extends the SSO session to --sso-expire from now up to --sso-max-lifetime, if --sso-sliding is enabled.
+func (api *LauthAPI) PostSessionRenew(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	noStore(c)
+
+	if !api.Config.SSO.Sliding {
+		e := &errors.Error{
+			Reason:      errors.AccessDenied,
+			Description: "sliding expiration of SSO session is disabled",
+		}
+		report.SetError(e)
+		c.JSON(http.StatusForbidden, e)
+		return
+	}
+
+	if !api.sameOrigin(c) {
+		e := &errors.Error{
+			Reason:      errors.AccessDenied,
+			Description: "cross-origin request is not allowed",
+		}
+		report.SetError(e)
+		c.JSON(http.StatusForbidden, e)
+		return
+	}
+
+	ssoToken, err := api.GetSSOToken(c)
+	if err != nil {
+		if err != http.ErrNoCookie {
+			api.DeleteSSOToken(c)
+		}
+		e := &errors.Error{
+			Err:         err,
+			Reason:      errors.LoginRequired,
+			Description: "no active SSO session",
+		}
+		report.SetError(e)
+		c.JSON(http.StatusUnauthorized, e)
+		return
+	}
+
+	expiresAt := api.slideSSOExpiry(time.Unix(ssoToken.AuthTime, 0), time.Unix(ssoToken.ExpiresAt, 0))
+	if expiresAt.Unix() > ssoToken.ExpiresAt {
+		ssoToken.ExpiresAt = expiresAt.Unix()
+		if err := api.setSSOCookie(c, ssoToken); err != nil {
+			e := &errors.Error{
+				Err:         err,
+				Reason:      errors.ServerError,
+				Description: "failed to renew SSO token",
+			}
+			report.SetError(e)
+			errors.SendJSON(c, e)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, api.sessionStatus(ssoToken))
+}
+
+// setSSOCookie issues the SSO token with the session ID, subject, parties, consents, MFA, and times of ssoToken, and sets it as cookie.
+// The fingerprint is made from the current request.
+func (api *LauthAPI) setSSOCookie(c *gin.Context, ssoToken token.SSOTokenClaims) error {
+	raw, err := api.TokenManager.CreateSSOTokenWithMFA(
+		api.Config.Issuer,
+		ssoToken.Id,
+		ssoToken.Subject,
+		api.SSOFingerprint(c),
+		ssoToken.Authorized,
+		ssoToken.Consents,
+		ssoToken.MFA,
+		time.Unix(ssoToken.AuthTime, 0),
+		time.Unix(ssoToken.ExpiresAt, 0),
+	)
+	if err != nil {
+		return err
+	}
+
+	secure := api.Config.Issuer.Scheme == "https"
+	c.SetCookie(
+		SSO_TOKEN_COOKIE,
+		raw,
+		int(api.Config.Expire.SSO.IntSeconds()),
+		"/",
+		api.Config.Issuer.Hostname(),
+		secure,
+		true,
+	)
+	return nil
+}
@@ -0,0 +1,196 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func sessionRequest(t *testing.T, env *testutil.APITestEnvironment, method, path, ssoToken, origin string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, path, nil)
+	if ssoToken != "" {
+		req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	return env.DoRequest(req)
+}
+
+func decodeSessionStatus(t *testing.T, resp *httptest.ResponseRecorder) api.SessionStatus {
+	t.Helper()
+
+	var status api.SessionStatus
+	if err := json.Unmarshal(resp.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to parse response: %s", err)
+	}
+	return status
+}
+
+func TestSession(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	clock := env.UseFakeClock(time.Now())
+
+	authTime := clock.Now()
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope},
+		authTime,
+		authTime.Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	clock.Advance(4 * time.Minute)
+
+	resp := sessionRequest(t, env, "GET", "/session/status", ssoToken, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	if cc := resp.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("unexpected Cache-Control: %#v", cc)
+	}
+	status := decodeSessionStatus(t, resp)
+	expect := api.SessionStatus{
+		Active:    true,
+		AuthTime:  authTime.Unix(),
+		ExpiresAt: authTime.Add(10 * time.Minute).Unix(),
+		ExpiresIn: 6 * 60,
+		Renewable: false,
+	}
+	if status != expect {
+		t.Errorf("unexpected status: %#v", status)
+	}
+
+	resp = sessionRequest(t, env, "GET", "/session/status", "", "")
+	if status := decodeSessionStatus(t, resp); status != (api.SessionStatus{}) {
+		t.Errorf("unexpected status without session: %#v", status)
+	}
+
+	resp = sessionRequest(t, env, "POST", "/session/renew", ssoToken, "")
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("expected 403 when sliding is disabled but got %d", resp.Code)
+	}
+
+	env.API.Config.SSO.Sliding = true
+
+	resp = sessionRequest(t, env, "POST", "/session/renew", ssoToken, "http://evil.example.com")
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for cross-origin request but got %d", resp.Code)
+	}
+
+	resp = sessionRequest(t, env, "POST", "/session/renew", "", "")
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without session but got %d", resp.Code)
+	}
+
+	resp = sessionRequest(t, env, "POST", "/session/renew", ssoToken, env.API.Config.Issuer.String())
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to renew: %d: %s", resp.Code, resp.Body.String())
+	}
+	status = decodeSessionStatus(t, resp)
+	if status.ExpiresAt != clock.Now().Add(env.API.Config.Expire.SSO.Duration()).Unix() || status.AuthTime != authTime.Unix() || !status.Renewable {
+		t.Errorf("unexpected status after renew: %#v", status)
+	}
+
+	var renewed string
+	for _, c := range resp.Result().Cookies() {
+		if c.Name == api.SSO_TOKEN_COOKIE {
+			renewed = c.Value
+		}
+	}
+	claims, err := env.API.TokenManager.ParseSSOToken(renewed)
+	if err != nil {
+		t.Fatalf("failed to parse renewed SSO token: %s", err)
+	}
+	if claims.Id != "some-session" || claims.ExpiresAt != status.ExpiresAt {
+		t.Errorf("unexpected renewed SSO token: %#v", claims)
+	}
+}
+
+func TestSSO_SlidingExpiration(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	// tokens are verified by the real clock, so the fake clock goes from the past.
+	clock := env.UseFakeClock(time.Now().Add(-10 * time.Minute))
+
+	env.API.Config.Expire.SSO = config.Duration(30 * time.Minute)
+	env.API.Config.SSO.MaxLifetime = config.Duration(36 * time.Minute)
+
+	authTime := clock.Now()
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"some-session",
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope},
+		authTime,
+		authTime.Add(30*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	authzRequest := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid"},
+		"prompt":        {"none"},
+	}
+
+	tests := []struct {
+		Sliding bool
+		Advance time.Duration
+		Expect  time.Time
+	}{
+		{false, 2 * time.Minute, authTime.Add(30 * time.Minute)},
+		{true, 2 * time.Minute, authTime.Add(34 * time.Minute)},
+		{true, 4 * time.Minute, authTime.Add(36 * time.Minute)},
+	}
+
+	for i, tt := range tests {
+		env.API.Config.SSO.Sliding = tt.Sliding
+		clock.Advance(tt.Advance)
+
+		resp := sessionRequest(t, env, "GET", "/authz?"+authzRequest.Encode(), ssoToken, "")
+		if resp.Code != http.StatusFound {
+			t.Fatalf("%d: unexpected status code: %d", i, resp.Code)
+		}
+		if loc, _ := url.Parse(resp.Header().Get("Location")); loc.Query().Get("code") == "" {
+			t.Fatalf("%d: failed to authorize silently: %s", i, loc)
+		}
+
+		for _, c := range resp.Result().Cookies() {
+			if c.Name == api.SSO_TOKEN_COOKIE {
+				ssoToken = c.Value
+			}
+		}
+		claims, err := env.API.TokenManager.ParseSSOToken(ssoToken)
+		if err != nil {
+			t.Fatalf("%d: failed to parse SSO token: %s", i, err)
+		}
+		if claims.ExpiresAt != tt.Expect.Unix() {
+			t.Errorf("%d: expected to expire at %s but got %s", i, tt.Expect, time.Unix(claims.ExpiresAt, 0))
+		}
+		if claims.AuthTime != authTime.Unix() {
+			t.Errorf("%d: auth_time was changed", i)
+		}
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/macrat/lauth/events"
+	"github.com/macrat/lauth/revocation"
+	"github.com/macrat/lauth/secret"
 	"github.com/macrat/lauth/token"
 )
 
@@ -11,42 +15,64 @@ const (
 	SSO_TOKEN_COOKIE = "lauth_token"
 )
 
-func (api *LauthAPI) SetSSOToken(c *gin.Context, subject, client string, authenticated bool) error {
-	authTime := time.Now()
-	expiresAt := time.Now().Add(api.Config.Expire.SSO.Duration())
+// SetSSOToken issues or renews SSO token and sets it as cookie.
+// The scope is recorded as consented for the client, and the mfaProvider is recorded as passed if not empty.
+//
+// It returns the session ID that can use to revoke the SSO token.
+func (api *LauthAPI) SetSSOToken(c *gin.Context, subject, client, scope string, authenticated bool, mfaProvider string) (string, error) {
+	id := uuid.New().String()
+	authTime := api.TokenManager.Now()
+	expiresAt := authTime.Add(api.Config.Expire.SSO.Duration())
 	azp := token.AuthorizedParties{client}
+	var consents token.Consents
+	var passedMFA []string
 
 	if current, err := api.GetSSOToken(c); err == nil {
 		if !authenticated {
+			if current.Id != "" {
+				id = current.Id
+			}
 			authTime = time.Unix(current.AuthTime, 0)
 			expiresAt = time.Unix(current.ExpiresAt, 0)
+			if api.Config.SSO.Sliding {
+				expiresAt = api.slideSSOExpiry(authTime, expiresAt)
+			}
+			passedMFA = current.MFA
 		}
 		azp = current.Authorized.Append(client)
+		consents = current.Consents
+	}
+	consents = consents.Add(client, scope)
+	if mfaProvider != "" && !(token.SSOTokenClaims{MFA: passedMFA}).PassedMFA(mfaProvider) {
+		passedMFA = append(passedMFA, mfaProvider)
 	}
 
-	token, err := api.TokenManager.CreateSSOToken(
-		api.Config.Issuer,
-		subject,
-		azp,
-		authTime,
-		expiresAt,
-	)
-	if err != nil {
-		return err
+	claims := token.SSOTokenClaims{
+		Authorized: azp,
+		Consents:   consents,
+		MFA:        passedMFA,
+	}
+	claims.Id = id
+	claims.Subject = subject
+	claims.AuthTime = authTime.Unix()
+	claims.ExpiresAt = expiresAt.Unix()
+	if err := api.setSSOCookie(c, claims); err != nil {
+		return "", err
 	}
 
-	secure := api.Config.Issuer.Scheme == "https"
-	c.SetCookie(
-		SSO_TOKEN_COOKIE,
-		token,
-		int(api.Config.Expire.SSO.IntSeconds()),
-		"/",
-		api.Config.Issuer.Hostname(),
-		secure,
-		true,
-	)
+	return id, nil
+}
 
-	return nil
+// slideSSOExpiry returns the expiration of SSO session that used now, capped by --sso-max-lifetime from the login.
+func (api *LauthAPI) slideSSOExpiry(authTime, expiresAt time.Time) time.Time {
+	next := api.TokenManager.Now().Add(api.Config.Expire.SSO.Duration())
+	if limit := authTime.Add(api.Config.SSO.MaxLifetime.Duration()); next.After(limit) {
+		next = limit
+	}
+	if next.Before(expiresAt) {
+		return expiresAt
+	}
+	return next
 }
 
 func (api *LauthAPI) GetSSOToken(c *gin.Context) (token.SSOTokenClaims, error) {
@@ -60,14 +86,39 @@ func (api *LauthAPI) GetSSOToken(c *gin.Context) (token.SSOTokenClaims, error) {
 		return token.SSOTokenClaims{}, err
 	}
 
-	err = ssoToken.Validate(api.Config.Issuer)
+	err = api.validateIssuers(ssoToken.Validate)
 	if err != nil {
 		return token.SSOTokenClaims{}, err
 	}
 
+	if api.Revocation.IsRevoked(ssoToken.Id) {
+		return token.SSOTokenClaims{}, token.RevokedTokenError
+	}
+
+	if !secret.Equal(ssoToken.Fingerprint, api.SSOFingerprint(c)) {
+		return token.SSOTokenClaims{}, token.FingerprintMismatchError
+	}
+
 	return ssoToken, nil
 }
 
+// RevokeSSOToken puts the SSO token into the revocation list if the list is available.
+func (api *LauthAPI) RevokeSSOToken(ssoToken token.SSOTokenClaims) error {
+	if api.Revocation == nil {
+		return nil
+	}
+	if err := api.Revocation.Revoke(ssoToken.Id, time.Unix(ssoToken.ExpiresAt, 0)); err == revocation.AlreadyRevokedError {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	events.Emit(events.TypeSSORevoked, map[string]string{
+		"sso_id":   ssoToken.Id,
+		"username": ssoToken.Subject,
+	})
+	return nil
+}
+
 func (api *LauthAPI) DeleteSSOToken(c *gin.Context) {
 	secure := api.Config.Issuer.Scheme == "https"
 	c.SetCookie(SSO_TOKEN_COOKIE, "", 0, "/", api.Config.Issuer.Hostname(), secure, true)
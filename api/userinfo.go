@@ -1,7 +1,9 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/macrat/lauth/config"
@@ -10,7 +12,7 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func (api *LauthAPI) userinfo(subject string, scope *StringSet) (map[string]interface{}, *errors.Error) {
+func (api *LauthAPI) userinfo(c *gin.Context, subject, clientID string, scope *StringSet) (map[string]interface{}, *errors.Error) {
 	conn, err := api.Connector.Connect()
 	if err != nil {
 		log.Error().
@@ -25,7 +27,15 @@ func (api *LauthAPI) userinfo(subject string, scope *StringSet) (map[string]inte
 	}
 	defer conn.Close()
 
-	attrs, err := conn.GetUserAttributes(subject, api.Config.Scopes.AttributesFor(scope.List()))
+	roles := api.Config.Clients[clientID].Roles
+	groupsAttr := api.Config.Policy.GroupsAttribute
+
+	attributes := api.Config.Scopes.AttributesFor(scope.List())
+	if len(roles) > 0 {
+		attributes = append(attributes, groupsAttr)
+	}
+
+	attrs, err := conn.GetUserAttributes(subject, attributes)
 	if err != nil {
 		return nil, &errors.Error{
 			Err:         err,
@@ -33,19 +43,25 @@ func (api *LauthAPI) userinfo(subject string, scope *StringSet) (map[string]inte
 			Description: "user was not found or disabled",
 		}
 	}
+	if e := api.enrichAttributes(c, subject, attrs); e != nil {
+		return nil, e
+	}
 
 	maps := api.Config.Scopes.ClaimMapFor(scope.List())
 	result := config.MappingClaims(attrs, maps)
 	result["sub"] = subject
+	if len(roles) > 0 {
+		result["roles"] = roles.RolesFor(attrs[groupsAttr])
+	}
 
-	return result, nil
+	return api.filterClaims(c, subject, clientID, scope, result)
 }
 
 func (api *LauthAPI) sendUserInfo(c *gin.Context, report *metrics.Context, origin, rawToken string) {
 	token, err := api.TokenManager.ParseAccessToken(rawToken)
 	if err == nil {
 		report.Set("username", token.Subject)
-		err = token.Validate(api.Config.Issuer)
+		err = api.validateIssuers(token.Validate)
 	}
 
 	clientID := ""
@@ -65,6 +81,18 @@ func (api *LauthAPI) sendUserInfo(c *gin.Context, report *metrics.Context, origi
 		return
 	}
 
+	api.recordKeyUsage(clientID, rawToken)
+
+	if token.Subject == "" {
+		e := &errors.Error{
+			Reason:      errors.InvalidToken,
+			Description: "token has no user; tokens of client_credentials grant can't use userinfo",
+		}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
 	if origin != "" {
 		client := api.Config.Clients[clientID]
 		if client.CORSOrigin.Match(origin) {
@@ -81,7 +109,7 @@ func (api *LauthAPI) sendUserInfo(c *gin.Context, report *metrics.Context, origi
 	}
 
 	scope := ParseStringSet(token.Scope)
-	info, e := api.userinfo(token.Subject, scope)
+	info, e := api.userinfo(c, token.Subject, clientID, scope)
 	if e != nil {
 		report.SetError(e)
 		errors.SendJSON(c, e)
@@ -91,3 +119,103 @@ func (api *LauthAPI) sendUserInfo(c *gin.Context, report *metrics.Context, origi
 	report.Success()
 	c.JSON(http.StatusOK, info)
 }
+
+// idTokenClaims returns userinfo for id_token.
+// The groups claim is truncated if it has more than GroupsLimit entries, like Azure AD's groups overage.
+func (api *LauthAPI) idTokenClaims(c *gin.Context, subject, clientID string, scope *StringSet) (map[string]interface{}, *errors.Error) {
+	claims, e := api.userinfo(c, subject, clientID, scope)
+	if e != nil {
+		return nil, e
+	}
+
+	limit := api.Config.IDToken.GroupsLimit
+	if groups, ok := claims["groups"].([]string); ok && limit > 0 && len(groups) > limit {
+		claims["groups"] = groups[:limit]
+		api.setGroupsOverage(claims)
+	}
+
+	return claims, nil
+}
+
+// setGroupsOverage marks that the full list of groups is available via userinfo endpoint.
+func (api *LauthAPI) setGroupsOverage(claims map[string]interface{}) {
+	claims["groups_overage"] = true
+	claims["_claim_names"] = map[string]string{
+		"groups": "userinfo",
+	}
+	claims["_claim_sources"] = map[string]interface{}{
+		"userinfo": map[string]string{
+			"endpoint": api.Config.OpenIDConfiguration().UserinfoEndpoint,
+		},
+	}
+}
+
+// createIDToken signs id_token, and applies --id-token-overflow if it is larger than --id-token-max-size.
+func (api *LauthAPI) createIDToken(subject, clientID, nonce, code, accessToken string, claims map[string]interface{}, authTime time.Time) (string, *errors.Error) {
+	create := func(claims map[string]interface{}) (string, *errors.Error) {
+		token, err := api.TokenManager.CreateIDToken(
+			api.Config.Issuer,
+			subject,
+			clientID,
+			nonce,
+			code,
+			accessToken,
+			claims,
+			authTime,
+			api.Config.Expire.Token.Duration(),
+		)
+		if err != nil {
+			return "", &errors.Error{
+				Err:         err,
+				Reason:      errors.ServerError,
+				Description: "failed to generate id_token",
+			}
+		}
+		return token, nil
+	}
+
+	token, e := create(claims)
+	maxSize := api.Config.IDToken.MaxSize
+	if e != nil || maxSize <= 0 || len(token) <= maxSize {
+		return token, e
+	}
+
+	warn := func(size int) {
+		log.Warn().
+			Str("client_id", clientID).
+			Str("username", subject).
+			Int("size", size).
+			Int("max_size", maxSize).
+			Msg("id_token is larger than --id-token-max-size")
+	}
+
+	switch api.Config.IDToken.Overflow {
+	case config.IDTokenOverflowError:
+		return "", &errors.Error{
+			Err:         fmt.Errorf("id_token is %d bytes but --id-token-max-size is %d bytes", len(token), maxSize),
+			Reason:      errors.ServerError,
+			Description: "id_token is too large",
+		}
+	case config.IDTokenOverflowWarn:
+		warn(len(token))
+		return token, nil
+	}
+
+	if _, ok := claims["groups"]; !ok {
+		warn(len(token))
+		return token, nil
+	}
+
+	dropped := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		dropped[k] = v
+	}
+	delete(dropped, "groups")
+	api.setGroupsOverage(dropped)
+
+	token, e = create(dropped)
+	if e == nil && len(token) > maxSize {
+		warn(len(token))
+	}
+	return token, e
+}
@@ -2,10 +2,14 @@ package api_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/testutil"
 )
 
@@ -208,3 +212,186 @@ func TestUserinfoCORS(t *testing.T) {
 		})
 	}
 }
+
+func TestUserinfo_Roles(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.Roles = config.RoleMappings{
+		{Group: "CN=grafana-admins,OU=groups,DC=example,DC=com", Role: "admin"},
+		{Group: "CN=grafana-editors,OU=groups,DC=example,DC=com", Role: "editor"},
+		{Group: "cn=users,ou=groups,dc=example,dc=com", Role: "viewer"},
+	}
+	env.API.Config.Clients["some_client_id"] = client
+
+	macratToken, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "macrat", "some_client_id", "openid email", time.Now(), 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate access_token: %s", err)
+	}
+	smithToken, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "j.smith", "some_client_id", "openid", time.Now(), 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate access_token: %s", err)
+	}
+	otherClientToken, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "macrat", "implicit_client_id", "openid", time.Now(), 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate access_token: %s", err)
+	}
+
+	env.JSONTest(t, "GET", "/userinfo", []testutil.JSONTest{
+		{
+			Name:  "mapped roles",
+			Token: "Bearer " + macratToken,
+			Code:  http.StatusOK,
+			Body: map[string]interface{}{
+				"sub":   "macrat",
+				"email": "m@crat.jp",
+				"roles": []interface{}{"admin", "viewer"},
+			},
+		},
+		{
+			Name:  "no groups",
+			Token: "Bearer " + smithToken,
+			Code:  http.StatusOK,
+			Body: map[string]interface{}{
+				"sub":   "j.smith",
+				"roles": []interface{}{},
+			},
+		},
+		{
+			Name:  "client without mapping",
+			Token: "Bearer " + otherClientToken,
+			Code:  http.StatusOK,
+			Body: map[string]interface{}{
+				"sub": "macrat",
+			},
+		},
+	})
+}
+
+func TestUserinfo_ClaimSources(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/macrat", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer hr-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"costCenter": "CC-1234", "mail": "macrat@hr.example.com", "memberOf": ["CN=injected"]}`))
+	})
+	mux.HandleFunc("/error/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Scopes["email"] = append(env.API.Config.Scopes["email"], config.ClaimConfig{Claim: "cost_center", Attribute: "costCenter", Type: config.CLAIM_TYPE_STRING})
+
+	macratToken, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "macrat", "some_client_id", "openid email", time.Now(), 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate access_token: %s", err)
+	}
+	smithToken, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "j.smith", "some_client_id", "openid email", time.Now(), 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate access_token: %s", err)
+	}
+
+	hr := config.ClaimSourceConfig{
+		Name:       "hr",
+		URL:        server.URL + "/users/{subject}",
+		Attributes: []string{"costCenter"},
+		Headers:    map[string]string{"Authorization": "Bearer hr-token"},
+	}
+	broken := config.ClaimSourceConfig{
+		Name:       "broken",
+		URL:        server.URL + "/error/{subject}",
+		Attributes: []string{"costCenter"},
+	}
+
+	tests := []struct {
+		Name    string
+		Sources []config.ClaimSourceConfig
+		Token   string
+		Code    int
+		Body    map[string]interface{}
+	}{
+		{
+			Name:    "enriched",
+			Sources: []config.ClaimSourceConfig{hr},
+			Token:   macratToken,
+			Code:    http.StatusOK,
+			Body:    map[string]interface{}{"sub": "macrat", "email": "m@crat.jp", "cost_center": "CC-1234"},
+		},
+		{
+			Name:    "not found in source",
+			Sources: []config.ClaimSourceConfig{hr},
+			Token:   smithToken,
+			Code:    http.StatusOK,
+			Body:    map[string]interface{}{"sub": "j.smith", "email": "jhon@example.com"},
+		},
+		{
+			Name: "source precedence",
+			Sources: []config.ClaimSourceConfig{{
+				Name:       "hr",
+				URL:        hr.URL,
+				Attributes: []string{"mail"},
+				Headers:    hr.Headers,
+			}},
+			Token: macratToken,
+			Code:  http.StatusOK,
+			Body:  map[string]interface{}{"sub": "macrat", "email": "macrat@hr.example.com"},
+		},
+		{
+			Name: "ldap precedence",
+			Sources: []config.ClaimSourceConfig{{
+				Name:       "hr",
+				URL:        hr.URL,
+				Attributes: []string{"mail"},
+				Precedence: "ldap",
+				Headers:    hr.Headers,
+			}},
+			Token: macratToken,
+			Code:  http.StatusOK,
+			Body:  map[string]interface{}{"sub": "macrat", "email": "m@crat.jp"},
+		},
+		{
+			Name:    "optional source is down",
+			Sources: []config.ClaimSourceConfig{broken, hr},
+			Token:   macratToken,
+			Code:    http.StatusOK,
+			Body:    map[string]interface{}{"sub": "macrat", "email": "m@crat.jp", "cost_center": "CC-1234"},
+		},
+		{
+			Name: "required source is down",
+			Sources: []config.ClaimSourceConfig{{
+				Name:       "broken",
+				URL:        broken.URL,
+				Attributes: broken.Attributes,
+				Required:   true,
+			}},
+			Token: macratToken,
+			Code:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			env.API.Config.ClaimSources = tt.Sources
+
+			resp := env.Get("/userinfo", "Bearer "+tt.Token, nil)
+			if resp.Code != tt.Code {
+				t.Fatalf("expected status code %d but got %d: %s", tt.Code, resp.Code, resp.Body.String())
+			}
+			if tt.Body == nil {
+				return
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse response: %s", err)
+			}
+			if !reflect.DeepEqual(body, tt.Body) {
+				t.Errorf("unexpected claims:\nexpected: %#v\n but got: %#v", tt.Body, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/token"
+)
+
+// BuildInfo is the version of the running binary.
+type BuildInfo struct {
+	Version string
+	Commit  string
+}
+
+type VersionResponse struct {
+	Version   string                 `json:"version"`
+	Commit    string                 `json:"commit,omitempty"`
+	GoVersion string                 `json:"go_version"`
+	Platform  string                 `json:"platform"`
+	Keys      []token.KeyFingerprint `json:"keys"`
+	Features  map[string]bool        `json:"features"`
+}
+
+// Version reports the build and the running state that should be the same in all replicas.
+func (api *LauthAPI) Version() VersionResponse {
+	return VersionResponse{
+		Version:   api.Build.Version,
+		Commit:    api.Build.Commit,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Keys:      api.TokenManager.KeyFingerprints(),
+		Features:  api.Features.All(),
+	}
+}
+
+// GetVersion responds Version, for fleet inventory and finding replicas that have different versions or keys.
+//
+// It requires the admin credentials, because the version and the features help attackers to find a vulnerability.
+func (api *LauthAPI) GetVersion(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	noStore(c)
+
+	if e := api.requireAdmin(c); e != nil {
+		report.SetError(e)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Version())
+}
@@ -0,0 +1,49 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/feature"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestGetVersion(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Build = api.BuildInfo{Version: "1.2.3", Commit: "abc1234"}
+
+	if resp := env.Get("/version", "", nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without credentials but got %d", resp.Code)
+	}
+
+	req, _ := http.NewRequest("GET", "/version", nil)
+	req.SetBasicAuth("admin", "admin password")
+	resp := env.DoRequest(req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	if cc := resp.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("unexpected Cache-Control: %s", cc)
+	}
+
+	var body api.VersionResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response: %s", err)
+	}
+
+	if body.Version != "1.2.3" || body.Commit != "abc1234" {
+		t.Errorf("unexpected version: %#v", body)
+	}
+	if body.GoVersion != runtime.Version() || body.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("unexpected runtime: %#v", body)
+	}
+	if len(body.Keys) != 1 || body.Keys[0].KeyID != env.API.TokenManager.KeyID().String() || !body.Keys[0].Signing {
+		t.Errorf("unexpected keys: %#v", body.Keys)
+	}
+	if !body.Features[feature.Implicit] {
+		t.Errorf("unexpected features: %#v", body.Features)
+	}
+}
@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	TYPE_EVENT  = "event"
+	TYPE_ANCHOR = "anchor"
+)
+
+var (
+	BrokenChainError = errors.New("audit log chain is broken")
+	NoAnchorError    = errors.New("audit log has no anchor")
+)
+
+type Entry struct {
+	Seq      uint64            `json:"seq"`
+	Time     string            `json:"time"`
+	Type     string            `json:"type"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Anchor   string            `json:"anchor,omitempty"`
+	PrevHash string            `json:"prev_hash"`
+	Hash     string            `json:"hash"`
+}
+
+func (e Entry) CalcHash() string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// Signer makes a signature for the anchor of the chain.
+type Signer func(seq uint64, hash string) (string, error)
+
+// Verifier checks the signature that made by Signer and returns signed seq and hash.
+type Verifier func(anchor string) (seq uint64, hash string, err error)
+
+type Logger struct {
+	sync.Mutex
+
+	w      io.Writer
+	signer Signer
+
+	seq         uint64
+	prevHash    string
+	sinceAnchor int
+
+	mirrors []*mirror
+}
+
+func NewLogger(w io.Writer, signer Signer) *Logger {
+	return &Logger{
+		w:      w,
+		signer: signer,
+	}
+}
+
+// OpenFile opens audit log file to append, and continues the chain of existing entries.
+func OpenFile(path string, signer Signer) (*Logger, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := NewLogger(f, signer)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read existing audit log: %s", err)
+		}
+		l.seq = e.Seq
+		l.prevHash = e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Logger) write(e Entry) error {
+	l.seq++
+	e.Seq = l.seq
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	e.PrevHash = l.prevHash
+	e.Hash = e.CalcHash()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line := append(b, '\n')
+	if _, err := l.w.Write(line); err != nil {
+		return err
+	}
+
+	l.prevHash = e.Hash
+
+	for _, m := range l.mirrors {
+		m.Write(line)
+	}
+	return nil
+}
+
+// MirrorTo adds another writer to copy entries into, like the Windows Event Log or syslog.
+// Each entry is written by a single Write call, in the background with a queue of MirrorQueueSize entries.
+// Entries are dropped if the queue is full, because the chain in the main writer is what to verify.
+// Failures of the writer and dropped entries are reported to onError.
+func (l *Logger) MirrorTo(w io.Writer, onError func(error)) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.mirrors = append(l.mirrors, newMirror(w, onError, MirrorQueueSize))
+}
+
+// Close stops mirroring, and waits until queued entries are written to mirrors or timeout.
+// It returns the number of entries that dropped because of timeout.
+// It may wait longer than timeout until the current Write of mirrors returns.
+// The main writer is not closed.
+func (l *Logger) Close(timeout time.Duration) int {
+	l.Lock()
+	mirrors := l.mirrors
+	l.mirrors = nil
+	l.Unlock()
+
+	dropped := 0
+	for _, m := range mirrors {
+		dropped += m.Close(timeout)
+	}
+	return dropped
+}
+
+func (l *Logger) Record(fields map[string]string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	l.sinceAnchor++
+	return l.write(Entry{
+		Type:   TYPE_EVENT,
+		Fields: fields,
+	})
+}
+
+// Anchor writes the signature of the last hash if there are new entries since the last anchor.
+func (l *Logger) Anchor() error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.sinceAnchor == 0 {
+		return nil
+	}
+
+	sign, err := l.signer(l.seq, l.prevHash)
+	if err != nil {
+		return err
+	}
+
+	if err := l.write(Entry{Type: TYPE_ANCHOR, Anchor: sign}); err != nil {
+		return err
+	}
+	l.sinceAnchor = 0
+
+	return nil
+}
+
+// StartAnchoring calls Anchor every interval until stop called.
+func (l *Logger) StartAnchoring(interval time.Duration, onError func(error)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.Anchor(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+type VerifyResult struct {
+	Entries    uint64
+	Anchors    int
+	LastAnchor uint64
+}
+
+// Verify checks the hash chain and anchors of the audit log.
+// Entries after the last anchor are checked only the chain.
+func Verify(r io.Reader, verifier Verifier) (VerifyResult, error) {
+	var result VerifyResult
+	var prevHash string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return result, fmt.Errorf("line %d: %s", result.Entries+1, err)
+		}
+
+		if e.Seq != result.Entries+1 || e.PrevHash != prevHash || e.Hash != e.CalcHash() {
+			return result, fmt.Errorf("seq %d: %w", e.Seq, BrokenChainError)
+		}
+
+		if e.Type == TYPE_ANCHOR {
+			seq, hash, err := verifier(e.Anchor)
+			if err != nil {
+				return result, fmt.Errorf("seq %d: invalid anchor: %s", e.Seq, err)
+			}
+			if seq != e.Seq-1 || hash != e.PrevHash {
+				return result, fmt.Errorf("seq %d: anchor is not for this chain: %w", e.Seq, BrokenChainError)
+			}
+			result.Anchors++
+			result.LastAnchor = e.Seq
+		}
+
+		result.Entries = e.Seq
+		prevHash = e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	if result.Entries > 0 && result.Anchors == 0 {
+		return result, NoAnchorError
+	}
+
+	return result, nil
+}
+
+var (
+	defaultLogger *Logger
+)
+
+// SetDefault sets Logger to use by Record function.
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// Record writes an entry to the default Logger. It does nothing if the default Logger is not set.
+func Record(fields map[string]string) error {
+	if defaultLogger == nil {
+		return nil
+	}
+	return defaultLogger.Record(fields)
+}
@@ -0,0 +1,202 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/audit"
+)
+
+func dummySigner(seq uint64, hash string) (string, error) {
+	return fmt.Sprintf("signed:%d:%s", seq, hash), nil
+}
+
+func dummyVerifier(anchor string) (uint64, string, error) {
+	var seq uint64
+	var hash string
+	if _, err := fmt.Sscanf(strings.ReplaceAll(anchor, ":", " "), "signed %d %s", &seq, &hash); err != nil {
+		return 0, "", err
+	}
+	return seq, hash, nil
+}
+
+func rewriteEntry(t *testing.T, log []byte, seq int, rewrite func(e *audit.Entry)) []byte {
+	t.Helper()
+
+	lines := bytes.Split(bytes.TrimSpace(log), []byte("\n"))
+
+	var e audit.Entry
+	if err := json.Unmarshal(lines[seq-1], &e); err != nil {
+		t.Fatalf("failed to parse entry: %s", err)
+	}
+	rewrite(&e)
+	lines[seq-1], _ = json.Marshal(e)
+
+	return append(bytes.Join(lines, []byte("\n")), '\n')
+}
+
+func TestLogger(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	l := audit.NewLogger(buf, dummySigner)
+
+	if err := l.Anchor(); err != nil {
+		t.Fatalf("failed to anchor: %s", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("anchor should not write if no entries: %s", buf.String())
+	}
+
+	l.Record(map[string]string{"username": "macrat", "endpoint": "authz"})
+	l.Record(map[string]string{"username": "j.smith", "endpoint": "authz"})
+	l.Anchor()
+	l.Record(map[string]string{"username": "macrat", "endpoint": "token"})
+
+	log := buf.Bytes()
+
+	result, err := audit.Verify(bytes.NewReader(log), dummyVerifier)
+	if err != nil {
+		t.Fatalf("failed to verify: %s", err)
+	}
+	if result != (audit.VerifyResult{Entries: 4, Anchors: 1, LastAnchor: 3}) {
+		t.Errorf("unexpected result: %#v", result)
+	}
+
+	tampered := rewriteEntry(t, log, 2, func(e *audit.Entry) {
+		e.Fields["username"] = "someone"
+	})
+	if _, err := audit.Verify(bytes.NewReader(tampered), dummyVerifier); err == nil {
+		t.Errorf("expected error for tampered entry but got nil")
+	}
+
+	tampered = rewriteEntry(t, log, 2, func(e *audit.Entry) {
+		e.Fields["username"] = "someone"
+		e.Hash = e.CalcHash()
+	})
+	tampered = rewriteEntry(t, tampered, 3, func(e *audit.Entry) {
+		e.PrevHash = "0000"
+		e.Hash = e.CalcHash()
+	})
+	if _, err := audit.Verify(bytes.NewReader(tampered), dummyVerifier); err == nil {
+		t.Errorf("expected error for rewritten chain but got nil")
+	}
+
+	if _, err := audit.Verify(strings.NewReader(string(log[:bytes.IndexByte(log, '\n')+1])), dummyVerifier); err != audit.NoAnchorError {
+		t.Errorf("expected NoAnchorError but got %v", err)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := audit.OpenFile(path, dummySigner)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %s", err)
+	}
+	l.Record(map[string]string{"username": "macrat"})
+	l.Anchor()
+
+	l, err = audit.OpenFile(path, dummySigner)
+	if err != nil {
+		t.Fatalf("failed to reopen audit log: %s", err)
+	}
+	l.Record(map[string]string{"username": "j.smith"})
+	l.Anchor()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %s", err)
+	}
+	defer f.Close()
+
+	result, err := audit.Verify(f, dummyVerifier)
+	if err != nil {
+		t.Fatalf("failed to verify: %s", err)
+	}
+	if result != (audit.VerifyResult{Entries: 4, Anchors: 2, LastAnchor: 4}) {
+		t.Errorf("unexpected result: %#v", result)
+	}
+}
+
+func TestLogger_MirrorTo(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	mirror := bytes.NewBuffer(nil)
+	l := audit.NewLogger(buf, dummySigner)
+
+	l.Record(map[string]string{"username": "macrat"})
+	l.MirrorTo(mirror, nil)
+	l.Record(map[string]string{"username": "j.smith"})
+	l.Anchor()
+	if n := l.Close(time.Second); n != 0 {
+		t.Errorf("unexpected dropped entries: %d", n)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected number of entries: %d", len(lines))
+	}
+	if expect := strings.Join(lines[1:], "\n") + "\n"; mirror.String() != expect {
+		t.Errorf("unexpected mirrored entries\nexpected: %s\n but got: %s", expect, mirror.String())
+	}
+}
+
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (w blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestLogger_MirrorTo_Blocking(t *testing.T) {
+	w := blockingWriter{release: make(chan struct{})}
+	l := audit.NewLogger(bytes.NewBuffer(nil), dummySigner)
+
+	var lock sync.Mutex
+	var errs []error
+	l.MirrorTo(w, func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		errs = append(errs, err)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < audit.MirrorQueueSize+10; i++ {
+			l.Record(map[string]string{"username": "macrat"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Record was blocked by the mirror")
+	}
+
+	lock.Lock()
+	if len(errs) == 0 {
+		t.Errorf("expected queue full errors but got nothing")
+	}
+	for _, err := range errs {
+		if err != audit.MirrorQueueFullError {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+	lock.Unlock()
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		close(w.release)
+	}()
+	if n := l.Close(100 * time.Millisecond); n == 0 {
+		t.Errorf("expected dropped entries because of timeout")
+	}
+}
@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// cefExtensionKeys maps fields of entries to the keys of the CEF extension dictionary.
+var cefExtensionKeys = map[string]string{
+	"remote_addr": "src",
+	"username":    "suser",
+	"method":      "requestMethod",
+	"path":        "request",
+	"error":       "reason",
+}
+
+// cefSeverity decides the severity of the event in 0-10 by the error of the request.
+func cefSeverity(e Entry) int {
+	switch e.Fields["error"] {
+	case "":
+		return 3
+	case "server_error":
+		return 7
+	default:
+		return 5
+	}
+}
+
+// FormatCEF formats the entry as ArcSight Common Event Format, for SIEMs like ArcSight or QRadar.
+//
+// The signature ID is the endpoint of the request like "authz", or "anchor" for anchors.
+// Fields that have no CEF key are put in "msg" as "key=value".
+func FormatCEF(e Entry, version string) string {
+	signature := e.Type
+	name := "Audit anchor"
+	if e.Type == TYPE_EVENT {
+		signature = e.Fields["endpoint"]
+		name = "Request to " + signature
+	}
+
+	ext := []string{}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+	addCustom := func(key, label, value string) {
+		if value != "" {
+			add(key+"Label", label)
+			add(key, value)
+		}
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, e.Time); err == nil {
+		add("rt", fmt.Sprint(t.UnixNano()/int64(time.Millisecond)))
+	}
+	addCustom("cn1", "seq", fmt.Sprint(e.Seq))
+	addCustom("cs1", "hash", e.Hash)
+
+	if e.Type == TYPE_EVENT {
+		if e.Fields["error"] == "" {
+			add("outcome", "success")
+		} else {
+			add("outcome", "failure")
+		}
+		addCustom("cs2", "client_id", e.Fields["client_id"])
+
+		var keys []string
+		for k := range e.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var others []string
+		for _, k := range keys {
+			if cefKey, ok := cefExtensionKeys[k]; ok {
+				add(cefKey, e.Fields[k])
+			} else if k != "endpoint" && k != "client_id" {
+				others = append(others, k+"="+e.Fields[k])
+			}
+		}
+		add("msg", strings.Join(others, " "))
+	}
+
+	return fmt.Sprintf(
+		"CEF:0|Lauth|Lauth|%s|%s|%s|%d|%s",
+		cefHeaderEscaper.Replace(version),
+		cefHeaderEscaper.Replace(signature),
+		cefHeaderEscaper.Replace(name),
+		cefSeverity(e),
+		strings.Join(ext, " "),
+	)
+}
@@ -0,0 +1,76 @@
+package audit_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth/audit"
+)
+
+func TestFormatCEF(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Entry  audit.Entry
+		Expect string
+	}{
+		{
+			Name: "success",
+			Entry: audit.Entry{
+				Seq:  1,
+				Time: "2021-01-02T15:04:05Z",
+				Type: audit.TYPE_EVENT,
+				Fields: map[string]string{
+					"endpoint":    "authz",
+					"method":      "POST",
+					"path":        "/authz",
+					"remote_addr": "10.2.3.4",
+					"username":    "macrat",
+					"client_id":   "some_client",
+					"scope":       "openid profile",
+				},
+				Hash: "abcd",
+			},
+			Expect: "CEF:0|Lauth|Lauth|1.2.3|authz|Request to authz|3|rt=1609599845000 cn1Label=seq cn1=1 cs1Label=hash cs1=abcd outcome=success cs2Label=client_id cs2=some_client requestMethod=POST request=/authz src=10.2.3.4 suser=macrat msg=scope\\=openid profile",
+		},
+		{
+			Name: "error",
+			Entry: audit.Entry{
+				Seq:  2,
+				Type: audit.TYPE_EVENT,
+				Fields: map[string]string{
+					"endpoint": "token|x",
+					"error":    "invalid_grant",
+					"username": "a=b\\c\nd",
+				},
+				Hash: "ef01",
+			},
+			Expect: `CEF:0|Lauth|Lauth|1.2.3|token\|x|Request to token\|x|5|cn1Label=seq cn1=2 cs1Label=hash cs1=ef01 outcome=failure reason=invalid_grant suser=a\=b\\c\nd`,
+		},
+		{
+			Name: "server-error",
+			Entry: audit.Entry{
+				Seq:    3,
+				Type:   audit.TYPE_EVENT,
+				Fields: map[string]string{"endpoint": "userinfo", "error": "server_error"},
+			},
+			Expect: "CEF:0|Lauth|Lauth|1.2.3|userinfo|Request to userinfo|7|cn1Label=seq cn1=3 outcome=failure reason=server_error",
+		},
+		{
+			Name: "anchor",
+			Entry: audit.Entry{
+				Seq:    4,
+				Type:   audit.TYPE_ANCHOR,
+				Anchor: "signed",
+				Hash:   "2345",
+			},
+			Expect: "CEF:0|Lauth|Lauth|1.2.3|anchor|Audit anchor|3|cn1Label=seq cn1=4 cs1Label=hash cs1=2345",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if got := audit.FormatCEF(tt.Entry, "1.2.3"); got != tt.Expect {
+				t.Errorf("unexpected CEF\nexpected: %s\n but got: %s", tt.Expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// MirrorQueueSize is the number of entries that each mirror can hold until written.
+	MirrorQueueSize = 1024
+)
+
+var (
+	MirrorQueueFullError = errors.New("audit mirror queue is full")
+)
+
+// mirror copies entries into the writer in the background, so a slow writer like an unreachable syslog server doesn't block Record.
+type mirror struct {
+	sync.Mutex
+
+	w       io.Writer
+	onError func(error)
+	queue   chan []byte
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+	dropped int
+}
+
+func newMirror(w io.Writer, onError func(error), queueSize int) *mirror {
+	m := &mirror{
+		w:       w,
+		onError: onError,
+		queue:   make(chan []byte, queueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+func (m *mirror) reportError(err error) {
+	if m.onError != nil {
+		m.onError(err)
+	}
+}
+
+// Write queues an entry without blocking.
+// The entry is dropped and reported to onError if the queue is full.
+func (m *mirror) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	select {
+	case m.queue <- b:
+		return len(p), nil
+	default:
+		m.reportError(MirrorQueueFullError)
+		return 0, MirrorQueueFullError
+	}
+}
+
+func (m *mirror) run() {
+	defer close(m.done)
+
+	for b := range m.queue {
+		select {
+		case <-m.stop:
+			m.dropped = 1 + len(m.queue)
+			return
+		default:
+		}
+
+		if _, err := m.w.Write(b); err != nil {
+			m.reportError(err)
+		}
+	}
+}
+
+// Close stops accepting entries, and waits until queued entries are written or timeout.
+// It returns the number of entries that dropped because of timeout.
+// It may wait longer than timeout until the current Write returns.
+func (m *mirror) Close(timeout time.Duration) int {
+	m.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.Unlock()
+
+	select {
+	case <-m.done:
+	case <-time.After(timeout):
+		close(m.stop)
+		<-m.done
+	}
+	return m.dropped
+}
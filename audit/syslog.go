@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// syslogPriority is the priority of messages, that is facility authpriv (10) and severity informational (6).
+	syslogPriority = 10*8 + 6
+
+	SyslogFormatJSON = "json"
+	SyslogFormatCEF  = "cef"
+)
+
+// Syslog sends entries to the syslog server in RFC 5424 format.
+//
+// It is an io.Writer to use with Logger.MirrorTo, and each Write should be an entry of the audit log.
+// TCP and TLS connections use octet counting framing of RFC 6587, and reconnect if the connection is broken.
+type Syslog struct {
+	sync.Mutex
+
+	network  string
+	addr     string
+	tls      *tls.Config
+	conn     net.Conn
+	format   string
+	version  string
+	hostname string
+}
+
+// DialSyslog connects to the syslog server like "udp://syslog.example.com:514", "tcp://syslog.example.com:601", or "tls://syslog.example.com:6514".
+// Format is SyslogFormatJSON or SyslogFormatCEF, and version is the version of lauth for CEF header.
+func DialSyslog(u *url.URL, format, version string) (*Syslog, error) {
+	s := &Syslog{
+		addr:    u.Host,
+		format:  format,
+		version: version,
+	}
+
+	switch u.Scheme {
+	case "udp", "tcp":
+		s.network = u.Scheme
+	case "tls":
+		s.network = "tcp"
+		s.tls = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, fmt.Errorf("unsupported syslog scheme: %#v", u.Scheme)
+	}
+
+	if u.Port() == "" {
+		port := "514"
+		if u.Scheme == "tls" {
+			port = "6514"
+		}
+		s.addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var err error
+	s.hostname, err = os.Hostname()
+	if err != nil || s.hostname == "" {
+		s.hostname = "-"
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Syslog) connect() (err error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if s.tls != nil {
+		s.conn, err = tls.DialWithDialer(dialer, s.network, s.addr, s.tls)
+	} else {
+		s.conn, err = dialer.Dial(s.network, s.addr)
+	}
+	return err
+}
+
+// Format makes a syslog message of the entry, without framing.
+func (s *Syslog) Format(e Entry) string {
+	msg := ""
+	if s.format == SyslogFormatCEF {
+		msg = FormatCEF(e, s.version)
+	} else {
+		b, _ := json.Marshal(e)
+		msg = string(b)
+	}
+
+	timestamp := e.Time
+	if timestamp == "" {
+		timestamp = "-"
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s lauth %d %s - %s", syslogPriority, timestamp, s.hostname, os.Getpid(), e.Type, msg)
+}
+
+func (s *Syslog) send(msg string) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	if s.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+func (s *Syslog) Write(p []byte) (int, error) {
+	var e Entry
+	if err := json.Unmarshal(p, &e); err != nil {
+		return 0, err
+	}
+	msg := s.Format(e)
+
+	s.Lock()
+	defer s.Unlock()
+
+	err := s.send(msg)
+	if err != nil && s.network == "tcp" {
+		// Retry once with a new connection, because the server may close idle connections.
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		err = s.send(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *Syslog) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,112 @@
+package audit_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/audit"
+)
+
+var syslogPattern = regexp.MustCompile(`^<86>1 [^ ]+ [^ ]+ lauth [0-9]+ (event|anchor) - (.*)$`)
+
+func TestSyslog_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer conn.Close()
+
+	s, err := audit.DialSyslog(&url.URL{Scheme: "udp", Host: conn.LocalAddr().String()}, audit.SyslogFormatCEF, "1.2.3")
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	defer s.Close()
+
+	l := audit.NewLogger(bytes.NewBuffer(nil), dummySigner)
+	l.MirrorTo(s, nil)
+	l.Record(map[string]string{"endpoint": "authz", "username": "macrat"})
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to receive: %s", err)
+	}
+
+	m := syslogPattern.FindStringSubmatch(string(buf[:n]))
+	if m == nil {
+		t.Fatalf("unexpected syslog message: %s", buf[:n])
+	}
+	if m[1] != "event" || !strings.HasPrefix(m[2], "CEF:0|Lauth|Lauth|1.2.3|authz|") || !strings.Contains(m[2], "suser=macrat") {
+		t.Errorf("unexpected syslog message: %s", buf[:n])
+	}
+}
+
+func TestSyslog_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					var length int
+					if _, err := fmt.Fscanf(r, "%d ", &length); err != nil {
+						return
+					}
+					msg := make([]byte, length)
+					if _, err := r.Read(msg); err != nil {
+						return
+					}
+					received <- string(msg)
+				}
+			}()
+		}
+	}()
+
+	s, err := audit.DialSyslog(&url.URL{Scheme: "tcp", Host: ln.Addr().String()}, audit.SyslogFormatJSON, "1.2.3")
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	defer s.Close()
+
+	l := audit.NewLogger(bytes.NewBuffer(nil), dummySigner)
+	l.MirrorTo(s, nil)
+	l.Record(map[string]string{"endpoint": "authz"})
+	l.Anchor()
+
+	for _, typ := range []string{"event", "anchor"} {
+		select {
+		case msg := <-received:
+			m := syslogPattern.FindStringSubmatch(msg)
+			if m == nil || m[1] != typ || !strings.HasPrefix(m[2], `{"seq":`) {
+				t.Errorf("unexpected syslog message: %s", msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout to receive %s", typ)
+		}
+	}
+}
+
+func TestDialSyslog_UnsupportedScheme(t *testing.T) {
+	if _, err := audit.DialSyslog(&url.URL{Scheme: "http", Host: "localhost"}, audit.SyslogFormatJSON, "1.2.3"); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
@@ -0,0 +1,201 @@
+// Package backchannel keeps the requests of Client-Initiated Backchannel Authentication (CIBA) until the user approves them and the client receives the result.
+package backchannel
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	NotFoundError = errors.New("backchannel authentication request is not found")
+	PendingError  = errors.New("user hasn't approved the request yet")
+	SlowDownError = errors.New("client polls too frequently")
+	DeniedError   = errors.New("user denied the request")
+	ExpiredError  = errors.New("backchannel authentication request is expired")
+)
+
+// SlowDownStep is the amount to increase the polling interval when the client polls too frequently, as defined in the CIBA spec.
+const SlowDownStep = 5 * time.Second
+
+type Status int
+
+const (
+	Pending Status = iota
+	Approved
+	Denied
+)
+
+// Request is a backchannel authentication request.
+type Request struct {
+	// ID is the auth_req_id that the client polls the result with.
+	ID string
+
+	// ApprovalKey is the key of the approval link that sent to the user.
+	// It is different from ID, so the user's mailbox doesn't have the ID.
+	ApprovalKey string
+
+	ClientID       string
+	Subject        string
+	Scope          string
+	BindingMessage string
+	ExpiresAt      time.Time
+	Interval       time.Duration
+
+	Status   Status
+	AuthTime time.Time
+
+	lastPoll time.Time
+}
+
+// Store keeps requests on memory of the process.
+type Store struct {
+	sync.Mutex
+
+	requests map[string]*Request
+	keys     map[string]string
+}
+
+// NewStore makes a new empty Store.
+func NewStore() *Store {
+	return &Store{
+		requests: make(map[string]*Request),
+		keys:     make(map[string]string),
+	}
+}
+
+func randomID() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (s *Store) remove(r *Request) {
+	delete(s.requests, r.ID)
+	delete(s.keys, r.ApprovalKey)
+}
+
+// compact removes expired requests.
+func (s *Store) compact(now time.Time) {
+	for _, r := range s.requests {
+		if !r.ExpiresAt.After(now) {
+			s.remove(r)
+		}
+	}
+}
+
+// Add stores req as a pending request, and returns it with new random ID and ApprovalKey.
+func (s *Store) Add(req Request, now time.Time) (Request, error) {
+	var err error
+	if req.ID, err = randomID(); err != nil {
+		return Request{}, err
+	}
+	if req.ApprovalKey, err = randomID(); err != nil {
+		return Request{}, err
+	}
+	req.Status = Pending
+	req.lastPoll = time.Time{}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.compact(now)
+
+	s.requests[req.ID] = &req
+	s.keys[req.ApprovalKey] = req.ID
+
+	return req, nil
+}
+
+func (s *Store) findPending(key string, now time.Time) (*Request, error) {
+	id, ok := s.keys[key]
+	if !ok {
+		return nil, NotFoundError
+	}
+	r := s.requests[id]
+	if !r.ExpiresAt.After(now) {
+		return nil, ExpiredError
+	}
+	if r.Status != Pending {
+		return nil, NotFoundError
+	}
+	return r, nil
+}
+
+// Find returns the pending request of the approval key.
+func (s *Store) Find(key string, now time.Time) (Request, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	r, err := s.findPending(key, now)
+	if err != nil {
+		return Request{}, err
+	}
+	return *r, nil
+}
+
+// Approve marks the pending request of the approval key as approved by the user.
+func (s *Store) Approve(key string, authTime time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	r, err := s.findPending(key, authTime)
+	if err != nil {
+		return err
+	}
+	r.Status = Approved
+	r.AuthTime = authTime
+	return nil
+}
+
+// Deny marks the pending request of the approval key as denied by the user.
+func (s *Store) Deny(key string, now time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	r, err := s.findPending(key, now)
+	if err != nil {
+		return err
+	}
+	r.Status = Denied
+	return nil
+}
+
+// Poll returns the approved request of the auth_req_id for the client.
+//
+// The approved or denied request is removed, so the result can be received only once.
+// It returns PendingError if the user hasn't decided yet, or SlowDownError and increases the interval if the client polls faster than the interval.
+func (s *Store) Poll(id, clientID string, now time.Time) (Request, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	r, ok := s.requests[id]
+	if !ok || r.ClientID != clientID {
+		return Request{}, NotFoundError
+	}
+	if !r.ExpiresAt.After(now) {
+		s.remove(r)
+		return Request{}, ExpiredError
+	}
+
+	switch r.Status {
+	case Approved:
+		s.remove(r)
+		return *r, nil
+	case Denied:
+		s.remove(r)
+		return Request{}, DeniedError
+	}
+
+	last := r.lastPoll
+	r.lastPoll = now
+	if !last.IsZero() && now.Sub(last) < r.Interval {
+		r.Interval += SlowDownStep
+		return Request{}, SlowDownError
+	}
+	return Request{}, PendingError
+}
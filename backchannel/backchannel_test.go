@@ -0,0 +1,121 @@
+package backchannel_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/backchannel"
+)
+
+func TestStore(t *testing.T) {
+	s := backchannel.NewStore()
+	now := time.Now()
+
+	req, err := s.Add(backchannel.Request{
+		ClientID:  "some_client_id",
+		Subject:   "macrat",
+		Scope:     "openid",
+		ExpiresAt: now.Add(5 * time.Minute),
+		Interval:  5 * time.Second,
+	}, now)
+	if err != nil {
+		t.Fatalf("failed to add request: %s", err)
+	}
+	if req.ID == "" || req.ApprovalKey == "" || req.ID == req.ApprovalKey {
+		t.Fatalf("unexpected ID and approval key: %#v", req)
+	}
+
+	if _, err := s.Poll(req.ID, "another_client", now); err != backchannel.NotFoundError {
+		t.Errorf("another client should not poll the request: %v", err)
+	}
+	if _, err := s.Poll(req.ApprovalKey, "some_client_id", now); err != backchannel.NotFoundError {
+		t.Errorf("approval key should not be usable as auth_req_id: %v", err)
+	}
+
+	if _, err := s.Poll(req.ID, "some_client_id", now); err != backchannel.PendingError {
+		t.Errorf("expected pending but got %v", err)
+	}
+	if _, err := s.Poll(req.ID, "some_client_id", now.Add(time.Second)); err != backchannel.SlowDownError {
+		t.Errorf("expected slow down but got %v", err)
+	}
+	if _, err := s.Poll(req.ID, "some_client_id", now.Add(7*time.Second)); err != backchannel.SlowDownError {
+		t.Errorf("interval should be increased after slow down: %v", err)
+	}
+	if _, err := s.Poll(req.ID, "some_client_id", now.Add(30*time.Second)); err != backchannel.PendingError {
+		t.Errorf("expected pending but got %v", err)
+	}
+
+	if found, err := s.Find(req.ApprovalKey, now); err != nil || found.Subject != "macrat" {
+		t.Errorf("failed to find request: %#v %v", found, err)
+	}
+	if _, err := s.Find(req.ID, now); err != backchannel.NotFoundError {
+		t.Errorf("auth_req_id should not be usable as approval key: %v", err)
+	}
+
+	authTime := now.Add(time.Minute)
+	if err := s.Approve(req.ApprovalKey, authTime); err != nil {
+		t.Fatalf("failed to approve: %s", err)
+	}
+	if err := s.Deny(req.ApprovalKey, authTime); err != backchannel.NotFoundError {
+		t.Errorf("approved request should not be denied: %v", err)
+	}
+
+	got, err := s.Poll(req.ID, "some_client_id", authTime)
+	if err != nil {
+		t.Fatalf("failed to poll approved request: %s", err)
+	}
+	if got.Subject != "macrat" || got.Scope != "openid" || !got.AuthTime.Equal(authTime) {
+		t.Errorf("unexpected request: %#v", got)
+	}
+
+	if _, err := s.Poll(req.ID, "some_client_id", authTime); err != backchannel.NotFoundError {
+		t.Errorf("approved request should be received only once: %v", err)
+	}
+}
+
+func TestStore_Deny(t *testing.T) {
+	s := backchannel.NewStore()
+	now := time.Now()
+
+	req, err := s.Add(backchannel.Request{ClientID: "some_client_id", Subject: "macrat", ExpiresAt: now.Add(time.Minute)}, now)
+	if err != nil {
+		t.Fatalf("failed to add request: %s", err)
+	}
+
+	if err := s.Deny(req.ApprovalKey, now); err != nil {
+		t.Fatalf("failed to deny: %s", err)
+	}
+	if err := s.Approve(req.ApprovalKey, now); err != backchannel.NotFoundError {
+		t.Errorf("denied request should not be approved: %v", err)
+	}
+	if _, err := s.Poll(req.ID, "some_client_id", now); err != backchannel.DeniedError {
+		t.Errorf("expected denied but got %v", err)
+	}
+	if _, err := s.Poll(req.ID, "some_client_id", now); err != backchannel.NotFoundError {
+		t.Errorf("denied request should be removed: %v", err)
+	}
+}
+
+func TestStore_Expire(t *testing.T) {
+	s := backchannel.NewStore()
+	now := time.Now()
+
+	req, err := s.Add(backchannel.Request{ClientID: "some_client_id", Subject: "macrat", ExpiresAt: now.Add(time.Minute)}, now)
+	if err != nil {
+		t.Fatalf("failed to add request: %s", err)
+	}
+
+	later := now.Add(2 * time.Minute)
+	if _, err := s.Find(req.ApprovalKey, later); err != backchannel.ExpiredError {
+		t.Errorf("expected expired but got %v", err)
+	}
+	if err := s.Approve(req.ApprovalKey, later); err != backchannel.ExpiredError {
+		t.Errorf("expired request should not be approved: %v", err)
+	}
+	if _, err := s.Poll(req.ID, "some_client_id", later); err != backchannel.ExpiredError {
+		t.Errorf("expected expired but got %v", err)
+	}
+	if _, err := s.Poll(req.ID, "some_client_id", later); err != backchannel.NotFoundError {
+		t.Errorf("expired request should be removed: %v", err)
+	}
+}
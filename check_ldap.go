@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkLDAPConfigFiles []string
+	checkLDAPCmd         = &cobra.Command{
+		Use:   "check-ldap",
+		Short: "Check that LDAP attributes in the config are defined in the schema and readable, and the bind account is not over-privileged",
+		Long: "Check that the ID attribute, the groups attribute, and the attributes of claims are defined in the schema of the LDAP server, and the bind account can read them.\n" +
+			"It also checks that the bind account is not a member of administrative groups, and can't modify users unless registration or invitation is enabled.\n" +
+			"Options are loaded from the config files and LAUTH_* environment variables, in the same way as the server.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var conf config.Config
+			if err := conf.LoadFiles(checkLDAPConfigFiles, cmd.Root().Flags()); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load config: %s\n", err)
+				os.Exit(1)
+			}
+			if err := conf.Validate(); err != nil {
+				fmt.Fprintf(os.Stderr, "invalid config: %s\n", err)
+				os.Exit(1)
+			}
+
+			connector := ldap.SimpleConnector{Config: &conf.LDAP}
+
+			n, err := CheckLDAP(os.Stdout, connector, &conf)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to check LDAP: %s\n", err)
+				os.Exit(1)
+			}
+
+			m, err := CheckLDAPPrivileges(os.Stdout, connector, &conf)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to check privileges of the bind account: %s\n", err)
+				os.Exit(1)
+			}
+			n += m
+			if n > 0 {
+				fmt.Fprintf(os.Stderr, "%d problems found\n", n)
+				os.Exit(1)
+			}
+			fmt.Println("OK: no problems found")
+		},
+	}
+)
+
+func init() {
+	cmd.AddCommand(checkLDAPCmd)
+
+	flags := checkLDAPCmd.Flags()
+	flags.StringArrayVarP(&checkLDAPConfigFiles, "config", "c", nil, "Load options from TOML, YAML, or JSON file. Multiple files are merged in order.")
+}
+
+// CheckLDAP writes problems of LDAP attributes that referred in the config to w, and returns the number of them.
+// It does nothing if the connector doesn't support to inspect the schema.
+func CheckLDAP(w io.Writer, connector ldap.Connector, conf *config.Config) (int, error) {
+	conn, err := connector.Connect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	prober, ok := conn.(ldap.SchemaProber)
+	if !ok {
+		return 0, nil
+	}
+
+	problems, err := ldap.ProbeSchema(prober, conf.LDAPAttributes())
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	return len(problems), err
+}
+
+// CheckLDAPPrivileges writes problems of privileges of the bind account to w, and returns the number of them.
+// It does nothing if the connector doesn't support to inspect privileges.
+func CheckLDAPPrivileges(w io.Writer, connector ldap.Connector, conf *config.Config) (int, error) {
+	conn, err := connector.Connect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	prober, ok := conn.(ldap.PrivilegeProber)
+	if !ok {
+		return 0, nil
+	}
+
+	problems, err := ldap.ProbePrivileges(prober, conf.Register.Enable || conf.Admin.Enabled())
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	return len(problems), err
+}
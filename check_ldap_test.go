@@ -0,0 +1,81 @@
+package main_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestCheckLDAP(t *testing.T) {
+	conf := &config.Config{
+		LDAP: config.LDAPConfig{IDAttribute: "mail"},
+		Scopes: config.ScopeConfig{
+			"profile": {
+				{Claim: "name", Attribute: "displayName"},
+				{Claim: "picture", Attribute: "jpegPhoto"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	n, err := main.CheckLDAP(&buf, testutil.LDAP, conf)
+	if err != nil {
+		t.Fatalf("failed to check LDAP: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 problem but got %d:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), `Attribute "jpegPhoto" for claim "picture" of scope "profile" is not defined`) {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+
+	conf.Scopes["profile"] = conf.Scopes["profile"][:1]
+	buf.Reset()
+	if n, err := main.CheckLDAP(&buf, testutil.LDAP, conf); err != nil || n != 0 {
+		t.Errorf("expected no problem but got %d, %v:\n%s", n, err, buf.String())
+	}
+}
+
+type PrivilegedLDAP struct {
+	testutil.DummyLDAP
+}
+
+func (c PrivilegedLDAP) Connect() (ldap.Session, error) {
+	return c, nil
+}
+
+func (c PrivilegedLDAP) BindPrivileges() (ldap.Privileges, error) {
+	return ldap.Privileges{
+		Account:  "CN=lauth,DC=example,DC=com",
+		Writable: []string{"DC=example,DC=com"},
+	}, nil
+}
+
+func TestCheckLDAPPrivileges(t *testing.T) {
+	conf := &config.Config{}
+
+	var buf bytes.Buffer
+	n, err := main.CheckLDAPPrivileges(&buf, PrivilegedLDAP{testutil.LDAP}, conf)
+	if err != nil {
+		t.Fatalf("failed to check privileges: %s", err)
+	}
+	if n != 1 || !strings.Contains(buf.String(), `can modify "DC=example,DC=com"`) {
+		t.Errorf("unexpected result: %d\n%s", n, buf.String())
+	}
+
+	conf.Register.Enable = true
+	buf.Reset()
+	if n, err := main.CheckLDAPPrivileges(&buf, PrivilegedLDAP{testutil.LDAP}, conf); err != nil || n != 0 {
+		t.Errorf("write privilege should be allowed if registration is enabled but got %d, %v:\n%s", n, err, buf.String())
+	}
+
+	buf.Reset()
+	if n, err := main.CheckLDAPPrivileges(&buf, testutil.LDAP, conf); err != nil || n != 0 {
+		t.Errorf("expected no problem for connector that doesn't support privileges but got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/page"
+	"github.com/spf13/cobra"
+)
+
+type CheckTemplatesConfig struct {
+	ConfigFiles []string
+	Template    config.TemplateConfig
+}
+
+var (
+	checkTemplatesConfig = CheckTemplatesConfig{}
+	checkTemplatesCmd    = &cobra.Command{
+		Use:   "check-templates",
+		Short: "Render page templates with sample data and check accessibility",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			tconf, err := checkTemplatesConfig.Load()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load config: %s\n", err)
+				os.Exit(1)
+			}
+
+			n, err := CheckTemplates(os.Stdout, tconf)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to render templates: %s\n", err)
+				os.Exit(1)
+			}
+			if n > 0 {
+				fmt.Fprintf(os.Stderr, "%d problems found\n", n)
+				os.Exit(1)
+			}
+
+			fmt.Println("OK: no problems found")
+		},
+	}
+)
+
+func init() {
+	cmd.AddCommand(checkTemplatesCmd)
+
+	flags := checkTemplatesCmd.Flags()
+	flags.SortFlags = false
+
+	flags.StringArrayVarP(&checkTemplatesConfig.ConfigFiles, "config", "c", nil, "Load template options from TOML, YAML, or JSON file. Multiple files are merged in order.")
+	flags.StringVar(&checkTemplatesConfig.Template.LoginPage, "login-page", "", "Template file for login page.")
+	flags.StringVar(&checkTemplatesConfig.Template.LogoutPage, "logout-page", "", "Template file for logged out page.")
+	flags.StringVar(&checkTemplatesConfig.Template.ErrorPage, "error-page", "", "Template file for error page.")
+	flags.StringVar(&checkTemplatesConfig.Template.Language, "page-language", "", "Language of messages by t function in the pages.")
+	flags.StringVar(&checkTemplatesConfig.Template.AssetURL, "asset-url", "", "Base URL of static assets for asset function in the pages.")
+}
+
+// Load reads template options from the config file, and overrides them by the flags.
+func (c CheckTemplatesConfig) Load() (config.TemplateConfig, error) {
+	var conf config.Config
+	if err := conf.LoadFiles(c.ConfigFiles, nil); err != nil {
+		return config.TemplateConfig{}, err
+	}
+
+	t := conf.Templates
+	for _, x := range []struct {
+		From string
+		To   *string
+	}{
+		{c.Template.LoginPage, &t.LoginPage},
+		{c.Template.LogoutPage, &t.LogoutPage},
+		{c.Template.ErrorPage, &t.ErrorPage},
+		{c.Template.Language, &t.Language},
+		{c.Template.AssetURL, &t.AssetURL},
+	} {
+		if x.From != "" {
+			*x.To = x.From
+		}
+	}
+
+	return t, nil
+}
+
+// CheckTemplates writes problems of the templates in each language to w, and returns the number of them.
+func CheckTemplates(w io.Writer, conf config.TemplateConfig) (int, error) {
+	renderer, err := page.NewRenderer(conf)
+	if err != nil {
+		return 0, err
+	}
+
+	langs := conf.Languages()
+
+	n := 0
+	for _, lang := range langs {
+		problems, err := page.Audit(renderer.Languages[lang])
+		if err != nil {
+			return 0, err
+		}
+
+		for _, p := range problems {
+			if len(langs) > 1 {
+				fmt.Fprintf(w, "[%s] %s\n", lang, p)
+			} else {
+				fmt.Fprintln(w, p)
+			}
+		}
+		n += len(problems)
+	}
+	return n, nil
+}
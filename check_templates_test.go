@@ -0,0 +1,58 @@
+package main_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/macrat/lauth"
+	"github.com/macrat/lauth/config"
+)
+
+func TestCheckTemplates(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := main.CheckTemplates(&buf, config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("failed to check built-in templates: %s", err)
+	}
+	if n != 0 {
+		t.Errorf("built-in templates have problems:\n%s", buf.String())
+	}
+
+	page := filepath.Join(t.TempDir(), "logout.tmpl")
+	if err := os.WriteFile(page, []byte(`<html><title>bye</title><img src="bye.png" /></html>`), 0600); err != nil {
+		t.Fatalf("failed to write template: %s", err)
+	}
+
+	buf.Reset()
+	n, err = main.CheckTemplates(&buf, config.TemplateConfig{LogoutPage: page})
+	if err != nil {
+		t.Fatalf("failed to check custom template: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 problems but got %d", n)
+	}
+	if expect := "logout.tmpl: <html> has no lang attribute\nlogout.tmpl: <img> has no alt attribute\n"; buf.String() != expect {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestCheckTemplates_Languages(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "logout.tmpl")
+	if err := os.WriteFile(page, []byte(`<html lang="{{ .locale }}"><title>{{ t "logged_out" }}</title><img src="bye.png" /></html>`), 0600); err != nil {
+		t.Fatalf("failed to write template: %s", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := main.CheckTemplates(&buf, config.TemplateConfig{Language: "en,ja", LogoutPage: page})
+	if err != nil {
+		t.Fatalf("failed to check templates: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 problems but got %d", n)
+	}
+	if expect := "[en] logout.tmpl: <img> has no alt attribute\n[ja] logout.tmpl: <img> has no alt attribute\n"; buf.String() != expect {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
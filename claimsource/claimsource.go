@@ -0,0 +1,103 @@
+// Package claimsource fetches additional attributes of users from external systems like HR databases, to enrich claims in addition to LDAP.
+package claimsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SubjectPlaceholder is replaced with the escaped subject in the URL of HTTPSource.
+const SubjectPlaceholder = "{subject}"
+
+// HTTPSource gets attributes of a user as a JSON object from a REST endpoint.
+//
+// The response must be an object like `{"costCenter": "CC-1234", "licenses": ["e3", "visio"]}`.
+// Strings, numbers, booleans, and arrays of them are accepted, and other values are ignored.
+// The status code 404 means the user has no attributes in the source.
+type HTTPSource struct {
+	URL     string
+	Timeout time.Duration
+	Headers map[string]string
+}
+
+// escape escapes the subject so it is safe in both of path and query.
+func escape(subject string) string {
+	return strings.ReplaceAll(url.QueryEscape(subject), "+", "%20")
+}
+
+// Fetch gets values of the attributes of the subject.
+// Attributes that not listed in attributes are dropped, so the source can't overwrite unexpected attributes.
+func (s HTTPSource) Fetch(ctx context.Context, subject string, attributes []string) (map[string][]string, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.ReplaceAll(s.URL, SubjectPlaceholder, escape(subject)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string][]string{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("claim source responded status code %d", resp.StatusCode)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]string)
+	for _, attr := range attributes {
+		if values := toStrings(body[attr]); len(values) > 0 {
+			result[attr] = values
+		}
+	}
+	return result, nil
+}
+
+func toString(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case float64, bool:
+		return fmt.Sprint(x), true
+	default:
+		return "", false
+	}
+}
+
+func toStrings(v interface{}) []string {
+	if xs, ok := v.([]interface{}); ok {
+		var result []string
+		for _, x := range xs {
+			if s, ok := toString(x); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	if s, ok := toString(v); ok {
+		return []string{s}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package claimsource_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/claimsource"
+)
+
+func TestHTTPSource(t *testing.T) {
+	var requested string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.EscapedPath()
+		switch r.URL.Path {
+		case "/users/macrat":
+			w.Write([]byte(`{"costCenter": "CC-1234", "level": 3, "manager": true, "licenses": ["e3", "visio", {"x": 1}], "extra": "ignored", "empty": null}`))
+		case "/users/broken":
+			w.Write([]byte(`["not", "object"]`))
+		case "/users/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	src := claimsource.HTTPSource{URL: server.URL + "/users/{subject}"}
+	attributes := []string{"costCenter", "level", "manager", "licenses", "empty"}
+
+	tests := []struct {
+		Subject string
+		Path    string
+		Result  map[string][]string
+		Error   bool
+	}{
+		{"macrat", "/users/macrat", map[string][]string{
+			"costCenter": {"CC-1234"},
+			"level":      {"3"},
+			"manager":    {"true"},
+			"licenses":   {"e3", "visio"},
+		}, false},
+		{"j smith/x", "/users/j%20smith%2Fx", map[string][]string{}, false},
+		{"broken", "/users/broken", nil, true},
+		{"error", "/users/error", nil, true},
+	}
+
+	for _, tt := range tests {
+		result, err := src.Fetch(context.Background(), tt.Subject, attributes)
+		if requested != tt.Path {
+			t.Errorf("%s: unexpected request path: %s", tt.Subject, requested)
+		}
+		if (err != nil) != tt.Error {
+			t.Errorf("%s: unexpected error: %v", tt.Subject, err)
+		}
+		if !tt.Error && !reflect.DeepEqual(result, tt.Result) {
+			t.Errorf("%s: unexpected result: %#v", tt.Subject, result)
+		}
+	}
+}
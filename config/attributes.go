@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AttributeUsage is an LDAP attribute and the option that refers it, for reporting problems about the attribute.
+type AttributeUsage struct {
+	Attribute string
+	UsedBy    string
+}
+
+// usesGroups checks if the groups attribute is read, for authorization policy or role mapping.
+func (c *Config) usesGroups() bool {
+	if c.Policy.URL.String() != "" || c.Policy.RegoDir != "" {
+		return true
+	}
+	for _, client := range c.Clients {
+		if len(client.Roles) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// providedBySource checks if any claim source provides the attribute, so it may not be in LDAP.
+func (c *Config) providedBySource(attribute string) bool {
+	for _, s := range c.ClaimSources {
+		if s.Provides(attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+// LDAPAttributes returns LDAP attributes that the config refers.
+// The attributes that provided by claim sources are not included.
+func (c *Config) LDAPAttributes() []AttributeUsage {
+	attrs := []AttributeUsage{
+		{c.LDAP.IDAttribute, "--ldap-id-attribute"},
+	}
+
+	if c.usesGroups() {
+		attrs = append(attrs, AttributeUsage{c.Policy.GroupsAttribute, "--policy-groups-attribute"})
+	}
+
+	scopes := c.Scopes.ScopeNames()
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		for _, claim := range c.Scopes[scope] {
+			for _, attr := range claim.Attributes() {
+				if c.providedBySource(attr) {
+					continue
+				}
+				attrs = append(attrs, AttributeUsage{attr, fmt.Sprintf("claim %#v of scope %#v", claim.Claim, scope)})
+			}
+		}
+	}
+
+	return attrs
+}
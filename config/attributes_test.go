@@ -0,0 +1,44 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestConfig_LDAPAttributes(t *testing.T) {
+	conf := &config.Config{
+		LDAP:   config.LDAPConfig{IDAttribute: "sAMAccountName"},
+		Policy: config.PolicyConfig{GroupsAttribute: "memberOf"},
+		Scopes: config.ScopeConfig{
+			"profile": {
+				{Claim: "name", Attribute: "displayName"},
+				{Claim: "preferred_username", Template: "{{ .uid }}@example.com"},
+			},
+			"email": {
+				{Claim: "email", Attribute: "mail"},
+			},
+		},
+	}
+
+	expect := []config.AttributeUsage{
+		{Attribute: "sAMAccountName", UsedBy: "--ldap-id-attribute"},
+		{Attribute: "mail", UsedBy: `claim "email" of scope "email"`},
+		{Attribute: "displayName", UsedBy: `claim "name" of scope "profile"`},
+		{Attribute: "uid", UsedBy: `claim "preferred_username" of scope "profile"`},
+	}
+	if attrs := conf.LDAPAttributes(); !reflect.DeepEqual(attrs, expect) {
+		t.Errorf("unexpected attributes:\n%#v", attrs)
+	}
+
+	conf.Policy.RegoDir = "/path/to/policies"
+	if attrs := conf.LDAPAttributes(); len(attrs) != 5 || attrs[1] != (config.AttributeUsage{Attribute: "memberOf", UsedBy: "--policy-groups-attribute"}) {
+		t.Errorf("groups attribute should be included if policy is enabled:\n%#v", attrs)
+	}
+
+	conf.ClaimSources = []config.ClaimSourceConfig{{Name: "hr", Attributes: []string{"Mail"}}}
+	if attrs := conf.LDAPAttributes(); len(attrs) != 4 || attrs[2].Attribute != "displayName" {
+		t.Errorf("attributes from claim sources should not be included:\n%#v", attrs)
+	}
+}
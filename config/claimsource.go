@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	PrecedenceSource = "source"
+	PrecedenceLDAP   = "ldap"
+)
+
+// ClaimSourceConfig is an external REST endpoint that provides attributes of users, in addition to LDAP.
+type ClaimSourceConfig struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	URL  string `json:"url"  yaml:"url"  toml:"url"`
+
+	// Attributes are the attributes that taken from this source. Others in the response are ignored.
+	Attributes []string `json:"attributes" yaml:"attributes" toml:"attributes"`
+
+	// Precedence is which value wins if both of LDAP and this source have the attribute. "source" or "ldap". The default is "source".
+	Precedence string `json:"precedence,omitempty" yaml:"precedence,omitempty" toml:"precedence,omitempty"`
+
+	// Required makes userinfo and token requests fail if this source is unavailable. If false, claims are made without this source.
+	Required bool `json:"required,omitempty" yaml:"required,omitempty" toml:"required,omitempty"`
+
+	Timeout Duration          `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty" toml:"headers,omitempty"`
+}
+
+// Provides checks if this source provides the attribute.
+func (c ClaimSourceConfig) Provides(attribute string) bool {
+	for _, a := range c.Attributes {
+		if strings.EqualFold(a, attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge merges values from this source into attrs, following to the Precedence.
+func (c ClaimSourceConfig) Merge(attrs, values map[string][]string) {
+	for _, name := range c.Attributes {
+		v := values[name]
+		if len(v) == 0 {
+			continue
+		}
+		if c.Precedence == PrecedenceLDAP && len(attrs[name]) > 0 {
+			continue
+		}
+		attrs[name] = v
+	}
+}
+
+func (c *Config) claimSourceErrors() []error {
+	var es []error
+
+	names := make(map[string]bool)
+	for i, s := range c.ClaimSources {
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprint(i)
+			es = append(es, fmt.Errorf("claim_source.%s.name: Name is required.", name))
+		} else if names[name] {
+			es = append(es, fmt.Errorf("claim_source.%s.name: Name %#v is duplicated.", name, name))
+		}
+		names[name] = true
+
+		if u, err := url.Parse(s.URL); err != nil || !u.IsAbs() {
+			es = append(es, fmt.Errorf("claim_source.%s.url: URL must be absolute URL.", name))
+		} else if !strings.Contains(s.URL, "{subject}") {
+			es = append(es, fmt.Errorf("claim_source.%s.url: URL must include {subject}.", name))
+		}
+		if len(s.Attributes) == 0 {
+			es = append(es, fmt.Errorf("claim_source.%s.attributes: At least one attribute is required.", name))
+		}
+		if s.Precedence != "" && s.Precedence != PrecedenceSource && s.Precedence != PrecedenceLDAP {
+			es = append(es, fmt.Errorf("claim_source.%s.precedence: Precedence must be %#v or %#v but got %#v.", name, PrecedenceSource, PrecedenceLDAP, s.Precedence))
+		}
+		if s.Timeout < 0 {
+			es = append(es, fmt.Errorf("claim_source.%s.timeout: Timeout can't set less than 0.", name))
+		}
+	}
+
+	return es
+}
@@ -6,17 +6,38 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
-	"path"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"time"
 
+	"github.com/macrat/lauth/audit"
+	"github.com/macrat/lauth/feature"
+	"github.com/macrat/lauth/secret"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	// ProfileOAuth21 is the profile name to comply with OAuth 2.1 strictly.
+	ProfileOAuth21 = "oauth2.1"
 )
 
 var (
+	DefaultRegistrationAttributes = map[string][]string{
+		"objectClass": {"top", "person", "organizationalPerson", "inetOrgPerson"},
+		"cn":          {"{{ .GivenName }} {{ .FamilyName }}"},
+		"sn":          {"{{ .FamilyName }}"},
+		"givenName":   {"{{ .GivenName }}"},
+		"mail":        {"{{ .Email }}"},
+	}
+
 	DefaultScopes = ScopeConfig{
 		"profile": []ClaimConfig{
 			{Claim: "name", Attribute: "displayName", Type: "string"},
@@ -36,9 +57,20 @@ var (
 )
 
 type ClaimConfig struct {
-	Claim     string    `json:"claim"          yaml:"claim"          toml:"claim"`
-	Attribute string    `json:"attribute"      yaml:"attribute"      toml:"attribute"`
-	Type      ClaimType `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	Claim     string    `json:"claim"              yaml:"claim"              toml:"claim"`
+	Attribute string    `json:"attribute"          yaml:"attribute"          toml:"attribute"`
+	Type      ClaimType `json:"type,omitempty"     yaml:"type,omitempty"     toml:"type,omitempty"`
+	Template  string    `json:"template,omitempty" yaml:"template,omitempty" toml:"template,omitempty"`
+	Regex     string    `json:"regex,omitempty"    yaml:"regex,omitempty"    toml:"regex,omitempty"`
+	Case      string    `json:"case,omitempty"     yaml:"case,omitempty"     toml:"case,omitempty"`
+	Join      string    `json:"join,omitempty"     yaml:"join,omitempty"     toml:"join,omitempty"`
+
+	ExtraAttributes []string `json:"extra_attributes,omitempty" yaml:"extra_attributes,omitempty" toml:"extra_attributes,omitempty"`
+
+	RDN        bool     `json:"rdn,omitempty"         yaml:"rdn,omitempty"         toml:"rdn,omitempty"`
+	TrimPrefix string   `json:"trim_prefix,omitempty" yaml:"trim_prefix,omitempty" toml:"trim_prefix,omitempty"`
+	TrimSuffix string   `json:"trim_suffix,omitempty" yaml:"trim_suffix,omitempty" toml:"trim_suffix,omitempty"`
+	Include    []string `json:"include,omitempty"     yaml:"include,omitempty"     toml:"include,omitempty"`
 }
 
 type ScopeConfig map[string][]ClaimConfig
@@ -49,6 +81,11 @@ type EndpointConfig struct {
 	Userinfo string `json:"userinfo"      yaml:"userinfo"      toml:"userinfo"      flag:"userinfo-endpoint"`
 	Jwks     string `json:"jwks"          yaml:"jwks"          toml:"jwks"          flag:"jwks-uri"`
 	Logout   string `json:"logout"        yaml:"logout"        toml:"logout"        flag:"logout-endpoint"`
+	Register string `json:"register"      yaml:"register"      toml:"register"      flag:"register-endpoint"`
+	Invite   string `json:"invite"        yaml:"invite"        toml:"invite"        flag:"invite-endpoint"`
+	QRCode   string `json:"qrcode"        yaml:"qrcode"        toml:"qrcode"        flag:"qrcode-endpoint"`
+
+	Backchannel string `json:"backchannel,omitempty" yaml:"backchannel,omitempty" toml:"backchannel,omitempty" flag:"backchannel-endpoint"`
 }
 
 type ExpireConfig struct {
@@ -57,6 +94,11 @@ type ExpireConfig struct {
 	Token   Duration `json:"token"   yaml:"token"   toml:"token"   flag:"token-expire"`
 	Refresh Duration `json:"refresh" yaml:"refresh" toml:"refresh" flag:"refresh-expire"`
 	SSO     Duration `json:"sso"     yaml:"sso"     toml:"sso"     flag:"sso-expire"`
+
+	Invitation  Duration `json:"invitation,omitempty"  yaml:"invitation,omitempty"  toml:"invitation,omitempty"  flag:"invitation-expire"`
+	Backchannel Duration `json:"backchannel,omitempty" yaml:"backchannel,omitempty" toml:"backchannel,omitempty" flag:"backchannel-expire"`
+
+	AllowLong bool `json:"allow_long,omitempty" yaml:"allow_long,omitempty" toml:"allow_long,omitempty" flag:"allow-long-expire"`
 }
 
 type ClientConfig struct {
@@ -67,6 +109,89 @@ type ClientConfig struct {
 	CORSOrigin        PatternSet `json:"cors_origin"         yaml:"cors_origin"         toml:"cors_origin"`
 	AllowImplicitFlow bool       `json:"allow_implicit_flow" yaml:"allow_implicit_flow" toml:"allow_implicit_flow"`
 	RequestKey        string     `json:"request_key"         yaml:"request_key"         toml:"request_key"`
+	RedirectURIMatch  string     `json:"redirect_uri_match,omitempty" yaml:"redirect_uri_match,omitempty" toml:"redirect_uri_match,omitempty"`
+	RequirePKCE       bool       `json:"require_pkce,omitempty" yaml:"require_pkce,omitempty" toml:"require_pkce,omitempty"`
+	PKCEMethods       []string   `json:"pkce_methods,omitempty" yaml:"pkce_methods,omitempty" toml:"pkce_methods,omitempty"`
+
+	Roles RoleMappings `json:"roles,omitempty" yaml:"roles,omitempty" toml:"roles,omitempty"`
+
+	SSO *bool `json:"sso,omitempty" yaml:"sso,omitempty" toml:"sso,omitempty"`
+
+	AllowClientCredentials  bool     `json:"allow_client_credentials,omitempty"  yaml:"allow_client_credentials,omitempty"  toml:"allow_client_credentials,omitempty"`
+	ClientCredentialsScopes []string `json:"client_credentials_scopes,omitempty" yaml:"client_credentials_scopes,omitempty" toml:"client_credentials_scopes,omitempty"`
+
+	AllowPasswordGrant bool `json:"allow_password_grant,omitempty" yaml:"allow_password_grant,omitempty" toml:"allow_password_grant,omitempty"`
+
+	// AllowBackchannel allows Client-Initiated Backchannel Authentication, that the client starts login of a user without redirect.
+	AllowBackchannel bool `json:"allow_backchannel,omitempty" yaml:"allow_backchannel,omitempty" toml:"allow_backchannel,omitempty"`
+
+	// RequestURIs is the URIs that lauth can fetch request objects from for the request_uri parameter.
+	RequestURIs PatternSet `json:"request_uris,omitempty" yaml:"request_uris,omitempty" toml:"request_uris,omitempty"`
+
+	FrontchannelLogoutURI string `json:"frontchannel_logout_uri,omitempty" yaml:"frontchannel_logout_uri,omitempty" toml:"frontchannel_logout_uri,omitempty"`
+
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods,omitempty" yaml:"token_endpoint_auth_methods,omitempty" toml:"token_endpoint_auth_methods,omitempty"`
+
+	// MFA is the name of the MFA provider that required for this client, in addition to [mfa] settings.
+	MFA string `json:"mfa,omitempty" yaml:"mfa,omitempty" toml:"mfa,omitempty"`
+}
+
+const (
+	TokenEndpointAuthClientSecretPost  = "client_secret_post"
+	TokenEndpointAuthClientSecretBasic = "client_secret_basic"
+)
+
+// UsesSSO checks if the client participates in SSO. It is true unless `sso = false` is set.
+func (c ClientConfig) UsesSSO() bool {
+	return c.SSO == nil || *c.SSO
+}
+
+// DefaultTokenEndpointAuthMethods is the methods that allowed for clients without token_endpoint_auth_methods.
+var DefaultTokenEndpointAuthMethods = []string{TokenEndpointAuthClientSecretPost, TokenEndpointAuthClientSecretBasic}
+
+// AllowsTokenEndpointAuthMethod checks if the client can authenticate to the token endpoint by the method.
+func (c ClientConfig) AllowsTokenEndpointAuthMethod(method string) bool {
+	methods := c.TokenEndpointAuthMethods
+	if len(methods) == 0 {
+		methods = DefaultTokenEndpointAuthMethods
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPKCEMethod checks if the client accepts the code_challenge_method.
+// The empty method means "plain".
+func (c ClientConfig) AllowsPKCEMethod(method string) bool {
+	if len(c.PKCEMethods) == 0 {
+		return true
+	}
+	if method == "" {
+		method = "plain"
+	}
+	for _, m := range c.PKCEMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	RedirectURIMatchExact    = "exact"
+	RedirectURIMatchWildcard = "wildcard"
+)
+
+// MatchRedirectURI checks if the uri is registered as redirect_uri of the client.
+// Wildcards in redirect_uri are expanded unless redirect_uri_match is "exact".
+func (c ClientConfig) MatchRedirectURI(uri string) bool {
+	if c.RedirectURIMatch == RedirectURIMatchExact {
+		return c.RedirectURI.MatchExact(uri)
+	}
+	return c.RedirectURI.Match(uri)
 }
 
 type ClientConfigSet map[string]ClientConfig
@@ -75,14 +200,53 @@ type MetricsConfig struct {
 	Path     string `json:"path"               yaml:"path"               toml:"path"               flag:"metrics-path"`
 	Username string `json:"username,omitempty" yaml:"username,omitempty" toml:"username,omitempty" flag:"metrics-username"`
 	Password string `json:"password,omitempty" yaml:"password,omitempty" toml:"password,omitempty" flag:"metrics-password"`
+
+	// Provider is the backend of metrics. "prometheus", "otlp", or "none".
+	Provider     string   `json:"provider,omitempty"      yaml:"provider,omitempty"      toml:"provider,omitempty"      flag:"metrics-provider"`
+	OTLPEndpoint *URL     `json:"otlp_endpoint,omitempty" yaml:"otlp_endpoint,omitempty" toml:"otlp_endpoint,omitempty" flag:"metrics-otlp-endpoint"`
+	OTLPInterval Duration `json:"otlp_interval,omitempty" yaml:"otlp_interval,omitempty" toml:"otlp_interval,omitempty" flag:"metrics-otlp-interval"`
 }
 
+const (
+	MetricsPrometheus = "prometheus"
+	MetricsOTLP       = "otlp"
+	MetricsNone       = "none"
+)
+
 type TLSConfig struct {
 	Auto bool   `json:"auto,omitempty" yaml:"auto,omitempty" toml:"auto,omitempty" flag:"tls-auto"`
 	Cert string `json:"cert,omitempty" yaml:"cert,omitempty" toml:"cert,omitempty" flag:"tls-cert"`
 	Key  string `json:"key,omitempty"  yaml:"key,omitempty"  toml:"key,omitempty"  flag:"tls-key"`
+
+	// Redirect is the address to listen plain HTTP that redirects to the Issuer URL, like ":80".
+	Redirect *TCPAddr `json:"redirect,omitempty" yaml:"redirect,omitempty" toml:"redirect,omitempty" flag:"tls-redirect"`
+}
+
+// Enabled reports whether TLS is enabled.
+func (c TLSConfig) Enabled() bool {
+	return c.Auto || c.Cert != ""
 }
 
+// RedirectEnabled reports whether the HTTP redirect listener is enabled.
+func (c TLSConfig) RedirectEnabled() bool {
+	return c.Redirect != nil && c.Redirect.String() != ""
+}
+
+type ServerConfig struct {
+	ReadHeaderTimeout Duration `json:"read_header_timeout,omitempty" yaml:"read_header_timeout,omitempty" toml:"read_header_timeout,omitempty" flag:"server-read-header-timeout"`
+	ReadTimeout       Duration `json:"read_timeout,omitempty"        yaml:"read_timeout,omitempty"        toml:"read_timeout,omitempty"        flag:"server-read-timeout"`
+	WriteTimeout      Duration `json:"write_timeout,omitempty"       yaml:"write_timeout,omitempty"       toml:"write_timeout,omitempty"       flag:"server-write-timeout"`
+	IdleTimeout       Duration `json:"idle_timeout,omitempty"        yaml:"idle_timeout,omitempty"        toml:"idle_timeout,omitempty"        flag:"server-idle-timeout"`
+
+	// TrustedProxies are addresses or networks of reverse proxies that X-Forwarded-For header from them is trusted.
+	TrustedProxies []string `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty" toml:"trusted_proxies,omitempty" flag:"trusted-proxies"`
+}
+
+const (
+	LDAPBindSimple   = "simple"
+	LDAPBindExternal = "external"
+)
+
 type LDAPConfig struct {
 	Server      *URL   `json:"server"       yaml:"server"       toml:"server"       flag:"ldap"`
 	User        string `json:"user"         yaml:"user"         toml:"user"         flag:"ldap-user"`
@@ -90,26 +254,265 @@ type LDAPConfig struct {
 	BaseDN      string `json:"base_dn"      yaml:"base_dn"      toml:"base_dn"      flag:"ldap-base-dn"`
 	IDAttribute string `json:"id_attribute" yaml:"id_attribute" toml:"id_attribute" flag:"ldap-id-attribute"`
 	DisableTLS  bool   `json:"disable_tls"  yaml:"disable_tls"  toml:"disable_tls"  flag:"ldap-disable-tls"`
+
+	Bind         string   `json:"bind,omitempty"          yaml:"bind,omitempty"          toml:"bind,omitempty"          flag:"ldap-bind"`
+	ClientCert   string   `json:"client_cert,omitempty"   yaml:"client_cert,omitempty"   toml:"client_cert,omitempty"   flag:"ldap-client-cert"`
+	ClientKey    string   `json:"client_key,omitempty"    yaml:"client_key,omitempty"    toml:"client_key,omitempty"    flag:"ldap-client-key"`
+	CA           string   `json:"ca,omitempty"            yaml:"ca,omitempty"            toml:"ca,omitempty"            flag:"ldap-ca"`
+	StrictSchema bool     `json:"strict_schema,omitempty" yaml:"strict_schema,omitempty" toml:"strict_schema,omitempty" flag:"ldap-strict-schema"`
+	SRV          bool     `json:"srv,omitempty"           yaml:"srv,omitempty"           toml:"srv,omitempty"           flag:"ldap-srv"`
+	SRVRefresh   Duration `json:"srv_refresh,omitempty"   yaml:"srv_refresh,omitempty"   toml:"srv_refresh,omitempty"   flag:"ldap-srv-refresh"`
+
+	StrictPrivileges bool `json:"strict_privileges,omitempty" yaml:"strict_privileges,omitempty" toml:"strict_privileges,omitempty" flag:"ldap-strict-privileges"`
+	PrimaryGroup     bool `json:"primary_group,omitempty"     yaml:"primary_group,omitempty"     toml:"primary_group,omitempty"     flag:"ldap-primary-group"`
+}
+
+const (
+	ErrorFormatJSON    = "json"
+	ErrorFormatProblem = "problem"
+)
+
+type AdminConfig struct {
+	Path     string `json:"path,omitempty"     yaml:"path,omitempty"     toml:"path,omitempty"     flag:"admin-path"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty" toml:"username,omitempty" flag:"admin-username"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty" toml:"password,omitempty" flag:"admin-password"`
+
+	// ErrorFormat is the format of errors from the admin API and /readyz.
+	ErrorFormat string `json:"error_format,omitempty" yaml:"error_format,omitempty" toml:"error_format,omitempty" flag:"admin-error-format"`
+}
+
+// Enabled reports whether the admin API is enabled.
+func (c AdminConfig) Enabled() bool {
+	return c.Username != "" && c.Password != ""
+}
+
+type EventsConfig struct {
+	NATS          *URL     `json:"nats,omitempty"           yaml:"nats,omitempty"           toml:"nats,omitempty"           flag:"events-nats"`
+	SubjectPrefix string   `json:"subject_prefix,omitempty" yaml:"subject_prefix,omitempty" toml:"subject_prefix,omitempty" flag:"events-subject-prefix"`
+	QueueSize     int      `json:"queue_size,omitempty"     yaml:"queue_size,omitempty"     toml:"queue_size,omitempty"     flag:"events-queue-size"`
+	Timeout       Duration `json:"timeout,omitempty"        yaml:"timeout,omitempty"        toml:"timeout,omitempty"        flag:"events-timeout"`
+}
+
+type SecretHashConfig struct {
+	Algorithm     string `json:"algorithm,omitempty"      yaml:"algorithm,omitempty"      toml:"algorithm,omitempty"      flag:"secret-hash"`
+	BcryptCost    int    `json:"bcrypt_cost,omitempty"    yaml:"bcrypt_cost,omitempty"    toml:"bcrypt_cost,omitempty"    flag:"secret-hash-bcrypt-cost"`
+	Argon2Time    uint32 `json:"argon2_time,omitempty"    yaml:"argon2_time,omitempty"    toml:"argon2_time,omitempty"    flag:"secret-hash-argon2-time"`
+	Argon2Memory  uint32 `json:"argon2_memory,omitempty"  yaml:"argon2_memory,omitempty"  toml:"argon2_memory,omitempty"  flag:"secret-hash-argon2-memory"`
+	Argon2Threads uint8  `json:"argon2_threads,omitempty" yaml:"argon2_threads,omitempty" toml:"argon2_threads,omitempty" flag:"secret-hash-argon2-threads"`
+}
+
+// Params converts the config to the parameters for the secret package.
+func (c SecretHashConfig) Params() secret.Params {
+	return secret.Params{
+		Algorithm:     c.Algorithm,
+		BcryptCost:    c.BcryptCost,
+		Argon2Time:    c.Argon2Time,
+		Argon2Memory:  c.Argon2Memory,
+		Argon2Threads: c.Argon2Threads,
+	}
 }
 
 type TemplateConfig struct {
 	LoginPage  string `json:"login_page,omitempty"  yaml:"login_page,omitempty"  toml:"login_page,omitempty"  flag:"login-page"`
 	LogoutPage string `json:"logout_page,omitempty" yaml:"logout_page,omitempty" toml:"logout_page,omitempty" flag:"logout-page"`
 	ErrorPage  string `json:"error_page,omitempty"  yaml:"error_page,omitempty"  toml:"error_page,omitempty"  flag:"error-page"`
+	Language   string `json:"language,omitempty"    yaml:"language,omitempty"    toml:"language,omitempty"    flag:"page-language"`
+	AssetURL   string `json:"asset_url,omitempty"   yaml:"asset_url,omitempty"   toml:"asset_url,omitempty"   flag:"asset-url"`
+	Timezone   string `json:"timezone,omitempty"    yaml:"timezone,omitempty"    toml:"timezone,omitempty"    flag:"page-timezone"`
+}
+
+// Languages returns the languages of the pages. The first one is the default.
+func (c TemplateConfig) Languages() []string {
+	var langs []string
+	for _, l := range strings.Split(c.Language, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			langs = append(langs, l)
+		}
+	}
+	if len(langs) == 0 {
+		return []string{"en"}
+	}
+	return langs
+}
+
+type PolicyConfig struct {
+	URL             *URL     `json:"url,omitempty"              yaml:"url,omitempty"              toml:"url,omitempty"              flag:"policy-url"`
+	RegoDir         string   `json:"rego_dir,omitempty"         yaml:"rego_dir,omitempty"         toml:"rego_dir,omitempty"         flag:"policy-rego-dir"`
+	Timeout         Duration `json:"timeout,omitempty"          yaml:"timeout,omitempty"          toml:"timeout,omitempty"          flag:"policy-timeout"`
+	GroupsAttribute string   `json:"groups_attribute,omitempty" yaml:"groups_attribute,omitempty" toml:"groups_attribute,omitempty" flag:"policy-groups-attribute"`
+}
+
+type IDTokenConfig struct {
+	GroupsLimit int    `json:"groups_limit,omitempty" yaml:"groups_limit,omitempty" toml:"groups_limit,omitempty" flag:"id-token-groups-limit"`
+	MaxSize     int    `json:"max_size,omitempty"     yaml:"max_size,omitempty"     toml:"max_size,omitempty"     flag:"id-token-max-size"`
+	Overflow    string `json:"overflow,omitempty"     yaml:"overflow,omitempty"     toml:"overflow,omitempty"     flag:"id-token-overflow"`
+}
+
+const (
+	// IDTokenOverflowUserinfo drops the groups claim from id_token that exceeds the max size, and tells to get it via userinfo endpoint.
+	IDTokenOverflowUserinfo = "userinfo"
+
+	// IDTokenOverflowError fails to issue id_token that exceeds the max size.
+	IDTokenOverflowError = "error"
+
+	// IDTokenOverflowWarn issues id_token that exceeds the max size as is, and writes a warning log.
+	IDTokenOverflowWarn = "warn"
+)
+
+type LoginConfig struct {
+	DisableAutocomplete bool     `json:"disable_autocomplete,omitempty" yaml:"disable_autocomplete,omitempty" toml:"disable_autocomplete,omitempty" flag:"login-disable-autocomplete"`
+	PasswordToggle      bool     `json:"password_toggle,omitempty"      yaml:"password_toggle,omitempty"      toml:"password_toggle,omitempty"      flag:"login-password-toggle"`
+	UsernameCase        string   `json:"username_case,omitempty"        yaml:"username_case,omitempty"        toml:"username_case,omitempty"        flag:"login-username-case"`
+	StripDomains        []string `json:"strip_domains,omitempty"        yaml:"strip_domains,omitempty"        toml:"strip_domains,omitempty"        flag:"login-strip-domain"`
+	FailureLatency      Duration `json:"failure_latency,omitempty"      yaml:"failure_latency,omitempty"      toml:"failure_latency,omitempty"      flag:"login-failure-latency"`
+	DetailedErrors      []string `json:"detailed_errors,omitempty"      yaml:"detailed_errors,omitempty"      toml:"detailed_errors,omitempty"      flag:"login-detailed-errors"`
+	LockoutThreshold    int      `json:"lockout_threshold,omitempty"    yaml:"lockout_threshold,omitempty"    toml:"lockout_threshold,omitempty"    flag:"login-lockout-threshold"`
+	LockoutDuration     Duration `json:"lockout_duration,omitempty"     yaml:"lockout_duration,omitempty"     toml:"lockout_duration,omitempty"     flag:"login-lockout-duration"`
+	LockoutDir          string   `json:"lockout_dir,omitempty"          yaml:"lockout_dir,omitempty"          toml:"lockout_dir,omitempty"          flag:"login-lockout-dir"`
+
+	NotifyThreshold int    `json:"notify_threshold,omitempty" yaml:"notify_threshold,omitempty" toml:"notify_threshold,omitempty" flag:"login-notify-threshold"`
+	NotifyAttribute string `json:"notify_attribute,omitempty" yaml:"notify_attribute,omitempty" toml:"notify_attribute,omitempty" flag:"login-notify-attribute"`
+}
+
+type LimitsConfig struct {
+	MaxBodySize           int      `json:"max_body_size,omitempty"           yaml:"max_body_size,omitempty"           toml:"max_body_size,omitempty"           flag:"max-body-size"`
+	MaxURLLength          int      `json:"max_url_length,omitempty"          yaml:"max_url_length,omitempty"          toml:"max_url_length,omitempty"          flag:"max-url-length"`
+	MaxConcurrentRequests int      `json:"max_concurrent_requests,omitempty" yaml:"max_concurrent_requests,omitempty" toml:"max_concurrent_requests,omitempty" flag:"max-concurrent-requests"`
+	RetryAfter            Duration `json:"retry_after,omitempty"             yaml:"retry_after,omitempty"             toml:"retry_after,omitempty"             flag:"retry-after"`
+
+	TokensPerSubject int    `json:"tokens_per_subject,omitempty" yaml:"tokens_per_subject,omitempty" toml:"tokens_per_subject,omitempty" flag:"tokens-per-subject"`
+	TokensPerClient  int    `json:"tokens_per_client,omitempty"  yaml:"tokens_per_client,omitempty"  toml:"tokens_per_client,omitempty"  flag:"tokens-per-client"`
+	QuotaDir         string `json:"quota_dir,omitempty"          yaml:"quota_dir,omitempty"          toml:"quota_dir,omitempty"          flag:"quota-dir"`
+
+	RequestObjectSize int      `json:"request_object_size,omitempty" yaml:"request_object_size,omitempty" toml:"request_object_size,omitempty" flag:"max-request-object-size"`
+	RequestURITimeout Duration `json:"request_uri_timeout,omitempty" yaml:"request_uri_timeout,omitempty" toml:"request_uri_timeout,omitempty" flag:"request-uri-timeout"`
+	RequestURICache   Duration `json:"request_uri_cache,omitempty"   yaml:"request_uri_cache,omitempty"   toml:"request_uri_cache,omitempty"   flag:"request-uri-cache"`
+}
+
+// HasQuota checks if --tokens-per-subject or --tokens-per-client is set.
+func (c LimitsConfig) HasQuota() bool {
+	return c.TokensPerSubject > 0 || c.TokensPerClient > 0
+}
+
+type HeadersConfig struct {
+	All   map[string]string `json:"all,omitempty"   yaml:"all,omitempty"   toml:"all,omitempty"`
+	Pages map[string]string `json:"pages,omitempty" yaml:"pages,omitempty" toml:"pages,omitempty"`
+	API   map[string]string `json:"api,omitempty"   yaml:"api,omitempty"   toml:"api,omitempty"`
+}
+
+type AuditConfig struct {
+	File           string   `json:"file,omitempty"            yaml:"file,omitempty"            toml:"file,omitempty"            flag:"audit-log"`
+	AnchorInterval Duration `json:"anchor_interval,omitempty" yaml:"anchor_interval,omitempty" toml:"anchor_interval,omitempty" flag:"audit-anchor-interval"`
+	Syslog         *URL     `json:"syslog,omitempty"          yaml:"syslog,omitempty"          toml:"syslog,omitempty"          flag:"audit-syslog"`
+	SyslogFormat   string   `json:"syslog_format,omitempty"   yaml:"syslog_format,omitempty"   toml:"syslog_format,omitempty"   flag:"audit-syslog-format"`
+}
+
+const (
+	ResponseModeQuery    = "query"
+	ResponseModeFragment = "fragment"
+
+	// ResponseModeFormPost sends the response by an auto-submitting HTML form, as OAuth 2.0 Form Post Response Mode.
+	ResponseModeFormPost = "form_post"
+
+	// ResponseModeQueryJWT, ResponseModeFragmentJWT, ResponseModeFormPostJWT, and ResponseModeJWT are the modes of JARM (JWT Secured Authorization Response Mode).
+	// ResponseModeJWT means ResponseModeQueryJWT for response_type=code, and ResponseModeFragmentJWT for the others.
+	ResponseModeQueryJWT    = "query.jwt"
+	ResponseModeFragmentJWT = "fragment.jwt"
+	ResponseModeFormPostJWT = "form_post.jwt"
+	ResponseModeJWT         = "jwt"
+)
+
+// ResponseModeConfig is the policy of response_mode of the authorization endpoint.
+type ResponseModeConfig struct {
+	Code     string `json:"code,omitempty"     yaml:"code,omitempty"     toml:"code,omitempty"     flag:"response-mode-code"`
+	Implicit string `json:"implicit,omitempty" yaml:"implicit,omitempty" toml:"implicit,omitempty" flag:"response-mode-implicit"`
+}
+
+// Default returns the response_mode for requests without it.
+// The tokens should be true if the response includes access_token or id_token, that means implicit or hybrid flow.
+func (c ResponseModeConfig) Default(tokens bool) string {
+	if tokens {
+		return c.Implicit
+	}
+	return c.Code
+}
+
+const (
+	SSOBindingOff    = "off"
+	SSOBindingLoose  = "loose"
+	SSOBindingStrict = "strict"
+)
+
+type SSOConfig struct {
+	RevocationFile string `json:"revocation_file,omitempty" yaml:"revocation_file,omitempty" toml:"revocation_file,omitempty" flag:"sso-revocation-file"`
+	Binding        string `json:"binding,omitempty"         yaml:"binding,omitempty"         toml:"binding,omitempty"         flag:"sso-binding"`
+
+	Sliding     bool     `json:"sliding,omitempty"      yaml:"sliding,omitempty"      toml:"sliding,omitempty"      flag:"sso-sliding"`
+	MaxLifetime Duration `json:"max_lifetime,omitempty" yaml:"max_lifetime,omitempty" toml:"max_lifetime,omitempty" flag:"sso-max-lifetime"`
+}
+
+// DefaultSSOMaxLifetime is the absolute lifetime of SSO session from the login, when sliding expiration is enabled.
+const DefaultSSOMaxLifetime = Duration(30 * 24 * time.Hour)
+
+type RegistrationConfig struct {
+	Enable         bool                `json:"enable,omitempty"          yaml:"enable,omitempty"          toml:"enable,omitempty"          flag:"registration"`
+	BaseDN         string              `json:"base_dn,omitempty"         yaml:"base_dn,omitempty"         toml:"base_dn,omitempty"         flag:"registration-base-dn"`
+	Group          string              `json:"group,omitempty"           yaml:"group,omitempty"           toml:"group,omitempty"           flag:"registration-group"`
+	GroupAttribute string              `json:"group_attribute,omitempty" yaml:"group_attribute,omitempty" toml:"group_attribute,omitempty" flag:"registration-group-attribute"`
+	Attributes     map[string][]string `json:"attributes,omitempty"      yaml:"attributes,omitempty"      toml:"attributes,omitempty"`
+}
+
+type SMTPConfig struct {
+	Server *URL   `json:"server,omitempty" yaml:"server,omitempty" toml:"server,omitempty" flag:"smtp-server"`
+	From   string `json:"from,omitempty"   yaml:"from,omitempty"   toml:"from,omitempty"   flag:"smtp-from"`
 }
 
 type Config struct {
-	Issuer    *URL            `json:"issuer"              yaml:"issuer"              toml:"issuer"             flag:"issuer"`
-	Listen    *TCPAddr        `json:"listen,omitempty"    yaml:"listen,omitempty"    toml:"listen,omitempty"   flag:"listen"`
-	SignKey   string          `json:"sign_key,omitempty"  yaml:"sign_key,omitempty"  toml:"sign_key,omitempty" flag:"sign-key"`
-	TLS       TLSConfig       `json:"tls,omitempty"       yaml:"tls,omitempty"       toml:"tls,omitempty"`
-	LDAP      LDAPConfig      `json:"ldap"                yaml:"ldap"                toml:"ldap"`
-	Expire    ExpireConfig    `json:"expire"              yaml:"expire"              toml:"expire"`
-	Endpoints EndpointConfig  `json:"endpoint"            yaml:"endpoint"            toml:"endpoint"`
-	Scopes    ScopeConfig     `json:"scope,omitempty"     yaml:"scope,omitempty"     toml:"scope,omitempty"`
-	Clients   ClientConfigSet `json:"client,omitempty"    yaml:"client,omitempty"    toml:"client,omitempty"`
-	Metrics   MetricsConfig   `json:"metrics"             yaml:"metrics"             toml:"metrics"`
-	Templates TemplateConfig  `json:"template,omitempty"  yaml:"template,omitempty"  toml:"template,omitempty"`
+	Issuer     *URL               `json:"issuer"              yaml:"issuer"              toml:"issuer"             flag:"issuer"`
+	OldIssuers []*URL             `json:"old_issuers,omitempty" yaml:"old_issuers,omitempty" toml:"old_issuers,omitempty" flag:"old-issuer"`
+	Listen     *TCPAddr           `json:"listen,omitempty"    yaml:"listen,omitempty"    toml:"listen,omitempty"   flag:"listen"`
+	SignKey    string             `json:"sign_key,omitempty"  yaml:"sign_key,omitempty"  toml:"sign_key,omitempty" flag:"sign-key"`
+	VerifyKeys []string           `json:"verify_keys,omitempty" yaml:"verify_keys,omitempty" toml:"verify_keys,omitempty" flag:"verify-key"`
+	TLS        TLSConfig          `json:"tls,omitempty"       yaml:"tls,omitempty"       toml:"tls,omitempty"`
+	Server     ServerConfig       `json:"server,omitempty"    yaml:"server,omitempty"    toml:"server,omitempty"`
+	LDAP       LDAPConfig         `json:"ldap"                yaml:"ldap"                toml:"ldap"`
+	Expire     ExpireConfig       `json:"expire"              yaml:"expire"              toml:"expire"`
+	Endpoints  EndpointConfig     `json:"endpoint"            yaml:"endpoint"            toml:"endpoint"`
+	Scopes     ScopeConfig        `json:"scope,omitempty"     yaml:"scope,omitempty"     toml:"scope,omitempty"`
+	Clients    ClientConfigSet    `json:"client,omitempty"    yaml:"client,omitempty"    toml:"client,omitempty"`
+	Metrics    MetricsConfig      `json:"metrics"             yaml:"metrics"             toml:"metrics"`
+	Templates  TemplateConfig     `json:"template,omitempty"  yaml:"template,omitempty"  toml:"template,omitempty"`
+	Policy     PolicyConfig       `json:"policy,omitempty"    yaml:"policy,omitempty"    toml:"policy,omitempty"`
+	Audit      AuditConfig        `json:"audit,omitempty"     yaml:"audit,omitempty"     toml:"audit,omitempty"`
+	SSO        SSOConfig          `json:"sso,omitempty"       yaml:"sso,omitempty"       toml:"sso,omitempty"`
+	Register   RegistrationConfig `json:"registration,omitempty" yaml:"registration,omitempty" toml:"registration,omitempty"`
+	SMTP       SMTPConfig         `json:"smtp,omitempty"      yaml:"smtp,omitempty"      toml:"smtp,omitempty"`
+	Admin      AdminConfig        `json:"admin,omitempty"     yaml:"admin,omitempty"     toml:"admin,omitempty"`
+	IDToken    IDTokenConfig      `json:"id_token,omitempty"  yaml:"id_token,omitempty"  toml:"id_token,omitempty"`
+	Login      LoginConfig        `json:"login,omitempty"     yaml:"login,omitempty"     toml:"login,omitempty"`
+	Headers    HeadersConfig      `json:"headers,omitempty"   yaml:"headers,omitempty"   toml:"headers,omitempty"`
+	Limits     LimitsConfig       `json:"limits,omitempty"    yaml:"limits,omitempty"    toml:"limits,omitempty"`
+	RobotsTxt  string             `json:"robots_txt,omitempty" yaml:"robots_txt,omitempty" toml:"robots_txt,omitempty" flag:"robots-txt"`
+	Features   map[string]bool    `json:"features,omitempty"  yaml:"features,omitempty"  toml:"features,omitempty"`
+	Profile    string             `json:"profile,omitempty"   yaml:"profile,omitempty"   toml:"profile,omitempty"  flag:"profile"`
+
+	ScopeRegistry ScopeRegistryConfig `json:"scope_registry,omitempty" yaml:"scope_registry,omitempty" toml:"scope_registry,omitempty"`
+
+	DiscoveryMaxAge Duration `json:"discovery_max_age,omitempty" yaml:"discovery_max_age,omitempty" toml:"discovery_max_age,omitempty" flag:"discovery-max-age"`
+
+	SecretHash SecretHashConfig `json:"secret_hash,omitempty" yaml:"secret_hash,omitempty" toml:"secret_hash,omitempty"`
+
+	Events EventsConfig `json:"events,omitempty" yaml:"events,omitempty" toml:"events,omitempty"`
+
+	// RequireOfflineAccess issues refresh tokens only to requests that granted the offline_access scope.
+	RequireOfflineAccess bool `json:"require_offline_access,omitempty" yaml:"require_offline_access,omitempty" toml:"require_offline_access,omitempty" flag:"require-offline-access"`
+
+	ResponseMode ResponseModeConfig `json:"response_mode,omitempty" yaml:"response_mode,omitempty" toml:"response_mode,omitempty"`
+
+	MFA MFAConfig `json:"mfa,omitempty" yaml:"mfa,omitempty" toml:"mfa,omitempty"`
+
+	// ClaimSources are external sources of attributes, that merged with attributes from LDAP in the listed order.
+	ClaimSources []ClaimSourceConfig `json:"claim_source,omitempty" yaml:"claim_source,omitempty" toml:"claim_source,omitempty"`
 }
 
 func TakeOptions(prefix string, typ reflect.Type, result map[string]string) {
@@ -170,6 +573,65 @@ func (c *Config) unmarshal(vip *viper.Viper) error {
 		c.Scopes = DefaultScopes
 	}
 
+	if c.Register.BaseDN == "" {
+		c.Register.BaseDN = c.LDAP.BaseDN
+	}
+	if c.Register.GroupAttribute == "" {
+		c.Register.GroupAttribute = "member"
+	}
+	if c.Register.Attributes == nil {
+		c.Register.Attributes = DefaultRegistrationAttributes
+	}
+
+	if c.Templates.Language == "" {
+		c.Templates.Language = "en"
+	}
+
+	if c.SSO.Binding == "" {
+		c.SSO.Binding = SSOBindingOff
+	}
+	if c.ResponseMode.Code == "" {
+		c.ResponseMode.Code = ResponseModeQuery
+	}
+	if c.ResponseMode.Implicit == "" {
+		c.ResponseMode.Implicit = ResponseModeFragment
+	}
+	if c.SSO.MaxLifetime == 0 {
+		c.SSO.MaxLifetime = DefaultSSOMaxLifetime
+	}
+
+	if c.Policy.GroupsAttribute == "" {
+		c.Policy.GroupsAttribute = "memberOf"
+	}
+
+	if c.LDAP.Bind == "" {
+		c.LDAP.Bind = LDAPBindSimple
+	}
+
+	if c.Audit.SyslogFormat == "" {
+		c.Audit.SyslogFormat = audit.SyslogFormatJSON
+	}
+
+	if c.Admin.ErrorFormat == "" {
+		c.Admin.ErrorFormat = ErrorFormatJSON
+	}
+
+	if c.SecretHash.Algorithm == "" {
+		c.SecretHash.Algorithm = secret.DefaultParams.Algorithm
+	}
+	if c.SecretHash.BcryptCost == 0 {
+		c.SecretHash.BcryptCost = secret.DefaultParams.BcryptCost
+	}
+	if c.SecretHash.Argon2Time == 0 {
+		c.SecretHash.Argon2Time = secret.DefaultParams.Argon2Time
+	}
+	if c.SecretHash.Argon2Memory == 0 {
+		c.SecretHash.Argon2Memory = secret.DefaultParams.Argon2Memory
+	}
+	if c.SecretHash.Argon2Threads == 0 {
+		c.SecretHash.Argon2Threads = secret.DefaultParams.Argon2Threads
+	}
+
 	if c.LDAP.Server != nil {
 		if c.LDAP.User == "" {
 			c.LDAP.User = c.LDAP.Server.User.Username()
@@ -200,7 +662,20 @@ func (r EnvReplacer) Replace(s string) string {
 	return strings.ReplaceAll(s, ".", "_")
 }
 
+// Load reads options from the config file, the environment variables, and the flags.
 func (c *Config) Load(file string, flags *pflag.FlagSet) error {
+	var files []string
+	if file != "" {
+		files = []string{file}
+	}
+	return c.LoadFiles(files, flags)
+}
+
+// LoadFiles reads options like Load, but from multiple config files.
+//
+// The files are merged in order; see DiffFiles about the override rules.
+// If no file given, read files in LAUTH_CONFIG that separated by the OS's path list separator.
+func (c *Config) LoadFiles(files []string, flags *pflag.FlagSet) error {
 	var replacer EnvReplacer
 	vip := viper.NewWithOptions(viper.EnvKeyReplacer(replacer))
 
@@ -210,15 +685,12 @@ func (c *Config) Load(file string, flags *pflag.FlagSet) error {
 	vip.SetEnvPrefix("LAUTH")
 	vip.AutomaticEnv()
 
-	if file == "" {
-		file = os.Getenv("LAUTH_CONFIG")
+	if len(files) == 0 {
+		files = filepath.SplitList(os.Getenv("LAUTH_CONFIG"))
 	}
 
-	if file != "" {
-		vip.SetConfigFile(file)
-		if err := vip.ReadInConfig(); err != nil {
-			return err
-		}
+	if err := readFiles(vip, files); err != nil {
+		return err
 	}
 
 	return c.unmarshal(vip)
@@ -245,6 +717,14 @@ func (c *Config) Validate() error {
 		es = append(es, errors.New("--issuer: Issuer URL must be absolute URL."))
 	}
 
+	for _, old := range c.OldIssuers {
+		if old == nil || !old.URL().IsAbs() {
+			es = append(es, errors.New("--old-issuer: Old Issuer URL must be absolute URL."))
+		} else if old.String() == c.Issuer.String() {
+			es = append(es, fmt.Errorf("--old-issuer: Old Issuer URL can't be the same as the Issuer URL: %s", old))
+		}
+	}
+
 	if c.TLS.Auto && (c.TLS.Cert != "" || c.TLS.Key != "") {
 		es = append(es, errors.New("--tls-auto: Can't use both of TLS auto and TLS Key/TLS Cert."))
 	}
@@ -256,19 +736,49 @@ func (c *Config) Validate() error {
 	if (c.TLS.Cert != "" || c.TLS.Key != "" || c.TLS.Auto) && c.Issuer.Scheme != "https" {
 		es = append(es, errors.New("--issuer: Please set https URL for Issuer URL when use TLS."))
 	}
+	if c.TLS.RedirectEnabled() {
+		if !c.TLS.Enabled() {
+			es = append(es, errors.New("--tls-redirect: HTTP redirect is available only when use TLS."))
+		} else if c.Listen != nil && c.TLS.Redirect.Port == c.Listen.Port {
+			es = append(es, fmt.Errorf("--tls-redirect: Can't use the same port as the listen address: %d", c.Listen.Port))
+		}
+	}
 
+	var ldapScheme string
 	if c.LDAP.Server.String() == "" {
 		es = append(es, errors.New("--ldap: LDAP Server address is required."))
+	} else {
+		ldapScheme = c.LDAP.Server.Scheme
 	}
-	if c.LDAP.User == "" {
-		es = append(es, errors.New("--ldap-user: LDAP User is required."))
-	}
-	if c.LDAP.Password == "" {
-		es = append(es, errors.New("--ldap-password: LDAP Password is required."))
+	switch c.LDAP.Bind {
+	case LDAPBindSimple:
+		if c.LDAP.User == "" {
+			es = append(es, errors.New("--ldap-user: LDAP User is required."))
+		}
+		if c.LDAP.Password == "" {
+			es = append(es, errors.New("--ldap-password: LDAP Password is required."))
+		}
+	case LDAPBindExternal:
+		if (c.LDAP.ClientCert == "") != (c.LDAP.ClientKey == "") {
+			es = append(es, errors.New("--ldap-client-cert, --ldap-client-key: Please set both of client certificate and key."))
+		}
+		if c.LDAP.ClientCert == "" && ldapScheme != "ldapi" {
+			es = append(es, errors.New("--ldap-client-cert: Client certificate is required for external bind, except for ldapi://."))
+		}
+	case "gssapi", "kerberos":
+		es = append(es, errors.New("--ldap-bind: Kerberos (GSSAPI) bind is not supported. Please use \"external\" with a client certificate to bind without password."))
+	default:
+		es = append(es, fmt.Errorf("--ldap-bind: LDAP bind method must be \"simple\" or \"external\" but got %#v.", c.LDAP.Bind))
 	}
 	if c.LDAP.BaseDN == "" {
 		es = append(es, errors.New("--ldap-base-dn: LDAP Base DN is required if using user that non DN style."))
 	}
+	if c.LDAP.ClientCert != "" && ldapScheme == "ldap" && c.LDAP.DisableTLS {
+		es = append(es, errors.New("--ldap-client-cert: Client certificate can't use with --ldap-disable-tls."))
+	}
+	if c.LDAP.SRVRefresh < 0 {
+		es = append(es, errors.New("--ldap-srv-refresh: Interval to refresh SRV records can't set less than 0."))
+	}
 
 	if c.Expire.Login <= 0 {
 		es = append(es, errors.New("--login-expire: Expiration of Login can't set 0 or less."))
@@ -279,6 +789,365 @@ func (c *Config) Validate() error {
 	if c.Expire.Token <= 0 {
 		es = append(es, errors.New("--token-expire: Expiration of Token can't set 0 or less."))
 	}
+	if c.Expire.Code > 0 && c.Expire.Token > 0 && c.Expire.Code >= c.Expire.Token {
+		es = append(es, errors.New("--code-expire: Expiration of Code must be shorter than Expiration of Token."))
+	}
+	if c.Expire.Refresh > 0 && c.Expire.Refresh < c.Expire.Token {
+		es = append(es, errors.New("--refresh-expire: Expiration of Refresh Token can't be shorter than Expiration of Token."))
+	}
+	es = append(es, c.Expire.Errors()...)
+	if c.Issuer.String() != "" {
+		es = append(es, c.endpointErrors()...)
+	}
+	es = append(es, c.mfaErrors()...)
+	es = append(es, c.claimSourceErrors()...)
+
+	for _, t := range []struct {
+		Flag  string
+		Value Duration
+	}{
+		{"--server-read-header-timeout", c.Server.ReadHeaderTimeout},
+		{"--server-read-timeout", c.Server.ReadTimeout},
+		{"--server-write-timeout", c.Server.WriteTimeout},
+		{"--server-idle-timeout", c.Server.IdleTimeout},
+	} {
+		if t.Value < 0 {
+			es = append(es, fmt.Errorf("%s: Timeout can't set less than 0.", t.Flag))
+		}
+	}
+
+	if c.Limits.MaxBodySize < 0 {
+		es = append(es, errors.New("--max-body-size: Maximum size of request body can't set less than 0."))
+	}
+	if c.Limits.MaxURLLength < 0 {
+		es = append(es, errors.New("--max-url-length: Maximum length of URL can't set less than 0."))
+	}
+	if c.Limits.MaxConcurrentRequests < 0 {
+		es = append(es, errors.New("--max-concurrent-requests: Maximum number of concurrent requests can't set less than 0."))
+	}
+	if c.Limits.RetryAfter < 0 {
+		es = append(es, errors.New("--retry-after: Retry-After can't set less than 0."))
+	}
+	if c.Limits.RequestObjectSize < 0 {
+		es = append(es, errors.New("--max-request-object-size: Maximum size of request object can't set less than 0."))
+	}
+	if c.Limits.RequestURITimeout < 0 {
+		es = append(es, errors.New("--request-uri-timeout: Timeout to fetch request_uri can't set less than 0."))
+	}
+	if c.Limits.RequestURICache < 0 {
+		es = append(es, errors.New("--request-uri-cache: Cache duration of request_uri can't set less than 0."))
+	}
+	if c.Limits.TokensPerSubject < 0 {
+		es = append(es, errors.New("--tokens-per-subject: Quota of tokens per subject can't set less than 0."))
+	}
+	if c.Limits.TokensPerClient < 0 {
+		es = append(es, errors.New("--tokens-per-client: Quota of tokens per client can't set less than 0."))
+	}
+	if c.DiscoveryMaxAge < 0 {
+		es = append(es, errors.New("--discovery-max-age: Max age of discovery document can't set less than 0."))
+	}
+
+	if c.IDToken.GroupsLimit < 0 {
+		es = append(es, errors.New("--id-token-groups-limit: Limit of groups in ID Token can't set less than 0."))
+	}
+	if c.IDToken.MaxSize < 0 {
+		es = append(es, errors.New("--id-token-max-size: Max size of ID Token can't set less than 0."))
+	}
+	switch c.IDToken.Overflow {
+	case "", IDTokenOverflowUserinfo, IDTokenOverflowError, IDTokenOverflowWarn:
+	default:
+		es = append(es, fmt.Errorf("--id-token-overflow: Overflow strategy must be %#v, %#v, or %#v but got %#v.", IDTokenOverflowUserinfo, IDTokenOverflowError, IDTokenOverflowWarn, c.IDToken.Overflow))
+	}
+
+	if _, err := time.LoadLocation(c.Templates.Timezone); err != nil {
+		es = append(es, fmt.Errorf("--page-timezone: Invalid timezone: %s", err))
+	}
+
+	for _, group := range []struct {
+		Name    string
+		Headers map[string]string
+	}{
+		{"all", c.Headers.All},
+		{"pages", c.Headers.Pages},
+		{"api", c.Headers.API},
+	} {
+		for k, v := range group.Headers {
+			if !httpguts.ValidHeaderFieldName(k) {
+				es = append(es, fmt.Errorf("headers.%s: Invalid header name: %#v", group.Name, k))
+			} else if !httpguts.ValidHeaderFieldValue(v) {
+				es = append(es, fmt.Errorf("headers.%s: Invalid value of %s header: %#v", group.Name, k, v))
+			}
+		}
+	}
+
+	for name := range c.Features {
+		if _, ok := feature.Defaults[name]; !ok {
+			es = append(es, fmt.Errorf("features.%s: Unknown feature. Known features are %s.", name, strings.Join(feature.Names(), ", ")))
+		}
+	}
+
+	switch c.Login.UsernameCase {
+	case "", "keep", "lower", "upper":
+	default:
+		es = append(es, fmt.Errorf("--login-username-case: Username case must be \"keep\", \"lower\", or \"upper\" but got %#v.", c.Login.UsernameCase))
+	}
+
+	if c.Login.LockoutThreshold < 0 {
+		es = append(es, errors.New("--login-lockout-threshold: Threshold can't set less than 0."))
+	}
+	if c.Login.CountsFailures() && c.Login.LockoutDuration <= 0 {
+		es = append(es, errors.New("--login-lockout-duration: Duration of lockout can't set 0 or less."))
+	}
+
+	if c.Login.NotifyThreshold < 0 {
+		es = append(es, errors.New("--login-notify-threshold: Threshold can't set less than 0."))
+	}
+	if c.Login.NotifyThreshold > 0 {
+		if c.Login.LockoutThreshold > 0 && c.Login.NotifyThreshold > c.Login.LockoutThreshold {
+			es = append(es, errors.New("--login-notify-threshold: Threshold can't set greater than --login-lockout-threshold, because failures of locked out users are not counted."))
+		}
+		if c.Login.NotifyAttribute == "" {
+			es = append(es, errors.New("--login-notify-attribute: Attribute is required to send notifications of failed logins."))
+		}
+		if c.SMTP.Server.String() == "" {
+			es = append(es, errors.New("--smtp-server: SMTP Server is required to send notifications of failed logins."))
+		}
+		if c.SMTP.From == "" {
+			es = append(es, errors.New("--smtp-from: SMTP From address is required to send notifications of failed logins."))
+		}
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				es = append(es, fmt.Errorf("--trusted-proxies: Invalid address %#v. Please use IP address or CIDR like \"10.0.0.0/8\".", proxy))
+			}
+		}
+	}
+
+	for _, network := range c.Login.DetailedErrors {
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			es = append(es, fmt.Errorf("--login-detailed-errors: Invalid network %#v. Please use CIDR like \"10.0.0.0/8\".", network))
+		}
+	}
+
+	for name, scope := range c.Scopes {
+		for _, claim := range scope {
+			if err := claim.Check(); err != nil {
+				es = append(es, fmt.Errorf("scope.%s: %s.", name, err))
+			}
+		}
+	}
+
+	switch c.SSO.Binding {
+	case SSOBindingOff, SSOBindingLoose, SSOBindingStrict:
+	default:
+		es = append(es, fmt.Errorf("--sso-binding: SSO binding must be one of \"off\", \"loose\", or \"strict\" but got %#v.", c.SSO.Binding))
+	}
+	for _, m := range []struct {
+		Flag  string
+		Value string
+	}{
+		{"response-mode-code", c.ResponseMode.Code},
+		{"response-mode-implicit", c.ResponseMode.Implicit},
+	} {
+		if m.Value != ResponseModeQuery && m.Value != ResponseModeFragment {
+			es = append(es, fmt.Errorf("--%s: Response mode must be %#v or %#v but got %#v.", m.Flag, ResponseModeQuery, ResponseModeFragment, m.Value))
+		}
+	}
+	if c.ResponseMode.Implicit == ResponseModeQuery {
+		es = append(es, errors.New("--response-mode-implicit: Default response mode of implicit/hybrid flow can't be \"query\", because it exposes tokens in URL."))
+	}
+
+	if c.SSO.Sliding && c.SSO.MaxLifetime < c.Expire.SSO {
+		es = append(es, errors.New("--sso-max-lifetime: Max lifetime of SSO session can't be shorter than --sso-expire."))
+	}
+
+	if c.Register.Enable {
+		if c.SMTP.Server.String() == "" {
+			es = append(es, errors.New("--smtp-server: SMTP Server is required for email verification when registration is enabled."))
+		}
+		if c.SMTP.From == "" {
+			es = append(es, errors.New("--smtp-from: SMTP From address is required for email verification when registration is enabled."))
+		}
+		if c.Register.BaseDN == "" {
+			es = append(es, errors.New("--registration-base-dn: Registration Base DN is required when registration is enabled."))
+		}
+	}
+	if c.AllowsBackchannel() {
+		if c.Login.NotifyAttribute == "" {
+			es = append(es, errors.New("--login-notify-attribute: Attribute is required to send backchannel authentication requests to users."))
+		}
+		if c.SMTP.Server.String() == "" {
+			es = append(es, errors.New("--smtp-server: SMTP Server is required to send backchannel authentication requests to users."))
+		}
+		if c.SMTP.From == "" {
+			es = append(es, errors.New("--smtp-from: SMTP From address is required to send backchannel authentication requests to users."))
+		}
+		if c.Expire.Backchannel <= 0 {
+			es = append(es, errors.New("--backchannel-expire: Expiration of Backchannel Authentication can't set 0 or less."))
+		}
+	}
+	if c.SMTP.Server.String() != "" && c.SMTP.Server.Scheme != "smtp" && c.SMTP.Server.Scheme != "smtps" {
+		es = append(es, errors.New("--smtp-server: SMTP Server URL must be smtp:// or smtps://."))
+	}
+
+	if c.Policy.URL.String() != "" && !c.Policy.URL.URL().IsAbs() {
+		es = append(es, errors.New("--policy-url: Policy URL must be absolute URL."))
+	}
+	if c.Policy.URL.String() != "" && c.Policy.RegoDir != "" {
+		es = append(es, errors.New("--policy-rego-dir: Can't use both of Policy URL and Policy Rego directory."))
+	}
+	if c.Policy.Timeout < 0 {
+		es = append(es, errors.New("--policy-timeout: Timeout of Policy can't set less than 0."))
+	}
+
+	if (c.Audit.File != "" || c.Audit.Syslog.String() != "") && c.Audit.AnchorInterval <= 0 {
+		es = append(es, errors.New("--audit-anchor-interval: Anchor interval of Audit log can't set 0 or less."))
+	}
+	if c.Audit.Syslog.String() != "" {
+		switch c.Audit.Syslog.Scheme {
+		case "udp", "tcp", "tls":
+			if c.Audit.Syslog.Host == "" {
+				es = append(es, errors.New("--audit-syslog: Syslog server URL must include host like \"tls://syslog.example.com:6514\"."))
+			}
+		default:
+			es = append(es, fmt.Errorf("--audit-syslog: Syslog server URL must be udp://, tcp://, or tls:// but got %#v.", c.Audit.Syslog.String()))
+		}
+	}
+	switch c.Audit.SyslogFormat {
+	case audit.SyslogFormatJSON, audit.SyslogFormatCEF:
+	default:
+		es = append(es, fmt.Errorf("--audit-syslog-format: Format of syslog must be %#v or %#v but got %#v.", audit.SyslogFormatJSON, audit.SyslogFormatCEF, c.Audit.SyslogFormat))
+	}
+
+	for id, client := range c.Clients {
+		if err := secret.ValidateHash(client.Secret); err != nil {
+			es = append(es, fmt.Errorf("client.%s.secret: Secret must be a hash that made by gen-client command: %s", id, err))
+		}
+		for _, m := range client.Roles {
+			if m.Group == "" || m.Role == "" {
+				es = append(es, fmt.Errorf("client.%s.roles: Both of group and role are required in role mapping.", id))
+				break
+			}
+		}
+		for _, m := range client.PKCEMethods {
+			if m != "plain" && m != "S256" {
+				es = append(es, fmt.Errorf("client.%s.pkce_methods: PKCE method must be \"plain\" or \"S256\" but got %#v.", id, m))
+			}
+		}
+		for _, m := range client.TokenEndpointAuthMethods {
+			if m != TokenEndpointAuthClientSecretPost && m != TokenEndpointAuthClientSecretBasic {
+				es = append(es, fmt.Errorf("client.%s.token_endpoint_auth_methods: Method must be %#v or %#v but got %#v.", id, TokenEndpointAuthClientSecretPost, TokenEndpointAuthClientSecretBasic, m))
+			}
+		}
+		switch client.RedirectURIMatch {
+		case "", RedirectURIMatchWildcard:
+		case RedirectURIMatchExact:
+			for _, p := range client.RedirectURI {
+				if !p.IsExact() {
+					es = append(es, fmt.Errorf("client.%s.redirect_uri: Wildcard %#v can't use with redirect_uri_match = %#v.", id, p.String(), RedirectURIMatchExact))
+				}
+			}
+		default:
+			es = append(es, fmt.Errorf("client.%s.redirect_uri_match: Must be %#v or %#v but got %#v.", id, RedirectURIMatchExact, RedirectURIMatchWildcard, client.RedirectURIMatch))
+		}
+		if client.FrontchannelLogoutURI != "" {
+			if u, err := url.Parse(client.FrontchannelLogoutURI); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Fragment != "" {
+				es = append(es, fmt.Errorf("client.%s.frontchannel_logout_uri: Must be an absolute http:// or https:// URL without fragment but got %#v.", id, client.FrontchannelLogoutURI))
+			}
+		}
+	}
+
+	if c.Events.NATS.String() != "" {
+		switch c.Events.NATS.Scheme {
+		case "nats", "tls":
+			if c.Events.NATS.Host == "" {
+				es = append(es, errors.New("--events-nats: NATS server URL must include host like \"nats://nats.example.com:4222\"."))
+			}
+		default:
+			es = append(es, fmt.Errorf("--events-nats: NATS server URL must be nats:// or tls:// but got %#v.", c.Events.NATS.String()))
+		}
+		if c.Events.SubjectPrefix == "" || strings.ContainsAny(c.Events.SubjectPrefix, " \t\r\n*>") || strings.HasPrefix(c.Events.SubjectPrefix, ".") || strings.HasSuffix(c.Events.SubjectPrefix, ".") {
+			es = append(es, fmt.Errorf("--events-subject-prefix: Subject prefix must be like \"lauth\" or \"auth.lauth\" but got %#v.", c.Events.SubjectPrefix))
+		}
+		if c.Events.QueueSize <= 0 {
+			es = append(es, errors.New("--events-queue-size: Queue size of events must be greater than 0."))
+		}
+		if c.Events.Timeout <= 0 {
+			es = append(es, errors.New("--events-timeout: Timeout of events can't set 0 or less."))
+		}
+	}
+
+	switch c.SecretHash.Algorithm {
+	case secret.AlgorithmBcrypt:
+		if c.SecretHash.BcryptCost < bcrypt.MinCost || c.SecretHash.BcryptCost > bcrypt.MaxCost {
+			es = append(es, fmt.Errorf("--secret-hash-bcrypt-cost: Cost of bcrypt must be between %d and %d.", bcrypt.MinCost, bcrypt.MaxCost))
+		}
+	case secret.AlgorithmArgon2id:
+		if c.SecretHash.Argon2Time > secret.MaxArgon2Time {
+			es = append(es, fmt.Errorf("--secret-hash-argon2-time: Time of argon2id must be %d or less.", secret.MaxArgon2Time))
+		}
+		if c.SecretHash.Argon2Memory < 8*uint32(c.SecretHash.Argon2Threads) {
+			es = append(es, errors.New("--secret-hash-argon2-memory: Memory of argon2id must be at least 8 KiB per thread."))
+		}
+		if c.SecretHash.Argon2Memory > secret.MaxArgon2Memory {
+			es = append(es, fmt.Errorf("--secret-hash-argon2-memory: Memory of argon2id must be %d KiB or less.", secret.MaxArgon2Memory))
+		}
+	default:
+		es = append(es, fmt.Errorf("--secret-hash: Algorithm must be %#v or %#v but got %#v.", secret.AlgorithmBcrypt, secret.AlgorithmArgon2id, c.SecretHash.Algorithm))
+	}
+
+	switch c.ScopeRegistry.Unknown {
+	case "", UnknownScopeStrip, UnknownScopeReject:
+	default:
+		es = append(es, fmt.Errorf("--unknown-scope: Unknown scope handling must be %#v or %#v but got %#v.", UnknownScopeStrip, UnknownScopeReject, c.ScopeRegistry.Unknown))
+	}
+
+	for id, client := range c.Clients {
+		for _, scope := range client.ClientCredentialsScopes {
+			if scope == "openid" {
+				es = append(es, fmt.Errorf("client.%s.client_credentials_scopes: \"openid\" can't be granted by client_credentials grant because it has no user.", id))
+			}
+		}
+	}
+
+	switch c.Profile {
+	case "":
+	case ProfileOAuth21:
+		for id, client := range c.Clients {
+			if client.AllowImplicitFlow {
+				es = append(es, fmt.Errorf("client.%s.allow_implicit_flow: Implicit flow is not allowed in %s profile.", id, ProfileOAuth21))
+			}
+			if client.AllowPasswordGrant {
+				es = append(es, fmt.Errorf("client.%s.allow_password_grant: Password grant is not allowed in %s profile.", id, ProfileOAuth21))
+			}
+			for _, p := range client.RedirectURI {
+				if !p.IsExact() {
+					es = append(es, fmt.Errorf("client.%s.redirect_uri: Wildcard %#v is not allowed in %s profile. Please list exact URIs.", id, p.String(), ProfileOAuth21))
+				}
+			}
+		}
+	default:
+		es = append(es, fmt.Errorf("--profile: Profile must be empty or %#v but got %#v.", ProfileOAuth21, c.Profile))
+	}
+
+	if c.Admin.Username != "" && c.Admin.Password == "" {
+		es = append(es, errors.New("--admin-password: Admin Password is required when set Admin Username."))
+	} else if c.Admin.Username == "" && c.Admin.Password != "" {
+		es = append(es, errors.New("--admin-username: Admin Username is required when set Admin Password."))
+	}
+	if c.Admin.Enabled() && c.Admin.Path == "" {
+		es = append(es, errors.New("--admin-path: Admin Path can't set empty."))
+	}
+	switch c.Admin.ErrorFormat {
+	case ErrorFormatJSON, ErrorFormatProblem:
+	default:
+		es = append(es, fmt.Errorf("--admin-error-format: Format of errors must be %#v or %#v but got %#v.", ErrorFormatJSON, ErrorFormatProblem, c.Admin.ErrorFormat))
+	}
+	if c.Admin.Enabled() && c.Expire.Invitation <= 0 {
+		es = append(es, errors.New("--invitation-expire: Expiration of Invitation can't set 0 or less."))
+	}
 
 	if c.Metrics.Path == "" {
 		es = append(es, errors.New("--metrics-path: Metrics Path can't set empty."))
@@ -288,6 +1157,18 @@ func (c *Config) Validate() error {
 	} else if c.Metrics.Username == "" && c.Metrics.Password != "" {
 		es = append(es, errors.New("--metrics-password: Metrics Password is required when set Metrics Username."))
 	}
+	switch c.Metrics.Provider {
+	case MetricsPrometheus, MetricsNone:
+	case MetricsOTLP:
+		if u := c.Metrics.OTLPEndpoint; u.String() == "" || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			es = append(es, fmt.Errorf("--metrics-otlp-endpoint: OTLP endpoint must be http:// or https:// URL like \"http://otel-collector:4318/v1/metrics\" but got %#v.", u.String()))
+		}
+		if c.Metrics.OTLPInterval <= 0 {
+			es = append(es, errors.New("--metrics-otlp-interval: Interval to push metrics can't set 0 or less."))
+		}
+	default:
+		es = append(es, fmt.Errorf("--metrics-provider: Metrics provider must be \"prometheus\", \"otlp\", or \"none\" but got %#v.", c.Metrics.Provider))
+	}
 
 	if len(es) > 0 {
 		return es
@@ -302,16 +1183,30 @@ type ResolvedEndpointPaths struct {
 	Userinfo            string
 	Jwks                string
 	Logout              string
+	Register            string
+	Invite              string
+	QRCode              string
+	Backchannel         string
+	Admin               string
+	Errors              string
+	Session             string
 }
 
 func (c *Config) EndpointPaths() ResolvedEndpointPaths {
 	return ResolvedEndpointPaths{
-		OpenIDConfiguration: path.Join(c.Issuer.Path, "/.well-known/openid-configuration"),
-		Authz:               path.Join(c.Issuer.Path, c.Endpoints.Authz),
-		Token:               path.Join(c.Issuer.Path, c.Endpoints.Token),
-		Userinfo:            path.Join(c.Issuer.Path, c.Endpoints.Userinfo),
-		Jwks:                path.Join(c.Issuer.Path, c.Endpoints.Jwks),
-		Logout:              path.Join(c.Issuer.Path, c.Endpoints.Logout),
+		OpenIDConfiguration: JoinEndpoint(c.Issuer.Path, "/.well-known/openid-configuration"),
+		Authz:               JoinEndpoint(c.Issuer.Path, c.Endpoints.Authz),
+		Token:               JoinEndpoint(c.Issuer.Path, c.Endpoints.Token),
+		Userinfo:            JoinEndpoint(c.Issuer.Path, c.Endpoints.Userinfo),
+		Jwks:                JoinEndpoint(c.Issuer.Path, c.Endpoints.Jwks),
+		Logout:              JoinEndpoint(c.Issuer.Path, c.Endpoints.Logout),
+		Register:            JoinEndpoint(c.Issuer.Path, c.Endpoints.Register),
+		Invite:              JoinEndpoint(c.Issuer.Path, c.Endpoints.Invite),
+		QRCode:              JoinEndpoint(c.Issuer.Path, c.Endpoints.QRCode),
+		Backchannel:         JoinEndpoint(c.Issuer.Path, c.Endpoints.Backchannel),
+		Admin:               JoinEndpoint(c.Issuer.Path, c.Admin.Path),
+		Errors:              JoinEndpoint(c.Issuer.Path, "/errors"),
+		Session:             JoinEndpoint(c.Issuer.Path, "/session"),
 	}
 }
 
@@ -333,19 +1228,35 @@ type OpenIDConfiguration struct {
 	ClaimsSupported                   []string `json:"claims_supported"`
 	RequestParameterSupported         bool     `json:"request_parameter_supported"`
 	RequestURIParameterSupported      bool     `json:"request_uri_parameter_supported"`
+	PromptValuesSupported             []string `json:"prompt_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	AuthorizationResponseIssSupported bool     `json:"authorization_response_iss_parameter_supported"`
+	AuthorizationSigningAlgsSupported []string `json:"authorization_signing_alg_values_supported"`
+	FrontchannelLogoutSupported       bool     `json:"frontchannel_logout_supported"`
+
+	BackchannelAuthenticationEndpoint      string   `json:"backchannel_authentication_endpoint,omitempty"`
+	BackchannelTokenDeliveryModesSupported []string `json:"backchannel_token_delivery_modes_supported,omitempty"`
+}
+
+// EndpointURL returns the absolute URL of the endpoint, as routing serves it.
+func (c *Config) EndpointURL(endpoint string) string {
+	u := *c.Issuer.URL()
+	u.Path = JoinEndpoint(u.Path, endpoint)
+	u.RawPath = ""
+	return u.String()
 }
 
 func (c *Config) OpenIDConfiguration() OpenIDConfiguration {
 	issuer := c.Issuer.String()
 
-	return OpenIDConfiguration{
+	conf := OpenIDConfiguration{
 		Issuer:                issuer,
-		AuthorizationEndpoint: issuer + path.Join("/", c.Endpoints.Authz),
-		TokenEndpoint:         issuer + path.Join("/", c.Endpoints.Token),
-		UserinfoEndpoint:      issuer + path.Join("/", c.Endpoints.Userinfo),
-		JwksEndpoint:          issuer + path.Join("/", c.Endpoints.Jwks),
-		EndSessionEndpoint:    issuer + path.Join("/", c.Endpoints.Logout),
-		ScopesSupported:       append(c.Scopes.ScopeNames(), "openid"),
+		AuthorizationEndpoint: c.EndpointURL(c.Endpoints.Authz),
+		TokenEndpoint:         c.EndpointURL(c.Endpoints.Token),
+		UserinfoEndpoint:      c.EndpointURL(c.Endpoints.Userinfo),
+		JwksEndpoint:          c.EndpointURL(c.Endpoints.Jwks),
+		EndSessionEndpoint:    c.EndpointURL(c.Endpoints.Logout),
+		ScopesSupported:       c.KnownScopes(),
 		ResponseTypesSupported: []string{
 			"code",
 			"token",
@@ -355,14 +1266,15 @@ func (c *Config) OpenIDConfiguration() OpenIDConfiguration {
 			"token id_token",
 			"code token id_token",
 		},
-		ResponseModesSupported:            []string{"query", "fragment"},
+		ResponseModesSupported:            []string{"query", "fragment", "form_post", "query.jwt", "fragment.jwt", "form_post.jwt", "jwt"},
 		GrantTypesSupported:               []string{"authorization_code", "implicit", "refresh_token"},
 		SubjectTypesSupported:             []string{"public"},
 		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_post", "client_secret_basic"},
+		TokenEndpointAuthMethodsSupported: c.TokenEndpointAuthMethods(),
 		DisplayValuesSupported:            []string{"page"},
 		ClaimsSupported: append(
 			c.Scopes.AllClaims(),
+			"roles",
 			"iss",
 			"sub",
 			"aud",
@@ -373,10 +1285,108 @@ func (c *Config) OpenIDConfiguration() OpenIDConfiguration {
 			"nonce",
 			"c_hash",
 			"at_hash",
+			"groups_overage",
 		),
-		RequestParameterSupported:    true,
-		RequestURIParameterSupported: true,
+		RequestParameterSupported:     true,
+		RequestURIParameterSupported:  true,
+		PromptValuesSupported:         c.PromptValues(),
+		CodeChallengeMethodsSupported: []string{"plain", "S256"},
+
+		AuthorizationResponseIssSupported: true,
+		AuthorizationSigningAlgsSupported: []string{"RS256"},
+		FrontchannelLogoutSupported:       true,
+	}
+
+	if c.StrictOAuth21() {
+		conf.ResponseTypesSupported = []string{"code"}
+		conf.ResponseModesSupported = []string{"query", "form_post", "query.jwt", "form_post.jwt", "jwt"}
+		conf.GrantTypesSupported = []string{"authorization_code", "refresh_token"}
+		conf.CodeChallengeMethodsSupported = []string{"S256"}
+	}
+
+	if c.AllowsClientCredentials() {
+		conf.GrantTypesSupported = append(conf.GrantTypesSupported, "client_credentials")
+	}
+	if c.AllowsPasswordGrant() {
+		conf.GrantTypesSupported = append(conf.GrantTypesSupported, "password")
+	}
+	if c.AllowsBackchannel() {
+		conf.GrantTypesSupported = append(conf.GrantTypesSupported, GrantTypeCIBA)
+		conf.BackchannelAuthenticationEndpoint = c.EndpointURL(c.Endpoints.Backchannel)
+		conf.BackchannelTokenDeliveryModesSupported = []string{"poll"}
+	}
+
+	return conf
+}
+
+// AllowsClientCredentials checks if any client can use client_credentials grant, for the discovery document.
+func (c *Config) AllowsClientCredentials() bool {
+	for _, client := range c.Clients {
+		if client.AllowClientCredentials {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPasswordGrant checks if any client can use password grant, for the discovery document.
+func (c *Config) AllowsPasswordGrant() bool {
+	for _, client := range c.Clients {
+		if client.AllowPasswordGrant {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantTypeCIBA is the grant_type to poll the result of Client-Initiated Backchannel Authentication.
+const GrantTypeCIBA = "urn:openid:params:grant-type:ciba"
+
+// AllowsBackchannel checks if any client can use Client-Initiated Backchannel Authentication.
+func (c *Config) AllowsBackchannel() bool {
+	for _, client := range c.Clients {
+		if client.AllowBackchannel {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenEndpointAuthMethods returns the union of token_endpoint_auth_methods of all clients, for the discovery document.
+func (c *Config) TokenEndpointAuthMethods() []string {
+	used := make(map[string]bool)
+	for _, client := range c.Clients {
+		methods := client.TokenEndpointAuthMethods
+		if len(methods) == 0 {
+			methods = DefaultTokenEndpointAuthMethods
+		}
+		for _, m := range methods {
+			used[m] = true
+		}
+	}
+
+	methods := []string{}
+	for _, m := range DefaultTokenEndpointAuthMethods {
+		if used[m] || len(c.Clients) == 0 {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// StrictOAuth21 checks if the OAuth 2.1 profile is enabled.
+//
+// The profile disables implicit and hybrid flow, and requires PKCE, exact redirect URI matching, and refresh token rotation.
+func (c *Config) StrictOAuth21() bool {
+	return c.Profile == ProfileOAuth21
+}
+
+func (c *Config) PromptValues() []string {
+	values := []string{"none", "login", "consent", "select_account"}
+	if c.Register.Enable {
+		values = append(values, "create")
 	}
+	return values
 }
 
 func (c *Config) AsJSON() (string, error) {
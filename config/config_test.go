@@ -1,6 +1,9 @@
 package config_test
 
 import (
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -37,6 +40,7 @@ func TestTakeOptions(t *testing.T) {
 func TestLoadConfig(t *testing.T) {
 	raw := strings.NewReader(`
 issuer = "http://example.com:1234"
+old_issuers = ["http://old.example.com", "https://older.example.com/path"]
 listen = ":4200"
 
 [expire]
@@ -59,6 +63,10 @@ secret = "$2a$10$fU1PBoQ6V4a3Mbg4BI5yJemdSU4bE5LogDMFG55n5C761X0/tzAkW"
 		t.Errorf("unexpected issuer: %s", conf.Issuer)
 	}
 
+	if len(conf.OldIssuers) != 2 || conf.OldIssuers[0].String() != "http://old.example.com" || conf.OldIssuers[1].String() != "https://older.example.com/path" {
+		t.Errorf("unexpected old issuers: %v", conf.OldIssuers)
+	}
+
 	if conf.Listen.String() != ":4200" {
 		t.Errorf("unexpected listen address: %s", conf.Listen)
 	}
@@ -155,6 +163,10 @@ func TestConfig_EndpointPaths(t *testing.T) {
 	if endpoints.Jwks != "/path/to/jwks" {
 		t.Errorf("unexpected jwks endpoint: %s", endpoints.Jwks)
 	}
+
+	if endpoints.Errors != "/path/to/errors" {
+		t.Errorf("unexpected errors path: %s", endpoints.Errors)
+	}
 }
 
 func TestConfig_OpenIDConfiguration(t *testing.T) {
@@ -177,4 +189,1168 @@ func TestConfig_OpenIDConfiguration(t *testing.T) {
 	if oidconfig.TokenEndpoint != "https://test.example.com/path/to/login/token" {
 		t.Errorf("unexpected issuer: %s", oidconfig.TokenEndpoint)
 	}
+
+	if !oidconfig.AuthorizationResponseIssSupported {
+		t.Errorf("authorization_response_iss_parameter_supported should be true")
+	}
+}
+
+func TestConfig_OpenIDConfiguration_TrailingSlash(t *testing.T) {
+	conf := config.Config{
+		Issuer: &config.URL{Scheme: "https", Host: "test.example.com", Path: "/path/to/"},
+		Endpoints: config.EndpointConfig{
+			Authz: "/login/",
+		},
+	}
+
+	if authz := conf.OpenIDConfiguration().AuthorizationEndpoint; authz != "https://test.example.com/path/to/login" {
+		t.Errorf("unexpected authorization endpoint: %s", authz)
+	}
+	if authz := conf.EndpointPaths().Authz; authz != "/path/to/login" {
+		t.Errorf("unexpected authorization endpoint path: %s", authz)
+	}
+
+	ws := conf.EndpointWarnings()
+	if len(ws) != 2 || !strings.HasPrefix(ws[0], "--issuer: ") || !strings.HasPrefix(ws[1], `--authz-endpoint: Endpoint "/login/" is served and advertised as "/login".`) {
+		t.Errorf("unexpected warnings: %v", ws)
+	}
+}
+
+func TestConfig_Validate_Endpoints(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Modify func(c *config.Config)
+		Error  string
+	}{
+		{"default", func(c *config.Config) {}, ""},
+		{"empty", func(c *config.Config) { c.Endpoints.Token = "" }, "--token-endpoint: Endpoint path can't set empty."},
+		{"relative", func(c *config.Config) { c.Endpoints.Token = "token" }, `--token-endpoint: Endpoint path must start with "/" but got "token".`},
+		{"absolute URL", func(c *config.Config) { c.Endpoints.Token = "https://example.com/token" }, `--token-endpoint: Endpoint must be a path relative to the Issuer URL like "/authz" but got "https://example.com/token".`},
+		{"outside of issuer", func(c *config.Config) { c.Issuer.Path = "/auth"; c.Endpoints.Token = "/../token" }, `--token-endpoint: Endpoint must be under the Issuer URL but got "/../token".`},
+		{"issuer itself", func(c *config.Config) { c.Endpoints.Token = "/" }, "--token-endpoint: Endpoint path can't be the same as the Issuer URL."},
+		{"same path", func(c *config.Config) { c.Endpoints.Userinfo = "/login/token/" }, `--token-endpoint: Endpoint "/login/token" collides with --userinfo-endpoint "/login/token".`},
+		{"fixed path", func(c *config.Config) { c.Endpoints.Logout = "/healthz" }, `--logout-endpoint: Endpoint "/healthz" collides with /healthz "/healthz".`},
+		{"under prefix", func(c *config.Config) { c.Endpoints.Invite = "/errors/invite" }, `--invite-endpoint: Endpoint "/errors/invite" collides with /errors "/errors".`},
+		{"metrics", func(c *config.Config) { c.Metrics.Path = "/login" }, `--authz-endpoint: Endpoint "/login" collides with --metrics-path "/login".`},
+		{"metrics disabled", func(c *config.Config) { c.Metrics.Path = "/login"; c.Metrics.Provider = "none" }, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			tt.Modify(conf)
+
+			err := conf.Validate()
+			if tt.Error == "" {
+				if err != nil && strings.Contains(err.Error(), "Endpoint") {
+					t.Errorf("unexpected error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.Error) {
+				t.Errorf("expected error %#v but got %v", tt.Error, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_Expire(t *testing.T) {
+	tests := []struct {
+		Code    time.Duration
+		Token   time.Duration
+		Refresh time.Duration
+		Error   string
+	}{
+		{time.Minute, time.Hour, 24 * time.Hour, ""},
+		{time.Minute, time.Hour, 0, ""},
+		{time.Hour, time.Hour, 24 * time.Hour, "--code-expire: Expiration of Code must be shorter than Expiration of Token."},
+		{time.Minute, time.Hour, 30 * time.Minute, "--refresh-expire: Expiration of Refresh Token can't be shorter than Expiration of Token."},
+	}
+
+	for _, tt := range tests {
+		conf := &config.Config{}
+		if err := conf.Load("../config.example.toml", nil); err != nil {
+			t.Fatalf("failed to load example config: %s", err)
+		}
+		conf.Expire.Code = config.Duration(tt.Code)
+		conf.Expire.Token = config.Duration(tt.Token)
+		conf.Expire.Refresh = config.Duration(tt.Refresh)
+
+		msg := ""
+		if err := conf.Validate(); err != nil {
+			msg = err.Error()
+		}
+
+		for _, m := range []string{"--code-expire", "--refresh-expire"} {
+			if strings.Contains(tt.Error, m) != strings.Contains(msg, m) {
+				t.Errorf("code=%s token=%s refresh=%s: unexpected validation result: %s", tt.Code, tt.Token, tt.Refresh, msg)
+			}
+		}
+		if tt.Error != "" && !strings.Contains(msg, tt.Error) {
+			t.Errorf("code=%s token=%s refresh=%s: expected error %#v but got %#v", tt.Code, tt.Token, tt.Refresh, tt.Error, msg)
+		}
+	}
+}
+
+func TestConfig_Validate_Headers(t *testing.T) {
+	tests := []struct {
+		Headers map[string]string
+		Error   string
+	}{
+		{map[string]string{"x-robots-tag": "noindex"}, ""},
+		{map[string]string{"x robots tag": "noindex"}, `headers.pages: Invalid header name: "x robots tag"`},
+		{map[string]string{"x-robots-tag": "noindex\r\nx-injected: yes"}, `headers.pages: Invalid value of x-robots-tag header`},
+	}
+
+	for _, tt := range tests {
+		conf := &config.Config{}
+		if err := conf.Load("../config.example.toml", nil); err != nil {
+			t.Fatalf("failed to load example config: %s", err)
+		}
+		if conf.Headers.Pages["x-robots-tag"] != "noindex, nofollow" {
+			t.Errorf("expected X-Robots-Tag in the example config but got %#v", conf.Headers.Pages)
+		}
+		conf.Headers.Pages = tt.Headers
+
+		msg := ""
+		if err := conf.Validate(); err != nil {
+			msg = err.Error()
+		}
+
+		if strings.Contains(msg, "headers.") != (tt.Error != "") || !strings.Contains(msg, tt.Error) {
+			t.Errorf("%#v: expected error %#v but got %#v", tt.Headers, tt.Error, msg)
+		}
+	}
+}
+
+// clientSecretHash is the hash of "secret" that made by gen-client command.
+const clientSecretHash = "$2a$04$SP26R0o8pwa8rU1FTvHI4e4rkwHu0lE6QlNyK1oZXQwZ1.zFC7ft6"
+
+func TestConfig_Validate_Profile(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+
+	var wildcard config.Pattern
+	if err := wildcard.UnmarshalText([]byte("http://*.example.com/callback")); err != nil {
+		t.Fatalf("failed to parse pattern: %s", err)
+	}
+	conf.Clients = config.ClientConfigSet{
+		"implicit": {Secret: clientSecretHash, AllowImplicitFlow: true},
+		"wildcard": {Secret: clientSecretHash, RedirectURI: config.PatternSet{wildcard}},
+	}
+	if err := conf.Validate(); err != nil && strings.Contains(err.Error(), "client.") {
+		t.Fatalf("failed to validate without profile: %s", err)
+	}
+
+	conf.Profile = "oauth3"
+	if err := conf.Validate(); err == nil || !strings.Contains(err.Error(), "--profile: Profile must be empty or") {
+		t.Errorf("expected invalid profile error but got %v", err)
+	}
+
+	conf.Profile = config.ProfileOAuth21
+	err := conf.Validate()
+	if err == nil {
+		t.Fatalf("expected error but got nil")
+	}
+	for _, msg := range []string{
+		"client.implicit.allow_implicit_flow: Implicit flow is not allowed in oauth2.1 profile.",
+		`client.wildcard.redirect_uri: Wildcard "http://*.example.com/callback" is not allowed in oauth2.1 profile.`,
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error %#v but got %#v", msg, err.Error())
+		}
+	}
+}
+
+func TestConfig_Validate_RedirectURIMatch(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+
+	var exact, wildcard config.Pattern
+	exact.UnmarshalText([]byte("http://example.com/callback"))
+	wildcard.UnmarshalText([]byte("http://*.example.com/callback"))
+
+	conf.Clients = config.ClientConfigSet{
+		"exact":    {Secret: clientSecretHash, RedirectURIMatch: "exact", RedirectURI: config.PatternSet{exact, wildcard}},
+		"wildcard": {Secret: clientSecretHash, RedirectURIMatch: "wildcard", RedirectURI: config.PatternSet{exact, wildcard}},
+		"invalid":  {Secret: clientSecretHash, RedirectURIMatch: "prefix"},
+	}
+	err := conf.Validate()
+	if err == nil {
+		t.Fatalf("expected error but got nil")
+	}
+	for _, msg := range []string{
+		`client.exact.redirect_uri: Wildcard "http://*.example.com/callback" can't use with redirect_uri_match = "exact".`,
+		`client.invalid.redirect_uri_match: Must be "exact" or "wildcard" but got "prefix".`,
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error %#v but got %#v", msg, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "client.wildcard.") {
+		t.Errorf("unexpected error for wildcard client: %#v", err.Error())
+	}
+}
+
+func TestConfig_Validate_Server(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+
+	if conf.Server.ReadHeaderTimeout.Duration() != 5*time.Second || conf.Server.IdleTimeout.Duration() != 2*time.Minute {
+		t.Errorf("unexpected timeouts in example config: %#v", conf.Server)
+	}
+
+	conf.Server.ReadTimeout = config.Duration(-time.Second)
+	conf.Server.IdleTimeout = config.Duration(-time.Second)
+
+	err := conf.Validate()
+	if err == nil {
+		t.Fatalf("expected error but got nil")
+	}
+	for _, msg := range []string{
+		"--server-read-timeout: Timeout can't set less than 0.",
+		"--server-idle-timeout: Timeout can't set less than 0.",
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error %#v but got %#v", msg, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "--server-write-timeout") {
+		t.Errorf("unexpected error for write timeout: %#v", err.Error())
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	yml := "issuer: http://localhost:8000\nserver:\n  read_timeout: 1m\n  write_timeout: 2m\n"
+	if err := os.WriteFile(path, []byte(yml), 0600); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+
+	conf = &config.Config{}
+	if err := conf.Load(path, nil); err != nil {
+		t.Fatalf("failed to load YAML config: %s", err)
+	}
+	if conf.Server.ReadTimeout.Duration() != time.Minute || conf.Server.WriteTimeout.Duration() != 2*time.Minute {
+		t.Errorf("unexpected timeouts from YAML: %#v", conf.Server)
+	}
+}
+
+func TestConfig_Validate_LDAPBind(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Modify func(c *config.Config)
+		Errors []string
+	}{
+		{
+			Name:   "simple",
+			Modify: func(c *config.Config) {},
+		},
+		{
+			Name: "external-with-cert",
+			Modify: func(c *config.Config) {
+				c.LDAP.Bind = config.LDAPBindExternal
+				c.LDAP.Password = ""
+				c.LDAP.ClientCert = "/path/to/client.crt"
+				c.LDAP.ClientKey = "/path/to/client.key"
+			},
+		},
+		{
+			Name: "external-ldapi",
+			Modify: func(c *config.Config) {
+				c.LDAP.Server = &config.URL{Scheme: "ldapi", Path: "/var/run/slapd/ldapi"}
+				c.LDAP.Bind = config.LDAPBindExternal
+				c.LDAP.Password = ""
+			},
+		},
+		{
+			Name: "external-without-cert",
+			Modify: func(c *config.Config) {
+				c.LDAP.Bind = config.LDAPBindExternal
+				c.LDAP.ClientKey = "/path/to/client.key"
+			},
+			Errors: []string{
+				"--ldap-client-cert, --ldap-client-key: Please set both of client certificate and key.",
+				"--ldap-client-cert: Client certificate is required for external bind, except for ldapi://.",
+			},
+		},
+		{
+			Name: "external-without-tls",
+			Modify: func(c *config.Config) {
+				c.LDAP.Bind = config.LDAPBindExternal
+				c.LDAP.ClientCert = "/path/to/client.crt"
+				c.LDAP.ClientKey = "/path/to/client.key"
+				c.LDAP.DisableTLS = true
+			},
+			Errors: []string{"--ldap-client-cert: Client certificate can't use with --ldap-disable-tls."},
+		},
+		{
+			Name: "simple-without-password",
+			Modify: func(c *config.Config) {
+				c.LDAP.Password = ""
+			},
+			Errors: []string{"--ldap-password: LDAP Password is required."},
+		},
+		{
+			Name: "gssapi",
+			Modify: func(c *config.Config) {
+				c.LDAP.Bind = "gssapi"
+			},
+			Errors: []string{`--ldap-bind: Kerberos (GSSAPI) bind is not supported. Please use "external" with a client certificate to bind without password.`},
+		},
+		{
+			Name: "unknown",
+			Modify: func(c *config.Config) {
+				c.LDAP.Bind = "digest-md5"
+			},
+			Errors: []string{`--ldap-bind: LDAP bind method must be "simple" or "external" but got "digest-md5".`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			conf.LDAP.Server = &config.URL{Scheme: "ldap", Host: "ldap.example.com"}
+			conf.LDAP.User = "CN=lauth,DC=example,DC=com"
+			conf.LDAP.Password = "secret"
+			conf.LDAP.BaseDN = "DC=example,DC=com"
+			tt.Modify(conf)
+
+			err := conf.Validate()
+			if len(tt.Errors) == 0 {
+				if err != nil && strings.Contains(err.Error(), "--ldap") {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error but got nil")
+			}
+			for _, msg := range tt.Errors {
+				if !strings.Contains(err.Error(), msg) {
+					t.Errorf("expected error %#v but got %#v", msg, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestClientConfig_MatchRedirectURI(t *testing.T) {
+	var exact, wildcard config.Pattern
+	exact.UnmarshalText([]byte("http://example.com/callback"))
+	wildcard.UnmarshalText([]byte("http://*.example.com/callback"))
+
+	tests := []struct {
+		Mode   string
+		Input  string
+		Expect bool
+	}{
+		{"", "http://example.com/callback", true},
+		{"", "http://sub.example.com/callback", true},
+		{"wildcard", "http://sub.example.com/callback", true},
+		{"exact", "http://example.com/callback", true},
+		{"exact", "http://sub.example.com/callback", false},
+		{"exact", "http://example.com/callback?foo=bar", false},
+		{"exact", "http://example.com/callback/", false},
+	}
+
+	for _, tt := range tests {
+		c := config.ClientConfig{
+			RedirectURI:      config.PatternSet{exact, wildcard},
+			RedirectURIMatch: tt.Mode,
+		}
+		if got := c.MatchRedirectURI(tt.Input); got != tt.Expect {
+			t.Errorf("%#v / %#v: expected %t but got %t", tt.Mode, tt.Input, tt.Expect, got)
+		}
+	}
+}
+
+func TestExpireConfig_Limits(t *testing.T) {
+	conf := config.ExpireConfig{
+		Login:   config.Duration(time.Hour),
+		Code:    config.Duration(2 * time.Hour),
+		Token:   config.Duration(7 * 24 * time.Hour),
+		Refresh: config.Duration(7 * 24 * time.Hour),
+		SSO:     config.Duration(14 * 24 * time.Hour),
+	}
+
+	es := conf.Errors()
+	if len(es) != 1 || !strings.HasPrefix(es[0].Error(), "--code-expire: Expiration of Code is too long (2h).") {
+		t.Errorf("unexpected errors: %v", es)
+	}
+
+	ws := conf.Warnings()
+	if len(ws) != 2 || !strings.HasPrefix(ws[0], "--code-expire:") || !strings.HasPrefix(ws[1], "--token-expire:") {
+		t.Errorf("unexpected warnings: %v", ws)
+	}
+
+	conf.AllowLong = true
+	if es := conf.Errors(); len(es) != 0 {
+		t.Errorf("unexpected errors even though allowed: %v", es)
+	}
+	if ws := conf.Warnings(); len(ws) != 2 {
+		t.Errorf("warnings should not be suppressed: %v", ws)
+	}
+}
+
+func TestConfig_Hash(t *testing.T) {
+	load := func() *config.Config {
+		conf := &config.Config{}
+		if err := conf.Load("../config.example.toml", nil); err != nil {
+			t.Fatalf("failed to load example config: %s", err)
+		}
+		return conf
+	}
+
+	a, b := load(), load()
+	if a.Hash() == "" || a.Hash() != b.Hash() {
+		t.Fatalf("same config must have same hash: %#v != %#v", a.Hash(), b.Hash())
+	}
+
+	b.Listen = &config.TCPAddr{}
+	if a.Hash() != b.Hash() {
+		t.Errorf("listen address must not affect to hash")
+	}
+
+	b.Expire.Token = config.Duration(2 * time.Hour)
+	if a.Hash() == b.Hash() {
+		t.Errorf("different config must have different hash")
+	}
+
+	c, d := load(), load()
+	c.LDAP.Password = "first-password"
+	d.LDAP.Password = "second-password"
+	c.Admin.Password = "first-password"
+	d.Admin.Password = "second-password"
+	c.Metrics.Password = "first-password"
+	d.Metrics.Password = "second-password"
+	c.LDAP.Server = &config.URL{Scheme: "ldap", Host: "localhost", User: url.UserPassword("cn=admin", "first-password")}
+	d.LDAP.Server = &config.URL{Scheme: "ldap", Host: "localhost", User: url.UserPassword("cn=admin", "second-password")}
+	c.Clients = config.ClientConfigSet{"some_client": {Secret: "first secret"}}
+	d.Clients = config.ClientConfigSet{"some_client": {Secret: "second secret"}}
+	c.ClaimSources = []config.ClaimSourceConfig{{Name: "hr", Headers: map[string]string{"Authorization": "Bearer first"}}}
+	d.ClaimSources = []config.ClaimSourceConfig{{Name: "hr", Headers: map[string]string{"Authorization": "Bearer second"}}}
+	if c.Hash() != d.Hash() {
+		t.Errorf("secrets must not affect to hash")
+	}
+	if c.LDAP.Password != "first-password" || c.ClaimSources[0].Headers["Authorization"] != "Bearer first" {
+		t.Errorf("hash must not change the original config")
+	}
+}
+
+func TestClientConfig_AllowsPKCEMethod(t *testing.T) {
+	tests := []struct {
+		Methods []string
+		Method  string
+		Expect  bool
+	}{
+		{nil, "", true},
+		{nil, "S256", true},
+		{[]string{"S256"}, "S256", true},
+		{[]string{"S256"}, "plain", false},
+		{[]string{"S256"}, "", false},
+		{[]string{"plain"}, "", true},
+	}
+
+	for _, tt := range tests {
+		c := config.ClientConfig{PKCEMethods: tt.Methods}
+		if got := c.AllowsPKCEMethod(tt.Method); got != tt.Expect {
+			t.Errorf("%v / %#v: expected %t but got %t", tt.Methods, tt.Method, tt.Expect, got)
+		}
+	}
+}
+
+func TestConfig_TokenEndpointAuthMethods(t *testing.T) {
+	basic := config.ClientConfig{TokenEndpointAuthMethods: []string{config.TokenEndpointAuthClientSecretBasic}}
+	post := config.ClientConfig{TokenEndpointAuthMethods: []string{config.TokenEndpointAuthClientSecretPost}}
+
+	tests := []struct {
+		Clients config.ClientConfigSet
+		Expect  []string
+	}{
+		{nil, []string{"client_secret_post", "client_secret_basic"}},
+		{config.ClientConfigSet{"a": basic}, []string{"client_secret_basic"}},
+		{config.ClientConfigSet{"a": basic, "b": post}, []string{"client_secret_post", "client_secret_basic"}},
+		{config.ClientConfigSet{"a": basic, "b": {}}, []string{"client_secret_post", "client_secret_basic"}},
+	}
+
+	for i, tt := range tests {
+		conf := &config.Config{Clients: tt.Clients}
+		if methods := conf.TokenEndpointAuthMethods(); !reflect.DeepEqual(methods, tt.Expect) {
+			t.Errorf("%d: expected %#v but got %#v", i, tt.Expect, methods)
+		}
+	}
+
+	if basic.AllowsTokenEndpointAuthMethod(config.TokenEndpointAuthClientSecretPost) {
+		t.Errorf("client_secret_post should not be allowed")
+	}
+	if !(config.ClientConfig{}).AllowsTokenEndpointAuthMethod(config.TokenEndpointAuthClientSecretPost) {
+		t.Errorf("client_secret_post should be allowed in default")
+	}
+
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+	conf.Clients = config.ClientConfigSet{
+		"jwt": {Secret: clientSecretHash, TokenEndpointAuthMethods: []string{"private_key_jwt"}},
+	}
+	msg := `client.jwt.token_endpoint_auth_methods: Method must be "client_secret_post" or "client_secret_basic" but got "private_key_jwt".`
+	if err := conf.Validate(); err == nil || !strings.Contains(err.Error(), msg) {
+		t.Errorf("expected error %#v but got %v", msg, err)
+	}
+}
+
+func TestConfig_Validate_ClientSecret(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+	conf.Clients = config.ClientConfigSet{
+		"good":  {Secret: clientSecretHash},
+		"plain": {Secret: "secret"},
+		"zero":  {Secret: "$argon2id$v=19$m=1024,t=0,p=4$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"},
+	}
+
+	err := conf.Validate()
+	for _, msg := range []string{
+		"client.plain.secret: Secret must be a hash that made by gen-client command:",
+		"client.zero.secret: Secret must be a hash that made by gen-client command: invalid hash format",
+	} {
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error %#v but got %v", msg, err)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "client.good.") {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestConfig_Validate_SecretHash(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Modify func(c *config.SecretHashConfig)
+		Error  string
+	}{
+		{
+			Name:   "bcrypt",
+			Modify: func(c *config.SecretHashConfig) {},
+		},
+		{
+			Name: "argon2id",
+			Modify: func(c *config.SecretHashConfig) {
+				c.Algorithm = "argon2id"
+			},
+		},
+		{
+			Name: "bcrypt-cost",
+			Modify: func(c *config.SecretHashConfig) {
+				c.BcryptCost = 32
+			},
+			Error: "--secret-hash-bcrypt-cost: Cost of bcrypt must be between 4 and 31.",
+		},
+		{
+			Name: "argon2-memory",
+			Modify: func(c *config.SecretHashConfig) {
+				c.Algorithm = "argon2id"
+				c.Argon2Memory = 16
+			},
+			Error: "--secret-hash-argon2-memory: Memory of argon2id must be at least 8 KiB per thread.",
+		},
+		{
+			Name: "argon2-memory-limit",
+			Modify: func(c *config.SecretHashConfig) {
+				c.Algorithm = "argon2id"
+				c.Argon2Memory = 4 * 1024 * 1024
+			},
+			Error: "--secret-hash-argon2-memory: Memory of argon2id must be 1048576 KiB or less.",
+		},
+		{
+			Name: "argon2-time-limit",
+			Modify: func(c *config.SecretHashConfig) {
+				c.Algorithm = "argon2id"
+				c.Argon2Time = 100
+			},
+			Error: "--secret-hash-argon2-time: Time of argon2id must be 16 or less.",
+		},
+		{
+			Name: "unknown",
+			Modify: func(c *config.SecretHashConfig) {
+				c.Algorithm = "md5"
+			},
+			Error: `--secret-hash: Algorithm must be "bcrypt" or "argon2id" but got "md5".`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			tt.Modify(&conf.SecretHash)
+
+			err := conf.Validate()
+			if tt.Error == "" {
+				if err != nil && strings.Contains(err.Error(), "--secret-hash") {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.Error) {
+				t.Errorf("expected error %#v but got %v", tt.Error, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_AuditSyslog(t *testing.T) {
+	tests := []struct {
+		Syslog string
+		Format string
+		Error  string
+	}{
+		{Syslog: "", Format: "json"},
+		{Syslog: "udp://syslog.example.com", Format: "json"},
+		{Syslog: "tls://syslog.example.com:6514", Format: "cef"},
+		{Syslog: "http://syslog.example.com", Format: "json", Error: `--audit-syslog: Syslog server URL must be udp://, tcp://, or tls:// but got "http://syslog.example.com".`},
+		{Syslog: "tcp:///path", Format: "json", Error: `--audit-syslog: Syslog server URL must include host like "tls://syslog.example.com:6514".`},
+		{Syslog: "udp://syslog.example.com", Format: "leef", Error: `--audit-syslog-format: Format of syslog must be "json" or "cef" but got "leef".`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Syslog+"/"+tt.Format, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			if tt.Syslog != "" {
+				conf.Audit.Syslog = &config.URL{}
+				conf.Audit.Syslog.UnmarshalText([]byte(tt.Syslog))
+			}
+			conf.Audit.SyslogFormat = tt.Format
+
+			err := conf.Validate()
+			if tt.Error == "" {
+				if err != nil && strings.Contains(err.Error(), "--audit") {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.Error) {
+				t.Errorf("expected error %#v but got %v", tt.Error, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_Events(t *testing.T) {
+	tests := []struct {
+		NATS   string
+		Prefix string
+		Error  string
+	}{
+		{NATS: "", Prefix: ""},
+		{NATS: "nats://nats.example.com:4222", Prefix: "lauth"},
+		{NATS: "tls://nats.example.com", Prefix: "auth.lauth"},
+		{NATS: "kafka://kafka.example.com", Prefix: "lauth", Error: `--events-nats: NATS server URL must be nats:// or tls:// but got "kafka://kafka.example.com".`},
+		{NATS: "nats:///path", Prefix: "lauth", Error: `--events-nats: NATS server URL must include host like "nats://nats.example.com:4222".`},
+		{NATS: "nats://nats.example.com", Prefix: "lauth.*", Error: `--events-subject-prefix: Subject prefix must be like "lauth" or "auth.lauth" but got "lauth.*".`},
+		{NATS: "nats://nats.example.com", Prefix: "lauth.", Error: `--events-subject-prefix: Subject prefix must be like "lauth" or "auth.lauth" but got "lauth.".`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.NATS+"/"+tt.Prefix, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			if tt.NATS != "" {
+				conf.Events.NATS = &config.URL{}
+				conf.Events.NATS.UnmarshalText([]byte(tt.NATS))
+			}
+			conf.Events.SubjectPrefix = tt.Prefix
+
+			err := conf.Validate()
+			if tt.Error == "" {
+				if err != nil && strings.Contains(err.Error(), "--events") {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.Error) {
+				t.Errorf("expected error %#v but got %v", tt.Error, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_AdminErrorFormat(t *testing.T) {
+	tests := []struct {
+		Format string
+		Error  string
+	}{
+		{Format: "json"},
+		{Format: "problem"},
+		{Format: "xml", Error: `--admin-error-format: Format of errors must be "json" or "problem" but got "xml".`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Format, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			conf.Admin.ErrorFormat = tt.Format
+
+			err := conf.Validate()
+			if tt.Error == "" {
+				if err != nil && strings.Contains(err.Error(), "--admin-error-format") {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.Error) {
+				t.Errorf("expected error %#v but got %v", tt.Error, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_TLSRedirect(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Auto     bool
+		Redirect string
+		Error    string
+	}{
+		{Name: "disabled"},
+		{Name: "with TLS", Auto: true, Redirect: ":80"},
+		{Name: "without TLS", Redirect: ":80", Error: "--tls-redirect: HTTP redirect is available only when use TLS."},
+		{Name: "same port", Auto: true, Redirect: ":443", Error: "--tls-redirect: Can't use the same port as the listen address: 443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			conf.Issuer = &config.URL{Scheme: "https", Host: "auth.example.com"}
+			conf.Listen = &config.TCPAddr{Port: 443}
+			conf.TLS.Auto = tt.Auto
+			if tt.Redirect != "" {
+				conf.TLS.Redirect = &config.TCPAddr{}
+				if err := conf.TLS.Redirect.UnmarshalText([]byte(tt.Redirect)); err != nil {
+					t.Fatalf("failed to parse address: %s", err)
+				}
+			}
+
+			err := conf.Validate()
+			if tt.Error == "" {
+				if err != nil && strings.Contains(err.Error(), "--tls-redirect") {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.Error) {
+				t.Errorf("expected error %#v but got %v", tt.Error, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_SSOMaxLifetime(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Sliding     bool
+		MaxLifetime time.Duration
+		Error       bool
+	}{
+		{"disabled", false, time.Hour, false},
+		{"longer than sso-expire", true, 30 * 24 * time.Hour, false},
+		{"shorter than sso-expire", true, time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			conf.SSO.Sliding = tt.Sliding
+			conf.SSO.MaxLifetime = config.Duration(tt.MaxLifetime)
+
+			err := conf.Validate()
+			hasError := err != nil && strings.Contains(err.Error(), "--sso-max-lifetime: Max lifetime of SSO session can't be shorter than --sso-expire.")
+			if hasError != tt.Error {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_ClientCredentialsScopes(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+	conf.Clients = config.ClientConfigSet{
+		"daemon": {
+			AllowClientCredentials:  true,
+			ClientCredentialsScopes: []string{"api:read", "openid"},
+		},
+	}
+
+	msg := "client.daemon.client_credentials_scopes: \"openid\" can't be granted by client_credentials grant because it has no user."
+	if err := conf.Validate(); err == nil || !strings.Contains(err.Error(), msg) {
+		t.Errorf("expected error %#v but got %v", msg, err)
+	}
+}
+
+func TestConfig_Validate_PasswordGrantInOAuth21(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+	conf.Profile = config.ProfileOAuth21
+	conf.Clients = config.ClientConfigSet{
+		"legacy": {
+			AllowPasswordGrant: true,
+		},
+	}
+
+	msg := "client.legacy.allow_password_grant: Password grant is not allowed in oauth2.1 profile."
+	if err := conf.Validate(); err == nil || !strings.Contains(err.Error(), msg) {
+		t.Errorf("expected error %#v but got %v", msg, err)
+	}
+}
+
+func TestConfig_Validate_IDTokenOverflow(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+	if conf.IDToken.Overflow != config.IDTokenOverflowUserinfo {
+		t.Errorf("unexpected default overflow strategy: %#v", conf.IDToken.Overflow)
+	}
+
+	conf.IDToken.MaxSize = -1
+	conf.IDToken.Overflow = "truncate"
+
+	err := conf.Validate()
+	for _, msg := range []string{
+		"--id-token-max-size: Max size of ID Token can't set less than 0.",
+		`--id-token-overflow: Overflow strategy must be "userinfo", "error", or "warn" but got "truncate".`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error %#v but got %v", msg, err)
+		}
+	}
+}
+
+func TestConfig_Validate_MetricsProvider(t *testing.T) {
+	tests := []struct {
+		Metrics config.MetricsConfig
+		Error   string
+	}{
+		{config.MetricsConfig{Provider: "prometheus"}, ""},
+		{config.MetricsConfig{Provider: "none"}, ""},
+		{config.MetricsConfig{Provider: "otlp", OTLPEndpoint: &config.URL{Scheme: "http", Host: "otel-collector:4318", Path: "/v1/metrics"}, OTLPInterval: config.Duration(time.Minute)}, ""},
+		{config.MetricsConfig{Provider: "otlp", OTLPInterval: config.Duration(time.Minute)}, "--metrics-otlp-endpoint: "},
+		{config.MetricsConfig{Provider: "otlp", OTLPEndpoint: &config.URL{Scheme: "http", Host: "otel-collector:4318"}}, "--metrics-otlp-interval: "},
+		{config.MetricsConfig{Provider: "statsd"}, `--metrics-provider: Metrics provider must be "prometheus", "otlp", or "none" but got "statsd".`},
+	}
+
+	for _, tt := range tests {
+		conf := &config.Config{}
+		if err := conf.Load("../config.example.toml", nil); err != nil {
+			t.Fatalf("failed to load example config: %s", err)
+		}
+		tt.Metrics.Path = "/metrics"
+		conf.Metrics = tt.Metrics
+
+		err := conf.Validate()
+		if tt.Error == "" {
+			if err != nil && strings.Contains(err.Error(), "metrics") {
+				t.Errorf("%#v: unexpected error: %s", tt.Metrics.Provider, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.Error) {
+			t.Errorf("%#v: expected error %#v but got %v", tt.Metrics.Provider, tt.Error, err)
+		}
+	}
+}
+
+func TestConfig_Validate_FrontchannelLogoutURI(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+	conf.Clients = config.ClientConfigSet{
+		"good": {Secret: clientSecretHash, FrontchannelLogoutURI: "https://good.example.com/logout"},
+		"bad":  {FrontchannelLogoutURI: "/logout"},
+	}
+
+	err := conf.Validate()
+	msg := `client.bad.frontchannel_logout_uri: Must be an absolute http:// or https:// URL without fragment but got "/logout".`
+	if err == nil || !strings.Contains(err.Error(), msg) {
+		t.Errorf("expected error %#v but got %v", msg, err)
+	}
+	if strings.Contains(err.Error(), "client.good.") {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestConfig_Validate_ResponseMode(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Config config.ResponseModeConfig
+		Error  string
+	}{
+		{Name: "default", Config: config.ResponseModeConfig{Code: "query", Implicit: "fragment"}},
+		{Name: "fragment for code", Config: config.ResponseModeConfig{Code: "fragment", Implicit: "fragment"}},
+		{Name: "unknown mode", Config: config.ResponseModeConfig{Code: "form_post", Implicit: "fragment"}, Error: `--response-mode-code: Response mode must be "query" or "fragment" but got "form_post".`},
+		{Name: "query for implicit", Config: config.ResponseModeConfig{Code: "query", Implicit: "query"}, Error: `--response-mode-implicit: Default response mode of implicit/hybrid flow can't be "query", because it exposes tokens in URL.`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			conf := &config.Config{}
+			if err := conf.Load("../config.example.toml", nil); err != nil {
+				t.Fatalf("failed to load example config: %s", err)
+			}
+			conf.ResponseMode = tt.Config
+
+			err := conf.Validate()
+			if tt.Error == "" {
+				if err != nil && strings.Contains(err.Error(), "--response-mode") {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.Error) {
+				t.Errorf("expected error %#v but got %v", tt.Error, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_LoginNotify(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Modify func(c *config.Config)
+		Error  string
+	}{
+		{"disabled", func(c *config.Config) {}, ""},
+		{"enabled", func(c *config.Config) {
+			c.Login.NotifyThreshold = 3
+			c.SMTP = config.SMTPConfig{Server: &config.URL{Scheme: "smtp", Host: "mail.example.com:587"}, From: "lauth@example.com"}
+		}, ""},
+		{"negative", func(c *config.Config) {
+			c.Login.NotifyThreshold = -1
+		}, "--login-notify-threshold: Threshold can't set less than 0."},
+		{"without smtp", func(c *config.Config) {
+			c.Login.NotifyThreshold = 3
+		}, "--smtp-server: SMTP Server is required to send notifications of failed logins."},
+		{"greater than lockout", func(c *config.Config) {
+			c.Login.NotifyThreshold = 5
+			c.Login.LockoutThreshold = 3
+		}, "--login-notify-threshold: Threshold can't set greater than --login-lockout-threshold"},
+		{"without attribute", func(c *config.Config) {
+			c.Login.NotifyThreshold = 3
+			c.Login.NotifyAttribute = ""
+		}, "--login-notify-attribute: "},
+		{"without duration", func(c *config.Config) {
+			c.Login.NotifyThreshold = 3
+			c.Login.LockoutDuration = 0
+		}, "--login-lockout-duration: "},
+	}
+
+	for _, tt := range tests {
+		conf := &config.Config{}
+		if err := conf.Load("../config.example.toml", nil); err != nil {
+			t.Fatalf("failed to load example config: %s", err)
+		}
+		tt.Modify(conf)
+
+		err := conf.Validate()
+		if tt.Error == "" {
+			if err != nil && strings.Contains(err.Error(), "notif") {
+				t.Errorf("%s: unexpected error: %s", tt.Name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.Error) {
+			t.Errorf("%s: expected error %#v but got %v", tt.Name, tt.Error, err)
+		}
+	}
+}
+
+func TestConfig_Validate_Backchannel(t *testing.T) {
+	allow := func(c *config.Config) {
+		c.Clients = config.ClientConfigSet{
+			"call-center": {AllowBackchannel: true},
+		}
+	}
+	smtp := config.SMTPConfig{Server: &config.URL{Scheme: "smtp", Host: "mail.example.com:587"}, From: "lauth@example.com"}
+
+	tests := []struct {
+		Name   string
+		Modify func(c *config.Config)
+		Error  string
+	}{
+		{"disabled", func(c *config.Config) {}, ""},
+		{"enabled", func(c *config.Config) {
+			allow(c)
+			c.SMTP = smtp
+		}, ""},
+		{"without smtp", func(c *config.Config) {
+			allow(c)
+		}, "--smtp-server: SMTP Server is required to send backchannel authentication requests to users."},
+		{"without attribute", func(c *config.Config) {
+			allow(c)
+			c.SMTP = smtp
+			c.Login.NotifyAttribute = ""
+		}, "--login-notify-attribute: "},
+		{"without expire", func(c *config.Config) {
+			allow(c)
+			c.SMTP = smtp
+			c.Expire.Backchannel = 0
+		}, "--backchannel-expire: "},
+		{"too long expire", func(c *config.Config) {
+			allow(c)
+			c.SMTP = smtp
+			c.Expire.Backchannel = config.Duration(2 * time.Hour)
+		}, "--backchannel-expire: Expiration of Backchannel Authentication is too long"},
+	}
+
+	for _, tt := range tests {
+		conf := &config.Config{}
+		if err := conf.Load("../config.example.toml", nil); err != nil {
+			t.Fatalf("failed to load example config: %s", err)
+		}
+		tt.Modify(conf)
+
+		err := conf.Validate()
+		if tt.Error == "" {
+			if err != nil && strings.Contains(err.Error(), "backchannel") {
+				t.Errorf("%s: unexpected error: %s", tt.Name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.Error) {
+			t.Errorf("%s: expected error %#v but got %v", tt.Name, tt.Error, err)
+		}
+	}
+}
+
+func TestConfig_Validate_ClaimSources(t *testing.T) {
+	hr := config.ClaimSourceConfig{Name: "hr", URL: "https://hr.example.com/users/{subject}", Attributes: []string{"costCenter"}}
+
+	tests := []struct {
+		Name   string
+		Modify func(s *config.ClaimSourceConfig)
+		Error  string
+	}{
+		{"valid", func(s *config.ClaimSourceConfig) {}, ""},
+		{"ldap precedence", func(s *config.ClaimSourceConfig) { s.Precedence = "ldap" }, ""},
+		{"without name", func(s *config.ClaimSourceConfig) { s.Name = "" }, "claim_source.0.name: Name is required."},
+		{"relative url", func(s *config.ClaimSourceConfig) { s.URL = "/users/{subject}" }, "claim_source.hr.url: URL must be absolute URL."},
+		{"without subject", func(s *config.ClaimSourceConfig) { s.URL = "https://hr.example.com/users" }, "claim_source.hr.url: URL must include {subject}."},
+		{"without attributes", func(s *config.ClaimSourceConfig) { s.Attributes = nil }, "claim_source.hr.attributes: At least one attribute is required."},
+		{"unknown precedence", func(s *config.ClaimSourceConfig) { s.Precedence = "hr" }, `claim_source.hr.precedence: Precedence must be "source" or "ldap" but got "hr".`},
+		{"negative timeout", func(s *config.ClaimSourceConfig) { s.Timeout = -1 }, "claim_source.hr.timeout: Timeout can't set less than 0."},
+	}
+
+	for _, tt := range tests {
+		conf := &config.Config{}
+		if err := conf.Load("../config.example.toml", nil); err != nil {
+			t.Fatalf("failed to load example config: %s", err)
+		}
+		s := hr
+		tt.Modify(&s)
+		conf.ClaimSources = []config.ClaimSourceConfig{s}
+
+		err := conf.Validate()
+		if tt.Error == "" {
+			if err != nil && strings.Contains(err.Error(), "claim_source") {
+				t.Errorf("%s: unexpected error: %s", tt.Name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.Error) {
+			t.Errorf("%s: expected error %#v but got %v", tt.Name, tt.Error, err)
+		}
+	}
+
+	conf := &config.Config{}
+	if err := conf.Load("../config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+	conf.ClaimSources = []config.ClaimSourceConfig{hr, hr}
+	if err := conf.Validate(); err == nil || !strings.Contains(err.Error(), `claim_source.hr.name: Name "hr" is duplicated.`) {
+		t.Errorf("duplicated name should be error: %v", err)
+	}
+}
+
+func TestConfig_Validate_MFA(t *testing.T) {
+	duo := config.MFAProviderConfig{Type: "duo", Host: "api-xxx.duosecurity.com", IntegrationKey: "ikey", SecretKey: "skey"}
+
+	tests := []struct {
+		Name   string
+		Modify func(c *config.Config)
+		Error  string
+	}{
+		{"disabled", func(c *config.Config) {}, ""},
+		{"duo", func(c *config.Config) {
+			c.MFA.Default = "duo"
+			c.MFA.Providers = map[string]config.MFAProviderConfig{"duo": duo}
+		}, ""},
+		{"radius", func(c *config.Config) {
+			c.MFA.Groups = []config.MFAGroup{{Group: "CN=admins,DC=example,DC=com", Provider: "otp"}}
+			c.MFA.Providers = map[string]config.MFAProviderConfig{"otp": {Type: "radius", Server: "localhost:1812", Secret: "secret"}}
+		}, ""},
+		{"unknown type", func(c *config.Config) {
+			c.MFA.Providers = map[string]config.MFAProviderConfig{"x": {Type: "sms"}}
+		}, `mfa.provider.x.type: Type must be "duo" or "radius" but got "sms".`},
+		{"duo without key", func(c *config.Config) {
+			c.MFA.Providers = map[string]config.MFAProviderConfig{"duo": {Type: "duo", Host: "api-xxx.duosecurity.com"}}
+		}, "mfa.provider.duo: host, integration_key, and secret_key are required for Duo."},
+		{"duo unknown factor", func(c *config.Config) {
+			p := duo
+			p.Factor = "sms"
+			c.MFA.Providers = map[string]config.MFAProviderConfig{"duo": p}
+		}, "mfa.provider.duo.factor: "},
+		{"radius without secret", func(c *config.Config) {
+			c.MFA.Providers = map[string]config.MFAProviderConfig{"otp": {Type: "radius", Server: "localhost:1812"}}
+		}, "mfa.provider.otp: server and secret are required for RADIUS."},
+		{"undefined default", func(c *config.Config) {
+			c.MFA.Default = "duo"
+		}, `mfa.default: Provider "duo" is not defined in [mfa.provider].`},
+		{"group without provider", func(c *config.Config) {
+			c.MFA.Groups = []config.MFAGroup{{Group: "CN=admins,DC=example,DC=com"}}
+		}, "mfa.groups: Both of group and provider are required."},
+		{"undefined client provider", func(c *config.Config) {
+			c.Clients = config.ClientConfigSet{"some_client": {MFA: "duo"}}
+		}, `client.some_client.mfa: Provider "duo" is not defined in [mfa.provider].`},
+	}
+
+	for _, tt := range tests {
+		conf := &config.Config{}
+		if err := conf.Load("../config.example.toml", nil); err != nil {
+			t.Fatalf("failed to load example config: %s", err)
+		}
+		tt.Modify(conf)
+
+		err := conf.Validate()
+		if tt.Error == "" {
+			if err != nil && strings.Contains(err.Error(), "mfa") {
+				t.Errorf("%s: unexpected error: %s", tt.Name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.Error) {
+			t.Errorf("%s: expected error %#v but got %v", tt.Name, tt.Error, err)
+		}
+	}
 }
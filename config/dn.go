@@ -25,3 +25,31 @@ func GetDCByDN(dn string) (string, error) {
 
 	return strings.Join(result, ","), nil
 }
+
+// EqualDN reports whether two DNs are the same, ignoring case and spaces around separators.
+func EqualDN(a, b string) bool {
+	x, err := ldap.ParseDN(a)
+	if err != nil {
+		return strings.EqualFold(a, b)
+	}
+	y, err := ldap.ParseDN(b)
+	if err != nil {
+		return false
+	}
+
+	if len(x.RDNs) != len(y.RDNs) {
+		return false
+	}
+	for i := range x.RDNs {
+		if len(x.RDNs[i].Attributes) != len(y.RDNs[i].Attributes) {
+			return false
+		}
+		for j := range x.RDNs[i].Attributes {
+			ax, ay := x.RDNs[i].Attributes[j], y.RDNs[i].Attributes[j]
+			if !strings.EqualFold(ax.Type, ay.Type) || !strings.EqualFold(ax.Value, ay.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -2,17 +2,119 @@ package config
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
-
-	"github.com/xhit/go-str2duration/v2"
 )
 
 type Duration time.Duration
 
+const (
+	day   = 24 * time.Hour
+	week  = 7 * day
+	month = 30 * day
+	year  = 365 * day
+)
+
+var (
+	durationUnits = map[string]time.Duration{
+		"ns": time.Nanosecond,
+		"us": time.Microsecond,
+		"µs": time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  day,
+		"w":  week,
+		"mo": month,
+		"y":  year,
+	}
+
+	durationPartRe = regexp.MustCompile(`^([0-9]+(?:\.[0-9]*)?|\.[0-9]+)([a-zµ]*)`)
+	iso8601Re      = regexp.MustCompile(`^P(?:([0-9.]+)Y)?(?:([0-9.]+)M)?(?:([0-9.]+)W)?(?:([0-9.]+)D)?(?:T(?:([0-9.]+)H)?(?:([0-9.]+)M)?(?:([0-9.]+)S)?)?$`)
+)
+
+// ParseDuration parses duration string like "1w2d3h", "1mo", or ISO 8601 style like "P14D" and "PT10M".
+//
+// A month means 30 days, and a year means 365 days.
 func ParseDuration(text string) (Duration, error) {
-	d, err := str2duration.ParseDuration(text)
-	return Duration(d), err
+	text = strings.TrimSpace(text)
+
+	if strings.HasPrefix(text, "P") {
+		return parseISO8601Duration(text)
+	}
+
+	s := text
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	if s == "0" {
+		return 0, nil
+	}
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration %#v: empty duration", text)
+	}
+
+	var total float64
+	for s != "" {
+		m := durationPartRe.FindStringSubmatch(s)
+		if m == nil {
+			return 0, fmt.Errorf("invalid duration %#v: expected number at %#v", text, s)
+		}
+		if m[2] == "" {
+			return 0, fmt.Errorf("invalid duration %#v: missing unit after %s (use one of s, m, h, d, w, mo, y, or ISO 8601 like P14D)", text, m[1])
+		}
+		unit, ok := durationUnits[m[2]]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration %#v: unknown unit %#v (use one of s, m, h, d, w, mo, y, or ISO 8601 like P14D)", text, m[2])
+		}
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %#v: %s", text, err)
+		}
+		total += n * float64(unit)
+		s = s[len(m[0]):]
+	}
+
+	return makeDuration(text, total, negative)
+}
+
+func parseISO8601Duration(text string) (Duration, error) {
+	m := iso8601Re.FindStringSubmatch(text)
+	if m == nil || text == "P" || strings.HasSuffix(text, "T") {
+		return 0, fmt.Errorf("invalid duration %#v: malformed ISO 8601 duration (expected like P1Y2M3W4DT5H6M7S)", text)
+	}
+
+	units := []time.Duration{year, month, week, day, time.Hour, time.Minute, time.Second}
+
+	var total float64
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %#v: invalid number %#v", text, m[i+1])
+		}
+		total += n * float64(unit)
+	}
+
+	return makeDuration(text, total, false)
+}
+
+func makeDuration(text string, total float64, negative bool) (Duration, error) {
+	if total > float64(1<<63-1) {
+		return 0, fmt.Errorf("invalid duration %#v: too long", text)
+	}
+	if negative {
+		total = -total
+	}
+	return Duration(total), nil
 }
 
 func (d Duration) Duration() time.Duration {
@@ -3,6 +3,7 @@ package config_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/macrat/lauth/config"
 )
@@ -41,3 +42,49 @@ func TestDuration(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output time.Duration
+		Error  string
+	}{
+		{"P14D", 14 * 24 * time.Hour, ""},
+		{"PT10M", 10 * time.Minute, ""},
+		{"P1W", 7 * 24 * time.Hour, ""},
+		{"P1M", 30 * 24 * time.Hour, ""},
+		{"P1DT12H", 36 * time.Hour, ""},
+		{"PT1.5H", 90 * time.Minute, ""},
+		{"2w", 14 * 24 * time.Hour, ""},
+		{"1mo", 30 * 24 * time.Hour, ""},
+		{"1mo1m", 30*24*time.Hour + time.Minute, ""},
+		{"1y", 365 * 24 * time.Hour, ""},
+		{"1.5h", 90 * time.Minute, ""},
+		{"500ms", 500 * time.Millisecond, ""},
+		{"-1h", -time.Hour, ""},
+		{"", 0, `invalid duration "": empty duration`},
+		{"10", 0, `invalid duration "10": missing unit after 10 (use one of s, m, h, d, w, mo, y, or ISO 8601 like P14D)`},
+		{"3x", 0, `invalid duration "3x": unknown unit "x" (use one of s, m, h, d, w, mo, y, or ISO 8601 like P14D)`},
+		{"h", 0, `invalid duration "h": expected number at "h"`},
+		{"P", 0, `invalid duration "P": malformed ISO 8601 duration (expected like P1Y2M3W4DT5H6M7S)`},
+		{"P1DT", 0, `invalid duration "P1DT": malformed ISO 8601 duration (expected like P1Y2M3W4DT5H6M7S)`},
+		{"PT10X", 0, `invalid duration "PT10X": malformed ISO 8601 duration (expected like P1Y2M3W4DT5H6M7S)`},
+	}
+
+	for _, tt := range tests {
+		d, err := config.ParseDuration(tt.Input)
+		if tt.Error != "" {
+			if err == nil || err.Error() != tt.Error {
+				t.Errorf("%#v: unexpected error:\nexpected: %s\nbut got: %v", tt.Input, tt.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%#v: failed to parse: %s", tt.Input, err)
+			continue
+		}
+		if d.Duration() != tt.Output {
+			t.Errorf("%#v: expected %s but got %s", tt.Input, tt.Output, d.Duration())
+		}
+	}
+}
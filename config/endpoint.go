@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+type endpointRoute struct {
+	// Name is the flag name of the endpoint, or the path itself if fixed.
+	Name string
+	Path string
+
+	// Prefix is true if the endpoint serves all paths under it.
+	Prefix bool
+}
+
+// JoinEndpoint joins the Issuer path and the endpoint path in the same way as routing, like "/auth" + "authz/" to "/auth/authz".
+func JoinEndpoint(issuerPath, endpoint string) string {
+	return path.Join("/", issuerPath, endpoint)
+}
+
+func (c *Config) configurableEndpoints() []endpointRoute {
+	es := []endpointRoute{
+		{"authz-endpoint", c.Endpoints.Authz, false},
+		{"token-endpoint", c.Endpoints.Token, false},
+		{"userinfo-endpoint", c.Endpoints.Userinfo, false},
+		{"jwks-uri", c.Endpoints.Jwks, false},
+		{"logout-endpoint", c.Endpoints.Logout, false},
+		{"register-endpoint", c.Endpoints.Register, false},
+		{"invite-endpoint", c.Endpoints.Invite, false},
+		{"qrcode-endpoint", c.Endpoints.QRCode, false},
+		{"backchannel-endpoint", c.Endpoints.Backchannel, false},
+	}
+	if c.Admin.Enabled() {
+		es = append(es, endpointRoute{"admin-path", c.Admin.Path, true})
+	}
+	return es
+}
+
+// routes returns all paths that lauth serves, after joined with the Issuer path.
+func (c *Config) routes() []endpointRoute {
+	p := c.EndpointPaths()
+
+	routes := []endpointRoute{
+		{"authz-endpoint", p.Authz, false},
+		{"token-endpoint", p.Token, false},
+		{"userinfo-endpoint", p.Userinfo, false},
+		{"jwks-uri", p.Jwks, false},
+		{"logout-endpoint", p.Logout, false},
+		{"register-endpoint", p.Register, false},
+		{"invite-endpoint", p.Invite, false},
+		{"qrcode-endpoint", p.QRCode + ".png", false},
+		{"qrcode-endpoint", p.QRCode + ".svg", false},
+		{"backchannel-endpoint", p.Backchannel, false},
+		{"backchannel-endpoint", path.Join(p.Backchannel, "approve"), false},
+		{p.OpenIDConfiguration, p.OpenIDConfiguration, false},
+		{p.Errors, p.Errors, true},
+		{p.Session, p.Session, true},
+		{"/robots.txt", "/robots.txt", false},
+		{"/healthz", "/healthz", false},
+		{"/readyz", "/readyz", false},
+		{"/version", "/version", false},
+	}
+	if c.Admin.Enabled() {
+		routes = append(routes, endpointRoute{"admin-path", p.Admin, true})
+	}
+	if c.Metrics.Provider == MetricsPrometheus {
+		routes = append(routes, endpointRoute{"metrics-path", path.Join("/", c.Metrics.Path), false})
+	}
+	return routes
+}
+
+func (r endpointRoute) flag() string {
+	if strings.HasPrefix(r.Name, "/") {
+		return r.Name
+	}
+	return "--" + r.Name
+}
+
+func (r endpointRoute) collides(other endpointRoute) bool {
+	if r.Path == other.Path {
+		return true
+	}
+	if r.Prefix && strings.HasPrefix(other.Path, strings.TrimSuffix(r.Path, "/")+"/") {
+		return true
+	}
+	if other.Prefix && strings.HasPrefix(r.Path, strings.TrimSuffix(other.Path, "/")+"/") {
+		return true
+	}
+	return false
+}
+
+// endpointErrors returns errors about endpoint paths that can't route or collide with another endpoint.
+func (c *Config) endpointErrors() []error {
+	var es []error
+
+	issuerPath := JoinEndpoint(c.Issuer.Path, "")
+
+	invalid := false
+	for _, e := range c.configurableEndpoints() {
+		switch {
+		case e.Path == "":
+			es = append(es, fmt.Errorf("--%s: Endpoint path can't set empty.", e.Name))
+		case strings.Contains(e.Path, "://") || strings.ContainsAny(e.Path, "?#"):
+			es = append(es, fmt.Errorf("--%s: Endpoint must be a path relative to the Issuer URL like \"/authz\" but got %#v.", e.Name, e.Path))
+		case !strings.HasPrefix(e.Path, "/"):
+			es = append(es, fmt.Errorf("--%s: Endpoint path must start with \"/\" but got %#v.", e.Name, e.Path))
+		case JoinEndpoint(c.Issuer.Path, e.Path) == issuerPath:
+			es = append(es, fmt.Errorf("--%s: Endpoint path can't be the same as the Issuer URL.", e.Name))
+		case !strings.HasPrefix(JoinEndpoint(c.Issuer.Path, e.Path), strings.TrimSuffix(issuerPath, "/")+"/"):
+			es = append(es, fmt.Errorf("--%s: Endpoint must be under the Issuer URL but got %#v.", e.Name, e.Path))
+		default:
+			continue
+		}
+		invalid = true
+	}
+	if invalid {
+		return es
+	}
+
+	routes := c.routes()
+	for i, a := range routes {
+		for _, b := range routes[i+1:] {
+			if a.Name != b.Name && a.collides(b) {
+				es = append(es, fmt.Errorf("%s: Endpoint %#v collides with %s %#v.", a.flag(), a.Path, b.flag(), b.Path))
+			}
+		}
+	}
+
+	return es
+}
+
+// EndpointWarnings returns messages about endpoints that are served at a different path from the configured value.
+func (c *Config) EndpointWarnings() []string {
+	var ws []string
+
+	if strings.HasSuffix(c.Issuer.Path, "/") {
+		ws = append(ws, fmt.Sprintf("--issuer: Issuer URL %#v ends with \"/\". Endpoints are served and advertised without double slashes, like %#v.", c.Issuer.String(), c.OpenIDConfiguration().AuthorizationEndpoint))
+	}
+
+	for _, e := range c.configurableEndpoints() {
+		if e.Path != "" && e.Path != path.Clean(e.Path) {
+			ws = append(ws, fmt.Sprintf("--%s: Endpoint %#v is served and advertised as %#v.", e.Name, e.Path, path.Clean(e.Path)))
+		}
+	}
+
+	return ws
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+type expireLimit struct {
+	Flag  string
+	Name  string
+	Get   func(ExpireConfig) Duration
+	Warn  time.Duration
+	Limit time.Duration
+}
+
+var expireLimits = []expireLimit{
+	{"login-expire", "Login", func(e ExpireConfig) Duration { return e.Login }, 24 * time.Hour, 7 * 24 * time.Hour},
+	{"code-expire", "Code", func(e ExpireConfig) Duration { return e.Code }, 10 * time.Minute, time.Hour},
+	{"token-expire", "Token", func(e ExpireConfig) Duration { return e.Token }, 24 * time.Hour, 30 * 24 * time.Hour},
+	{"refresh-expire", "Refresh Token", func(e ExpireConfig) Duration { return e.Refresh }, 90 * 24 * time.Hour, 365 * 24 * time.Hour},
+	{"sso-expire", "SSO", func(e ExpireConfig) Duration { return e.SSO }, 90 * 24 * time.Hour, 365 * 24 * time.Hour},
+	{"invitation-expire", "Invitation", func(e ExpireConfig) Duration { return e.Invitation }, 14 * 24 * time.Hour, 90 * 24 * time.Hour},
+	{"backchannel-expire", "Backchannel Authentication", func(e ExpireConfig) Duration { return e.Backchannel }, 10 * time.Minute, time.Hour},
+}
+
+// Errors returns errors about expiration that is too long to be intentional.
+//
+// It returns nothing if AllowLong is true.
+func (e ExpireConfig) Errors() []error {
+	if e.AllowLong {
+		return nil
+	}
+
+	var es []error
+	for _, l := range expireLimits {
+		if d := l.Get(e); d.Duration() > l.Limit {
+			es = append(es, fmt.Errorf("--%s: Expiration of %s is too long (%s). Maximum is %s. Please set --allow-long-expire if you really want it.", l.Flag, l.Name, d, Duration(l.Limit)))
+		}
+	}
+	return es
+}
+
+// Warnings returns messages about expiration that is longer than recommended.
+func (e ExpireConfig) Warnings() []string {
+	var ws []string
+	for _, l := range expireLimits {
+		if d := l.Get(e); d.Duration() > l.Warn {
+			ws = append(ws, fmt.Sprintf("--%s: Expiration of %s is %s. It is recommended %s or less.", l.Flag, l.Name, d, Duration(l.Warn)))
+		}
+	}
+	return ws
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+
+	"github.com/macrat/lauth/redact"
+)
+
+// Hash returns a short digest of the config to compare between replicas.
+// The listen address is excluded because it may differ for each replica.
+// Secrets are masked before hashing, because the digest is published as a metrics label.
+func (c *Config) Hash() string {
+	cc := c.redacted()
+	cc.Listen = nil
+
+	raw, err := json.Marshal(cc)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+func redactString(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redact.MASK
+}
+
+func redactURL(u *URL) *URL {
+	if u == nil || u.User == nil {
+		return u
+	}
+	r := *u
+	if _, ok := u.User.Password(); ok {
+		r.User = url.UserPassword(u.User.Username(), redact.MASK)
+	}
+	return &r
+}
+
+// redacted returns a copy of the config that all secrets are masked.
+// The maps and slices that include secrets are copied, so the original config is not changed.
+func (c *Config) redacted() Config {
+	cc := *c
+
+	cc.LDAP.Password = redactString(cc.LDAP.Password)
+	cc.LDAP.Server = redactURL(cc.LDAP.Server)
+	cc.Metrics.Password = redactString(cc.Metrics.Password)
+	cc.Metrics.OTLPEndpoint = redactURL(cc.Metrics.OTLPEndpoint)
+	cc.Admin.Password = redactString(cc.Admin.Password)
+	cc.Events.NATS = redactURL(cc.Events.NATS)
+	cc.SMTP.Server = redactURL(cc.SMTP.Server)
+	cc.Audit.Syslog = redactURL(cc.Audit.Syslog)
+	cc.Policy.URL = redactURL(cc.Policy.URL)
+
+	if c.Clients != nil {
+		cc.Clients = make(ClientConfigSet, len(c.Clients))
+		for id, client := range c.Clients {
+			client.Secret = redactString(client.Secret)
+			cc.Clients[id] = client
+		}
+	}
+
+	if c.MFA.Providers != nil {
+		cc.MFA.Providers = make(map[string]MFAProviderConfig, len(c.MFA.Providers))
+		for name, p := range c.MFA.Providers {
+			p.SecretKey = redactString(p.SecretKey)
+			p.Secret = redactString(p.Secret)
+			cc.MFA.Providers[name] = p
+		}
+	}
+
+	if c.ClaimSources != nil {
+		cc.ClaimSources = make([]ClaimSourceConfig, len(c.ClaimSources))
+		for i, s := range c.ClaimSources {
+			if u, err := url.Parse(s.URL); err == nil {
+				s.URL = redactURL((*URL)(u)).String()
+			}
+			if s.Headers != nil {
+				hs := make(map[string]string, len(s.Headers))
+				for k, v := range s.Headers {
+					hs[k] = redactString(v)
+				}
+				s.Headers = hs
+			}
+			cc.ClaimSources[i] = s
+		}
+	}
+
+	return cc
+}
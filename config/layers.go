@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// readFile reads the n-th config file into vip.
+// The first file is read as is, and the later files are merged into it.
+func readFile(vip *viper.Viper, n int, file string) error {
+	vip.SetConfigFile(file)
+
+	var err error
+	if n == 0 {
+		err = vip.ReadInConfig()
+	} else {
+		err = vip.MergeInConfig()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+func readFiles(vip *viper.Viper, files []string) error {
+	for i, f := range files {
+		if err := readFile(vip, i, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigChange is a change of an option by a config file.
+type ConfigChange struct {
+	Key   string
+	Old   interface{}
+	New   interface{}
+	Added bool
+}
+
+// ConfigLayer is the changes that a config file made to the former files.
+type ConfigLayer struct {
+	File    string
+	Changes []ConfigChange
+}
+
+func flattenConfig(vip *viper.Viper) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, k := range vip.AllKeys() {
+		m[k] = vip.Get(k)
+	}
+	return m
+}
+
+// DiffFiles reads the config files in order, and reports options that each file added or overrode.
+//
+// Tables are merged key by key, so an overlay file only needs the options to change.
+// Other values including arrays are replaced as a whole by the later file.
+// Options can not be removed by the later file.
+func DiffFiles(files []string) ([]ConfigLayer, error) {
+	vip := viper.New()
+	prev := map[string]interface{}{}
+	layers := make([]ConfigLayer, 0, len(files))
+
+	for i, f := range files {
+		if err := readFile(vip, i, f); err != nil {
+			return nil, err
+		}
+
+		cur := flattenConfig(vip)
+
+		keys := make([]string, 0, len(cur))
+		for k := range cur {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		layer := ConfigLayer{File: f}
+		for _, k := range keys {
+			old, ok := prev[k]
+			if !ok {
+				layer.Changes = append(layer.Changes, ConfigChange{Key: k, New: cur[k], Added: true})
+			} else if !reflect.DeepEqual(old, cur[k]) {
+				layer.Changes = append(layer.Changes, ConfigChange{Key: k, Old: old, New: cur[k]})
+			}
+		}
+		layers = append(layers, layer)
+
+		prev = cur
+	}
+
+	return layers, nil
+}
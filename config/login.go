@@ -0,0 +1,59 @@
+package config
+
+import (
+	"net"
+	"strings"
+)
+
+func (c LoginConfig) stripDomain(domain string) bool {
+	for _, d := range c.StripDomains {
+		if d == "*" || strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeUsername converts the username that typed in the login form to the form to search in LDAP.
+//
+// "DOMAIN\user" and "user@domain" are converted to "user" if the domain is in StripDomains.
+// "*" in StripDomains means any domain.
+func (c LoginConfig) NormalizeUsername(username string) string {
+	username = strings.TrimSpace(username)
+
+	if i := strings.Index(username, `\`); i > 0 && c.stripDomain(username[:i]) {
+		username = username[i+1:]
+	} else if i := strings.LastIndex(username, "@"); i > 0 && c.stripDomain(username[i+1:]) {
+		username = username[:i]
+	}
+
+	switch c.UsernameCase {
+	case "lower":
+		username = strings.ToLower(username)
+	case "upper":
+		username = strings.ToUpper(username)
+	}
+
+	return username
+}
+
+// ShowsDetailedErrors reports whether the client at ip is allowed to see the reason of failed login.
+//
+// It is false for any client if DetailedErrors is empty, so the login form doesn't tell whether the user exists.
+func (c LoginConfig) ShowsDetailedErrors(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, network := range c.DetailedErrors {
+		if _, n, err := net.ParseCIDR(network); err == nil && n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// CountsFailures reports whether failed logins need to be counted, for the lockout or the notification.
+func (c LoginConfig) CountsFailures() bool {
+	return c.LockoutThreshold > 0 || c.NotifyThreshold > 0
+}
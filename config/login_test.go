@@ -0,0 +1,57 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestLoginConfig_NormalizeUsername(t *testing.T) {
+	tests := []struct {
+		Config config.LoginConfig
+		Input  string
+		Output string
+	}{
+		{config.LoginConfig{}, " macrat ", "macrat"},
+		{config.LoginConfig{}, `EXAMPLE\macrat`, `EXAMPLE\macrat`},
+		{config.LoginConfig{}, "MacRat", "MacRat"},
+		{config.LoginConfig{UsernameCase: "keep"}, "MacRat", "MacRat"},
+		{config.LoginConfig{UsernameCase: "lower"}, "MacRat", "macrat"},
+		{config.LoginConfig{UsernameCase: "upper"}, "MacRat", "MACRAT"},
+		{config.LoginConfig{StripDomains: []string{"EXAMPLE", "example.com"}}, `example\macrat`, "macrat"},
+		{config.LoginConfig{StripDomains: []string{"EXAMPLE", "example.com"}}, "macrat@Example.com", "macrat"},
+		{config.LoginConfig{StripDomains: []string{"EXAMPLE", "example.com"}}, `OTHER\macrat`, `OTHER\macrat`},
+		{config.LoginConfig{StripDomains: []string{"EXAMPLE", "example.com"}}, "macrat@other.com", "macrat@other.com"},
+		{config.LoginConfig{StripDomains: []string{"EXAMPLE"}}, `\macrat`, `\macrat`},
+		{config.LoginConfig{StripDomains: []string{"*"}}, `ANY\macrat`, "macrat"},
+		{config.LoginConfig{StripDomains: []string{"*"}, UsernameCase: "lower"}, "MacRat@Example.com", "macrat"},
+	}
+
+	for _, tt := range tests {
+		if output := tt.Config.NormalizeUsername(tt.Input); output != tt.Output {
+			t.Errorf("%#v with %#v: expected %#v but got %#v", tt.Input, tt.Config, tt.Output, output)
+		}
+	}
+}
+
+func TestLoginConfig_ShowsDetailedErrors(t *testing.T) {
+	tests := []struct {
+		Networks []string
+		IP       string
+		Expect   bool
+	}{
+		{nil, "127.0.0.1", false},
+		{[]string{"10.0.0.0/8"}, "10.1.2.3", true},
+		{[]string{"10.0.0.0/8"}, "192.168.1.1", false},
+		{[]string{"10.0.0.0/8", "::1/128"}, "::1", true},
+		{[]string{"10.0.0.0/8"}, "not an ip", false},
+		{[]string{"invalid"}, "10.1.2.3", false},
+	}
+
+	for _, tt := range tests {
+		c := config.LoginConfig{DetailedErrors: tt.Networks}
+		if got := c.ShowsDetailedErrors(tt.IP); got != tt.Expect {
+			t.Errorf("%v / %s: expected %v but got %v", tt.Networks, tt.IP, tt.Expect, got)
+		}
+	}
+}
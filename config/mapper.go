@@ -67,9 +67,10 @@ func (t ClaimType) Convert(values []string) interface{} {
 func MappingClaims(attrs map[string][]string, maps map[string]ClaimConfig) map[string]interface{} {
 	result := make(map[string]interface{})
 
-	for name, values := range attrs {
-		conf := maps[name]
-		result[conf.Claim] = conf.Type.Convert(values)
+	for _, conf := range maps {
+		if value, ok := conf.Apply(attrs); ok {
+			result[conf.Claim] = value
+		}
 	}
 
 	return result
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	MFADuo    = "duo"
+	MFARADIUS = "radius"
+
+	MFAFactorPush     = "push"
+	MFAFactorPasscode = "passcode"
+)
+
+// MFAGroup selects the MFA provider for members of the group.
+type MFAGroup struct {
+	Group    string `json:"group"    yaml:"group"    toml:"group"`
+	Provider string `json:"provider" yaml:"provider" toml:"provider"`
+}
+
+// MFAProviderConfig is the settings of an MFA provider.
+// Which options are used depends on the Type.
+type MFAProviderConfig struct {
+	// Type is the kind of the provider. "duo" or "radius".
+	Type    string   `json:"type"              yaml:"type"              toml:"type"`
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+
+	// Host, IntegrationKey, SecretKey, and Factor are for the Duo Auth API.
+	Host           string `json:"host,omitempty"            yaml:"host,omitempty"            toml:"host,omitempty"`
+	IntegrationKey string `json:"integration_key,omitempty" yaml:"integration_key,omitempty" toml:"integration_key,omitempty"`
+	SecretKey      string `json:"secret_key,omitempty"      yaml:"secret_key,omitempty"      toml:"secret_key,omitempty"`
+	Factor         string `json:"factor,omitempty"          yaml:"factor,omitempty"          toml:"factor,omitempty"`
+
+	// Server, Secret, and NASIdentifier are for RADIUS.
+	Server        string `json:"server,omitempty"         yaml:"server,omitempty"         toml:"server,omitempty"`
+	Secret        string `json:"secret,omitempty"         yaml:"secret,omitempty"         toml:"secret,omitempty"`
+	NASIdentifier string `json:"nas_identifier,omitempty" yaml:"nas_identifier,omitempty" toml:"nas_identifier,omitempty"`
+}
+
+type MFAConfig struct {
+	// Default is the provider for all users. If empty, only the users in Groups and the users of clients that set mfa need the second factor.
+	Default   string                       `json:"default,omitempty"  yaml:"default,omitempty"  toml:"default,omitempty"`
+	Groups    []MFAGroup                   `json:"groups,omitempty"   yaml:"groups,omitempty"   toml:"groups,omitempty"`
+	Providers map[string]MFAProviderConfig `json:"provider,omitempty" yaml:"provider,omitempty" toml:"provider,omitempty"`
+}
+
+// ProviderForGroups returns the provider of the first group mapping that matches the groups, or Default if nothing matches.
+func (c MFAConfig) ProviderForGroups(groups []string) string {
+	for _, m := range c.Groups {
+		for _, g := range groups {
+			if EqualDN(m.Group, g) {
+				return m.Provider
+			}
+		}
+	}
+	return c.Default
+}
+
+func (c *Config) mfaErrors() []error {
+	var es []error
+
+	for name, p := range c.MFA.Providers {
+		switch p.Type {
+		case MFADuo:
+			if p.Host == "" || p.IntegrationKey == "" || p.SecretKey == "" {
+				es = append(es, fmt.Errorf("mfa.provider.%s: host, integration_key, and secret_key are required for Duo.", name))
+			}
+			if p.Factor != "" && p.Factor != MFAFactorPush && p.Factor != MFAFactorPasscode {
+				es = append(es, fmt.Errorf("mfa.provider.%s.factor: Factor must be %#v or %#v but got %#v.", name, MFAFactorPush, MFAFactorPasscode, p.Factor))
+			}
+		case MFARADIUS:
+			if p.Server == "" || p.Secret == "" {
+				es = append(es, fmt.Errorf("mfa.provider.%s: server and secret are required for RADIUS.", name))
+			}
+		default:
+			es = append(es, fmt.Errorf("mfa.provider.%s.type: Type must be %#v or %#v but got %#v.", name, MFADuo, MFARADIUS, p.Type))
+		}
+		if p.Timeout < 0 {
+			es = append(es, fmt.Errorf("mfa.provider.%s.timeout: Timeout can't set less than 0.", name))
+		}
+	}
+
+	defined := func(name string) bool {
+		_, ok := c.MFA.Providers[name]
+		return ok
+	}
+
+	if c.MFA.Default != "" && !defined(c.MFA.Default) {
+		es = append(es, fmt.Errorf("mfa.default: Provider %#v is not defined in [mfa.provider].", c.MFA.Default))
+	}
+	for _, m := range c.MFA.Groups {
+		if m.Group == "" || m.Provider == "" {
+			es = append(es, errors.New("mfa.groups: Both of group and provider are required."))
+		} else if !defined(m.Provider) {
+			es = append(es, fmt.Errorf("mfa.groups: Provider %#v is not defined in [mfa.provider].", m.Provider))
+		}
+	}
+	for id, client := range c.Clients {
+		if client.MFA != "" && !defined(client.MFA) {
+			es = append(es, fmt.Errorf("client.%s.mfa: Provider %#v is not defined in [mfa.provider].", id, client.MFA))
+		}
+	}
+
+	return es
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"strings"
+
 	"github.com/gobwas/glob"
 )
 
@@ -13,8 +15,13 @@ func (p Pattern) MarshalText() ([]byte, error) {
 	return []byte(p.pattern), nil
 }
 
+// patternSeparators are characters that a single `*` can't match.
+// It includes characters that end the host part of URL too,
+// for preventing open redirect like "https://evil.com?.example.com/" by "https://*.example.com/".
+var patternSeparators = []rune{'/', '\\', '?', '#', '@'}
+
 func (p *Pattern) UnmarshalText(text []byte) error {
-	pat, err := glob.Compile(string(text), '/')
+	pat, err := glob.Compile(string(text), patternSeparators...)
 	if err != nil {
 		return err
 	}
@@ -33,6 +40,11 @@ func (p Pattern) Match(url string) bool {
 	return p.matcher.Match(url)
 }
 
+// IsExact checks if the pattern has no wildcard, so it matches only the same string.
+func (p Pattern) IsExact() bool {
+	return !strings.ContainsAny(p.pattern, `*?[]{}\`)
+}
+
 type PatternSet []Pattern
 
 func (ps PatternSet) Match(url string) bool {
@@ -43,3 +55,13 @@ func (ps PatternSet) Match(url string) bool {
 	}
 	return false
 }
+
+// MatchExact checks if the url is the same as any pattern, without expanding wildcards.
+func (ps PatternSet) MatchExact(url string) bool {
+	for _, p := range ps {
+		if p.pattern == url {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package config_test
 
 import (
+	"math/rand"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/macrat/lauth/config"
@@ -55,3 +58,113 @@ func TestPattern(t *testing.T) {
 		}
 	}
 }
+
+func TestPatternSet_MatchExact(t *testing.T) {
+	var exact, wildcard config.Pattern
+	exact.UnmarshalText([]byte("http://example.com/callback"))
+	wildcard.UnmarshalText([]byte("http://*.example.com/callback"))
+
+	if !exact.IsExact() || wildcard.IsExact() {
+		t.Errorf("unexpected IsExact: %v, %v", exact.IsExact(), wildcard.IsExact())
+	}
+
+	ps := config.PatternSet{exact, wildcard}
+	if !ps.MatchExact("http://example.com/callback") {
+		t.Errorf("expected match with exact pattern")
+	}
+	if ps.MatchExact("http://sub.example.com/callback") {
+		t.Errorf("expected not match with wildcard pattern")
+	}
+	if !ps.Match("http://sub.example.com/callback") {
+		t.Errorf("expected match with wildcard pattern by Match")
+	}
+}
+
+func TestPatternSet_OpenRedirect(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Input   string
+	}{
+		{"https://*.example.com/callback", "https://evil.com?.example.com/callback"},
+		{"https://*.example.com/callback", "https://evil.com#.example.com/callback"},
+		{"https://*.example.com/callback", "https://evil.com\\.example.com/callback"},
+		{"https://*.example.com/callback", "https://evil.com@x.example.com/callback"},
+		{"https://*.example.com/callback", "https://evil.com/.example.com/callback"},
+		{"https://*.example.com/callback", "https://x.example.com.evil.com/callback"},
+		{"https://example.com:*/callback", "https://example.com:@evil.com/callback"},
+		{"https://example.com/callback", "https://example.com/callback@evil.com"},
+		{"https://example.com/callback", "https://evil.com/https://example.com/callback"},
+		{"https://example.com/callback", "//evil.com/callback"},
+		{"http*://example.com/login/*", "https://evil.com?//example.com/login/x"},
+		{"http*://example.com/login/*", "javascript://example.com/login/%0aalert(1)"},
+	}
+
+	for _, tt := range tests {
+		var p config.Pattern
+		if err := p.UnmarshalText([]byte(tt.Pattern)); err != nil {
+			t.Fatalf("failed to parse pattern %#v: %s", tt.Pattern, err)
+		}
+
+		if (config.PatternSet{p}).Match(tt.Input) {
+			t.Errorf("%#v should not match to %#v", tt.Input, tt.Pattern)
+		}
+	}
+}
+
+func TestPatternSet_OpenRedirect_Fuzz(t *testing.T) {
+	patterns := []string{
+		"https://*.example.com/callback",
+		"https://example.com/login/*",
+		"https://example.com:*/**",
+		"http*://example.com/callback",
+	}
+	seeds := []string{
+		"https://a.example.com/callback",
+		"https://example.com/login/x",
+		"https://example.com:8000/a/b",
+		"http://example.com/callback",
+	}
+	pieces := []string{
+		"@", "?", "#", "\\", "/", "//", ":", ".", "%2F", "%40", "%23",
+		"evil.com", "@evil.com", ".evil.com", "evil.com/", "evil.com?", "evil.com#",
+	}
+
+	var ps config.PatternSet
+	for _, pat := range patterns {
+		var p config.Pattern
+		if err := p.UnmarshalText([]byte(pat)); err != nil {
+			t.Fatalf("failed to parse pattern %#v: %s", pat, err)
+		}
+		ps = append(ps, p)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100000; i++ {
+		input := seeds[rnd.Intn(len(seeds))]
+		for j := rnd.Intn(3) + 1; j > 0; j-- {
+			pos := rnd.Intn(len(input) + 1)
+			input = input[:pos] + pieces[rnd.Intn(len(pieces))] + input[pos:]
+		}
+
+		if !ps.Match(input) {
+			continue
+		}
+
+		u, err := url.Parse(input)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if host == "" || strings.Contains(host, ":") {
+			// Not a valid host. Browsers can't redirect to it.
+			continue
+		}
+		if host != "example.com" && !strings.HasSuffix(host, ".example.com") {
+			t.Errorf("%#v matched but redirects to %#v", input, host)
+		}
+		if u.User != nil {
+			t.Errorf("%#v matched but has userinfo", input)
+		}
+	}
+}
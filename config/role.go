@@ -0,0 +1,29 @@
+package config
+
+type RoleMapping struct {
+	Group string `json:"group" yaml:"group" toml:"group"`
+	Role  string `json:"role"  yaml:"role"  toml:"role"`
+}
+
+type RoleMappings []RoleMapping
+
+// RolesFor returns role names that mapped from the groups, in the order of mappings.
+func (rm RoleMappings) RolesFor(groups []string) []string {
+	roles := []string{}
+	seen := make(map[string]bool)
+
+	for _, m := range rm {
+		if seen[m.Role] {
+			continue
+		}
+		for _, g := range groups {
+			if EqualDN(m.Group, g) {
+				roles = append(roles, m.Role)
+				seen[m.Role] = true
+				break
+			}
+		}
+	}
+
+	return roles
+}
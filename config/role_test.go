@@ -0,0 +1,37 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestRoleMappings(t *testing.T) {
+	mappings := config.RoleMappings{
+		{Group: "CN=grafana-admins,OU=groups,DC=example,DC=com", Role: "admin"},
+		{Group: "CN=grafana-editors,OU=groups,DC=example,DC=com", Role: "editor"},
+		{Group: "CN=grafana-admins,OU=groups,DC=example,DC=com", Role: "editor"},
+		{Group: "CN=users,OU=groups,DC=example,DC=com", Role: "viewer"},
+	}
+
+	tests := []struct {
+		Groups []string
+		Roles  []string
+	}{
+		{nil, []string{}},
+		{[]string{"CN=someone,OU=groups,DC=example,DC=com"}, []string{}},
+		{[]string{"CN=users,OU=groups,DC=example,DC=com"}, []string{"viewer"}},
+		{[]string{"cn=Grafana-Admins, ou=groups, dc=example, dc=com"}, []string{"admin", "editor"}},
+		{
+			[]string{"CN=users,OU=groups,DC=example,DC=com", "CN=grafana-editors,OU=groups,DC=example,DC=com"},
+			[]string{"editor", "viewer"},
+		},
+	}
+
+	for _, tt := range tests {
+		if roles := mappings.RolesFor(tt.Groups); !reflect.DeepEqual(roles, tt.Roles) {
+			t.Errorf("%#v: expected %#v but got %#v", tt.Groups, tt.Roles, roles)
+		}
+	}
+}
@@ -18,18 +18,26 @@ func (sc ScopeConfig) AllClaims() []string {
 	return claims
 }
 
+// AttributesFor returns LDAP attribute names that required to make claims of the scopes, without duplicates.
+// Only these attributes are requested to LDAP server, to avoid fetching large attributes like photos.
 func (sc ScopeConfig) AttributesFor(scopes []string) []string {
-	var claims []string
+	var attrs []string
+	seen := make(map[string]bool)
 
 	for _, scopeName := range scopes {
 		if scope, ok := sc[scopeName]; ok {
 			for _, x := range scope {
-				claims = append(claims, x.Attribute)
+				for _, attr := range x.Attributes() {
+					if !seen[attr] {
+						seen[attr] = true
+						attrs = append(attrs, attr)
+					}
+				}
 			}
 		}
 	}
 
-	return claims
+	return attrs
 }
 
 func (sc ScopeConfig) ClaimMapFor(scopes []string) map[string]ClaimConfig {
@@ -38,7 +46,7 @@ func (sc ScopeConfig) ClaimMapFor(scopes []string) map[string]ClaimConfig {
 	for _, scopeName := range scopes {
 		if scope, ok := sc[scopeName]; ok {
 			for _, x := range scope {
-				claims[x.Attribute] = x
+				claims[x.Claim] = x
 			}
 		}
 	}
@@ -45,12 +45,35 @@ func TestScopeConfig(t *testing.T) {
 		t.Errorf("AttributesFor returns unexpected value: %#v", ss)
 	}
 
+	ss = conf.AttributesFor([]string{"openid"})
+	if len(ss) != 0 {
+		t.Errorf("AttributesFor returns unexpected value for unknown scope: %#v", ss)
+	}
+
 	maps := conf.ClaimMapFor([]string{"profile", "email"})
 	if !reflect.DeepEqual(maps, map[string]config.ClaimConfig{
-		"DisplayName": {Claim: "name", Attribute: "DisplayName", Type: "string"},
-		"GivenName":   {Claim: "given_name", Attribute: "GivenName", Type: "string"},
-		"mail":        {Claim: "email", Attribute: "mail", Type: "string"},
+		"name":       {Claim: "name", Attribute: "DisplayName", Type: "string"},
+		"given_name": {Claim: "given_name", Attribute: "GivenName", Type: "string"},
+		"email":      {Claim: "email", Attribute: "mail", Type: "string"},
 	}) {
 		t.Errorf("ClaimMapFor returns unexpected value: %#v", maps)
 	}
 }
+
+func TestScopeConfig_AttributesFor_Deduplicate(t *testing.T) {
+	conf := config.ScopeConfig{
+		"profile": {
+			{Claim: "name", Attribute: "displayName"},
+			{Claim: "preferred_username", Template: "{{ .uid }}@example.com"},
+			{Claim: "nickname", Template: `{{ index . "x-nick" }}`, ExtraAttributes: []string{"x-nick"}},
+		},
+		"email": {
+			{Claim: "email", Template: "{{ if .mail }}{{ .mail }}{{ else }}{{ .uid }}@example.com{{ end }}"},
+		},
+	}
+
+	ss := conf.AttributesFor([]string{"profile", "email"})
+	if !reflect.DeepEqual(ss, []string{"displayName", "uid", "x-nick", "mail"}) {
+		t.Errorf("AttributesFor returns unexpected value: %#v", ss)
+	}
+}
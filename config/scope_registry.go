@@ -0,0 +1,86 @@
+package config
+
+import (
+	"sort"
+)
+
+const (
+	// UnknownScopeStrip removes unknown scopes from the request, and grants only known scopes.
+	UnknownScopeStrip = "strip"
+
+	// UnknownScopeReject rejects the request that includes unknown scopes with invalid_scope error.
+	UnknownScopeReject = "reject"
+)
+
+var (
+	// DefaultScopeDescriptions are the descriptions of the built-in scopes.
+	DefaultScopeDescriptions = map[string]string{
+		"openid":  "Sign in with your account.",
+		"profile": "Your name.",
+		"email":   "Your email address.",
+		"phone":   "Your phone number.",
+		"groups":  "Groups that you belong to.",
+
+		"offline_access": "Stay connected while you are away.",
+	}
+)
+
+type ScopeRegistryConfig struct {
+	Descriptions map[string]string `json:"descriptions,omitempty" yaml:"descriptions,omitempty" toml:"descriptions,omitempty"`
+	Unknown      string            `json:"unknown,omitempty"      yaml:"unknown,omitempty"      toml:"unknown,omitempty"      flag:"unknown-scope"`
+}
+
+// KnownScopes returns sorted names of the scopes that accepted.
+// That is openid, scopes in the scope config, and scopes that have description in the scope registry.
+// offline_access is known too if RequireOfflineAccess is set.
+func (c *Config) KnownScopes() []string {
+	set := map[string]struct{}{"openid": {}}
+	if c.RequireOfflineAccess {
+		set["offline_access"] = struct{}{}
+	}
+	for name := range c.Scopes {
+		set[name] = struct{}{}
+	}
+	for name := range c.ScopeRegistry.Descriptions {
+		set[name] = struct{}{}
+	}
+
+	scopes := make([]string, 0, len(set))
+	for name := range set {
+		scopes = append(scopes, name)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// IsKnownScope checks if the scope is in KnownScopes.
+func (c *Config) IsKnownScope(scope string) bool {
+	if scope == "openid" || (scope == "offline_access" && c.RequireOfflineAccess) {
+		return true
+	}
+	if _, ok := c.Scopes[scope]; ok {
+		return true
+	}
+	_, ok := c.ScopeRegistry.Descriptions[scope]
+	return ok
+}
+
+// ScopeDescription returns the human readable description of the scope, or empty string if unknown.
+func (c *Config) ScopeDescription(scope string) string {
+	if d, ok := c.ScopeRegistry.Descriptions[scope]; ok {
+		return d
+	}
+	return DefaultScopeDescriptions[scope]
+}
+
+// FilterScopes splits the scopes into known ones and unknown ones.
+func (c *Config) FilterScopes(scopes []string) (known, unknown []string) {
+	for _, s := range scopes {
+		if c.IsKnownScope(s) {
+			known = append(known, s)
+		} else {
+			unknown = append(unknown, s)
+		}
+	}
+	return
+}
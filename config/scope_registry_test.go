@@ -0,0 +1,64 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestConfig_ScopeRegistry(t *testing.T) {
+	conf := &config.Config{
+		Scopes: config.DefaultScopes,
+		ScopeRegistry: config.ScopeRegistryConfig{
+			Descriptions: map[string]string{
+				"api:read": "Read your data.",
+				"profile":  "Your name and so on.",
+			},
+		},
+	}
+
+	expect := []string{"api:read", "email", "groups", "openid", "phone", "profile"}
+	if scopes := conf.KnownScopes(); !reflect.DeepEqual(scopes, expect) {
+		t.Errorf("unexpected known scopes: %#v", scopes)
+	}
+
+	known, unknown := conf.FilterScopes([]string{"openid", "api:read", "api:write", "email", "something"})
+	if !reflect.DeepEqual(known, []string{"openid", "api:read", "email"}) {
+		t.Errorf("unexpected known scopes: %#v", known)
+	}
+	if !reflect.DeepEqual(unknown, []string{"api:write", "something"}) {
+		t.Errorf("unexpected unknown scopes: %#v", unknown)
+	}
+
+	for scope, expect := range map[string]string{
+		"profile":   "Your name and so on.",
+		"email":     "Your email address.",
+		"api:read":  "Read your data.",
+		"something": "",
+	} {
+		if d := conf.ScopeDescription(scope); d != expect {
+			t.Errorf("%s: unexpected description: %#v", scope, d)
+		}
+	}
+}
+
+func TestConfig_ScopeRegistry_OfflineAccess(t *testing.T) {
+	conf := &config.Config{}
+
+	if conf.IsKnownScope("offline_access") {
+		t.Errorf("offline_access is known without RequireOfflineAccess")
+	}
+
+	conf.RequireOfflineAccess = true
+
+	if !conf.IsKnownScope("offline_access") {
+		t.Errorf("offline_access is unknown with RequireOfflineAccess")
+	}
+	if scopes := conf.KnownScopes(); !reflect.DeepEqual(scopes, []string{"offline_access", "openid"}) {
+		t.Errorf("unexpected known scopes: %#v", scopes)
+	}
+	if d := conf.ScopeDescription("offline_access"); d == "" {
+		t.Errorf("offline_access has no description")
+	}
+}
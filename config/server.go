@@ -0,0 +1,53 @@
+package config
+
+import (
+	"net"
+	"strings"
+)
+
+// trustsProxy reports whether ip is in TrustedProxies.
+func (c ServerConfig) trustsProxy(ip net.IP) bool {
+	for _, proxy := range c.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if p := net.ParseIP(proxy); p != nil && p.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if _, n, err := net.ParseCIDR(proxy); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client, from the address of the peer and the X-Forwarded-For header.
+//
+// The header is used only if the peer is one of TrustedProxies, because anyone can set it.
+// The addresses in the header are read from the right, and the first one that isn't a trusted proxy is the client.
+func (c ServerConfig) ClientIP(remoteAddr, forwardedFor string) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(remoteAddr)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if !c.trustsProxy(ip) || forwardedFor == "" {
+		return ip.String()
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !c.trustsProxy(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
@@ -0,0 +1,38 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestServerConfig_ClientIP(t *testing.T) {
+	c := config.ServerConfig{TrustedProxies: []string{"10.0.0.1", "192.0.2.0/24"}}
+
+	tests := []struct {
+		Remote       string
+		ForwardedFor string
+		Expect       string
+	}{
+		{"203.0.113.5:1234", "", "203.0.113.5"},
+		{"203.0.113.5:1234", "10.1.2.3", "203.0.113.5"},
+		{"[::1]:1234", "10.1.2.3", "::1"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"10.0.0.1:1234", "203.0.113.5", "203.0.113.5"},
+		{"10.0.0.1:1234", "10.1.2.3, 203.0.113.5", "203.0.113.5"},
+		{"10.0.0.1:1234", "203.0.113.5, 192.0.2.8", "203.0.113.5"},
+		{"10.0.0.1:1234", "192.0.2.9, 192.0.2.8", "192.0.2.9"},
+		{"10.0.0.1:1234", "203.0.113.5, invalid", "10.0.0.1"},
+		{"invalid", "", ""},
+	}
+
+	for _, tt := range tests {
+		if ip := c.ClientIP(tt.Remote, tt.ForwardedFor); ip != tt.Expect {
+			t.Errorf("%s with %#v: expected %#v but got %#v", tt.Remote, tt.ForwardedFor, tt.Expect, ip)
+		}
+	}
+
+	if ip := (config.ServerConfig{}).ClientIP("10.0.0.1:1234", "203.0.113.5"); ip != "10.0.0.1" {
+		t.Errorf("X-Forwarded-For should not be trusted without trusted proxies: %s", ip)
+	}
+}
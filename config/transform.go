@@ -0,0 +1,276 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/gobwas/glob"
+)
+
+var (
+	regexpCache   sync.Map
+	templateCache sync.Map
+	globCache     sync.Map
+
+	claimTemplateFuncs = template.FuncMap{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}
+)
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(pattern, re)
+	return re, nil
+}
+
+// compileGlob compiles the pattern for `include`, that matches without case.
+func compileGlob(pattern string) (glob.Glob, error) {
+	if g, ok := globCache.Load(pattern); ok {
+		return g.(glob.Glob), nil
+	}
+	g, err := glob.Compile(strings.ToLower(pattern))
+	if err != nil {
+		return nil, err
+	}
+	globCache.Store(pattern, g)
+	return g, nil
+}
+
+func compileTemplate(text string) (*template.Template, error) {
+	if tmpl, ok := templateCache.Load(text); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("claim").Funcs(claimTemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	templateCache.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// templateFields returns attribute names that referenced in the template like `{{ .uid }}`.
+func templateFields(tmpl *template.Template) []string {
+	var fields []string
+	seen := make(map[string]bool)
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, x := range n.Nodes {
+				walk(x)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, x := range n.Cmds {
+				walk(x)
+			}
+		case *parse.CommandNode:
+			for _, x := range n.Args {
+				walk(x)
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.FieldNode:
+			if len(n.Ident) > 0 && !seen[n.Ident[0]] {
+				seen[n.Ident[0]] = true
+				fields = append(fields, n.Ident[0])
+			}
+		}
+	}
+	walk(tmpl.Tree.Root)
+
+	return fields
+}
+
+// Check returns error if the claim config has invalid transformation.
+func (c ClaimConfig) Check() error {
+	if c.Attribute == "" && c.Template == "" {
+		return fmt.Errorf("claim %#v: attribute or template is required", c.Claim)
+	}
+	if c.Template != "" {
+		if _, err := compileTemplate(c.Template); err != nil {
+			return fmt.Errorf("claim %#v: invalid template: %s", c.Claim, err)
+		}
+	}
+	if c.Regex != "" {
+		if _, err := compileRegexp(c.Regex); err != nil {
+			return fmt.Errorf("claim %#v: invalid regex: %s", c.Claim, err)
+		}
+	}
+	for _, p := range c.Include {
+		if _, err := compileGlob(p); err != nil {
+			return fmt.Errorf("claim %#v: invalid include pattern %#v: %s", c.Claim, p, err)
+		}
+	}
+	switch c.Case {
+	case "", "lower", "upper":
+	default:
+		return fmt.Errorf("claim %#v: case must be \"lower\" or \"upper\" but got %#v", c.Claim, c.Case)
+	}
+	return nil
+}
+
+// Attributes returns LDAP attribute names that required to make this claim.
+// ExtraAttributes are included for templates that refer attributes in the way that can't be detected, like `{{ index . "x-attr" }}`.
+func (c ClaimConfig) Attributes() []string {
+	var attrs []string
+	if c.Attribute != "" {
+		attrs = append(attrs, c.Attribute)
+	}
+	if c.Template != "" {
+		if tmpl, err := compileTemplate(c.Template); err == nil {
+			attrs = append(attrs, templateFields(tmpl)...)
+		}
+	}
+	return append(attrs, c.ExtraAttributes...)
+}
+
+// Apply makes claim value from LDAP attributes.
+// The second return value is false if the user has no attributes for this claim.
+func (c ClaimConfig) Apply(attrs map[string][]string) (interface{}, bool) {
+	var values []string
+
+	if c.Template != "" {
+		tmpl, err := compileTemplate(c.Template)
+		if err != nil {
+			return nil, false
+		}
+
+		found := false
+		data := make(map[string]string)
+		for _, name := range c.Attributes() {
+			if vs, ok := attrs[name]; ok {
+				found = true
+				if len(vs) > 0 {
+					data[name] = vs[0]
+				}
+			}
+		}
+		if !found {
+			return nil, false
+		}
+
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, false
+		}
+		values = []string{buf.String()}
+	} else {
+		vs, ok := attrs[c.Attribute]
+		if !ok {
+			return nil, false
+		}
+		values = vs
+	}
+
+	if c.RDN {
+		values = mapStrings(values, firstRDNValue)
+	}
+
+	if c.Regex != "" {
+		re, err := compileRegexp(c.Regex)
+		if err != nil {
+			return nil, false
+		}
+
+		var matched []string
+		for _, v := range values {
+			if m := re.FindStringSubmatch(v); m != nil {
+				if len(m) > 1 {
+					matched = append(matched, m[1])
+				} else {
+					matched = append(matched, m[0])
+				}
+			}
+		}
+		values = matched
+	}
+
+	if c.TrimPrefix != "" || c.TrimSuffix != "" {
+		values = mapStrings(values, func(v string) string {
+			return strings.TrimSuffix(strings.TrimPrefix(v, c.TrimPrefix), c.TrimSuffix)
+		})
+	}
+
+	if len(c.Include) > 0 {
+		var included []string
+		for _, v := range values {
+			if c.included(v) {
+				included = append(included, v)
+			}
+		}
+		values = included
+	}
+
+	switch c.Case {
+	case "lower":
+		values = mapStrings(values, strings.ToLower)
+	case "upper":
+		values = mapStrings(values, strings.ToUpper)
+	}
+
+	if c.Join != "" {
+		values = []string{strings.Join(values, c.Join)}
+	}
+
+	return c.Type.Convert(values), true
+}
+
+func mapStrings(values []string, f func(string) string) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = f(v)
+	}
+	return result
+}
+
+// included checks if the value matches any pattern in `include`.
+func (c ClaimConfig) included(value string) bool {
+	value = strings.ToLower(value)
+	for _, p := range c.Include {
+		if g, err := compileGlob(p); err == nil && g.Match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstRDNValue returns the value of the first RDN like "vpn-users" for "CN=vpn-users,OU=Groups,DC=example,DC=com".
+// The value is kept as is if it is not a DN.
+func firstRDNValue(value string) string {
+	dn, err := ldap.ParseDN(value)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return value
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
@@ -0,0 +1,131 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestClaimConfig_Apply(t *testing.T) {
+	attrs := map[string][]string{
+		"uid":      {"macrat"},
+		"sn":       {"Shida"},
+		"mail":     {"M@Crat.JP", "another@example.com"},
+		"memberOf": {"CN=admins,OU=groups,DC=example,DC=com", "CN=users,OU=groups,DC=example,DC=com", "OU=something"},
+		"vpnGroup": {"CN=app-vpn-users,OU=groups,DC=example,DC=com", "CN=app-wiki-users,OU=groups,DC=example,DC=com", "CN=app-VPN-Admins,OU=groups,DC=example,DC=com"},
+		"x-nick":   {"mac"},
+	}
+
+	tests := []struct {
+		Config config.ClaimConfig
+		Expect interface{}
+		Exists bool
+	}{
+		{
+			Config: config.ClaimConfig{Claim: "preferred_username", Template: "{{ .uid }}@example.com", Type: "string"},
+			Expect: "macrat@example.com",
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "name", Template: "{{ .uid }} {{ upper .sn }} {{ .nothing }}", Type: "string"},
+			Expect: "macrat SHIDA ",
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "nothing", Template: "{{ .nothing }}", Type: "string"},
+			Exists: false,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "nickname", Template: `{{ index . "x-nick" }}`, ExtraAttributes: []string{"x-nick"}, Type: "string"},
+			Expect: "mac",
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "email", Attribute: "mail", Case: "lower", Type: "string"},
+			Expect: "m@crat.jp",
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "groups", Attribute: "memberOf", Regex: "^CN=([^,]+)", Type: "[]string"},
+			Expect: []string{"admins", "users"},
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "groups", Attribute: "memberOf", Regex: "^CN=[^,]+", Case: "upper", Join: " ", Type: "string"},
+			Expect: "CN=ADMINS CN=USERS",
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "groups", Attribute: "memberOf", RDN: true, Type: "[]string"},
+			Expect: []string{"admins", "users", "something"},
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "groups", Attribute: "vpnGroup", RDN: true, TrimPrefix: "app-", Include: []string{"vpn-*"}, Type: "[]string"},
+			Expect: []string{"vpn-users", "VPN-Admins"},
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "groups", Attribute: "vpnGroup", RDN: true, TrimSuffix: "-users", Include: []string{"app-wiki"}, Type: "[]string"},
+			Expect: []string{"app-wiki"},
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "groups", Attribute: "vpnGroup", Include: []string{"nothing-*"}, Type: "[]string"},
+			Expect: []string(nil),
+			Exists: true,
+		},
+		{
+			Config: config.ClaimConfig{Claim: "nothing", Attribute: "nothing", Type: "string"},
+			Exists: false,
+		},
+	}
+
+	for _, tt := range tests {
+		if err := tt.Config.Check(); err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Config.Claim, err)
+			continue
+		}
+
+		value, ok := tt.Config.Apply(attrs)
+		if ok != tt.Exists {
+			t.Errorf("%s: expected exists %v but got %v", tt.Config.Claim, tt.Exists, ok)
+		} else if ok && !reflect.DeepEqual(value, tt.Expect) {
+			t.Errorf("%s: expected %#v but got %#v", tt.Config.Claim, tt.Expect, value)
+		}
+	}
+}
+
+func TestClaimConfig_Check(t *testing.T) {
+	tests := []struct {
+		Config config.ClaimConfig
+		Error  string
+	}{
+		{config.ClaimConfig{Claim: "x"}, `claim "x": attribute or template is required`},
+		{config.ClaimConfig{Claim: "x", Template: "{{ .uid"}, `claim "x": invalid template: template: claim:1: unclosed action`},
+		{config.ClaimConfig{Claim: "x", Attribute: "uid", Regex: "("}, "claim \"x\": invalid regex: error parsing regexp: missing closing ): `(`"},
+		{config.ClaimConfig{Claim: "x", Attribute: "uid", Case: "title"}, `claim "x": case must be "lower" or "upper" but got "title"`},
+		{config.ClaimConfig{Claim: "x", Attribute: "uid", Include: []string{"vpn-["}}, `claim "x": invalid include pattern "vpn-[": unexpected end of input`},
+	}
+
+	for _, tt := range tests {
+		if err := tt.Config.Check(); err == nil {
+			t.Errorf("expected error %#v but got nil", tt.Error)
+		} else if err.Error() != tt.Error {
+			t.Errorf("expected error %#v but got %#v", tt.Error, err.Error())
+		}
+	}
+}
+
+func TestClaimConfig_Attributes(t *testing.T) {
+	c := config.ClaimConfig{Claim: "x", Template: "{{ if .mail }}{{ .mail }}{{ else }}{{ lower .uid }}@example.com{{ end }}"}
+	if attrs := c.Attributes(); !reflect.DeepEqual(attrs, []string{"mail", "uid"}) {
+		t.Errorf("unexpected attributes: %#v", attrs)
+	}
+
+	c = config.ClaimConfig{Claim: "x", Template: `{{ .uid }}:{{ index . "x-nick" }}`, ExtraAttributes: []string{"x-nick"}}
+	if attrs := c.Attributes(); !reflect.DeepEqual(attrs, []string{"uid", "x-nick"}) {
+		t.Errorf("unexpected attributes with extra attributes: %#v", attrs)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/secret"
+)
+
+const (
+	DemoClientID = "demo-client"
+	demoGroups   = "OU=groups,DC=example,DC=com"
+)
+
+// DemoUsers are the users of --demo mode. Attributes are for the default claims of ActiveDirectory.
+var DemoUsers = ldap.MemoryDirectory{
+	"alice": {
+		Password: "alice-password",
+		Attributes: map[string][]string{
+			"displayName":     {"Alice Liddell"},
+			"givenName":       {"Alice"},
+			"sn":              {"Liddell"},
+			"mail":            {"alice@example.com"},
+			"telephoneNumber": {"+1-555-0100"},
+			"memberOf":        {"CN=admins," + demoGroups, "CN=users," + demoGroups},
+		},
+	},
+	"bob": {
+		Password: "bob-password",
+		Attributes: map[string][]string{
+			"displayName": {"Bob Smith"},
+			"givenName":   {"Bob"},
+			"sn":          {"Smith"},
+			"mail":        {"bob@example.com"},
+			"memberOf":    {"CN=users," + demoGroups},
+		},
+	},
+}
+
+// demoRedirectURIs are the redirect URIs of the demo client.
+// They cover local apps and https://oidcdebugger.com, so the flow can be tried without writing a client.
+var demoRedirectURIs = []string{
+	"http://localhost:*/**",
+	"http://127.0.0.1:*/**",
+	"https://oidcdebugger.com/debug",
+}
+
+// SetupDemo changes conf to use DemoUsers instead of LDAP server, and registers the demo client with a random secret.
+// It returns the plain client secret for showing to the user.
+func SetupDemo(conf *config.Config) (string, error) {
+	conf.LDAP.Server = &config.URL{Scheme: "memory", Host: "demo"}
+	conf.LDAP.Bind = config.LDAPBindSimple
+	conf.LDAP.User = "demo"
+	conf.LDAP.Password = "demo"
+	conf.LDAP.BaseDN = "DC=example,DC=com"
+
+	sec, err := secret.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	var uris config.PatternSet
+	for _, u := range demoRedirectURIs {
+		var p config.Pattern
+		if err := p.UnmarshalText([]byte(u)); err != nil {
+			return "", err
+		}
+		uris = append(uris, p)
+	}
+
+	if conf.Clients == nil {
+		conf.Clients = make(config.ClientConfigSet)
+	}
+	conf.Clients[DemoClientID] = config.ClientConfig{
+		Name:        "Demo Client",
+		Secret:      string(sec.Hash),
+		RedirectURI: uris,
+	}
+
+	return string(sec.Secret), nil
+}
+
+// PrintDemo shows the users and the client of --demo mode.
+func PrintDemo(w io.Writer, conf *config.Config, clientSecret string) {
+	names := make([]string, 0, len(DemoUsers))
+	for name := range DemoUsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Demo mode: users are kept in memory, and no LDAP server is used.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Users:")
+	for _, name := range names {
+		u := DemoUsers[name]
+		fmt.Fprintf(w, "  username: %-8s password: %-16s groups: %v\n", name, u.Password, u.Attributes["memberOf"])
+	}
+	fmt.Fprintln(w)
+
+	authz := conf.Issuer.URL().ResolveReference(&url.URL{Path: conf.EndpointPaths().Authz})
+	authz.RawQuery = url.Values{
+		"client_id":     {DemoClientID},
+		"response_type": {"code"},
+		"scope":         {"openid profile email"},
+		"redirect_uri":  {"http://localhost:8080/callback"},
+	}.Encode()
+
+	fmt.Fprintln(w, "Client:")
+	fmt.Fprintf(w, "  client_id:     %s\n", DemoClientID)
+	fmt.Fprintf(w, "  client_secret: %s\n", clientSecret)
+	fmt.Fprintf(w, "  redirect_uri:  %v\n", demoRedirectURIs)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Try login: %s\n", authz)
+	fmt.Fprintln(w)
+}
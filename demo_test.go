@@ -0,0 +1,59 @@
+package main_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/secret"
+)
+
+func TestSetupDemo(t *testing.T) {
+	conf := &config.Config{}
+	if err := conf.Load("./config.example.toml", nil); err != nil {
+		t.Fatalf("failed to load example config: %s", err)
+	}
+
+	clientSecret, err := main.SetupDemo(conf)
+	if err != nil {
+		t.Fatalf("failed to setup demo: %s", err)
+	}
+
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("demo config is invalid: %s", err)
+	}
+
+	client, ok := conf.Clients[main.DemoClientID]
+	if !ok {
+		t.Fatalf("demo client is not registered")
+	}
+	if err := secret.Compare(client.Secret, clientSecret); err != nil {
+		t.Errorf("client secret doesn't match: %s", err)
+	}
+	if !client.RedirectURI.Match("http://localhost:8080/callback") {
+		t.Errorf("redirect URI on localhost should be accepted")
+	}
+	if client.RedirectURI.Match("https://evil.example.com/callback") {
+		t.Errorf("redirect URI on other hosts should not be accepted")
+	}
+
+	conn, err := main.DemoUsers.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect demo users: %s", err)
+	}
+	for name, user := range main.DemoUsers {
+		if err := conn.LoginTest(name, user.Password); err != nil {
+			t.Errorf("failed to login as %s: %s", name, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	main.PrintDemo(&buf, conf, clientSecret)
+	for _, s := range []string{"alice-password", "bob-password", main.DemoClientID, clientSecret, "http://localhost:8000/login?client_id=demo-client"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("output should include %#v:\n%s", s, buf.String())
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/redact"
+)
+
+var sensitiveOption = regexp.MustCompile(`(?i)(?:^|_)(?:` + redact.SensitiveKeys + `)$`)
+
+// formatOption formats the option value for the dry-run output, with masking credentials.
+func formatOption(key string, value interface{}) string {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	if sensitiveOption.MatchString(key) {
+		return redact.MASK
+	}
+
+	if s, ok := value.(string); ok {
+		if u, err := url.Parse(s); err == nil && u.User != nil {
+			s = u.Redacted()
+		}
+		value = s
+	}
+
+	var s string
+	if bs, err := json.Marshal(value); err == nil {
+		s = string(bs)
+	} else {
+		s = fmt.Sprint(value)
+	}
+	return redact.String(s)
+}
+
+// PrintConfigLayers writes the options that each config file added or overrode.
+// If no file given, use files in LAUTH_CONFIG like Config.LoadFiles.
+func PrintConfigLayers(w io.Writer, files []string) error {
+	if len(files) == 0 {
+		files = filepath.SplitList(os.Getenv("LAUTH_CONFIG"))
+	}
+
+	layers, err := config.DiffFiles(files)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range layers {
+		fmt.Fprintf(w, "%s:\n", l.File)
+		if len(l.Changes) == 0 {
+			fmt.Fprintln(w, "  (no changes)")
+		}
+		for _, c := range l.Changes {
+			if c.Added {
+				fmt.Fprintf(w, "  + %s = %s\n", c.Key, formatOption(c.Key, c.New))
+			} else {
+				fmt.Fprintf(w, "  ~ %s = %s -> %s\n", c.Key, formatOption(c.Key, c.Old), formatOption(c.Key, c.New))
+			}
+		}
+	}
+	return nil
+}
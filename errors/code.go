@@ -0,0 +1,117 @@
+package errors
+
+import (
+	"net/url"
+	"path"
+)
+
+// Code is the stable identifier of an error, for looking up the explanation and for quoting in support tickets.
+// Unlike Reason, Code is never shared between the different kind of failures.
+type Code string
+
+func (c Code) String() string {
+	return string(c)
+}
+
+// CodeInfo is the explanation of a Code.
+type CodeInfo struct {
+	Code        Code
+	Reason      Reason
+	Title       string
+	Explanation string
+}
+
+var (
+	codes = []CodeInfo{
+		{"LA1001", InvalidRequest, "Invalid request", "A required parameter is missing, a parameter has an invalid value, or the request is malformed. The client application has to fix the request."},
+		{"LA1002", InvalidRequestObject, "Invalid request object", "The request object in the request parameter is not a valid signed JWT, or its claims are invalid."},
+		{"LA1003", InvalidRequestURI, "Invalid request URI", "The request_uri parameter refers to an invalid or unreachable request object."},
+		{"LA1004", RequestNotSupported, "Request object is not supported", "The request parameter was used, but this server doesn't support it."},
+		{"LA1005", RequestURINotSupported, "Request URI is not supported", "The request_uri parameter was used, but this server doesn't support it."},
+		{"LA1006", UnsupportedResponseType, "Unsupported response type", "The response_type is not supported by this server or not allowed for the client."},
+		{"LA1007", UnsupportedGrantType, "Unsupported grant type", "The grant_type is not supported by this server or not allowed for the client."},
+		{"LA1008", InvalidScope, "Invalid scope", "The requested scope is unknown, malformed, or exceeds the scope that granted before."},
+		{"LA1009", MethodNotAllowed, "Method not allowed", "The HTTP method is not supported by this endpoint."},
+		{"LA1010", PageNotFound, "Page not found", "There is no page at the requested URL. Please check the link."},
+		{"LA1011", RequestTooLarge, "Request too large", "The request body is larger than the limit of this server."},
+		{"LA1012", URITooLong, "URI too long", "The request URL is longer than the limit of this server."},
+		{"LA1013", UnknownUserID, "Unknown user", "The login_hint of the backchannel authentication request doesn't match any user."},
+		{"LA1014", InvalidBindingMessage, "Invalid binding message", "The binding_message of the backchannel authentication request is too long or has characters that can't be shown to the user."},
+		{"LA2001", InvalidClient, "Invalid client", "The client is not registered, or the client authentication is failed. Please check the client_id and client_secret."},
+		{"LA2002", UnauthorizedClient, "Unauthorized client", "The client is registered, but not allowed to make this request, for example with the redirect_uri or the grant type."},
+		{"LA3001", InvalidGrant, "Invalid grant", "The authorization code or refresh token is invalid, expired, revoked, or issued to another client. Please sign in again."},
+		{"LA3002", InvalidToken, "Invalid token", "The access token is invalid, expired, or revoked. Please get a new token."},
+		{"LA3003", InsufficientScope, "Insufficient scope", "The access token doesn't have the scope that required for this request."},
+		{"LA3004", ExpiredToken, "Expired request", "The user didn't approve the backchannel authentication request in time. Please start a new request."},
+		{"LA4001", AccessDenied, "Access denied", "The user or the server's policy denied the request. Please ask the administrator if you need access."},
+		{"LA4002", LoginRequired, "Login required", "The client requested not to show the login page, but the user is not signed in."},
+		{"LA4003", InteractionRequired, "Interaction required", "The client requested not to show any page, but the request needs an interaction with the user."},
+		{"LA4004", ConsentRequired, "Consent required", "The client requested not to show any page, but the user hasn't allowed the client or the requested scope yet."},
+		{QuotaExceeded, AccessDenied, "Quota exceeded", "Too many tokens were issued to the user or the client in a short time. Please retry later, or ask the administrator if it continues."},
+		{"LA4006", AuthorizationPending, "Authorization pending", "The user hasn't approved the backchannel authentication request yet. The client should poll again after the interval."},
+		{"LA4007", SlowDown, "Slow down", "The client polls the result of the backchannel authentication request too frequently. The client should poll 5 seconds slower than before."},
+		{"LA5001", ServerError, "Internal server error", "The server failed to process the request. Please report the error code and the time to the administrator."},
+		{"LA5002", TemporarilyUnavailable, "Temporarily unavailable", "The server is overloaded or under maintenance. Please try again later."},
+	}
+
+	// QuotaExceeded is the code of access_denied that caused by --tokens-per-subject or --tokens-per-client.
+	QuotaExceeded Code = "LA4005"
+
+	// UnknownCode is the code of errors that have a reason without its own code.
+	UnknownCode Code = "LA0000"
+
+	codeByReason = make(map[Reason]Code)
+	infoByCode   = make(map[Code]CodeInfo)
+
+	documentBase *url.URL
+)
+
+func init() {
+	for _, c := range codes {
+		// The first code of each reason is the default, and the others have to be set to Error.Code explicitly.
+		if _, ok := codeByReason[c.Reason]; !ok {
+			codeByReason[c.Reason] = c.Code
+		}
+		infoByCode[c.Code] = c
+	}
+}
+
+// Codes returns all known codes in order.
+func Codes() []CodeInfo {
+	cs := make([]CodeInfo, len(codes))
+	copy(cs, codes)
+	return cs
+}
+
+// LookupCode returns the explanation of the code.
+func LookupCode(code Code) (CodeInfo, bool) {
+	info, ok := infoByCode[code]
+	return info, ok
+}
+
+// SetDocumentBase sets the URL of the explanation pages, like "https://auth.example.com/errors".
+// error_uri is not included in responses until this is set.
+func SetDocumentBase(u *url.URL) {
+	documentBase = u
+}
+
+// ErrorCode returns Code if set, or the code of Reason.
+func (e *Error) ErrorCode() Code {
+	if e.Code != "" {
+		return e.Code
+	}
+	if c, ok := codeByReason[e.Reason]; ok {
+		return c
+	}
+	return UnknownCode
+}
+
+// ErrorURI returns the URL of the explanation page, or an empty string if SetDocumentBase is not called.
+func (e *Error) ErrorURI() string {
+	if documentBase == nil {
+		return ""
+	}
+	u := *documentBase
+	u.Path = path.Join(u.Path, string(e.ErrorCode()))
+	return u.String()
+}
@@ -0,0 +1,130 @@
+package errors_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestCodes(t *testing.T) {
+	reasons := []errors.Reason{
+		errors.AccessDenied,
+		errors.AuthorizationPending,
+		errors.ExpiredToken,
+		errors.InvalidBindingMessage,
+		errors.SlowDown,
+		errors.UnknownUserID,
+		errors.InteractionRequired,
+		errors.InvalidClient,
+		errors.InvalidGrant,
+		errors.InvalidRequest,
+		errors.InvalidRequestObject,
+		errors.InvalidRequestURI,
+		errors.InvalidScope,
+		errors.InvalidToken,
+		errors.InsufficientScope,
+		errors.LoginRequired,
+		errors.RequestNotSupported,
+		errors.RequestURINotSupported,
+		errors.ServerError,
+		errors.TemporarilyUnavailable,
+		errors.UnauthorizedClient,
+		errors.UnsupportedGrantType,
+		errors.UnsupportedResponseType,
+		errors.MethodNotAllowed,
+		errors.PageNotFound,
+		errors.RequestTooLarge,
+		errors.URITooLong,
+	}
+
+	seen := make(map[errors.Code]bool)
+	for _, info := range errors.Codes() {
+		if seen[info.Code] {
+			t.Errorf("code %s is duplicated", info.Code)
+		}
+		seen[info.Code] = true
+
+		if info.Title == "" || info.Explanation == "" {
+			t.Errorf("code %s has no explanation", info.Code)
+		}
+		if got, ok := errors.LookupCode(info.Code); !ok || got != info {
+			t.Errorf("failed to lookup code %s", info.Code)
+		}
+	}
+
+	for _, r := range reasons {
+		code := (&errors.Error{Reason: r}).ErrorCode()
+		if code == errors.UnknownCode {
+			t.Errorf("reason %s has no code", r)
+		}
+	}
+
+	if _, ok := errors.LookupCode("LA9999"); ok {
+		t.Errorf("unknown code found")
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		Error *errors.Error
+		Code  errors.Code
+	}{
+		{&errors.Error{Reason: errors.InvalidRequest}, "LA1001"},
+		{&errors.Error{Reason: errors.InvalidGrant}, "LA3001"},
+		{&errors.Error{Reason: errors.ServerError}, "LA5001"},
+		{&errors.Error{Reason: errors.InvalidRequest, Code: "LA1010"}, "LA1010"},
+		{&errors.Error{Reason: "something_wrong"}, errors.UnknownCode},
+	}
+
+	for _, tt := range tests {
+		if got := tt.Error.ErrorCode(); got != tt.Code {
+			t.Errorf("%s: expected %s but got %s", tt.Error.Reason, tt.Code, got)
+		}
+	}
+}
+
+func TestError_MarshalJSON(t *testing.T) {
+	e := &errors.Error{
+		Reason:      errors.InvalidGrant,
+		Description: "code is expired",
+		State:       "hello",
+	}
+
+	errors.SetDocumentBase(nil)
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	expected := `{"state":"hello","error":"invalid_grant","error_description":"code is expired","error_code":"LA3001"}`
+	if string(b) != expected {
+		t.Errorf("unexpected JSON without document base: %s", b)
+	}
+
+	errors.SetDocumentBase(testutil.MustParseURL("https://auth.example.com/errors"))
+	defer errors.SetDocumentBase(nil)
+
+	b, err = json.Marshal(e)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	expected = `{"state":"hello","error":"invalid_grant","error_description":"code is expired","error_code":"LA3001","error_uri":"https://auth.example.com/errors/LA3001"}`
+	if string(b) != expected {
+		t.Errorf("unexpected JSON with document base: %s", b)
+	}
+}
+
+func TestCodes_QuotaExceeded(t *testing.T) {
+	if code := (&errors.Error{Reason: errors.AccessDenied}).ErrorCode(); code != "LA4001" {
+		t.Errorf("default code of access_denied should be LA4001 but got %s", code)
+	}
+
+	e := &errors.Error{Reason: errors.AccessDenied, Code: errors.QuotaExceeded}
+	if code := e.ErrorCode(); code != "LA4005" {
+		t.Errorf("unexpected code: %s", code)
+	}
+	if status := e.StatusCode(); status != 429 {
+		t.Errorf("unexpected status code: %d", status)
+	}
+}
@@ -1,17 +1,47 @@
 package errors
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/url"
+
+	"github.com/macrat/lauth/redact"
 )
 
 type Error struct {
 	Err          error    `json:"-"`
 	RedirectURI  *url.URL `json:"-"`
 	ResponseType string   `json:"-"`
+	ResponseMode string   `json:"-"`
+	ClientID     string   `json:"-"`
 	State        string   `json:"state,omitempty"`
+	Issuer       string   `json:"-"`
 	Reason       Reason   `json:"error"`
 	Description  string   `json:"error_description,omitempty"`
+
+	// Code is the specific code of this error. The code of Reason is used if it is empty.
+	Code Code `json:"-"`
+}
+
+func (e Error) MarshalJSON() ([]byte, error) {
+	type plain Error
+	return json.Marshal(struct {
+		plain
+		ErrorCode Code   `json:"error_code"`
+		ErrorURI  string `json:"error_uri,omitempty"`
+	}{plain(e), e.ErrorCode(), e.ErrorURI()})
+}
+
+// UsesFragment checks if the error should be sent in the fragment of the redirect URI rather than the query.
+// It follows ResponseMode if set, otherwise the default of ResponseType.
+func (e *Error) UsesFragment() bool {
+	switch e.ResponseMode {
+	case "fragment", "fragment.jwt":
+		return true
+	case "query", "query.jwt":
+		return false
+	}
+	return e.ResponseType != "code" && e.ResponseType != ""
 }
 
 func (e *Error) Unwrap() error {
@@ -26,19 +56,29 @@ func (e *Error) Error() string {
 	if e.Err != nil {
 		msg += ": " + e.Err.Error()
 	}
-	return msg
+	return redact.String(msg)
 }
 
 func (e *Error) StatusCode() int {
+	if e.Code == QuotaExceeded {
+		return http.StatusTooManyRequests
+	}
+
 	switch e.Reason {
 	case ServerError:
 		return http.StatusInternalServerError
-	case InvalidToken:
+	case TemporarilyUnavailable:
+		return http.StatusServiceUnavailable
+	case InvalidToken, InsufficientScope:
 		return http.StatusForbidden
 	case MethodNotAllowed:
 		return http.StatusMethodNotAllowed
 	case PageNotFound:
 		return http.StatusNotFound
+	case RequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case URITooLong:
+		return http.StatusRequestURITooLong
 	default:
 		return http.StatusBadRequest
 	}
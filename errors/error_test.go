@@ -40,6 +40,13 @@ func TestErrorString(t *testing.T) {
 				Err:         fmt.Errorf("err"),
 			},
 		},
+		{
+			"invalid_grant: invalid code: [REDACTED]",
+			&errors.Error{
+				Reason: errors.InvalidGrant,
+				Err:    fmt.Errorf("invalid code: eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJtYWNyYXQifQ.c2ln"),
+			},
+		},
 	}
 
 	for _, tt := range tests {
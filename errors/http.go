@@ -6,20 +6,28 @@ import (
 	"net/url"
 
 	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/page"
 )
 
 func SendHTML(c *gin.Context, e *Error) {
+	l := page.GetLocale(c)
 	c.HTML(e.StatusCode(), "error.tmpl", gin.H{
-		"error": e,
+		"error":         e,
+		"error_message": l.ErrorMessage(string(e.Reason)),
+		"error_code":    e.ErrorCode(),
+		"error_uri":     e.ErrorURI(),
+		"locale":        l,
+		"csp_nonce":     page.GetCSPNonce(c),
 	})
 }
 
-func SendRedirect(c *gin.Context, e *Error) {
-	if e.RedirectURI == nil || e.RedirectURI.String() == "" || !e.RedirectURI.IsAbs() {
-		SendHTML(c, e)
-		return
-	}
+// CanRedirect checks if the error has a valid redirect URI to send.
+func (e *Error) CanRedirect() bool {
+	return e.RedirectURI != nil && e.RedirectURI.String() != "" && e.RedirectURI.IsAbs()
+}
 
+// RedirectParams returns the parameters to send the error to the redirect URI.
+func (e *Error) RedirectParams() url.Values {
 	resp := make(url.Values)
 	if e.State != "" {
 		resp.Set("state", e.State)
@@ -29,8 +37,23 @@ func SendRedirect(c *gin.Context, e *Error) {
 	if e.Description != "" {
 		resp.Set("error_description", e.Description)
 	}
+	if uri := e.ErrorURI(); uri != "" {
+		resp.Set("error_uri", uri)
+	}
+	if e.Issuer != "" {
+		resp.Set("iss", e.Issuer)
+	}
+	return resp
+}
+
+func SendRedirect(c *gin.Context, e *Error) {
+	if !e.CanRedirect() {
+		SendHTML(c, e)
+		return
+	}
 
-	if e.ResponseType != "code" && e.ResponseType != "" {
+	resp := e.RedirectParams()
+	if e.UsesFragment() {
 		e.RedirectURI.Fragment = resp.Encode()
 	} else {
 		e.RedirectURI.RawQuery = resp.Encode()
@@ -39,8 +62,8 @@ func SendRedirect(c *gin.Context, e *Error) {
 }
 
 func SendJSON(c *gin.Context, e *Error) {
-	if e.Reason == InvalidToken {
-		c.Header("WWW-Authenticate", fmt.Sprintf("Bearer error=\"invalid_token\",error_description=%#v", e.Description))
+	if e.Reason == InvalidToken || e.Reason == InsufficientScope {
+		c.Header("WWW-Authenticate", fmt.Sprintf("Bearer error=%#v,error_description=%#v", string(e.Reason), e.Description))
 	}
 
 	c.JSON(e.StatusCode(), e)
@@ -98,6 +98,16 @@ func TestSendRedirect(t *testing.T) {
 			Query:    testutil.MustParseQuery("error=something_wrong"),
 			Fragment: url.Values{},
 		},
+		{
+			Msg: &errors.Error{
+				RedirectURI:  testutil.MustParseURL("http://localhost:3000/redirect"),
+				ResponseType: "code",
+				Issuer:       "https://auth.example.com",
+				Reason:       "something_wrong",
+			},
+			Query:    testutil.MustParseQuery("error=something_wrong&iss=https://auth.example.com"),
+			Fragment: url.Values{},
+		},
 		{
 			Msg: &errors.Error{
 				RedirectURI:  testutil.MustParseURL("http://localhost:3000/redirect"),
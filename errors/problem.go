@@ -0,0 +1,69 @@
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an error in the format of RFC 7807 problem details, for APIs that are not part of OAuth.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Code and TraceID are extension members, to look up the explanation and the logs.
+	Code    Code   `json:"code"`
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// Problem converts the error to problem details.
+// The type is error_uri if SetDocumentBase is called, or "about:blank".
+func (e *Error) Problem(status int, instance, traceID string) Problem {
+	p := Problem{
+		Type:     e.ErrorURI(),
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Description,
+		Instance: instance,
+		Code:     e.ErrorCode(),
+		TraceID:  traceID,
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if info, ok := LookupCode(p.Code); ok {
+		p.Title = info.Title
+	}
+	return p
+}
+
+// SendProblem responds the error as application/problem+json.
+func SendProblem(c *gin.Context, status int, e *Error, traceID string) {
+	RenderProblem(c, status, e.Problem(status, c.Request.URL.Path, traceID))
+}
+
+// RenderProblem responds v as application/problem+json.
+// v is a Problem or a struct that embeds Problem to add extension members.
+func RenderProblem(c *gin.Context, status int, v interface{}) {
+	c.Render(status, problemRender{v})
+}
+
+type problemRender struct {
+	Problem interface{}
+}
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.Problem)
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ProblemContentType)
+}
@@ -3,7 +3,11 @@ package errors
 var (
 	// OpenID errors
 	AccessDenied            Reason = "access_denied"
+	AuthorizationPending    Reason = "authorization_pending"
+	ConsentRequired         Reason = "consent_required"
+	ExpiredToken            Reason = "expired_token"
 	InteractionRequired     Reason = "interaction_required"
+	InvalidBindingMessage   Reason = "invalid_binding_message"
 	InvalidClient           Reason = "invalid_client"
 	InvalidGrant            Reason = "invalid_grant"
 	InvalidRequest          Reason = "invalid_request"
@@ -11,16 +15,23 @@ var (
 	InvalidRequestURI       Reason = "invalid_request_uri"
 	InvalidScope            Reason = "invalid_scope"
 	InvalidToken            Reason = "invalid_token"
+	InsufficientScope       Reason = "insufficient_scope"
 	LoginRequired           Reason = "login_required"
+	RequestNotSupported     Reason = "request_not_supported"
+	RequestURINotSupported  Reason = "request_uri_not_supported"
 	ServerError             Reason = "server_error"
+	SlowDown                Reason = "slow_down"
 	TemporarilyUnavailable  Reason = "temporarily_unavailable"
 	UnauthorizedClient      Reason = "unauthorized_client"
+	UnknownUserID           Reason = "unknown_user_id"
 	UnsupportedGrantType    Reason = "unsupported_grant_type"
 	UnsupportedResponseType Reason = "unsupported_response_type"
 
 	// original errors
 	MethodNotAllowed Reason = "method_not_allowed"
 	PageNotFound     Reason = "page_not_found"
+	RequestTooLarge  Reason = "request_too_large"
+	URITooLong       Reason = "uri_too_long"
 )
 
 type Reason string
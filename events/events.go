@@ -0,0 +1,197 @@
+// Package events publishes audit and token lifecycle events to message brokers like NATS.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// TypeAudit is the event of each request, with the same fields as the audit log.
+	TypeAudit = "audit"
+
+	// TypeTokenIssued is the event that tokens or a code are issued to a client.
+	TypeTokenIssued = "token.issued"
+
+	// TypeRefreshTokenRevoked is the event that a refresh token is revoked by rotation.
+	TypeRefreshTokenRevoked = "refresh_token.revoked"
+
+	// TypeSSORevoked is the event that an SSO session is revoked by logout.
+	TypeSSORevoked = "sso.revoked"
+)
+
+var (
+	QueueFullError = errors.New("event queue is full")
+	ClosedError    = errors.New("dispatcher is closed")
+)
+
+// Event is a message to publish.
+// ID is unique for each event, so consumers can drop duplicates that caused by redelivery.
+type Event struct {
+	ID     string            `json:"id"`
+	Type   string            `json:"type"`
+	Time   string            `json:"time"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Publisher sends messages to the broker.
+type Publisher interface {
+	// Publish sends the data to the subject.
+	// It returns nil only after the broker acknowledged to store it.
+	Publish(subject, id string, data []byte) error
+}
+
+// Dispatcher queues events and publishes them in the background.
+//
+// Events are retried until the broker acknowledges them, so each event is delivered at least once unless the process stops.
+type Dispatcher struct {
+	sync.Mutex
+
+	// OnError is called when failed to publish or queue an event.
+	OnError func(Event, error)
+
+	publisher Publisher
+	prefix    string
+	queue     chan Event
+	closed    bool
+	stop      chan struct{}
+	done      chan struct{}
+	dropped   int
+
+	// MaxBackoff is the longest interval to retry publishing.
+	MaxBackoff time.Duration
+}
+
+// NewDispatcher makes a Dispatcher and starts publishing.
+// Events are published to the subject of prefix and type like "lauth.token.issued".
+func NewDispatcher(p Publisher, prefix string, queueSize int) *Dispatcher {
+	d := &Dispatcher{
+		publisher:  p,
+		prefix:     prefix,
+		queue:      make(chan Event, queueSize),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		MaxBackoff: 30 * time.Second,
+	}
+	go d.run()
+	return d
+}
+
+func (d *Dispatcher) onError(e Event, err error) {
+	if d.OnError != nil {
+		d.OnError(e, err)
+	}
+}
+
+// Emit queues an event without blocking.
+// The event is dropped and reported to OnError if the queue is full.
+func (d *Dispatcher) Emit(typ string, fields map[string]string) {
+	e := Event{
+		ID:     uuid.New().String(),
+		Type:   typ,
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Fields: fields,
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.closed {
+		d.onError(e, ClosedError)
+		return
+	}
+
+	select {
+	case d.queue <- e:
+	default:
+		d.onError(e, QueueFullError)
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+
+	for e := range d.queue {
+		select {
+		case <-d.stop:
+			d.dropped = 1 + len(d.queue)
+			return
+		default:
+		}
+
+		if !d.publish(e) {
+			d.dropped = 1 + len(d.queue)
+			return
+		}
+	}
+}
+
+// publish sends the event until succeed. It returns false if stopped before succeed.
+func (d *Dispatcher) publish(e Event) bool {
+	data, err := json.Marshal(e)
+	if err != nil {
+		d.onError(e, err)
+		return true
+	}
+
+	backoff := 100 * time.Millisecond
+	for {
+		err := d.publisher.Publish(d.prefix+"."+e.Type, e.ID, data)
+		if err == nil {
+			return true
+		}
+		d.onError(e, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-d.stop:
+			return false
+		}
+
+		backoff *= 2
+		if backoff > d.MaxBackoff {
+			backoff = d.MaxBackoff
+		}
+	}
+}
+
+// Close stops accepting events, and waits until queued events are published or timeout.
+// It returns the number of events that dropped because of timeout.
+// It may wait longer than timeout until the current Publish returns.
+func (d *Dispatcher) Close(timeout time.Duration) int {
+	d.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.Unlock()
+
+	select {
+	case <-d.done:
+	case <-time.After(timeout):
+		close(d.stop)
+		<-d.done
+	}
+	return d.dropped
+}
+
+var (
+	defaultDispatcher *Dispatcher
+)
+
+// SetDefault sets Dispatcher to use by Emit function.
+func SetDefault(d *Dispatcher) {
+	defaultDispatcher = d
+}
+
+// Emit queues an event to the default Dispatcher. It does nothing if the default Dispatcher is not set.
+func Emit(typ string, fields map[string]string) {
+	if defaultDispatcher == nil {
+		return
+	}
+	defaultDispatcher.Emit(typ, fields)
+}
@@ -0,0 +1,124 @@
+package events_test
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/events"
+)
+
+type published struct {
+	Subject string
+	ID      string
+	Event   events.Event
+}
+
+// DummyPublisher fails the first Failures times, and records published messages after that.
+type DummyPublisher struct {
+	sync.Mutex
+
+	Failures  int
+	Block     chan struct{}
+	Published []published
+}
+
+func (p *DummyPublisher) Publish(subject, id string, data []byte) error {
+	if p.Block != nil {
+		<-p.Block
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.Failures > 0 {
+		p.Failures--
+		return errors.New("dummy error")
+	}
+
+	var e events.Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	p.Published = append(p.Published, published{subject, id, e})
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	p := &DummyPublisher{Failures: 2}
+	d := events.NewDispatcher(p, "lauth", 10)
+	d.MaxBackoff = 10 * time.Millisecond
+
+	var errs []error
+	d.OnError = func(e events.Event, err error) {
+		errs = append(errs, err)
+	}
+
+	d.Emit(events.TypeTokenIssued, map[string]string{"client_id": "some_client"})
+	d.Emit(events.TypeSSORevoked, map[string]string{"sso_id": "abc"})
+
+	if n := d.Close(5 * time.Second); n != 0 {
+		t.Errorf("%d events dropped", n)
+	}
+
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors by retry but got %d", len(errs))
+	}
+
+	if len(p.Published) != 2 {
+		t.Fatalf("expected 2 events published but got %d", len(p.Published))
+	}
+	for i, expect := range []string{"lauth.token.issued", "lauth.sso.revoked"} {
+		got := p.Published[i]
+		if got.Subject != expect {
+			t.Errorf("%d: expected subject %s but got %s", i, expect, got.Subject)
+		}
+		if got.ID == "" || got.ID != got.Event.ID {
+			t.Errorf("%d: ID of message and event must be the same: %#v", i, got)
+		}
+	}
+	if p.Published[0].Event.Fields["client_id"] != "some_client" {
+		t.Errorf("unexpected fields: %#v", p.Published[0].Event.Fields)
+	}
+
+	d.Emit(events.TypeAudit, nil)
+	if len(errs) != 3 || errs[2] != events.ClosedError {
+		t.Errorf("expected ClosedError after closed but got %v", errs)
+	}
+}
+
+func TestDispatcher_QueueFull(t *testing.T) {
+	p := &DummyPublisher{Block: make(chan struct{})}
+	d := events.NewDispatcher(p, "lauth", 1)
+
+	var mu sync.Mutex
+	var errs []error
+	d.OnError = func(e events.Event, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	// The first one is taken by the worker, the second one is in the queue, and the third one overflows.
+	d.Emit(events.TypeAudit, nil)
+	time.Sleep(50 * time.Millisecond)
+	d.Emit(events.TypeAudit, nil)
+	d.Emit(events.TypeAudit, nil)
+
+	mu.Lock()
+	if len(errs) != 1 || errs[0] != events.QueueFullError {
+		t.Errorf("expected QueueFullError but got %v", errs)
+	}
+	mu.Unlock()
+
+	// Publish of the first one returns after Close timed out, so only the second one is dropped.
+	time.AfterFunc(100*time.Millisecond, func() { close(p.Block) })
+	if n := d.Close(50 * time.Millisecond); n != 1 {
+		t.Errorf("expected 1 event dropped by timeout but got %d", n)
+	}
+	if len(p.Published) != 1 {
+		t.Errorf("expected 1 event published but got %d", len(p.Published))
+	}
+}
@@ -0,0 +1,152 @@
+package events_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/events"
+)
+
+type natsMessage struct {
+	Subject string
+	Header  string
+	Payload string
+}
+
+// startDummyNATS starts a server that speaks the NATS protocol, and acknowledges messages like JetStream.
+// Messages to the subjects that start with "nostream." are responded as no responders.
+func startDummyNATS(t *testing.T) (addr string, connects <-chan string, messages <-chan natsMessage) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	conns := make(chan string, 10)
+	msgs := make(chan natsMessage, 10)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveDummyNATS(conn, conns, msgs)
+		}
+	}()
+
+	return ln.Addr().String(), conns, msgs
+}
+
+func serveDummyNATS(conn net.Conn, conns chan<- string, msgs chan<- natsMessage) {
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"dummy\",\"headers\":true,\"proto\":1}\r\n")
+
+	r := bufio.NewReader(conn)
+	seq := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			conns <- strings.TrimSpace(line[len("CONNECT"):])
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "HPUB":
+			hlen, _ := strconv.Atoi(fields[3])
+			total, _ := strconv.Atoi(fields[4])
+			buf := make([]byte, total+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			msgs <- natsMessage{Subject: fields[1], Header: string(buf[:hlen]), Payload: string(buf[hlen:total])}
+
+			if strings.HasPrefix(fields[1], "nostream.") {
+				status := "NATS/1.0 503\r\n\r\n"
+				fmt.Fprintf(conn, "HMSG %s 1 %d %d\r\n%s\r\n", fields[2], len(status), len(status), status)
+				continue
+			}
+
+			seq++
+			fmt.Fprintf(conn, "PING\r\n")
+			ack := fmt.Sprintf(`{"stream":"LAUTH","seq":%d}`, seq)
+			fmt.Fprintf(conn, "MSG %s.old 1 %d\r\n%s\r\n", fields[2], len(ack), ack)
+			fmt.Fprintf(conn, "MSG %s 1 %d\r\n%s\r\n", fields[2], len(ack), ack)
+		}
+	}
+}
+
+func TestNATS(t *testing.T) {
+	addr, connects, messages := startDummyNATS(t)
+
+	n, err := events.DialNATS(&url.URL{Scheme: "nats", Host: addr, User: url.UserPassword("lauth", "secret")}, 5*time.Second, "1.2.3")
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer n.Close()
+
+	if c := <-connects; !strings.Contains(c, `"user":"lauth","pass":"secret"`) || !strings.Contains(c, `"headers":true`) {
+		t.Errorf("unexpected CONNECT: %s", c)
+	}
+
+	if err := n.Publish("lauth.audit", "event-id", []byte(`{"hello":"world"}`)); err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+	msg := <-messages
+	if msg.Subject != "lauth.audit" || msg.Payload != `{"hello":"world"}` || !strings.Contains(msg.Header, "Nats-Msg-Id: event-id\r\n") {
+		t.Errorf("unexpected message: %#v", msg)
+	}
+
+	if err := n.Publish("lauth.audit", "event-id-2", []byte(`{}`)); err != nil {
+		t.Fatalf("failed to publish again: %s", err)
+	}
+	<-messages
+
+	if err := n.Publish("nostream.audit", "event-id-3", []byte(`{}`)); err == nil || err.Error() != "no JetStream stream for the subject" {
+		t.Errorf("expected no stream error but got %v", err)
+	}
+	<-messages
+}
+
+func TestNATS_Reconnect(t *testing.T) {
+	addr, connects, messages := startDummyNATS(t)
+
+	n, err := events.DialNATS(&url.URL{Scheme: "nats", Host: addr, User: url.User("token")}, 5*time.Second, "1.2.3")
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer n.Close()
+
+	if c := <-connects; !strings.Contains(c, `"auth_token":"token"`) {
+		t.Errorf("unexpected CONNECT: %s", c)
+	}
+
+	n.Close()
+
+	if err := n.Publish("lauth.audit", "event-id", []byte(`{}`)); err != nil {
+		t.Fatalf("failed to publish after reconnect: %s", err)
+	}
+	<-connects
+	<-messages
+}
+
+func TestDialNATS_UnsupportedScheme(t *testing.T) {
+	if _, err := events.DialNATS(&url.URL{Scheme: "kafka", Host: "localhost"}, time.Second, "1.2.3"); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
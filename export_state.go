@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/revocation"
+	"github.com/macrat/lauth/state"
+	"github.com/spf13/cobra"
+)
+
+type ExportStateConfig struct {
+	ConfigFiles    []string
+	PassphraseFile string
+	Output         string
+}
+
+var (
+	exportStateConfig = ExportStateConfig{}
+	exportStateCmd    = &cobra.Command{
+		Use:   "export-state",
+		Short: "Export clients and revoked SSO sessions as an encrypted archive",
+		Long: "Export clients and revoked SSO sessions as an archive that encrypted with the passphrase, for backup or cloning the environment.\n" +
+			"Options are loaded from the config files and LAUTH_* environment variables, in the same way as the server.\n" +
+			"The sign key is not included. Please copy it separately if tokens that issued before should be valid in the restored environment.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var conf config.Config
+			if err := conf.LoadFiles(exportStateConfig.ConfigFiles, cmd.Root().Flags()); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load config: %s\n", err)
+				os.Exit(1)
+			}
+
+			passphrase, err := readPassphrase(exportStateConfig.PassphraseFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read passphrase: %s\n", err)
+				os.Exit(1)
+			}
+
+			var buf bytes.Buffer
+			if err := ExportState(&buf, &conf, passphrase); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to export state: %s\n", err)
+				os.Exit(1)
+			}
+
+			if exportStateConfig.Output == "" || exportStateConfig.Output == "-" {
+				os.Stdout.Write(buf.Bytes())
+			} else if err := ioutil.WriteFile(exportStateConfig.Output, buf.Bytes(), 0600); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write archive: %s\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	cmd.AddCommand(exportStateCmd)
+
+	flags := exportStateCmd.Flags()
+	flags.SortFlags = false
+
+	flags.StringArrayVarP(&exportStateConfig.ConfigFiles, "config", "c", nil, "Load options from TOML, YAML, or JSON file. Multiple files are merged in order.")
+	flags.StringVar(&exportStateConfig.PassphraseFile, "passphrase-file", "", "File of the passphrase to encrypt the archive.")
+	flags.StringVarP(&exportStateConfig.Output, "output", "o", "", "File to write the archive. Write to stdout if omit.")
+	exportStateCmd.MarkFlagRequired("passphrase-file")
+}
+
+// readPassphrase reads the passphrase from the file, without the trailing newline.
+func readPassphrase(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimRight(b, "\r\n")
+	if len(b) == 0 {
+		return nil, state.EmptyPassphraseError
+	}
+	return b, nil
+}
+
+func ExportState(w io.Writer, conf *config.Config, passphrase []byte) error {
+	now := time.Now()
+
+	s := state.State{
+		CreatedAt: now.Unix(),
+		Clients:   conf.Clients,
+	}
+	if s.Clients == nil {
+		s.Clients = config.ClientConfigSet{}
+	}
+
+	entries := make(map[string]time.Time)
+	if conf.SSO.RevocationFile != "" {
+		var err error
+		entries, err = revocation.ReadFile(conf.SSO.RevocationFile)
+		if err != nil {
+			return err
+		}
+	}
+	s.SetRevocations(entries, now)
+
+	return state.Export(w, s, passphrase)
+}
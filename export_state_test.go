@@ -0,0 +1,85 @@
+package main_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/revocation"
+	"github.com/macrat/lauth/state"
+)
+
+func TestExportImportState(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	conf := &config.Config{
+		Clients: config.ClientConfigSet{
+			"some_client": {
+				Name:   "Some Client",
+				Secret: "$2a$10$hashed",
+			},
+		},
+	}
+	conf.SSO.RevocationFile = filepath.Join(src, "revoked.jsonl")
+	revocation.AppendFile(conf.SSO.RevocationFile, "revoked-session", time.Now().Add(time.Hour))
+	revocation.AppendFile(conf.SSO.RevocationFile, "expired-session", time.Now().Add(-time.Hour))
+
+	var buf bytes.Buffer
+	if err := main.ExportState(&buf, conf, []byte("passphrase")); err != nil {
+		t.Fatalf("failed to export: %s", err)
+	}
+
+	s, err := state.Import(&buf, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+
+	importConf := main.ImportStateConfig{
+		ClientsOutput:  filepath.Join(dst, "clients.json"),
+		RevocationFile: filepath.Join(dst, "revoked.jsonl"),
+	}
+	result, err := main.ImportState(s, importConf)
+	if err != nil {
+		t.Fatalf("failed to import state: %s", err)
+	}
+	if result.Clients != 1 || result.Revocations != 1 {
+		t.Errorf("unexpected result: %#v", result)
+	}
+
+	var restored config.Config
+	if err := restored.Load(importConf.ClientsOutput, nil); err != nil {
+		t.Fatalf("failed to load imported clients: %s", err)
+	}
+	if c, ok := restored.Clients["some_client"]; !ok || c.Name != "Some Client" || c.Secret != "$2a$10$hashed" {
+		t.Errorf("unexpected clients imported: %#v", restored.Clients)
+	}
+
+	list, err := revocation.OpenFile(importConf.RevocationFile)
+	if err != nil {
+		t.Fatalf("failed to open imported revocation file: %s", err)
+	}
+	if !list.IsRevoked("revoked-session") {
+		t.Errorf("revoked-session is not imported")
+	}
+	if list.IsRevoked("expired-session") {
+		t.Errorf("expired-session is imported")
+	}
+
+	importConf.RevocationFile = ""
+	if _, err := main.ImportState(s, importConf); !os.IsExist(err) {
+		t.Errorf("expected error because the clients file already exists but got %v", err)
+	}
+
+	importConf.ClientsOutput = ""
+	importConf.RevocationFile = filepath.Join(dst, "revoked.jsonl")
+	if result, err := main.ImportState(s, importConf); err != nil {
+		t.Errorf("failed to import again: %s", err)
+	} else if result.Revocations != 0 {
+		t.Errorf("already imported revocations are imported again: %#v", result)
+	}
+}
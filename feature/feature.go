@@ -0,0 +1,133 @@
+// Package feature implements the feature flags that can be toggled at runtime for gradual rollouts.
+package feature
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	// Implicit is the implicit and hybrid flow.
+	// Clients also need allow_implicit_flow to use it.
+	Implicit = "implicit"
+
+	// RefreshToken is issuing refresh tokens and the refresh_token grant type.
+	RefreshToken = "refresh_token"
+
+	// RequestObject is the request and request_uri parameters of the authorization request.
+	RequestObject = "request_object"
+
+	// QRCode is the QR code endpoints.
+	QRCode = "qrcode"
+)
+
+var (
+	// Defaults are the known features and whether enabled in default.
+	Defaults = map[string]bool{
+		Implicit:      true,
+		RefreshToken:  true,
+		RequestObject: true,
+		QRCode:        true,
+	}
+)
+
+// UnknownFeatureError is the error that the feature name is not in Defaults.
+type UnknownFeatureError string
+
+func (e UnknownFeatureError) Error() string {
+	return fmt.Sprintf("unknown feature: %s", string(e))
+}
+
+// Names returns sorted names of the known features.
+func Names() []string {
+	names := make([]string, 0, len(Defaults))
+	for name := range Defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flags is the current state of the features.
+//
+// The nil Flags reports the default state of each feature.
+type Flags struct {
+	sync.RWMutex
+	values  map[string]bool
+	version uint64
+}
+
+// New makes Flags that overrides the default state by values.
+func New(values map[string]bool) (*Flags, error) {
+	f := &Flags{
+		values: make(map[string]bool, len(Defaults)),
+	}
+	for name, enabled := range Defaults {
+		f.values[name] = enabled
+	}
+	for name, enabled := range values {
+		if err := f.Set(name, enabled); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Enabled checks if the feature is enabled.
+func (f *Flags) Enabled(name string) bool {
+	if f == nil {
+		return Defaults[name]
+	}
+
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.values[name]
+}
+
+// Set enables or disables the feature.
+func (f *Flags) Set(name string, enabled bool) error {
+	if _, ok := Defaults[name]; !ok {
+		return UnknownFeatureError(name)
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.values[name] = enabled
+	f.version++
+	return nil
+}
+
+// Version returns a number that changes each time Set is called, to know if the state may have changed without comparing all features.
+func (f *Flags) Version() uint64 {
+	if f == nil {
+		return 0
+	}
+
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.version
+}
+
+// All returns a copy of the state of all features.
+func (f *Flags) All() map[string]bool {
+	result := make(map[string]bool, len(Defaults))
+
+	if f == nil {
+		for name, enabled := range Defaults {
+			result[name] = enabled
+		}
+		return result
+	}
+
+	f.RLock()
+	defer f.RUnlock()
+
+	for name, enabled := range f.values {
+		result[name] = enabled
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package feature_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/feature"
+)
+
+func TestFlags(t *testing.T) {
+	f, err := feature.New(map[string]bool{feature.Implicit: false})
+	if err != nil {
+		t.Fatalf("failed to make flags: %s", err)
+	}
+
+	if f.Enabled(feature.Implicit) {
+		t.Errorf("implicit should be disabled by values")
+	}
+	if !f.Enabled(feature.RefreshToken) {
+		t.Errorf("refresh_token should be enabled in default")
+	}
+	if f.Enabled("unknown") {
+		t.Errorf("unknown feature should be disabled")
+	}
+
+	version := f.Version()
+	if err := f.Set(feature.Implicit, true); err != nil {
+		t.Fatalf("failed to set: %s", err)
+	}
+	if !f.Enabled(feature.Implicit) {
+		t.Errorf("implicit should be enabled by Set")
+	}
+	if f.Version() == version {
+		t.Errorf("version should be changed by Set")
+	}
+
+	if err := f.Set("unknown", true); err != feature.UnknownFeatureError("unknown") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	all := f.All()
+	all[feature.QRCode] = false
+	if !f.Enabled(feature.QRCode) {
+		t.Errorf("All should return a copy")
+	}
+
+	if _, err := feature.New(map[string]bool{"unknown": true}); err == nil {
+		t.Errorf("expected error for unknown feature")
+	}
+}
+
+func TestFlags_Nil(t *testing.T) {
+	var f *feature.Flags
+
+	if !f.Enabled(feature.Implicit) {
+		t.Errorf("nil flags should report default state")
+	}
+	if !reflect.DeepEqual(f.All(), feature.Defaults) {
+		t.Errorf("unexpected all flags: %#v", f.All())
+	}
+}
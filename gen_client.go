@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/secret"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +18,8 @@ type GenClientConfig struct {
 	Secret            string
 	URIs              []string
 	AllowImplicitFlow bool
+	RequirePKCE       bool
+	HashAlgorithm     string
 }
 
 var (
@@ -32,6 +35,10 @@ var (
 				genClientConfig.Name = args[0]
 			}
 
+			params := secret.DefaultParams
+			params.Algorithm = genClientConfig.HashAlgorithm
+			secret.SetParams(params)
+
 			client, err := GenClient(genClientConfig)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "failed to hash secret: %s", err)
@@ -53,7 +60,9 @@ func init() {
 	flags.StringVarP(&genClientConfig.IconURL, "icon-url", "i", "", "Icon image URL for displaying on the login page.")
 	flags.StringArrayVarP(&genClientConfig.URIs, "redirect-uri", "u", nil, "URIs to accept redirect to.")
 	flags.StringVar(&genClientConfig.Secret, "secret", "", "Client secret value. Generate random secret if omit. Not recommend use this option.")
+	flags.StringVar(&genClientConfig.HashAlgorithm, "hash", secret.AlgorithmBcrypt, "Algorithm to hash the secret. \"bcrypt\" or \"argon2id\".")
 	flags.BoolVar(&genClientConfig.AllowImplicitFlow, "allow-implicit-flow", false, "Allow implicit and hybrid flow for this client.")
+	flags.BoolVar(&genClientConfig.RequirePKCE, "require-pkce", false, "Require PKCE with S256 method for this client. Recommended for public clients like SPA or mobile apps.")
 }
 
 func quoteString(str string) string {
@@ -61,6 +70,16 @@ func quoteString(str string) string {
 	return string(b)
 }
 
+func hasWildcard(uris []string) bool {
+	for _, u := range uris {
+		var p config.Pattern
+		if p.UnmarshalText([]byte(u)) != nil || !p.IsExact() {
+			return true
+		}
+	}
+	return false
+}
+
 func GenClient(conf GenClientConfig) (string, error) {
 	var sec, hash []byte
 	if conf.Secret != "" {
@@ -100,6 +119,15 @@ func GenClient(conf GenClientConfig) (string, error) {
 	fmt.Fprintf(buf, "# Allow use implicit and hybrid flow for this client.\n")
 	fmt.Fprintf(buf, "allow_implicit_flow = %t\n", conf.AllowImplicitFlow)
 	fmt.Fprintf(buf, "\n")
+	fmt.Fprintf(buf, "# Require PKCE, and accept only these code_challenge_method.\n")
+	if conf.RequirePKCE {
+		fmt.Fprintf(buf, "require_pkce = true\n")
+		fmt.Fprintf(buf, "pkce_methods = [\"S256\"]\n")
+	} else {
+		fmt.Fprintf(buf, "#require_pkce = true\n")
+		fmt.Fprintf(buf, "#pkce_methods = [\"S256\"]\n")
+	}
+	fmt.Fprintf(buf, "\n")
 	fmt.Fprintf(buf, "# The origin to set to Access-Control-Allow-Origin header.\n")
 	fmt.Fprintf(buf, "# Please set this if need access userinfo endpoint by script that runs on browser.\n")
 	fmt.Fprintf(buf, "#cors_origin = [\"https://example.com\"]\n")
@@ -110,6 +138,13 @@ func GenClient(conf GenClientConfig) (string, error) {
 		fmt.Fprintf(buf, "  %s,\n", quoteString(u))
 	}
 	fmt.Fprintf(buf, "]\n")
+	fmt.Fprintf(buf, "\n")
+	fmt.Fprintf(buf, "# How to compare redirect_uri. \"exact\" or \"wildcard\".\n")
+	if hasWildcard(conf.URIs) {
+		fmt.Fprintf(buf, "redirect_uri_match = \"wildcard\"\n")
+	} else {
+		fmt.Fprintf(buf, "redirect_uri_match = \"exact\"\n")
+	}
 
 	return string(buf.Bytes()), nil
 }
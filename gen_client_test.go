@@ -28,6 +28,7 @@ func TestGenClient(t *testing.T) {
 				"http://example.com/callback",
 			},
 			AllowImplicitFlow: true,
+			RequirePKCE:       true,
 		},
 		{
 			ID:      "quote string",
@@ -42,6 +43,12 @@ func TestGenClient(t *testing.T) {
 		},
 	}
 
+	redirectURIMatch := map[string]string{
+		"empty":        config.RedirectURIMatchExact,
+		"all_present":  config.RedirectURIMatchWildcard,
+		"quote string": config.RedirectURIMatchExact,
+	}
+
 	for _, tt := range tests {
 		client, err := main.GenClient(tt)
 		if err != nil {
@@ -69,6 +76,10 @@ func TestGenClient(t *testing.T) {
 				t.Errorf("%s: unexpected name: %s", tt.ID, v.Name)
 			}
 
+			if v.RedirectURIMatch != redirectURIMatch[tt.ID] {
+				t.Errorf("%s: unexpected redirect_uri_match: %s", tt.ID, v.RedirectURIMatch)
+			}
+
 			if v.IconURL != tt.IconURL {
 				t.Errorf("%s: unexpected icon_url: %s", tt.ID, v.IconURL)
 			}
@@ -82,6 +93,10 @@ func TestGenClient(t *testing.T) {
 			if v.AllowImplicitFlow != tt.AllowImplicitFlow {
 				t.Errorf("%s: unexpected allow_implicit_flow: %t", tt.ID, v.AllowImplicitFlow)
 			}
+
+			if v.RequirePKCE != tt.RequirePKCE || (tt.RequirePKCE && !v.AllowsPKCEMethod("S256")) || (tt.RequirePKCE && v.AllowsPKCEMethod("plain")) {
+				t.Errorf("%s: unexpected PKCE config: %t %v", tt.ID, v.RequirePKCE, v.PKCEMethods)
+			}
 		}
 	}
 }
@@ -5,9 +5,8 @@ go 1.16
 require (
 	github.com/NYTimes/gziphandler v1.1.1
 	github.com/coreos/go-oidc/v3 v3.0.0
-	github.com/gin-gonic/autotls v0.0.3
 	github.com/gin-gonic/gin v1.7.2
-	github.com/go-asn1-ber/asn1-ber v1.5.3 // indirect
+	github.com/go-asn1-ber/asn1-ber v1.5.3
 	github.com/go-ldap/ldap/v3 v3.3.0
 	github.com/go-playground/validator/v10 v10.6.1 // indirect
 	github.com/gobwas/glob v0.2.3
@@ -15,6 +14,7 @@ require (
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/mattn/go-isatty v0.0.13 // indirect
 	github.com/mitchellh/mapstructure v1.4.1
+	github.com/open-policy-agent/opa v0.30.2
 	github.com/prometheus/client_golang v1.11.0
 	github.com/prometheus/common v0.29.0 // indirect
 	github.com/rs/zerolog v1.23.0
@@ -23,11 +23,11 @@ require (
 	github.com/spf13/viper v1.8.1
 	github.com/tdewolff/minify/v2 v2.9.18
 	github.com/ugorji/go v1.2.6 // indirect
-	github.com/xhit/go-str2duration/v2 v2.0.0
 	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
 	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
 	golang.org/x/oauth2 v0.0.0-20210514164344-f6687ab2804c
-	golang.org/x/sys v0.0.0-20210616094352-59db8d763f22 // indirect
+	golang.org/x/sys v0.0.0-20210616094352-59db8d763f22
+	golang.org/x/text v0.3.6
 	google.golang.org/protobuf v1.27.0 // indirect
 	gopkg.in/dgrijalva/jwt-go.v3 v3.2.0
 	gopkg.in/square/go-jose.v2 v2.6.0
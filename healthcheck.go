@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	healthcheckConfigFiles []string
+	healthcheckTimeout     time.Duration
+	healthcheckCmd         = &cobra.Command{
+		Use:   "healthcheck",
+		Short: "Check /readyz of the server that running on this host, for HEALTHCHECK of container",
+		Long: "Request /readyz of the server that running on this host, and exit with non-zero status if it is not ready.\n" +
+			"The scheme and port are derived from the config files and LAUTH_* environment variables, in the same way as the server.\n" +
+			"It doesn't verify the TLS certificate, because it connects to the loopback address instead of the Issuer URL.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var conf config.Config
+			if err := conf.LoadFiles(healthcheckConfigFiles, cmd.Root().Flags()); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load config: %s\n", err)
+				os.Exit(1)
+			}
+
+			u := HealthcheckURL(&conf)
+			if err := Healthcheck(HealthcheckClient(&conf, healthcheckTimeout), u); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", u, err)
+				os.Exit(1)
+			}
+			fmt.Printf("OK: %s\n", u)
+		},
+	}
+)
+
+func init() {
+	cmd.AddCommand(healthcheckCmd)
+
+	flags := healthcheckCmd.Flags()
+	flags.StringArrayVarP(&healthcheckConfigFiles, "config", "c", nil, "Load options from TOML, YAML, or JSON file. Multiple files are merged in order.")
+	flags.DurationVar(&healthcheckTimeout, "timeout", 5*time.Second, "Timeout to wait the response.")
+}
+
+// HealthcheckURL returns the URL of /readyz of the server that serves with the config, on the loopback address.
+func HealthcheckURL(conf *config.Config) string {
+	scheme := "http"
+	if conf.TLS.Auto || conf.TLS.Cert != "" {
+		scheme = "https"
+	}
+
+	host := "127.0.0.1"
+	port := 80
+	if listen := config.DecideListenAddress(conf.Issuer, conf.Listen); listen != nil {
+		port = listen.Port
+		if listen.IP != nil && !listen.IP.IsUnspecified() {
+			host = listen.IP.String()
+		}
+	}
+
+	u := url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   "/readyz",
+	}
+	return u.String()
+}
+
+// HealthcheckClient makes a HTTP client to request HealthcheckURL.
+func HealthcheckClient(conf *config.Config, timeout time.Duration) *http.Client {
+	var serverName string
+	if conf.Issuer.String() != "" {
+		serverName = conf.Issuer.Hostname()
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				// The certificate is for the Issuer URL, and the container may not have CA certificates.
+				// It is safe because the connection is to the loopback address of this host.
+				InsecureSkipVerify: true,
+				ServerName:         serverName,
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Healthcheck requests u and returns an error unless the response is 200 OK.
+func Healthcheck(client *http.Client, u string) error {
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("not ready: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth"
+	"github.com/macrat/lauth/config"
+)
+
+func TestHealthcheckURL(t *testing.T) {
+	tests := []struct {
+		Conf   config.Config
+		Expect string
+	}{
+		{
+			config.Config{Issuer: &config.URL{Scheme: "http", Host: "localhost:8000"}},
+			"http://127.0.0.1:8000/readyz",
+		},
+		{
+			config.Config{Issuer: &config.URL{Scheme: "https", Host: "auth.example.com"}},
+			"http://127.0.0.1:443/readyz",
+		},
+		{
+			config.Config{Issuer: &config.URL{Scheme: "https", Host: "auth.example.com"}, TLS: config.TLSConfig{Auto: true}},
+			"https://127.0.0.1:443/readyz",
+		},
+		{
+			config.Config{
+				Issuer: &config.URL{Scheme: "https", Host: "auth.example.com"},
+				Listen: &config.TCPAddr{IP: net.ParseIP("::1"), Port: 8443},
+				TLS:    config.TLSConfig{Cert: "cert.pem", Key: "key.pem"},
+			},
+			"https://[::1]:8443/readyz",
+		},
+		{
+			config.Config{
+				Issuer: &config.URL{Scheme: "https", Host: "auth.example.com"},
+				Listen: &config.TCPAddr{IP: net.IPv4zero, Port: 8000},
+			},
+			"http://127.0.0.1:8000/readyz",
+		},
+	}
+
+	for _, tt := range tests {
+		if u := main.HealthcheckURL(&tt.Conf); u != tt.Expect {
+			t.Errorf("expected %s but got %s", tt.Expect, u)
+		}
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	ready := true
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	conf := &config.Config{Issuer: &config.URL{Scheme: "https", Host: "auth.example.com"}}
+	client := main.HealthcheckClient(conf, time.Second)
+
+	if err := main.Healthcheck(client, srv.URL+"/readyz"); err != nil {
+		t.Errorf("expected ready but got error: %s", err)
+	}
+
+	ready = false
+	if err := main.Healthcheck(client, srv.URL+"/readyz"); err == nil || err.Error() != "not ready: 503 Service Unavailable" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	srv.Close()
+	if err := main.Healthcheck(client, srv.URL+"/readyz"); err == nil {
+		t.Errorf("expected error after the server stopped")
+	}
+}
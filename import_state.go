@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/revocation"
+	"github.com/macrat/lauth/state"
+	"github.com/spf13/cobra"
+)
+
+type ImportStateConfig struct {
+	PassphraseFile string
+	ClientsOutput  string
+	RevocationFile string
+}
+
+type ImportStateResult struct {
+	Clients     int
+	Revocations int
+}
+
+var (
+	importStateConfig = ImportStateConfig{}
+	importStateCmd    = &cobra.Command{
+		Use:   "import-state ARCHIVE",
+		Short: "Import clients and revoked SSO sessions from an archive of export-state",
+		Long: "Import clients and revoked SSO sessions from an archive that made by export-state.\n" +
+			"Clients are written as a config file, to load it with --config in addition to other config files.\n" +
+			"Revoked SSO sessions are appended to the revocation file. Please send SIGHUP to the running server to apply them.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			passphrase, err := readPassphrase(importStateConfig.PassphraseFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read passphrase: %s\n", err)
+				os.Exit(1)
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to open archive: %s\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			s, err := state.Import(f, passphrase)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to import state: %s\n", err)
+				os.Exit(1)
+			}
+
+			result, err := ImportState(s, importStateConfig)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to import state: %s\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("OK: %d clients, %d revoked SSO sessions imported from the archive created at %s\n", result.Clients, result.Revocations, time.Unix(s.CreatedAt, 0).Format(time.RFC3339))
+		},
+	}
+)
+
+func init() {
+	cmd.AddCommand(importStateCmd)
+
+	flags := importStateCmd.Flags()
+	flags.SortFlags = false
+
+	flags.StringVar(&importStateConfig.PassphraseFile, "passphrase-file", "", "File of the passphrase that used to export the archive.")
+	flags.StringVar(&importStateConfig.ClientsOutput, "clients-output", "", "File to write clients as a JSON config file. It must not exist. If omit, clients are not imported.")
+	flags.StringVar(&importStateConfig.RevocationFile, "sso-revocation-file", "", "File of revoked SSO sessions that the server uses. If omit, revocations are not imported.")
+	importStateCmd.MarkFlagRequired("passphrase-file")
+}
+
+// ImportState writes the state to the files.
+// The clients file is never overwritten, to avoid losing clients that registered in the destination.
+func ImportState(s state.State, conf ImportStateConfig) (ImportStateResult, error) {
+	var result ImportStateResult
+
+	if conf.ClientsOutput != "" {
+		f, err := os.OpenFile(conf.ClientsOutput, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return result, err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			Clients config.ClientConfigSet `json:"client"`
+		}{s.Clients})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Clients = len(s.Clients)
+	}
+
+	if conf.RevocationFile != "" {
+		current, err := revocation.ReadFile(conf.RevocationFile)
+		if err != nil {
+			return result, err
+		}
+
+		now := time.Now()
+		for _, r := range s.Revocations {
+			exp := time.Unix(r.ExpiresAt, 0)
+			if !exp.After(now) || !exp.After(current[r.ID]) {
+				continue
+			}
+			if err := revocation.AppendFile(conf.RevocationFile, r.ID, exp); err != nil {
+				return result, err
+			}
+			result.Revocations++
+		}
+	}
+
+	return result, nil
+}
@@ -1,7 +1,6 @@
 package integration_test
 
 import (
-	"encoding/json"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -12,73 +11,38 @@ import (
 
 func TestOIDCImplicitFlow(t *testing.T) {
 	env := testutil.NewAPITestEnvironment(t)
+	rp := env.ImplicitClientRP()
 
-	clientID := "implicit_client_id"
 	nonce := "This Is Nonce"
 
-	resp := env.Get("/authz", "", url.Values{
+	resp := rp.Login(t, url.Values{
 		"response_type": {"token id_token"},
-		"redirect_uri":  {"http://implicit-client.example.com/callback"},
-		"client_id":     {clientID},
 		"nonce":         {nonce},
 		"scope":         {"phone"},
-	})
-	if resp.Code != http.StatusOK {
-		t.Fatalf("unexpected status code: %d", resp.Code)
-	}
-
-	request, err := testutil.FindRequestObjectByHTML(resp.Body)
-	if err != nil {
-		t.Fatalf("failed to get request object: %s", err)
-	}
-
-	resp = env.Post("/authz", "", url.Values{
-		"client_id":     {clientID},
-		"response_type": {"token id_token"},
-		"request":       {request},
-		"username":      {"macrat"},
-		"password":      {"foobar"},
-	})
+	}, "macrat", "foobar")
 	if resp.Code != http.StatusFound {
 		t.Fatalf("unexpected status code: %d", resp.Code)
 	}
-	location, err := url.Parse(resp.Header().Get("Location"))
-	if err != nil {
-		t.Fatalf("failed to parse location: %s", err)
-	}
 
-	fragment, err := url.ParseQuery(location.Fragment)
-	if err != nil {
-		t.Fatalf("failed to parse fragment: %s", err)
-	}
-
-	if fragment.Get("id_token") == "" {
+	if resp.Fragment.Get("id_token") == "" {
 		t.Errorf("failed to get id_token")
-	} else if idToken, err := env.API.TokenManager.ParseIDToken(fragment.Get("id_token")); err != nil {
-		t.Errorf("failed to parse id_token: %s", err)
-	} else if idToken.Nonce != nonce {
-		t.Errorf("nonce of id_token expected %#v but got %#v", nonce, idToken.Nonce)
+	} else {
+		claims := rp.VerifyIDToken(t, resp.Fragment.Get("id_token"), nonce)
+		if claims["sub"] != "macrat" {
+			t.Errorf("unexpected subject of id_token: %#v", claims["sub"])
+		}
 	}
 
-	accessToken := fragment.Get("access_token")
+	accessToken := resp.Fragment.Get("access_token")
 	if accessToken == "" {
 		t.Fatalf("failed to get access_token")
 	}
 
-	resp = env.Get("/userinfo", "Bearer "+accessToken, nil)
-	if resp.Code != http.StatusOK {
-		t.Fatalf("unexpected status code: %d", resp.Code)
-	}
-
-	var userinfo map[string]interface{}
-	if err = json.Unmarshal(resp.Body.Bytes(), &userinfo); err != nil {
-		t.Fatalf("failed to parse body: %s", err)
-	}
-
+	userinfo := rp.UserInfo(t, accessToken)
 	if !reflect.DeepEqual(userinfo, map[string]interface{}{
 		"sub":          "macrat",
 		"phone_number": "000-1234-5678",
 	}) {
-		t.Errorf("unexpected response body: %s", string(resp.Body.Bytes()))
+		t.Errorf("unexpected userinfo: %#v", userinfo)
 	}
 }
@@ -0,0 +1,276 @@
+package ldap_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+)
+
+// StartDummyServer starts an LDAP server that reports the first operation, and rejects any bind with strongerAuthRequired.
+func StartDummyServer(t *testing.T) (*config.URL, <-chan *ber.Packet) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ops := make(chan *ber.Packet, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		ops <- req.Children[1]
+
+		if req.Children[1].Tag != goldap.ApplicationBindRequest {
+			return
+		}
+
+		resp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, req.Children[0].Value, "MessageID"))
+		bind := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationBindResponse, nil, "Bind Response")
+		bind.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(goldap.LDAPResultStrongAuthRequired), "resultCode"))
+		bind.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+		bind.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "The server requires binds to turn on integrity checking if SSL\\TLS are not already active on the connection", "diagnosticMessage"))
+		resp.AppendChild(bind)
+		conn.Write(resp.Bytes())
+	}()
+
+	return &config.URL{Scheme: "ldap", Host: l.Addr().String()}, ops
+}
+
+func TestSimpleConnector_StartTLSBeforeBind(t *testing.T) {
+	server, ops := StartDummyServer(t)
+
+	c := ldap.SimpleConnector{
+		Config: &config.LDAPConfig{Server: server, User: "CN=lauth,DC=example,DC=com", Password: "secret"},
+	}
+	if _, err := c.Connect(); err == nil {
+		t.Fatalf("expected error because the dummy server doesn't support StartTLS")
+	}
+
+	if op := <-ops; op.Tag != goldap.ApplicationExtendedRequest {
+		t.Errorf("expected StartTLS as the first operation but got %d", op.Tag)
+	}
+}
+
+func TestSimpleConnector_StrongAuthRequired(t *testing.T) {
+	server, ops := StartDummyServer(t)
+
+	c := ldap.SimpleConnector{
+		Config: &config.LDAPConfig{Server: server, User: "CN=lauth,DC=example,DC=com", Password: "secret", DisableTLS: true},
+	}
+	_, err := c.Connect()
+
+	if op := <-ops; op.Tag != goldap.ApplicationBindRequest {
+		t.Errorf("expected bind as the first operation but got %d", op.Tag)
+	}
+
+	var e ldap.StrongAuthRequiredError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected StrongAuthRequiredError but got %#v", err)
+	}
+	if !goldap.IsErrorWithCode(e.Err, goldap.LDAPResultStrongAuthRequired) {
+		t.Errorf("original error should be kept: %s", err)
+	}
+}
+
+func TestSimpleConnector_ExternalBind(t *testing.T) {
+	server, ops := StartDummyServer(t)
+
+	c := ldap.SimpleConnector{
+		Config: &config.LDAPConfig{Server: server, Bind: config.LDAPBindExternal, DisableTLS: true},
+	}
+	if _, err := c.Connect(); err == nil {
+		t.Fatalf("expected error because the dummy server rejects any bind")
+	}
+
+	op := <-ops
+	if op.Tag != goldap.ApplicationBindRequest || len(op.Children) < 3 {
+		t.Fatalf("expected bind as the first operation but got %d", op.Tag)
+	}
+	auth := op.Children[2]
+	if auth.Tag != 3 || len(auth.Children) == 0 || auth.Children[0].Data.String() != "EXTERNAL" {
+		t.Errorf("expected SASL EXTERNAL bind but got %#v", auth)
+	}
+}
+
+func TestSimpleConnector_InvalidClientCertificate(t *testing.T) {
+	c := ldap.SimpleConnector{
+		Config: &config.LDAPConfig{
+			Server:     &config.URL{Scheme: "ldap", Host: "localhost"},
+			Bind:       config.LDAPBindExternal,
+			ClientCert: "/path/to/not-exists.crt",
+			ClientKey:  "/path/to/not-exists.key",
+		},
+	}
+	if _, err := c.Connect(); err == nil || !strings.Contains(err.Error(), "client certificate") {
+		t.Errorf("expected error about client certificate but got %v", err)
+	}
+}
+
+// StartTLSServer starts an LDAP server that accepts StartTLS with a self-signed certificate for the hosts, and reports the first operation after TLS.
+// It returns the URL of the server and the path to the certificate.
+func StartTLSServer(t *testing.T, hosts ...string) (*config.URL, string, <-chan *ber.Packet) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "lauth test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write certificate: %s", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ops := make(chan *ber.Packet, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 || req.Children[1].Tag != goldap.ApplicationExtendedRequest {
+			return
+		}
+
+		resp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, req.Children[0].Value, "MessageID"))
+		ext := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationExtendedResponse, nil, "Extended Response")
+		ext.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(goldap.LDAPResultSuccess), "resultCode"))
+		ext.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+		ext.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+		resp.AppendChild(ext)
+		if _, err := conn.Write(resp.Bytes()); err != nil {
+			return
+		}
+
+		tlsConn := tls.Server(conn, &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+
+		req, err = ber.ReadPacket(tlsConn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		ops <- req.Children[1]
+	}()
+
+	return &config.URL{Scheme: "ldap", Host: l.Addr().String()}, ca, ops
+}
+
+func TestSimpleConnector_VerifyServer(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Hosts   []string
+		UseCA   bool
+		Success bool
+	}{
+		{"trusted", []string{"127.0.0.1"}, true, true},
+		{"unknown-ca", []string{"127.0.0.1"}, false, false},
+		{"wrong-host", []string{"ldap.example.com"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			server, ca, ops := StartTLSServer(t, tt.Hosts...)
+
+			conf := &config.LDAPConfig{Server: server, User: "CN=lauth,DC=example,DC=com", Password: "secret"}
+			if tt.UseCA {
+				conf.CA = ca
+			}
+			_, err := ldap.SimpleConnector{Config: conf}.Connect()
+			if err == nil {
+				t.Fatalf("expected error because the dummy server doesn't respond to bind")
+			}
+
+			if tt.Success {
+				select {
+				case op := <-ops:
+					if op.Tag != goldap.ApplicationBindRequest {
+						t.Errorf("expected bind after StartTLS but got %d", op.Tag)
+					}
+				case <-time.After(time.Second):
+					t.Errorf("bind was not sent after StartTLS: %s", err)
+				}
+			} else if !strings.Contains(err.Error(), "certificate") {
+				t.Errorf("expected certificate error but got %s", err)
+			}
+		})
+	}
+}
+
+func TestSimpleConnector_InvalidCA(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(ca, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	c := ldap.SimpleConnector{
+		Config: &config.LDAPConfig{
+			Server: &config.URL{Scheme: "ldap", Host: "localhost"},
+			CA:     ca,
+		},
+	}
+	if _, err := c.Connect(); err == nil || !strings.Contains(err.Error(), "CA certificate") {
+		t.Errorf("expected error about CA certificate but got %v", err)
+	}
+}
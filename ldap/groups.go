@@ -0,0 +1,124 @@
+package ldap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/macrat/lauth/config"
+)
+
+const (
+	// tokenGroupsAttribute is the constructed attribute of ActiveDirectory that has SIDs of all groups of the user,
+	// including the primary group and nested groups.
+	tokenGroupsAttribute = "tokenGroups"
+
+	memberOfAttribute = "memberOf"
+)
+
+func hasAttribute(attributes []string, name string) bool {
+	for _, a := range attributes {
+		if strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeBinary escapes a binary value like SID for search filters (RFC 4515 section 3).
+func escapeBinary(b []byte) string {
+	var s strings.Builder
+	for _, x := range b {
+		fmt.Fprintf(&s, `\%02x`, x)
+	}
+	return s.String()
+}
+
+// primaryGroupSID makes the SID of the primary group from the SID of the user and primaryGroupID.
+// They are in the same domain, so only the last sub-authority (RID) differs.
+func primaryGroupSID(userSID []byte, rid uint32) ([]byte, error) {
+	if _, err := parseSID(userSID); err != nil {
+		return nil, err
+	}
+	sid := make([]byte, len(userSID))
+	copy(sid, userSID)
+	binary.LittleEndian.PutUint32(sid[len(sid)-4:], rid)
+	return sid, nil
+}
+
+// groupDNs searches DNs of the groups of SIDs in the domain of the user.
+func (c *SimpleSession) groupDNs(userDN string, sids [][]byte) ([]string, error) {
+	if len(sids) == 0 {
+		return []string{}, nil
+	}
+
+	base, err := config.GetDCByDN(userDN)
+	if err != nil || base == "" {
+		base = c.BaseDN
+	}
+
+	var filter strings.Builder
+	filter.WriteString("(|")
+	for _, sid := range sids {
+		fmt.Fprintf(&filter, "(objectSid=%s)", escapeBinary(sid))
+	}
+	filter.WriteString(")")
+
+	res, err := c.conn.Search(ldap.NewSearchRequest(
+		base,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, // size limit
+		0, // time limit
+		false,
+		filter.String(),
+		[]string{noAttributes},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	dns := make([]string, len(res.Entries))
+	for i, entry := range res.Entries {
+		dns[i] = entry.DN
+	}
+	return dns, nil
+}
+
+// tokenGroups reads tokenGroups of the user, and converts them to DNs.
+// tokenGroups can read only with the base scope, so it needs another search after found the user.
+func (c *SimpleSession) tokenGroups(userDN string) ([]string, error) {
+	entry, err := c.readEntry(userDN, []string{tokenGroupsAttribute})
+	if err != nil {
+		return nil, err
+	}
+	return c.groupDNs(userDN, entry.GetRawAttributeValues(tokenGroupsAttribute))
+}
+
+// primaryGroup finds the DN of the primary group like "Domain Users", that is not included in memberOf.
+// It returns an empty string if the user has no primary group, like in directories other than ActiveDirectory.
+func (c *SimpleSession) primaryGroup(user *ldap.Entry) (string, error) {
+	sid := user.GetRawAttributeValue("objectSid")
+	rid := user.GetAttributeValue("primaryGroupID")
+	if len(sid) == 0 || rid == "" {
+		return "", nil
+	}
+
+	var n uint32
+	if _, err := fmt.Sscan(rid, &n); err != nil {
+		return "", fmt.Errorf("invalid primaryGroupID: %#v", rid)
+	}
+
+	groupSID, err := primaryGroupSID(sid, n)
+	if err != nil {
+		return "", err
+	}
+
+	dns, err := c.groupDNs(user.DN, [][]byte{groupSID})
+	if err != nil || len(dns) == 0 {
+		return "", err
+	}
+	return dns[0], nil
+}
@@ -0,0 +1,40 @@
+package ldap
+
+import (
+	"testing"
+)
+
+func TestEscapeBinary(t *testing.T) {
+	if s := escapeBinary([]byte{1, 5, 0, 0x2a, 0xff}); s != `\01\05\00\2a\ff` {
+		t.Errorf("unexpected escaped value: %s", s)
+	}
+}
+
+func TestPrimaryGroupSID(t *testing.T) {
+	user := []byte{1, 5, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 0x51, 4, 0, 0}
+
+	sid, err := primaryGroupSID(user, 513)
+	if err != nil {
+		t.Fatalf("failed to make SID: %s", err)
+	}
+	if s, _ := parseSID(sid); s != "S-1-5-21-1-2-3-513" {
+		t.Errorf("unexpected primary group SID: %s", s)
+	}
+	if s, _ := parseSID(user); s != "S-1-5-21-1-2-3-1105" {
+		t.Errorf("user SID should not be modified: %s", s)
+	}
+
+	if _, err := primaryGroupSID([]byte{1, 5, 0}, 513); err == nil {
+		t.Errorf("expected error for invalid SID")
+	}
+}
+
+func TestHasAttribute(t *testing.T) {
+	attrs := []string{"mail", "memberOf"}
+	if !hasAttribute(attrs, "memberof") {
+		t.Errorf("attribute names should be compared without case")
+	}
+	if hasAttribute(attrs, "tokenGroups") {
+		t.Errorf("unexpected attribute found")
+	}
+}
@@ -2,8 +2,13 @@ package ldap
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/go-ldap/ldap/v3"
 	"github.com/macrat/lauth/config"
@@ -12,8 +17,24 @@ import (
 var (
 	UserNotFoundError       = fmt.Errorf("user was not found")
 	MultipleUsersFoundError = fmt.Errorf("multiple users was found")
+	UserAlreadyExistsError  = fmt.Errorf("user already exists")
 )
 
+// StrongAuthRequiredError is returned if the LDAP server refused bind without encryption.
+// ActiveDirectory does it if LDAP signing or channel binding is enforced.
+// Simple bind over TLS satisfies these requirements.
+type StrongAuthRequiredError struct {
+	Err error
+}
+
+func (e StrongAuthRequiredError) Error() string {
+	return fmt.Sprintf("%s: the LDAP server requires signing or channel binding. Please use ldaps:// or StartTLS, instead of --ldap-disable-tls.", e.Err)
+}
+
+func (e StrongAuthRequiredError) Unwrap() error {
+	return e.Err
+}
+
 type Connector interface {
 	Connect() (Session, error)
 }
@@ -23,36 +44,147 @@ type Session interface {
 
 	LoginTest(username, password string) error
 	GetUserAttributes(username string, attributes []string) (map[string][]string, error)
+
+	// Ping checks the connection and the base DN with a no-op search.
+	Ping() error
+}
+
+// Registrar is a Session that can create new users.
+type Registrar interface {
+	// CreateUser adds a new user entry under the baseDN, and sets the password.
+	CreateUser(baseDN, username, password string, attributes map[string][]string) error
+
+	// AddGroupMember adds the user into the group by adding the user's DN to the attribute of the group.
+	AddGroupMember(groupDN, attribute, username string) error
+
+	// ActivateUser sets the password of the pre-created user, and enables the account if it is disabled.
+	ActivateUser(username, password string) error
 }
 
 type SimpleConnector struct {
 	Config *config.LDAPConfig
+
+	// Resolver gives addresses of the servers instead of the host in Config.Server, if not nil.
+	Resolver *SRVResolver
+}
+
+// clientCertificates loads the client certificate for TLS, if configured.
+// It is loaded on every connection, so a renewed certificate is used without restart.
+func (c SimpleConnector) clientCertificates() ([]tls.Certificate, error) {
+	if c.Config.ClientCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.Config.ClientCert, c.Config.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// rootCAs loads the CA certificates to verify the server, if configured.
+// It returns nil to use the system's CAs if not configured.
+func (c SimpleConnector) rootCAs() (*x509.CertPool, error) {
+	if c.Config.CA == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(c.Config.CA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("failed to load CA certificate: no certificate found in %s", c.Config.CA)
+	}
+	return pool, nil
+}
+
+// tlsConfig makes the TLS config that verifies the server certificate by the CA, and sends the client certificate.
+func (c SimpleConnector) tlsConfig() (*tls.Config, error) {
+	certs, err := c.clientCertificates()
+	if err != nil {
+		return nil, err
+	}
+	roots, err := c.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{RootCAs: roots, Certificates: certs}, nil
+}
+
+// dial connects to the server in the config, or to the first available server that found by Resolver.
+//
+// It returns the TLS config that ServerName is set to the connected host too, to verify the server in StartTLS.
+func (c SimpleConnector) dial(base *tls.Config) (*ldap.Conn, *tls.Config, error) {
+	if base == nil {
+		base = &tls.Config{}
+	}
+	dial := func(u url.URL) (*ldap.Conn, *tls.Config, error) {
+		tc := base.Clone()
+		tc.ServerName = u.Hostname()
+		conn, err := ldap.DialURL(u.String(), ldap.DialWithTLSConfig(tc))
+		return conn, tc, err
+	}
+
+	if c.Resolver == nil {
+		return dial(*c.Config.Server.URL())
+	}
+
+	err := fmt.Errorf("no LDAP server found for %s", c.Resolver.Domain)
+	for _, addr := range c.Resolver.Addresses() {
+		u := *c.Config.Server.URL()
+		u.Host = addr
+
+		var conn *ldap.Conn
+		var tc *tls.Config
+		conn, tc, err = dial(u)
+		if err == nil {
+			return conn, tc, nil
+		}
+	}
+	return nil, nil, err
 }
 
 func (c SimpleConnector) Connect() (Session, error) {
-	conn, err := ldap.DialURL(c.Config.Server.String())
+	base, err := c.tlsConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	err = conn.Bind(c.Config.User, c.Config.Password)
+	conn, tc, err := c.dial(base)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
 
-	if c.Config.Server.Scheme != "ldaps" && !c.Config.DisableTLS {
-		err = conn.StartTLS(&tls.Config{InsecureSkipVerify: true})
+	// StartTLS must be done before bind, otherwise the password is sent in plain text.
+	// ActiveDirectory that requires LDAP signing rejects such simple bind.
+	// ldapi:// is a local socket, so it doesn't need TLS.
+	if c.Config.Server.Scheme == "ldap" && !c.Config.DisableTLS {
+		err = conn.StartTLS(tc)
 		if err != nil {
 			conn.Close()
 			return nil, err
 		}
 	}
 
+	if c.Config.Bind == config.LDAPBindExternal {
+		// SASL EXTERNAL uses the identity of the client certificate, or of the process on ldapi://.
+		err = conn.ExternalBind()
+	} else {
+		err = conn.Bind(c.Config.User, c.Config.Password)
+	}
+	if err != nil {
+		conn.Close()
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultStrongAuthRequired) {
+			return nil, StrongAuthRequiredError{err}
+		}
+		return nil, err
+	}
+
 	return &SimpleSession{
-		conn:        conn,
-		IDAttribute: c.Config.IDAttribute,
-		BaseDN:      c.Config.BaseDN,
+		conn:         conn,
+		IDAttribute:  c.Config.IDAttribute,
+		BaseDN:       c.Config.BaseDN,
+		PrimaryGroup: c.Config.PrimaryGroup,
 	}, nil
 }
 
@@ -60,6 +192,9 @@ type SimpleSession struct {
 	conn        *ldap.Conn
 	IDAttribute string
 	BaseDN      string
+
+	// PrimaryGroup includes the primary group into memberOf, for ActiveDirectory.
+	PrimaryGroup bool
 }
 
 func (c *SimpleSession) Close() error {
@@ -67,7 +202,15 @@ func (c *SimpleSession) Close() error {
 	return nil
 }
 
+// noAttributes is the special attribute name to request no attributes (RFC 4511 section 4.5.1.8).
+// It is used instead of an empty list, because an empty list means all attributes.
+const noAttributes = "1.1"
+
 func (c *SimpleSession) searchUser(username string, attributes []string) (*ldap.Entry, error) {
+	if len(attributes) == 0 {
+		attributes = []string{noAttributes}
+	}
+
 	req := ldap.NewSearchRequest(
 		c.BaseDN,
 		ldap.ScopeWholeSubtree,
@@ -95,8 +238,25 @@ func (c *SimpleSession) searchUser(username string, attributes []string) (*ldap.
 	return res.Entries[0], nil
 }
 
+func (c *SimpleSession) Ping() error {
+	req := ldap.NewSearchRequest(
+		c.BaseDN,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1, // size limit
+		0, // time limit
+		false,
+		"(objectClass=*)",
+		[]string{noAttributes},
+		nil,
+	)
+
+	_, err := c.conn.Search(req)
+	return err
+}
+
 func (c *SimpleSession) LoginTest(username, password string) error {
-	user, err := c.searchUser(username, []string{"dn"})
+	user, err := c.searchUser(username, nil)
 	if err != nil {
 		return err
 	}
@@ -105,7 +265,19 @@ func (c *SimpleSession) LoginTest(username, password string) error {
 }
 
 func (c *SimpleSession) GetUserAttributes(username string, attributes []string) (map[string][]string, error) {
-	user, err := c.searchUser(username, attributes)
+	withPrimary := c.PrimaryGroup && hasAttribute(attributes, memberOfAttribute)
+
+	query := make([]string, 0, len(attributes)+2)
+	for _, attr := range attributes {
+		if !strings.EqualFold(attr, tokenGroupsAttribute) {
+			query = append(query, attr)
+		}
+	}
+	if withPrimary {
+		query = append(query, "objectSid", "primaryGroupID")
+	}
+
+	user, err := c.searchUser(username, query)
 	if err != nil {
 		return nil, err
 	}
@@ -113,8 +285,105 @@ func (c *SimpleSession) GetUserAttributes(username string, attributes []string)
 	result := make(map[string][]string)
 
 	for _, attr := range attributes {
-		result[attr] = user.GetAttributeValues(attr)
+		switch {
+		case strings.EqualFold(attr, tokenGroupsAttribute):
+			groups, err := c.tokenGroups(user.DN)
+			if err != nil {
+				return nil, err
+			}
+			result[attr] = groups
+		case withPrimary && strings.EqualFold(attr, memberOfAttribute):
+			groups := user.GetAttributeValues(attr)
+			primary, err := c.primaryGroup(user)
+			if err != nil {
+				return nil, err
+			}
+			if primary != "" {
+				groups = append(groups, primary)
+			}
+			result[attr] = groups
+		default:
+			result[attr] = user.GetAttributeValues(attr)
+		}
 	}
 
 	return result, nil
 }
+
+func (c *SimpleSession) CreateUser(baseDN, username, password string, attributes map[string][]string) error {
+	if _, err := c.searchUser(username, nil); err == nil {
+		return UserAlreadyExistsError
+	} else if err != UserNotFoundError {
+		return err
+	}
+
+	dn := fmt.Sprintf("%s=%s,%s", c.IDAttribute, escapeDN(username), baseDN)
+
+	req := ldap.NewAddRequest(dn, nil)
+	req.Attribute(c.IDAttribute, []string{username})
+	for name, values := range attributes {
+		if len(values) > 0 {
+			req.Attribute(name, values)
+		}
+	}
+
+	if err := c.conn.Add(req); err != nil {
+		return err
+	}
+
+	_, err := c.conn.PasswordModify(ldap.NewPasswordModifyRequest(dn, "", password))
+	return err
+}
+
+func (c *SimpleSession) AddGroupMember(groupDN, attribute, username string) error {
+	user, err := c.searchUser(username, nil)
+	if err != nil {
+		return err
+	}
+
+	req := ldap.NewModifyRequest(groupDN, nil)
+	req.Add(attribute, []string{user.DN})
+	return c.conn.Modify(req)
+}
+
+// ACCOUNTDISABLE flag of userAccountControl in ActiveDirectory.
+const uacAccountDisable = 0x2
+
+func (c *SimpleSession) ActivateUser(username, password string) error {
+	user, err := c.searchUser(username, []string{"userAccountControl"})
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.conn.PasswordModify(ldap.NewPasswordModifyRequest(user.DN, "", password)); err != nil {
+		return err
+	}
+
+	if raw := user.GetAttributeValue("userAccountControl"); raw != "" {
+		uac, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		if uac&uacAccountDisable != 0 {
+			req := ldap.NewModifyRequest(user.DN, nil)
+			req.Replace("userAccountControl", []string{strconv.Itoa(uac &^ uacAccountDisable)})
+			return c.conn.Modify(req)
+		}
+	}
+
+	return nil
+}
+
+func escapeDN(value string) string {
+	var buf strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(value)-1 && r == ' ':
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
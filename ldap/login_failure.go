@@ -0,0 +1,62 @@
+package ldap
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LoginFailure is the reason why LoginTest failed.
+// It is for audit logs and trusted networks. Please don't show it to the users in default, because it tells whether the user exists.
+type LoginFailure string
+
+const (
+	LoginFailureUserNotFound    LoginFailure = "user_not_found"
+	LoginFailureMultipleUsers   LoginFailure = "multiple_users"
+	LoginFailureWrongPassword   LoginFailure = "wrong_password"
+	LoginFailureAccountDisabled LoginFailure = "account_disabled"
+	LoginFailureAccountLocked   LoginFailure = "account_locked"
+	LoginFailurePasswordExpired LoginFailure = "password_expired"
+	LoginFailureUnknown         LoginFailure = "unknown"
+
+	// LoginFailureTooManyAttempts is not detected by LDAP server, but by lauth itself, before asking to LDAP server.
+	LoginFailureTooManyAttempts LoginFailure = "too_many_attempts"
+)
+
+// adBindErrors is the sub-error codes in the diagnostic message of ActiveDirectory, like "AcceptSecurityContext error, data 52e, v4563".
+var adBindErrors = map[string]LoginFailure{
+	"525": LoginFailureUserNotFound,
+	"52e": LoginFailureWrongPassword,
+	"530": LoginFailureAccountDisabled,
+	"531": LoginFailureAccountDisabled,
+	"532": LoginFailurePasswordExpired,
+	"533": LoginFailureAccountDisabled,
+	"701": LoginFailureAccountDisabled,
+	"773": LoginFailurePasswordExpired,
+	"775": LoginFailureAccountLocked,
+}
+
+// ClassifyLoginError detects the reason of the error that returned from Session.LoginTest.
+func ClassifyLoginError(err error) LoginFailure {
+	switch {
+	case err == nil:
+		return ""
+	case err == UserNotFoundError:
+		return LoginFailureUserNotFound
+	case err == MultipleUsersFoundError:
+		return LoginFailureMultipleUsers
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials):
+		msg := strings.ToLower(err.Error())
+		if i := strings.Index(msg, "data "); i >= 0 && len(msg) >= i+8 {
+			if f, ok := adBindErrors[msg[i+5:i+8]]; ok {
+				return f
+			}
+		}
+		return LoginFailureWrongPassword
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform):
+		// OpenLDAP and 389 Directory Server respond this for disabled or locked accounts.
+		return LoginFailureAccountDisabled
+	default:
+		return LoginFailureUnknown
+	}
+}
@@ -0,0 +1,37 @@
+package ldap_test
+
+import (
+	"fmt"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/macrat/lauth/ldap"
+)
+
+func TestClassifyLoginError(t *testing.T) {
+	adError := func(data string) error {
+		return goldap.NewError(goldap.LDAPResultInvalidCredentials, fmt.Errorf("80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data %s, v3839", data))
+	}
+
+	tests := []struct {
+		Err    error
+		Expect ldap.LoginFailure
+	}{
+		{nil, ""},
+		{ldap.UserNotFoundError, ldap.LoginFailureUserNotFound},
+		{ldap.MultipleUsersFoundError, ldap.LoginFailureMultipleUsers},
+		{goldap.NewError(goldap.LDAPResultInvalidCredentials, fmt.Errorf("invalid credentials")), ldap.LoginFailureWrongPassword},
+		{adError("52e"), ldap.LoginFailureWrongPassword},
+		{adError("533"), ldap.LoginFailureAccountDisabled},
+		{adError("775"), ldap.LoginFailureAccountLocked},
+		{adError("532"), ldap.LoginFailurePasswordExpired},
+		{goldap.NewError(goldap.LDAPResultUnwillingToPerform, fmt.Errorf("account locked")), ldap.LoginFailureAccountDisabled},
+		{fmt.Errorf("something wrong"), ldap.LoginFailureUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := ldap.ClassifyLoginError(tt.Err); got != tt.Expect {
+			t.Errorf("%v: expected %#v but got %#v", tt.Err, tt.Expect, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// MemoryUser is a user entry of MemoryDirectory.
+type MemoryUser struct {
+	Password   string
+	Attributes map[string][]string
+}
+
+// MemoryDirectory is a read-only user store on memory, for trying Lauth without an LDAP server.
+// The key is the username.
+type MemoryDirectory map[string]MemoryUser
+
+func (d MemoryDirectory) Connect() (Session, error) {
+	return d, nil
+}
+
+func (d MemoryDirectory) Close() error {
+	return nil
+}
+
+func (d MemoryDirectory) Ping() error {
+	return nil
+}
+
+// LoginTest checks the password in the same way as LDAP servers respond, so failed logins are classified as usual.
+func (d MemoryDirectory) LoginTest(username, password string) error {
+	user, ok := d[username]
+	if !ok {
+		return UserNotFoundError
+	}
+	if user.Password != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, fmt.Errorf("incorrect password"))
+	}
+	return nil
+}
+
+// GetUserAttributes returns the attributes of the user. Attribute names are case-insensitive like LDAP.
+func (d MemoryDirectory) GetUserAttributes(username string, attributes []string) (map[string][]string, error) {
+	user, ok := d[username]
+	if !ok {
+		return nil, UserNotFoundError
+	}
+
+	result := make(map[string][]string)
+	for _, attr := range attributes {
+		for name, values := range user.Attributes {
+			if strings.EqualFold(name, attr) {
+				result[attr] = values
+				break
+			}
+		}
+	}
+	return result, nil
+}
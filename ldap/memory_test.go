@@ -0,0 +1,52 @@
+package ldap_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/ldap"
+)
+
+func TestMemoryDirectory(t *testing.T) {
+	d := ldap.MemoryDirectory{
+		"alice": {
+			Password: "alice-password",
+			Attributes: map[string][]string{
+				"displayName": {"Alice"},
+				"memberOf":    {"CN=admins,OU=groups,DC=example,DC=com"},
+			},
+		},
+	}
+
+	conn, err := d.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.LoginTest("alice", "alice-password"); err != nil {
+		t.Errorf("failed to login: %s", err)
+	}
+	if f := ldap.ClassifyLoginError(conn.LoginTest("alice", "wrong")); f != ldap.LoginFailureWrongPassword {
+		t.Errorf("unexpected failure of wrong password: %s", f)
+	}
+	if f := ldap.ClassifyLoginError(conn.LoginTest("bob", "alice-password")); f != ldap.LoginFailureUserNotFound {
+		t.Errorf("unexpected failure of unknown user: %s", f)
+	}
+
+	attrs, err := conn.GetUserAttributes("alice", []string{"displayname", "memberOf", "mail"})
+	if err != nil {
+		t.Fatalf("failed to get attributes: %s", err)
+	}
+	expect := map[string][]string{
+		"displayname": {"Alice"},
+		"memberOf":    {"CN=admins,OU=groups,DC=example,DC=com"},
+	}
+	if !reflect.DeepEqual(attrs, expect) {
+		t.Errorf("unexpected attributes: %#v", attrs)
+	}
+
+	if _, err := conn.GetUserAttributes("bob", []string{"mail"}); err != ldap.UserNotFoundError {
+		t.Errorf("expected user not found but got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package ldap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// PrivilegeProber is a Session that can inspect privileges of the bind account.
+type PrivilegeProber interface {
+	// BindPrivileges returns privileges of the bind account that are more than reading users.
+	BindPrivileges() (Privileges, error)
+}
+
+// Privileges is privileges of the bind account that found by PrivilegeProber.
+type Privileges struct {
+	// Account is the DN of the bind account.
+	Account string
+
+	// AdminGroups is names of administrative groups that the account belongs to, like "Domain Admins".
+	AdminGroups []string
+
+	// Writable is DNs of entries that the account can modify, or can create children under.
+	Writable []string
+}
+
+// adminRIDs is well-known relative IDs of administrative groups in ActiveDirectory domains.
+var adminRIDs = map[uint32]string{
+	512: "Domain Admins",
+	518: "Schema Admins",
+	519: "Enterprise Admins",
+}
+
+// builtinAdminSIDs is well-known SIDs of administrative groups that built in to ActiveDirectory.
+var builtinAdminSIDs = map[string]string{
+	"S-1-5-32-544": "Administrators",
+	"S-1-5-32-548": "Account Operators",
+}
+
+// parseSID converts binary SID like a value of tokenGroups to the string form like "S-1-5-32-544".
+func parseSID(b []byte) (string, error) {
+	if len(b) < 8 || len(b) != 8+4*int(b[1]) {
+		return "", fmt.Errorf("invalid SID length: %d", len(b))
+	}
+
+	var authority uint64
+	for _, x := range b[2:8] {
+		authority = authority<<8 | uint64(x)
+	}
+
+	s := fmt.Sprintf("S-%d-%d", b[0], authority)
+	for i := 8; i < len(b); i += 4 {
+		s += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(b[i:i+4]))
+	}
+	return s, nil
+}
+
+// adminGroupName returns the name of the administrative group if the SID is one of them.
+func adminGroupName(sid []byte) (string, bool) {
+	s, err := parseSID(sid)
+	if err != nil {
+		return "", false
+	}
+	if name, ok := builtinAdminSIDs[s]; ok {
+		return name, true
+	}
+
+	// Domain groups are S-1-5-21-<domain>-<domain>-<domain>-<RID>.
+	if strings.HasPrefix(s, "S-1-5-21-") && len(sid) == 8+4*5 {
+		name, ok := adminRIDs[binary.LittleEndian.Uint32(sid[len(sid)-4:])]
+		return name, ok
+	}
+	return "", false
+}
+
+func (c *SimpleSession) readEntry(dn string, attributes []string) (*ldap.Entry, error) {
+	res, err := c.conn.Search(ldap.NewSearchRequest(
+		dn,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1, // size limit
+		0, // time limit
+		false,
+		"(objectClass=*)",
+		attributes,
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) == 0 {
+		return nil, fmt.Errorf("entry %#v is not found", dn)
+	}
+	return res.Entries[0], nil
+}
+
+// bindAccountDN finds the DN of the bind account by the "Who am I?" operation (RFC 4532).
+// ActiveDirectory answers "u:DOMAIN\username" instead of the DN, so it is searched by sAMAccountName.
+func (c *SimpleSession) bindAccountDN() (string, error) {
+	res, err := c.conn.WhoAmI(nil)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case res.AuthzID == "":
+		return "", nil
+	case strings.HasPrefix(res.AuthzID, "dn:"):
+		return res.AuthzID[len("dn:"):], nil
+	case !strings.HasPrefix(res.AuthzID, "u:"):
+		return "", fmt.Errorf("unsupported authorization ID: %#v", res.AuthzID)
+	}
+
+	username := res.AuthzID[len("u:"):]
+	if i := strings.LastIndex(username, `\`); i >= 0 {
+		username = username[i+1:]
+	}
+
+	root, err := c.readEntry("", []string{"defaultNamingContext"})
+	if err != nil {
+		return "", err
+	}
+	base := root.GetAttributeValue("defaultNamingContext")
+	if base == "" {
+		base = c.BaseDN
+	}
+
+	users, err := c.conn.Search(ldap.NewSearchRequest(
+		base,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, // size limit
+		0, // time limit
+		false,
+		fmt.Sprintf("(sAMAccountName=%s)", ldap.EscapeFilter(username)),
+		[]string{noAttributes},
+		nil,
+	))
+	if err != nil {
+		return "", err
+	}
+	if len(users.Entries) != 1 {
+		return "", fmt.Errorf("failed to find the bind account %#v", res.AuthzID)
+	}
+	return users.Entries[0].DN, nil
+}
+
+// writable checks the entry by allowedAttributesEffective and allowedChildClassesEffective of ActiveDirectory.
+// It always reports false for the directories that don't have these attributes.
+func (c *SimpleSession) writable(dn string) (bool, error) {
+	entry, err := c.readEntry(dn, []string{"allowedAttributesEffective", "allowedChildClassesEffective"})
+	if err != nil {
+		return false, err
+	}
+	return len(entry.GetAttributeValues("allowedAttributesEffective")) > 0 || len(entry.GetAttributeValues("allowedChildClassesEffective")) > 0, nil
+}
+
+func (c *SimpleSession) BindPrivileges() (Privileges, error) {
+	var p Privileges
+
+	account, err := c.bindAccountDN()
+	if err != nil || account == "" {
+		return p, err
+	}
+	p.Account = account
+
+	// tokenGroups includes nested groups, but it can read only with the base scope.
+	entry, err := c.readEntry(account, []string{"tokenGroups"})
+	if err != nil {
+		return p, err
+	}
+	for _, sid := range entry.GetRawAttributeValues("tokenGroups") {
+		if name, ok := adminGroupName(sid); ok {
+			p.AdminGroups = append(p.AdminGroups, name)
+		}
+	}
+
+	if ok, err := c.writable(c.BaseDN); err != nil {
+		return p, err
+	} else if ok {
+		p.Writable = append(p.Writable, c.BaseDN)
+	}
+
+	// The account itself is not checked, because everyone can modify some attributes of themselves by default.
+	users, err := c.conn.Search(ldap.NewSearchRequest(
+		c.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, // size limit
+		0, // time limit
+		false,
+		"(objectClass=person)",
+		[]string{"allowedAttributesEffective"},
+		nil,
+	))
+	if err != nil && !(ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) && users != nil) {
+		return p, err
+	}
+	for _, user := range users.Entries {
+		if !strings.EqualFold(user.DN, account) && len(user.GetAttributeValues("allowedAttributesEffective")) > 0 {
+			p.Writable = append(p.Writable, user.DN)
+			break
+		}
+	}
+
+	return p, nil
+}
+
+// ProbePrivileges checks that the bind account has no more privileges than Lauth needs.
+// It returns problems as messages for the administrator.
+// Write privileges are not reported if allowWrite is true, because user registration and invitation need them.
+func ProbePrivileges(p PrivilegeProber, allowWrite bool) ([]string, error) {
+	privs, err := p.BindPrivileges()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, g := range privs.AdminGroups {
+		problems = append(problems, fmt.Sprintf("The bind account %#v is a member of %#v. Please use an account that can only read users.", privs.Account, g))
+	}
+	if !allowWrite {
+		for _, dn := range privs.Writable {
+			problems = append(problems, fmt.Sprintf("The bind account %#v can modify %#v. Lauth needs only read permission unless registration or invitation is enabled.", privs.Account, dn))
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,47 @@
+package ldap
+
+import (
+	"testing"
+)
+
+func TestParseSID(t *testing.T) {
+	tests := []struct {
+		Input  []byte
+		Expect string
+	}{
+		{[]byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 32, 2, 0, 0}, "S-1-5-32-544"},
+		{[]byte{1, 5, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 0, 2, 0, 0}, "S-1-5-21-1-2-3-512"},
+	}
+
+	for _, tt := range tests {
+		if s, err := parseSID(tt.Input); err != nil {
+			t.Errorf("%v: failed to parse: %s", tt.Input, err)
+		} else if s != tt.Expect {
+			t.Errorf("%v: expected %s but got %s", tt.Input, tt.Expect, s)
+		}
+	}
+
+	if _, err := parseSID([]byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0}); err == nil {
+		t.Errorf("expected error for truncated SID")
+	}
+}
+
+func TestAdminGroupName(t *testing.T) {
+	tests := []struct {
+		Input  []byte
+		Name   string
+		Expect bool
+	}{
+		{[]byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 32, 2, 0, 0}, "Administrators", true},
+		{[]byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 33, 2, 0, 0}, "", false},
+		{[]byte{1, 5, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 0, 2, 0, 0}, "Domain Admins", true},
+		{[]byte{1, 5, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 7, 2, 0, 0}, "Enterprise Admins", true},
+		{[]byte{1, 5, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 1, 2, 0, 0}, "", false},
+	}
+
+	for _, tt := range tests {
+		if name, ok := adminGroupName(tt.Input); name != tt.Name || ok != tt.Expect {
+			t.Errorf("%v: expected %#v, %v but got %#v, %v", tt.Input, tt.Name, tt.Expect, name, ok)
+		}
+	}
+}
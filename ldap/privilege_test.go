@@ -0,0 +1,59 @@
+package ldap_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/ldap"
+)
+
+type DummyPrivilegeProber struct {
+	Privileges ldap.Privileges
+	Err        error
+}
+
+func (p DummyPrivilegeProber) BindPrivileges() (ldap.Privileges, error) {
+	return p.Privileges, p.Err
+}
+
+func TestProbePrivileges(t *testing.T) {
+	p := DummyPrivilegeProber{
+		Privileges: ldap.Privileges{
+			Account:     "CN=lauth,DC=example,DC=com",
+			AdminGroups: []string{"Domain Admins"},
+			Writable:    []string{"OU=users,DC=example,DC=com"},
+		},
+	}
+
+	problems, err := ldap.ProbePrivileges(p, false)
+	if err != nil {
+		t.Fatalf("failed to probe privileges: %s", err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems but got %d: %#v", len(problems), problems)
+	}
+	if !strings.Contains(problems[0], `"Domain Admins"`) {
+		t.Errorf("unexpected problem for admin group: %s", problems[0])
+	}
+	if !strings.Contains(problems[1], `can modify "OU=users,DC=example,DC=com"`) {
+		t.Errorf("unexpected problem for write privilege: %s", problems[1])
+	}
+
+	problems, err = ldap.ProbePrivileges(p, true)
+	if err != nil {
+		t.Fatalf("failed to probe privileges: %s", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], `"Domain Admins"`) {
+		t.Errorf("admin group should be reported even if write is allowed: %#v", problems)
+	}
+
+	problems, err = ldap.ProbePrivileges(DummyPrivilegeProber{Privileges: ldap.Privileges{Account: "CN=lauth,DC=example,DC=com"}}, false)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("expected no problem but got %#v, %v", problems, err)
+	}
+
+	if _, err := ldap.ProbePrivileges(DummyPrivilegeProber{Err: fmt.Errorf("access denied")}, false); err == nil {
+		t.Errorf("expected error if failed to inspect privileges")
+	}
+}
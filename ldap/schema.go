@@ -0,0 +1,180 @@
+package ldap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/macrat/lauth/config"
+)
+
+// SchemaProber is a Session that can inspect the schema of the directory.
+type SchemaProber interface {
+	// AttributeTypes returns names of attribute types that defined in the schema, in lower case.
+	AttributeTypes() (map[string]bool, error)
+
+	// HasAttribute checks if any user under the base DN has the attribute that the bind account can read.
+	HasAttribute(attribute string) (bool, error)
+}
+
+var (
+	attributeTypeNames = regexp.MustCompile(`NAME\s+(?:'([^']*)'|\(([^)]*)\))`)
+	quotedName         = regexp.MustCompile(`'([^']*)'`)
+)
+
+// parseAttributeTypeNames extracts names from a value of attributeTypes in the subschema (RFC 4512 section 4.1.2),
+// like "( 2.5.4.3 NAME ( 'cn' 'commonName' ) SUP name )".
+func parseAttributeTypeNames(def string) []string {
+	m := attributeTypeNames.FindStringSubmatch(def)
+	if m == nil {
+		return nil
+	}
+	if m[1] != "" {
+		return []string{m[1]}
+	}
+
+	var names []string
+	for _, n := range quotedName.FindAllStringSubmatch(m[2], -1) {
+		names = append(names, n[1])
+	}
+	return names
+}
+
+func (c *SimpleSession) AttributeTypes() (map[string]bool, error) {
+	res, err := c.conn.Search(ldap.NewSearchRequest(
+		"",
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1, // size limit
+		0, // time limit
+		false,
+		"(objectClass=*)",
+		[]string{"subschemaSubentry"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) == 0 || res.Entries[0].GetAttributeValue("subschemaSubentry") == "" {
+		return nil, fmt.Errorf("subschemaSubentry is not found in the root DSE")
+	}
+
+	res, err = c.conn.Search(ldap.NewSearchRequest(
+		res.Entries[0].GetAttributeValue("subschemaSubentry"),
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1, // size limit
+		0, // time limit
+		false,
+		"(objectClass=*)",
+		[]string{"attributeTypes"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) == 0 {
+		return nil, fmt.Errorf("subschema entry is not found")
+	}
+
+	types := make(map[string]bool)
+	for _, def := range res.Entries[0].GetAttributeValues("attributeTypes") {
+		for _, name := range parseAttributeTypeNames(def) {
+			types[strings.ToLower(name)] = true
+		}
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no attributeTypes in the subschema entry")
+	}
+	return types, nil
+}
+
+func (c *SimpleSession) HasAttribute(attribute string) (bool, error) {
+	if strings.EqualFold(attribute, tokenGroupsAttribute) {
+		return c.hasTokenGroups()
+	}
+
+	res, err := c.conn.Search(ldap.NewSearchRequest(
+		c.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		1, // size limit
+		0, // time limit
+		false,
+		fmt.Sprintf("(&(objectClass=person)(%s=*))", ldap.EscapeFilter(attribute)),
+		[]string{attribute},
+		nil,
+	))
+	if err != nil && !(ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) && res != nil) {
+		return false, err
+	}
+
+	for _, entry := range res.Entries {
+		if len(entry.GetAttributeValues(attribute)) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ProbeSchema checks that the attributes are defined in the schema, and readable by the bind account.
+// It returns problems as messages for the administrator.
+// The error is not nil if failed to read the schema, but problems about readability are still reported.
+func ProbeSchema(p SchemaProber, attrs []config.AttributeUsage) ([]string, error) {
+	types, schemaErr := p.AttributeTypes()
+
+	var problems []string
+	checked := make(map[string]bool)
+
+	for _, a := range attrs {
+		key := strings.ToLower(a.Attribute)
+
+		if types != nil && !types[key] {
+			problems = append(problems, fmt.Sprintf("Attribute %#v for %s is not defined in the LDAP schema. Please check the spelling.", a.Attribute, a.UsedBy))
+			continue
+		}
+
+		ok, seen := checked[key]
+		if !seen {
+			var err error
+			ok, err = p.HasAttribute(a.Attribute)
+			if err != nil {
+				return problems, fmt.Errorf("failed to search users that have attribute %#v: %s", a.Attribute, err)
+			}
+			checked[key] = ok
+		}
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Attribute %#v for %s is not readable by the bind account, or no user has it. Please check access control of the LDAP server.", a.Attribute, a.UsedBy))
+		}
+	}
+
+	return problems, schemaErr
+}
+
+// hasTokenGroups checks tokenGroups of a user, because it can't use in search filters.
+func (c *SimpleSession) hasTokenGroups() (bool, error) {
+	res, err := c.conn.Search(ldap.NewSearchRequest(
+		c.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		1, // size limit
+		0, // time limit
+		false,
+		"(objectClass=person)",
+		[]string{noAttributes},
+		nil,
+	))
+	if err != nil && !(ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) && res != nil) {
+		return false, err
+	}
+	if len(res.Entries) == 0 {
+		return false, nil
+	}
+
+	entry, err := c.readEntry(res.Entries[0].DN, []string{tokenGroupsAttribute})
+	if err != nil {
+		return false, err
+	}
+	return len(entry.GetRawAttributeValues(tokenGroupsAttribute)) > 0, nil
+}
@@ -0,0 +1,24 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAttributeTypeNames(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Expect []string
+	}{
+		{"( 0.9.2342.19200300.100.1.3 NAME 'mail' EQUALITY caseIgnoreIA5Match )", []string{"mail"}},
+		{"( 2.5.4.3 NAME ( 'cn' 'commonName' ) SUP name )", []string{"cn", "commonName"}},
+		{"( 1.2.840.113556.1.4.221 NAME 'sAMAccountName' SYNTAX '1.3.6.1.4.1.1466.115.121.1.15' SINGLE-VALUE )", []string{"sAMAccountName"}},
+		{"( 1.2.3.4 DESC 'no name' )", nil},
+	}
+
+	for _, tt := range tests {
+		if names := parseAttributeTypeNames(tt.Input); !reflect.DeepEqual(names, tt.Expect) {
+			t.Errorf("%s: expected %#v but got %#v", tt.Input, tt.Expect, names)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ldap_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+)
+
+type DummyProber struct {
+	Types     map[string]bool
+	SchemaErr error
+	Readable  map[string]bool
+	Searched  []string
+}
+
+func (p *DummyProber) AttributeTypes() (map[string]bool, error) {
+	return p.Types, p.SchemaErr
+}
+
+func (p *DummyProber) HasAttribute(attribute string) (bool, error) {
+	p.Searched = append(p.Searched, attribute)
+	return p.Readable[attribute], nil
+}
+
+func TestProbeSchema(t *testing.T) {
+	attrs := []config.AttributeUsage{
+		{Attribute: "sAMAccountName", UsedBy: "--ldap-id-attribute"},
+		{Attribute: "mial", UsedBy: `claim "email" of scope "email"`},
+		{Attribute: "jpegPhoto", UsedBy: `claim "picture" of scope "profile"`},
+		{Attribute: "jpegPhoto", UsedBy: `claim "photo" of scope "profile"`},
+	}
+
+	p := &DummyProber{
+		Types:    map[string]bool{"samaccountname": true, "mail": true, "jpegphoto": true},
+		Readable: map[string]bool{"sAMAccountName": true},
+	}
+	problems, err := ldap.ProbeSchema(p, attrs)
+	if err != nil {
+		t.Fatalf("failed to probe schema: %s", err)
+	}
+	if len(problems) != 3 {
+		t.Fatalf("expected 3 problems but got %d: %#v", len(problems), problems)
+	}
+	if !strings.Contains(problems[0], `"mial"`) || !strings.Contains(problems[0], "not defined in the LDAP schema") {
+		t.Errorf("unexpected problem for undefined attribute: %s", problems[0])
+	}
+	for _, p := range problems[1:] {
+		if !strings.Contains(p, `"jpegPhoto"`) || !strings.Contains(p, "not readable") {
+			t.Errorf("unexpected problem for unreadable attribute: %s", p)
+		}
+	}
+	if strings.Join(p.Searched, ",") != "sAMAccountName,jpegPhoto" {
+		t.Errorf("each attribute should be searched only once: %#v", p.Searched)
+	}
+
+	p = &DummyProber{
+		SchemaErr: fmt.Errorf("access denied"),
+		Readable:  map[string]bool{"sAMAccountName": true, "jpegPhoto": true},
+	}
+	problems, err = ldap.ProbeSchema(p, attrs)
+	if err == nil {
+		t.Errorf("expected error if failed to read schema")
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], `"mial"`) || !strings.Contains(problems[0], "not readable") {
+		t.Errorf("readability should be checked even if failed to read schema: %#v", problems)
+	}
+}
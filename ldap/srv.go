@@ -0,0 +1,115 @@
+package ldap
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SRVResolver keeps addresses of LDAP servers that found in SRV records like `_ldap._tcp.example.com`.
+// The addresses are refreshed periodically by StartRefreshing, so replaced domain controllers are used without restart.
+type SRVResolver struct {
+	Service string
+	Domain  string
+
+	// Lookup is the function to resolve SRV records. It is net.LookupSRV if nil.
+	Lookup func(service, proto, name string) (string, []*net.SRV, error)
+
+	sync.RWMutex
+	addrs []string
+}
+
+// NewSRVResolver makes a SRVResolver for the service like "ldap" or "ldaps" in the domain.
+func NewSRVResolver(service, domain string) *SRVResolver {
+	return &SRVResolver{
+		Service: service,
+		Domain:  domain,
+	}
+}
+
+// Addresses returns addresses of servers in the order of priority, like "dc1.example.com:389".
+func (r *SRVResolver) Addresses() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.addrs
+}
+
+// Refresh resolves SRV records again, and reports whether the addresses are changed.
+// The previous addresses are kept if failed to resolve, so a temporary failure of DNS doesn't stop the service.
+func (r *SRVResolver) Refresh() (changed bool, err error) {
+	lookup := r.Lookup
+	if lookup == nil {
+		lookup = net.LookupSRV
+	}
+
+	_, records, err := lookup(r.Service, "tcp", r.Domain)
+	if err != nil {
+		return false, err
+	}
+	if len(records) == 0 {
+		return false, fmt.Errorf("no SRV record for _%s._tcp.%s", r.Service, r.Domain)
+	}
+
+	// Records are already sorted by priority and randomized by weight in the lookup.
+	addrs := make([]string, len(records))
+	for i, srv := range records {
+		addrs[i] = net.JoinHostPort(trimDot(srv.Target), strconv.Itoa(int(srv.Port)))
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	changed = !sameAddresses(r.addrs, addrs)
+	r.addrs = addrs
+	return changed, nil
+}
+
+func trimDot(host string) string {
+	if len(host) > 0 && host[len(host)-1] == '.' {
+		return host[:len(host)-1]
+	}
+	return host
+}
+
+// sameAddresses compares addresses without order, because the order changes by weight on every lookup.
+func sameAddresses(xs, ys []string) bool {
+	count := func(ss []string) map[string]int {
+		m := make(map[string]int)
+		for _, s := range ss {
+			m[s]++
+		}
+		return m
+	}
+	return reflect.DeepEqual(count(xs), count(ys))
+}
+
+// StartRefreshing calls Refresh every interval until stop called.
+func (r *SRVResolver) StartRefreshing(interval time.Duration, onChange func([]string), onError func(error)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				changed, err := r.Refresh()
+				if err != nil && onError != nil {
+					onError(err)
+				} else if changed && onChange != nil {
+					onChange(r.Addresses())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
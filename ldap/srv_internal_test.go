@@ -0,0 +1,56 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestSimpleConnector_dial_SRV(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	server := &config.URL{Scheme: "ldap", Host: "example.com"}
+	resolver := NewSRVResolver("ldap", "example.com")
+	resolver.addrs = []string{closedAddr, l.Addr().String()}
+
+	c := SimpleConnector{
+		Config:   &config.LDAPConfig{Server: server},
+		Resolver: resolver,
+	}
+	conn, _, err := c.dial(nil)
+	if err != nil {
+		t.Fatalf("expected to connect the second server but failed: %s", err)
+	}
+	conn.Close()
+
+	resolver.addrs = []string{closedAddr}
+	if _, _, err := c.dial(nil); err == nil {
+		t.Errorf("expected error if all servers are down")
+	}
+
+	resolver.addrs = nil
+	if _, _, err := c.dial(nil); err == nil {
+		t.Errorf("expected error if no server found")
+	}
+}
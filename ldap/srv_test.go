@@ -0,0 +1,89 @@
+package ldap_test
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/ldap"
+)
+
+type DummyDNS struct {
+	sync.Mutex
+	Records []*net.SRV
+	Err     error
+}
+
+func (d *DummyDNS) Set(records []*net.SRV, err error) {
+	d.Lock()
+	defer d.Unlock()
+	d.Records = records
+	d.Err = err
+}
+
+func (d *DummyDNS) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	d.Lock()
+	defer d.Unlock()
+	if service != "ldap" || proto != "tcp" || name != "example.com" {
+		return "", nil, fmt.Errorf("unexpected lookup: _%s._%s.%s", service, proto, name)
+	}
+	return "_ldap._tcp.example.com.", d.Records, d.Err
+}
+
+func TestSRVResolver(t *testing.T) {
+	dns := &DummyDNS{Records: []*net.SRV{
+		{Target: "dc1.example.com.", Port: 389, Priority: 0},
+		{Target: "dc2.example.com.", Port: 3389, Priority: 10},
+	}}
+	r := ldap.NewSRVResolver("ldap", "example.com")
+	r.Lookup = dns.LookupSRV
+
+	if changed, err := r.Refresh(); err != nil {
+		t.Fatalf("failed to refresh: %s", err)
+	} else if !changed {
+		t.Errorf("expected changed on the first refresh")
+	}
+	expect := []string{"dc1.example.com:389", "dc2.example.com:3389"}
+	if addrs := r.Addresses(); !reflect.DeepEqual(addrs, expect) {
+		t.Errorf("unexpected addresses: %#v", addrs)
+	}
+
+	dns.Set([]*net.SRV{dns.Records[1], dns.Records[0]}, nil)
+	if changed, err := r.Refresh(); err != nil || changed {
+		t.Errorf("reordering by weight should not be a change: changed=%v err=%v", changed, err)
+	}
+
+	dns.Set(nil, fmt.Errorf("temporary failure"))
+	if _, err := r.Refresh(); err == nil {
+		t.Errorf("expected error if failed to lookup")
+	}
+	dns.Set(nil, nil)
+	if _, err := r.Refresh(); err == nil {
+		t.Errorf("expected error if no records")
+	}
+	if addrs := r.Addresses(); len(addrs) != 2 {
+		t.Errorf("previous addresses should be kept if failed to refresh: %#v", addrs)
+	}
+
+	changes := make(chan []string, 1)
+	stop := r.StartRefreshing(10*time.Millisecond, func(addrs []string) {
+		select {
+		case changes <- addrs:
+		default:
+		}
+	}, nil)
+	defer stop()
+
+	dns.Set([]*net.SRV{{Target: "dc3.example.com.", Port: 389}}, nil)
+	select {
+	case addrs := <-changes:
+		if !reflect.DeepEqual(addrs, []string{"dc3.example.com:389"}) {
+			t.Errorf("unexpected addresses after change: %#v", addrs)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("change of SRV records is not detected")
+	}
+}
@@ -0,0 +1,394 @@
+// Package lockout counts failed logins to lock out brute-force attacks.
+package lockout
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Counter records failed logins for each key like username.
+//
+// Counter that made by OpenDir stores the records in the directory, so replicas that share the directory share the counts.
+// Otherwise the records are kept only in memory of the process.
+type Counter struct {
+	sync.Mutex
+
+	dir     string
+	entries map[string][]time.Time
+}
+
+// NewCounter makes a new Counter on memory.
+func NewCounter() *Counter {
+	return &Counter{
+		entries: make(map[string][]time.Time),
+	}
+}
+
+// OpenDir makes a Counter that stores records in the directory.
+//
+// The directory will be created if not exists.
+// Each key is stored as a separated file that named by the hash of the key, so the directory doesn't tell any username.
+func OpenDir(dir string) (*Counter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Counter{dir: dir}, nil
+}
+
+func (c *Counter) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:]))
+}
+
+func readFile(path string) ([]time.Time, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var times []time.Time
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		t, err := strconv.ParseInt(scanner.Text(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		times = append(times, time.Unix(t, 0))
+	}
+
+	return times, scanner.Err()
+}
+
+// lockTimeout is how long to wait for the lock file of a key that held by another process.
+// A lock file older than this is regarded as left by a crashed process, and removed.
+const lockTimeout = 10 * time.Second
+
+// lockKey takes the lock of the key that shared between processes that use the same directory.
+// The caller must hold the mutex of the Counter.
+func (c *Counter) lockKey(key string) (unlock func(), err error) {
+	if c.dir == "" {
+		return func() {}, nil
+	}
+	return c.lockPath(c.path(key))
+}
+
+func (c *Counter) lockPath(path string) (unlock func(), err error) {
+	path += ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockTimeout {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s: timed out to take lock", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (c *Counter) load(key string) ([]time.Time, error) {
+	if c.dir == "" {
+		return c.entries[key], nil
+	}
+	return readFile(c.path(key))
+}
+
+// store replaces records of the key, or removes the key if times is empty.
+// The file is replaced by rename, so readers never see a half-written file.
+func (c *Counter) store(key string, times []time.Time) error {
+	if c.dir == "" {
+		if len(times) == 0 {
+			delete(c.entries, key)
+		} else {
+			c.entries[key] = times
+		}
+		return nil
+	}
+
+	return c.storePath(c.path(key), times)
+}
+
+func (c *Counter) storePath(path string, times []time.Time) error {
+	if len(times) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, t := range times {
+		fmt.Fprintf(&buf, "%d\n", t.Unix())
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// dropBefore returns records that are not older than since.
+func dropBefore(times []time.Time, since time.Time) []time.Time {
+	var kept []time.Time
+	for _, t := range times {
+		if !t.Before(since) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// loadSince reads records of the key, and rewrites them if there are records older than since.
+// The caller must hold the lock of the key.
+func (c *Counter) loadSince(key string, since time.Time) ([]time.Time, error) {
+	times, err := c.load(key)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := dropBefore(times, since)
+	if len(kept) != len(times) {
+		if err := c.store(key, kept); err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// Fail records a failed login of the key.
+func (c *Counter) Fail(key string, at time.Time) error {
+	return c.Add(key, at)
+}
+
+// Add records an event of the key.
+// It is the same as Fail, for the counters of the other events than failed logins.
+func (c *Counter) Add(key string, at time.Time) error {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.dir == "" {
+		c.entries[key] = append(c.entries[key], at)
+		return nil
+	}
+
+	unlock, err := c.lockKey(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(c.path(key), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(f, "%d\n", at.Unix()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Count returns the number of failed logins of the key since the time.
+//
+// Records that older than since are removed.
+func (c *Counter) Count(key string, since time.Time) (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	unlock, err := c.lockKey(key)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	times, err := c.loadSince(key, since)
+	return len(times), err
+}
+
+// Limit is a limit of the number of records of a key, for Take.
+type Limit struct {
+	Key   string
+	Since time.Time
+	Max   int
+}
+
+// Take records an event at the time to every key of limits, only if no limit is reached.
+//
+// It returns the index of the first limit that reached, or -1 if the event is recorded.
+// Counting and recording are done atomically, so concurrent callers never exceed the limits.
+// Records that older than Since of each limit are removed.
+func (c *Counter) Take(at time.Time, limits ...Limit) (int, error) {
+	if c == nil {
+		return -1, nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	keys := make([]string, 0, len(limits))
+	for _, l := range limits {
+		keys = append(keys, l.Key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if i > 0 && keys[i-1] == key {
+			continue
+		}
+		unlock, err := c.lockKey(key)
+		if err != nil {
+			return -1, err
+		}
+		defer unlock()
+	}
+
+	records := make([][]time.Time, len(limits))
+	for i, l := range limits {
+		times, err := c.loadSince(l.Key, l.Since)
+		if err != nil {
+			return -1, err
+		}
+		if len(times) >= l.Max {
+			return i, nil
+		}
+		records[i] = times
+	}
+
+	for i, l := range limits {
+		if err := c.store(l.Key, append(records[i], at)); err != nil {
+			return -1, err
+		}
+	}
+	return -1, nil
+}
+
+// Reset removes all records of the key, for example after succeed to login.
+func (c *Counter) Reset(key string) error {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	unlock, err := c.lockKey(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.store(key, nil)
+}
+
+// Sweep removes records that older than before from every key, and removes keys that have no record.
+//
+// Count and Take drop old records only of the key they read, so keys that never read again, like usernames that tried only once, are kept until Sweep.
+func (c *Counter) Sweep(before time.Time) error {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.dir == "" {
+		for key := range c.entries {
+			c.store(key, dropBefore(c.entries[key], before))
+		}
+		return nil
+	}
+
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != "" {
+			continue
+		}
+		if err := c.sweepFile(f.Name(), before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweepFile drops old records in the file. The name is the hash of a key, because the key itself is unknown.
+func (c *Counter) sweepFile(name string, before time.Time) error {
+	path := filepath.Join(c.dir, name)
+
+	unlock, err := c.lockPath(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	times, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	kept := dropBefore(times, before)
+	if len(kept) == len(times) {
+		return nil
+	}
+	return c.storePath(path, kept)
+}
+
+// StartSweeping calls Sweep every interval to remove records older than maxAge, until stop called.
+func (c *Counter) StartSweeping(interval, maxAge time.Duration, onError func(error)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				if err := c.Sweep(now.Add(-maxAge)); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
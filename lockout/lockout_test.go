@@ -0,0 +1,267 @@
+package lockout_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/lockout"
+)
+
+func testCounter(t *testing.T, c *lockout.Counter) {
+	t.Helper()
+
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if err := c.Fail("macrat", now.Add(time.Duration(i-2)*time.Minute)); err != nil {
+			t.Fatalf("failed to record: %s", err)
+		}
+	}
+
+	if n, err := c.Count("macrat", now.Add(-5*time.Minute)); err != nil || n != 3 {
+		t.Errorf("expected 3 failures but got %d %v", n, err)
+	}
+	if n, err := c.Count("macrat", now.Add(-90*time.Second)); err != nil || n != 2 {
+		t.Errorf("expected 2 failures in the last 90 seconds but got %d %v", n, err)
+	}
+	if n, err := c.Count("j.smith", now.Add(-5*time.Minute)); err != nil || n != 0 {
+		t.Errorf("expected no failures of another user but got %d %v", n, err)
+	}
+
+	if err := c.Reset("macrat"); err != nil {
+		t.Fatalf("failed to reset: %s", err)
+	}
+	if n, err := c.Count("macrat", now.Add(-5*time.Minute)); err != nil || n != 0 {
+		t.Errorf("expected no failures after reset but got %d %v", n, err)
+	}
+	if err := c.Reset("macrat"); err != nil {
+		t.Errorf("failed to reset twice: %s", err)
+	}
+}
+
+func testTake(t *testing.T, c *lockout.Counter) {
+	t.Helper()
+
+	now := time.Now()
+	limits := []lockout.Limit{
+		{Key: "subject:macrat", Since: now.Add(-time.Hour), Max: 3},
+		{Key: "client:some_client", Since: now.Add(-time.Minute), Max: 2},
+	}
+
+	if err := c.Add("client:some_client", now.Add(-2*time.Minute)); err != nil {
+		t.Fatalf("failed to record: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if n, err := c.Take(now, limits...); err != nil || n != -1 {
+			t.Fatalf("%d: failed to take: %d %v", i, n, err)
+		}
+	}
+	if n, err := c.Take(now, limits...); err != nil || n != 1 {
+		t.Errorf("expected client limit reached but got %d %v", n, err)
+	}
+	if n, err := c.Count("subject:macrat", now.Add(-time.Hour)); err != nil || n != 2 {
+		t.Errorf("rejected take must not be recorded but got %d %v", n, err)
+	}
+	if n, err := c.Count("client:some_client", time.Time{}); err != nil || n != 2 {
+		t.Errorf("expected record out of window to be dropped but got %d %v", n, err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := c.Take(now, lockout.Limit{Key: "concurrent", Since: now.Add(-time.Minute), Max: 5})
+			if err != nil {
+				t.Errorf("failed to take: %s", err)
+			} else if n == -1 {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 5 {
+		t.Errorf("expected 5 takes succeeded but got %d", taken)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	testCounter(t, lockout.NewCounter())
+	testTake(t, lockout.NewCounter())
+
+	var nilCounter *lockout.Counter
+	if err := nilCounter.Fail("macrat", time.Now()); err != nil {
+		t.Errorf("nil counter must ignore failure: %s", err)
+	}
+	if n, err := nilCounter.Count("macrat", time.Time{}); err != nil || n != 0 {
+		t.Errorf("nil counter must count nothing: %d %v", n, err)
+	}
+	if n, err := nilCounter.Take(time.Now(), lockout.Limit{Key: "macrat", Max: 0}); err != nil || n != -1 {
+		t.Errorf("nil counter must take always: %d %v", n, err)
+	}
+}
+
+func TestOpenDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "lockout")
+
+	c, err := lockout.OpenDir(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	testCounter(t, c)
+
+	c, err = lockout.OpenDir(filepath.Join(t.TempDir(), "quota"))
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	testTake(t, c)
+}
+
+func testSweep(t *testing.T, c *lockout.Counter) {
+	t.Helper()
+
+	now := time.Now()
+	c.Fail("alice", now.Add(-time.Hour))
+	c.Fail("bob", now.Add(-time.Hour))
+	c.Fail("bob", now)
+
+	if err := c.Sweep(now.Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to sweep: %s", err)
+	}
+
+	if n, err := c.Count("alice", time.Time{}); err != nil || n != 0 {
+		t.Errorf("old records of alice should be swept but got %d %v", n, err)
+	}
+	if n, err := c.Count("bob", time.Time{}); err != nil || n != 1 {
+		t.Errorf("expected only the recent record of bob but got %d %v", n, err)
+	}
+}
+
+func TestCounter_Sweep(t *testing.T) {
+	testSweep(t, lockout.NewCounter())
+
+	dir := t.TempDir()
+	c, err := lockout.OpenDir(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	testSweep(t, c)
+
+	if files, err := os.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("expected only the file of bob but got %v %v", files, err)
+	}
+}
+
+func TestOpenDir_DropOld(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := lockout.OpenDir(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+
+	now := time.Now()
+	c.Fail("macrat", now.Add(-time.Hour))
+	c.Fail("macrat", now)
+
+	if n, err := c.Count("macrat", now.Add(-time.Minute)); err != nil || n != 1 {
+		t.Errorf("expected 1 recent failure but got %d %v", n, err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("unexpected files: %v %v", files, err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err)
+	}
+	if string(raw) != fmt.Sprintf("%d\n", now.Unix()) {
+		t.Errorf("old record should be dropped from file: %q", raw)
+	}
+}
+
+func TestOpenDir_Shared(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := lockout.OpenDir(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	b, err := lockout.OpenDir(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+
+	now := time.Now()
+	a.Fail("macrat", now)
+	b.Fail("macrat", now)
+	a.Fail("macrat", now)
+
+	if n, err := b.Count("macrat", now.Add(-time.Minute)); err != nil || n != 3 {
+		t.Errorf("expected 3 failures from both counters but got %d %v", n, err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %s", err)
+	}
+	if len(files) != 1 || files[0].Name() == "macrat" {
+		t.Errorf("unexpected files: %v", files)
+	}
+
+	if err := b.Reset("macrat"); err != nil {
+		t.Fatalf("failed to reset: %s", err)
+	}
+	if n, err := a.Count("macrat", now.Add(-time.Minute)); err != nil || n != 0 {
+		t.Errorf("expected reset by another counter but got %d %v", n, err)
+	}
+}
+
+func TestOpenDir_RemoveStale(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := lockout.OpenDir(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+
+	now := time.Now()
+	c.Fail("macrat", now.Add(-time.Hour))
+
+	if n, err := c.Count("macrat", now.Add(-time.Minute)); err != nil || n != 0 {
+		t.Errorf("expected no recent failures but got %d %v", n, err)
+	}
+
+	if files, err := os.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Errorf("stale file should be removed: %v %v", files, err)
+	}
+}
+
+func TestOpenDir_Broken(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := lockout.OpenDir(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	c.Fail("macrat", time.Now())
+
+	files, _ := os.ReadDir(dir)
+	if err := os.WriteFile(filepath.Join(dir, files[0].Name()), []byte("hello\n"), 0600); err != nil {
+		t.Fatalf("failed to break file: %s", err)
+	}
+
+	if _, err := c.Count("macrat", time.Time{}); err == nil {
+		t.Errorf("expected error for broken file")
+	}
+}
@@ -0,0 +1,20 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/mail"
+)
+
+func TestCompose(t *testing.T) {
+	msg := string(mail.Compose("lauth@example.com", "someone@example.com\r\nBcc: evil@example.com", "hello", "line1\nline2"))
+
+	if !strings.HasPrefix(msg, "From: lauth@example.com\r\nTo: someone@example.comBcc: evil@example.com\r\nSubject: hello\r\n") {
+		t.Errorf("unexpected headers:\n%s", msg)
+	}
+
+	if !strings.HasSuffix(msg, "\r\n\r\nline1\r\nline2") {
+		t.Errorf("unexpected body:\n%s", msg)
+	}
+}
@@ -12,12 +12,8 @@ var (
 	)
 )
 
-func init() {
-	Authz.MustRegister()
-}
-
 func StartAuthz(ctx *gin.Context) *Context {
-	c := Authz.Start(ctx)
+	c := Authz.Start(GinRequest(ctx))
 	c.Set("method", ctx.Request.Method)
 	return c
 }
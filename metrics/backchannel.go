@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Backchannel = NewEndpointMetrics(
+		"backchannel",
+		[]string{"step", "client_id", "username"},
+		[]string{"step"},
+	)
+)
+
+func StartBackchannel(c *gin.Context) *Context {
+	return Backchannel.Start(GinRequest(c))
+}
@@ -2,26 +2,19 @@ package metrics
 
 import (
 	"net/http"
-
-	"github.com/prometheus/client_golang/prometheus"
+	"time"
 )
 
 var (
-	HTTPLatency = prometheus.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Namespace: NAMESPACE,
-			Subsystem: "http",
-			Name:      "latency_seconds",
-			Help:      "The whole latency of each endpoint. It is includes non-core process like minifying or compression.",
-		},
-		[]string{"method", "path", "status"},
+	HTTPLatency = NewHistogram(
+		"http",
+		"latency_seconds",
+		"The whole latency of each endpoint. It is includes non-core process like minifying or compression.",
+		LatencyBuckets,
+		"method", "path", "status",
 	)
 )
 
-func init() {
-	prometheus.MustRegister(HTTPLatency)
-}
-
 type ResponseCollcetor struct {
 	Upstream http.ResponseWriter
 	Code     int
@@ -63,11 +56,11 @@ func Middleware(handler http.Handler) http.Handler {
 			Upstream: w,
 		}
 
-		timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
-			HTTPLatency.WithLabelValues(r.Method, r.URL.Path, rc.StatusClass()).Observe(v)
-		}))
-		defer timer.ObserveDuration()
+		req := NewRequest(r)
+		start := time.Now()
 
 		handler.ServeHTTP(rc, r)
+
+		HTTPLatency.Observe(time.Since(start).Seconds(), req.Exemplar, req.Method, req.Path, rc.StatusClass())
 	})
 }
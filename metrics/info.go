@@ -0,0 +1,16 @@
+package metrics
+
+var (
+	Info = NewGauge(
+		"",
+		"info",
+		"The config hash and the signing key ID of this instance. Replicas that have different values are drifted.",
+		"config_hash", "key_id",
+	)
+)
+
+// SetInfo sets the config hash and the signing key ID of this instance.
+// It should be called only once on startup.
+func SetInfo(configHash, keyID string) {
+	Info.Set(1, configHash, keyID)
+}
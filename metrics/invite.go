@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Invite = NewEndpointMetrics(
+		"invite",
+		[]string{"method", "step", "username"},
+		[]string{"method", "step"},
+	)
+)
+
+func StartInvite(c *gin.Context) *Context {
+	return Invite.Start(GinRequest(c))
+}
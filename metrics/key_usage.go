@@ -0,0 +1,10 @@
+package metrics
+
+var (
+	KeyUsage = NewCounter(
+		"token",
+		"key_usage_count",
+		"The count of tokens that clients sent back, by the key that signed them.",
+		"kid", "client_id",
+	)
+)
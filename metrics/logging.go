@@ -1,9 +1,10 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/macrat/lauth/errors"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -16,18 +17,22 @@ type LogContext struct {
 	Error       string
 	Description string
 	Latency     float64
-	timer       *prometheus.Timer
+	start       time.Time
+	request     Request
 }
 
 func StartLogging(ctx *gin.Context) *LogContext {
-	c := &LogContext{
-		Method: ctx.Request.Method,
-		Path:   ctx.Request.URL.Path,
-		Remote: ctx.ClientIP(),
-	}
-	c.timer = prometheus.NewTimer(c)
+	return NewLogContext(GinRequest(ctx))
+}
 
-	return c
+func NewLogContext(r Request) *LogContext {
+	return &LogContext{
+		Method:  r.Method,
+		Path:    r.Path,
+		Remote:  r.Remote,
+		start:   time.Now(),
+		request: r,
+	}
 }
 
 func (c *LogContext) writeLog(e *zerolog.Event) *zerolog.Event {
@@ -35,6 +40,10 @@ func (c *LogContext) writeLog(e *zerolog.Event) *zerolog.Event {
 	e.Str("path", c.Path)
 	e.Str("remote_addr", c.Remote)
 
+	if id := c.request.traceID(); id != "" {
+		e.Str("trace_id", id)
+	}
+
 	if c.Error != "" {
 		e.Err(c.Err)
 		e.Str("error", c.Error)
@@ -44,8 +53,8 @@ func (c *LogContext) writeLog(e *zerolog.Event) *zerolog.Event {
 	return e
 }
 
-func (c *LogContext) Observe(v float64) {
-	c.Latency = v
+func (c *LogContext) Close() error {
+	c.Latency = time.Since(c.start).Seconds()
 
 	if c.Error != "" {
 		c.writeLog(log.Error()).
@@ -56,11 +65,6 @@ func (c *LogContext) Observe(v float64) {
 			Float64("latency_seconds", c.Latency).
 			Send()
 	}
-}
-
-func (c *LogContext) Close() error {
-	c.timer.ObserveDuration()
-	c.timer = nil
 
 	return nil
 }
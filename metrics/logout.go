@@ -12,10 +12,6 @@ var (
 	)
 )
 
-func init() {
-	Logout.MustRegister()
-}
-
 func StartLogout(c *gin.Context) *Context {
-	return Logout.Start(c)
+	return Logout.Start(GinRequest(c))
 }
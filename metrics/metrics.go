@@ -2,12 +2,12 @@ package metrics
 
 import (
 	"fmt"
-	"net/http"
+	"time"
 
-	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/audit"
 	"github.com/macrat/lauth/errors"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/macrat/lauth/events"
+	"github.com/macrat/lauth/redact"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -20,8 +20,8 @@ type EndpointMetrics struct {
 	Name        string
 	Labels      []string
 	TimerLabels []string
-	Latency     *prometheus.SummaryVec
-	Count       *prometheus.CounterVec
+	Latency     *Histogram
+	Count       *Counter
 }
 
 func NewEndpointMetrics(name string, labels []string, timerLabels []string) *EndpointMetrics {
@@ -32,62 +32,73 @@ func NewEndpointMetrics(name string, labels []string, timerLabels []string) *End
 		Name:        name,
 		Labels:      labels,
 		TimerLabels: timerLabels,
-		Latency: prometheus.NewSummaryVec(
-			prometheus.SummaryOpts{
-				Namespace: NAMESPACE,
-				Subsystem: name,
-				Name:      "seconds",
-				Help:      fmt.Sprintf("The latency to processes the %s endpoint.", name),
-			},
-			timerLabels,
+		Latency: NewHistogram(
+			name,
+			"seconds",
+			fmt.Sprintf("The latency to processes the %s endpoint.", name),
+			LatencyBuckets,
+			timerLabels...,
 		),
-		Count: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Namespace: NAMESPACE,
-				Subsystem: name,
-				Name:      "count",
-				Help:      fmt.Sprintf("The count of use the %s endpoint.", name),
-			},
-			labels,
+		Count: NewCounter(
+			name,
+			"count",
+			fmt.Sprintf("The count of use the %s endpoint.", name),
+			labels...,
 		),
 	}
 }
 
-func (em *EndpointMetrics) MustRegister() {
-	prometheus.MustRegister(em.Latency)
-	prometheus.MustRegister(em.Count)
-}
-
 type Context struct {
 	Error   error
 	Metrics *EndpointMetrics
-	Labels  prometheus.Labels
+	Labels  Labels
+	Fields  map[string]string
 	Method  string
 	Path    string
 	Remote  string
-	timer   *prometheus.Timer
+	start   time.Time
+	request Request
+
+	// Timeline records steps of the request in the debug mode. It is nil otherwise.
+	Timeline *Timeline
 }
 
-func (em *EndpointMetrics) Start(ctx *gin.Context) *Context {
-	ls := make(prometheus.Labels)
+func (em *EndpointMetrics) Start(r Request) *Context {
+	ls := make(Labels)
 	for _, l := range em.Labels {
 		ls[l] = ""
 	}
 	c := &Context{
 		Metrics: em,
 		Labels:  ls,
-		Method:  ctx.Request.Method,
-		Path:    ctx.Request.URL.Path,
-		Remote:  ctx.ClientIP(),
+		Fields:  make(map[string]string),
+		Method:  r.Method,
+		Path:    r.Path,
+		Remote:  r.Remote,
+		start:   time.Now(),
+		request: r,
+	}
+	if timelineEnabled() {
+		c.Timeline = NewTimeline()
 	}
-	c.timer = prometheus.NewTimer(c)
 	return c
 }
 
+// Step starts a step of the timeline, and returns the function to end it.
+// Use it like `defer c.Step("ldap_bind")()`. It does nothing unless the debug mode.
+func (c *Context) Step(name string) (end func()) {
+	return c.Timeline.Step(name)
+}
+
 func (c *Context) Set(key, value string) {
 	c.Labels[key] = value
 }
 
+// SetField sets a value that is only for logging and not for metrics labels, like session ID.
+func (c *Context) SetField(key, value string) {
+	c.Fields[key] = value
+}
+
 func (c *Context) SetError(err error) {
 	if e, ok := err.(*errors.Error); ok {
 		c.Error = e.Err
@@ -124,12 +135,12 @@ func (c *Context) ServerError() {
 	c.Labels["status"] = "server_error"
 }
 
-func (c *Context) Observe(v float64) {
-	labels := make([]string, len(c.Metrics.TimerLabels))
-	for i, l := range c.Metrics.TimerLabels {
-		labels[i] = c.Labels[l]
+func (c *Context) observe(v float64) {
+	labels := make(Labels, len(c.Metrics.TimerLabels))
+	for _, l := range c.Metrics.TimerLabels {
+		labels[l] = c.Labels[l]
 	}
-	c.Metrics.Latency.WithLabelValues(labels...).Observe(v)
+	c.Metrics.Latency.ObserveWith(labels, v, c.request.Exemplar)
 }
 
 func (c *Context) writeLog(e *zerolog.Event) *zerolog.Event {
@@ -143,14 +154,45 @@ func (c *Context) writeLog(e *zerolog.Event) *zerolog.Event {
 			e.Str(l, c.Labels[l])
 		}
 	}
+	for k, v := range c.Fields {
+		if v != "" {
+			e.Str(k, v)
+		}
+	}
 
 	if c.Error != nil {
 		e.Err(c.Error)
 	}
 
+	if len(c.Timeline.Steps()) > 0 {
+		e.Array("timeline", c.Timeline)
+	}
+
 	return e
 }
 
+func (c *Context) auditFields() map[string]string {
+	fields := map[string]string{
+		"method":      c.Method,
+		"path":        c.Path,
+		"remote_addr": c.Remote,
+		"endpoint":    c.Metrics.Name,
+	}
+
+	for _, l := range c.Metrics.Labels {
+		if l != "method" && c.Labels[l] != "" {
+			fields[l] = c.Labels[l]
+		}
+	}
+	for k, v := range c.Fields {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+
+	return fields
+}
+
 func (c *Context) Close() error {
 	if c.Labels["status"] == "" && c.Labels["error"] != "" {
 		if c.Labels["error"] == "server_error" {
@@ -159,9 +201,18 @@ func (c *Context) Close() error {
 			c.ClientError()
 		}
 	}
-	c.Metrics.Count.With(c.Labels).Inc()
-	duration := c.timer.ObserveDuration()
-	c.timer = nil
+	if id := c.request.traceID(); id != "" {
+		c.Fields["trace_id"] = id
+	}
+	c.Metrics.Count.IncWith(c.Labels)
+	duration := time.Since(c.start)
+	c.observe(duration.Seconds())
+
+	fields := redact.Map(c.auditFields())
+	if err := audit.Record(fields); err != nil {
+		log.Error().Err(err).Msg("failed to write audit log")
+	}
+	events.Emit(events.TypeAudit, fields)
 
 	if c.Labels["error"] != "" {
 		c.writeLog(log.Error()).
@@ -175,20 +226,3 @@ func (c *Context) Close() error {
 
 	return nil
 }
-
-func Handler(username, password string) http.Handler {
-	handler := promhttp.Handler()
-	if username == "" {
-		return handler
-	} else {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			u, p, ok := r.BasicAuth()
-			if !ok || u != username || p != password {
-				w.Header().Set("WWW-Authenticate", "Basic realm=\"Prometheus Metrics\"")
-				w.WriteHeader(http.StatusUnauthorized)
-			} else {
-				handler.ServeHTTP(w, r)
-			}
-		})
-	}
-}
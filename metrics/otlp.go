@@ -0,0 +1,374 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP is a provider that pushes metrics to an OpenTelemetry collector, in OTLP/HTTP with JSON encoding.
+//
+// All metrics are cumulative, the same as Prometheus.
+type OTLP struct {
+	sync.Mutex
+
+	// OnError is called when failed to push metrics.
+	OnError func(error)
+
+	endpoint string
+	client   *http.Client
+	resource []otlpKeyValue
+	start    time.Time
+	descs    []*Desc
+	points   map[*Desc]map[string]*otlpPoint
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type otlpPoint struct {
+	Labels    Labels
+	Value     float64
+	Count     uint64
+	Buckets   []uint64
+	Exemplars []*otlpExemplar
+}
+
+// NewOTLP makes OTLP provider that pushes to the endpoint like "http://otel-collector:4318/v1/metrics".
+func NewOTLP(endpoint string, timeout time.Duration, version string) *OTLP {
+	return &OTLP{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout},
+		resource: []otlpKeyValue{
+			{Key: "service.name", Value: otlpAnyValue{StringValue: "lauth"}},
+			{Key: "service.version", Value: otlpAnyValue{StringValue: version}},
+		},
+		start:  time.Now(),
+		points: make(map[*Desc]map[string]*otlpPoint),
+	}
+}
+
+func (o *OTLP) Register(d *Desc) error {
+	o.Lock()
+	defer o.Unlock()
+
+	if _, ok := o.points[d]; !ok {
+		o.descs = append(o.descs, d)
+		o.points[d] = make(map[string]*otlpPoint)
+	}
+	return nil
+}
+
+func (o *OTLP) point(d *Desc, labels Labels) *otlpPoint {
+	ps, ok := o.points[d]
+	if !ok {
+		return nil
+	}
+
+	values := make([]string, len(d.Labels))
+	for i, l := range d.Labels {
+		values[i] = labels[l]
+	}
+	key := strings.Join(values, "\xff")
+
+	p, ok := ps[key]
+	if !ok {
+		p = &otlpPoint{Labels: labels}
+		if d.Kind == KindHistogram {
+			p.Buckets = make([]uint64, len(d.Buckets)+1)
+			p.Exemplars = make([]*otlpExemplar, len(d.Buckets)+1)
+		}
+		ps[key] = p
+	}
+	return p
+}
+
+func (o *OTLP) Add(d *Desc, labels Labels, value float64) {
+	o.Lock()
+	defer o.Unlock()
+
+	if p := o.point(d, labels); p != nil {
+		p.Value += value
+	}
+}
+
+func (o *OTLP) Set(d *Desc, labels Labels, value float64) {
+	o.Lock()
+	defer o.Unlock()
+
+	if p := o.point(d, labels); p != nil {
+		p.Value = value
+	}
+}
+
+func (o *OTLP) Observe(d *Desc, labels Labels, value float64, exemplar Exemplar) {
+	o.Lock()
+	defer o.Unlock()
+
+	p := o.point(d, labels)
+	if p == nil {
+		return
+	}
+
+	i := sort.SearchFloat64s(d.Buckets, value)
+	p.Value += value
+	p.Count++
+	p.Buckets[i]++
+	if exemplar.TraceID != "" {
+		p.Exemplars[i] = &otlpExemplar{
+			TimeUnixNano: otlpTime(time.Now()),
+			AsDouble:     value,
+			TraceID:      exemplar.TraceID,
+		}
+	}
+}
+
+// Export makes the request body of the current values.
+func (o *OTLP) Export() ([]byte, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	start := otlpTime(o.start)
+	now := otlpTime(time.Now())
+
+	metrics := make([]otlpMetric, 0, len(o.descs))
+	for _, d := range o.descs {
+		ps := o.points[d]
+		if len(ps) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(ps))
+		for k := range ps {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		m := otlpMetric{
+			Name:        d.FullName("."),
+			Description: d.Help,
+		}
+
+		switch d.Kind {
+		case KindCounter, KindGauge:
+			points := make([]otlpNumberPoint, len(keys))
+			for i, k := range keys {
+				points[i] = otlpNumberPoint{
+					Attributes:        otlpAttributes(ps[k].Labels),
+					StartTimeUnixNano: start,
+					TimeUnixNano:      now,
+					AsDouble:          ps[k].Value,
+				}
+			}
+			if d.Kind == KindCounter {
+				m.Sum = &otlpSum{DataPoints: points, AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			} else {
+				m.Gauge = &otlpGauge{DataPoints: points}
+			}
+
+		case KindHistogram:
+			points := make([]otlpHistogramPoint, len(keys))
+			for i, k := range keys {
+				p := ps[k]
+
+				buckets := make([]string, len(p.Buckets))
+				for j, b := range p.Buckets {
+					buckets[j] = strconv.FormatUint(b, 10)
+				}
+
+				var exemplars []otlpExemplar
+				for _, e := range p.Exemplars {
+					if e != nil {
+						exemplars = append(exemplars, *e)
+					}
+				}
+
+				points[i] = otlpHistogramPoint{
+					Attributes:        otlpAttributes(p.Labels),
+					StartTimeUnixNano: start,
+					TimeUnixNano:      now,
+					Count:             strconv.FormatUint(p.Count, 10),
+					Sum:               p.Value,
+					BucketCounts:      buckets,
+					ExplicitBounds:    d.Buckets,
+					Exemplars:         exemplars,
+				}
+			}
+			m.Histogram = &otlpHistogram{DataPoints: points, AggregationTemporality: otlpCumulative}
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	return json.Marshal(otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: o.resource},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "github.com/macrat/lauth/metrics"},
+				Metrics: metrics,
+			}},
+		}},
+	})
+}
+
+// Push sends the current values to the collector.
+func (o *OTLP) Push() error {
+	body, err := o.Export()
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.client.Post(o.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return fmt.Errorf("OTLP collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Start pushes metrics in the background each interval, until Close called.
+func (o *OTLP) Start(interval time.Duration) {
+	o.stop = make(chan struct{})
+	o.done = make(chan struct{})
+
+	go func() {
+		defer close(o.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				o.push()
+			case <-o.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops pushing in the background, and pushes the last values.
+func (o *OTLP) Close() error {
+	if o.stop != nil {
+		close(o.stop)
+		<-o.done
+		o.stop = nil
+	}
+	return o.Push()
+}
+
+func (o *OTLP) push() {
+	if err := o.Push(); err != nil && o.OnError != nil {
+		o.OnError(err)
+	}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpAttributes(labels Labels) []otlpKeyValue {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		kvs[i] = otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: labels[k]}}
+	}
+	return kvs
+}
+
+// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const otlpCumulative = 2
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type otlpNumberPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []string       `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+	Exemplars         []otlpExemplar `json:"exemplars,omitempty"`
+}
+
+type otlpExemplar struct {
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+	TraceID      string  `json:"traceId"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
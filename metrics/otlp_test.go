@@ -0,0 +1,102 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/metrics"
+)
+
+func TestOTLP(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	otlp := metrics.NewOTLP(srv.URL+"/v1/metrics", time.Second, "test")
+
+	counter := &metrics.Desc{Kind: metrics.KindCounter, Subsystem: "test", Name: "count", Labels: []string{"status"}}
+	histogram := &metrics.Desc{Kind: metrics.KindHistogram, Subsystem: "test", Name: "seconds", Labels: []string{"status"}, Buckets: []float64{0.1, 1}}
+	otlp.Register(counter)
+	otlp.Register(histogram)
+
+	otlp.Add(counter, metrics.Labels{"status": "success"}, 1)
+	otlp.Add(counter, metrics.Labels{"status": "success"}, 1)
+	otlp.Observe(histogram, metrics.Labels{"status": "success"}, 0.05, metrics.Exemplar{})
+	otlp.Observe(histogram, metrics.Labels{"status": "success"}, 0.5, metrics.Exemplar{TraceID: "0af7651916cd43dd8448eb211c80319c"})
+	otlp.Observe(histogram, metrics.Labels{"status": "success"}, 5, metrics.Exemplar{})
+
+	if err := otlp.Push(); err != nil {
+		t.Fatalf("failed to push: %s", err)
+	}
+
+	var req struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name string `json:"name"`
+					Sum  *struct {
+						DataPoints []struct {
+							AsDouble float64 `json:"asDouble"`
+						} `json:"dataPoints"`
+						IsMonotonic bool `json:"isMonotonic"`
+					} `json:"sum"`
+					Histogram *struct {
+						DataPoints []struct {
+							Count        string   `json:"count"`
+							BucketCounts []string `json:"bucketCounts"`
+							Exemplars    []struct {
+								AsDouble float64 `json:"asDouble"`
+								TraceID  string  `json:"traceId"`
+							} `json:"exemplars"`
+						} `json:"dataPoints"`
+					} `json:"histogram"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(<-bodies, &req); err != nil {
+		t.Fatalf("failed to parse pushed metrics: %s", err)
+	}
+
+	ms := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(ms) != 2 {
+		t.Fatalf("unexpected number of metrics: %d", len(ms))
+	}
+
+	if ms[0].Name != "lauth.test.count" || ms[0].Sum == nil || !ms[0].Sum.IsMonotonic || ms[0].Sum.DataPoints[0].AsDouble != 2 {
+		t.Errorf("unexpected counter: %#v", ms[0])
+	}
+
+	if ms[1].Name != "lauth.test.seconds" || ms[1].Histogram == nil {
+		t.Fatalf("unexpected histogram: %#v", ms[1])
+	}
+	p := ms[1].Histogram.DataPoints[0]
+	if p.Count != "3" || len(p.BucketCounts) != 3 || p.BucketCounts[0] != "1" || p.BucketCounts[1] != "1" || p.BucketCounts[2] != "1" {
+		t.Errorf("unexpected histogram data point: %#v", p)
+	}
+	if len(p.Exemplars) != 1 || p.Exemplars[0].TraceID != "0af7651916cd43dd8448eb211c80319c" || p.Exemplars[0].AsDouble != 0.5 {
+		t.Errorf("unexpected exemplars: %#v", p.Exemplars)
+	}
+}
+
+func TestOTLP_PushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	otlp := metrics.NewOTLP(srv.URL, time.Second, "test")
+	if err := otlp.Push(); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
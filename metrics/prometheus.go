@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/macrat/lauth/secret"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus is a provider that exports metrics on the Prometheus endpoint.
+//
+// Exemplars are exported only if the scraper accepts OpenMetrics format.
+type Prometheus struct {
+	sync.RWMutex
+
+	registerer prometheus.Registerer
+	collectors map[*Desc]prometheus.Collector
+}
+
+// DefaultPrometheus is the provider that registered to the default registry of Prometheus. It is the provider in default.
+var DefaultPrometheus = NewPrometheus(prometheus.DefaultRegisterer)
+
+func init() {
+	if err := SetProvider(DefaultPrometheus); err != nil {
+		panic(err)
+	}
+}
+
+func NewPrometheus(registerer prometheus.Registerer) *Prometheus {
+	return &Prometheus{
+		registerer: registerer,
+		collectors: make(map[*Desc]prometheus.Collector),
+	}
+}
+
+func (p *Prometheus) Register(d *Desc) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.collectors[d]; ok {
+		return nil
+	}
+
+	var c prometheus.Collector
+	switch d.Kind {
+	case KindCounter:
+		c = prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: NAMESPACE, Subsystem: d.Subsystem, Name: d.Name, Help: d.Help}, d.Labels)
+	case KindGauge:
+		c = prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: NAMESPACE, Subsystem: d.Subsystem, Name: d.Name, Help: d.Help}, d.Labels)
+	case KindHistogram:
+		c = prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: NAMESPACE, Subsystem: d.Subsystem, Name: d.Name, Help: d.Help, Buckets: d.Buckets}, d.Labels)
+	default:
+		return fmt.Errorf("unknown kind of metric: %s", d.FullName("_"))
+	}
+
+	if err := p.registerer.Register(c); err != nil {
+		return err
+	}
+	p.collectors[d] = c
+	return nil
+}
+
+// Collector returns the collector of the metric, or nil if not registered.
+func (p *Prometheus) Collector(d *Desc) prometheus.Collector {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.collectors[d]
+}
+
+func (p *Prometheus) Add(d *Desc, labels Labels, value float64) {
+	switch c := p.Collector(d).(type) {
+	case *prometheus.CounterVec:
+		c.With(prometheus.Labels(labels)).Add(value)
+	case *prometheus.GaugeVec:
+		c.With(prometheus.Labels(labels)).Add(value)
+	}
+}
+
+func (p *Prometheus) Set(d *Desc, labels Labels, value float64) {
+	if c, ok := p.Collector(d).(*prometheus.GaugeVec); ok {
+		c.With(prometheus.Labels(labels)).Set(value)
+	}
+}
+
+func (p *Prometheus) Observe(d *Desc, labels Labels, value float64, exemplar Exemplar) {
+	c, ok := p.Collector(d).(*prometheus.HistogramVec)
+	if !ok {
+		return
+	}
+
+	o := c.With(prometheus.Labels(labels))
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && exemplar.TraceID != "" {
+		eo.ObserveWithExemplar(value, prometheus.Labels{"trace_id": exemplar.TraceID})
+	} else {
+		o.Observe(value)
+	}
+}
+
+// Handler returns the Prometheus endpoint of the default registry.
+func Handler(username, password string) http.Handler {
+	handler := promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	)
+	if username == "" {
+		return handler
+	} else {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, p, ok := r.BasicAuth()
+			if !ok || !secret.Equal(u, username) || !secret.Equal(p, password) {
+				w.Header().Set("WWW-Authenticate", "Basic realm=\"Prometheus Metrics\"")
+				w.WriteHeader(http.StatusUnauthorized)
+			} else {
+				handler.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPrometheus_Exemplar(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	p := metrics.NewPrometheus(registry)
+
+	desc := &metrics.Desc{Kind: metrics.KindHistogram, Subsystem: "test", Name: "seconds", Labels: []string{"status"}, Buckets: []float64{0.1, 1}}
+	if err := p.Register(desc); err != nil {
+		t.Fatalf("failed to register: %s", err)
+	}
+
+	p.Observe(desc, metrics.Labels{"status": "success"}, 0.5, metrics.Exemplar{TraceID: "0af7651916cd43dd8448eb211c80319c"})
+	p.Observe(desc, metrics.Labels{"status": "success"}, 0.05, metrics.Exemplar{})
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "lauth_test_seconds" {
+		t.Fatalf("unexpected metrics: %v", families)
+	}
+
+	h := families[0].GetMetric()[0].GetHistogram()
+	if h.GetSampleCount() != 2 {
+		t.Errorf("unexpected sample count: %d", h.GetSampleCount())
+	}
+
+	ex := h.GetBucket()[1].GetExemplar()
+	if ex == nil || len(ex.GetLabel()) != 1 || ex.GetLabel()[0].GetName() != "trace_id" || ex.GetLabel()[0].GetValue() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("unexpected exemplar: %v", ex)
+	}
+	if ex := h.GetBucket()[0].GetExemplar(); ex != nil {
+		t.Errorf("unexpected exemplar for the request without trace: %v", ex)
+	}
+}
@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kind is the type of a metric.
+type Kind int
+
+const (
+	KindCounter Kind = iota
+	KindGauge
+	KindHistogram
+)
+
+// LatencyBuckets is the upper bounds of histogram buckets for latencies in seconds.
+var LatencyBuckets = prometheus.DefBuckets
+
+// Desc describes a metric that lauth records.
+type Desc struct {
+	Kind      Kind
+	Subsystem string
+	Name      string
+	Help      string
+	Labels    []string
+
+	// Buckets is the upper bounds of buckets. It is used only for histograms.
+	Buckets []float64
+}
+
+// FullName returns the name joined with the namespace and subsystem by sep, like "lauth_authz_seconds".
+func (d *Desc) FullName(sep string) string {
+	if d.Subsystem == "" {
+		return strings.Join([]string{NAMESPACE, d.Name}, sep)
+	}
+	return strings.Join([]string{NAMESPACE, d.Subsystem, d.Name}, sep)
+}
+
+func (d *Desc) labels(values []string) Labels {
+	ls := make(Labels, len(d.Labels))
+	for i, l := range d.Labels {
+		if i < len(values) {
+			ls[l] = values[i]
+		} else {
+			ls[l] = ""
+		}
+	}
+	return ls
+}
+
+// Labels is label names and values of a measurement.
+type Labels map[string]string
+
+// Exemplar is a reference to the trace that a measurement came from.
+type Exemplar struct {
+	// TraceID is the W3C trace ID in hex, or empty if the request has no trace.
+	TraceID string
+}
+
+// Provider is a backend that receives measurements, like Prometheus or OpenTelemetry.
+//
+// Labels passed to the provider always have every label in Desc.Labels.
+type Provider interface {
+	// Register declares the metric. It is called once for each metric before recording.
+	Register(d *Desc) error
+
+	// Add adds the value to a counter or a gauge.
+	Add(d *Desc, labels Labels, value float64)
+
+	// Set sets the value of a gauge.
+	Set(d *Desc, labels Labels, value float64)
+
+	// Observe records the value to a histogram, and links it to the exemplar if the provider supports.
+	Observe(d *Desc, labels Labels, value float64, exemplar Exemplar)
+}
+
+type providerHolder struct {
+	Provider
+}
+
+var (
+	descsLock sync.Mutex
+	descs     []*Desc
+	current   atomic.Value
+)
+
+func currentProvider() Provider {
+	if p, ok := current.Load().(providerHolder); ok {
+		return p.Provider
+	}
+	return Noop{}
+}
+
+// SetProvider sets the backend to record metrics, and registers all metrics to it.
+//
+// It should be called before serving, because measurements before it went to the previous provider.
+func SetProvider(p Provider) error {
+	descsLock.Lock()
+	defer descsLock.Unlock()
+
+	for _, d := range descs {
+		if err := p.Register(d); err != nil {
+			return err
+		}
+	}
+	current.Store(providerHolder{p})
+	return nil
+}
+
+func newDesc(d *Desc) *Desc {
+	descsLock.Lock()
+	defer descsLock.Unlock()
+
+	descs = append(descs, d)
+	if p, ok := current.Load().(providerHolder); ok {
+		if err := p.Register(d); err != nil {
+			panic(err)
+		}
+	}
+	return d
+}
+
+// Counter is a metric that only goes up.
+type Counter struct {
+	Desc *Desc
+}
+
+func NewCounter(subsystem, name, help string, labels ...string) *Counter {
+	return &Counter{newDesc(&Desc{Kind: KindCounter, Subsystem: subsystem, Name: name, Help: help, Labels: labels})}
+}
+
+// Inc increments the counter of the label values in the order of Desc.Labels.
+func (c *Counter) Inc(labelValues ...string) {
+	c.IncWith(c.Desc.labels(labelValues))
+}
+
+func (c *Counter) IncWith(labels Labels) {
+	currentProvider().Add(c.Desc, labels, 1)
+}
+
+// Gauge is a metric that goes up and down.
+type Gauge struct {
+	Desc *Desc
+}
+
+func NewGauge(subsystem, name, help string, labels ...string) *Gauge {
+	return &Gauge{newDesc(&Desc{Kind: KindGauge, Subsystem: subsystem, Name: name, Help: help, Labels: labels})}
+}
+
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	currentProvider().Add(g.Desc, g.Desc.labels(labelValues), value)
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	currentProvider().Set(g.Desc, g.Desc.labels(labelValues), value)
+}
+
+// Histogram is a metric that counts distribution of values, like latencies.
+type Histogram struct {
+	Desc *Desc
+}
+
+func NewHistogram(subsystem, name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{newDesc(&Desc{Kind: KindHistogram, Subsystem: subsystem, Name: name, Help: help, Labels: labels, Buckets: buckets})}
+}
+
+func (h *Histogram) Observe(value float64, exemplar Exemplar, labelValues ...string) {
+	h.ObserveWith(h.Desc.labels(labelValues), value, exemplar)
+}
+
+func (h *Histogram) ObserveWith(labels Labels, value float64, exemplar Exemplar) {
+	currentProvider().Observe(h.Desc, labels, value, exemplar)
+}
+
+// Noop is a provider that discards all measurements, for --metrics-provider=none.
+type Noop struct{}
+
+func (Noop) Register(d *Desc) error                                    { return nil }
+func (Noop) Add(d *Desc, labels Labels, value float64)                 {}
+func (Noop) Set(d *Desc, labels Labels, value float64)                 {}
+func (Noop) Observe(d *Desc, labels Labels, value float64, _ Exemplar) {}
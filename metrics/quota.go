@@ -0,0 +1,10 @@
+package metrics
+
+var (
+	QuotaExceeded = NewCounter(
+		"token",
+		"quota_exceeded_count",
+		"The count of token issuances that rejected by --tokens-per-subject or --tokens-per-client.",
+		"quota",
+	)
+)
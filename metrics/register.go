@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Register = NewEndpointMetrics(
+		"register",
+		[]string{"method", "step", "username"},
+		[]string{"method", "step"},
+	)
+)
+
+func StartRegister(c *gin.Context) *Context {
+	return Register.Start(GinRequest(c))
+}
@@ -0,0 +1,16 @@
+package metrics
+
+var (
+	InFlight = NewGauge(
+		"http",
+		"in_flight_requests",
+		"The number of requests that processing now.",
+	)
+
+	Shed = NewCounter(
+		"http",
+		"shed_count",
+		"The count of requests that rejected by --max-concurrent-requests.",
+		"method", "path",
+	)
+)
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// TimelineStep is a step of the request, with the time since the request started.
+type TimelineStep struct {
+	Name     string
+	Start    time.Duration
+	Duration time.Duration
+}
+
+func (s TimelineStep) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("step", s.Name)
+	e.Float64("start_seconds", s.Start.Seconds())
+	e.Float64("seconds", s.Duration.Seconds())
+}
+
+// Timeline records steps of the request to find which step makes the request slow.
+// Steps can be recorded from multiple goroutines, because some steps run in parallel.
+type Timeline struct {
+	sync.Mutex
+
+	start time.Time
+	steps []TimelineStep
+}
+
+func NewTimeline() *Timeline {
+	return &Timeline{start: time.Now()}
+}
+
+// Step starts a step, and returns the function to end it.
+// It does nothing if the timeline is nil, so callers don't have to check whether the timeline is enabled.
+func (t *Timeline) Step(name string) (end func()) {
+	if t == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		t.Lock()
+		defer t.Unlock()
+
+		t.steps = append(t.steps, TimelineStep{
+			Name:     name,
+			Start:    start.Sub(t.start),
+			Duration: time.Since(start),
+		})
+	}
+}
+
+// Steps returns the ended steps in the order of ended.
+func (t *Timeline) Steps() []TimelineStep {
+	if t == nil {
+		return nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	steps := make([]TimelineStep, len(t.steps))
+	copy(steps, t.steps)
+	return steps
+}
+
+func (t *Timeline) MarshalZerologArray(a *zerolog.Array) {
+	for _, s := range t.Steps() {
+		a.Object(s)
+	}
+}
+
+// timelineEnabled reports whether the timeline should be recorded.
+// It is only in the debug mode, because it makes logs large.
+func timelineEnabled() bool {
+	return zerolog.GlobalLevel() <= zerolog.DebugLevel
+}
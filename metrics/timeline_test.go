@@ -0,0 +1,50 @@
+package metrics_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/metrics"
+)
+
+func TestTimeline(t *testing.T) {
+	tl := metrics.NewTimeline()
+
+	end := tl.Step("ldap_bind")
+	time.Sleep(10 * time.Millisecond)
+	end()
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"sign_code", "sign_access_token"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer tl.Step(name)()
+		}(name)
+	}
+	wg.Wait()
+
+	steps := tl.Steps()
+	if len(steps) != 3 {
+		t.Fatalf("expected 3 steps but got %#v", steps)
+	}
+	if steps[0].Name != "ldap_bind" || steps[0].Duration < 10*time.Millisecond {
+		t.Errorf("unexpected first step: %#v", steps[0])
+	}
+	for _, s := range steps[1:] {
+		if s.Start < steps[0].Duration {
+			t.Errorf("step %s should start after ldap_bind: %#v", s.Name, s)
+		}
+	}
+}
+
+func TestTimeline_Nil(t *testing.T) {
+	var tl *metrics.Timeline
+
+	tl.Step("parse")()
+
+	if steps := tl.Steps(); steps != nil {
+		t.Errorf("nil timeline should have no steps: %#v", steps)
+	}
+}
@@ -12,10 +12,6 @@ var (
 	)
 )
 
-func init() {
-	Token.MustRegister()
-}
-
 func StartToken(c *gin.Context) *Context {
-	return Token.Start(c)
+	return Token.Start(GinRequest(c))
 }
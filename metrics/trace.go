@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const traceIDKey = "lauth.trace_id"
+
+var (
+	traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+	requestIDPattern   = regexp.MustCompile(`^[0-9A-Za-z._:-]{1,128}$`)
+)
+
+// traceParent returns the trace-id in the traceparent header, or empty if not valid.
+func traceParent(header string) string {
+	if m := traceparentPattern.FindStringSubmatch(header); m != nil && m[1] != "00000000000000000000000000000000" {
+		return m[1]
+	}
+	return ""
+}
+
+// TraceID returns the ID to find the logs of the request.
+// It uses the trace-id of traceparent header or X-Request-Id header if set, or generates a new one.
+// Once called, the ID is included in the log of the request.
+func TraceID(c *gin.Context) string {
+	if id := c.GetString(traceIDKey); id != "" {
+		return id
+	}
+
+	id := uuid.New().String()
+	if tp := traceParent(c.GetHeader("traceparent")); tp != "" {
+		id = tp
+	} else if rid := c.GetHeader("X-Request-Id"); requestIDPattern.MatchString(rid) {
+		id = rid
+	}
+
+	c.Set(traceIDKey, id)
+	return id
+}
+
+// Request is the information of an HTTP request, that metrics and logs need.
+type Request struct {
+	Method string
+	Path   string
+	Remote string
+
+	// Exemplar links the latency of the request to the trace in the traceparent header.
+	Exemplar Exemplar
+
+	// TraceID returns the ID that assigned by TraceID, or empty if not assigned. It can be nil.
+	TraceID func() string
+}
+
+// NewRequest makes Request from the request of net/http.
+func NewRequest(r *http.Request) Request {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+
+	return Request{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Remote:   remote,
+		Exemplar: Exemplar{TraceID: traceParent(r.Header.Get("traceparent"))},
+	}
+}
+
+// GinRequest makes Request from the context of gin.
+func GinRequest(c *gin.Context) Request {
+	r := NewRequest(c.Request)
+	r.Remote = c.ClientIP()
+	r.TraceID = func() string {
+		return c.GetString(traceIDKey)
+	}
+	return r
+}
+
+func (r Request) traceID() string {
+	if r.TraceID == nil {
+		return ""
+	}
+	return r.TraceID()
+}
@@ -12,12 +12,8 @@ var (
 	)
 )
 
-func init() {
-	Userinfo.MustRegister()
-}
-
 func StartUserinfo(ctx *gin.Context) *Context {
-	c := Userinfo.Start(ctx)
+	c := Userinfo.Start(GinRequest(ctx))
 	c.Set("method", ctx.Request.Method)
 	return c
 }
@@ -0,0 +1,137 @@
+package mfa
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/macrat/lauth/config"
+)
+
+// Duo is a provider that uses Auth API of Duo Security.
+//
+// With the "push" factor, Start sends a push notification to the user's device and waits for approval.
+// With the "passcode" factor, the user types a passcode from Duo Mobile or a hardware token.
+type Duo struct {
+	Host           string
+	IntegrationKey string
+	SecretKey      string
+	Factor         string
+	Timeout        time.Duration
+
+	// Client is used to call the API. http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+// DuoDefaultTimeout is the timeout if not set. It is longer than the push notification waits.
+const DuoDefaultTimeout = 75 * time.Second
+
+type duoResponse struct {
+	Stat     string `json:"stat"`
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	Response struct {
+		Result    string `json:"result"`
+		Status    string `json:"status"`
+		StatusMsg string `json:"status_msg"`
+	} `json:"response"`
+}
+
+// DuoSignature makes the value of Authorization header of the Auth API request.
+func DuoSignature(integrationKey, secretKey, date, method, host, path string, params url.Values) string {
+	canonical := strings.Join([]string{
+		date,
+		strings.ToUpper(method),
+		strings.ToLower(host),
+		path,
+		strings.ReplaceAll(params.Encode(), "+", "%20"),
+	}, "\n")
+
+	mac := hmac.New(sha1.New, []byte(secretKey))
+	mac.Write([]byte(canonical))
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	req := http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(integrationKey, sig)
+	return req.Header.Get("Authorization")
+}
+
+func (d *Duo) auth(ctx context.Context, params url.Values) error {
+	ctx, cancel := withTimeout(ctx, d.Timeout, DuoDefaultTimeout)
+	defer cancel()
+
+	const path = "/auth/v2/auth"
+	date := time.Now().UTC().Format(time.RFC1123Z)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://"+d.Host+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Date", date)
+	req.Header.Set("Authorization", DuoSignature(d.IntegrationKey, d.SecretKey, date, "POST", d.Host, path, params))
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result duoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to parse response of Duo: %w", err)
+	}
+
+	if result.Stat != "OK" {
+		return fmt.Errorf("Duo responded error %d: %s", result.Code, result.Message)
+	}
+	if result.Response.Result != "allow" {
+		return DeniedError
+	}
+	return nil
+}
+
+func (d *Duo) params(username, remoteAddr string) url.Values {
+	params := url.Values{
+		"username": {username},
+	}
+	if remoteAddr != "" {
+		params.Set("ipaddr", remoteAddr)
+	}
+	return params
+}
+
+func (d *Duo) Start(ctx context.Context, username, remoteAddr string) (*Challenge, error) {
+	if d.Factor == config.MFAFactorPasscode {
+		return &Challenge{Message: "Enter a passcode from Duo Mobile or your token."}, nil
+	}
+
+	params := d.params(username, remoteAddr)
+	params.Set("factor", "push")
+	params.Set("device", "auto")
+	if err := d.auth(ctx, params); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (d *Duo) Verify(ctx context.Context, username, remoteAddr string, challenge Challenge, answer string) (*Challenge, error) {
+	params := d.params(username, remoteAddr)
+	params.Set("factor", "passcode")
+	params.Set("passcode", answer)
+	if err := d.auth(ctx, params); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,125 @@
+package mfa_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/mfa"
+)
+
+func TestDuoSignature(t *testing.T) {
+	// The example of Duo's document.
+	got := mfa.DuoSignature(
+		"DIWJ8X6AEYOR5OMC6TQ1",
+		"Zh5eGmUq9zpfQnyUIu5OL9iWoMMv5ZNmk3zLJ4Ep",
+		"Tue, 21 Aug 2012 17:29:18 -0000",
+		"POST",
+		"api-XXXXXXXX.duosecurity.com",
+		"/accounts/v1/account/list",
+		url.Values{"realname": {"First Last"}, "username": {"root"}},
+	)
+	want := "Basic RElXSjhYNkFFWU9SNU9NQzZUUTE6MmQ5N2Q2MTY2MzE5NzgxYjVhM2EwN2FmMzlkMzY2ZjQ5MTIzNGVkYw=="
+	if got != want {
+		t.Errorf("unexpected signature:\nwant: %s\n got: %s", want, got)
+	}
+}
+
+type DummyDuo struct {
+	*httptest.Server
+
+	Requests []url.Values
+	Result   string
+}
+
+func NewDummyDuo(t *testing.T) *DummyDuo {
+	d := &DummyDuo{Result: "allow"}
+	d.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse request: %s", err)
+		}
+
+		host := strings.TrimPrefix(d.URL, "https://")
+		sign := mfa.DuoSignature("ikey", "skey", r.Header.Get("Date"), r.Method, host, r.URL.Path, r.PostForm)
+		if r.URL.Path != "/auth/v2/auth" || r.Header.Get("Authorization") != sign {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"stat": "FAIL", "code": 40101, "message": "Missing request credentials"})
+			return
+		}
+		d.Requests = append(d.Requests, r.PostForm)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"stat": "OK",
+			"response": map[string]string{
+				"result": d.Result,
+			},
+		})
+	}))
+	t.Cleanup(d.Close)
+	return d
+}
+
+func (d *DummyDuo) Provider(factor string) *mfa.Duo {
+	return &mfa.Duo{
+		Host:           strings.TrimPrefix(d.URL, "https://"),
+		IntegrationKey: "ikey",
+		SecretKey:      "skey",
+		Factor:         factor,
+		Client:         d.Client(),
+	}
+}
+
+func TestDuo_Push(t *testing.T) {
+	d := NewDummyDuo(t)
+	p := d.Provider("push")
+
+	if c, err := p.Start(context.Background(), "macrat", "192.0.2.1"); err != nil || c != nil {
+		t.Fatalf("approved push should verify without challenge: %v %v", c, err)
+	}
+	if len(d.Requests) != 1 {
+		t.Fatalf("expected 1 request but got %d", len(d.Requests))
+	}
+	req := d.Requests[0]
+	if req.Get("username") != "macrat" || req.Get("factor") != "push" || req.Get("device") != "auto" || req.Get("ipaddr") != "192.0.2.1" {
+		t.Errorf("unexpected request: %v", req)
+	}
+
+	d.Result = "deny"
+	if _, err := p.Start(context.Background(), "macrat", "192.0.2.1"); err != mfa.DeniedError {
+		t.Errorf("expected denied but got %v", err)
+	}
+
+	p.SecretKey = "wrong"
+	if _, err := p.Start(context.Background(), "macrat", "192.0.2.1"); err == nil || err == mfa.DeniedError {
+		t.Errorf("expected API error but got %v", err)
+	}
+}
+
+func TestDuo_Passcode(t *testing.T) {
+	d := NewDummyDuo(t)
+	p := d.Provider("passcode")
+
+	c, err := p.Start(context.Background(), "macrat", "192.0.2.1")
+	if err != nil || c == nil || c.Message == "" {
+		t.Fatalf("passcode factor should ask passcode: %v %v", c, err)
+	}
+	if len(d.Requests) != 0 {
+		t.Fatalf("Start of passcode factor should not call API")
+	}
+
+	if next, err := p.Verify(context.Background(), "macrat", "192.0.2.1", *c, "123456"); err != nil || next != nil {
+		t.Fatalf("failed to verify: %v %v", next, err)
+	}
+	if req := d.Requests[0]; req.Get("factor") != "passcode" || req.Get("passcode") != "123456" {
+		t.Errorf("unexpected request: %v", req)
+	}
+
+	d.Result = "deny"
+	if _, err := p.Verify(context.Background(), "macrat", "192.0.2.1", *c, "000000"); err != mfa.DeniedError {
+		t.Errorf("expected denied but got %v", err)
+	}
+}
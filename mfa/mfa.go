@@ -0,0 +1,81 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/macrat/lauth/config"
+)
+
+var (
+	// DeniedError means the user failed or rejected the second factor.
+	DeniedError = errors.New("denied by MFA provider")
+)
+
+// Challenge is a prompt of the second factor that the user has to answer on the login page.
+type Challenge struct {
+	// Message is the text to show to the user, like "Enter the code from your authenticator".
+	Message string
+
+	// State is the opaque value to pass to Verify with the answer, to continue the same challenge-response session.
+	State string
+}
+
+// Provider is a second factor of authentication that checked after the password.
+type Provider interface {
+	// Start begins the second factor for the user who just entered the correct password.
+	//
+	// It returns nil Challenge if the user is verified without any input, like an approved push notification.
+	Start(ctx context.Context, username, remoteAddr string) (*Challenge, error)
+
+	// Verify checks the answer for the challenge.
+	//
+	// It returns nil Challenge if verified, or the next Challenge if the provider asks another answer.
+	// DeniedError is returned if the answer is wrong.
+	Verify(ctx context.Context, username, remoteAddr string, challenge Challenge, answer string) (*Challenge, error)
+}
+
+// New makes the Provider from the config.
+func New(conf config.MFAProviderConfig) (Provider, error) {
+	switch conf.Type {
+	case config.MFADuo:
+		return &Duo{
+			Host:           conf.Host,
+			IntegrationKey: conf.IntegrationKey,
+			SecretKey:      conf.SecretKey,
+			Factor:         conf.Factor,
+			Timeout:        conf.Timeout.Duration(),
+		}, nil
+	case config.MFARADIUS:
+		return &RADIUS{
+			Server:        conf.Server,
+			Secret:        conf.Secret,
+			NASIdentifier: conf.NASIdentifier,
+			Timeout:       conf.Timeout.Duration(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown type of MFA provider: %#v", conf.Type)
+	}
+}
+
+// NewSet makes all providers in the config, by name.
+func NewSet(conf config.MFAConfig) (map[string]Provider, error) {
+	ps := make(map[string]Provider, len(conf.Providers))
+	for name, c := range conf.Providers {
+		p, err := New(c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		ps[name] = p
+	}
+	return ps, nil
+}
+
+func withTimeout(ctx context.Context, timeout, fallback time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = fallback
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,297 @@
+package mfa
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// RADIUS is a provider that asks one-time passwords to a RADIUS server, like privacyIDEA, FreeRADIUS with an OTP module, or RSA Authentication Manager.
+//
+// Access-Challenge from the server is shown to the user as the next challenge, so the server can use challenge-response like SMS or email OTP.
+type RADIUS struct {
+	// Server is the address of the RADIUS server like "radius.example.com:1812".
+	Server        string
+	Secret        string
+	NASIdentifier string
+	Timeout       time.Duration
+}
+
+// RADIUSDefaultTimeout is the timeout if not set.
+const RADIUSDefaultTimeout = 10 * time.Second
+
+// radiusRetransmit is the interval to send the request again if no response, because RADIUS is on UDP.
+const radiusRetransmit = 2 * time.Second
+
+const (
+	radiusAccessRequest   = 1
+	radiusAccessAccept    = 2
+	radiusAccessReject    = 3
+	radiusAccessChallenge = 11
+
+	radiusUserName             = 1
+	radiusUserPassword         = 2
+	radiusReplyMessage         = 18
+	radiusState                = 24
+	radiusNASIdentifier        = 32
+	radiusMessageAuthenticator = 80
+)
+
+var (
+	radiusInvalidResponse = errors.New("invalid response from RADIUS server")
+)
+
+type radiusAttribute struct {
+	Type  byte
+	Value []byte
+}
+
+type radiusPacket struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [16]byte
+	Attributes    []radiusAttribute
+}
+
+func (p radiusPacket) Get(typ byte) []byte {
+	for _, a := range p.Attributes {
+		if a.Type == typ {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func (p radiusPacket) Encode() ([]byte, error) {
+	buf := make([]byte, 20, 4096)
+	buf[0] = p.Code
+	buf[1] = p.Identifier
+	copy(buf[4:20], p.Authenticator[:])
+	for _, a := range p.Attributes {
+		if len(a.Value) > 253 {
+			return nil, fmt.Errorf("too long RADIUS attribute: %d", a.Type)
+		}
+		buf = append(buf, a.Type, byte(len(a.Value)+2))
+		buf = append(buf, a.Value...)
+	}
+	if len(buf) > 4096 {
+		return nil, errors.New("too long RADIUS packet")
+	}
+	binary.BigEndian.PutUint16(buf[2:4], uint16(len(buf)))
+	return buf, nil
+}
+
+func decodeRADIUS(raw []byte) (radiusPacket, error) {
+	if len(raw) < 20 {
+		return radiusPacket{}, radiusInvalidResponse
+	}
+	length := int(binary.BigEndian.Uint16(raw[2:4]))
+	if length < 20 || len(raw) < length {
+		return radiusPacket{}, radiusInvalidResponse
+	}
+
+	p := radiusPacket{Code: raw[0], Identifier: raw[1]}
+	copy(p.Authenticator[:], raw[4:20])
+	for rest := raw[20:length]; len(rest) > 0; {
+		if len(rest) < 2 || int(rest[1]) < 2 || len(rest) < int(rest[1]) {
+			return radiusPacket{}, radiusInvalidResponse
+		}
+		p.Attributes = append(p.Attributes, radiusAttribute{Type: rest[0], Value: rest[2:rest[1]]})
+		rest = rest[rest[1]:]
+	}
+	return p, nil
+}
+
+// radiusHidePassword encrypts User-Password in the way of RFC 2865 section 5.2.
+func radiusHidePassword(password []byte, secret string, authenticator [16]byte) []byte {
+	padded := make([]byte, (len(password)+15)/16*16)
+	if len(padded) == 0 {
+		padded = make([]byte, 16)
+	}
+	copy(padded, password)
+
+	result := make([]byte, len(padded))
+	prev := authenticator[:]
+	for i := 0; i < len(padded); i += 16 {
+		h := md5.Sum(append([]byte(secret), prev...))
+		for j := 0; j < 16; j++ {
+			result[i+j] = padded[i+j] ^ h[j]
+		}
+		prev = result[i : i+16]
+	}
+	return result
+}
+
+// radiusMessageAuthenticatorOf calculates Message-Authenticator of RFC 3579, for the packet that has the attribute filled with zero.
+func radiusMessageAuthenticatorOf(raw []byte, secret string) []byte {
+	mac := hmac.New(md5.New, []byte(secret))
+	mac.Write(raw)
+	return mac.Sum(nil)
+}
+
+// signRADIUS fills Message-Authenticator of the encoded packet.
+func signRADIUS(raw []byte, secret string) {
+	for i := 20; i+2 <= len(raw); i += int(raw[i+1]) {
+		if raw[i] == radiusMessageAuthenticator {
+			copy(raw[i+2:i+18], radiusMessageAuthenticatorOf(raw, secret))
+			return
+		}
+	}
+}
+
+// verifyRADIUSResponse checks Response Authenticator and Message-Authenticator of the response, for the request that has requestAuth.
+// Responses without Message-Authenticator are rejected, because Response Authenticator alone can be forged by MD5 collision (Blast-RADIUS, CVE-2024-3596).
+func verifyRADIUSResponse(raw []byte, secret string, requestAuth [16]byte) bool {
+	length := int(binary.BigEndian.Uint16(raw[2:4]))
+	if length < 20 || len(raw) < length {
+		return false
+	}
+	raw = raw[:length]
+
+	h := md5.New()
+	h.Write(raw[:4])
+	h.Write(requestAuth[:])
+	h.Write(raw[20:])
+	h.Write([]byte(secret))
+	if !hmac.Equal(h.Sum(nil), raw[4:20]) {
+		return false
+	}
+
+	buf := make([]byte, len(raw))
+	copy(buf, raw)
+	copy(buf[4:20], requestAuth[:])
+	for i := 20; i+2 <= len(buf); i += int(buf[i+1]) {
+		if buf[i+1] < 2 || len(buf) < i+int(buf[i+1]) {
+			return false
+		}
+		if buf[i] == radiusMessageAuthenticator && buf[i+1] == 18 {
+			got := make([]byte, 16)
+			copy(got, buf[i+2:i+18])
+			for j := i + 2; j < i+18; j++ {
+				buf[j] = 0
+			}
+			return hmac.Equal(got, radiusMessageAuthenticatorOf(buf, secret))
+		}
+	}
+	return false
+}
+
+func (r *RADIUS) exchange(ctx context.Context, req radiusPacket) (radiusPacket, error) {
+	ctx, cancel := withTimeout(ctx, r.Timeout, RADIUSDefaultTimeout)
+	defer cancel()
+
+	raw, err := req.Encode()
+	if err != nil {
+		return radiusPacket{}, err
+	}
+	signRADIUS(raw, r.Secret)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", r.Server)
+	if err != nil {
+		return radiusPacket{}, err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	buf := make([]byte, 4096)
+	for {
+		if _, err := conn.Write(raw); err != nil {
+			return radiusPacket{}, err
+		}
+
+		next := time.Now().Add(radiusRetransmit)
+		if next.After(deadline) {
+			next = deadline
+		}
+		conn.SetReadDeadline(next)
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() && time.Now().Before(deadline) {
+					break
+				}
+				return radiusPacket{}, err
+			}
+
+			if n < 20 || buf[1] != req.Identifier || !verifyRADIUSResponse(buf[:n], r.Secret, req.Authenticator) {
+				continue
+			}
+			return decodeRADIUS(buf[:n])
+		}
+	}
+}
+
+func (r *RADIUS) Start(ctx context.Context, username, remoteAddr string) (*Challenge, error) {
+	return &Challenge{Message: "Enter your one-time password."}, nil
+}
+
+func (r *RADIUS) Verify(ctx context.Context, username, remoteAddr string, challenge Challenge, answer string) (*Challenge, error) {
+	req := radiusPacket{Code: radiusAccessRequest}
+
+	var random [17]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return nil, err
+	}
+	req.Identifier = random[0]
+	copy(req.Authenticator[:], random[1:])
+
+	if len(answer) > 128 {
+		return nil, DeniedError
+	}
+
+	req.Attributes = []radiusAttribute{
+		{radiusMessageAuthenticator, make([]byte, 16)},
+		{radiusUserName, []byte(username)},
+		{radiusUserPassword, radiusHidePassword([]byte(answer), r.Secret, req.Authenticator)},
+	}
+	if r.NASIdentifier != "" {
+		req.Attributes = append(req.Attributes, radiusAttribute{radiusNASIdentifier, []byte(r.NASIdentifier)})
+	}
+	if challenge.State != "" {
+		state, err := base64.RawURLEncoding.DecodeString(challenge.State)
+		if err != nil {
+			return nil, DeniedError
+		}
+		req.Attributes = append(req.Attributes, radiusAttribute{radiusState, state})
+	}
+
+	resp, err := r.exchange(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.Code {
+	case radiusAccessAccept:
+		return nil, nil
+	case radiusAccessReject:
+		return nil, DeniedError
+	case radiusAccessChallenge:
+		var messages []string
+		for _, a := range resp.Attributes {
+			if a.Type == radiusReplyMessage {
+				messages = append(messages, string(a.Value))
+			}
+		}
+		next := &Challenge{
+			Message: strings.Join(messages, "\n"),
+			State:   base64.RawURLEncoding.EncodeToString(resp.Get(radiusState)),
+		}
+		if next.Message == "" {
+			next.Message = challenge.Message
+		}
+		return next, nil
+	default:
+		return nil, fmt.Errorf("unexpected response code from RADIUS server: %d", resp.Code)
+	}
+}
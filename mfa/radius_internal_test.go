@@ -0,0 +1,182 @@
+package mfa
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"net"
+	"testing"
+	"time"
+)
+
+// radiusRevealPassword decrypts User-Password, the reverse of radiusHidePassword.
+func radiusRevealPassword(hidden []byte, secret string, authenticator [16]byte) []byte {
+	result := make([]byte, len(hidden))
+	prev := authenticator[:]
+	for i := 0; i+16 <= len(hidden); i += 16 {
+		h := md5.Sum(append([]byte(secret), prev...))
+		for j := 0; j < 16; j++ {
+			result[i+j] = hidden[i+j] ^ h[j]
+		}
+		prev = hidden[i : i+16]
+	}
+	return bytes.TrimRight(result, "\x00")
+}
+
+func TestRADIUSHidePassword(t *testing.T) {
+	auth := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	for _, password := range []string{"", "123456", "0123456789abcdef", "a long password that is longer than 32 bytes"} {
+		hidden := radiusHidePassword([]byte(password), "secret", auth)
+		if len(hidden)%16 != 0 || len(hidden) == 0 {
+			t.Errorf("%#v: unexpected length: %d", password, len(hidden))
+		}
+		if got := string(radiusRevealPassword(hidden, "secret", auth)); got != password {
+			t.Errorf("%#v: failed to reveal: %#v", password, got)
+		}
+	}
+}
+
+// encodeRADIUSResponse encodes the response with Message-Authenticator and Response Authenticator, for the request that has requestAuth.
+func encodeRADIUSResponse(resp radiusPacket, secret string, requestAuth [16]byte) []byte {
+	raw, _ := resp.Encode()
+	copy(raw[4:20], requestAuth[:])
+	signRADIUS(raw, secret)
+	h := md5.New()
+	h.Write(raw)
+	h.Write([]byte(secret))
+	copy(raw[4:20], h.Sum(nil))
+	return raw
+}
+
+func TestVerifyRADIUSResponse(t *testing.T) {
+	auth := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	for _, code := range []byte{radiusAccessAccept, radiusAccessReject, radiusAccessChallenge} {
+		signed := encodeRADIUSResponse(radiusPacket{
+			Code:       code,
+			Identifier: 1,
+			Attributes: []radiusAttribute{{radiusMessageAuthenticator, make([]byte, 16)}},
+		}, "secret", auth)
+		if !verifyRADIUSResponse(signed, "secret", auth) {
+			t.Errorf("%d: failed to verify signed response", code)
+		}
+
+		tampered := append([]byte{}, signed...)
+		tampered[len(tampered)-1] ^= 1
+		if verifyRADIUSResponse(tampered, "secret", auth) {
+			t.Errorf("%d: response with wrong Message-Authenticator should be rejected", code)
+		}
+
+		unsigned := encodeRADIUSResponse(radiusPacket{
+			Code:       code,
+			Identifier: 1,
+			Attributes: []radiusAttribute{{radiusReplyMessage, []byte("hello")}},
+		}, "secret", auth)
+		if verifyRADIUSResponse(unsigned, "secret", auth) {
+			t.Errorf("%d: response without Message-Authenticator should be rejected", code)
+		}
+	}
+}
+
+// startDummyRADIUS starts a server that accepts "123456", asks another code for "challenge", and rejects any other password.
+func startDummyRADIUS(t *testing.T, secret string) (addr string, received chan radiusPacket) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	received = make(chan radiusPacket, 10)
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			req, err := decodeRADIUS(buf[:n])
+			if err != nil {
+				continue
+			}
+			received <- req
+
+			password := string(radiusRevealPassword(req.Get(radiusUserPassword), secret, req.Authenticator))
+
+			resp := radiusPacket{
+				Identifier: req.Identifier,
+				Attributes: []radiusAttribute{{radiusMessageAuthenticator, make([]byte, 16)}},
+			}
+			switch {
+			case password == "challenge":
+				resp.Code = radiusAccessChallenge
+				resp.Attributes = append(resp.Attributes,
+					radiusAttribute{radiusReplyMessage, []byte("Enter the code sent by SMS.")},
+					radiusAttribute{radiusState, []byte("state-1")},
+				)
+			case password == "123456":
+				resp.Code = radiusAccessAccept
+			default:
+				resp.Code = radiusAccessReject
+			}
+
+			conn.WriteTo(encodeRADIUSResponse(resp, secret, req.Authenticator), from)
+		}
+	}()
+
+	return conn.LocalAddr().String(), received
+}
+
+func TestRADIUS(t *testing.T) {
+	addr, received := startDummyRADIUS(t, "shared-secret")
+
+	r := &RADIUS{
+		Server:        addr,
+		Secret:        "shared-secret",
+		NASIdentifier: "lauth",
+		Timeout:       5 * time.Second,
+	}
+	ctx := context.Background()
+
+	c, err := r.Start(ctx, "macrat", "192.0.2.1")
+	if err != nil || c == nil {
+		t.Fatalf("RADIUS should ask one-time password: %v %v", c, err)
+	}
+
+	if next, err := r.Verify(ctx, "macrat", "192.0.2.1", *c, "123456"); err != nil || next != nil {
+		t.Fatalf("failed to verify: %v %v", next, err)
+	}
+	req := <-received
+	if string(req.Get(radiusUserName)) != "macrat" || string(req.Get(radiusNASIdentifier)) != "lauth" {
+		t.Errorf("unexpected request attributes: %v", req.Attributes)
+	}
+
+	if _, err := r.Verify(ctx, "macrat", "192.0.2.1", *c, "000000"); err != DeniedError {
+		t.Errorf("expected denied but got %v", err)
+	}
+	<-received
+
+	next, err := r.Verify(ctx, "macrat", "192.0.2.1", *c, "challenge")
+	if err != nil || next == nil {
+		t.Fatalf("expected next challenge: %v %v", next, err)
+	}
+	if next.Message != "Enter the code sent by SMS." {
+		t.Errorf("unexpected message: %#v", next.Message)
+	}
+	<-received
+
+	if _, err := r.Verify(ctx, "macrat", "192.0.2.1", *next, "123456"); err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if req := <-received; string(req.Get(radiusState)) != "state-1" {
+		t.Errorf("State should be sent back: %#v", string(req.Get(radiusState)))
+	}
+
+	r.Secret = "wrong-secret"
+	r.Timeout = 500 * time.Millisecond
+	if _, err := r.Verify(ctx, "macrat", "192.0.2.1", *c, "123456"); err == nil || err == DeniedError {
+		t.Errorf("responses with wrong authenticator should be ignored: %v", err)
+	}
+}
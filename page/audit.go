@@ -0,0 +1,263 @@
+package page
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// probe is embedded in the sample data to find values that rendered without escaping.
+const probe = "<lauth-probe></lauth-probe>"
+
+// Problem is an accessibility or validity issue that found by Audit.
+type Problem struct {
+	Page    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Page, p.Message)
+}
+
+// Audit renders each page with sample data like Check, and checks basic accessibility and validity of the rendered HTML.
+//
+// The returned error is only for templates that failed to render.
+func Audit(t *template.Template) ([]Problem, error) {
+	var problems []Problem
+
+	for _, s := range samples {
+		if t.Lookup(s.Name) == nil {
+			return nil, fmt.Errorf("%s: template is not found", s.Name)
+		}
+
+		var buf bytes.Buffer
+		if err := t.ExecuteTemplate(&buf, s.Name, s.Data); err != nil {
+			return nil, fmt.Errorf("%s: %s", s.Name, err)
+		}
+
+		ps, err := AuditHTML(s.Name, &buf)
+		if err != nil {
+			return nil, err
+		}
+		problems = appendUniqueProblems(problems, ps...)
+	}
+
+	return problems, nil
+}
+
+func appendUniqueProblems(ps []Problem, xs ...Problem) []Problem {
+	for _, x := range xs {
+		found := false
+		for _, p := range ps {
+			if p == x {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ps = append(ps, x)
+		}
+	}
+	return ps
+}
+
+// AuditHTML checks basic accessibility and validity of a rendered page.
+func AuditHTML(name string, r io.Reader) ([]Problem, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	a := &auditor{
+		Page:   name,
+		Labels: map[string]bool{},
+		IDs:    map[string]bool{},
+	}
+	a.collect(doc)
+	a.walk(doc, false)
+
+	if !a.HasTitle {
+		a.report("page has no <title>")
+	}
+
+	return a.Problems, nil
+}
+
+type auditor struct {
+	Page     string
+	Labels   map[string]bool
+	IDs      map[string]bool
+	HasTitle bool
+	Problems []Problem
+}
+
+func (a *auditor) report(format string, args ...interface{}) {
+	a.Problems = appendUniqueProblems(a.Problems, Problem{
+		Page:    a.Page,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func getAttr(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func hasName(n *html.Node) bool {
+	for _, key := range []string{"aria-label", "aria-labelledby", "title"} {
+		if v, ok := getAttr(n, key); ok && strings.TrimSpace(v) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasText(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode && strings.TrimSpace(c.Data) != "" {
+			return true
+		}
+		if c.Type == html.ElementNode && (hasText(c) || (c.DataAtom == atom.Img && hasName(c))) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPassword(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if t, _ := getAttr(c, "type"); c.DataAtom == atom.Input && strings.EqualFold(t, "password") {
+			return true
+		}
+		if hasPassword(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSubmit checks if the form has a button to submit it without JavaScript.
+func hasSubmit(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		t, _ := getAttr(c, "type")
+		if c.DataAtom == atom.Button && (t == "" || strings.EqualFold(t, "submit")) {
+			return true
+		}
+		if c.DataAtom == atom.Input && (strings.EqualFold(t, "submit") || strings.EqualFold(t, "image")) {
+			return true
+		}
+		if hasSubmit(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// collect gathers IDs that referred by <label for="...">, and reports duplicated IDs.
+func (a *auditor) collect(n *html.Node) {
+	if n.Type == html.ElementNode {
+		if id, ok := getAttr(n, "id"); ok {
+			if a.IDs[id] {
+				a.report("id %#v is used more than once", id)
+			}
+			a.IDs[id] = true
+		}
+		if n.DataAtom == atom.Label {
+			if id, ok := getAttr(n, "for"); ok {
+				a.Labels[id] = true
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		a.collect(c)
+	}
+}
+
+func (a *auditor) walk(n *html.Node, inLabel bool) {
+	if n.Type == html.ElementNode {
+		switch n.DataAtom {
+		case atom.Html:
+			if lang, _ := getAttr(n, "lang"); strings.TrimSpace(lang) == "" {
+				a.report("<html> has no lang attribute")
+			}
+		case atom.Title:
+			a.HasTitle = a.HasTitle || hasText(n)
+		case atom.Img:
+			if _, ok := getAttr(n, "alt"); !ok {
+				a.report("<img> has no alt attribute")
+			}
+		case atom.Form:
+			method, _ := getAttr(n, "method")
+			switch strings.ToUpper(method) {
+			case "POST":
+			case "GET", "":
+				if hasPassword(n) {
+					a.report("<form> with password must use POST method")
+				} else if method == "" {
+					a.report("<form> has no method attribute")
+				}
+			default:
+				a.report("<form> has unknown method %#v", method)
+			}
+			if !hasSubmit(n) {
+				a.report("<form> has no submit button, so it can't be sent without JavaScript")
+			}
+		case atom.Input, atom.Select, atom.Textarea:
+			t, _ := getAttr(n, "type")
+			switch strings.ToLower(t) {
+			case "hidden", "submit", "reset", "button", "image":
+			default:
+				id, _ := getAttr(n, "id")
+				if !inLabel && !hasName(n) && (id == "" || !a.Labels[id]) {
+					name, _ := getAttr(n, "name")
+					a.report("<%s name=%#v> has no label", n.Data, name)
+				}
+			}
+		case atom.Button:
+			if !hasName(n) && !hasText(n) {
+				a.report("<button> has no text or aria-label")
+			}
+			if t, _ := getAttr(n, "type"); strings.EqualFold(t, "button") {
+				if _, hidden := getAttr(n, "hidden"); !hidden {
+					a.report("<button type=\"button\"> does nothing without JavaScript; add hidden attribute and show it by script")
+				}
+			}
+		case atom.A:
+			if href, _ := getAttr(n, "href"); strings.HasPrefix(strings.ToLower(strings.TrimSpace(href)), "javascript:") {
+				a.report("<a href=\"javascript:...\"> doesn't work without JavaScript")
+			}
+		case atom.Label:
+			inLabel = true
+		}
+
+		for _, attr := range n.Attr {
+			if attr.Namespace == "" && strings.HasPrefix(strings.ToLower(attr.Key), "on") {
+				a.report("<%s %s> doesn't work without JavaScript, and is blocked by Content-Security-Policy", n.Data, attr.Key)
+			}
+		}
+
+		if n.Data == "lauth-probe" {
+			a.report("sample data is rendered without escaping")
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		a.walk(c, inLabel)
+	}
+}
@@ -0,0 +1,111 @@
+package page_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/page"
+)
+
+func TestAudit_BuiltIn(t *testing.T) {
+	tmpl, err := page.Load(config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("failed to load templates: %s", err)
+	}
+
+	problems, err := page.Audit(tmpl)
+	if err != nil {
+		t.Fatalf("failed to audit: %s", err)
+	}
+	for _, p := range problems {
+		t.Errorf("%s", p)
+	}
+}
+
+func TestAudit_Custom(t *testing.T) {
+	tmpl, err := page.Load(config.TemplateConfig{
+		LoginPage: MakeTestFile(t, `<html><head><title>login</title></head><body>
+			<img src="{{ .client.IconURL }}" />
+			<form>
+				{{ csrfField . }}
+				<input name="username" />
+				<input type="password" name="password" aria-label="password" />
+				<button></button>
+			</form>
+		</body></html>`),
+	})
+	if err != nil {
+		t.Fatalf("failed to load templates: %s", err)
+	}
+
+	problems, err := page.Audit(tmpl)
+	if err != nil {
+		t.Fatalf("failed to audit: %s", err)
+	}
+
+	expect := []string{
+		"login.tmpl: <html> has no lang attribute",
+		"login.tmpl: <img> has no alt attribute",
+		"login.tmpl: <form> with password must use POST method",
+		`login.tmpl: <input name="username"> has no label`,
+		"login.tmpl: <button> has no text or aria-label",
+	}
+	if len(problems) != len(expect) {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	for i, p := range problems {
+		if p.String() != expect[i] {
+			t.Errorf("%d: expected %#v but got %#v", i, expect[i], p.String())
+		}
+	}
+}
+
+func TestAuditHTML(t *testing.T) {
+	tests := []struct {
+		HTML   string
+		Expect []string
+	}{
+		{
+			`<html lang="en"><title>ok</title><form method="post"><label>name <input name="name" /></label><label for="x">x</label><input id="x" name="x" /><button>ok</button></form></html>`,
+			nil,
+		},
+		{
+			`<html lang="en"><title>ok</title><p><lauth-probe></lauth-probe></p></html>`,
+			[]string{"page: sample data is rendered without escaping"},
+		},
+		{
+			`<html lang="en"><form method="get"><span id="a"></span><span id="a"></span></form></html>`,
+			[]string{`page: id "a" is used more than once`, "page: <form> has no submit button, so it can't be sent without JavaScript", "page: page has no <title>"},
+		},
+		{
+			`<html lang="en"><title>ok</title><form method="post"><input type="submit" value="ok" /></form><button type="button" hidden>show</button></html>`,
+			nil,
+		},
+		{
+			`<html lang="en"><title>ok</title><button type="button">show</button><a href="javascript:void(0)" onclick="go()">go</a></html>`,
+			[]string{
+				`page: <button type="button"> does nothing without JavaScript; add hidden attribute and show it by script`,
+				`page: <a href="javascript:..."> doesn't work without JavaScript`,
+				"page: <a onclick> doesn't work without JavaScript, and is blocked by Content-Security-Policy",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		problems, err := page.AuditHTML("page", strings.NewReader(tt.HTML))
+		if err != nil {
+			t.Errorf("%s: failed to audit: %s", tt.HTML, err)
+			continue
+		}
+		if len(problems) != len(tt.Expect) {
+			t.Errorf("%s: unexpected problems: %v", tt.HTML, problems)
+			continue
+		}
+		for i, p := range problems {
+			if p.String() != tt.Expect[i] {
+				t.Errorf("%s: expected %#v but got %#v", tt.HTML, tt.Expect[i], p.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package page
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	sampleClient = gin.H{
+		"ID":      "sample_client",
+		"Name":    "Sample Client" + probe,
+		"IconURL": "https://example.com/icon.png",
+	}
+
+	sampleScopes = []gin.H{
+		{"Name": "openid", "Description": "Sign in with your account." + probe},
+		{"Name": "profile", "Description": "Your name." + probe},
+	}
+
+	sampleLocale = Locale{Language: "en", Location: time.UTC}
+
+	sampleError = gin.H{
+		"Reason":      "invalid_request",
+		"Description": "this is a sample error" + probe,
+	}
+
+	// samples are the data to render each template on self-test.
+	samples = []struct {
+		Name string
+		Data gin.H
+	}{
+		{"login.tmpl", gin.H{"client": sampleClient, "response_type": "code", "request": "sample", "initial_username": "someone" + probe, "error": "sample error", "scopes": sampleScopes, "autocomplete": true, "password_toggle": true, "csp_nonce": "c2FtcGxl", "locale": sampleLocale, "expires_in": "30 minutes", "expires_at": "Jan 2, 2006 15:04 UTC"}},
+		{"login.tmpl", gin.H{"client": sampleClient, "response_type": "code", "request": "sample", "initial_username": "someone" + probe, "error": "sample error", "error_detail": "Sample detail." + probe}},
+		{"login.tmpl", gin.H{"client": sampleClient, "response_type": "code", "request": "sample", "initial_username": "someone" + probe, "authz_only": true}},
+		{"logout.tmpl", gin.H{"locale": sampleLocale}},
+		{"logout.tmpl", gin.H{"frontchannel_logout_uris": []string{"http://example.com/logout" + probe}, "continue": "http://example.com/" + probe, "locale": sampleLocale}},
+		{"logout.tmpl", gin.H{"confirm": true, "post_logout_redirect_uri": "http://example.com/logout" + probe, "client_id": "sample" + probe, "state": "sample" + probe, "locale": sampleLocale}},
+		{"form_post.tmpl", gin.H{"redirect_uri": "http://example.com/callback" + probe, "params": []gin.H{{"Name": "code", "Value": "sample" + probe}, {"Name": "state", "Value": "sample" + probe}}, "csp_nonce": "c2FtcGxl", "locale": sampleLocale}},
+		{"error.tmpl", gin.H{"error": sampleError, "error_message": "The request is invalid.", "error_code": "LA1001", "error_uri": "https://example.com/errors/LA1001", "locale": sampleLocale}},
+		{"error_code.tmpl", gin.H{"info": gin.H{"Code": "LA1001", "Reason": "invalid_request", "Title": "Invalid request" + probe, "Explanation": "This is a sample explanation." + probe}, "locale": sampleLocale}},
+		{"backchannel.tmpl", gin.H{"step": "confirm", "key": "sample" + probe, "username": "someone" + probe, "binding_message": "sample message" + probe, "client": sampleClient, "scopes": sampleScopes, "error": "sample error", "csp_nonce": "c2FtcGxl", "locale": sampleLocale, "expires_in": "5 minutes", "expires_at": "Jan 2, 2006 15:04 UTC"}},
+		{"backchannel.tmpl", gin.H{"step": "approved", "locale": sampleLocale}},
+		{"backchannel.tmpl", gin.H{"step": "denied", "locale": sampleLocale}},
+		{"register.tmpl", gin.H{"step": "profile", "continue": "/", "username": "someone" + probe, "email": "someone@example.com" + probe}},
+		{"register.tmpl", gin.H{"step": "sent", "email": "someone@example.com"}},
+		{"register.tmpl", gin.H{"step": "password", "username": "someone", "token": "sample", "error": "sample error", "locale": sampleLocale, "expires_in": "7 days", "expires_at": "Jan 2, 2006 15:04 UTC"}},
+		{"register.tmpl", gin.H{"step": "done", "username": "someone", "continue": "/"}},
+	}
+)
+
+// Check renders each page with sample data to find broken templates before serving.
+func Check(t *template.Template) error {
+	for _, s := range samples {
+		if t.Lookup(s.Name) == nil {
+			return fmt.Errorf("%s: template is not found", s.Name)
+		}
+		if err := t.ExecuteTemplate(io.Discard, s.Name, s.Data); err != nil {
+			return fmt.Errorf("%s: %s", s.Name, err)
+		}
+	}
+	return nil
+}
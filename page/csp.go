@@ -0,0 +1,74 @@
+package page
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const cspNonceKey = "lauth_csp_nonce"
+
+// NewCSPNonce makes a random nonce for Content-Security-Policy.
+func NewCSPNonce() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SetCSPNonce stores the nonce of the response to the context.
+func SetCSPNonce(c *gin.Context, nonce string) {
+	c.Set(cspNonceKey, nonce)
+}
+
+// GetCSPNonce returns the nonce that stored by SetCSPNonce, or empty string if not stored.
+func GetCSPNonce(c *gin.Context) string {
+	return c.GetString(cspNonceKey)
+}
+
+// ContentSecurityPolicy makes the Content-Security-Policy header for the pages.
+//
+// Inline scripts and styles are allowed only if they have the nonce.
+// The origin of assetURL is also allowed, to load static assets for the custom templates.
+func ContentSecurityPolicy(nonce, assetURL string) string {
+	sources := "'self'"
+	if u, err := url.Parse(assetURL); err == nil && u.Scheme != "" && u.Host != "" {
+		sources += " " + u.Scheme + "://" + u.Host
+	}
+
+	return strings.Join([]string{
+		"default-src " + sources,
+		fmt.Sprintf("script-src 'nonce-%s' %s", nonce, sources),
+		fmt.Sprintf("style-src 'nonce-%s' %s", nonce, sources),
+		"img-src * data:",
+		"object-src 'none'",
+		"base-uri 'none'",
+		"frame-ancestors 'none'",
+	}, "; ")
+}
+
+// AllowFrames adds frame-src of the origins of the URIs to the policy, for the logout page that loads front-channel logout URIs of clients.
+func AllowFrames(policy string, uris []string) string {
+	var origins []string
+	seen := make(map[string]bool)
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			continue
+		}
+		origin := u.Scheme + "://" + u.Host
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		return policy
+	}
+	return policy + "; frame-src " + strings.Join(origins, " ")
+}
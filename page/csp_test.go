@@ -0,0 +1,70 @@
+package page_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth/page"
+)
+
+func TestNewCSPNonce(t *testing.T) {
+	a, err := page.NewCSPNonce()
+	if err != nil {
+		t.Fatalf("failed to generate nonce: %s", err)
+	}
+	b, err := page.NewCSPNonce()
+	if err != nil {
+		t.Fatalf("failed to generate nonce: %s", err)
+	}
+
+	if len(a) < 22 {
+		t.Errorf("nonce is too short: %#v", a)
+	}
+	if a == b {
+		t.Errorf("nonce should be random but got the same value: %#v", a)
+	}
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	tests := []struct {
+		AssetURL string
+		Expect   string
+	}{
+		{
+			"",
+			"default-src 'self'; script-src 'nonce-abc' 'self'; style-src 'nonce-abc' 'self'; img-src * data:; object-src 'none'; base-uri 'none'; frame-ancestors 'none'",
+		},
+		{
+			"https://cdn.example.com/lauth/assets",
+			"default-src 'self' https://cdn.example.com; script-src 'nonce-abc' 'self' https://cdn.example.com; style-src 'nonce-abc' 'self' https://cdn.example.com; img-src * data:; object-src 'none'; base-uri 'none'; frame-ancestors 'none'",
+		},
+		{
+			"/static",
+			"default-src 'self'; script-src 'nonce-abc' 'self'; style-src 'nonce-abc' 'self'; img-src * data:; object-src 'none'; base-uri 'none'; frame-ancestors 'none'",
+		},
+	}
+
+	for _, tt := range tests {
+		if csp := page.ContentSecurityPolicy("abc", tt.AssetURL); csp != tt.Expect {
+			t.Errorf("%#v: unexpected policy:\nexpected: %s\n but got: %s", tt.AssetURL, tt.Expect, csp)
+		}
+	}
+}
+
+func TestAllowFrames(t *testing.T) {
+	policy := "default-src 'self'"
+
+	if csp := page.AllowFrames(policy, nil); csp != policy {
+		t.Errorf("policy should not be changed without URIs: %s", csp)
+	}
+
+	csp := page.AllowFrames(policy, []string{
+		"https://app.example.com/logout",
+		"https://app.example.com/another/logout",
+		"http://other.example.com:8080/logout?x=1",
+		"/relative",
+	})
+	expect := "default-src 'self'; frame-src https://app.example.com http://other.example.com:8080"
+	if csp != expect {
+		t.Errorf("unexpected policy:\nexpected: %s\n but got: %s", expect, csp)
+	}
+}
@@ -0,0 +1,113 @@
+package page
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/qrcode"
+)
+
+var (
+	// messages is the built-in catalog for `t` function.
+	messages = map[string]map[string]string{
+		"en": {
+			"login":          "Login",
+			"logout":         "Logout",
+			"logged_out":     "Logged out",
+			"username":       "username",
+			"password":       "password",
+			"show_password":  "show password",
+			"continue":       "Continue",
+			"create_account": "Create account",
+			"error":          "Error",
+		},
+		"ja": {
+			"login":          "ログイン",
+			"logout":         "ログアウト",
+			"logged_out":     "ログアウトしました",
+			"username":       "ユーザ名",
+			"password":       "パスワード",
+			"show_password":  "パスワードを表示",
+			"continue":       "続ける",
+			"create_account": "アカウント作成",
+			"error":          "エラー",
+		},
+	}
+
+	// csrfFields are the names of values that bind a form to the session.
+	csrfFields = []string{"request", "token"}
+)
+
+// translate returns the message of the key in the language, or in English if not found.
+func translate(language, key string) string {
+	if msg, ok := messages[language][key]; ok {
+		return msg
+	}
+	if msg, ok := messages["en"][key]; ok {
+		return msg
+	}
+	return key
+}
+
+// assetURL makes URL of a static asset that hosted under the base URL.
+func assetURL(base, name string) string {
+	if base == "" {
+		return name
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return name
+	}
+	u.Path = path.Join(u.Path, name)
+	return u.String()
+}
+
+// csrfField makes hidden inputs of the values that bind a form to the login session.
+func csrfField(data interface{}) template.HTML {
+	var values map[string]interface{}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		values = d
+	case gin.H:
+		values = d
+	}
+
+	var sb strings.Builder
+	for _, name := range csrfFields {
+		if v, ok := values[name]; ok && v != nil && v != "" {
+			fmt.Fprintf(&sb, `<input type="hidden" name="%s" value="%s" />`, name, template.HTMLEscapeString(fmt.Sprint(v)))
+		}
+	}
+	return template.HTML(sb.String())
+}
+
+// qrcodeURL makes data URL of SVG QR code, to show secrets like otpauth:// URI without sending it to anywhere.
+func qrcodeURL(data string) (template.URL, error) {
+	q, err := qrcode.Encode([]byte(data))
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(q.SVG()))), nil
+}
+
+// Funcs returns the functions that available in the templates.
+// Templates that use any other function are rejected on load.
+func Funcs(conf config.TemplateConfig) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string) string {
+			return translate(conf.Languages()[0], key)
+		},
+		"asset": func(name string) string {
+			return assetURL(conf.AssetURL, name)
+		},
+		"csrfField": csrfField,
+		"qrcode":    qrcodeURL,
+	}
+}
@@ -31,6 +31,8 @@ func TestLoginForm_value_passing(t *testing.T) {
 		t.Fatalf("failed to render login page (status code = %d)", resp.Code)
 	}
 
+	testutil.AssertAccessible(t, "login page", resp.Body.Bytes())
+
 	inputs, err := testutil.FindInputsByHTML(resp.Body)
 	if err != nil {
 		t.Fatalf("failed to parse login page: %s", err)
@@ -0,0 +1,198 @@
+package page
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+	"golang.org/x/text/language"
+)
+
+const localeKey = "lauth.page.locale"
+
+var (
+	// durationUnits are the units to format durations, in descending order.
+	durationUnits = []struct {
+		Duration time.Duration
+		Names    map[string][2]string
+	}{
+		{24 * time.Hour, map[string][2]string{"en": {"day", "days"}, "ja": {"日", "日"}}},
+		{time.Hour, map[string][2]string{"en": {"hour", "hours"}, "ja": {"時間", "時間"}}},
+		{time.Minute, map[string][2]string{"en": {"minute", "minutes"}, "ja": {"分", "分"}}},
+		{time.Second, map[string][2]string{"en": {"second", "seconds"}, "ja": {"秒", "秒"}}},
+	}
+
+	durationSeparators = map[string]string{
+		"en": " ",
+		"ja": "",
+	}
+
+	timeFormats = map[string]string{
+		"en": "Jan 2, 2006 15:04 MST",
+		"ja": "2006年1月2日 15:04 MST",
+	}
+
+	// errorMessages are human readable messages of the error reasons.
+	errorMessages = map[string]map[string]string{
+		"en": {
+			"access_denied":             "Access denied.",
+			"interaction_required":      "Interaction is required.",
+			"invalid_client":            "The client is not registered.",
+			"invalid_grant":             "The grant is invalid or expired.",
+			"invalid_request":           "The request is invalid.",
+			"invalid_request_object":    "The request object is invalid.",
+			"invalid_request_uri":       "The request URI is invalid.",
+			"invalid_scope":             "The requested scope is invalid.",
+			"invalid_token":             "The token is invalid or expired.",
+			"login_required":            "Login is required.",
+			"request_not_supported":     "The request parameter is not supported.",
+			"request_uri_not_supported": "The request_uri parameter is not supported.",
+			"server_error":              "Internal server error.",
+			"temporarily_unavailable":   "The service is temporarily unavailable.",
+			"unauthorized_client":       "The client is not allowed to do this request.",
+			"unsupported_grant_type":    "The grant type is not supported.",
+			"unsupported_response_type": "The response type is not supported.",
+			"method_not_allowed":        "The method is not allowed.",
+			"page_not_found":            "The page is not found.",
+			"request_too_large":         "The request is too large.",
+			"uri_too_long":              "The URL is too long.",
+		},
+		"ja": {
+			"access_denied":             "アクセスが拒否されました。",
+			"interaction_required":      "操作が必要です。",
+			"invalid_client":            "クライアントが登録されていません。",
+			"invalid_grant":             "認可が無効か期限切れです。",
+			"invalid_request":           "リクエストが不正です。",
+			"invalid_request_object":    "リクエストオブジェクトが不正です。",
+			"invalid_request_uri":       "リクエストURIが不正です。",
+			"invalid_scope":             "要求されたスコープが不正です。",
+			"invalid_token":             "トークンが無効か期限切れです。",
+			"login_required":            "ログインが必要です。",
+			"request_not_supported":     "requestパラメータには対応していません。",
+			"request_uri_not_supported": "request_uriパラメータには対応していません。",
+			"server_error":              "サーバ内部でエラーが発生しました。",
+			"temporarily_unavailable":   "サービスが一時的に利用できません。",
+			"unauthorized_client":       "クライアントにはこのリクエストが許可されていません。",
+			"unsupported_grant_type":    "このグラントタイプには対応していません。",
+			"unsupported_response_type": "このレスポンスタイプには対応していません。",
+			"method_not_allowed":        "このメソッドは使用できません。",
+			"page_not_found":            "ページが見つかりません。",
+			"request_too_large":         "リクエストが大きすぎます。",
+			"uri_too_long":              "URLが長すぎます。",
+		},
+	}
+)
+
+// Locale is the language and the timezone to render a page.
+type Locale struct {
+	Language string
+	Location *time.Location
+}
+
+// DefaultLocale returns the locale for the requests that don't match any language.
+func DefaultLocale(conf config.TemplateConfig) Locale {
+	loc, err := time.LoadLocation(conf.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return Locale{
+		Language: conf.Languages()[0],
+		Location: loc,
+	}
+}
+
+// Negotiate chooses the locale from the languages in the config by the Accept-Language header.
+func Negotiate(conf config.TemplateConfig, acceptLanguage string) Locale {
+	l := DefaultLocale(conf)
+
+	langs := conf.Languages()
+	if len(langs) == 1 || acceptLanguage == "" {
+		return l
+	}
+
+	tags := make([]language.Tag, len(langs))
+	for i, lang := range langs {
+		tags[i] = language.Make(lang)
+	}
+
+	accepts, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(accepts) == 0 {
+		return l
+	}
+
+	_, i, confidence := language.NewMatcher(tags).Match(accepts...)
+	if confidence != language.No {
+		l.Language = langs[i]
+	}
+	return l
+}
+
+// SetLocale stores the locale of the request to the context.
+func SetLocale(c *gin.Context, l Locale) {
+	c.Set(localeKey, l)
+}
+
+// GetLocale returns the locale that stored by SetLocale, or English in UTC if not stored.
+func GetLocale(c *gin.Context) Locale {
+	if v, ok := c.Get(localeKey); ok {
+		if l, ok := v.(Locale); ok {
+			return l
+		}
+	}
+	return Locale{Language: "en", Location: time.UTC}
+}
+
+func (l Locale) String() string {
+	return l.Language
+}
+
+// Duration formats the duration in the largest unit like "5 minutes".
+func (l Locale) Duration(d time.Duration) string {
+	unit := durationUnits[len(durationUnits)-1]
+	for _, u := range durationUnits {
+		if d >= u.Duration {
+			unit = u
+			break
+		}
+	}
+
+	names, ok := unit.Names[l.Language]
+	if !ok {
+		names = unit.Names["en"]
+	}
+
+	sep, ok := durationSeparators[l.Language]
+	if !ok {
+		sep = durationSeparators["en"]
+	}
+
+	n := int64(d / unit.Duration)
+	if n == 1 {
+		return fmt.Sprintf("%d%s%s", n, sep, names[0])
+	}
+	return fmt.Sprintf("%d%s%s", n, sep, names[1])
+}
+
+// Time formats the time in the timezone of the locale.
+func (l Locale) Time(t time.Time) string {
+	format, ok := timeFormats[l.Language]
+	if !ok {
+		format = timeFormats["en"]
+	}
+	if l.Location != nil {
+		t = t.In(l.Location)
+	}
+	return t.Format(format)
+}
+
+// ErrorMessage returns the human readable message of the error reason.
+func (l Locale) ErrorMessage(reason string) string {
+	if msg, ok := errorMessages[l.Language][reason]; ok {
+		return msg
+	}
+	if msg, ok := errorMessages["en"][reason]; ok {
+		return msg
+	}
+	return reason
+}
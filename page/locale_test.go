@@ -0,0 +1,119 @@
+package page_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/page"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		Language       string
+		AcceptLanguage string
+		Expect         string
+	}{
+		{"", "ja", "en"},
+		{"en", "ja", "en"},
+		{"ja", "en", "ja"},
+		{"en,ja", "", "en"},
+		{"en,ja", "ja-JP,ja;q=0.9,en;q=0.8", "ja"},
+		{"en,ja", "fr,en;q=0.5", "en"},
+		{"ja,en", "fr", "ja"},
+		{"en, ja", "ja", "ja"},
+		{"en,ja", "!!invalid!!", "en"},
+	}
+
+	for _, tt := range tests {
+		l := page.Negotiate(config.TemplateConfig{Language: tt.Language}, tt.AcceptLanguage)
+		if l.Language != tt.Expect {
+			t.Errorf("%#v with %#v: expected %#v but got %#v", tt.Language, tt.AcceptLanguage, tt.Expect, l.Language)
+		}
+	}
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("failed to load timezone: %s", err)
+	}
+	if l := page.Negotiate(config.TemplateConfig{Timezone: "Asia/Tokyo"}, ""); l.Location.String() != tokyo.String() {
+		t.Errorf("unexpected timezone: %s", l.Location)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	en := page.Locale{Language: "en", Location: time.UTC}
+	ja := page.Locale{Language: "ja", Location: time.FixedZone("JST", 9*60*60)}
+	fr := page.Locale{Language: "fr", Location: time.UTC}
+
+	durations := []struct {
+		Locale   page.Locale
+		Duration time.Duration
+		Expect   string
+	}{
+		{en, 30 * time.Second, "30 seconds"},
+		{en, time.Minute, "1 minute"},
+		{en, 5*time.Minute + 30*time.Second, "5 minutes"},
+		{en, 2 * time.Hour, "2 hours"},
+		{en, 7 * 24 * time.Hour, "7 days"},
+		{en, 0, "0 seconds"},
+		{ja, 5 * time.Minute, "5分"},
+		{ja, time.Hour, "1時間"},
+		{fr, 5 * time.Minute, "5 minutes"},
+	}
+	for _, tt := range durations {
+		if s := tt.Locale.Duration(tt.Duration); s != tt.Expect {
+			t.Errorf("%s: %s: expected %#v but got %#v", tt.Locale, tt.Duration, tt.Expect, s)
+		}
+	}
+
+	ts := time.Date(2021, 6, 1, 15, 4, 0, 0, time.UTC)
+	if s := en.Time(ts); s != "Jun 1, 2021 15:04 UTC" {
+		t.Errorf("unexpected time in en: %#v", s)
+	}
+	if s := ja.Time(ts); s != "2021年6月2日 00:04 JST" {
+		t.Errorf("unexpected time in ja: %#v", s)
+	}
+
+	if s := ja.ErrorMessage("access_denied"); s != "アクセスが拒否されました。" {
+		t.Errorf("unexpected error message in ja: %#v", s)
+	}
+	if s := fr.ErrorMessage("access_denied"); s != "Access denied." {
+		t.Errorf("unexpected error message in fr: %#v", s)
+	}
+	if s := en.ErrorMessage("something_wrong"); s != "something_wrong" {
+		t.Errorf("unexpected error message of unknown reason: %#v", s)
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	r, err := page.NewRenderer(config.TemplateConfig{
+		Language:   "en,ja",
+		LogoutPage: MakeTestFile(t, `{{ t "logged_out" }}`),
+	})
+	if err != nil {
+		t.Fatalf("failed to load renderer: %s", err)
+	}
+
+	tests := []struct {
+		Data   interface{}
+		Expect string
+	}{
+		{nil, "Logged out"},
+		{gin.H{}, "Logged out"},
+		{gin.H{"locale": page.Locale{Language: "ja"}}, "ログアウトしました"},
+		{map[string]interface{}{"locale": page.Locale{Language: "ja"}}, "ログアウトしました"},
+		{gin.H{"locale": page.Locale{Language: "fr"}}, "Logged out"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		if err := r.Instance("logout.tmpl", tt.Data).Render(w); err != nil {
+			t.Errorf("%#v: failed to render: %s", tt.Data, err)
+		} else if w.Body.String() != tt.Expect {
+			t.Errorf("%#v: expected %#v but got %#v", tt.Data, tt.Expect, w.Body.String())
+		}
+	}
+}
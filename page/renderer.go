@@ -0,0 +1,62 @@
+package page
+
+import (
+	"html/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/macrat/lauth/config"
+)
+
+// Renderer is a gin.HTMLRender that renders pages in the language of the "locale" in the data.
+type Renderer struct {
+	Default   *template.Template
+	Languages map[string]*template.Template
+}
+
+// NewRenderer loads templates for each language in the config.
+func NewRenderer(conf config.TemplateConfig) (*Renderer, error) {
+	r := &Renderer{
+		Languages: make(map[string]*template.Template),
+	}
+
+	for _, lang := range conf.Languages() {
+		c := conf
+		c.Language = lang
+
+		t, err := Load(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.Default == nil {
+			r.Default = t
+		}
+		r.Languages[lang] = t
+	}
+
+	return r, nil
+}
+
+func (r *Renderer) Instance(name string, data interface{}) render.Render {
+	t := r.Default
+
+	var l interface{}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		l = d["locale"]
+	case gin.H:
+		l = d["locale"]
+	}
+	if l, ok := l.(Locale); ok {
+		if lt, ok := r.Languages[l.Language]; ok {
+			t = lt
+		}
+	}
+
+	return render.HTML{
+		Template: t,
+		Name:     name,
+		Data:     data,
+	}
+}
@@ -18,7 +18,7 @@ func Load(conf config.TemplateConfig) (*template.Template, error) {
 		return nil, err
 	}
 
-	t, err := template.ParseFS(fsys, "*.tmpl")
+	t, err := template.New("").Funcs(Funcs(conf)).ParseFS(fsys, "*.tmpl")
 	if err != nil {
 		return nil, err
 	}
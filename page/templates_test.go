@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"html/template"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/macrat/lauth/config"
@@ -87,3 +88,70 @@ func TestLoad(t *testing.T) {
 		t.Errorf("expected test error page but got normal builtin page")
 	}
 }
+
+func TestCheck(t *testing.T) {
+	tmpl, err := page.Load(config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("failed to load templates: %s", err)
+	}
+	if err := page.Check(tmpl); err != nil {
+		t.Errorf("failed to check default templates: %s", err)
+	}
+
+	tmpl, err = page.Load(config.TemplateConfig{
+		ErrorPage: MakeTestFile(t, "{{ .error.Reason.NoSuchField }}"),
+	})
+	if err != nil {
+		t.Fatalf("failed to load templates: %s", err)
+	}
+	if err := page.Check(tmpl); err == nil {
+		t.Errorf("expected error on broken template but got nil")
+	}
+}
+
+func TestLoad_Funcs(t *testing.T) {
+	tmpl, err := page.Load(config.TemplateConfig{
+		Language:  "ja",
+		AssetURL:  "https://cdn.example.com/lauth/",
+		LoginPage: MakeTestFile(t, `{{ t "login" }}|{{ t "no_such_key" }}|{{ asset "logo.png" }}|{{ csrfField . }}`),
+	})
+	if err != nil {
+		t.Fatalf("failed to load templates: %s", err)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := tmpl.ExecuteTemplate(buf, "login.tmpl", map[string]interface{}{"request": `a"b`}); err != nil {
+		t.Fatalf("failed to render: %s", err)
+	}
+
+	expect := `ログイン|no_such_key|https://cdn.example.com/lauth/logo.png|<input type="hidden" name="request" value="a&#34;b" />`
+	if buf.String() != expect {
+		t.Errorf("unexpected rendered result:\nexpected: %s\n but got: %s", expect, buf.String())
+	}
+
+	_, err = page.Load(config.TemplateConfig{
+		LoginPage: MakeTestFile(t, `{{ exec "rm -rf /" }}`),
+	})
+	if err == nil || !strings.Contains(err.Error(), `function "exec" not defined`) {
+		t.Errorf("expected error for undefined function but got %v", err)
+	}
+}
+
+func TestLoad_QRCode(t *testing.T) {
+	tmpl, err := page.Load(config.TemplateConfig{
+		LoginPage: MakeTestFile(t, `<img src="{{ qrcode .uri }}" />`),
+	})
+	if err != nil {
+		t.Fatalf("failed to load templates: %s", err)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := tmpl.ExecuteTemplate(buf, "login.tmpl", map[string]interface{}{"uri": "otpauth://totp/lauth:macrat?secret=JBSWY3DPEHPK3PXP"}); err != nil {
+		t.Fatalf("failed to render: %s", err)
+	}
+
+	// html/template escapes "+" in attributes as "&#43;", which browsers decode as usual.
+	if !strings.HasPrefix(buf.String(), `<img src="data:image/svg&#43;xml;base64,`) {
+		t.Errorf("unexpected rendered result: %s", buf.String())
+	}
+}
@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPDecider asks to an external policy service like Open Policy Agent.
+//
+// The request body is `{"input": {...}}`, and the response must be either `{"result": true}` or `{"result": {"allow": true, "reason": "..."}}`.
+type HTTPDecider struct {
+	URL     string
+	Timeout time.Duration
+}
+
+type httpRequest struct {
+	Input Input `json:"input"`
+}
+
+type httpResponse struct {
+	Result interface{} `json:"result"`
+}
+
+func (d HTTPDecider) Decide(ctx context.Context, input Input) (Decision, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	body, err := json.Marshal(httpRequest{Input: input})
+	if err != nil {
+		return Decision{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", d.URL, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("policy service responded status code %d", resp.StatusCode)
+	}
+
+	var result httpResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Decision{}, err
+	}
+
+	return decisionFromResult(result.Result)
+}
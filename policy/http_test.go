@@ -0,0 +1,89 @@
+package policy_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/policy"
+)
+
+func TestHTTPDecider(t *testing.T) {
+	var received policy.Input
+
+	mux := http.NewServeMux()
+	handler := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Input policy.Input `json:"input"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %s", err)
+			}
+			received = req.Input
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/bool/allow", handler(`{"result": true}`))
+	mux.HandleFunc("/bool/deny", handler(`{"result": false}`))
+	mux.HandleFunc("/object/allow", handler(`{"result": {"allow": true}}`))
+	mux.HandleFunc("/object/deny", handler(`{"result": {"allow": false, "reason": "not in office hours"}}`))
+	mux.HandleFunc("/undefined", handler(`{}`))
+	mux.HandleFunc("/broken", handler(`{"result": "hello"}`))
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	input := policy.Input{
+		Subject:    "macrat",
+		ClientID:   "some_client_id",
+		Scopes:     []string{"openid", "profile"},
+		RemoteAddr: "127.0.0.1",
+		Groups:     []string{"CN=admin,DC=example,DC=local"},
+	}
+
+	tests := []struct {
+		Path     string
+		Decision policy.Decision
+		Error    bool
+	}{
+		{"/bool/allow", policy.Decision{Allow: true}, false},
+		{"/bool/deny", policy.Decision{Allow: false}, false},
+		{"/object/allow", policy.Decision{Allow: true}, false},
+		{"/object/deny", policy.Decision{Allow: false, Reason: "not in office hours"}, false},
+		{"/undefined", policy.Decision{Allow: false, Reason: "no decision by policy"}, false},
+		{"/broken", policy.Decision{}, true},
+		{"/error", policy.Decision{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Path, func(t *testing.T) {
+			d := policy.HTTPDecider{URL: server.URL + tt.Path}
+
+			decision, err := d.Decide(context.Background(), input)
+			if tt.Error {
+				if err == nil {
+					t.Errorf("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decide: %s", err)
+			}
+
+			if decision != tt.Decision {
+				t.Errorf("unexpected decision: %#v", decision)
+			}
+
+			if !reflect.DeepEqual(received, input) {
+				t.Errorf("unexpected input received: %#v", received)
+			}
+		})
+	}
+}
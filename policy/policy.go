@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+)
+
+type Input struct {
+	Subject    string                 `json:"subject"`
+	ClientID   string                 `json:"client_id"`
+	Scopes     []string               `json:"scopes"`
+	RemoteAddr string                 `json:"remote_addr"`
+	Groups     []string               `json:"groups"`
+	Claims     map[string]interface{} `json:"claims,omitempty"`
+
+	// FailedLogins is the number of recent failed logins of the user, that is counted only if the lockout or the notification is enabled.
+	FailedLogins int `json:"failed_logins"`
+}
+
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+
+	// MFA is the name of MFA provider that the user has to pass, or empty to skip MFA.
+	// It is nil if the policy doesn't decide about MFA, then the [mfa] config decides.
+	MFA *string `json:"mfa,omitempty"`
+}
+
+type Decider interface {
+	Decide(ctx context.Context, input Input) (Decision, error)
+}
+
+// ClaimFilter is an optional interface for Decider to rewrite claims of id_token and userinfo.
+type ClaimFilter interface {
+	FilterClaims(ctx context.Context, input Input) (map[string]interface{}, error)
+}
+
+func decisionFromResult(result interface{}) (Decision, error) {
+	switch r := result.(type) {
+	case nil:
+		return Decision{Allow: false, Reason: "no decision by policy"}, nil
+	case bool:
+		return Decision{Allow: r}, nil
+	case map[string]interface{}:
+		allow, ok := r["allow"].(bool)
+		if !ok {
+			return Decision{}, fmt.Errorf("unexpected policy result: allow is not a boolean")
+		}
+		reason, _ := r["reason"].(string)
+		d := Decision{Allow: allow, Reason: reason}
+
+		switch mfa := r["mfa"].(type) {
+		case nil:
+		case string:
+			d.MFA = &mfa
+		case bool:
+			if mfa {
+				return Decision{}, fmt.Errorf("unexpected policy result: mfa must be a provider name or false")
+			}
+			none := ""
+			d.MFA = &none
+		default:
+			return Decision{}, fmt.Errorf("unexpected policy result: mfa must be a provider name or false")
+		}
+
+		return d, nil
+	default:
+		return Decision{}, fmt.Errorf("unexpected policy result: %#v", result)
+	}
+}
@@ -0,0 +1,130 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+const (
+	REGO_AUTHZ_QUERY  = "data.lauth.authz"
+	REGO_CLAIMS_QUERY = "data.lauth.claims"
+)
+
+// RegoDecider evaluates Rego policies in the directory.
+//
+// The policies should be in `lauth` package. `data.lauth.authz` is used for the authorization decision, and `data.lauth.claims` is used for filtering claims if defined.
+type RegoDecider struct {
+	Dir string
+
+	mu     sync.RWMutex
+	authz  rego.PreparedEvalQuery
+	claims rego.PreparedEvalQuery
+}
+
+func NewRegoDecider(dir string) (*RegoDecider, error) {
+	d := &RegoDecider{Dir: dir}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *RegoDecider) modules() ([]func(*rego.Rego), error) {
+	files, err := filepath.Glob(filepath.Join(d.Dir, "*.rego"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .rego file in %s", d.Dir)
+	}
+
+	var modules []func(*rego.Rego)
+	for _, f := range files {
+		raw, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, rego.Module(f, string(raw)))
+	}
+	return modules, nil
+}
+
+func (d *RegoDecider) prepare(query string, modules []func(*rego.Rego)) (rego.PreparedEvalQuery, error) {
+	return rego.New(append(modules, rego.Query(query))...).PrepareForEval(context.Background())
+}
+
+// Reload reads policies from the directory again.
+// The current policies are kept if failed to load new policies.
+func (d *RegoDecider) Reload() error {
+	modules, err := d.modules()
+	if err != nil {
+		return err
+	}
+
+	authz, err := d.prepare(REGO_AUTHZ_QUERY, modules)
+	if err != nil {
+		return err
+	}
+
+	claims, err := d.prepare(REGO_CLAIMS_QUERY, modules)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.authz = authz
+	d.claims = claims
+
+	return nil
+}
+
+func evalFirst(ctx context.Context, query rego.PreparedEvalQuery, input Input) (interface{}, error) {
+	rs, err := query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return nil, nil
+	}
+	return rs[0].Expressions[0].Value, nil
+}
+
+func (d *RegoDecider) Decide(ctx context.Context, input Input) (Decision, error) {
+	d.mu.RLock()
+	query := d.authz
+	d.mu.RUnlock()
+
+	result, err := evalFirst(ctx, query, input)
+	if err != nil {
+		return Decision{}, err
+	}
+	return decisionFromResult(result)
+}
+
+func (d *RegoDecider) FilterClaims(ctx context.Context, input Input) (map[string]interface{}, error) {
+	d.mu.RLock()
+	query := d.claims
+	d.mu.RUnlock()
+
+	result, err := evalFirst(ctx, query, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return input.Claims, nil
+	}
+
+	claims, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected policy result for claims: %#v", result)
+	}
+	return claims, nil
+}
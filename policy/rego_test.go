@@ -0,0 +1,168 @@
+package policy_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/policy"
+)
+
+func writePolicy(t *testing.T, dir, body string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, "lauth.rego"), []byte(body), 0644); err != nil {
+		t.Fatalf("failed to write policy: %s", err)
+	}
+}
+
+func TestRegoDecider(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := policy.NewRegoDecider(dir); err == nil {
+		t.Errorf("expected error for empty directory but got nil")
+	}
+
+	writePolicy(t, dir, `
+package lauth
+
+default authz = {"allow": false, "reason": "only admin can login"}
+
+authz = {"allow": true} {
+	input.groups[_] == "admin"
+}
+
+claims = {k: v | v := input.claims[k]; k != "phone_number"}
+`)
+
+	d, err := policy.NewRegoDecider(dir)
+	if err != nil {
+		t.Fatalf("failed to load policy: %s", err)
+	}
+
+	decision, err := d.Decide(context.Background(), policy.Input{Subject: "macrat", Groups: []string{"admin"}})
+	if err != nil {
+		t.Errorf("failed to decide: %s", err)
+	} else if decision != (policy.Decision{Allow: true}) {
+		t.Errorf("unexpected decision: %#v", decision)
+	}
+
+	decision, err = d.Decide(context.Background(), policy.Input{Subject: "j.smith", Groups: []string{}})
+	if err != nil {
+		t.Errorf("failed to decide: %s", err)
+	} else if decision != (policy.Decision{Allow: false, Reason: "only admin can login"}) {
+		t.Errorf("unexpected decision: %#v", decision)
+	}
+
+	claims, err := d.FilterClaims(context.Background(), policy.Input{
+		Subject: "macrat",
+		Claims: map[string]interface{}{
+			"sub":          "macrat",
+			"phone_number": "000-1234-5678",
+		},
+	})
+	if err != nil {
+		t.Errorf("failed to filter claims: %s", err)
+	} else if !reflect.DeepEqual(claims, map[string]interface{}{"sub": "macrat"}) {
+		t.Errorf("unexpected claims: %#v", claims)
+	}
+
+	writePolicy(t, dir, `
+package lauth
+
+authz = true
+`)
+	if err := d.Reload(); err != nil {
+		t.Fatalf("failed to reload policy: %s", err)
+	}
+
+	decision, err = d.Decide(context.Background(), policy.Input{Subject: "j.smith"})
+	if err != nil {
+		t.Errorf("failed to decide: %s", err)
+	} else if decision != (policy.Decision{Allow: true}) {
+		t.Errorf("unexpected decision after reload: %#v", decision)
+	}
+
+	input := policy.Input{Claims: map[string]interface{}{"sub": "j.smith"}}
+	claims, err = d.FilterClaims(context.Background(), input)
+	if err != nil {
+		t.Errorf("failed to filter claims: %s", err)
+	} else if !reflect.DeepEqual(claims, input.Claims) {
+		t.Errorf("claims should not change if claims policy is undefined: %#v", claims)
+	}
+
+	writePolicy(t, dir, `this is not a valid rego`)
+	if err := d.Reload(); err == nil {
+		t.Errorf("expected error for invalid policy but got nil")
+	}
+
+	decision, err = d.Decide(context.Background(), policy.Input{Subject: "j.smith"})
+	if err != nil {
+		t.Errorf("failed to decide: %s", err)
+	} else if decision != (policy.Decision{Allow: true}) {
+		t.Errorf("policy should keep after failed to reload: %#v", decision)
+	}
+}
+
+func TestRegoDecider_MFA(t *testing.T) {
+	dir := t.TempDir()
+
+	writePolicy(t, dir, `
+package lauth
+
+default authz = {"allow": true}
+
+authz = {"allow": true, "mfa": false} {
+	net.cidr_contains("10.0.0.0/8", input.remote_addr)
+	input.failed_logins == 0
+}
+
+authz = {"allow": true, "mfa": "duo"} {
+	input.client_id == "admin-console"
+}
+`)
+
+	d, err := policy.NewRegoDecider(dir)
+	if err != nil {
+		t.Fatalf("failed to load policy: %s", err)
+	}
+
+	tests := []struct {
+		Name  string
+		Input policy.Input
+		MFA   *string
+	}{
+		{"undecided", policy.Input{ClientID: "some-client", RemoteAddr: "192.0.2.1"}, nil},
+		{"skip", policy.Input{ClientID: "some-client", RemoteAddr: "10.1.2.3"}, new(string)},
+		{"risky", policy.Input{ClientID: "some-client", RemoteAddr: "10.1.2.3", FailedLogins: 2}, nil},
+		{"provider", policy.Input{ClientID: "admin-console", RemoteAddr: "192.0.2.1"}, func() *string { s := "duo"; return &s }()},
+	}
+
+	for _, tt := range tests {
+		decision, err := d.Decide(context.Background(), tt.Input)
+		if err != nil {
+			t.Errorf("%s: failed to decide: %s", tt.Name, err)
+			continue
+		}
+		if !decision.Allow {
+			t.Errorf("%s: unexpected denied", tt.Name)
+		}
+		if !reflect.DeepEqual(decision.MFA, tt.MFA) {
+			t.Errorf("%s: unexpected mfa: %v", tt.Name, decision.MFA)
+		}
+	}
+
+	writePolicy(t, dir, `
+package lauth
+
+authz = {"allow": true, "mfa": true}
+`)
+	if err := d.Reload(); err != nil {
+		t.Fatalf("failed to reload policy: %s", err)
+	}
+	if _, err := d.Decide(context.Background(), policy.Input{}); err == nil {
+		t.Errorf("expected error for mfa=true but got nil")
+	}
+}
@@ -0,0 +1,55 @@
+package qrcode_test
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/qrcode"
+)
+
+func TestQRCode_PNG(t *testing.T) {
+	q, err := qrcode.Encode([]byte("https://auth.example.com/device"))
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	raw, err := q.PNG(4)
+	if err != nil {
+		t.Fatalf("failed to make PNG: %s", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %s", err)
+	}
+
+	width := (q.Size + qrcode.QuietZone*2) * 4
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != width {
+		t.Errorf("unexpected image size: %s", img.Bounds())
+	}
+
+	// top-left corner of the finder pattern is dark, and the quiet zone is light.
+	if r, _, _, _ := img.At(qrcode.QuietZone*4, qrcode.QuietZone*4).RGBA(); r != 0 {
+		t.Errorf("finder pattern must be dark")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Errorf("quiet zone must be light")
+	}
+}
+
+func TestQRCode_SVG(t *testing.T) {
+	q, err := qrcode.Encode([]byte("https://auth.example.com/device"))
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	svg := q.SVG()
+	if !strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 37 37"`) {
+		t.Errorf("unexpected SVG header: %s", svg[:80])
+	}
+	if !strings.Contains(svg, "M4,4h1v1h-1z") {
+		t.Errorf("top-left module of finder pattern is not drawn")
+	}
+}
@@ -0,0 +1,192 @@
+package qrcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// The example of version 1-M "HELLO WORLD" from the specification.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expect := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if ecc := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(ecc, expect) {
+		t.Errorf("unexpected error correction codewords: %v", ecc)
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	tests := map[int][]int{
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		10: {6, 28, 50},
+		14: {6, 26, 46, 66},
+		15: {6, 26, 48, 70},
+	}
+	for ver, expect := range tests {
+		pos := alignmentPositions(ver)
+		if len(pos) != len(expect) {
+			t.Errorf("version %d: unexpected positions: %v", ver, pos)
+			continue
+		}
+		for i := range pos {
+			if pos[i] != expect[i] {
+				t.Errorf("version %d: unexpected positions: %v", ver, pos)
+				break
+			}
+		}
+	}
+}
+
+// decode reads the data back from the symbol, to check the encoder.
+func decode(t *testing.T, q *QRCode) []byte {
+	t.Helper()
+
+	format := 0
+	for i := 0; i <= 5; i++ {
+		if q.Dark(8, i) {
+			format |= 1 << i
+		}
+	}
+	if q.Dark(8, 7) {
+		format |= 1 << 6
+	}
+	if q.Dark(8, 8) {
+		format |= 1 << 7
+	}
+	if q.Dark(7, 8) {
+		format |= 1 << 8
+	}
+	for i := 9; i < 15; i++ {
+		if q.Dark(14-i, 8) {
+			format |= 1 << i
+		}
+	}
+	format ^= 0x5412
+	if format>>13 != 0 {
+		t.Fatalf("unexpected error correction level: %015b", format)
+	}
+	mask := (format >> 10) & 7
+
+	ref := newQRCode(q.Version)
+	ref.drawFunctionPatterns()
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if ref.function[y][x] && !(y == 8 || x == 8) && ref.modules[y][x] != q.modules[y][x] {
+				t.Fatalf("function pattern is broken at (%d, %d)", x, y)
+			}
+		}
+	}
+
+	var raw []byte
+	var cur byte
+	n := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.Size - 1 - vert
+				}
+				if ref.function[y][x] {
+					continue
+				}
+				cur <<= 1
+				if q.modules[y][x] != maskBit(mask, x, y) {
+					cur |= 1
+				}
+				if n++; n%8 == 0 {
+					raw = append(raw, cur)
+					cur = 0
+				}
+			}
+		}
+	}
+
+	blocks := numBlocks[q.Version]
+	eccLen := eccPerBlock[q.Version]
+	rawCodewords := numRawDataModules(q.Version) / 8
+	numShortBlocks := blocks - rawCodewords%blocks
+	shortBlockLen := rawCodewords / blocks
+
+	dataBlocks := make([][]byte, blocks)
+	k := 0
+	for i := 0; i <= shortBlockLen-eccLen; i++ {
+		for b := 0; b < blocks; b++ {
+			if i < shortBlockLen-eccLen || b >= numShortBlocks {
+				dataBlocks[b] = append(dataBlocks[b], raw[k])
+				k++
+			}
+		}
+	}
+	eccBlocks := make([][]byte, blocks)
+	for i := 0; i < eccLen; i++ {
+		for b := 0; b < blocks; b++ {
+			eccBlocks[b] = append(eccBlocks[b], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	divisor := reedSolomonDivisor(eccLen)
+	for b := range dataBlocks {
+		if !bytes.Equal(reedSolomonRemainder(dataBlocks[b], divisor), eccBlocks[b]) {
+			t.Fatalf("block %d has broken error correction codewords", b)
+		}
+		data = append(data, dataBlocks[b]...)
+	}
+
+	bit := func(i int) int {
+		return int(data[i/8]>>(7-i%8)) & 1
+	}
+	read := func(pos, length int) int {
+		v := 0
+		for i := 0; i < length; i++ {
+			v = v<<1 | bit(pos+i)
+		}
+		return v
+	}
+
+	if mode := read(0, 4); mode != 0x4 {
+		t.Fatalf("unexpected mode: %d", mode)
+	}
+	countBits := 8
+	if q.Version >= 10 {
+		countBits = 16
+	}
+	length := read(4, countBits)
+
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = byte(read(4+countBits+i*8, 8))
+	}
+	return result
+}
+
+func TestEncode(t *testing.T) {
+	for _, n := range []int{0, 1, 14, 15, 100, 150, 213, 214, 300, 412} {
+		data := []byte(strings.Repeat("otpauth://totp/lauth:macrat?secret=JBSWY3DPEHPK3PXP&issuer=lauth", 10)[:n])
+
+		q, err := Encode(data)
+		if err != nil {
+			t.Errorf("%d bytes: failed to encode: %s", n, err)
+			continue
+		}
+		if q.Size != q.Version*4+17 {
+			t.Errorf("%d bytes: unexpected size %d for version %d", n, q.Size, q.Version)
+		}
+
+		if decoded := decode(t, q); !bytes.Equal(decoded, data) {
+			t.Errorf("%d bytes: decoded data is not same:\n%q\n%q", n, data, decoded)
+		}
+	}
+
+	if _, err := Encode(make([]byte, 413)); err != TooLongError {
+		t.Errorf("expected TooLongError but got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package redact
+
+import (
+	"io"
+	"regexp"
+)
+
+const (
+	MASK = "[REDACTED]"
+)
+
+var (
+	SensitiveKeys = `password|passwd|secret|client_secret|code|access_token|refresh_token|id_token|id_token_hint|request|token|authorization`
+
+	patterns = []struct {
+		Pattern     *regexp.Regexp
+		Replacement string
+	}{
+		// JSON style like `"password": "xxx"`.
+		{regexp.MustCompile(`(?i)("(?:` + SensitiveKeys + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`), `${1}"` + MASK + `"`},
+
+		// form or query style like `password=xxx`.
+		{regexp.MustCompile(`(?i)((?:^|[?&\s"'])(?:` + SensitiveKeys + `)=)[^&\s"']+`), `${1}` + MASK},
+
+		// Authorization header.
+		{regexp.MustCompile(`(?i)\b(Bearer|Basic)\s+[A-Za-z0-9._~+/=-]+`), `${1} ` + MASK},
+
+		// JWT, JWS, and JWE.
+		{regexp.MustCompile(`eyJ[A-Za-z0-9_-]*(?:\.[A-Za-z0-9_-]*){1,4}`), MASK},
+
+		// bcrypt hash.
+		{regexp.MustCompile(`\$2[abxy]?\$\d\d\$[./A-Za-z0-9]{53}`), MASK},
+	}
+)
+
+// String masks credentials in the string.
+func String(s string) string {
+	for _, p := range patterns {
+		s = p.Pattern.ReplaceAllString(s, p.Replacement)
+	}
+	return s
+}
+
+// Map masks credentials in the values of the map.
+func Map(m map[string]string) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = String(v)
+	}
+	return result
+}
+
+// Writer masks credentials in data before write into Upstream.
+type Writer struct {
+	Upstream io.Writer
+}
+
+func (w Writer) Write(data []byte) (int, error) {
+	if _, err := w.Upstream.Write([]byte(String(string(data)))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// HTTPSRedirector redirects plain HTTP requests to the same path on the host of the issuer.
+// It always uses the issuer's host instead of the Host header, so it can't be used as an open redirector.
+func HTTPSRedirector(issuer *url.URL) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := url.URL{
+			Scheme:   issuer.Scheme,
+			Host:     issuer.Host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+		if r.URL.Path == "" || r.URL.Path == "/" {
+			target.Path = issuer.Path
+		}
+
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, target.String(), status)
+	})
+}
+
+// autocertCacheDir is the same directory as autocert.NewListener uses, so certificates issued before are still used.
+func autocertCacheDir() string {
+	home := os.Getenv("HOME")
+	if runtime.GOOS == "windows" {
+		home = os.Getenv("HOMEDRIVE") + os.Getenv("HOMEPATH")
+	} else if home == "" {
+		home = "/"
+	}
+
+	const base = "golang-autocert"
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Caches", base)
+	case "windows":
+		for _, ev := range []string{"APPDATA", "CSIDL_APPDATA", "TEMP", "TMP"} {
+			if v := os.Getenv(ev); v != "" {
+				return filepath.Join(v, base)
+			}
+		}
+		return filepath.Join(home, base)
+	}
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, base)
+	}
+	return filepath.Join(home, ".cache", base)
+}
+
+// newAutocertManager makes the same autocert.Manager as autocert.NewListener, to serve ACME challenges on the redirect listener.
+func newAutocertManager(hostname string) *autocert.Manager {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hostname),
+	}
+	dir := autocertCacheDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Warn().Err(err).Msg("failed to make cache directory for TLS certificates")
+	} else {
+		m.Cache = autocert.DirCache(dir)
+	}
+	return m
+}
@@ -0,0 +1,42 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/macrat/lauth"
+)
+
+func TestHTTPSRedirector(t *testing.T) {
+	issuer, _ := url.Parse("https://auth.example.com/auth")
+	handler := main.HTTPSRedirector(issuer)
+
+	tests := []struct {
+		Method   string
+		URL      string
+		Status   int
+		Location string
+	}{
+		{"GET", "http://auth.example.com/", http.StatusMovedPermanently, "https://auth.example.com/auth"},
+		{"GET", "http://auth.example.com/auth/authz?client_id=abc", http.StatusMovedPermanently, "https://auth.example.com/auth/authz?client_id=abc"},
+		{"GET", "http://evil.example.com/auth/authz", http.StatusMovedPermanently, "https://auth.example.com/auth/authz"},
+		{"HEAD", "http://auth.example.com/healthz", http.StatusMovedPermanently, "https://auth.example.com/healthz"},
+		{"POST", "http://auth.example.com/auth/token", http.StatusPermanentRedirect, "https://auth.example.com/auth/token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Method+" "+tt.URL, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.Method, tt.URL, nil))
+
+			if w.Code != tt.Status {
+				t.Errorf("expected status %d but got %d", tt.Status, w.Code)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.Location {
+				t.Errorf("expected Location %#v but got %#v", tt.Location, loc)
+			}
+		})
+	}
+}
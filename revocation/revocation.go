@@ -0,0 +1,200 @@
+// Package revocation implements the denylist of revoked SSO tokens.
+package revocation
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// AlreadyRevokedError means the ID was already in the List when tried to revoke.
+var AlreadyRevokedError = errors.New("token is already revoked")
+
+type entry struct {
+	ID        string `json:"jti"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// List is a set of revoked token IDs.
+//
+// Each ID is kept until the token itself expires.
+type List struct {
+	sync.RWMutex
+
+	path    string
+	entries map[string]time.Time
+}
+
+// NewList makes a new List on memory.
+func NewList() *List {
+	return &List{
+		entries: make(map[string]time.Time),
+	}
+}
+
+// OpenFile loads revoked IDs from the file, and persists new revocations into it.
+//
+// The file will be created if not exists, and expired entries will be removed from it.
+func OpenFile(path string) (*List, error) {
+	l := NewList()
+	l.path = path
+
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func readFile(path string) (map[string]time.Time, error) {
+	entries := make(map[string]time.Time)
+
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	now := time.Now()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+
+		exp := time.Unix(e.ExpiresAt, 0)
+		if exp.After(now) {
+			entries[e.ID] = exp
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// ReadFile reads revoked IDs that not expired yet from the file, without creating or compacting it.
+func ReadFile(path string) (map[string]time.Time, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return make(map[string]time.Time), nil
+	}
+	return readFile(path)
+}
+
+// Reload reads the file again to take in revocations by other process like `lauth revoke-sso`.
+//
+// The current entries are kept if failed to read.
+func (l *List) Reload() error {
+	if l.path == "" {
+		return nil
+	}
+
+	entries, err := readFile(l.path)
+	if err != nil {
+		return err
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.entries = entries
+
+	return nil
+}
+
+func (l *List) compact() error {
+	l.RLock()
+	defer l.RUnlock()
+
+	tmp := l.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for id, exp := range l.entries {
+		if err := enc.Encode(entry{id, exp.Unix()}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, l.path)
+}
+
+// AppendFile writes a revocation into the file without loading it.
+func AppendFile(path, id string, expiresAt time.Time) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(entry{id, expiresAt.Unix()}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Revoke adds the ID into the List until expiresAt.
+//
+// It returns AlreadyRevokedError if the ID is already in the List.
+// Checking and adding are atomic, so only one of concurrent callers with the same ID succeeds.
+func (l *List) Revoke(id string, expiresAt time.Time) error {
+	if id == "" {
+		return nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if exp, ok := l.entries[id]; ok && exp.After(time.Now()) {
+		return AlreadyRevokedError
+	}
+
+	if l.path != "" {
+		if err := AppendFile(l.path, id, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	l.entries[id] = expiresAt
+
+	now := time.Now()
+	for k, exp := range l.entries {
+		if !exp.After(now) {
+			delete(l.entries, k)
+		}
+	}
+
+	return nil
+}
+
+// IsRevoked checks if the ID is revoked.
+func (l *List) IsRevoked(id string) bool {
+	if l == nil || id == "" {
+		return false
+	}
+
+	l.RLock()
+	defer l.RUnlock()
+
+	_, ok := l.entries[id]
+	return ok
+}
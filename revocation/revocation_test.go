@@ -0,0 +1,144 @@
+package revocation_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/revocation"
+)
+
+func TestList(t *testing.T) {
+	l := revocation.NewList()
+
+	if l.IsRevoked("abc") {
+		t.Errorf("abc is not revoked yet but reports as revoked")
+	}
+
+	if err := l.Revoke("abc", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to revoke: %s", err)
+	}
+
+	if !l.IsRevoked("abc") {
+		t.Errorf("abc is revoked but reports as not revoked")
+	}
+	if err := l.Revoke("abc", time.Now().Add(time.Hour)); err != revocation.AlreadyRevokedError {
+		t.Errorf("revoke twice should fail: %v", err)
+	}
+	if l.IsRevoked("def") {
+		t.Errorf("def is not revoked but reports as revoked")
+	}
+	if l.IsRevoked("") {
+		t.Errorf("empty ID must not be revoked")
+	}
+
+	var nilList *revocation.List
+	if nilList.IsRevoked("abc") {
+		t.Errorf("nil list must not report revoked")
+	}
+}
+
+func TestList_ConcurrentRevoke(t *testing.T) {
+	l := revocation.NewList()
+	exp := time.Now().Add(time.Hour)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Revoke("abc", exp); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			} else if err != revocation.AlreadyRevokedError {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 1 {
+		t.Errorf("exactly one revoke should succeed but %d succeeded", succeeded)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revoked.jsonl")
+
+	l, err := revocation.OpenFile(path)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+
+	if err := l.Revoke("abc", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to revoke: %s", err)
+	}
+	if err := l.Revoke("expired", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to revoke: %s", err)
+	}
+
+	if err := revocation.AppendFile(path, "def", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to append: %s", err)
+	}
+	if l.IsRevoked("def") {
+		t.Errorf("def is revoked before reload")
+	}
+	if err := l.Reload(); err != nil {
+		t.Fatalf("failed to reload: %s", err)
+	}
+	if !l.IsRevoked("def") {
+		t.Errorf("def is not revoked even after reload")
+	}
+
+	l, err = revocation.OpenFile(path)
+	if err != nil {
+		t.Fatalf("failed to open again: %s", err)
+	}
+	if !l.IsRevoked("abc") || !l.IsRevoked("def") {
+		t.Errorf("revocations was not persisted")
+	}
+	if l.IsRevoked("expired") {
+		t.Errorf("expired revocation was loaded")
+	}
+
+	if err := os.WriteFile(path, []byte("broken\n"), 0600); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := l.Reload(); err == nil {
+		t.Errorf("expected error for broken file but got nil")
+	}
+	if !l.IsRevoked("abc") {
+		t.Errorf("entries must be kept when failed to reload")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revoked.jsonl")
+
+	entries, err := revocation.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read not existing file: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("unexpected entries: %#v", entries)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("ReadFile must not create the file")
+	}
+
+	revocation.AppendFile(path, "abc", time.Now().Add(time.Hour))
+	revocation.AppendFile(path, "def", time.Now().Add(-time.Hour))
+
+	entries, err = revocation.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err)
+	}
+	if _, ok := entries["abc"]; !ok || len(entries) != 1 {
+		t.Errorf("unexpected entries: %#v", entries)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/revocation"
+	"github.com/spf13/cobra"
+)
+
+type RevokeSSOConfig struct {
+	File   string
+	Expire config.Duration
+}
+
+var (
+	revokeSSOConfig = RevokeSSOConfig{
+		Expire: config.Duration(365 * 24 * time.Hour),
+	}
+	revokeSSOCmd = &cobra.Command{
+		Use:   "revoke-sso SESSION_ID...",
+		Short: "Revoke SSO sessions",
+		Long: `Revoke SSO sessions.
+
+The session ID is recorded as "sso_id" in the access log.
+Please send SIGHUP to the running server to apply revocations.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			expiresAt := time.Now().Add(revokeSSOConfig.Expire.Duration())
+
+			for _, id := range args {
+				if err := revocation.AppendFile(revokeSSOConfig.File, id, expiresAt); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to revoke %s: %s\n", id, err)
+					os.Exit(1)
+				}
+				fmt.Printf("revoked: %s\n", id)
+			}
+		},
+	}
+)
+
+func init() {
+	cmd.AddCommand(revokeSSOCmd)
+
+	flags := revokeSSOCmd.Flags()
+	flags.SortFlags = false
+
+	flags.StringVar(&revokeSSOConfig.File, "sso-revocation-file", "", "File of revoked SSO sessions that the server uses.")
+	flags.Var(&revokeSSOConfig.Expire, "expire", "Duration to keep the revocation. It should be longer than --sso-expire of the server.")
+	revokeSSOCmd.MarkFlagRequired("sso-revocation-file")
+}
@@ -0,0 +1,161 @@
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+
+	// MaxArgon2Time and MaxArgon2Memory are the upper limits of the parameters of argon2id hashes.
+	// Hashes that use larger parameters are rejected, so a broken hash can't make every compare take a long time or exhaust memory.
+	MaxArgon2Time   = 16
+	MaxArgon2Memory = 1024 * 1024 // in KiB
+)
+
+var (
+	InvalidHashError = errors.New("invalid hash format")
+)
+
+// Params is the algorithm and its parameters to hash secrets.
+type Params struct {
+	Algorithm string
+
+	BcryptCost int
+
+	Argon2Time    uint32
+	Argon2Memory  uint32 // in KiB
+	Argon2Threads uint8
+}
+
+// DefaultParams is the parameters that used if not configured.
+var DefaultParams = Params{
+	Algorithm:     AlgorithmBcrypt,
+	BcryptCost:    bcrypt.DefaultCost,
+	Argon2Time:    1,
+	Argon2Memory:  64 * 1024,
+	Argon2Threads: 4,
+}
+
+// Hash makes hash of the secret in the format that Compare accepts.
+// bcrypt makes like "$2a$10$...", and argon2id makes PHC string format like "$argon2id$v=19$m=65536,t=1,p=4$salt$hash".
+func (p Params) Hash(secret []byte) ([]byte, error) {
+	switch p.Algorithm {
+	case AlgorithmBcrypt:
+		return bcrypt.GenerateFromPassword(shash(secret), p.BcryptCost)
+	case AlgorithmArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		key := argon2.IDKey(shash(secret), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, argon2KeyLength)
+		return []byte(fmt.Sprintf(
+			"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version,
+			p.Argon2Memory,
+			p.Argon2Time,
+			p.Argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		)), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %#v", p.Algorithm)
+	}
+}
+
+type argon2Hash struct {
+	Params
+	Salt []byte
+	Key  []byte
+}
+
+func parseArgon2Hash(hash string) (argon2Hash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != AlgorithmArgon2id {
+		return argon2Hash{}, InvalidHashError
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Hash{}, InvalidHashError
+	}
+
+	h := argon2Hash{Params: Params{Algorithm: AlgorithmArgon2id}}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.Argon2Memory, &h.Argon2Time, &h.Argon2Threads); err != nil {
+		return argon2Hash{}, InvalidHashError
+	}
+	if h.Argon2Time < 1 || h.Argon2Time > MaxArgon2Time || h.Argon2Threads < 1 || h.Argon2Memory < 8*uint32(h.Argon2Threads) || h.Argon2Memory > MaxArgon2Memory {
+		return argon2Hash{}, InvalidHashError
+	}
+
+	var err error
+	if h.Salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2Hash{}, InvalidHashError
+	}
+	if h.Key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.Key) == 0 {
+		return argon2Hash{}, InvalidHashError
+	}
+	return h, nil
+}
+
+// hashParams detects the parameters that used to make the hash.
+func hashParams(hash string) (Params, error) {
+	if strings.HasPrefix(hash, "$"+AlgorithmArgon2id+"$") {
+		h, err := parseArgon2Hash(hash)
+		return h.Params, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return Params{}, err
+	}
+	return Params{Algorithm: AlgorithmBcrypt, BcryptCost: cost}, nil
+}
+
+// ValidateHash checks if the hash is a bcrypt or argon2id hash that Compare can use.
+func ValidateHash(hash string) error {
+	_, err := hashParams(hash)
+	return err
+}
+
+// NeedsRehash checks if the hash is made with other algorithm or parameters than p.
+// Hashes that can't parse are reported as not needed, because Compare fails for them anyway.
+func (p Params) NeedsRehash(hash string) bool {
+	current, err := hashParams(hash)
+	if err != nil {
+		return false
+	}
+
+	if current.Algorithm != p.Algorithm {
+		return true
+	}
+	if p.Algorithm == AlgorithmBcrypt {
+		return current.BcryptCost != p.BcryptCost
+	}
+	return current.Argon2Time != p.Argon2Time || current.Argon2Memory != p.Argon2Memory || current.Argon2Threads != p.Argon2Threads
+}
+
+func compareArgon2(hash, secret string) error {
+	h, err := parseArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey(shash([]byte(secret)), h.Salt, h.Argon2Time, h.Argon2Memory, h.Argon2Threads, uint32(len(h.Key)))
+	if subtle.ConstantTimeCompare(key, h.Key) != 1 {
+		return bcrypt.ErrMismatchedHashAndPassword
+	}
+	return nil
+}
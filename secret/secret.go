@@ -3,6 +3,10 @@ package secret
 import (
 	"crypto/rand"
 	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,22 +24,71 @@ func shash(secret []byte) []byte {
 	return h[:]
 }
 
-func bhash(secret []byte) ([]byte, error) {
-	b, err := bcrypt.GenerateFromPassword(secret, bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
-	}
-	return b, nil
+var (
+	paramsLock    sync.RWMutex
+	currentParams = DefaultParams
+)
+
+// SetParams changes the algorithm and parameters for Hash, Generate, and CompareDummy.
+func SetParams(p Params) {
+	paramsLock.Lock()
+	defer paramsLock.Unlock()
+
+	currentParams = p
+}
+
+// CurrentParams returns the parameters that set by SetParams.
+func CurrentParams() Params {
+	paramsLock.RLock()
+	defer paramsLock.RUnlock()
+
+	return currentParams
 }
 
 func Hash(secret []byte) ([]byte, error) {
-	return bhash(shash(secret))
+	return CurrentParams().Hash(secret)
 }
 
+// Compare checks the secret with the hash that made by bcrypt or argon2id.
 func Compare(hash, secret string) error {
+	if strings.HasPrefix(hash, "$"+AlgorithmArgon2id+"$") {
+		return compareArgon2(hash, secret)
+	}
 	return bcrypt.CompareHashAndPassword([]byte(hash), shash([]byte(secret)))
 }
 
+var (
+	dummyLock   sync.Mutex
+	dummyHash   string
+	dummyParams Params
+
+	DummyCompareError = errors.New("compared with dummy hash")
+)
+
+// CompareDummy takes the same time as Compare but always fails.
+// Use this when the hash to compare is not found, for preventing to guess the existence by timing.
+func CompareDummy(secret string) error {
+	p := CurrentParams()
+
+	dummyLock.Lock()
+	if dummyHash == "" || dummyParams != p {
+		if h, err := p.Hash([]byte("dummy secret")); err == nil {
+			dummyHash, dummyParams = string(h), p
+		}
+	}
+	hash := dummyHash
+	dummyLock.Unlock()
+
+	Compare(hash, secret)
+	return DummyCompareError
+}
+
+// Equal compares two secrets in constant time.
+// Secrets are hashed before compare, so it doesn't leak even the length of secrets.
+func Equal(a, b string) bool {
+	return subtle.ConstantTimeCompare(shash([]byte(a)), shash([]byte(b))) == 1
+}
+
 func generatePlainSecret() ([]byte, error) {
 	b := make([]byte, LENGTH)
 	if _, err := rand.Read(b); err != nil {
@@ -22,3 +22,112 @@ func TestGenerate(t *testing.T) {
 		}
 	}
 }
+
+func TestCompareDummy(t *testing.T) {
+	if err := secret.CompareDummy("dummy secret"); err != secret.DummyCompareError {
+		t.Errorf("expected DummyCompareError but got %v", err)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		A, B   string
+		Expect bool
+	}{
+		{"hello", "hello", true},
+		{"hello", "world", false},
+		{"hello", "hello world", false},
+		{"", "", true},
+		{"", "hello", false},
+	}
+
+	for _, tt := range tests {
+		if got := secret.Equal(tt.A, tt.B); got != tt.Expect {
+			t.Errorf("Equal(%#v, %#v): expected %t but got %t", tt.A, tt.B, tt.Expect, got)
+		}
+	}
+}
+
+func TestParams_Hash(t *testing.T) {
+	argon2 := secret.DefaultParams
+	argon2.Algorithm = secret.AlgorithmArgon2id
+	argon2.Argon2Memory = 1024
+
+	for _, p := range []secret.Params{secret.DefaultParams, argon2} {
+		t.Run(p.Algorithm, func(t *testing.T) {
+			hash, err := p.Hash([]byte("hello world"))
+			if err != nil {
+				t.Fatalf("failed to hash: %s", err)
+			}
+
+			if err := secret.Compare(string(hash), "hello world"); err != nil {
+				t.Errorf("failed to compare with correct secret: %s", err)
+			}
+			if err := secret.Compare(string(hash), "hello"); err == nil {
+				t.Errorf("expected error with wrong secret but got nil")
+			}
+
+			if p.NeedsRehash(string(hash)) {
+				t.Errorf("hash made with the same params reported as needs rehash")
+			}
+		})
+	}
+}
+
+func TestParams_NeedsRehash(t *testing.T) {
+	bcrypt, err := secret.DefaultParams.Hash([]byte("hello"))
+	if err != nil {
+		t.Fatalf("failed to hash: %s", err)
+	}
+	argon2 := "$argon2id$v=19$m=1024,t=1,p=4$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		Name   string
+		Params secret.Params
+		Hash   string
+		Expect bool
+	}{
+		{"bcrypt-same", secret.Params{Algorithm: secret.AlgorithmBcrypt, BcryptCost: 10}, string(bcrypt), false},
+		{"bcrypt-cost", secret.Params{Algorithm: secret.AlgorithmBcrypt, BcryptCost: 12}, string(bcrypt), true},
+		{"bcrypt-to-argon2", secret.Params{Algorithm: secret.AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 4}, string(bcrypt), true},
+		{"argon2-same", secret.Params{Algorithm: secret.AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 4}, argon2, false},
+		{"argon2-memory", secret.Params{Algorithm: secret.AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 65536, Argon2Threads: 4}, argon2, true},
+		{"argon2-to-bcrypt", secret.Params{Algorithm: secret.AlgorithmBcrypt, BcryptCost: 10}, argon2, true},
+		{"invalid", secret.DefaultParams, "$argon2id$broken", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.Params.NeedsRehash(tt.Hash); got != tt.Expect {
+			t.Errorf("%s: expected %t but got %t", tt.Name, tt.Expect, got)
+		}
+	}
+}
+
+func TestCompare_InvalidArgon2(t *testing.T) {
+	if err := secret.Compare("$argon2id$v=19$m=1024$broken", "hello"); err != secret.InvalidHashError {
+		t.Errorf("expected InvalidHashError but got %v", err)
+	}
+}
+
+func TestCompare_Argon2Params(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Params string
+	}{
+		{"zero-time", "m=1024,t=0,p=4"},
+		{"zero-threads", "m=1024,t=1,p=0"},
+		{"too-much-time", "m=1024,t=1000000,p=4"},
+		{"too-much-memory", "m=4294967295,t=1,p=4"},
+		{"too-little-memory", "m=8,t=1,p=4"},
+	}
+
+	for _, tt := range tests {
+		hash := "$argon2id$v=19$" + tt.Params + "$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+		if err := secret.ValidateHash(hash); err != secret.InvalidHashError {
+			t.Errorf("%s: expected InvalidHashError from ValidateHash but got %v", tt.Name, err)
+		}
+		if err := secret.Compare(hash, "hello"); err != secret.InvalidHashError {
+			t.Errorf("%s: expected InvalidHashError from Compare but got %v", tt.Name, err)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"github.com/macrat/lauth/config"
+)
+
+func isWindowsService() (bool, error) {
+	return false, nil
+}
+
+func runService(conf *config.Config) {
+	panic("not supported on this platform")
+}
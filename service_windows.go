@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/redact"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	eventIDLog   = 1
+	eventIDAudit = 2
+)
+
+type ServiceConfig struct {
+	Name        string
+	DisplayName string
+}
+
+var (
+	serviceName   = "lauth"
+	serviceConfig = ServiceConfig{}
+	serviceCmd    = &cobra.Command{
+		Use:   "service",
+		Short: "Manage Windows service",
+	}
+	serviceInstallCmd = &cobra.Command{
+		Use:   "install [-- SERVER OPTIONS...]",
+		Short: "Register lauth as a Windows service",
+		Long: "Register lauth as a Windows service that starts automatically, and register the event source for the Windows Event Log.\n" +
+			"Options after \"--\" are passed to the server, like \"lauth service install -- --config C:\\lauth\\config.toml\".",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := InstallService(serviceConfig, args); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to install service: %s\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("installed: %s\n", serviceConfig.Name)
+		},
+	}
+	serviceUninstallCmd = &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove the Windows service of lauth",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := UninstallService(serviceConfig.Name); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to uninstall service: %s\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("uninstalled: %s\n", serviceConfig.Name)
+		},
+	}
+)
+
+func init() {
+	cmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(serviceInstallCmd, serviceUninstallCmd)
+
+	serviceCmd.PersistentFlags().StringVar(&serviceConfig.Name, "name", "lauth", "Name of the service.")
+	serviceInstallCmd.Flags().StringVar(&serviceConfig.DisplayName, "display-name", "Lauth OpenID Provider", "Display name of the service.")
+
+	// The service name is passed by the service that installed, to use the same name as the source of the event log.
+	cmd.Flags().StringVar(&serviceName, "service-name", "lauth", "Name of the Windows service.")
+	cmd.Flags().MarkHidden("service-name")
+}
+
+func InstallService(conf ServiceConfig, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(conf.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", conf.Name)
+	}
+
+	s, err := m.CreateService(conf.Name, exe, mgr.Config{
+		DisplayName: conf.DisplayName,
+		Description: "The simple OpenID Provider for LDAP like an ActiveDirectory.",
+		StartType:   mgr.StartAutomatic,
+	}, append([]string{"--service-name", conf.Name}, args...)...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(conf.Name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event source: %s", err)
+	}
+	return nil
+}
+
+func UninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	return eventlog.Remove(name)
+}
+
+// eventLogWriter writes logs into the Windows Event Log.
+// The event type is decided by the level of zerolog, and entries without level like audit logs are written as information.
+type eventLogWriter struct {
+	log *eventlog.Log
+	id  uint32
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	var entry struct {
+		Level string `json:"level"`
+	}
+	json.Unmarshal(p, &entry)
+
+	msg := string(bytes.TrimSpace(p))
+
+	var err error
+	switch entry.Level {
+	case "error", "fatal", "panic":
+		err = w.log.Error(w.id, msg)
+	case "warn":
+		err = w.log.Warning(w.id, msg)
+	default:
+		err = w.log.Info(w.id, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type service struct {
+	conf *config.Config
+}
+
+func (s service) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(s.conf, stop)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				close(stop)
+				<-done
+				return false, 0
+			}
+		case <-done:
+			log.Error().Msg("server stopped unexpectedly")
+			return false, 1
+		}
+	}
+}
+
+func isWindowsService() (bool, error) {
+	return svc.IsWindowsService()
+}
+
+// runService serves as a Windows service, and writes logs into the Windows Event Log instead of stderr.
+func runService(conf *config.Config) {
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		log.Fatal().Msgf("failed to open event log: %s", err)
+	}
+	defer elog.Close()
+
+	log.Logger = log.Output(redact.Writer{Upstream: eventLogWriter{log: elog, id: eventIDLog}})
+	auditMirror = eventLogWriter{log: elog, id: eventIDAudit}
+
+	if err := svc.Run(serviceName, service{conf: conf}); err != nil {
+		log.Fatal().Msgf("failed to run as a service: %s", err)
+	}
+}
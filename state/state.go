@@ -0,0 +1,167 @@
+// Package state exports and imports the persistent state of lauth as an encrypted archive, for backup and cloning environments.
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Version is the version of the archive format.
+	Version = 1
+
+	kdfArgon2id = "argon2id"
+
+	// Upper limits of the key derivation parameters in archives, so a broken archive can't exhaust CPU or memory.
+	maxKDFTime   = 16
+	maxKDFMemory = 1024 * 1024 // in KiB
+)
+
+var (
+	EmptyPassphraseError = errors.New("passphrase is empty")
+	DecryptError         = errors.New("failed to decrypt: the passphrase is wrong or the archive is broken")
+)
+
+// Revocation is a revoked SSO session.
+type Revocation struct {
+	ID        string `json:"jti"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// State is the persistent state of lauth.
+//
+// Users are not included because they are in the LDAP server.
+// Tokens are not included either, because they are signed by the sign key and not stored in lauth.
+type State struct {
+	CreatedAt   int64                  `json:"created_at"`
+	Clients     config.ClientConfigSet `json:"clients"`
+	Revocations []Revocation           `json:"sso_revocations"`
+}
+
+// SetRevocations sets revocations from the entries of the revocation list, and drops expired ones.
+func (s *State) SetRevocations(entries map[string]time.Time, now time.Time) {
+	s.Revocations = []Revocation{}
+	for id, exp := range entries {
+		if exp.After(now) {
+			s.Revocations = append(s.Revocations, Revocation{ID: id, ExpiresAt: exp.Unix()})
+		}
+	}
+	sort.Slice(s.Revocations, func(i, j int) bool {
+		return s.Revocations[i].ID < s.Revocations[j].ID
+	})
+}
+
+type envelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// validate checks the key derivation parameters before using them, because argon2 panics with zero time or threads.
+func (e envelope) validate() error {
+	if e.KDF != kdfArgon2id {
+		return fmt.Errorf("unsupported key derivation: %#v", e.KDF)
+	}
+	if e.Time < 1 || e.Time > maxKDFTime || e.Threads < 1 || e.Memory < 8*uint32(e.Threads) || e.Memory > maxKDFMemory {
+		return fmt.Errorf("invalid key derivation parameters: time=%d, memory=%d, threads=%d", e.Time, e.Memory, e.Threads)
+	}
+	return nil
+}
+
+func (e envelope) cipher(passphrase []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey(passphrase, e.Salt, e.Time, e.Memory, e.Threads, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Export writes the state as an archive that encrypted by AES-GCM with a key derived from the passphrase by argon2id.
+func Export(w io.Writer, s State, passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return EmptyPassphraseError
+	}
+
+	plain, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	e := envelope{
+		Version: Version,
+		KDF:     kdfArgon2id,
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+		Salt:    make([]byte, 16),
+	}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return err
+	}
+
+	aead, err := e.cipher(passphrase)
+	if err != nil {
+		return err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return err
+	}
+	e.Data = aead.Seal(nil, e.Nonce, plain, nil)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+// Import reads the archive that made by Export.
+func Import(r io.Reader, passphrase []byte) (State, error) {
+	if len(passphrase) == 0 {
+		return State{}, EmptyPassphraseError
+	}
+
+	var e envelope
+	if err := json.NewDecoder(r).Decode(&e); err != nil {
+		return State{}, fmt.Errorf("invalid archive: %s", err)
+	}
+	if e.Version != Version {
+		return State{}, fmt.Errorf("unsupported archive version: %d", e.Version)
+	}
+	if err := e.validate(); err != nil {
+		return State{}, err
+	}
+
+	aead, err := e.cipher(passphrase)
+	if err != nil {
+		return State{}, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return State{}, DecryptError
+	}
+	plain, err := aead.Open(nil, e.Nonce, e.Data, nil)
+	if err != nil {
+		return State{}, DecryptError
+	}
+
+	var s State
+	if err := json.Unmarshal(plain, &s); err != nil {
+		return State{}, fmt.Errorf("invalid archive: %s", err)
+	}
+	return s, nil
+}
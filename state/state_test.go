@@ -0,0 +1,109 @@
+package state_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/state"
+)
+
+func TestExportImport(t *testing.T) {
+	s := state.State{
+		CreatedAt: 1234567890,
+		Clients: config.ClientConfigSet{
+			"some_client": {
+				Name:   "Some Client",
+				Secret: "$2a$10$hashed",
+			},
+		},
+		Revocations: []state.Revocation{
+			{ID: "abc", ExpiresAt: 2345678901},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := state.Export(&buf, s, []byte("hello world")); err != nil {
+		t.Fatalf("failed to export: %s", err)
+	}
+
+	if strings.Contains(buf.String(), "Some Client") || strings.Contains(buf.String(), "abc") {
+		t.Errorf("archive is not encrypted:\n%s", buf.String())
+	}
+
+	got, err := state.Import(bytes.NewReader(buf.Bytes()), []byte("hello world"))
+	if err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("unexpected state imported\nexpected: %#v\n but got: %#v", s, got)
+	}
+
+	if _, err := state.Import(bytes.NewReader(buf.Bytes()), []byte("wrong passphrase")); err != state.DecryptError {
+		t.Errorf("expected DecryptError with wrong passphrase but got %v", err)
+	}
+
+	broken := bytes.Replace(buf.Bytes(), []byte(`"version": 1`), []byte(`"version": 2`), 1)
+	if _, err := state.Import(bytes.NewReader(broken), []byte("hello world")); err == nil || err.Error() != "unsupported archive version: 2" {
+		t.Errorf("expected version error but got %v", err)
+	}
+}
+
+func TestImport_InvalidKDF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := state.Export(&buf, state.State{}, []byte("hello world")); err != nil {
+		t.Fatalf("failed to export: %s", err)
+	}
+
+	tests := []struct {
+		Name  string
+		From  string
+		To    string
+		Error string
+	}{
+		{"kdf", `"kdf": "argon2id"`, `"kdf": "scrypt"`, `unsupported key derivation: "scrypt"`},
+		{"zero-time", `"time": 3`, `"time": 0`, "invalid key derivation parameters: time=0, memory=65536, threads=4"},
+		{"zero-threads", `"threads": 4`, `"threads": 0`, "invalid key derivation parameters: time=3, memory=65536, threads=0"},
+		{"too-much-time", `"time": 3`, `"time": 100000`, "invalid key derivation parameters: time=100000, memory=65536, threads=4"},
+		{"too-much-memory", `"memory": 65536`, `"memory": 4294967295`, "invalid key derivation parameters: time=3, memory=4294967295, threads=4"},
+	}
+
+	for _, tt := range tests {
+		broken := bytes.Replace(buf.Bytes(), []byte(tt.From), []byte(tt.To), 1)
+		if _, err := state.Import(bytes.NewReader(broken), []byte("hello world")); err == nil || err.Error() != tt.Error {
+			t.Errorf("%s: expected error %#v but got %v", tt.Name, tt.Error, err)
+		}
+	}
+}
+
+func TestExport_EmptyPassphrase(t *testing.T) {
+	var buf bytes.Buffer
+	if err := state.Export(&buf, state.State{}, nil); err != state.EmptyPassphraseError {
+		t.Errorf("expected EmptyPassphraseError but got %v", err)
+	}
+	if _, err := state.Import(&buf, nil); err != state.EmptyPassphraseError {
+		t.Errorf("expected EmptyPassphraseError but got %v", err)
+	}
+}
+
+func TestState_SetRevocations(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	var s state.State
+	s.SetRevocations(map[string]time.Time{
+		"b":       time.Unix(2000, 0),
+		"a":       time.Unix(3000, 0),
+		"expired": time.Unix(500, 0),
+	}, now)
+
+	expect := []state.Revocation{
+		{ID: "a", ExpiresAt: 3000},
+		{ID: "b", ExpiresAt: 2000},
+	}
+	if !reflect.DeepEqual(s.Revocations, expect) {
+		t.Errorf("unexpected revocations: %#v", s.Revocations)
+	}
+}
@@ -19,7 +19,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/backchannel"
 	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/feature"
+	"github.com/macrat/lauth/page"
 	"github.com/rs/zerolog"
 )
 
@@ -45,7 +49,12 @@ func FindAvailTCPPort() int {
 func MakeTestRouter() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	router.LoadHTMLGlob("../page/html/*.tmpl")
+
+	renderer, err := page.NewRenderer(config.TemplateConfig{Language: "en,ja"})
+	if err != nil {
+		panic(err.Error())
+	}
+	router.HTMLRender = renderer
 
 	return router
 }
@@ -53,6 +62,13 @@ func MakeTestRouter() *gin.Engine {
 //go:embed config.toml
 var configTemplate string
 
+// LoginSession is the login session cookie that sent by Get and Post of APITestEnvironment.
+// Request objects for POST /authz have to include LoginSessionHash of it.
+var LoginSession = "login-session-for-testing-0123456789"
+
+// LoginSessionHash is the hash of LoginSession to embed into request objects.
+var LoginSessionHash = api.LoginSessionHash(LoginSession)
+
 func MakeConfig() *config.Config {
 	conf := &config.Config{}
 	port := FindAvailTCPPort()
@@ -89,10 +105,19 @@ func NewAPITestEnvironment(t *testing.T) *APITestEnvironment {
 		t.Fatalf("failed to make jwt certs: %s", err)
 	}
 
+	conf := MakeConfig()
+
+	features, err := feature.New(conf.Features)
+	if err != nil {
+		t.Fatalf("failed to make feature flags: %s", err)
+	}
+
 	api := &api.LauthAPI{
 		Connector:    LDAP,
-		Config:       MakeConfig(),
+		Config:       conf,
 		TokenManager: tokenManager,
+		Backchannel:  backchannel.NewStore(),
+		Features:     features,
 	}
 	api.SetRoutes(router)
 	api.SetErrorRoutes(router)
@@ -112,6 +137,7 @@ func (env *APITestEnvironment) DoRequest(r *http.Request) *httptest.ResponseReco
 func (env *APITestEnvironment) Get(path, token string, query url.Values) *httptest.ResponseRecorder {
 	r, _ := http.NewRequest("GET", path+"?"+query.Encode(), nil)
 	r.RemoteAddr = "[::1]:54321"
+	r.AddCookie(&http.Cookie{Name: api.LOGIN_SESSION_COOKIE, Value: LoginSession})
 
 	if token != "" {
 		r.Header.Set("Authorization", token)
@@ -123,6 +149,7 @@ func (env *APITestEnvironment) Get(path, token string, query url.Values) *httpte
 func (env *APITestEnvironment) Post(path, token string, body url.Values) *httptest.ResponseRecorder {
 	r, _ := http.NewRequest("POST", path, strings.NewReader(body.Encode()))
 	r.RemoteAddr = "[::1]:54321"
+	r.AddCookie(&http.Cookie{Name: api.LOGIN_SESSION_COOKIE, Value: LoginSession})
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	if token != "" {
@@ -198,10 +225,10 @@ func (env *APITestEnvironment) RedirectTest(t *testing.T, method, endpoint strin
 				if tt.CheckParams != nil {
 					tt.CheckParams(t, loc.Query(), fragment)
 				} else {
-					if !reflect.DeepEqual(loc.Query(), tt.Query) {
+					if !reflect.DeepEqual(loc.Query(), expectErrorURI(tt.Query)) {
 						t.Errorf("redirect with unexpected query: %#v", location)
 					}
-					if !reflect.DeepEqual(fragment, tt.Fragment) {
+					if !reflect.DeepEqual(fragment, expectErrorURI(tt.Fragment)) {
 						t.Errorf("redirect with unexpected fragment: %#v", location)
 					}
 				}
@@ -210,6 +237,43 @@ func (env *APITestEnvironment) RedirectTest(t *testing.T, method, endpoint strin
 	}
 }
 
+// expectErrorURI adds error_uri to the expected parameters of an error redirect, because the server always sets it.
+func expectErrorURI(params url.Values) url.Values {
+	if params.Get("error") == "" || params.Get("error_uri") != "" {
+		return params
+	}
+	e := &errors.Error{Reason: errors.Reason(params.Get("error"))}
+
+	expected := make(url.Values)
+	for k, v := range params {
+		expected[k] = v
+	}
+	expected.Set("error_uri", e.ErrorURI())
+	return expected
+}
+
+// expectErrorCode adds error_code and error_uri to the expected body of an error response, because the server always sets them.
+func expectErrorCode(body map[string]interface{}) map[string]interface{} {
+	reason, ok := body["error"].(string)
+	if !ok {
+		return body
+	}
+	if _, ok := body["error_code"]; ok {
+		return body
+	}
+	e := &errors.Error{Reason: errors.Reason(reason)}
+
+	expected := make(map[string]interface{})
+	for k, v := range body {
+		expected[k] = v
+	}
+	expected["error_code"] = string(e.ErrorCode())
+	if uri := e.ErrorURI(); uri != "" {
+		expected["error_uri"] = uri
+	}
+	return expected
+}
+
 type RawBody []byte
 
 func (body RawBody) Bind(target interface{}) error {
@@ -246,7 +310,7 @@ func (env *APITestEnvironment) JSONTest(t *testing.T, method, endpoint string, t
 				var body map[string]interface{}
 				if err := json.Unmarshal(rawBody, &body); err != nil {
 					t.Errorf("failed to unmarshal response body: %s", err)
-				} else if !reflect.DeepEqual(body, tt.Body) {
+				} else if !reflect.DeepEqual(body, expectErrorCode(tt.Body)) {
 					t.Errorf("unexpected response body: %s", string(rawBody))
 				}
 			}
@@ -283,10 +347,17 @@ func (env *APITestEnvironment) Start(t *testing.T) (stop func()) {
 	go func() {
 		err := env.Run(ctx)
 		if err != nil {
-			t.Fatalf("failed on test server: %s", err)
+			t.Errorf("failed on test server: %s", err)
 		}
 	}()
 	time.Sleep(100 * time.Millisecond)
 
 	return stop
 }
+
+// UseFakeClock replaces the clock of the token manager with FakeClock that starts at now.
+func (env *APITestEnvironment) UseFakeClock(now time.Time) *FakeClock {
+	clock := NewFakeClock(now)
+	env.API.TokenManager = env.API.TokenManager.WithClock(clock)
+	return clock
+}
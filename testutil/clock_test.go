@@ -0,0 +1,27 @@
+package testutil_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2021, 6, 30, 23, 59, 59, 0, time.UTC)
+	clock := testutil.NewFakeClock(start)
+
+	if !clock.Now().Equal(start) {
+		t.Errorf("unexpected time: %s", clock.Now())
+	}
+
+	clock.Advance(2 * time.Second)
+	if expect := time.Date(2021, 7, 1, 0, 0, 1, 0, time.UTC); !clock.Now().Equal(expect) {
+		t.Errorf("unexpected time after advance: %s", clock.Now())
+	}
+
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("unexpected time after set: %s", clock.Now())
+	}
+}
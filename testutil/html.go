@@ -1,8 +1,12 @@
 package testutil
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"testing"
+
+	"github.com/macrat/lauth/page"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
@@ -56,3 +60,16 @@ func FindRequestObjectByHTML(body io.Reader) (string, error) {
 		return req, nil
 	}
 }
+
+// AssertAccessible reports problems of a rendered page that found by page.AuditHTML.
+func AssertAccessible(t *testing.T, name string, body []byte) {
+	t.Helper()
+
+	problems, err := page.AuditHTML(name, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to audit page: %s", err)
+	}
+	for _, p := range problems {
+		t.Errorf("%s", p)
+	}
+}
@@ -2,7 +2,9 @@ package testutil
 
 import (
 	"fmt"
+	"strings"
 
+	goldap "github.com/go-ldap/ldap/v3"
 	"github.com/macrat/lauth/ldap"
 )
 
@@ -16,6 +18,10 @@ var (
 				"sn":              {"shida"},
 				"mail":            {"m@crat.jp"},
 				"telephoneNumber": {"000-1234-5678"},
+				"memberOf": {
+					"CN=grafana-admins,OU=groups,DC=example,DC=com",
+					"CN=users,OU=groups,DC=example,DC=com",
+				},
 			},
 		},
 		"j.smith": DummyUserInfo{
@@ -32,6 +38,7 @@ var (
 
 type DummyUserInfo struct {
 	Password   string
+	Disabled   bool
 	Attributes map[string][]string
 }
 
@@ -45,11 +52,17 @@ func (c DummyLDAP) Close() error {
 	return nil
 }
 
+func (c DummyLDAP) Ping() error {
+	return nil
+}
+
 func (c DummyLDAP) LoginTest(username, password string) error {
 	if user, ok := c[username]; !ok {
 		return ldap.UserNotFoundError
 	} else if user.Password != password {
-		return fmt.Errorf("incorrect password")
+		return goldap.NewError(goldap.LDAPResultInvalidCredentials, fmt.Errorf("incorrect password"))
+	} else if user.Disabled {
+		return goldap.NewError(goldap.LDAPResultInvalidCredentials, fmt.Errorf("AcceptSecurityContext error, data 533, v4563"))
 	}
 	return nil
 }
@@ -68,3 +81,78 @@ func (c DummyLDAP) GetUserAttributes(username string, attributes []string) (map[
 	}
 	return result, nil
 }
+
+func (c DummyLDAP) CreateUser(baseDN, username, password string, attributes map[string][]string) error {
+	if _, ok := c[username]; ok {
+		return ldap.UserAlreadyExistsError
+	}
+
+	attrs := make(map[string][]string)
+	for k, v := range attributes {
+		attrs[k] = v
+	}
+	attrs["dn"] = []string{fmt.Sprintf("uid=%s,%s", username, baseDN)}
+
+	c[username] = DummyUserInfo{
+		Password:   password,
+		Attributes: attrs,
+	}
+	return nil
+}
+
+func (c DummyLDAP) AddGroupMember(groupDN, attribute, username string) error {
+	user, ok := c[username]
+	if !ok {
+		return ldap.UserNotFoundError
+	}
+
+	user.Attributes["memberOf"] = append(user.Attributes["memberOf"], groupDN)
+	return nil
+}
+
+// Copy makes a copy of DummyLDAP for tests that modify users.
+func (c DummyLDAP) Copy() DummyLDAP {
+	d := make(DummyLDAP)
+	for k, v := range c {
+		attrs := make(map[string][]string)
+		for ak, av := range v.Attributes {
+			attrs[ak] = av
+		}
+		d[k] = DummyUserInfo{
+			Password:   v.Password,
+			Attributes: attrs,
+		}
+	}
+	return d
+}
+
+func (c DummyLDAP) ActivateUser(username, password string) error {
+	user, ok := c[username]
+	if !ok {
+		return ldap.UserNotFoundError
+	}
+
+	user.Password = password
+	c[username] = user
+	return nil
+}
+
+// AttributeTypes returns attributes that any user has, as the schema of DummyLDAP.
+func (c DummyLDAP) AttributeTypes() (map[string]bool, error) {
+	types := make(map[string]bool)
+	for _, user := range c {
+		for name := range user.Attributes {
+			types[strings.ToLower(name)] = true
+		}
+	}
+	return types, nil
+}
+
+func (c DummyLDAP) HasAttribute(attribute string) (bool, error) {
+	for _, user := range c {
+		if len(user.Attributes[attribute]) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,307 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// RP is a simulated OpenID Connect relying party.
+// It talks to the APITestEnvironment without network, like the real client does via browser.
+type RP struct {
+	Env          *APITestEnvironment
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+}
+
+// NewRP makes a RP for the client that registered in testutil/config.toml.
+func (env *APITestEnvironment) NewRP(clientID, clientSecret, redirectURI string) *RP {
+	return &RP{
+		Env:          env,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+	}
+}
+
+// SomeClientRP makes a RP of some_client_id.
+func (env *APITestEnvironment) SomeClientRP() *RP {
+	return env.NewRP("some_client_id", "secret for some-client", "http://some-client.example.com/callback")
+}
+
+// ImplicitClientRP makes a RP of implicit_client_id.
+func (env *APITestEnvironment) ImplicitClientRP() *RP {
+	return env.NewRP("implicit_client_id", "secret for implicit-client", "http://implicit-client.example.com/callback")
+}
+
+// AuthzResponse is a response of the authorization endpoint.
+type AuthzResponse struct {
+	Code     int
+	Body     []byte
+	Location *url.URL
+	Query    url.Values
+	Fragment url.Values
+}
+
+// Params returns parameters of the redirect, from the fragment if set, or from the query.
+func (resp *AuthzResponse) Params() url.Values {
+	if len(resp.Fragment) > 0 {
+		return resp.Fragment
+	}
+	return resp.Query
+}
+
+func parseAuthzResponse(t *testing.T, code int, header http.Header, body []byte) *AuthzResponse {
+	t.Helper()
+
+	resp := &AuthzResponse{
+		Code:     code,
+		Body:     body,
+		Query:    url.Values{},
+		Fragment: url.Values{},
+	}
+
+	location := header.Get("Location")
+	if location == "" {
+		return resp
+	}
+
+	loc, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("failed to parse Location header: %s", err)
+	}
+	resp.Location = loc
+	resp.Query = loc.Query()
+
+	resp.Fragment, err = url.ParseQuery(loc.Fragment)
+	if err != nil {
+		t.Fatalf("failed to parse Location fragment: %s", err)
+	}
+
+	return resp
+}
+
+// AuthzRequest makes parameters for the authorization endpoint.
+// client_id, redirect_uri, and response_type are set if params doesn't have them.
+func (rp *RP) AuthzRequest(params url.Values) url.Values {
+	req := url.Values{
+		"client_id":     {rp.ClientID},
+		"redirect_uri":  {rp.RedirectURI},
+		"response_type": {"code"},
+	}
+	for k, v := range params {
+		req[k] = v
+	}
+	return req
+}
+
+// Authorize sends GET request to the authorization endpoint.
+func (rp *RP) Authorize(t *testing.T, params url.Values) *AuthzResponse {
+	t.Helper()
+
+	resp := rp.Env.Get(rp.Env.API.Config.Endpoints.Authz, "", rp.AuthzRequest(params))
+	return parseAuthzResponse(t, resp.Code, resp.Header(), resp.Body.Bytes())
+}
+
+// Login opens the login page and submits the login form with username and password.
+func (rp *RP) Login(t *testing.T, params url.Values, username, password string) *AuthzResponse {
+	t.Helper()
+
+	page := rp.Authorize(t, params)
+	if page.Code != http.StatusOK {
+		t.Fatalf("failed to open login page: status code %d: %s", page.Code, page.Location)
+	}
+
+	inputs, err := FindInputsByHTML(bytes.NewReader(page.Body))
+	if err != nil {
+		t.Fatalf("failed to parse login page: %s", err)
+	}
+	if inputs["request"] == "" {
+		t.Fatalf("request object is not in the login page")
+	}
+
+	form := url.Values{}
+	for k, v := range inputs {
+		form.Set(k, v)
+	}
+	form.Set("username", username)
+	form.Set("password", password)
+
+	resp := rp.Env.Post(rp.Env.API.Config.Endpoints.Authz, "", form)
+	return parseAuthzResponse(t, resp.Code, resp.Header(), resp.Body.Bytes())
+}
+
+// SubmitOTP submits the verification code on the MFA page that responded by Login.
+func (rp *RP) SubmitOTP(t *testing.T, page *AuthzResponse, otp string) *AuthzResponse {
+	t.Helper()
+
+	inputs, err := FindInputsByHTML(bytes.NewReader(page.Body))
+	if err != nil {
+		t.Fatalf("failed to parse MFA page: %s", err)
+	}
+	if _, ok := inputs["otp"]; !ok {
+		t.Fatalf("verification code is not asked in the page")
+	}
+
+	form := url.Values{}
+	for k, v := range inputs {
+		form.Set(k, v)
+	}
+	form.Set("otp", otp)
+
+	resp := rp.Env.Post(rp.Env.API.Config.Endpoints.Authz, "", form)
+	return parseAuthzResponse(t, resp.Code, resp.Header(), resp.Body.Bytes())
+}
+
+// TokenResponse is a response of the token endpoint.
+type TokenResponse struct {
+	api.PostTokenResponse
+
+	Code             int    `json:"-"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Token sends request to the token endpoint with client credentials.
+func (rp *RP) Token(t *testing.T, params url.Values) *TokenResponse {
+	t.Helper()
+
+	req := url.Values{
+		"client_id":     {rp.ClientID},
+		"client_secret": {rp.ClientSecret},
+	}
+	for k, v := range params {
+		req[k] = v
+	}
+
+	resp := rp.Env.Post(rp.Env.API.Config.Endpoints.Token, "", req)
+
+	var body TokenResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse token response: %s", err)
+	}
+	body.Code = resp.Code
+
+	return &body
+}
+
+// Exchange exchanges the code to tokens.
+func (rp *RP) Exchange(t *testing.T, code string) *TokenResponse {
+	t.Helper()
+
+	return rp.Token(t, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {rp.RedirectURI},
+	})
+}
+
+// Refresh gets new tokens by the refresh token.
+func (rp *RP) Refresh(t *testing.T, refreshToken string) *TokenResponse {
+	t.Helper()
+
+	return rp.Token(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// JWKs fetches public keys from the jwks endpoint.
+func (rp *RP) JWKs(t *testing.T) jose.JSONWebKeySet {
+	t.Helper()
+
+	resp := rp.Env.Get(rp.Env.API.Config.Endpoints.Jwks, "", nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to get jwks: status code %d", resp.Code)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(resp.Body.Bytes(), &keys); err != nil {
+		t.Fatalf("failed to parse jwks: %s", err)
+	}
+	return keys
+}
+
+// VerifyIDToken verifies signature, issuer, audience, expiration, and nonce of the id_token like the real RP does.
+// It returns claims of the id_token.
+func (rp *RP) VerifyIDToken(t *testing.T, rawIDToken, nonce string) map[string]interface{} {
+	t.Helper()
+
+	sig, err := jose.ParseSigned(rawIDToken)
+	if err != nil {
+		t.Fatalf("failed to parse id_token: %s", err)
+	}
+	if len(sig.Signatures) != 1 {
+		t.Fatalf("id_token has %d signatures", len(sig.Signatures))
+	}
+
+	jwks := rp.JWKs(t)
+	keys := jwks.Key(sig.Signatures[0].Header.KeyID)
+	if len(keys) == 0 {
+		t.Fatalf("key of id_token is not in jwks: %#v", sig.Signatures[0].Header.KeyID)
+	}
+
+	payload, err := sig.Verify(keys[0])
+	if err != nil {
+		t.Fatalf("failed to verify id_token: %s", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("failed to parse claims of id_token: %s", err)
+	}
+
+	if claims["iss"] != rp.Env.API.Config.Issuer.String() {
+		t.Errorf("unexpected issuer of id_token: %#v", claims["iss"])
+	}
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		if aud != rp.ClientID {
+			t.Errorf("unexpected audience of id_token: %#v", aud)
+		}
+	case []interface{}:
+		found := false
+		for _, a := range aud {
+			found = found || a == rp.ClientID
+		}
+		if !found {
+			t.Errorf("unexpected audience of id_token: %#v", aud)
+		}
+	default:
+		t.Errorf("unexpected audience of id_token: %#v", aud)
+	}
+
+	if exp, ok := claims["exp"].(float64); !ok || int64(exp) <= rp.Env.API.TokenManager.Now().Unix() {
+		t.Errorf("id_token is expired: %#v (now %s)", claims["exp"], rp.Env.API.TokenManager.Now().Format(time.RFC3339))
+	}
+
+	if nonce != "" && claims["nonce"] != nonce {
+		t.Errorf("nonce of id_token expected %#v but got %#v", nonce, claims["nonce"])
+	}
+
+	return claims
+}
+
+// UserInfo gets userinfo with the access token.
+func (rp *RP) UserInfo(t *testing.T, accessToken string) map[string]interface{} {
+	t.Helper()
+
+	resp := rp.Env.Get(rp.Env.API.Config.Endpoints.Userinfo, "Bearer "+accessToken, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to get userinfo: status code %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var info map[string]interface{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to parse userinfo: %s", err)
+	}
+	return info
+}
@@ -0,0 +1,56 @@
+package testutil_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestRP(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	rp := env.SomeClientRP()
+
+	resp := rp.Login(t, url.Values{
+		"scope": {"openid profile"},
+		"state": {"this is state"},
+		"nonce": {"this is nonce"},
+	}, "macrat", "foobar")
+	if resp.Code != http.StatusFound {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	if resp.Params().Get("state") != "this is state" {
+		t.Errorf("unexpected state: %#v", resp.Params().Get("state"))
+	}
+
+	tokens := rp.Exchange(t, resp.Query.Get("code"))
+	if tokens.Code != http.StatusOK {
+		t.Fatalf("failed to exchange code: %d: %s: %s", tokens.Code, tokens.Error, tokens.ErrorDescription)
+	}
+
+	claims := rp.VerifyIDToken(t, tokens.IDToken, "this is nonce")
+	if claims["sub"] != "macrat" {
+		t.Errorf("unexpected subject of id_token: %#v", claims["sub"])
+	}
+
+	if info := rp.UserInfo(t, tokens.AccessToken); info["sub"] != "macrat" {
+		t.Errorf("unexpected userinfo: %#v", info)
+	}
+
+	refreshed := rp.Refresh(t, tokens.RefreshToken)
+	if refreshed.Code != http.StatusOK {
+		t.Fatalf("failed to refresh: %d: %s: %s", refreshed.Code, refreshed.Error, refreshed.ErrorDescription)
+	}
+	rp.VerifyIDToken(t, refreshed.IDToken, "this is nonce")
+
+	failed := rp.Exchange(t, "invalid-code")
+	if failed.Code != http.StatusBadRequest || failed.Error != "invalid_grant" {
+		t.Errorf("unexpected response for invalid code: %d %#v", failed.Code, failed.Error)
+	}
+
+	denied := rp.Authorize(t, url.Values{"prompt": {"none"}})
+	if denied.Code != http.StatusFound || denied.Params().Get("error") != "login_required" {
+		t.Errorf("unexpected response for prompt=none: %d %#v", denied.Code, denied.Params())
+	}
+}
@@ -33,8 +33,8 @@ func (m Manager) CreateAccessToken(issuer *config.URL, subject, clientID, scope
 				Issuer:    issuer.String(),
 				Subject:   subject,
 				Audience:  issuer.String(),
-				ExpiresAt: time.Now().Add(expiresIn).Unix(),
-				IssuedAt:  time.Now().Unix(),
+				ExpiresAt: m.Now().Add(expiresIn).Unix(),
+				IssuedAt:  m.Now().Unix(),
 			},
 			Type:     "ACCESS_TOKEN",
 			AuthTime: authTime.Unix(),
@@ -44,6 +44,24 @@ func (m Manager) CreateAccessToken(issuer *config.URL, subject, clientID, scope
 	})
 }
 
+// CreateClientAccessToken makes an access token for client_credentials grant.
+// The token has no subject and auth_time, because it is issued to the client itself rather than a user.
+func (m Manager) CreateClientAccessToken(issuer *config.URL, clientID, scope string, expiresIn time.Duration) (string, error) {
+	return m.create(AccessTokenClaims{
+		OIDCClaims: OIDCClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    issuer.String(),
+				Audience:  issuer.String(),
+				ExpiresAt: m.Now().Add(expiresIn).Unix(),
+				IssuedAt:  m.Now().Unix(),
+			},
+			Type: "ACCESS_TOKEN",
+		},
+		AuthorizedParties: []string{clientID},
+		Scope:             scope,
+	})
+}
+
 func (m Manager) ParseAccessToken(token string) (AccessTokenClaims, error) {
 	var claims AccessTokenClaims
 	if _, err := m.parse(token, "", &claims); err != nil {
@@ -0,0 +1,48 @@
+package token
+
+import (
+	"github.com/macrat/lauth/config"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+type AuditAnchorClaims struct {
+	OIDCClaims
+
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+func (claims AuditAnchorClaims) Validate(issuer *config.URL) error {
+	if err := claims.OIDCClaims.Validate(issuer, issuer.String()); err != nil {
+		return err
+	}
+
+	if claims.Type != "AUDIT_ANCHOR" {
+		return UnexpectedTokenTypeError
+	}
+
+	return nil
+}
+
+func (m Manager) CreateAuditAnchor(issuer *config.URL, seq uint64, hash string) (string, error) {
+	return m.create(AuditAnchorClaims{
+		OIDCClaims: OIDCClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:   issuer.String(),
+				Audience: issuer.String(),
+				IssuedAt: m.Now().Unix(),
+			},
+			Type: "AUDIT_ANCHOR",
+		},
+		Seq:  seq,
+		Hash: hash,
+	})
+}
+
+func (m Manager) ParseAuditAnchor(token string) (AuditAnchorClaims, error) {
+	var claims AuditAnchorClaims
+	if _, err := m.parse(token, "", &claims); err != nil {
+		return AuditAnchorClaims{}, err
+	}
+	return claims, nil
+}
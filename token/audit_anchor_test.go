@@ -0,0 +1,48 @@
+package token_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestAuditAnchor(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	anchor, err := tokenManager.CreateAuditAnchor(issuer, 42, "this-is-hash")
+	if err != nil {
+		t.Fatalf("failed to generate anchor: %s", err)
+	}
+
+	claims, err := tokenManager.ParseAuditAnchor(anchor)
+	if err != nil {
+		t.Fatalf("failed to parse anchor: %s", err)
+	}
+
+	if err = claims.Validate(issuer); err != nil {
+		t.Errorf("failed to validate anchor: %s", err)
+	}
+
+	if claims.Seq != 42 || claims.Hash != "this-is-hash" {
+		t.Errorf("unexpected anchor claims: %#v", claims)
+	}
+
+	if err = claims.Validate(&config.URL{Host: "another-issuer"}); err != token.UnexpectedIssuerError {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	anotherManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+	if _, err := anotherManager.ParseAuditAnchor(anchor); err == nil {
+		t.Errorf("expected error when parse with another key but got nil")
+	}
+}
@@ -0,0 +1,35 @@
+package token
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+// CreateAuthzResponse makes a signed authorization response of JARM (JWT Secured Authorization Response Mode).
+//
+// The params like code, state, or error are included as claims of the JWT, with iss, aud, and exp.
+func (m Manager) CreateAuthzResponse(issuer *config.URL, clientID string, params url.Values, expiresIn time.Duration) (string, error) {
+	claims := make(jwt.MapClaims, len(params)+4)
+	for k := range params {
+		claims[k] = params.Get(k)
+	}
+
+	claims["iss"] = issuer.String()
+	claims["aud"] = clientID
+	claims["exp"] = m.Now().Add(expiresIn).Unix()
+	claims["iat"] = m.Now().Unix()
+
+	return m.create(claims)
+}
+
+// ParseAuthzResponse parses a response that made by CreateAuthzResponse.
+func (m Manager) ParseAuthzResponse(token string) (jwt.MapClaims, error) {
+	claims := make(jwt.MapClaims)
+	if _, err := m.parse(token, "", claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
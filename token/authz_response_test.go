@@ -0,0 +1,57 @@
+package token_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestAuthzResponse(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	resp, err := tokenManager.CreateAuthzResponse(issuer, "some_client_id", url.Values{
+		"code":  {"this-is-code"},
+		"state": {"hello"},
+		"iss":   {"http://another-issuer"},
+	}, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate response: %s", err)
+	}
+
+	claims, err := tokenManager.ParseAuthzResponse(resp)
+	if err != nil {
+		t.Fatalf("failed to parse response: %s", err)
+	}
+
+	expected := map[string]string{
+		"iss":   "http://localhost:8000",
+		"aud":   "some_client_id",
+		"code":  "this-is-code",
+		"state": "hello",
+	}
+	for k, v := range expected {
+		if claims[k] != v {
+			t.Errorf("unexpected %s: expected %#v but got %#v", k, v, claims[k])
+		}
+	}
+	if !claims.VerifyExpiresAt(time.Now().Add(9*time.Minute).Unix(), true) {
+		t.Errorf("unexpected expiration: %v", claims["exp"])
+	}
+
+	expired, err := tokenManager.CreateAuthzResponse(issuer, "some_client_id", url.Values{}, -time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate response: %s", err)
+	}
+	if _, err := tokenManager.ParseAuthzResponse(expired); err != token.TokenExpiredError {
+		t.Errorf("expected expired error but got %v", err)
+	}
+}
@@ -10,11 +10,15 @@ import (
 
 type CodeClaims struct {
 	OIDCClaims
+	VersionedClaims
 
 	ClientID    string `json:"client_id"`
 	RedirectURI string `json:"redirect_uri"`
 	Nonce       string `json:"nonce,omitempty"`
 	Scope       string `json:"scope,omitempty"`
+
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
 }
 
 func (claims CodeClaims) Validate(issuer *config.URL) error {
@@ -34,22 +38,31 @@ func (claims CodeClaims) Validate(issuer *config.URL) error {
 }
 
 func (m Manager) CreateCode(issuer *config.URL, subject, clientID, redirectURI, scope, nonce string, authTime time.Time, expiresIn time.Duration) (string, error) {
+	return m.CreateCodeWithChallenge(issuer, subject, clientID, redirectURI, scope, nonce, "", "", authTime, expiresIn)
+}
+
+// CreateCodeWithChallenge creates a code like CreateCode, with code_challenge of PKCE.
+func (m Manager) CreateCodeWithChallenge(issuer *config.URL, subject, clientID, redirectURI, scope, nonce, challenge, challengeMethod string, authTime time.Time, expiresIn time.Duration) (string, error) {
 	plain, err := json.Marshal(CodeClaims{
 		OIDCClaims: OIDCClaims{
 			StandardClaims: jwt.StandardClaims{
 				Issuer:    issuer.String(),
 				Subject:   subject,
 				Audience:  issuer.String(),
-				ExpiresAt: time.Now().Add(expiresIn).Unix(),
-				IssuedAt:  time.Now().Unix(),
+				ExpiresAt: m.Now().Add(expiresIn).Unix(),
+				IssuedAt:  m.Now().Unix(),
 			},
 			Type:     "CODE",
 			AuthTime: authTime.Unix(),
 		},
-		ClientID:    clientID,
-		RedirectURI: redirectURI,
-		Scope:       scope,
-		Nonce:       nonce,
+		VersionedClaims: currentVersion(),
+		ClientID:        clientID,
+		RedirectURI:     redirectURI,
+		Scope:           scope,
+		Nonce:           nonce,
+
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: challengeMethod,
 	})
 	if err != nil {
 		return "", err
@@ -68,5 +81,11 @@ func (m Manager) ParseCode(token string) (CodeClaims, error) {
 	if err := json.Unmarshal(dec, &claims); err != nil {
 		return CodeClaims{}, err
 	}
+	if err := m.validateTime(&claims); err != nil {
+		return CodeClaims{}, err
+	}
+	if err := migrate(&claims); err != nil {
+		return CodeClaims{}, err
+	}
 	return claims, nil
 }
@@ -1,9 +1,12 @@
 package token
 
 import (
+	"compress/flate"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"errors"
+	"sync"
 
 	"gopkg.in/square/go-jose.v2"
 )
@@ -12,30 +15,54 @@ var (
 	NotJWEError = errors.New("not a valid JWE data")
 )
 
-func (m Manager) encryptionKey() []byte {
-	hash := sha256.Sum256(x509.MarshalPKCS1PrivateKey(m.private))
+func encryptionKey(private *rsa.PrivateKey) []byte {
+	hash := sha256.Sum256(x509.MarshalPKCS1PrivateKey(private))
 	return hash[:]
 }
 
-func (m Manager) encrypt(plain []byte) (string, error) {
-	enc, err := jose.NewEncrypter(
+// newEncrypter makes an Encrypter that is reused for all tokens.
+// Compression is done by the caller with pooled writers, so the "zip" header is set manually.
+func newEncrypter(key []byte) (jose.Encrypter, error) {
+	return jose.NewEncrypter(
 		jose.A256GCM,
 		jose.Recipient{
 			Algorithm: jose.A256GCMKW,
-			Key:       m.encryptionKey(),
+			Key:       key,
 		},
 		&jose.EncrypterOptions{
-			Compression: jose.DEFLATE,
 			ExtraHeaders: map[jose.HeaderKey]interface{}{
 				jose.HeaderContentType: "JWT",
+				"zip":                  jose.DEFLATE,
 			},
 		},
 	)
-	if err != nil {
+}
+
+// deflatePool keeps flate writers because each of them allocates large buffers.
+// The compression level is the same as go-jose.
+var deflatePool = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, 1)
+		return w
+	},
+}
+
+func (m Manager) encrypt(plain []byte) (string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	w := deflatePool.Get().(*flate.Writer)
+	defer deflatePool.Put(w)
+
+	w.Reset(buf)
+	if _, err := w.Write(plain); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
 		return "", err
 	}
 
-	e, err := enc.Encrypt(plain)
+	e, err := m.encrypter.Encrypt(buf.Bytes())
 	if err != nil {
 		return "", err
 	}
@@ -43,16 +70,24 @@ func (m Manager) encrypt(plain []byte) (string, error) {
 }
 
 func (m Manager) decrypt(jwe string) ([]byte, error) {
+	if len(jwe) > MaxTokenSize {
+		return nil, TokenTooLargeError
+	}
+
 	e, err := jose.ParseEncrypted(jwe)
 	if err != nil {
 		return nil, err
 	}
 
+	if e.Header.Algorithm != string(jose.A256GCMKW) {
+		return nil, UnexpectedAlgorithmError
+	}
+
 	if typ, ok := e.Header.ExtraHeaders[jose.HeaderContentType]; !ok || typ != "JWT" {
 		return nil, NotJWEError
 	}
 
-	dec, err := e.Decrypt(m.encryptionKey())
+	dec, err := e.Decrypt(m.encKey)
 	if err != nil {
 		return nil, err
 	}
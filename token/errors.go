@@ -5,10 +5,15 @@ import (
 )
 
 var (
-	InvalidTokenError        = errors.New("invalid token")
-	TokenExpiredError        = errors.New("token has already expired")
-	UnexpectedIssuerError    = errors.New("unexpected issuer")
-	UnexpectedAudienceError  = errors.New("unexpected audience")
-	UnexpectedTokenTypeError = errors.New("unexpected token type")
-	UnexpectedClientIDError  = errors.New("unexpected client_id")
+	InvalidTokenError            = errors.New("invalid token")
+	TokenExpiredError            = errors.New("token has already expired")
+	UnexpectedIssuerError        = errors.New("unexpected issuer")
+	UnexpectedAudienceError      = errors.New("unexpected audience")
+	UnexpectedTokenTypeError     = errors.New("unexpected token type")
+	UnexpectedClientIDError      = errors.New("unexpected client_id")
+	UnsupportedTokenVersionError = errors.New("unsupported token version")
+	RevokedTokenError            = errors.New("token has been revoked")
+	FingerprintMismatchError     = errors.New("token was issued for another browser")
+	TokenTooLargeError           = errors.New("token is too large")
+	UnexpectedAlgorithmError     = errors.New("unexpected signing algorithm")
 )
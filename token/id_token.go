@@ -105,8 +105,8 @@ func (m Manager) CreateIDToken(issuer *config.URL, subject, audience, nonce, cod
 				Issuer:    issuer.String(),
 				Subject:   subject,
 				Audience:  audience,
-				ExpiresAt: time.Now().Add(expiresIn).Unix(),
-				IssuedAt:  time.Now().Unix(),
+				ExpiresAt: m.Now().Add(expiresIn).Unix(),
+				IssuedAt:  m.Now().Unix(),
 			},
 			Type:     "ID_TOKEN",
 			AuthTime: authTime.Unix(),
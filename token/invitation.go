@@ -0,0 +1,59 @@
+package token
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/macrat/lauth/config"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+// InvitationClaims is the claims of the invitation link to activate a pre-created account.
+type InvitationClaims struct {
+	OIDCClaims
+	VersionedClaims
+}
+
+func (claims InvitationClaims) Validate(issuer *config.URL) error {
+	if err := claims.OIDCClaims.Validate(issuer, issuer.String()); err != nil {
+		return err
+	}
+
+	if claims.Type != "INVITATION" {
+		return UnexpectedTokenTypeError
+	}
+
+	if claims.Subject == "" || claims.Id == "" {
+		return InvalidTokenError
+	}
+
+	return nil
+}
+
+func (m Manager) CreateInvitation(issuer *config.URL, username string, expiresIn time.Duration) (string, error) {
+	return m.create(InvitationClaims{
+		OIDCClaims: OIDCClaims{
+			StandardClaims: jwt.StandardClaims{
+				Id:        uuid.New().String(),
+				Issuer:    issuer.String(),
+				Subject:   username,
+				Audience:  issuer.String(),
+				ExpiresAt: m.Now().Add(expiresIn).Unix(),
+				IssuedAt:  m.Now().Unix(),
+			},
+			Type: "INVITATION",
+		},
+		VersionedClaims: currentVersion(),
+	})
+}
+
+func (m Manager) ParseInvitation(token string) (InvitationClaims, error) {
+	var claims InvitationClaims
+	if _, err := m.parse(token, "", &claims); err != nil {
+		return InvitationClaims{}, err
+	}
+	if err := migrate(&claims); err != nil {
+		return InvitationClaims{}, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,50 @@
+package token_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestInvitation(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	invitation, err := tokenManager.CreateInvitation(issuer, "someone", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate invitation: %s", err)
+	}
+
+	claims, err := tokenManager.ParseInvitation(invitation)
+	if err != nil {
+		t.Fatalf("failed to parse invitation: %s", err)
+	}
+
+	if err = claims.Validate(issuer); err != nil {
+		t.Errorf("failed to validate invitation: %s", err)
+	}
+	if claims.Subject != "someone" || claims.Id == "" {
+		t.Errorf("unexpected claims: %#v", claims)
+	}
+
+	if err = claims.Validate(&config.URL{Host: "another-issuer"}); err != token.UnexpectedIssuerError {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ssoToken, err := tokenManager.CreateSSOToken(issuer, "session-id", "someone", "", token.AuthorizedParties{}, nil, time.Now(), time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to generate SSO token: %s", err)
+	}
+	if claims, err := tokenManager.ParseInvitation(ssoToken); err != nil {
+		t.Fatalf("failed to parse SSO token: %s", err)
+	} else if err := claims.Validate(issuer); err != token.UnexpectedTokenTypeError {
+		t.Errorf("SSO token must not be accepted as invitation: %v", err)
+	}
+}
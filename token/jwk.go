@@ -3,10 +3,12 @@ package token
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/binary"
+	"fmt"
 	"math/big"
 	"time"
 )
@@ -18,7 +20,7 @@ type JWK struct {
 	KeyType   string   `json:"kty"`
 	E         string   `json:"e"`
 	N         string   `json:"n"`
-	X509      []string `json:"x5c"`
+	X509      []string `json:"x5c,omitempty"`
 }
 
 func int2bytes(i int) []byte {
@@ -31,13 +33,13 @@ func int2bytes(i int) []byte {
 	return bs[skip:]
 }
 
-func makeCert(hostname string, public *rsa.PublicKey, private *rsa.PrivateKey) ([]byte, error) {
+func makeCert(hostname string, public *rsa.PublicKey, private *rsa.PrivateKey, now time.Time) ([]byte, error) {
 	template := &x509.Certificate{
 		Issuer:       pkix.Name{CommonName: hostname},
 		Subject:      pkix.Name{CommonName: hostname},
 		SerialNumber: big.NewInt(0),
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().Add(1 * time.Hour),
+		NotBefore:    now,
+		NotAfter:     now.Add(1 * time.Hour),
 	}
 
 	b, err := x509.CreateCertificate(rand.Reader, template, template, public, private)
@@ -49,12 +51,12 @@ func makeCert(hostname string, public *rsa.PublicKey, private *rsa.PrivateKey) (
 }
 
 func (m Manager) JWKs(hostname string) ([]JWK, error) {
-	cert, err := makeCert(hostname, m.public, m.private)
+	cert, err := makeCert(hostname, m.public, m.private, m.Now())
 	if err != nil {
 		return nil, err
 	}
 
-	return []JWK{
+	keys := []JWK{
 		{
 			KeyID:     m.KeyID().String(),
 			Use:       "sig",
@@ -66,5 +68,56 @@ func (m Manager) JWKs(hostname string) ([]JWK, error) {
 				base64.StdEncoding.EncodeToString(cert),
 			},
 		},
-	}, nil
+	}
+
+	for _, key := range m.verify {
+		keys = append(keys, JWK{
+			KeyID:     keyID(key).String(),
+			Use:       "sig",
+			Algorithm: "RS256",
+			KeyType:   "RSA",
+			E:         base64.RawURLEncoding.EncodeToString(int2bytes(key.E)),
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		})
+	}
+
+	return keys, nil
+}
+
+// KeyFingerprint identifies a key that Manager uses.
+type KeyFingerprint struct {
+	KeyID string `json:"kid"`
+
+	// Thumbprint is the JWK SHA-256 thumbprint in RFC 7638.
+	Thumbprint string `json:"thumbprint"`
+
+	// Signing is true for the sign key, and false for the keys that only accepted for verification.
+	Signing bool `json:"signing"`
+}
+
+func thumbprint(key *rsa.PublicKey) string {
+	// RFC 7638 requires the required members in lexicographic order without whitespaces.
+	raw := fmt.Sprintf(
+		`{"e":"%s","kty":"RSA","n":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(int2bytes(key.E)),
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+	)
+	sum := sha256.Sum256([]byte(raw))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeyFingerprints returns the fingerprints of the sign key and the verify keys.
+func (m Manager) KeyFingerprints() []KeyFingerprint {
+	fs := []KeyFingerprint{{
+		KeyID:      m.KeyID().String(),
+		Thumbprint: thumbprint(m.public),
+		Signing:    true,
+	}}
+	for _, key := range m.verify {
+		fs = append(fs, KeyFingerprint{
+			KeyID:      keyID(key).String(),
+			Thumbprint: thumbprint(key),
+		})
+	}
+	return fs
 }
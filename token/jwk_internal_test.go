@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"testing"
+	"time"
 )
 
 func TestInt2bytes(t *testing.T) {
@@ -32,7 +33,7 @@ func TestMakeCert(t *testing.T) {
 	}
 	pub := pri.Public().(*rsa.PublicKey)
 
-	cert, err := makeCert("lauth.example.com", pub, pri)
+	cert, err := makeCert("lauth.example.com", pub, pri, time.Now())
 	if err != nil {
 		t.Fatalf("failed to generate certificate: %s", err)
 	}
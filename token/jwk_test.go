@@ -1,6 +1,7 @@
 package token_test
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -81,3 +82,43 @@ func TestTokenManager_JWKs(t *testing.T) {
 		return pri, nil
 	})
 }
+
+func TestTokenManager_KeyFingerprints(t *testing.T) {
+	manager, err := token.GenerateManager()
+	if err != nil {
+		t.Fatalf("failed to generate manager: %s", err)
+	}
+	old, err := token.GenerateManager()
+	if err != nil {
+		t.Fatalf("failed to generate manager: %s", err)
+	}
+	manager = manager.WithVerifyKeys(old.PublicKey())
+
+	fs := manager.KeyFingerprints()
+	if len(fs) != 2 {
+		t.Fatalf("unexpected number of fingerprints: %d", len(fs))
+	}
+
+	for i, tt := range []struct {
+		Manager token.Manager
+		Signing bool
+	}{
+		{manager, true},
+		{old, false},
+	} {
+		expected, err := (&jose.JSONWebKey{Key: tt.Manager.PublicKey()}).Thumbprint(crypto.SHA256)
+		if err != nil {
+			t.Fatalf("failed to calculate thumbprint: %s", err)
+		}
+
+		if fs[i].KeyID != tt.Manager.KeyID().String() {
+			t.Errorf("%d: unexpected key ID: %s", i, fs[i].KeyID)
+		}
+		if fs[i].Thumbprint != base64.RawURLEncoding.EncodeToString(expected) {
+			t.Errorf("%d: unexpected thumbprint: %s", i, fs[i].Thumbprint)
+		}
+		if fs[i].Signing != tt.Signing {
+			t.Errorf("%d: unexpected signing: %v", i, fs[i].Signing)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package token_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	mrand "math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+	"gopkg.in/square/go-jose.v2"
+)
+
+type tokenParser struct {
+	Name  string
+	Parse func(string) (subject string, err error)
+}
+
+func makeTokenParsers(m token.Manager, requestKey string) []tokenParser {
+	return []tokenParser{
+		{"access_token", func(s string) (string, error) {
+			c, err := m.ParseAccessToken(s)
+			return c.Subject, err
+		}},
+		{"refresh_token", func(s string) (string, error) {
+			c, err := m.ParseRefreshToken(s)
+			return c.Subject, err
+		}},
+		{"sso_token", func(s string) (string, error) {
+			c, err := m.ParseSSOToken(s)
+			return c.Subject, err
+		}},
+		{"code", func(s string) (string, error) {
+			c, err := m.ParseCode(s)
+			return c.Subject, err
+		}},
+		{"request_object", func(s string) (string, error) {
+			c, err := m.ParseRequestObject(s, requestKey)
+			return c.Subject, err
+		}},
+	}
+}
+
+func signWith(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	tok := jwt.NewWithClaims(method, claims)
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %s", err)
+	}
+	return s
+}
+
+// makeClientKey makes a RSA key that large enough for RS512 and PS256, and its public key in PEM.
+func makeClientKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %s", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal client key: %s", err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+}
+
+func TestManager_MalformedTokens(t *testing.T) {
+	m, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	claims := jwt.MapClaims{
+		"iss": "http://localhost:8000",
+		"sub": "macrat",
+		"aud": "http://localhost:8000",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+		"typ": "ACCESS_TOKEN",
+	}
+
+	clientKey, clientPublicKey := makeClientKey(t)
+
+	encKey := make([]byte, 32)
+	rand.Read(encKey)
+	enc, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: encKey}, &jose.EncrypterOptions{
+		ExtraHeaders: map[jose.HeaderKey]interface{}{jose.HeaderContentType: "JWT"},
+	})
+	if err != nil {
+		t.Fatalf("failed to prepare encrypter: %s", err)
+	}
+	jwe, err := enc.Encrypt([]byte(`{"sub":"macrat"}`))
+	if err != nil {
+		t.Fatalf("failed to encrypt: %s", err)
+	}
+	directJWE, _ := jwe.CompactSerialize()
+
+	validHeader := strings.Split(signWith(t, jwt.SigningMethodRS256, clientKey, claims), ".")[0]
+
+	inputs := map[string]string{
+		"empty":                  "",
+		"dots only":              "..",
+		"too many segments":      "a.b.c.d.e.f",
+		"invalid base64":         "!!!.###.$$$",
+		"truncated json":         "eyJ.eyJ.",
+		"broken payload":         validHeader + ".eyJzdWIiOiJtYWNy.AAAA",
+		"oversized":              strings.Repeat("a", token.MaxTokenSize+1),
+		"oversized jwt":          validHeader + "." + strings.Repeat("A", token.MaxTokenSize) + ".AAAA",
+		"alg none":               signWith(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims),
+		"HS256 with public key":  signWith(t, jwt.SigningMethodHS256, []byte(clientPublicKey), claims),
+		"HS256 with empty key":   signWith(t, jwt.SigningMethodHS256, []byte{}, claims),
+		"JWE with direct key":    directJWE,
+		"JWE with broken header": "eyJhbGciOiJBMjU2R0NNS1cifQ.a.b.c.d",
+	}
+
+	for _, p := range makeTokenParsers(m, clientPublicKey) {
+		for name, input := range inputs {
+			if _, err := p.Parse(input); err == nil {
+				t.Errorf("%s: %s: expected error but succeed", p.Name, name)
+			}
+		}
+	}
+
+	// The client key is accepted only for request objects, so the others must reject tokens signed by it.
+	signedByClient := map[string]string{
+		"RS512 with client key": signWith(t, jwt.SigningMethodRS512, clientKey, claims),
+		"PS256 with client key": signWith(t, jwt.SigningMethodPS256, clientKey, claims),
+	}
+	for _, p := range makeTokenParsers(m, clientPublicKey) {
+		if p.Name == "request_object" {
+			continue
+		}
+		for name, input := range signedByClient {
+			if _, err := p.Parse(input); err == nil {
+				t.Errorf("%s: %s: expected error but succeed", p.Name, name)
+			}
+		}
+	}
+}
+
+func TestManager_RejectUnexpectedAlgorithm(t *testing.T) {
+	m, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	clientKey, clientPublicKey := makeClientKey(t)
+
+	claims := jwt.MapClaims{"sub": "macrat"}
+
+	if _, err := m.ParseRequestObject(signWith(t, jwt.SigningMethodRS256, clientKey, claims), clientPublicKey); err != nil {
+		t.Fatalf("failed to parse RS256 request object: %s", err)
+	}
+
+	for _, method := range []jwt.SigningMethod{jwt.SigningMethodRS384, jwt.SigningMethodRS512, jwt.SigningMethodPS256, jwt.SigningMethodPS384, jwt.SigningMethodPS512} {
+		if _, err := m.ParseRequestObject(signWith(t, method, clientKey, claims), clientPublicKey); err != nil {
+			t.Errorf("failed to parse %s request object: %s", method.Alg(), err)
+		}
+	}
+
+	_, err = m.ParseRequestObject(signWith(t, jwt.SigningMethodHS256, []byte(clientPublicKey), claims), clientPublicKey)
+	if err == nil || !strings.Contains(err.Error(), "signing method HS256 is invalid") {
+		t.Errorf("expected HS256 is rejected but got %v", err)
+	}
+
+	accessToken := signWith(t, jwt.SigningMethodPS256, clientKey, claims)
+	if _, err := m.ParseAccessToken(accessToken); err == nil || !strings.Contains(err.Error(), "signing method PS256 is invalid") {
+		t.Errorf("expected PS256 is rejected for access_token but got %v", err)
+	}
+
+	_, err = m.ParseAccessToken(strings.Repeat("a", token.MaxTokenSize+1))
+	if err != token.TokenTooLargeError {
+		t.Errorf("expected TokenTooLargeError but got %v", err)
+	}
+
+	_, err = m.ParseCode(strings.Repeat("a", token.MaxTokenSize+1))
+	if err != token.TokenTooLargeError {
+		t.Errorf("expected TokenTooLargeError but got %v", err)
+	}
+}
+
+// mutate breaks the token randomly, like replacing, deleting, or duplicating bytes.
+func mutate(rnd *mrand.Rand, s string) string {
+	b := []byte(s)
+	for i := rnd.Intn(4) + 1; i > 0 && len(b) > 0; i-- {
+		pos := rnd.Intn(len(b))
+		switch rnd.Intn(4) {
+		case 0:
+			b[pos] = byte(rnd.Intn(256))
+		case 1:
+			b[pos] = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_."[rnd.Intn(65)]
+		case 2:
+			b = append(b[:pos], b[pos+1:]...)
+		case 3:
+			end := pos + rnd.Intn(len(b)-pos)
+			b = append(b[:end:end], append(b[pos:end:end], b[end:]...)...)
+		}
+	}
+	return string(b)
+}
+
+func TestManager_FuzzParse(t *testing.T) {
+	m, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+	now := time.Now()
+
+	accessToken, err := m.CreateAccessToken(issuer, "macrat", "some_client_id", "openid", now, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make access_token: %s", err)
+	}
+	refreshToken, err := m.CreateRefreshToken(issuer, "macrat", "some_client_id", "openid", "", now, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make refresh_token: %s", err)
+	}
+	ssoToken, err := m.CreateSSOToken(issuer, "sso-id", "macrat", "", token.AuthorizedParties{"some_client_id"}, token.Consents{"some_client_id": token.ConsentAnyScope}, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to make sso_token: %s", err)
+	}
+	code, err := m.CreateCode(issuer, "macrat", "some_client_id", "http://some-client.example.com/callback", "openid", "", now, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to make code: %s", err)
+	}
+	request := testutil.SomeClientRequestObject(t, map[string]interface{}{"sub": "macrat"})
+
+	seeds := map[string]string{
+		"access_token":   accessToken,
+		"refresh_token":  refreshToken,
+		"sso_token":      ssoToken,
+		"code":           code,
+		"request_object": request,
+	}
+
+	rnd := mrand.New(mrand.NewSource(1))
+
+	for _, p := range makeTokenParsers(m, testutil.SomeClientPublicKey) {
+		seed := seeds[p.Name]
+		if subject, err := p.Parse(seed); err != nil || subject != "macrat" {
+			t.Fatalf("%s: failed to parse seed: %#v %v", p.Name, subject, err)
+		}
+
+		for i := 0; i < 2000; i++ {
+			input := mutate(rnd, seed)
+			subject, err := p.Parse(input)
+			if err == nil && subject != "macrat" {
+				t.Errorf("%s: mutated token accepted with another subject %#v: %s", p.Name, subject, input)
+			}
+		}
+	}
+}
@@ -1,25 +1,71 @@
 package token
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"io"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"gopkg.in/dgrijalva/jwt-go.v3"
+	"gopkg.in/square/go-jose.v2"
 )
 
+// MaxTokenSize is the maximum length of tokens that Manager accepts.
+// Tokens are rejected before decoding if longer than this.
+const MaxTokenSize = 16 * 1024
+
+type Clock interface {
+	Now() time.Time
+}
+
 type Manager struct {
 	private *rsa.PrivateKey
 	public  *rsa.PublicKey
+	verify  []*rsa.PublicKey
+	clock   Clock
+
+	// They are derived from the private key once, because issuing tokens is a hot path.
+	kid       uuid.UUID
+	header    string
+	encKey    []byte
+	encrypter jose.Encrypter
 }
 
 func NewManager(private *rsa.PrivateKey) (Manager, error) {
-	return Manager{
+	private.Precompute()
+
+	m := Manager{
 		private: private,
 		public:  private.Public().(*rsa.PublicKey),
-	}, nil
+	}
+	m.kid = keyID(m.public)
+
+	header, err := json.Marshal(map[string]string{
+		"alg": jwt.SigningMethodRS256.Alg(),
+		"kid": m.kid.String(),
+		"typ": "JWT",
+	})
+	if err != nil {
+		return Manager{}, err
+	}
+	m.header = base64.RawURLEncoding.EncodeToString(header)
+
+	m.encKey = encryptionKey(private)
+	m.encrypter, err = newEncrypter(m.encKey)
+	if err != nil {
+		return Manager{}, err
+	}
+
+	return m, nil
 }
 
 func GenerateManager() (Manager, error) {
@@ -30,6 +76,19 @@ func GenerateManager() (Manager, error) {
 	return NewManager(pri)
 }
 
+// ReadVerifyKey reads a RSA public key, private key, or certificate in PEM format for WithVerifyKeys.
+func ReadVerifyKey(file io.Reader) (*rsa.PublicKey, error) {
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if pri, err := jwt.ParseRSAPrivateKeyFromPEM(raw); err == nil {
+		return pri.Public().(*rsa.PublicKey), nil
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(raw)
+}
+
 func NewManagerFromFile(file io.Reader) (Manager, error) {
 	raw, err := io.ReadAll(file)
 	if err != nil {
@@ -44,30 +103,185 @@ func NewManagerFromFile(file io.Reader) (Manager, error) {
 	return NewManager(pri)
 }
 
+// WithClock makes a copy of Manager that uses the clock to issue and verify tokens.
+func (m Manager) WithClock(clock Clock) Manager {
+	m.clock = clock
+	return m
+}
+
+// Now returns the current time of the clock of this Manager.
+func (m Manager) Now() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
+// WithVerifyKeys makes a copy of Manager that accepts tokens signed by the keys in addition to the sign key.
+// The keys are published in JWKs but never used for signing, so you can rotate keys without breaking issued tokens.
+func (m Manager) WithVerifyKeys(keys ...*rsa.PublicKey) Manager {
+	m.verify = append(append([]*rsa.PublicKey{}, m.verify...), keys...)
+	return m
+}
+
 func (m Manager) PublicKey() *rsa.PublicKey {
 	return m.public
 }
 
+func keyID(public *rsa.PublicKey) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceX500, x509.MarshalPKCS1PublicKey(public))
+}
+
 func (m Manager) KeyID() uuid.UUID {
-	return uuid.NewSHA1(uuid.NameSpaceX500, x509.MarshalPKCS1PublicKey(m.public))
+	return m.kid
+}
+
+// verifyKey returns the public key to verify token that signed by the key of kid.
+func (m Manager) verifyKey(kid interface{}) *rsa.PublicKey {
+	if id, ok := kid.(string); ok {
+		for _, key := range m.verify {
+			if keyID(key).String() == id {
+				return key
+			}
+		}
+	}
+	return m.public
+}
+
+// VerifyKeyID returns the ID of the key that is used to verify the token, without verifying the token.
+// It is the sign key unless the token has kid of one of the verify keys, the same as parsing tokens.
+func (m Manager) VerifyKeyID(token string) string {
+	if len(token) > MaxTokenSize {
+		return m.kid.String()
+	}
+
+	var header struct {
+		KeyID string `json:"kid"`
+	}
+	if i := strings.IndexByte(token, '.'); i > 0 {
+		if raw, err := base64.RawURLEncoding.DecodeString(token[:i]); err == nil {
+			json.Unmarshal(raw, &header)
+		}
+	}
+
+	return keyID(m.verifyKey(header.KeyID)).String()
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
 }
 
+func putBuffer(buf *bytes.Buffer) {
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// create makes a signed JWT.
+// It is the same as jwt.Token.SignedString of jwt-go, but reuses the encoded header and buffers.
 func (m Manager) create(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	token.Header["kid"] = m.KeyID().String()
-	return token.SignedString(m.private)
+	payload := getBuffer()
+	defer putBuffer(payload)
+
+	if err := json.NewEncoder(payload).Encode(claims); err != nil {
+		return "", err
+	}
+	raw := bytes.TrimSuffix(payload.Bytes(), []byte("\n"))
+
+	enc := base64.RawURLEncoding
+	headerLen := len(m.header) + 1
+	signingLen := headerLen + enc.EncodedLen(len(raw))
+	token := make([]byte, signingLen+1+enc.EncodedLen(m.private.Size()))
+
+	copy(token, m.header)
+	token[headerLen-1] = '.'
+	enc.Encode(token[headerLen:signingLen], raw)
+
+	hash := sha256.Sum256(token[:signingLen])
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.private, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	token[signingLen] = '.'
+	enc.Encode(token[signingLen+1:], sig)
+
+	return string(token), nil
+}
+
+type timeClaims interface {
+	VerifyExpiresAt(cmp int64, req bool) bool
+	VerifyIssuedAt(cmp int64, req bool) bool
+	VerifyNotBefore(cmp int64, req bool) bool
+}
+
+func (m Manager) validateTime(claims interface{}) error {
+	c, ok := claims.(timeClaims)
+	if !ok {
+		return nil
+	}
+
+	now := m.Now().Unix()
+
+	if !c.VerifyExpiresAt(now, false) {
+		return TokenExpiredError
+	}
+	if !c.VerifyIssuedAt(now, false) || !c.VerifyNotBefore(now, false) {
+		return InvalidTokenError
+	}
+
+	return nil
+}
+
+// clientSigningAlgorithms are the algorithms that accepted for tokens signed by clients, like request objects signed by request_key.
+// Tokens that lauth issued are always RS256.
+var clientSigningAlgorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodRS384.Alg(),
+	jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodPS384.Alg(),
+	jwt.SigningMethodPS512.Alg(),
+}
+
+func hasAlgorithm(algs []string, alg string) bool {
+	for _, a := range algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
 }
 
 func (m Manager) parse(token string, signKey string, claims jwt.Claims) (*jwt.Token, error) {
-	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+	if len(token) > MaxTokenSize {
+		return nil, TokenTooLargeError
+	}
+
+	methods := []string{jwt.SigningMethodRS256.Alg()}
+	if signKey != "" {
+		methods = clientSigningAlgorithms
+	}
+
+	parser := &jwt.Parser{
+		ValidMethods:         methods,
+		SkipClaimsValidation: true,
+	}
+
+	parsed, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if !hasAlgorithm(methods, t.Method.Alg()) {
+			return nil, UnexpectedAlgorithmError
+		}
 		if signKey != "" {
 			return jwt.ParseRSAPublicKeyFromPEM([]byte(signKey))
 		}
-		return m.public, nil
+		return m.verifyKey(t.Header["kid"]), nil
 	})
-	if e, ok := err.(*jwt.ValidationError); ok && e.Errors == jwt.ValidationErrorExpired {
-		return nil, TokenExpiredError
-	}
 	if err != nil {
 		return nil, err
 	}
@@ -76,5 +290,9 @@ func (m Manager) parse(token string, signKey string, claims jwt.Claims) (*jwt.To
 		return nil, InvalidTokenError
 	}
 
+	if err := m.validateTime(claims); err != nil {
+		return nil, err
+	}
+
 	return parsed, nil
 }
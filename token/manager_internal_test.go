@@ -0,0 +1,102 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"gopkg.in/dgrijalva/jwt-go.v3"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestManager_create_CompatibleWithJWTGo(t *testing.T) {
+	pri, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	m, err := NewManager(pri)
+	if err != nil {
+		t.Fatalf("failed to make manager: %s", err)
+	}
+
+	claims := AccessTokenClaims{
+		OIDCClaims: OIDCClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    "http://localhost:8000",
+				Subject:   "someone <&>",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+			Type: "ACCESS_TOKEN",
+		},
+		Scope: "openid profile",
+	}
+
+	expect := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	expect.Header["kid"] = keyID(m.public).String()
+	expectStr, err := expect.SignedString(pri)
+	if err != nil {
+		t.Fatalf("failed to sign by jwt-go: %s", err)
+	}
+
+	got, err := m.create(claims)
+	if err != nil {
+		t.Fatalf("failed to create token: %s", err)
+	}
+	if got != expectStr {
+		t.Errorf("unexpected token:\nexpected: %s\n     got: %s", expectStr, got)
+	}
+}
+
+func TestManager_decrypt_CompressedByJOSE(t *testing.T) {
+	pri, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	m, err := NewManager(pri)
+	if err != nil {
+		t.Fatalf("failed to make manager: %s", err)
+	}
+
+	enc, err := jose.NewEncrypter(
+		jose.A256GCM,
+		jose.Recipient{Algorithm: jose.A256GCMKW, Key: m.encKey},
+		&jose.EncrypterOptions{
+			Compression: jose.DEFLATE,
+			ExtraHeaders: map[jose.HeaderKey]interface{}{
+				jose.HeaderContentType: "JWT",
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to make encrypter: %s", err)
+	}
+	e, err := enc.Encrypt([]byte(`{"hello":"world"}`))
+	if err != nil {
+		t.Fatalf("failed to encrypt: %s", err)
+	}
+	old, err := e.CompactSerialize()
+	if err != nil {
+		t.Fatalf("failed to serialize: %s", err)
+	}
+
+	if dec, err := m.decrypt(old); err != nil {
+		t.Errorf("failed to decrypt token made by go-jose compression: %s", err)
+	} else if string(dec) != `{"hello":"world"}` {
+		t.Errorf("unexpected decrypted data: %s", dec)
+	}
+
+	tok, err := m.encrypt([]byte(`{"hello":"world"}`))
+	if err != nil {
+		t.Fatalf("failed to encrypt: %s", err)
+	}
+	parsed, err := jose.ParseEncrypted(tok)
+	if err != nil {
+		t.Fatalf("failed to parse encrypted token: %s", err)
+	}
+	if dec, err := parsed.Decrypt(m.encKey); err != nil {
+		t.Errorf("failed to decrypt by go-jose: %s", err)
+	} else if string(dec) != `{"hello":"world"}` {
+		t.Errorf("unexpected decrypted data by go-jose: %s", dec)
+	}
+}
@@ -0,0 +1,194 @@
+package token_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestManager_WithClock(t *testing.T) {
+	m, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	start := time.Date(2016, 12, 31, 23, 59, 59, 0, time.UTC)
+	clock := testutil.NewFakeClock(start)
+	m = m.WithClock(clock)
+
+	if !m.Now().Equal(start) {
+		t.Errorf("unexpected Now: %s", m.Now())
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	ttl, err := config.ParseDuration("7d")
+	if err != nil {
+		t.Fatalf("failed to parse duration: %s", err)
+	}
+
+	accessToken, err := m.CreateAccessToken(issuer, "someone", "something", "openid", start, ttl.Duration())
+	if err != nil {
+		t.Fatalf("failed to generate access token: %s", err)
+	}
+	code, err := m.CreateCode(issuer, "someone", "something", "http://something", "openid", "", start, ttl.Duration())
+	if err != nil {
+		t.Fatalf("failed to generate code: %s", err)
+	}
+
+	claims, err := m.ParseAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("failed to parse access token: %s", err)
+	}
+	if claims.IssuedAt != start.Unix() {
+		t.Errorf("unexpected iat: %d", claims.IssuedAt)
+	}
+	if claims.ExpiresAt != start.Unix()+7*24*60*60 {
+		t.Errorf("unexpected exp: %d", claims.ExpiresAt)
+	}
+
+	clock.Advance(ttl.Duration() - time.Second)
+	if _, err := m.ParseAccessToken(accessToken); err != nil {
+		t.Errorf("failed to parse access token just before expiration: %s", err)
+	}
+	if _, err := m.ParseCode(code); err != nil {
+		t.Errorf("failed to parse code just before expiration: %s", err)
+	}
+
+	clock.Advance(2 * time.Second)
+	if _, err := m.ParseAccessToken(accessToken); err != token.TokenExpiredError {
+		t.Errorf("expected TokenExpiredError but got %v", err)
+	}
+	if _, err := m.ParseCode(code); err != token.TokenExpiredError {
+		t.Errorf("expected TokenExpiredError but got %v", err)
+	}
+
+	clock.Set(start.Add(-time.Hour))
+	if _, err := m.ParseAccessToken(accessToken); err != token.InvalidTokenError {
+		t.Errorf("expected InvalidTokenError for token issued in future but got %v", err)
+	}
+}
+
+func TestManager_WithVerifyKeys(t *testing.T) {
+	old, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+	current, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	oldToken, err := old.CreateAccessToken(issuer, "someone", "something", "openid", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate access token: %s", err)
+	}
+
+	if _, err := current.ParseAccessToken(oldToken); err == nil {
+		t.Fatalf("expected failed to parse token that signed by unknown key")
+	}
+
+	key, err := token.ReadVerifyKey(strings.NewReader(testutil.SomeClientPublicKey))
+	if err != nil {
+		t.Fatalf("failed to read public key: %s", err)
+	}
+	current = current.WithVerifyKeys(key, old.PublicKey())
+
+	if _, err := current.ParseAccessToken(oldToken); err != nil {
+		t.Errorf("failed to parse token that signed by verify key: %s", err)
+	}
+
+	newToken, err := current.CreateAccessToken(issuer, "someone", "something", "openid", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate access token: %s", err)
+	}
+	if _, err := current.ParseAccessToken(newToken); err != nil {
+		t.Errorf("failed to parse token that signed by sign key: %s", err)
+	}
+	if _, err := old.ParseAccessToken(newToken); err == nil {
+		t.Errorf("verify keys must not be used for signing")
+	}
+
+	if kid := current.VerifyKeyID(oldToken); kid != old.KeyID().String() {
+		t.Errorf("unexpected verify key of old token: %s", kid)
+	}
+	if kid := current.VerifyKeyID(newToken); kid != current.KeyID().String() {
+		t.Errorf("unexpected verify key of new token: %s", kid)
+	}
+	if kid := current.VerifyKeyID("broken"); kid != current.KeyID().String() {
+		t.Errorf("unexpected verify key of broken token: %s", kid)
+	}
+
+	keys, err := current.JWKs("localhost")
+	if err != nil {
+		t.Fatalf("failed to get JWKs: %s", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys but got %d keys", len(keys))
+	}
+	if keys[0].KeyID != current.KeyID().String() || keys[2].KeyID != old.KeyID().String() {
+		t.Errorf("unexpected key IDs: %#v", keys)
+	}
+}
+
+func benchmarkManager(b *testing.B) token.Manager {
+	b.Helper()
+
+	m, err := testutil.MakeTokenManager()
+	if err != nil {
+		b.Fatalf("failed to generate TokenManager: %s", err)
+	}
+	return m
+}
+
+func BenchmarkManager_CreateAccessToken(b *testing.B) {
+	m := benchmarkManager(b)
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+	now := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.CreateAccessToken(issuer, "someone", "something", "openid profile", now, time.Hour); err != nil {
+			b.Fatalf("failed to generate access token: %s", err)
+		}
+	}
+}
+
+func BenchmarkManager_CreateIDToken(b *testing.B) {
+	m := benchmarkManager(b)
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+	now := time.Now()
+	extra := map[string]interface{}{
+		"name":  "Some User",
+		"email": "someone@example.com",
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.CreateIDToken(issuer, "someone", "something", "nonce", "code", "token", extra, now, time.Hour); err != nil {
+			b.Fatalf("failed to generate ID token: %s", err)
+		}
+	}
+}
+
+func BenchmarkManager_CreateCode(b *testing.B) {
+	m := benchmarkManager(b)
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+	now := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.CreateCode(issuer, "someone", "something", "http://something", "openid", "", now, time.Hour); err != nil {
+			b.Fatalf("failed to generate code: %s", err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package token
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"regexp"
+)
+
+var (
+	// CodeChallengeMethods are the supported methods of PKCE.
+	CodeChallengeMethods = []string{"plain", "S256"}
+
+	codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+	CodeVerifierRequiredError       = errors.New("code_verifier is required")
+	UnexpectedCodeVerifierError     = errors.New("code_verifier is set but code_challenge was not")
+	InvalidCodeVerifierError        = errors.New("code_verifier is invalid format")
+	CodeVerifierMismatchError       = errors.New("code_verifier doesn't match to code_challenge")
+	UnsupportedChallengeMethodError = errors.New("unsupported code_challenge_method")
+)
+
+// ValidCodeChallenge checks the format of code_challenge.
+func ValidCodeChallenge(challenge string) bool {
+	return codeVerifierPattern.MatchString(challenge)
+}
+
+// MakeCodeChallenge makes code_challenge from code_verifier by the method.
+func MakeCodeChallenge(verifier, method string) (string, error) {
+	switch method {
+	case "", "plain":
+		return verifier, nil
+	case "S256":
+		h := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(h[:]), nil
+	default:
+		return "", UnsupportedChallengeMethodError
+	}
+}
+
+// VerifyCodeVerifier checks code_verifier in the token request against code_challenge in the code.
+func (claims CodeClaims) VerifyCodeVerifier(verifier string) error {
+	if claims.CodeChallenge == "" {
+		if verifier != "" {
+			return UnexpectedCodeVerifierError
+		}
+		return nil
+	}
+
+	if verifier == "" {
+		return CodeVerifierRequiredError
+	}
+	if !codeVerifierPattern.MatchString(verifier) {
+		return InvalidCodeVerifierError
+	}
+
+	challenge, err := MakeCodeChallenge(verifier, claims.CodeChallengeMethod)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(claims.CodeChallenge)) != 1 {
+		return CodeVerifierMismatchError
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package token_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth/token"
+)
+
+func TestMakeCodeChallenge(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	tests := []struct {
+		Method string
+		Expect string
+		Error  error
+	}{
+		{"", verifier, nil},
+		{"plain", verifier, nil},
+		{"S256", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", nil},
+		{"S512", "", token.UnsupportedChallengeMethodError},
+	}
+
+	for _, tt := range tests {
+		challenge, err := token.MakeCodeChallenge(verifier, tt.Method)
+		if err != tt.Error {
+			t.Errorf("%s: unexpected error: %v", tt.Method, err)
+		} else if challenge != tt.Expect {
+			t.Errorf("%s: unexpected challenge: %s", tt.Method, challenge)
+		}
+	}
+}
+
+func TestCodeClaims_VerifyCodeVerifier(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	tests := []struct {
+		Claims   token.CodeClaims
+		Verifier string
+		Error    error
+	}{
+		{token.CodeClaims{}, "", nil},
+		{token.CodeClaims{}, verifier, token.UnexpectedCodeVerifierError},
+		{token.CodeClaims{CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", CodeChallengeMethod: "S256"}, verifier, nil},
+		{token.CodeClaims{CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", CodeChallengeMethod: "S256"}, "", token.CodeVerifierRequiredError},
+		{token.CodeClaims{CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", CodeChallengeMethod: "S256"}, "short", token.InvalidCodeVerifierError},
+		{token.CodeClaims{CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", CodeChallengeMethod: "S256"}, verifier[1:] + "x", token.CodeVerifierMismatchError},
+		{token.CodeClaims{CodeChallenge: verifier}, verifier, nil},
+		{token.CodeClaims{CodeChallenge: verifier, CodeChallengeMethod: "plain"}, verifier[1:] + "x", token.CodeVerifierMismatchError},
+	}
+
+	for i, tt := range tests {
+		if err := tt.Claims.VerifyCodeVerifier(tt.Verifier); err != tt.Error {
+			t.Errorf("%d: expected error %v but got %v", i, tt.Error, err)
+		}
+	}
+}
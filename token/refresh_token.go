@@ -3,12 +3,14 @@ package token
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/macrat/lauth/config"
 	"gopkg.in/dgrijalva/jwt-go.v3"
 )
 
 type RefreshTokenClaims struct {
 	OIDCClaims
+	VersionedClaims
 
 	ClientID string `json:"client_id"`
 	Scope    string `json:"scope,omitempty"`
@@ -36,17 +38,19 @@ func (m Manager) CreateRefreshToken(issuer *config.URL, subject, clientID, scope
 		OIDCClaims: OIDCClaims{
 			StandardClaims: jwt.StandardClaims{
 				Issuer:    issuer.String(),
+				Id:        uuid.New().String(),
 				Subject:   subject,
 				Audience:  issuer.String(),
-				ExpiresAt: time.Now().Add(expiresIn).Unix(),
-				IssuedAt:  time.Now().Unix(),
+				ExpiresAt: m.Now().Add(expiresIn).Unix(),
+				IssuedAt:  m.Now().Unix(),
 			},
 			Type:     "REFRESH_TOKEN",
 			AuthTime: authTime.Unix(),
 		},
-		ClientID: clientID,
-		Scope:    scope,
-		Nonce:    nonce,
+		VersionedClaims: currentVersion(),
+		ClientID:        clientID,
+		Scope:           scope,
+		Nonce:           nonce,
 	})
 }
 
@@ -55,5 +59,8 @@ func (m Manager) ParseRefreshToken(token string) (RefreshTokenClaims, error) {
 	if _, err := m.parse(token, "", &claims); err != nil {
 		return RefreshTokenClaims{}, err
 	}
+	if err := migrate(&claims); err != nil {
+		return RefreshTokenClaims{}, err
+	}
 	return claims, nil
 }
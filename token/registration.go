@@ -0,0 +1,80 @@
+package token
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+// RegistrationClaims is the claims of the link to verify email address for self-registration.
+type RegistrationClaims struct {
+	OIDCClaims
+	VersionedClaims
+
+	Email      string `json:"email"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Continue   string `json:"continue,omitempty"`
+}
+
+func (claims RegistrationClaims) Validate(issuer *config.URL) error {
+	if err := claims.OIDCClaims.Validate(issuer, issuer.String()); err != nil {
+		return err
+	}
+
+	if claims.Type != "REGISTRATION" {
+		return UnexpectedTokenTypeError
+	}
+
+	if claims.Subject == "" || claims.Email == "" {
+		return InvalidTokenError
+	}
+
+	return nil
+}
+
+func (m Manager) CreateRegistrationToken(issuer *config.URL, username, email, givenName, familyName, continueURL string, expiresIn time.Duration) (string, error) {
+	plain, err := json.Marshal(RegistrationClaims{
+		OIDCClaims: OIDCClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    issuer.String(),
+				Subject:   username,
+				Audience:  issuer.String(),
+				ExpiresAt: m.Now().Add(expiresIn).Unix(),
+				IssuedAt:  m.Now().Unix(),
+			},
+			Type: "REGISTRATION",
+		},
+		VersionedClaims: currentVersion(),
+		Email:           email,
+		GivenName:       givenName,
+		FamilyName:      familyName,
+		Continue:        continueURL,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return m.encrypt(plain)
+}
+
+func (m Manager) ParseRegistrationToken(token string) (RegistrationClaims, error) {
+	dec, err := m.decrypt(token)
+	if err != nil {
+		return RegistrationClaims{}, err
+	}
+
+	var claims RegistrationClaims
+	if err := json.Unmarshal(dec, &claims); err != nil {
+		return RegistrationClaims{}, err
+	}
+	if err := m.validateTime(&claims); err != nil {
+		return RegistrationClaims{}, err
+	}
+	if err := migrate(&claims); err != nil {
+		return RegistrationClaims{}, err
+	}
+	return claims, nil
+}
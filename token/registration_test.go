@@ -0,0 +1,51 @@
+package token_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestRegistrationToken(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	reg, err := tokenManager.CreateRegistrationToken(issuer, "someone", "someone@example.com", "some", "one", "/authz?client_id=foo", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate token: %s", err)
+	}
+
+	claims, err := tokenManager.ParseRegistrationToken(reg)
+	if err != nil {
+		t.Fatalf("failed to parse token: %s", err)
+	}
+
+	if err = claims.Validate(issuer); err != nil {
+		t.Errorf("failed to validate token: %s", err)
+	}
+
+	if claims.Subject != "someone" || claims.Email != "someone@example.com" || claims.Continue != "/authz?client_id=foo" {
+		t.Errorf("unexpected claims: %#v", claims)
+	}
+
+	if err = claims.Validate(&config.URL{Host: "another-issuer"}); err != token.UnexpectedIssuerError {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	code, err := tokenManager.CreateCode(issuer, "someone", "something", "http://something", "openid", "", time.Now(), 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate code: %s", err)
+	}
+	if claims, err := tokenManager.ParseRegistrationToken(code); err != nil {
+		t.Fatalf("failed to parse code: %s", err)
+	} else if err := claims.Validate(issuer); err != token.UnexpectedTokenTypeError {
+		t.Errorf("code must not be accepted as registration token: %v", err)
+	}
+}
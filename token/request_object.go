@@ -11,6 +11,7 @@ type RequestObjectClaims struct {
 	jwt.StandardClaims
 
 	ResponseType string `json:"response_type,omitempty"`
+	ResponseMode string `json:"response_mode,omitempty"`
 	ClientID     string `json:"client_id,omitempty"`
 	RedirectURI  string `json:"redirect_uri,omitempty"`
 	Scope        string `json:"scope,omitempty"`
@@ -19,6 +20,22 @@ type RequestObjectClaims struct {
 	MaxAge       int64  `json:"max_age,omitempty"`
 	Prompt       string `json:"prompt,omitempty"`
 	LoginHint    string `json:"login_hint,omitempty"`
+
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+
+	LoginSession string `json:"login_session,omitempty"`
+
+	// MFA is the pending second factor of the user who entered the correct password. It is set only in the login page.
+	MFA *MFAClaims `json:"mfa,omitempty"`
+}
+
+// MFAClaims is the state of the second factor between the login page and the MFA provider.
+type MFAClaims struct {
+	Subject  string `json:"sub"`
+	Provider string `json:"provider"`
+	Message  string `json:"message,omitempty"`
+	State    string `json:"state,omitempty"`
 }
 
 func (claims RequestObjectClaims) Validate(issuer string, audience *config.URL) error {
@@ -42,7 +59,7 @@ func (m Manager) CreateRequestObject(issuer *config.URL, subject string, request
 	request.Subject = subject
 	request.Audience = issuer.String()
 	request.ExpiresAt = expiresAt.Unix()
-	request.IssuedAt = time.Now().Unix()
+	request.IssuedAt = m.Now().Unix()
 
 	return m.create(request)
 }
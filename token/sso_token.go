@@ -1,6 +1,7 @@
 package token
 
 import (
+	"strings"
 	"time"
 
 	"github.com/macrat/lauth/config"
@@ -25,10 +26,78 @@ func (azp AuthorizedParties) Append(rp string) AuthorizedParties {
 	return append(azp, rp)
 }
 
+// ConsentAnyScope is the scope of Consents that covers any scope. It is used for the clients of SSO tokens that issued before consents were recorded.
+const ConsentAnyScope = "*"
+
+// Consents is the space separated scopes that the user consented for each client in the SSO session.
+type Consents map[string]string
+
+// Covers checks if the user already consented to all of the space separated scope for the client.
+func (c Consents) Covers(client, scope string) bool {
+	consented, ok := c[client]
+	if !ok {
+		return false
+	}
+	if consented == ConsentAnyScope {
+		return true
+	}
+
+	known := make(map[string]bool)
+	for _, s := range strings.Fields(consented) {
+		known[s] = true
+	}
+	for _, s := range strings.Fields(scope) {
+		if !known[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// Add makes a copy of Consents that also includes the scope for the client.
+func (c Consents) Add(client, scope string) Consents {
+	result := make(Consents, len(c)+1)
+	for k, v := range c {
+		result[k] = v
+	}
+
+	if result[client] == ConsentAnyScope {
+		return result
+	}
+
+	seen := make(map[string]bool)
+	var merged []string
+	for _, s := range append(strings.Fields(result[client]), strings.Fields(scope)...) {
+		if !seen[s] {
+			seen[s] = true
+			merged = append(merged, s)
+		}
+	}
+	result[client] = strings.Join(merged, " ")
+
+	return result
+}
+
 type SSOTokenClaims struct {
 	OIDCClaims
+	VersionedClaims
 
-	Authorized AuthorizedParties `json:"azp,omitempty"`
+	Authorized  AuthorizedParties `json:"azp,omitempty"`
+	Consents    Consents          `json:"cns,omitempty"`
+	Fingerprint string            `json:"fpt,omitempty"`
+
+	// MFA is the MFA providers that the user passed in this session.
+	MFA []string `json:"mfa,omitempty"`
+}
+
+// PassedMFA checks if the user passed the MFA provider in this session.
+func (claims SSOTokenClaims) PassedMFA(provider string) bool {
+	for _, p := range claims.MFA {
+		if p == provider {
+			return true
+		}
+	}
+	return false
 }
 
 func (claims SSOTokenClaims) Validate(issuer *config.URL) error {
@@ -43,20 +112,35 @@ func (claims SSOTokenClaims) Validate(issuer *config.URL) error {
 	return nil
 }
 
-func (m Manager) CreateSSOToken(issuer *config.URL, subject string, authorized AuthorizedParties, authTime time.Time, expiresAt time.Time) (string, error) {
+// CreateSSOToken makes a new SSO token.
+//
+// The id is the session ID that used as "jti" claim to revoke the token. It should be kept when renewing the token in the same session.
+// The fingerprint is the hash of the browser characteristics to bind the token. It can be empty if not bind.
+// The consents is the scopes that the user consented for each client, to decide whether to ask consent again.
+func (m Manager) CreateSSOToken(issuer *config.URL, id, subject, fingerprint string, authorized AuthorizedParties, consents Consents, authTime time.Time, expiresAt time.Time) (string, error) {
+	return m.CreateSSOTokenWithMFA(issuer, id, subject, fingerprint, authorized, consents, nil, authTime, expiresAt)
+}
+
+// CreateSSOTokenWithMFA makes a new SSO token the same as CreateSSOToken, and records the MFA providers that the user passed.
+func (m Manager) CreateSSOTokenWithMFA(issuer *config.URL, id, subject, fingerprint string, authorized AuthorizedParties, consents Consents, mfa []string, authTime time.Time, expiresAt time.Time) (string, error) {
 	return m.create(SSOTokenClaims{
 		OIDCClaims: OIDCClaims{
 			StandardClaims: jwt.StandardClaims{
+				Id:        id,
 				Issuer:    issuer.String(),
 				Subject:   subject,
 				Audience:  issuer.String(),
 				ExpiresAt: expiresAt.Unix(),
-				IssuedAt:  time.Now().Unix(),
+				IssuedAt:  m.Now().Unix(),
 			},
 			Type:     "SSO_TOKEN",
 			AuthTime: authTime.Unix(),
 		},
-		Authorized: authorized,
+		VersionedClaims: currentVersion(),
+		Authorized:      authorized,
+		Consents:        consents,
+		Fingerprint:     fingerprint,
+		MFA:             mfa,
 	})
 }
 
@@ -65,5 +149,8 @@ func (m Manager) ParseSSOToken(token string) (SSOTokenClaims, error) {
 	if _, err := m.parse(token, "", &claims); err != nil {
 		return SSOTokenClaims{}, err
 	}
+	if err := migrate(&claims); err != nil {
+		return SSOTokenClaims{}, err
+	}
 	return claims, nil
 }
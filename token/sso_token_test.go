@@ -35,6 +35,35 @@ func TestAuthorizedParties(t *testing.T) {
 	}
 }
 
+func TestConsents(t *testing.T) {
+	var consents token.Consents
+
+	if consents.Covers("some_client_id", "openid") {
+		t.Errorf("empty consents covers some_client_id")
+	}
+
+	consents = consents.Add("some_client_id", "openid profile")
+	consents = consents.Add("some_client_id", "email openid")
+
+	if c := consents["some_client_id"]; c != "openid profile email" {
+		t.Errorf("unexpected merged scope: %#v", c)
+	}
+	if !consents.Covers("some_client_id", "openid email") {
+		t.Errorf("expected to cover openid email but not")
+	}
+	if consents.Covers("some_client_id", "openid phone") {
+		t.Errorf("expected not to cover phone but covered")
+	}
+	if consents.Covers("another_client_id", "openid") {
+		t.Errorf("expected not to cover another client but covered")
+	}
+
+	consents = token.Consents{"legacy_client": token.ConsentAnyScope}.Add("legacy_client", "openid")
+	if !consents.Covers("legacy_client", "openid phone email") {
+		t.Errorf("ConsentAnyScope should cover any scope")
+	}
+}
+
 func TestSSOToken(t *testing.T) {
 	tokenManager, err := testutil.MakeTokenManager()
 	if err != nil {
@@ -45,8 +74,11 @@ func TestSSOToken(t *testing.T) {
 
 	ssoToken, err := tokenManager.CreateSSOToken(
 		issuer,
+		"session-id",
 		"someone",
+		"",
 		token.AuthorizedParties{"some_client_id"},
+		token.Consents{"some_client_id": token.ConsentAnyScope},
 		time.Now(),
 		time.Now().Add(10*time.Minute),
 	)
@@ -63,6 +95,10 @@ func TestSSOToken(t *testing.T) {
 		t.Errorf("failed to validate token: %s", err)
 	}
 
+	if claims.Id != "session-id" {
+		t.Errorf("unexpected session id: %#v", claims.Id)
+	}
+
 	if err = claims.Validate(&config.URL{Host: "another-issuer"}); err == nil {
 		t.Errorf("must be failed if issuer is incorrect but success")
 	} else if err != token.UnexpectedIssuerError {
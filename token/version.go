@@ -0,0 +1,67 @@
+package token
+
+// CurrentTokenVersion is the schema version of code, SSO token, and refresh token that this version of lauth issues.
+//
+// Please increment this and add a migration to tokenMigrations when changing the structure of these tokens.
+const CurrentTokenVersion = 2
+
+// OldestTokenVersion is the oldest schema version that this version of lauth accepts.
+//
+// Tokens older than this will be rejected instead of migrated.
+const OldestTokenVersion = 0
+
+// tokenMigrations[i] converts claims from version i to version i+1.
+var tokenMigrations = []func(claims interface{}) error{
+	// 0 -> 1: the "ver" claim was introduced. Other claims are the same.
+	func(claims interface{}) error {
+		return nil
+	},
+
+	// 1 -> 2: the "cns" claim of SSO token was introduced. Clients in "azp" of older tokens are treated as consented to any scope.
+	func(claims interface{}) error {
+		if sso, ok := claims.(*SSOTokenClaims); ok && sso.Consents == nil && len(sso.Authorized) > 0 {
+			sso.Consents = make(Consents)
+			for _, client := range sso.Authorized {
+				sso.Consents[client] = ConsentAnyScope
+			}
+		}
+		return nil
+	},
+}
+
+// VersionedClaims holds the schema version of internal tokens.
+//
+// Tokens without this claim are treated as version 0.
+type VersionedClaims struct {
+	Version int `json:"ver,omitempty"`
+}
+
+func (v *VersionedClaims) versionedClaims() *VersionedClaims {
+	return v
+}
+
+type versioned interface {
+	versionedClaims() *VersionedClaims
+}
+
+func currentVersion() VersionedClaims {
+	return VersionedClaims{Version: CurrentTokenVersion}
+}
+
+// migrate upgrades claims that issued by older lauth to the current version.
+func migrate(claims versioned) error {
+	v := claims.versionedClaims()
+
+	if v.Version < OldestTokenVersion || v.Version > CurrentTokenVersion {
+		return UnsupportedTokenVersionError
+	}
+
+	for v.Version < CurrentTokenVersion {
+		if err := tokenMigrations[v.Version](claims); err != nil {
+			return err
+		}
+		v.Version++
+	}
+
+	return nil
+}
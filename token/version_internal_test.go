@@ -0,0 +1,130 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func TestTokenVersion(t *testing.T) {
+	pri, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	m, err := NewManager(pri)
+	if err != nil {
+		t.Fatalf("failed to make manager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	oidc := OIDCClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    issuer.String(),
+			Subject:   "someone",
+			Audience:  issuer.String(),
+			ExpiresAt: time.Now().Add(10 * time.Minute).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+
+	tests := []struct {
+		Version int
+		Error   error
+	}{
+		{0, nil},
+		{CurrentTokenVersion, nil},
+		{CurrentTokenVersion + 1, UnsupportedTokenVersionError},
+		{-1, UnsupportedTokenVersionError},
+	}
+
+	for _, tt := range tests {
+		oidc.Type = "SSO_TOKEN"
+		sso, err := m.create(SSOTokenClaims{OIDCClaims: oidc, VersionedClaims: VersionedClaims{tt.Version}})
+		if err != nil {
+			t.Fatalf("failed to create SSO token: %s", err)
+		}
+		ssoClaims, err := m.ParseSSOToken(sso)
+		if err != tt.Error {
+			t.Errorf("version %d: unexpected error of SSO token: %v", tt.Version, err)
+		} else if err == nil && ssoClaims.Version != CurrentTokenVersion {
+			t.Errorf("version %d: SSO token was not migrated: %d", tt.Version, ssoClaims.Version)
+		}
+
+		oidc.Type = "REFRESH_TOKEN"
+		refresh, err := m.create(RefreshTokenClaims{OIDCClaims: oidc, VersionedClaims: VersionedClaims{tt.Version}, ClientID: "some_client_id"})
+		if err != nil {
+			t.Fatalf("failed to create refresh token: %s", err)
+		}
+		refreshClaims, err := m.ParseRefreshToken(refresh)
+		if err != tt.Error {
+			t.Errorf("version %d: unexpected error of refresh token: %v", tt.Version, err)
+		} else if err == nil && refreshClaims.Version != CurrentTokenVersion {
+			t.Errorf("version %d: refresh token was not migrated: %d", tt.Version, refreshClaims.Version)
+		}
+
+		oidc.Type = "CODE"
+		plain, err := json.Marshal(CodeClaims{OIDCClaims: oidc, VersionedClaims: VersionedClaims{tt.Version}, ClientID: "some_client_id"})
+		if err != nil {
+			t.Fatalf("failed to marshal code: %s", err)
+		}
+		code, err := m.encrypt(plain)
+		if err != nil {
+			t.Fatalf("failed to create code: %s", err)
+		}
+		codeClaims, err := m.ParseCode(code)
+		if err != tt.Error {
+			t.Errorf("version %d: unexpected error of code: %v", tt.Version, err)
+		} else if err == nil && codeClaims.Version != CurrentTokenVersion {
+			t.Errorf("version %d: code was not migrated: %d", tt.Version, codeClaims.Version)
+		}
+	}
+}
+
+func TestTokenVersion_Migrations(t *testing.T) {
+	if len(tokenMigrations) != CurrentTokenVersion {
+		t.Errorf("tokenMigrations should have %d migrations but has %d", CurrentTokenVersion, len(tokenMigrations))
+	}
+}
+
+func TestTokenVersion_SSOConsents(t *testing.T) {
+	pri, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	m, err := NewManager(pri)
+	if err != nil {
+		t.Fatalf("failed to make manager: %s", err)
+	}
+
+	sso, err := m.create(SSOTokenClaims{
+		OIDCClaims: OIDCClaims{
+			StandardClaims: jwt.StandardClaims{
+				Subject:   "someone",
+				ExpiresAt: time.Now().Add(10 * time.Minute).Unix(),
+			},
+			Type: "SSO_TOKEN",
+		},
+		VersionedClaims: VersionedClaims{1},
+		Authorized:      AuthorizedParties{"some_client_id"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	claims, err := m.ParseSSOToken(sso)
+	if err != nil {
+		t.Fatalf("failed to parse SSO token: %s", err)
+	}
+	if !claims.Consents.Covers("some_client_id", "openid profile") {
+		t.Errorf("clients of old SSO token should be consented to any scope: %#v", claims.Consents)
+	}
+	if claims.Consents.Covers("another_client_id", "openid") {
+		t.Errorf("unexpected consent for another client: %#v", claims.Consents)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/macrat/lauth/audit"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/token"
+	"github.com/spf13/cobra"
+)
+
+type VerifyAuditConfig struct {
+	SignKey string
+	Issuer  config.URL
+}
+
+var (
+	verifyAuditConfig = VerifyAuditConfig{}
+	verifyAuditCmd    = &cobra.Command{
+		Use:   "verify-audit FILE",
+		Short: "Verify hash chain and signatures of audit log",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			key, err := os.Open(verifyAuditConfig.SignKey)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to open sign key: %s\n", err)
+				os.Exit(1)
+			}
+			defer key.Close()
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to open audit log: %s\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			result, err := VerifyAudit(f, key, &verifyAuditConfig.Issuer)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "verification failed: %s\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("OK: %d entries, %d anchors, signed until seq %d\n", result.Entries, result.Anchors, result.LastAnchor)
+		},
+	}
+)
+
+func init() {
+	cmd.AddCommand(verifyAuditCmd)
+
+	flags := verifyAuditCmd.Flags()
+	flags.SortFlags = false
+
+	flags.StringVarP(&verifyAuditConfig.SignKey, "sign-key", "s", "", "RSA private key that used for signing by the server.")
+	flags.Var(&verifyAuditConfig.Issuer, "issuer", "Issuer URL of the server.")
+	verifyAuditCmd.MarkFlagRequired("sign-key")
+	verifyAuditCmd.MarkFlagRequired("issuer")
+}
+
+func VerifyAudit(log io.Reader, signKey io.Reader, issuer *config.URL) (audit.VerifyResult, error) {
+	manager, err := token.NewManagerFromFile(signKey)
+	if err != nil {
+		return audit.VerifyResult{}, err
+	}
+
+	return audit.Verify(log, func(anchor string) (uint64, string, error) {
+		claims, err := manager.ParseAuditAnchor(anchor)
+		if err != nil {
+			return 0, "", err
+		}
+		if err := claims.Validate(issuer); err != nil {
+			return 0, "", err
+		}
+		return claims.Seq, claims.Hash, nil
+	})
+}
@@ -0,0 +1,53 @@
+package main_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/macrat/lauth"
+	"github.com/macrat/lauth/audit"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/token"
+)
+
+func TestVerifyAudit(t *testing.T) {
+	pri, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	key := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(pri),
+	})
+
+	manager, err := token.NewManager(pri)
+	if err != nil {
+		t.Fatalf("failed to make token manager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "https", Host: "auth.example.com"}
+
+	buf := bytes.NewBuffer(nil)
+	l := audit.NewLogger(buf, func(seq uint64, hash string) (string, error) {
+		return manager.CreateAuditAnchor(issuer, seq, hash)
+	})
+	l.Record(map[string]string{"username": "macrat"})
+	l.Anchor()
+
+	result, err := main.VerifyAudit(bytes.NewReader(buf.Bytes()), bytes.NewReader(key), issuer)
+	if err != nil {
+		t.Fatalf("failed to verify: %s", err)
+	}
+	if result != (audit.VerifyResult{Entries: 2, Anchors: 1, LastAnchor: 2}) {
+		t.Errorf("unexpected result: %#v", result)
+	}
+
+	_, err = main.VerifyAudit(bytes.NewReader(buf.Bytes()), bytes.NewReader(key), &config.URL{Scheme: "https", Host: "another.example.com"})
+	if err == nil {
+		t.Errorf("expected error for another issuer but got nil")
+	}
+}